@@ -5,7 +5,6 @@ import (
 	"github.com/xuliangTang/mykubelet/pkg/core"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/tools/clientcmd"
-	"time"
 )
 
 const hostName = "mylain"
@@ -23,26 +22,7 @@ func main() {
 		fmt.Println("onAdd()", opts.Pod.Name)
 		opts.AddEvent("onAdd", "success")
 
-		// 获取容器cmd
-		//cmds := opts.GetCmdAndArgs()
-		//for _, cmd := range cmds {
-		//	fmt.Println(cmd.Args)
-		//}
-
-		cmds := opts.GetContainerCmds()
-		for _, cmd := range cmds {
-			go func(c *core.ContainerCmd) {
-				// 运行容器command
-				c.Run()
-				// 如果执行结束，根据执行后的exitCode设置容器状态 0为正常退出(completed) 否则为错误(error)
-				opts.SetContainerExit(c.ContainerName, c.ExitCode)
-			}(cmd)
-		}
-
-		// 设置容器为completed
-		time.Sleep(time.Second * 5)
-		opts.SetPodCompleted()
-
+		// 容器由运行时启动，状态由pleg同步到podCache
 		return nil
 	})
 
@@ -7,6 +7,7 @@ import (
 	v1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/apimachinery/pkg/util/validation/field"
 )
 
 // FindPort locates the container port for the given pod and portName.  If the
@@ -101,6 +102,36 @@ func VisitContainers(podSpec *v1.PodSpec, mask ContainerType, visitor ContainerV
 	return true
 }
 
+// ContainerVisitorWithPath is called with each container and the field.Path to that container,
+// and returns true if visiting should continue.
+type ContainerVisitorWithPath func(container *v1.Container, path *field.Path) bool
+
+// VisitContainersWithPath invokes the visitor function with a pointer to the spec
+// of every container in the given pod spec and the field.Path to that container.
+// If visitor returns false, visiting is short-circuited. VisitContainersWithPath returns true if visiting completes,
+// false if visiting was short-circuited.
+func VisitContainersWithPath(podSpec *v1.PodSpec, specPath *field.Path, visitor ContainerVisitorWithPath) bool {
+	fldPath := specPath.Child("initContainers")
+	for i := range podSpec.InitContainers {
+		if !visitor(&podSpec.InitContainers[i], fldPath.Index(i)) {
+			return false
+		}
+	}
+	fldPath = specPath.Child("containers")
+	for i := range podSpec.Containers {
+		if !visitor(&podSpec.Containers[i], fldPath.Index(i)) {
+			return false
+		}
+	}
+	fldPath = specPath.Child("ephemeralContainers")
+	for i := range podSpec.EphemeralContainers {
+		if !visitor((*v1.Container)(&podSpec.EphemeralContainers[i].EphemeralContainerCommon), fldPath.Index(i)) {
+			return false
+		}
+	}
+	return true
+}
+
 // VisitPodSecretNames invokes the visitor function with the name of every secret
 // referenced by the pod spec. If visitor returns false, visiting is short-circuited.
 // Transitive references (e.g. pod -> pvc -> pv -> secret) are not visited.
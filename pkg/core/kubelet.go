@@ -2,29 +2,55 @@ package core
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"github.com/xuliangTang/mykubelet/pkg/api/legacyscheme"
 	apisv1 "github.com/xuliangTang/mykubelet/pkg/apis/core/v1"
+	statsapi "github.com/xuliangTang/mykubelet/pkg/kubelet/apis/stats/v1alpha1"
+	"github.com/xuliangTang/mykubelet/pkg/kubelet/cm"
 	"github.com/xuliangTang/mykubelet/pkg/kubelet/config"
 	"github.com/xuliangTang/mykubelet/pkg/kubelet/configmap"
 	kubecontainer "github.com/xuliangTang/mykubelet/pkg/kubelet/container"
+	"github.com/xuliangTang/mykubelet/pkg/kubelet/cri/remote"
+	"github.com/xuliangTang/mykubelet/pkg/kubelet/events"
+	"github.com/xuliangTang/mykubelet/pkg/kubelet/images"
+	"github.com/xuliangTang/mykubelet/pkg/kubelet/lifecycle"
+	"github.com/xuliangTang/mykubelet/pkg/kubelet/logs"
+	"github.com/xuliangTang/mykubelet/pkg/kubelet/network/dns"
+	"github.com/xuliangTang/mykubelet/pkg/kubelet/pleg"
 	"github.com/xuliangTang/mykubelet/pkg/kubelet/pod"
 	"github.com/xuliangTang/mykubelet/pkg/kubelet/prober"
 	"github.com/xuliangTang/mykubelet/pkg/kubelet/prober/results"
+	"github.com/xuliangTang/mykubelet/pkg/kubelet/runtime/cni"
+	"github.com/xuliangTang/mykubelet/pkg/kubelet/runtime/cri"
+	"github.com/xuliangTang/mykubelet/pkg/kubelet/runtime/hostport"
+	"github.com/xuliangTang/mykubelet/pkg/kubelet/runtime/process"
 	"github.com/xuliangTang/mykubelet/pkg/kubelet/secret"
+	"github.com/xuliangTang/mykubelet/pkg/kubelet/stats"
 	"github.com/xuliangTang/mykubelet/pkg/kubelet/status"
 	kubetypes "github.com/xuliangTang/mykubelet/pkg/kubelet/types"
 	"github.com/xuliangTang/mykubelet/pkg/kubelet/util/queue"
+	"github.com/xuliangTang/mykubelet/pkg/kubelet/volumemanager"
 	v1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/types"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/apimachinery/pkg/util/wait"
 	"k8s.io/client-go/informers"
 	"k8s.io/client-go/kubernetes"
 	typedcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+	corelisters "k8s.io/client-go/listers/core/v1"
 	"k8s.io/client-go/tools/cache"
 	"k8s.io/client-go/tools/record"
+	"k8s.io/client-go/util/flowcontrol"
 	"k8s.io/klog/v2"
 	"k8s.io/utils/clock"
+	"math"
+	"net"
+	"net/http"
 	"os/exec"
+	"sort"
+	"strings"
+	"sync"
 	"time"
 )
 
@@ -33,14 +59,15 @@ type CallBackOptions struct {
 	Pod *v1.Pod
 
 	eventRecorder record.EventRecorder
-	podCache      kubecontainer.Cache
+	statsProvider stats.Provider
 }
 
-// GetCmdAndArgs 获取pod的commands和args
+// GetCmdAndArgs 获取pod的commands和args，initContainers排在前面
 func (c *CallBackOptions) GetCmdAndArgs() []*exec.Cmd {
 	var ret []*exec.Cmd
 
-	for _, container := range c.Pod.Spec.Containers {
+	containers := append(append([]v1.Container{}, c.Pod.Spec.InitContainers...), c.Pod.Spec.Containers...)
+	for _, container := range containers {
 		if len(container.Command) == 0 {
 			continue
 		}
@@ -56,58 +83,98 @@ func (c *CallBackOptions) GetCmdAndArgs() []*exec.Cmd {
 	return ret
 }
 
-// GetContainerCmds 获取pod的commands和args 封装为ContainerCmd对象
-func (c *CallBackOptions) GetContainerCmds() []*ContainerCmd {
-	var ret []*ContainerCmd
-
-	for _, container := range c.Pod.Spec.Containers {
-		if len(container.Command) == 0 {
-			continue
-		}
-
-		var args []string
-		if len(container.Command) > 1 {
-			args = append(args, container.Command[1:]...)
-		}
-		args = append(args, container.Args...)
-		cmd := exec.Command(container.Command[0], args...)
-		ret = append(ret, &ContainerCmd{
-			Cmd:           cmd,
-			ContainerName: container.Name,
-		})
-	}
-
-	return ret
-}
-
 // AddEvent 记录normal事件
 func (c *CallBackOptions) AddEvent(reason, msg string) {
 	c.eventRecorder.Event(c.Pod, v1.EventTypeNormal, reason, msg)
 }
 
-// SetPodCompleted 设置pod状态为completed
-func (c *CallBackOptions) SetPodCompleted() {
-	podStatus := SetPodCompleted(c.Pod)
-	c.podCache.Set(c.Pod.UID, podStatus, nil, time.Now())
+// GetPodStats 获取pod最近一次采样的资源使用
+func (c *CallBackOptions) GetPodStats() (*statsapi.PodStats, bool) {
+	if c.statsProvider == nil {
+		return nil, false
+	}
+	return c.statsProvider.GetPodStats(c.Pod.UID)
 }
 
-// SetContainerExit 设置pod其中一个容器为退出
-func (c *CallBackOptions) SetContainerExit(containerName string, exitCode int) {
-	// 获取缓存中的podStatus
-	getPodStatus, err := c.podCache.Get(c.Pod.UID)
-	if err != nil {
-		klog.Error(err)
-		return
+// GetContainerStats 获取pod中指定容器最近一次采样的资源使用
+func (c *CallBackOptions) GetContainerStats(containerName string) (*statsapi.ContainerStats, bool) {
+	if c.statsProvider == nil {
+		return nil, false
 	}
-
-	// 重新设置指定容器的状态
-	podStatus := SetContainerExit(getPodStatus, c.Pod, containerName, exitCode)
-
-	c.podCache.Set(c.Pod.UID, podStatus, nil, time.Now())
+	return c.statsProvider.GetContainerStats(c.Pod.UID, containerName)
 }
 
 type CallBackFn func(opts *CallBackOptions) error
 
+const (
+	// Capacity of the channel for receiving pod lifecycle events. This number
+	// is a bit arbitrary and may be adjusted in the future.
+	plegChannelCapacity = 1000
+
+	// Generic PLEG relies on relisting for discovering container events.
+	// A longer period means that kubelet will take longer to detect container
+	// changes and to update pod status. On the other hand, a shorter period
+	// will cause more frequent relisting (e.g., container runtime operations),
+	// leading to higher cpu usage.
+	plegRelistPeriod = time.Second * 1
+
+	// syncFrequency is the interval at which pods due for a resync are picked
+	// up from the work queue.
+	syncFrequency = time.Second * 1
+
+	// Period for performing global cleanup tasks.
+	housekeepingPeriod = time.Second * 2
+
+	// MaxContainerBackOff is the max backoff period, exported for the e2e test
+	MaxContainerBackOff = 300 * time.Second
+
+	// backOffPeriod is the period to back off when pod restarting
+	backOffPeriod = time.Second * 10
+
+	// ContainerGCPeriod is the period for performing container garbage collection.
+	ContainerGCPeriod = time.Minute
+	// ImageGCPeriod is the period for performing image garbage collection.
+	ImageGCPeriod = 5 * time.Minute
+
+	// defaults of the container garbage collection policy
+	defaultMinimumGCAge            = 0
+	defaultMaxPerPodContainerCount = 1
+	defaultMaxContainerCount       = -1
+
+	// defaults of the image garbage collection policy
+	defaultImageGCHighThresholdPercent = 85
+	defaultImageGCLowThresholdPercent  = 80
+	defaultImageMinimumGCAge           = 2 * time.Minute
+
+	// defaultContainerLogMaxSize is the size a container log file may reach before it is rotated
+	defaultContainerLogMaxSize = 10 * 1024 * 1024
+	// defaultContainerLogMaxFiles is the maximum number of log files kept per container
+	defaultContainerLogMaxFiles = 5
+
+	// defaults of the address the kubelet server listens on
+	defaultAddress = "0.0.0.0"
+	defaultPort    = 10250
+
+	// remoteRuntimeRequestTimeout is the timeout of the requests to a CRI runtime, except image pulls
+	remoteRuntimeRequestTimeout = 2 * time.Minute
+
+	// maxWaitForContainerRuntime is the max time the container runtime may go
+	// without a successful status check before it is considered down.
+	maxWaitForContainerRuntime = 30 * time.Second
+
+	// runtimeUpdatePeriod is the period the status of the container runtime is checked at.
+	runtimeUpdatePeriod = 5 * time.Second
+
+	// NetworkNotReadyErrorMsg is the message of the error a pod not using the
+	// host network fails to sync with while the runtime network is not ready.
+	NetworkNotReadyErrorMsg = "network is not ready"
+)
+
+var (
+	// ErrNetworkUnknown indicates the network state is unknown
+	ErrNetworkUnknown = errors.New("network state unknown")
+)
+
 type MyKubelet struct {
 	KubeClient    kubernetes.Interface
 	HostName      string
@@ -119,12 +186,287 @@ type MyKubelet struct {
 	probeManager  prober.Manager
 	reasonCache   *ReasonCache
 	Clock         clock.RealClock
+	recorder      record.EventRecorder
+
+	// kubelet数据目录
+	rootDirectory string
+	// 容器日志目录及轮转策略
+	podLogsDirectory     string
+	containerLogMaxSize  int64
+	containerLogMaxFiles int
+	// 容器运行时
+	containerRuntime kubecontainer.Runtime
+	// 在容器中执行命令，供exec探针使用
+	runner kubecontainer.CommandRunner
+	// 返回exec、attach和port-forward的流式请求地址，请求由streamingHandler处理
+	streamingRuntime kubecontainer.StreamingRuntime
+	streamingHandler http.Handler
+	// 通过relist运行时生成容器生命周期事件
+	pleg pleg.PodLifecycleEventGenerator
+	// 定期检查的容器运行时及其网络的健康状态，运行时不健康时暂停pod同步，node变为NotReady
+	runtimeState     *runtimeState
+	updateRuntimeMux sync.Mutex
+	// 保护podCIDR的更新，node的podCIDR变化时通知容器运行时，由运行时从中为pod分配IP
+	updatePodCIDRMux sync.Mutex
+	// 运行时首次就绪时启动依赖运行时的模块
+	oneTimeInitializer sync.Once
+	// 需要重新sync的pod队列
+	workQueue queue.WorkQueue
+	// 所有pod来源是否都已就绪
+	sourcesReady config.SourcesReady
+	// 容器重启的退避，key为pod和容器的组合
+	backOff *flowcontrol.Backoff
+
+	// 用于解析容器环境变量中引用的secret和configMap
+	secretManager    secret.Manager
+	configMapManager configmap.Manager
+	nodeLister       corelisters.NodeLister
+
+	// 将pod的volume物化到pod目录下
+	volumeManager volumemanager.VolumeManager
+
+	// 通过cgroup v2限制容器资源，cgroup不可用时不做限制
+	containerManager cm.ContainerManager
+	cgroupRoot       string
+	podPidsLimit     int64
+	// 为每个pod创建独立的PID、UTS、IPC和mount namespace，容器运行在镜像的根文件系统中
+	namespaceIsolation bool
+	// CRI运行时的unix socket地址，设置时通过CRI运行时运行容器，否则以进程运行容器
+	remoteRuntimeEndpoint string
+	// CNI网络配置目录和插件目录，设置时非hostNetwork的pod拥有独立的network namespace，由CNI插件配置网络
+	cniConfDir string
+	cniBinDir  string
+	// 集群DNS的IP和集群域名，dnsPolicy为ClusterFirst的pod使用集群DNS；
+	// resolverConfig为dnsPolicy为Default的pod使用的宿主机DNS配置文件
+	clusterDNS     []net.IP
+	clusterDomain  string
+	resolverConfig string
+	// 生成pod的DNS配置，写入pod目录下的resolv.conf
+	dnsConfigurer *dns.Configurer
+	// pod准入检查，任一handler拒绝则pod被拒绝
+	admitHandlers lifecycle.PodAdmitHandlers
+
+	// 采样容器的资源使用，在内存中保留最近一段时间的数据
+	statsProvider stats.Provider
+	// 更新node状态的函数
+	setNodeStatusFuncs []func(*v1.Node) error
+	// 容器垃圾回收，删除已退出容器的记录、日志和数据目录
+	containerGC       kubecontainer.GC
+	containerGCPolicy kubecontainer.GCPolicy
+	// 镜像垃圾回收，镜像文件系统使用率超过高水位时删除最久未使用的镜像，直到低于低水位
+	imageManager  images.ImageGCManager
+	imageGCPolicy images.ImageGCPolicy
+
+	// kubelet server的监听地址和端口，端口为0时不启动server
+	address string
+	port    int
+	// kubelet server的TLS证书和私钥，未设置时使用rootDirectory下自签名的证书；
+	// 只接受由clientCAFile签发的客户端证书，未设置clientCAFile时不启动server
+	tlsCertFile       string
+	tlsPrivateKeyFile string
+	clientCAFile      string
+	// 允许访问kubelet server的用户和组，均为空时通过SubjectAccessReview由apiserver鉴权
+	authorizedUsers  []string
+	authorizedGroups []string
 
 	// 回调
 	onAdd, onUpdate, onDelete, onRemove CallBackFn
 }
 
-func NewMyKubelet(client kubernetes.Interface, hostName string) *MyKubelet {
+// Option 用于设置MyKubelet的可选参数
+type Option func(*MyKubelet)
+
+// WithRootDir 设置kubelet数据目录，默认为DefaultRootDir
+func WithRootDir(rootDir string) Option {
+	return func(m *MyKubelet) {
+		m.rootDirectory = rootDir
+	}
+}
+
+// WithPodLogsDir 设置容器日志目录，默认为DefaultPodLogsDir
+func WithPodLogsDir(podLogsDir string) Option {
+	return func(m *MyKubelet) {
+		m.podLogsDirectory = podLogsDir
+	}
+}
+
+// WithContainerLogRotation 设置单个容器日志文件轮转前的最大字节数，以及保留的最大文件数
+func WithContainerLogRotation(maxSize int64, maxFiles int) Option {
+	return func(m *MyKubelet) {
+		m.containerLogMaxSize = maxSize
+		m.containerLogMaxFiles = maxFiles
+	}
+}
+
+// WithCgroupRoot 设置pod cgroup的父cgroup，默认为DefaultCgroupRoot
+func WithCgroupRoot(cgroupRoot string) Option {
+	return func(m *MyKubelet) {
+		m.cgroupRoot = cgroupRoot
+	}
+}
+
+// WithPodPidsLimit 设置单个pod的最大进程数，默认-1不限制
+func WithPodPidsLimit(podPidsLimit int64) Option {
+	return func(m *MyKubelet) {
+		m.podPidsLimit = podPidsLimit
+	}
+}
+
+// WithNamespaceIsolation 开启后pod中的容器运行在pod独立的namespace中，hostPID、hostIPC和hostNetwork的pod仍使用宿主机的对应namespace；
+// 容器镜像被拉取到本地镜像存储，容器chroot到镜像的根文件系统中运行
+func WithNamespaceIsolation(enabled bool) Option {
+	return func(m *MyKubelet) {
+		m.namespaceIsolation = enabled
+	}
+}
+
+// WithRemoteRuntimeEndpoint 设置CRI运行时（如containerd）的unix socket地址，容器和镜像由该运行时管理；
+// 运行时只需支持CRI v1alpha2，exec、attach和port-forward的流式请求不经kubelet server转发
+func WithRemoteRuntimeEndpoint(endpoint string) Option {
+	return func(m *MyKubelet) {
+		m.remoteRuntimeEndpoint = endpoint
+	}
+}
+
+// WithCNI 设置CNI网络配置目录和插件目录，仅在开启namespace隔离时生效；
+// 非hostNetwork的pod运行在独立的network namespace中，创建sandbox时调用插件的ADD，销毁时调用DEL，并定期CHECK；
+// 目录为空时使用默认的/etc/cni/net.d和/opt/cni/bin
+func WithCNI(confDir, binDir string) Option {
+	return func(m *MyKubelet) {
+		if confDir == "" {
+			confDir = cni.DefaultConfDir
+		}
+		if binDir == "" {
+			binDir = cni.DefaultBinDir
+		}
+		m.cniConfDir = confDir
+		m.cniBinDir = binDir
+	}
+}
+
+// WithClusterDNS 设置集群DNS的IP和集群域名；dnsPolicy为ClusterFirst的pod只使用集群DNS，
+// 并在search中加入<namespace>.svc.<domain>、svc.<domain>和<domain>；未设置集群DNS时回退为Default
+func WithClusterDNS(clusterDNS []net.IP, clusterDomain string) Option {
+	return func(m *MyKubelet) {
+		m.clusterDNS = clusterDNS
+		m.clusterDomain = clusterDomain
+	}
+}
+
+// WithResolverConfig 设置dnsPolicy为Default的pod使用的DNS配置文件，默认为/etc/resolv.conf；
+// 为空时pod的nameserver为127.0.0.1
+func WithResolverConfig(resolverConfig string) Option {
+	return func(m *MyKubelet) {
+		m.resolverConfig = resolverConfig
+	}
+}
+
+// WithContainerGCPolicy 设置已退出容器被回收前的最小存在时间，每个pod中每个容器保留的最大已退出实例数，以及节点上保留的最大已退出容器数；小于0为不限制
+func WithContainerGCPolicy(minAge time.Duration, maxPerPodContainer, maxContainers int) Option {
+	return func(m *MyKubelet) {
+		m.containerGCPolicy = kubecontainer.GCPolicy{
+			MinAge:             minAge,
+			MaxPerPodContainer: maxPerPodContainer,
+			MaxContainers:      maxContainers,
+		}
+	}
+}
+
+// WithImageGCPolicy 设置镜像垃圾回收的高低水位百分比，以及镜像可被回收的最小存在时间；高水位为100时不做镜像垃圾回收
+func WithImageGCPolicy(highThresholdPercent, lowThresholdPercent int, minAge time.Duration) Option {
+	return func(m *MyKubelet) {
+		m.imageGCPolicy = images.ImageGCPolicy{
+			HighThresholdPercent: highThresholdPercent,
+			LowThresholdPercent:  lowThresholdPercent,
+			MinAge:               minAge,
+		}
+	}
+}
+
+// WithServer 设置kubelet server的监听地址和端口，默认为0.0.0.0:10250；端口为0或未通过WithServerTLS设置
+// clientCAFile时不启动server，apiserver无法对该节点上的pod执行exec、attach和port-forward
+func WithServer(address string, port int) Option {
+	return func(m *MyKubelet) {
+		m.address = address
+		m.port = port
+	}
+}
+
+// WithServerTLS 设置kubelet server的TLS证书和私钥，以及校验客户端证书的CA；clientCAFile为空时不启动server
+func WithServerTLS(certFile, keyFile, clientCAFile string) Option {
+	return func(m *MyKubelet) {
+		m.tlsCertFile = certFile
+		m.tlsPrivateKeyFile = keyFile
+		m.clientCAFile = clientCAFile
+	}
+}
+
+// WithServerAllowList 设置允许访问kubelet server的用户和组，用户为客户端证书的CN，组为其O；
+// 未设置时通过SubjectAccessReview询问apiserver用户能否访问node的proxy子资源
+func WithServerAllowList(users, groups []string) Option {
+	return func(m *MyKubelet) {
+		m.authorizedUsers = users
+		m.authorizedGroups = groups
+	}
+}
+
+// newContainerRuntime 创建容器运行时：设置了remoteRuntimeEndpoint时连接CRI运行时，否则以进程运行容器；
+// 进程运行时的流式请求由kubelet server处理
+func (m *MyKubelet) newContainerRuntime(recorder record.EventRecorder) (cri.CRIRuntime, error) {
+	imageBackOff := flowcontrol.NewBackOff(backOffPeriod, MaxContainerBackOff)
+	if m.remoteRuntimeEndpoint != "" {
+		runtimeService, err := remote.NewRemoteRuntimeService(m.remoteRuntimeEndpoint, remoteRuntimeRequestTimeout)
+		if err != nil {
+			return nil, err
+		}
+		imageService, err := remote.NewRemoteImageService(m.remoteRuntimeEndpoint, remoteRuntimeRequestTimeout)
+		if err != nil {
+			return nil, err
+		}
+		return cri.NewCRIRuntimeManager(
+			runtimeService,
+			imageService,
+			m.podLogsDirectory,
+			m,
+			m.PodWorkers.(*podWorkers),
+			recorder,
+			imageBackOff)
+	}
+
+	var networkPlugin *cni.Plugin
+	if m.cniConfDir != "" {
+		if !m.namespaceIsolation {
+			klog.InfoS("CNI is ignored without namespace isolation, pods share the network of the host")
+		} else {
+			var err error
+			networkPlugin, err = cni.NewPlugin(m.cniConfDir, []string{m.cniBinDir}, m.getCNIDir())
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	runtime, err := process.NewProcessRuntimeManager(
+		m.getRuntimeDir(),
+		m.podLogsDirectory,
+		logs.LogRotatePolicy{
+			MaxSize:  m.containerLogMaxSize,
+			MaxFiles: m.containerLogMaxFiles,
+		},
+		m,
+		m.PodWorkers.(*podWorkers),
+		recorder,
+		m.namespaceIsolation,
+		networkPlugin,
+		m.getHostIPsAnyWay,
+		imageBackOff)
+	if err != nil {
+		return nil, err
+	}
+	m.streamingHandler = runtime
+	return runtime, nil
+}
+
+func NewMyKubelet(client kubernetes.Interface, hostName string, opts ...Option) *MyKubelet {
 	fact := informers.NewSharedInformerFactory(client, 0)
 	fact.Core().V1().Nodes().Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{})
 	nodeLister := fact.Core().V1().Nodes().Lister()
@@ -154,29 +496,108 @@ func NewMyKubelet(client kubernetes.Interface, hostName string) *MyKubelet {
 	}, podConfig.Channel(kubetypes.ApiserverSource)) // 关联configCh，会把相关的内容注入到ch里
 
 	mykubelet := &MyKubelet{
-		KubeClient:  client,
-		HostName:    hostName,
-		PodConfig:   podConfig,
-		PodManager:  podManager,
-		reasonCache: NewReasonCache(),
+		KubeClient:    client,
+		HostName:      hostName,
+		PodConfig:     podConfig,
+		PodManager:    podManager,
+		reasonCache:   NewReasonCache(),
+		recorder:      eventRecorder,
+		rootDirectory: DefaultRootDir,
+		sourcesReady:  config.NewSourcesReady(podConfig.SeenAllSources),
+		backOff:       flowcontrol.NewBackOff(backOffPeriod, MaxContainerBackOff),
+
+		podLogsDirectory:     DefaultPodLogsDir,
+		containerLogMaxSize:  defaultContainerLogMaxSize,
+		containerLogMaxFiles: defaultContainerLogMaxFiles,
+		cgroupRoot:           DefaultCgroupRoot,
+		podPidsLimit:         -1,
+		resolverConfig:       kubetypes.ResolvConfDefault,
+		address:              defaultAddress,
+		port:                 defaultPort,
+		containerGCPolicy: kubecontainer.GCPolicy{
+			MinAge:             defaultMinimumGCAge,
+			MaxPerPodContainer: defaultMaxPerPodContainerCount,
+			MaxContainers:      defaultMaxContainerCount,
+		},
+		imageGCPolicy: images.ImageGCPolicy{
+			HighThresholdPercent: defaultImageGCHighThresholdPercent,
+			LowThresholdPercent:  defaultImageGCLowThresholdPercent,
+			MinAge:               defaultImageMinimumGCAge,
+		},
+
+		secretManager:    secretManager,
+		configMapManager: configMapManager,
+		nodeLister:       nodeLister,
 	}
+	for _, opt := range opts {
+		opt(mykubelet)
+	}
+	if mykubelet.port > 0 && mykubelet.clientCAFile == "" {
+		klog.InfoS("Kubelet server is disabled, a client CA file is required to authenticate exec, attach and port-forward requests")
+		mykubelet.port = 0
+	}
+
+	// 初始化dnsConfigurer
+	mykubelet.dnsConfigurer = dns.NewConfigurer(eventRecorder, mykubelet.nodeRef(), mykubelet.clusterDNS, mykubelet.clusterDomain, mykubelet.resolverConfig)
+
+	// 初始化volumeManager
+	mykubelet.volumeManager = volumemanager.NewVolumeManager(&kubeletVolumeHost{kubelet: mykubelet})
 
-	// 初始化podWorker
+	// 初始化containerManager
+	mykubelet.containerManager = cm.NewContainerManager(cm.NodeConfig{
+		CgroupRoot:   mykubelet.cgroupRoot,
+		PodPidsLimit: mykubelet.podPidsLimit,
+	})
+
+	// 初始化podWorker，容器运行时通过它判断pod是否已被删除
 	mykubelet.Clock = clock.RealClock{}
 	mykubelet.PodCache = kubecontainer.NewCache()
-	workQueue := queue.NewBasicWorkQueue(mykubelet.Clock)
+	mykubelet.workQueue = queue.NewBasicWorkQueue(mykubelet.Clock)
 	mykubelet.PodWorkers = NewPodWorkers(
 		mykubelet.syncPod,
 		mykubelet.syncTerminatingPod,
 		mykubelet.syncTerminatedPod,
 		eventRecorder,
-		workQueue,
+		mykubelet.workQueue,
 		time.Second*1,
 		time.Second*10,
 		mykubelet.PodCache,
 		mykubelet.PodManager,
 	)
 
+	// 初始化容器运行时
+	runtime, err := mykubelet.newContainerRuntime(eventRecorder)
+	if err != nil {
+		klog.Fatalln("初始化容器运行时失败:", err)
+	}
+	mykubelet.containerRuntime = runtime
+	mykubelet.runner = runtime
+	mykubelet.streamingRuntime = runtime
+
+	// 初始化镜像垃圾回收
+	imageManager, err := images.NewImageGCManager(runtime, runtime, eventRecorder, mykubelet.nodeRef(), mykubelet.imageGCPolicy)
+	if err != nil {
+		klog.Fatalln("初始化镜像垃圾回收失败:", err)
+	}
+	mykubelet.imageManager = imageManager
+
+	// 初始化容器垃圾回收
+	containerGC, err := kubecontainer.NewContainerGC(runtime, mykubelet.containerGCPolicy, mykubelet.sourcesReady)
+	if err != nil {
+		klog.Fatalln("初始化容器垃圾回收失败:", err)
+	}
+	mykubelet.containerGC = containerGC
+
+	// 初始化statsProvider
+	mykubelet.statsProvider = stats.NewProvider(runtime, mykubelet.GetPodDir)
+
+	// 初始化pleg
+	mykubelet.pleg = pleg.NewGenericPLEG(mykubelet.containerRuntime, plegChannelCapacity, plegRelistPeriod, mykubelet.PodCache, mykubelet.Clock)
+
+	// 初始化runtimeState，pleg长时间未能relist时同样视为运行时不健康
+	mykubelet.runtimeState = newRuntimeState(maxWaitForContainerRuntime)
+	mykubelet.runtimeState.addHealthCheck("PLEG", mykubelet.pleg.Healthy)
+
 	// 初始化statusManager
 	mykubelet.statusManager = status.NewManager(client, mykubelet.PodManager, mykubelet)
 
@@ -187,9 +608,23 @@ func NewMyKubelet(client kubernetes.Interface, hostName string) *MyKubelet {
 		lm,
 		rm,
 		sm,
-		&ContainerCommandRunner{},
+		mykubelet.runner,
+		mykubelet.podSharesHostNetwork,
 		eventRecorder)
 
+	// 以进程运行容器时，拒绝请求了进程运行时无法实施的securityContext字段的pod；CRI运行时自行实施这些字段
+	if mykubelet.remoteRuntimeEndpoint == "" {
+		mykubelet.admitHandlers.AddPodAdmitHandler(lifecycle.NewSecurityContextAdmitHandler())
+	}
+	// 拒绝hostPort与其他活跃pod冲突的pod；进程运行时为拥有独立网络的pod转发hostPort，还要拒绝其不支持的协议
+	var forwardedProtocols []v1.Protocol
+	if mykubelet.remoteRuntimeEndpoint == "" && mykubelet.namespaceIsolation && mykubelet.cniConfDir != "" {
+		forwardedProtocols = hostport.ForwardedProtocols
+	}
+	mykubelet.admitHandlers.AddPodAdmitHandler(lifecycle.NewHostPortAdmitHandler(forwardedProtocols))
+
+	mykubelet.setNodeStatusFuncs = mykubelet.defaultNodeStatusFuncs()
+
 	return mykubelet
 }
 
@@ -223,30 +658,295 @@ func (m *MyKubelet) Run() {
 	klog.Info("边缘Kubelet开始启动")
 	m.StartStatusManager()
 
-	for item := range m.PodConfig.Updates() {
-		switch item.Op {
+	// 启动containerManager，创建QoS cgroup
+	if err := m.containerManager.Start(m.GetActivePods); err != nil {
+		klog.ErrorS(err, "Failed to start ContainerManager, container resources will not be enforced")
+	}
+	// 开始记录镜像的使用情况，并定期对容器和镜像进行垃圾回收
+	m.imageManager.Start()
+	m.StartGarbageCollection()
+	// 启动kubelet server，处理apiserver转发的exec、attach和port-forward请求
+	if m.port > 0 {
+		go wait.Until(m.ListenAndServe, time.Second*5, wait.NeverStop)
+	}
+	// 定期检查容器运行时的状态，并更新node状态
+	go wait.Until(m.updateRuntimeUp, runtimeUpdatePeriod, wait.NeverStop)
+	go wait.Until(m.syncNodeStatus, nodeStatusUpdateFrequency, wait.NeverStop)
+
+	// 启动pleg，由它驱动podCache的更新
+	m.pleg.Start()
+	m.syncLoop(m.PodConfig.Updates())
+}
+
+// updateRuntimeUp calls the container runtime status callback, initializing
+// the runtime dependent modules when the container runtime first comes up,
+// and returns an error if the status check fails.  If the status check is OK,
+// update the container runtime uptime in the kubelet runtimeState.
+func (m *MyKubelet) updateRuntimeUp() {
+	m.updateRuntimeMux.Lock()
+	defer m.updateRuntimeMux.Unlock()
+
+	s, err := m.containerRuntime.Status()
+	if err != nil {
+		klog.ErrorS(err, "Container runtime sanity check failed")
+		return
+	}
+	if s == nil {
+		klog.ErrorS(nil, "Container runtime status is nil")
+		return
+	}
+	// Periodically log the whole runtime status for debugging.
+	klog.V(4).InfoS("Container runtime status", "status", s)
+	networkReady := s.GetRuntimeCondition(kubecontainer.NetworkReady)
+	if networkReady == nil || !networkReady.Status {
+		klog.ErrorS(nil, "Container runtime network not ready", "networkReady", networkReady)
+		m.runtimeState.setNetworkState(fmt.Errorf("container runtime network not ready: %v", networkReady))
+	} else {
+		// Set nil if the container runtime network is ready.
+		m.runtimeState.setNetworkState(nil)
+	}
+	// information in RuntimeReady condition will be propagated to NodeReady condition.
+	runtimeReady := s.GetRuntimeCondition(kubecontainer.RuntimeReady)
+	// If RuntimeReady is not set or is false, report an error.
+	if runtimeReady == nil || !runtimeReady.Status {
+		klog.ErrorS(nil, "Container runtime not ready", "runtimeReady", runtimeReady)
+		m.runtimeState.setRuntimeState(fmt.Errorf("container runtime not ready: %v", runtimeReady))
+		return
+	}
+	m.runtimeState.setRuntimeState(nil)
+	m.oneTimeInitializer.Do(m.initializeRuntimeDependentModules)
+	m.runtimeState.setRuntimeSync(m.Clock.Now())
+}
+
+// initializeRuntimeDependentModules will initialize internal modules that require the container runtime to be up.
+func (m *MyKubelet) initializeRuntimeDependentModules() {
+	// 开始采样容器的资源使用
+	m.statsProvider.Start()
+}
+
+// StartGarbageCollection starts garbage collection threads.
+func (m *MyKubelet) StartGarbageCollection() {
+	loggedContainerGCFailure := false
+	go wait.Until(func() {
+		if err := m.containerGC.GarbageCollect(); err != nil {
+			klog.ErrorS(err, "Container garbage collection failed")
+			m.recorder.Eventf(m.nodeRef(), v1.EventTypeWarning, events.ContainerGCFailed, err.Error())
+			loggedContainerGCFailure = true
+		} else {
+			var vLevel klog.Level = 4
+			if loggedContainerGCFailure {
+				vLevel = 1
+				loggedContainerGCFailure = false
+			}
+
+			klog.V(vLevel).InfoS("Container garbage collection succeeded")
+		}
+	}, ContainerGCPeriod, wait.NeverStop)
+
+	// when the high threshold is set to 100, stub the image GC manager
+	if m.imageGCPolicy.HighThresholdPercent == 100 {
+		klog.V(2).InfoS("ImageGCHighThresholdPercent is set 100, Disable image GC")
+		return
+	}
+
+	prevImageGCFailed := false
+	go wait.Until(func() {
+		if err := m.imageManager.GarbageCollect(); err != nil {
+			if prevImageGCFailed {
+				klog.ErrorS(err, "Image garbage collection failed multiple times in a row")
+				// Only create an event for repeated failures
+				m.recorder.Eventf(m.nodeRef(), v1.EventTypeWarning, events.ImageGCFailed, err.Error())
+			} else {
+				klog.ErrorS(err, "Image garbage collection failed once. Stats initialization may not have completed yet")
+			}
+			prevImageGCFailed = true
+			if errors.Is(err, images.ErrFreeDiskSpace) {
+				m.reclaimDiskSpace()
+			}
+		} else {
+			var vLevel klog.Level = 4
+			if prevImageGCFailed {
+				vLevel = 1
+				prevImageGCFailed = false
+			}
+
+			klog.V(vLevel).InfoS("Image garbage collection succeeded")
+		}
+	}, ImageGCPeriod, wait.NeverStop)
+}
+
+// reclaimDiskSpace frees what pods do not need anymore when image garbage
+// collection could not bring the disk usage under the threshold: the
+// containers of terminated pods, even those not deleted yet, then every unused image.
+func (m *MyKubelet) reclaimDiskSpace() {
+	if err := m.containerGC.DeleteAllUnusedContainers(); err != nil {
+		klog.ErrorS(err, "Failed to delete unused containers")
+	}
+	if err := m.imageManager.DeleteUnusedImages(); err != nil {
+		klog.ErrorS(err, "Failed to delete unused images")
+	}
+}
+
+// syncLoop is the main loop for processing changes. It watches for changes from
+// three channels (file, apiserver, and http) and creates a union of them. For
+// any new change seen, will run a sync against desired state and running state. If
+// no changes are seen to the configuration, will synchronize the last known desired
+// state every sync-frequency seconds. Never returns.
+func (m *MyKubelet) syncLoop(updates <-chan kubetypes.PodUpdate) {
+	klog.InfoS("Starting kubelet main sync loop")
+	syncTicker := time.NewTicker(syncFrequency)
+	defer syncTicker.Stop()
+	housekeepingTicker := time.NewTicker(housekeepingPeriod)
+	defer housekeepingTicker.Stop()
+	plegCh := m.pleg.Watch()
+	const (
+		base   = 100 * time.Millisecond
+		max    = 5 * time.Second
+		factor = 2
+	)
+	duration := base
+	// Responsible for checking limits in resolv.conf
+	// The limits do not have anything to do with individual pods
+	// Since this is called in syncLoop, we don't need to call it anywhere else
+	if m.dnsConfigurer != nil && m.dnsConfigurer.ResolverConfig != "" {
+		m.dnsConfigurer.CheckLimitsForResolvConf()
+	}
+
+	for {
+		if err := m.runtimeState.runtimeErrors(); err != nil {
+			klog.ErrorS(err, "Skipping pod synchronization")
+			// exponential backoff
+			time.Sleep(duration)
+			duration = time.Duration(math.Min(float64(max), factor*float64(duration)))
+			continue
+		}
+		// reset backoff if we have a success
+		duration = base
+
+		if !m.syncLoopIteration(updates, syncTicker.C, housekeepingTicker.C, plegCh) {
+			break
+		}
+	}
+}
+
+// syncLoopIteration reads from various channels and dispatches pods to the
+// given handler.
+//
+// Arguments:
+// 1.  configCh:       a channel to read config events from
+// 2.  syncCh:         a channel to read periodic sync events from
+// 3.  housekeepingCh: a channel to read housekeeping events from
+// 4.  plegCh:         a channel to read PLEG updates from
+func (m *MyKubelet) syncLoopIteration(configCh <-chan kubetypes.PodUpdate, syncCh <-chan time.Time,
+	housekeepingCh <-chan time.Time, plegCh chan *pleg.PodLifecycleEvent) bool {
+	select {
+	case u, open := <-configCh:
+		// Update from a config source; dispatch it to the right handler
+		// callback.
+		if !open {
+			klog.ErrorS(nil, "Update channel is closed, exiting the sync loop")
+			return false
+		}
+
+		switch u.Op {
 		case kubetypes.ADD:
-			m.HandlePodAdditions(item.Pods)
+			m.HandlePodAdditions(u.Pods)
 		case kubetypes.UPDATE:
-			m.HandlePodUpdates(item.Pods)
+			m.HandlePodUpdates(u.Pods)
 		case kubetypes.DELETE:
-			m.HandlePodDelete(item.Pods)
+			m.HandlePodDelete(u.Pods)
 		case kubetypes.REMOVE:
-			m.HandlePodRemoves(item.Pods)
+			m.HandlePodRemoves(u.Pods)
+		}
+
+		m.sourcesReady.AddSource(u.Source)
+
+	case e := <-plegCh:
+		if e.Type == pleg.ContainerStarted {
+			// record the most recent time we observed a container start for this pod.
+			klog.V(4).InfoS("SyncLoop (PLEG): container started", "podUID", e.ID)
+		}
+		if pod, ok := m.PodManager.GetPodByUID(e.ID); ok {
+			klog.V(2).InfoS("SyncLoop (PLEG): event for pod", "pod", klog.KObj(pod), "event", e)
+			m.HandlePodSyncs([]*v1.Pod{pod})
+		} else {
+			// If the pod no longer exists, ignore the event.
+			klog.V(4).InfoS("SyncLoop (PLEG): pod does not exist, ignore irrelevant event", "event", e)
+		}
+
+	case <-syncCh:
+		// Sync pods waiting for sync
+		podsToSync := m.getPodsToSync()
+		if len(podsToSync) == 0 {
+			break
+		}
+		klog.V(4).InfoS("SyncLoop (SYNC) pods", "total", len(podsToSync), "pods", klog.KObjs(podsToSync))
+		m.HandlePodSyncs(podsToSync)
+
+	case <-housekeepingCh:
+		if !m.sourcesReady.AllReady() {
+			// If the sources aren't ready or volume manager has not yet synced the states,
+			// skip housekeeping, as we may accidentally delete pods from unready sources.
+			klog.V(4).InfoS("SyncLoop (housekeeping, skipped): sources aren't ready yet")
+		} else {
+			klog.V(4).InfoS("SyncLoop (housekeeping)")
+			if err := m.HandlePodCleanups(); err != nil {
+				klog.ErrorS(err, "Failed cleaning pods")
+			}
 		}
 	}
+	return true
+}
+
+// getPodsToSync returns pods which should be resynchronized. Currently, the following pods are
+// returned:
+//   - pods whose work is ready.
+func (m *MyKubelet) getPodsToSync() []*v1.Pod {
+	allPods := m.PodManager.GetPods()
+	podUIDs := m.workQueue.GetWork()
+	podUIDSet := make(map[types.UID]struct{}, len(podUIDs))
+	for _, podUID := range podUIDs {
+		podUIDSet[podUID] = struct{}{}
+	}
+	var podsToSync []*v1.Pod
+	for _, pod := range allPods {
+		if _, ok := podUIDSet[pod.UID]; ok {
+			// The work of the pod is ready
+			podsToSync = append(podsToSync, pod)
+		}
+	}
+	return podsToSync
+}
+
+// HandlePodSyncs is the callback in the syncHandler interface for pods
+// that should be dispatched to pod workers for sync.
+func (m *MyKubelet) HandlePodSyncs(pods []*v1.Pod) {
+	start := m.Clock.Now()
+	for _, pod := range pods {
+		m.dispatchWork(kubetypes.SyncPodSync, pod, start)
+	}
 }
 
 func (m *MyKubelet) HandlePodAdditions(pods []*v1.Pod) {
 	for _, p := range pods {
+		existingPods := m.PodManager.GetPods()
 		m.PodManager.AddPod(p)
+
+		if !m.PodWorkers.IsPodTerminationRequested(p.UID) {
+			activePods := m.filterOutInactivePods(existingPods)
+			// Check if we can admit the pod; if not, reject it.
+			if ok, reason, message := m.canAdmitPod(activePods, p); !ok {
+				m.rejectPod(p, reason, message)
+				continue
+			}
+		}
 		m.dispatchWork(kubetypes.SyncPodCreate, p, m.Clock.Now())
 
 		if m.onAdd != nil {
 			opts := &CallBackOptions{
 				Pod:           p,
-				eventRecorder: m.PodWorkers.(*podWorkers).recorder,
-				podCache:      m.PodCache,
+				eventRecorder: m.recorder,
+				statsProvider: m.statsProvider,
 			}
 			if err := m.onAdd(opts); err != nil {
 				klog.Errorln(err)
@@ -255,6 +955,33 @@ func (m *MyKubelet) HandlePodAdditions(pods []*v1.Pod) {
 	}
 }
 
+// canAdmitPod determines if a pod can be admitted, and gives a reason if it
+// cannot. "pod" is new pod, while "pods" are all admitted pods
+// The function returns a boolean value indicating whether the pod
+// can be admitted, a brief single-word reason and a message explaining why
+// the pod cannot be admitted.
+func (m *MyKubelet) canAdmitPod(pods []*v1.Pod, pod *v1.Pod) (bool, string, string) {
+	// the kubelet will invoke each pod admit handler in sequence
+	// if any handler rejects, the pod is rejected.
+	attrs := &lifecycle.PodAdmitAttributes{Pod: pod, OtherPods: pods}
+	for _, podAdmitHandler := range m.admitHandlers {
+		if result := podAdmitHandler.Admit(attrs); !result.Admit {
+			return false, result.Reason, result.Message
+		}
+	}
+	return true, "", ""
+}
+
+// rejectPod records an event about the pod with the given reason and message,
+// and updates the pod to the failed phase in the status manage.
+func (m *MyKubelet) rejectPod(pod *v1.Pod, reason, message string) {
+	m.recorder.Eventf(pod, v1.EventTypeWarning, reason, message)
+	m.statusManager.SetPodStatus(pod, v1.PodStatus{
+		Phase:   v1.PodFailed,
+		Reason:  reason,
+		Message: "Pod " + message})
+}
+
 func (m *MyKubelet) HandlePodUpdates(pods []*v1.Pod) {
 	for _, p := range pods {
 		m.PodManager.UpdatePod(p)
@@ -263,8 +990,8 @@ func (m *MyKubelet) HandlePodUpdates(pods []*v1.Pod) {
 		if m.onUpdate != nil {
 			opts := &CallBackOptions{
 				Pod:           p,
-				eventRecorder: m.PodWorkers.(*podWorkers).recorder,
-				podCache:      m.PodCache,
+				eventRecorder: m.recorder,
+				statsProvider: m.statsProvider,
 			}
 			if err := m.onUpdate(opts); err != nil {
 				klog.Errorln(err)
@@ -281,8 +1008,8 @@ func (m *MyKubelet) HandlePodDelete(pods []*v1.Pod) {
 		if m.onDelete != nil {
 			opts := &CallBackOptions{
 				Pod:           p,
-				eventRecorder: m.PodWorkers.(*podWorkers).recorder,
-				podCache:      m.PodCache,
+				eventRecorder: m.recorder,
+				statsProvider: m.statsProvider,
 			}
 			if err := m.onDelete(opts); err != nil {
 				klog.Errorln(err)
@@ -299,8 +1026,8 @@ func (m *MyKubelet) HandlePodRemoves(pods []*v1.Pod) {
 		if m.onRemove != nil {
 			opts := &CallBackOptions{
 				Pod:           p,
-				eventRecorder: m.PodWorkers.(*podWorkers).recorder,
-				podCache:      m.PodCache,
+				eventRecorder: m.recorder,
+				statsProvider: m.statsProvider,
 			}
 			if err := m.onRemove(opts); err != nil {
 				klog.Errorln(err)
@@ -317,44 +1044,271 @@ func (m *MyKubelet) dispatchWork(updateType kubetypes.SyncPodType, pod *v1.Pod,
 	})
 }
 
+// syncPod is the transaction script for the sync of a single pod (setting up)
+// a pod. This method is reentrant and expected to converge a pod towards the
+// desired state of the spec. The reverse (teardown) is handled in
+// syncTerminatingPod and syncTerminatedPod. If syncPod exits without error,
+// then the pod runtime state is in sync with the desired configuration state
+// (pod is running). If syncPod exits with a transient error, the next
+// invocation of syncPod is expected to make progress towards reaching the
+// desired state. syncPod exits with isTerminal when the pod was detected to
+// have reached a terminal lifecycle phase due to container exits (for
+// RestartNever or RestartOnFailure) and the next method invoked will by
+// syncTerminatingPod.
+//
+// The workflow is:
+//   - Kill the pod immediately if update type is SyncPodKill
+//   - Generate the API status and update the status manager
+//   - Create the data directories for the pod if they do not exist
+//   - Add the pod to the probe manager
+//   - Call the container runtime's SyncPod callback
+//   - Update the reason cache with the reasons of the sync results
 func (m *MyKubelet) syncPod(ctx context.Context, updateType kubetypes.SyncPodType, pod, mirrorPod *v1.Pod, podStatus *kubecontainer.PodStatus) (isTerminal bool, err error) {
-	fmt.Println("测试的syncPod")
+	klog.V(4).InfoS("syncPod enter", "pod", klog.KObj(pod), "podUID", pod.UID)
+	defer func() {
+		klog.V(4).InfoS("syncPod exit", "pod", klog.KObj(pod), "podUID", pod.UID, "isTerminal", isTerminal)
+	}()
 
-	//isTerminal = false
+	// Generate final API pod status with pod and status manager status
 	apiPodStatus := m.generateAPIPodStatus(pod, podStatus)
+	// The pod IP may be changed in generateAPIPodStatus if the pod is using host network. (See #24576)
+	// TODO(random-liu): After writing pod spec into container labels, check whether pod is using host network, and
+	// set pod IP to hostIP directly in runtime.GetPodStatus
+	podStatus.IPs = make([]string, 0, len(apiPodStatus.PodIPs))
+	for _, ipInfo := range apiPodStatus.PodIPs {
+		podStatus.IPs = append(podStatus.IPs, ipInfo.IP)
+	}
+	if len(podStatus.IPs) == 0 && len(apiPodStatus.PodIP) > 0 {
+		podStatus.IPs = []string{apiPodStatus.PodIP}
+	}
+
+	// If the pod is terminal, we don't need to continue to setup the pod
+	if apiPodStatus.Phase == v1.PodSucceeded || apiPodStatus.Phase == v1.PodFailed {
+		m.statusManager.SetPodStatus(pod, apiPodStatus)
+		isTerminal = true
+		return isTerminal, nil
+	}
+
+	// Update status in the status manager
 	m.statusManager.SetPodStatus(pod, apiPodStatus)
-	//if apiPodStatus.Phase == v1.PodSucceeded || apiPodStatus.Phase == v1.PodFailed {
-	//	isTerminal = true
-	//}
-	return true, nil
+
+	// If the network plugin is not ready, only start the pod if it uses the host network
+	if err := m.runtimeState.networkErrors(); err != nil && !kubecontainer.IsHostNetworkPod(pod) {
+		m.recorder.Eventf(pod, v1.EventTypeWarning, events.NetworkNotReady, "%s: %v", NetworkNotReadyErrorMsg, err)
+		return false, fmt.Errorf("%s: %v", NetworkNotReadyErrorMsg, err)
+	}
+
+	// Create Cgroups for the pod and apply resource parameters
+	// to them if cgroups-per-qos flag is enabled.
+	pcm := m.containerManager.NewPodContainerManager()
+	// If pod has already been terminated then we need not create
+	// or update the pod's cgroup
+	if m.cgroupsPerQOS() && !m.PodWorkers.IsPodTerminationRequested(pod.UID) {
+		if !pcm.Exists(pod) {
+			if err := m.containerManager.UpdateQOSCgroups(); err != nil {
+				klog.V(2).InfoS("Failed to update QoS cgroups while syncing pod", "pod", klog.KObj(pod), "err", err)
+			}
+			if err := pcm.EnsureExists(pod); err != nil {
+				m.recorder.Eventf(pod, v1.EventTypeWarning, events.FailedToCreatePodContainer, "unable to ensure pod container exists: %v", err)
+				return false, fmt.Errorf("failed to ensure that the pod: %v cgroups exist and are correctly applied: %v", pod.UID, err)
+			}
+		}
+	}
+
+	// Make data directories for the pod
+	if err := m.makePodDataDirs(pod); err != nil {
+		m.recorder.Eventf(pod, v1.EventTypeWarning, events.FailedToMakePodDataDirectories, "error making pod data directories: %v", err)
+		klog.ErrorS(err, "Unable to make pod data directories for pod", "pod", klog.KObj(pod))
+		return false, err
+	}
+
+	// Ensure the pod is being probed
+	m.probeManager.AddPod(pod)
+
+	// Wait for volumes to attach/mount
+	if err := m.volumeManager.WaitForAttachAndMount(pod); err != nil {
+		m.recorder.Eventf(pod, v1.EventTypeWarning, events.FailedMountVolume, "Unable to attach or mount volumes: %v", err)
+		klog.ErrorS(err, "Unable to attach or mount volumes for pod; skipping pod", "pod", klog.KObj(pod))
+		return false, err
+	}
+
+	// Fetch the pull secrets for the pod
+	pullSecrets := m.getPullSecretsForPod(pod)
+
+	// Call the container runtime's SyncPod callback
+	result := m.containerRuntime.SyncPod(pod, podStatus, pullSecrets, m.backOff)
+	m.reasonCache.Update(pod.UID, result)
+	if err := result.Error(); err != nil {
+		// Do not return error if the only failures were pods in backoff
+		for _, r := range result.SyncResults {
+			if r.Error != kubecontainer.ErrCrashLoopBackOff && r.Error != images.ErrImagePullBackOff {
+				// Do not record an event here, as we keep all event logging for sync pod failures
+				// local to container runtime, so we get better errors.
+				return false, err
+			}
+		}
+
+		return false, nil
+	}
+
+	return false, nil
 }
 
+// syncTerminatingPod is expected to terminate all running containers in a pod. Once this method
+// returns without error, the pod's local state can be safely cleaned up. If runningPod is passed,
+// we perform no status updates.
 func (m *MyKubelet) syncTerminatingPod(ctx context.Context, pod *v1.Pod, podStatus *kubecontainer.PodStatus, runningPod *kubecontainer.Pod, gracePeriod *int64, podStatusFn func(*v1.PodStatus)) error {
-	fmt.Println("测试的syncTerminatingPod")
+	klog.V(4).InfoS("syncTerminatingPod enter", "pod", klog.KObj(pod), "podUID", pod.UID)
+	defer klog.V(4).InfoS("syncTerminatingPod exit", "pod", klog.KObj(pod), "podUID", pod.UID)
+
+	// when we receive a runtime only pod (runningPod != nil) we don't need to update the status
+	// manager or refresh the status of the cache, because a successful killPod will ensure we do
+	// not get invoked again
+	if runningPod != nil {
+		// we kill the pod with the specified grace period since this is a termination
+		if gracePeriod != nil {
+			klog.V(4).InfoS("Pod terminating with grace period", "pod", klog.KObj(pod), "podUID", pod.UID, "gracePeriod", *gracePeriod)
+		} else {
+			klog.V(4).InfoS("Pod terminating with grace period", "pod", klog.KObj(pod), "podUID", pod.UID, "gracePeriod", nil)
+		}
+		if err := m.killPod(pod, *runningPod, gracePeriod); err != nil {
+			m.recorder.Eventf(pod, v1.EventTypeWarning, events.FailedToKillPod, "error killing pod: %v", err)
+			// there was an error killing the pod, so we return that error directly
+			utilruntime.HandleError(err)
+			return err
+		}
+		klog.V(4).InfoS("Pod termination stopped all running orphan containers", "pod", klog.KObj(pod), "podUID", pod.UID)
+		return nil
+	}
+
 	apiPodStatus := m.generateAPIPodStatus(pod, podStatus)
+	if podStatusFn != nil {
+		podStatusFn(&apiPodStatus)
+	}
+	m.statusManager.SetPodStatus(pod, apiPodStatus)
+
+	if gracePeriod != nil {
+		klog.V(4).InfoS("Pod terminating with grace period", "pod", klog.KObj(pod), "podUID", pod.UID, "gracePeriod", *gracePeriod)
+	} else {
+		klog.V(4).InfoS("Pod terminating with grace period", "pod", klog.KObj(pod), "podUID", pod.UID, "gracePeriod", nil)
+	}
+
+	m.probeManager.StopLivenessAndStartup(pod)
+
+	p := kubecontainer.ConvertPodStatusToRunningPod(m.containerRuntime.Type(), podStatus)
+	if err := m.killPod(pod, p, gracePeriod); err != nil {
+		m.recorder.Eventf(pod, v1.EventTypeWarning, events.FailedToKillPod, "error killing pod: %v", err)
+		// there was an error killing the pod, so we return that error directly
+		utilruntime.HandleError(err)
+		return err
+	}
+
+	// Once the containers are stopped, we can stop probing for liveness and readiness.
+	// TODO: once a pod is terminal, certain probes (liveness exec) could be stopped immediately after
+	//   the detection of a container shutdown or (for readiness) after the first failure. Tracked as
+	//   https://github.com/kubernetes/kubernetes/issues/107894 although may not be worth optimizing.
+	m.probeManager.RemovePod(pod)
+
+	// Guard against consistency issues in KillPod implementations by checking that there are no
+	// running containers. This method is invoked infrequently so this is effectively free and can
+	// catch race conditions introduced by callers updating pod status out of order.
+	// TODO: have KillPod return the terminal status of stopped containers and write that into the
+	//  cache immediately
+	stoppedPodStatus, err := m.containerRuntime.GetPodStatus(pod.UID, pod.Name, pod.Namespace)
+	if err != nil {
+		klog.ErrorS(err, "Unable to read pod status prior to final pod termination", "pod", klog.KObj(pod), "podUID", pod.UID)
+		return err
+	}
+	var runningContainers []string
+	var containers []string
+	for _, s := range stoppedPodStatus.ContainerStatuses {
+		if s.State == kubecontainer.ContainerStateRunning {
+			runningContainers = append(runningContainers, s.ID.String())
+		}
+		containers = append(containers, fmt.Sprintf("(%s state=%s exitCode=%d finishedAt=%s)", s.Name, s.State, s.ExitCode, s.FinishedAt.UTC().Format(time.RFC3339Nano)))
+	}
+	if klog.V(4).Enabled() {
+		sort.Strings(containers)
+		klog.InfoS("Post-termination container state", "pod", klog.KObj(pod), "podUID", pod.UID, "containers", strings.Join(containers, " "))
+	}
+	if len(runningContainers) > 0 {
+		return fmt.Errorf("detected running containers after a successful KillPod, CRI violation: %v", runningContainers)
+	}
+
+	// we have successfully stopped all containers, the pod is terminating, our status is "done"
+	klog.V(4).InfoS("Pod termination stopped all running containers", "pod", klog.KObj(pod), "podUID", pod.UID)
+
+	// Compute and update the status in cache once the pods are no longer running.
+	// The computation is done here to ensure the pod status used for it contains
+	// information about the container end states (including exit codes) - when
+	// SyncTerminatedPod is called the containers may already be removed.
+	apiPodStatus = m.generateAPIPodStatus(pod, stoppedPodStatus)
 	m.statusManager.SetPodStatus(pod, apiPodStatus)
 	return nil
 }
 
+// syncTerminatedPod cleans up a pod that has terminated (has no running containers).
+// The invocations in this call are expected to tear down what PodResourcesAreReclaimed checks (which
+// gates pod deletion). When this method exits the pod is expected to be ready for cleanup.
+// TODO: make this method take a context and exit early
 func (m *MyKubelet) syncTerminatedPod(ctx context.Context, pod *v1.Pod, podStatus *kubecontainer.PodStatus) error {
-	fmt.Println("测试的syncTerminatedPod 收尾工作")
+	klog.V(4).InfoS("syncTerminatedPod enter", "pod", klog.KObj(pod), "podUID", pod.UID)
+	defer klog.V(4).InfoS("syncTerminatedPod exit", "pod", klog.KObj(pod), "podUID", pod.UID)
+
+	// generate the final status of the pod
+	// TODO: should we simply fold this into TerminatePod? that would give a single pod update
+	apiPodStatus := m.generateAPIPodStatus(pod, podStatus)
+	m.statusManager.SetPodStatus(pod, apiPodStatus)
+
+	// volumes are unmounted after the pod worker reports ShouldPodRuntimeBeRemoved (which is satisfied
+	// before syncTerminatedPod is invoked)
+	if err := m.volumeManager.UnmountVolumes(pod.UID); err != nil {
+		return err
+	}
+	klog.V(4).InfoS("Pod termination unmounted volumes", "pod", klog.KObj(pod), "podUID", pod.UID)
+
+	// remove any cgroups in the hierarchy for pods that are no longer running.
+	if m.cgroupsPerQOS() {
+		pcm := m.containerManager.NewPodContainerManager()
+		name, _ := pcm.GetPodContainerName(pod)
+		if err := pcm.Destroy(name); err != nil {
+			return err
+		}
+		klog.V(4).InfoS("Pod termination removed cgroups", "pod", klog.KObj(pod), "podUID", pod.UID)
+	}
+
+	// mark the final pod status
+	m.statusManager.TerminatePod(pod)
+	klog.V(4).InfoS("Pod is terminated and will need no more status updates", "pod", klog.KObj(pod), "podUID", pod.UID)
+
 	return nil
 }
 
+// PodResourcesAreReclaimed returns true if all required node-level resources that a pod was consuming have
+// been reclaimed by the kubelet.  Reclaiming resources is a prerequisite to deleting a pod from the API server.
 func (m *MyKubelet) PodResourcesAreReclaimed(pod *v1.Pod, status v1.PodStatus) bool {
+	if m.PodCouldHaveRunningContainers(pod) {
+		// We shouldn't delete pods that still have running containers
+		klog.V(3).InfoS("Pod is terminated, but some containers are still running", "pod", klog.KObj(pod))
+		return false
+	}
+	if m.podVolumesExist(pod.UID) {
+		// We shouldn't delete pods whose volumes have not been cleaned up if we are not keeping terminated pod volumes
+		klog.V(3).InfoS("Pod is terminated, but some volumes have not been cleaned up", "pod", klog.KObj(pod))
+		return false
+	}
+	if m.cgroupsPerQOS() {
+		pcm := m.containerManager.NewPodContainerManager()
+		if pcm.Exists(pod) {
+			klog.V(3).InfoS("Pod is terminated, but pod cgroup sandbox has not been cleaned up", "pod", klog.KObj(pod))
+			return false
+		}
+	}
 	return true
 }
 
 func (m *MyKubelet) PodCouldHaveRunningContainers(pod *v1.Pod) bool {
-	return true
+	return m.PodWorkers.CouldHaveRunningContainers(pod.UID)
 }
 
 var _ status.PodDeletionSafetyProvider = &MyKubelet{}
-
-type ContainerCommandRunner struct{}
-
-func (c ContainerCommandRunner) RunInContainer(id kubecontainer.ContainerID, cmd []string, timeout time.Duration) ([]byte, error) {
-	return []byte(""), nil
-}
-
-var _ kubecontainer.CommandRunner = &ContainerCommandRunner{}
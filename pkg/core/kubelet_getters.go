@@ -0,0 +1,106 @@
+package core
+
+import (
+	"net"
+	"path/filepath"
+
+	"github.com/xuliangTang/mykubelet/pkg/kubelet/stats"
+	utilnode "github.com/xuliangTang/mykubelet/pkg/util/node"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+const (
+	// DefaultRootDir is the default directory of the kubelet state.
+	DefaultRootDir = "/var/lib/mykubelet"
+	// DefaultPodLogsDir is the default directory of the container logs.
+	DefaultPodLogsDir = "/var/log/pods"
+	// DefaultCgroupRoot is the default cgroup the pod cgroups are created below.
+	DefaultCgroupRoot = "/"
+
+	podsDirName          = "pods"
+	runtimeDirName       = "runtime"
+	cniDirName           = "cni"
+	podVolumesDirName    = "volumes"
+	podContainersDirName = "containers"
+)
+
+// getRootDir returns the full path to the directory under which kubelet can
+// store data.  These functions are useful to pass interfaces to other modules
+// that may need to know where to write data without getting a whole kubelet
+// instance.
+func (m *MyKubelet) getRootDir() string {
+	return m.rootDirectory
+}
+
+// getPodsDir returns the full path to the directory under which pod
+// directories are created.
+func (m *MyKubelet) getPodsDir() string {
+	return filepath.Join(m.getRootDir(), podsDirName)
+}
+
+// getRuntimeDir returns the full path to the directory holding the state of
+// the container runtime.
+func (m *MyKubelet) getRuntimeDir() string {
+	return filepath.Join(m.getRootDir(), runtimeDirName)
+}
+
+// getCNIDir returns the full path to the directory the results of the CNI
+// plugins are cached in.
+func (m *MyKubelet) getCNIDir() string {
+	return filepath.Join(m.getRootDir(), cniDirName)
+}
+
+// GetPodDir returns the full path to the per-pod data directory for the
+// specified pod. This directory may not exist if the pod does not exist.
+func (m *MyKubelet) GetPodDir(podUID types.UID) string {
+	return filepath.Join(m.getPodsDir(), string(podUID))
+}
+
+// getPodVolumesDir returns the full path to the per-pod data directory under
+// which volumes are created for the specified pod. This directory may not
+// exist if the pod does not exist.
+func (m *MyKubelet) getPodVolumesDir(podUID types.UID) string {
+	return filepath.Join(m.GetPodDir(podUID), podVolumesDirName)
+}
+
+// getPodVolumeDir returns the full path to the directory which represents the
+// named volume under the named plugin for specified pod. This directory may not
+// exist if the pod does not exist.
+func (m *MyKubelet) getPodVolumeDir(podUID types.UID, pluginName string, volumeName string) string {
+	return filepath.Join(m.getPodVolumesDir(podUID), pluginName, volumeName)
+}
+
+// getPodContainerDir returns the full path to the per-pod data directory under
+// which container data is held for the specified pod. This directory may not
+// exist if the pod or container does not exist.
+func (m *MyKubelet) getPodContainerDir(podUID types.UID, ctrName string) string {
+	return filepath.Join(m.GetPodDir(podUID), podContainersDirName, ctrName)
+}
+
+// GetNode returns the node info for the configured node name of this Kubelet.
+func (m *MyKubelet) GetNode() (*v1.Node, error) {
+	return m.nodeLister.Get(m.HostName)
+}
+
+// getNodeAnyWay() returns the node object of this kubelet. Unlike upstream,
+// there is no locally built initial node to fall back to.
+func (m *MyKubelet) getNodeAnyWay() (*v1.Node, error) {
+	return m.GetNode()
+}
+
+// getHostIPsAnyWay attempts to return the host IPs from kubelet's nodeInfo, or
+// the initialNode.
+func (m *MyKubelet) getHostIPsAnyWay() ([]net.IP, error) {
+	node, err := m.getNodeAnyWay()
+	if err != nil {
+		return nil, err
+	}
+	return utilnode.GetNodeHostIPs(node)
+}
+
+// GetStatsProvider returns the provider of the resource usage of the pods and
+// containers running on this Kubelet.
+func (m *MyKubelet) GetStatsProvider() stats.Provider {
+	return m.statsProvider
+}
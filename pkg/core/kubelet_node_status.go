@@ -0,0 +1,160 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/xuliangTang/mykubelet/pkg/kubelet/nodestatus"
+	nodeutil "github.com/xuliangTang/mykubelet/pkg/util/node"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/klog/v2"
+)
+
+const (
+	// nodeStatusUpdateRetry specifies how many times kubelet retries when posting node status failed.
+	nodeStatusUpdateRetry = 5
+
+	// nodeStatusUpdateFrequency is the frequency that kubelet computes node status.
+	nodeStatusUpdateFrequency = 10 * time.Second
+)
+
+// syncNodeStatus should be called periodically from a goroutine.
+// It synchronizes node status to master if there is any change or enough time
+// passed from the last sync.
+func (m *MyKubelet) syncNodeStatus() {
+	m.syncPodCIDR()
+	if err := m.updateNodeStatus(); err != nil {
+		klog.ErrorS(err, "Unable to update node status")
+	}
+}
+
+// updateNodeStatus updates node status to master with retries if there is any
+// change or enough time passed from the last sync.
+func (m *MyKubelet) updateNodeStatus() error {
+	klog.V(5).InfoS("Updating node status")
+	for i := 0; i < nodeStatusUpdateRetry; i++ {
+		if err := m.tryUpdateNodeStatus(i); err != nil {
+			klog.ErrorS(err, "Error updating node status, will retry")
+		} else {
+			return nil
+		}
+	}
+	return fmt.Errorf("update node status exceeds retry count")
+}
+
+// tryUpdateNodeStatus tries to update node status to master if there is any
+// change or enough time passed from the last sync.
+func (m *MyKubelet) tryUpdateNodeStatus(tryNumber int) error {
+	// To reduce the load on etcd, we are serving GET operations from
+	// apiserver cache (the data might be slightly delayed but it doesn't
+	// seem to cause more conflict - the delays are pretty small).
+	// If it result in a conflict, all retries are served directly from etcd.
+	opts := metav1.GetOptions{}
+	if tryNumber == 0 {
+		opts.ResourceVersion = "0"
+	}
+	node, err := m.KubeClient.CoreV1().Nodes().Get(context.TODO(), m.HostName, opts)
+	if err != nil {
+		return fmt.Errorf("error getting node %q: %v", m.HostName, err)
+	}
+
+	originalNode := node.DeepCopy()
+	m.setNodeStatus(node)
+
+	// Patch the current status on the API server
+	if _, _, err := nodeutil.PatchNodeStatus(m.KubeClient.CoreV1(), types.NodeName(m.HostName), originalNode, node); err != nil {
+		return err
+	}
+	return nil
+}
+
+// syncPodCIDR passes the pod CIDRs allocated to the node on to the container
+// runtime, which allocates the IPs of the pods from them.
+func (m *MyKubelet) syncPodCIDR() {
+	node, err := m.GetNode()
+	if err != nil {
+		klog.ErrorS(err, "Error getting node for its pod CIDR")
+		return
+	}
+	podCIDRs := node.Spec.PodCIDRs
+	if len(podCIDRs) == 0 && node.Spec.PodCIDR != "" {
+		podCIDRs = []string{node.Spec.PodCIDR}
+	}
+	if len(podCIDRs) == 0 {
+		return
+	}
+	if _, err := m.updatePodCIDR(strings.Join(podCIDRs, ",")); err != nil {
+		klog.ErrorS(err, "Error updating pod CIDR")
+	}
+}
+
+// updatePodCIDR updates the pod CIDR in the runtime state if it is different
+// from the current CIDR. Return true if pod CIDR is actually changed.
+func (m *MyKubelet) updatePodCIDR(cidr string) (bool, error) {
+	m.updatePodCIDRMux.Lock()
+	defer m.updatePodCIDRMux.Unlock()
+
+	podCIDR := m.runtimeState.podCIDR()
+
+	if podCIDR == cidr {
+		return false, nil
+	}
+
+	if err := m.containerRuntime.UpdatePodCIDR(cidr); err != nil {
+		// If updatePodCIDR would fail, theoretically pod CIDR could not change.
+		// But it is better to be on the safe side to still return true here.
+		return true, fmt.Errorf("failed to update pod CIDR: %v", err)
+	}
+	klog.InfoS("Updating Pod CIDR", "originalPodCIDR", podCIDR, "newPodCIDR", cidr)
+	m.runtimeState.setPodCIDR(cidr)
+	return true, nil
+}
+
+// recordNodeStatusEvent records an event of the given type with the given
+// message for the node.
+func (m *MyKubelet) recordNodeStatusEvent(eventType, event string) {
+	klog.V(2).InfoS("Recording event message for node", "node", klog.KRef("", m.HostName), "event", event)
+	m.recorder.Eventf(m.nodeRef(), eventType, event, "Node %s status is now: %s", m.HostName, event)
+}
+
+// nodeRef returns the reference of the node events are recorded for.
+func (m *MyKubelet) nodeRef() *v1.ObjectReference {
+	return &v1.ObjectReference{
+		Kind:      "Node",
+		Name:      m.HostName,
+		UID:       types.UID(m.HostName),
+		Namespace: "",
+	}
+}
+
+// setNodeStatus fills in the Status fields of the given Node, overwriting
+// any fields that are currently set.
+func (m *MyKubelet) setNodeStatus(node *v1.Node) {
+	for i, f := range m.setNodeStatusFuncs {
+		klog.V(5).InfoS("Setting node status condition code", "position", i, "node", klog.KObj(node))
+		if err := f(node); err != nil {
+			klog.ErrorS(err, "Failed to set some node status fields", "node", klog.KObj(node))
+		}
+	}
+}
+
+// defaultNodeStatusFuncs is a factory that generates the default set of
+// setNodeStatus funcs
+func (m *MyKubelet) defaultNodeStatusFuncs() []func(*v1.Node) error {
+	var setters []func(n *v1.Node) error
+	setters = append(setters,
+		nodestatus.CgroupsCondition(m.Clock.Now, func() error { return m.containerManager.Status().SoftRequirements }, m.recordNodeStatusEvent),
+	)
+	if m.port > 0 {
+		setters = append(setters, nodestatus.DaemonEndpoints(&v1.NodeDaemonEndpoints{
+			KubeletEndpoint: v1.DaemonEndpoint{Port: int32(m.port)},
+		}))
+	}
+	// Ready condition needs to be the last in the list of node conditions.
+	setters = append(setters, nodestatus.ReadyCondition(m.Clock.Now, m.runtimeState.runtimeErrors, m.runtimeState.networkErrors, m.recordNodeStatusEvent))
+	return setters
+}
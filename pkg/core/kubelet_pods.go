@@ -1,14 +1,43 @@
 package core
 
 import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
 	podutil "github.com/xuliangTang/mykubelet/pkg/api/v1/pod"
+	"github.com/xuliangTang/mykubelet/pkg/api/v1/resource"
+	podshelper "github.com/xuliangTang/mykubelet/pkg/apis/core/pods"
+	"github.com/xuliangTang/mykubelet/pkg/fieldpath"
+	"github.com/xuliangTang/mykubelet/pkg/kubelet/cm"
 	kubecontainer "github.com/xuliangTang/mykubelet/pkg/kubelet/container"
+	"github.com/xuliangTang/mykubelet/pkg/kubelet/cri/streaming/portforward"
+	remotecommandserver "github.com/xuliangTang/mykubelet/pkg/kubelet/cri/streaming/remotecommand"
 	"github.com/xuliangTang/mykubelet/pkg/kubelet/status"
 	kubetypes "github.com/xuliangTang/mykubelet/pkg/kubelet/types"
+	"github.com/xuliangTang/mykubelet/third_party/forked/golang/expansion"
 	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/sets"
+	utilvalidation "k8s.io/apimachinery/pkg/util/validation"
+	runtimeapi "k8s.io/cri-api/pkg/apis/runtime/v1alpha2"
 	"k8s.io/klog/v2"
-	"sort"
+	netutils "k8s.io/utils/net"
+)
+
+const (
+	managedHostsHeader                = "# Kubernetes-managed hosts file.\n"
+	managedHostsHeaderWithHostNetwork = "# Kubernetes-managed hosts file (host network).\n"
+
+	etcHostsPath = "/etc/hosts"
 )
 
 // Container state reason list
@@ -89,10 +118,52 @@ func (m *MyKubelet) generateAPIPodStatus(pod *v1.Pod, podStatus *kubecontainer.P
 	})
 
 	// set HostIP and initialize PodIP/PodIPs for host network pods
+	if m.KubeClient != nil {
+		hostIPs, err := m.getHostIPsAnyWay()
+		if err != nil {
+			klog.V(4).InfoS("Cannot get host IPs", "err", err)
+		} else {
+			s.HostIP = hostIPs[0].String()
+			// HostNetwork Pods inherit the node IPs as PodIPs. They are immutable once set,
+			// other than that if the node becomes dual-stack, we add the secondary IP.
+			// So do the pods whose sandbox shares the network of the host.
+			if kubecontainer.IsHostNetworkPod(pod) || sandboxInHostNetwork(podStatus) {
+				// Primary IP is not set
+				if s.PodIP == "" {
+					s.PodIP = hostIPs[0].String()
+					s.PodIPs = []v1.PodIP{{IP: s.PodIP}}
+				}
+				// Secondary IP is not set
+				if len(hostIPs) == 2 && len(s.PodIPs) == 1 {
+					s.PodIPs = append(s.PodIPs, v1.PodIP{IP: hostIPs[1].String()})
+				}
+			}
+		}
+	}
 
 	return *s
 }
 
+// sandboxInHostNetwork returns whether the latest sandbox of the pod shares
+// the network namespace of the host.
+func sandboxInHostNetwork(podStatus *kubecontainer.PodStatus) bool {
+	if podStatus == nil || len(podStatus.SandboxStatuses) == 0 {
+		return false
+	}
+	return podStatus.SandboxStatuses[0].GetLinux().GetNamespaces().GetOptions().GetNetwork() == runtimeapi.NamespaceMode_NODE
+}
+
+// podSharesHostNetwork returns whether the containers of the pod run in the
+// network namespace of the host, either because the pod asks for it or
+// because its sandbox has no network namespace of its own.
+func (m *MyKubelet) podSharesHostNetwork(pod *v1.Pod) bool {
+	if kubecontainer.IsHostNetworkPod(pod) {
+		return true
+	}
+	podStatus, err := m.PodCache.Get(pod.UID)
+	return err == nil && sandboxInHostNetwork(podStatus)
+}
+
 // convertStatusToAPIStatus initialize an api PodStatus for the given pod from
 // the given internal pod status and the previous state of the pod from the API.
 // It is purely transformative and does not alter the kubelet state at all.
@@ -105,6 +176,15 @@ func (m *MyKubelet) convertStatusToAPIStatus(pod *v1.Pod, podStatus *kubecontain
 		podIPs[j] = ip
 	}
 
+	// make podIPs order match node IP family preference
+	podIPs = m.sortPodIPs(podIPs)
+	for _, ip := range podIPs {
+		apiPodStatus.PodIPs = append(apiPodStatus.PodIPs, v1.PodIP{IP: ip})
+	}
+	if len(apiPodStatus.PodIPs) > 0 {
+		apiPodStatus.PodIP = apiPodStatus.PodIPs[0].IP
+	}
+
 	apiPodStatus.ContainerStatuses = m.convertToAPIContainerStatuses(
 		pod, podStatus,
 		oldPodStatus.ContainerStatuses,
@@ -124,6 +204,37 @@ func (m *MyKubelet) convertStatusToAPIStatus(pod *v1.Pod, podStatus *kubecontain
 	return &apiPodStatus
 }
 
+// sortPodIPs return the PodIPs sorted and truncated by the cluster IP family preference.
+// The runtime pod status may have an arbitrary number of IPs, in an arbitrary order.
+// Pick out the first returned IP of the same IP family as the node IP
+// first, followed by the first IP of the opposite IP family (if any)
+// and use them for the Pod.Status.PodIPs and the Downward API environment variables
+func (m *MyKubelet) sortPodIPs(podIPs []string) []string {
+	ips := make([]string, 0, 2)
+	var validPrimaryIP, validSecondaryIP func(ip string) bool
+	hostIPs, err := m.getHostIPsAnyWay()
+	if err != nil || netutils.IsIPv4(hostIPs[0]) {
+		validPrimaryIP = netutils.IsIPv4String
+		validSecondaryIP = netutils.IsIPv6String
+	} else {
+		validPrimaryIP = netutils.IsIPv6String
+		validSecondaryIP = netutils.IsIPv4String
+	}
+	for _, ip := range podIPs {
+		if validPrimaryIP(ip) {
+			ips = append(ips, ip)
+			break
+		}
+	}
+	for _, ip := range podIPs {
+		if validSecondaryIP(ip) {
+			ips = append(ips, ip)
+			break
+		}
+	}
+	return ips
+}
+
 // convertToAPIContainerStatuses converts the given internal container
 // statuses into API container statuses.
 func (m *MyKubelet) convertToAPIContainerStatuses(pod *v1.Pod, podStatus *kubecontainer.PodStatus, previousStatus []v1.ContainerStatus, containers []v1.Container, hasInitContainers, isInitContainer bool) []v1.ContainerStatus {
@@ -461,3 +572,971 @@ func getPhase(spec *v1.PodSpec, info []v1.ContainerStatus) v1.PodPhase {
 		return v1.PodPending
 	}
 }
+
+// makePodDataDirs creates the dirs for the pod datas.
+func (m *MyKubelet) makePodDataDirs(pod *v1.Pod) error {
+	uid := pod.UID
+	if err := os.MkdirAll(m.GetPodDir(uid), 0750); err != nil && !os.IsExist(err) {
+		return err
+	}
+	if err := os.MkdirAll(m.getPodVolumesDir(uid), 0750); err != nil && !os.IsExist(err) {
+		return err
+	}
+	return nil
+}
+
+// truncatePodHostnameIfNeeded truncates the pod hostname if it's longer than 63 chars.
+func truncatePodHostnameIfNeeded(podName, hostname string) (string, error) {
+	// Cap hostname at 63 chars (specification is 64bytes which is 63 chars and the null terminating char).
+	const hostnameMaxLen = 63
+	if len(hostname) <= hostnameMaxLen {
+		return hostname, nil
+	}
+	truncated := hostname[:hostnameMaxLen]
+	klog.ErrorS(nil, "Hostname for pod was too long, truncated it", "podName", podName, "hostnameMaxLen", hostnameMaxLen, "truncatedHostname", truncated)
+	// hostname should not end with '-' or '.'
+	truncated = strings.TrimRight(truncated, "-.")
+	if len(truncated) == 0 {
+		// This should never happen.
+		return "", fmt.Errorf("hostname for pod %q was invalid: %q", podName, hostname)
+	}
+	return truncated, nil
+}
+
+// GeneratePodHostNameAndDomain creates a hostname and domain name for a pod,
+// given that pod's spec and annotations or returns an error.
+// TODO: fill the domain from the pod subdomain once the kubelet knows the cluster domain.
+func (m *MyKubelet) GeneratePodHostNameAndDomain(pod *v1.Pod) (string, string, error) {
+	hostname := pod.Name
+	if len(pod.Spec.Hostname) > 0 {
+		if msgs := utilvalidation.IsDNS1123Label(pod.Spec.Hostname); len(msgs) != 0 {
+			return "", "", fmt.Errorf("pod Hostname %q is not a valid DNS label: %s", pod.Spec.Hostname, strings.Join(msgs, ";"))
+		}
+		hostname = pod.Spec.Hostname
+	}
+
+	hostname, err := truncatePodHostnameIfNeeded(pod.Name, hostname)
+	if err != nil {
+		return "", "", err
+	}
+
+	hostDomain := ""
+	if len(pod.Spec.Subdomain) > 0 {
+		if msgs := utilvalidation.IsDNS1123Label(pod.Spec.Subdomain); len(msgs) != 0 {
+			return "", "", fmt.Errorf("pod Subdomain %q is not a valid DNS label: %s", pod.Spec.Subdomain, strings.Join(msgs, ";"))
+		}
+		hostDomain = fmt.Sprintf("%s.%s.svc.%s", pod.Spec.Subdomain, pod.Namespace, m.clusterDomain)
+	}
+
+	return hostname, hostDomain, nil
+}
+
+// GenerateRunContainerOptions generates the RunContainerOptions, which can be used by
+// the container runtime to set parameters for launching a container.
+func (m *MyKubelet) GenerateRunContainerOptions(pod *v1.Pod, container *v1.Container, podIP string, podIPs []string) (*kubecontainer.RunContainerOptions, func(), error) {
+	opts := &kubecontainer.RunContainerOptions{}
+
+	hostname, hostDomainName, err := m.GeneratePodHostNameAndDomain(pod)
+	if err != nil {
+		return nil, nil, err
+	}
+	opts.Hostname = hostname
+
+	// only do this check if the experimental behavior is enabled, otherwise allow it to default to false
+	podContainerDir := m.getPodContainerDir(pod.UID, container.Name)
+	if err := os.MkdirAll(podContainerDir, 0750); err != nil {
+		klog.ErrorS(err, "Error on creating dir", "path", podContainerDir)
+		return nil, nil, err
+	}
+	opts.PodContainerDir = podContainerDir
+
+	envs, err := m.makeEnvironmentVariables(pod, container, podIP, podIPs)
+	if err != nil {
+		return nil, nil, err
+	}
+	opts.Envs = append(opts.Envs, envs...)
+
+	volumes := m.volumeManager.GetMountedVolumesForPod(pod.UID)
+	supportsSingleFileMapping := m.containerRuntime.SupportsSingleFileMapping()
+	mounts, err := makeMounts(pod, m.GetPodDir(pod.UID), container, hostname, hostDomainName, podIPs, volumes, opts.Envs, supportsSingleFileMapping)
+	if err != nil {
+		return nil, nil, err
+	}
+	opts.Mounts = append(opts.Mounts, mounts...)
+
+	return opts, nil, nil
+}
+
+// makeMounts determines the mount points for the given container.
+func makeMounts(pod *v1.Pod, podDir string, container *v1.Container, hostName, hostDomain string, podIPs []string, podVolumes kubecontainer.VolumeMap, expandEnvs []kubecontainer.EnvVar, supportsSingleFileMapping bool) ([]kubecontainer.Mount, error) {
+	// Kubernetes will not mount /etc/hosts if:
+	// - when the Pod sandbox is being created, its IP is still unknown. Hence, PodIP will not have been set.
+	// - the runtime can not bind mount single files into the container.
+	mountEtcHostsFile := len(podIPs) > 0 && supportsSingleFileMapping
+	mounts := []kubecontainer.Mount{}
+	for _, mount := range container.VolumeMounts {
+		// Kubernetes only mounts on /etc/hosts if:
+		// - container is not already mounting on /etc/hosts
+		mountEtcHostsFile = mountEtcHostsFile && (mount.MountPath != etcHostsPath)
+		vol, ok := podVolumes[mount.Name]
+		if !ok {
+			klog.ErrorS(nil, "Mount cannot be satisfied for the container, because the volume is missing",
+				"containerName", container.Name, "volumeMount", mount)
+			return nil, fmt.Errorf("cannot find volume %q to mount into container %q", mount.Name, container.Name)
+		}
+
+		hostPath := vol.HostPath
+		subPath := mount.SubPath
+		if mount.SubPathExpr != "" {
+			var err error
+			subPath, err = kubecontainer.ExpandContainerVolumeMounts(mount, expandEnvs)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		if subPath != "" {
+			if filepath.IsAbs(subPath) {
+				return nil, fmt.Errorf("error SubPath `%s` must not be an absolute path", subPath)
+			}
+
+			if err := validatePathNoBacksteps(subPath); err != nil {
+				return nil, fmt.Errorf("unable to provision SubPath `%s`: %v", subPath, err)
+			}
+
+			volumePath := hostPath
+			hostPath = filepath.Join(volumePath, subPath)
+
+			if _, err := os.Stat(hostPath); err != nil && !os.IsNotExist(err) {
+				klog.ErrorS(nil, "Could not determine if subPath exists, will not attempt to change its permissions", "path", hostPath)
+			} else if os.IsNotExist(err) {
+				// Create the sub path now because if it's auto-created later when referenced, it may have an
+				// incorrect ownership and mode.
+				info, err := os.Stat(volumePath)
+				if err != nil {
+					return nil, err
+				}
+				if err := os.MkdirAll(hostPath, info.Mode().Perm()); err != nil {
+					// Don't pass detailed error back to the user because it could give information about host filesystem
+					klog.ErrorS(err, "Failed to create subPath directory for volumeMount of the container", "containerName", container.Name, "volumeMountName", mount.Name)
+					return nil, fmt.Errorf("failed to create subPath directory for volumeMount %q of container %q", mount.Name, container.Name)
+				}
+			}
+		}
+
+		containerPath := mount.MountPath
+		if !filepath.IsAbs(containerPath) {
+			containerPath = filepath.Join(string(filepath.Separator), containerPath)
+		}
+
+		propagation, err := translateMountPropagation(mount.MountPropagation)
+		if err != nil {
+			return nil, err
+		}
+		klog.V(5).InfoS("Mount has propagation", "pod", klog.KObj(pod), "containerName", container.Name, "volumeMountName", mount.Name, "propagation", propagation)
+
+		mounts = append(mounts, kubecontainer.Mount{
+			Name:          mount.Name,
+			ContainerPath: containerPath,
+			HostPath:      hostPath,
+			ReadOnly:      mount.ReadOnly || vol.ReadOnly,
+			Propagation:   propagation,
+		})
+	}
+	if mountEtcHostsFile {
+		hostAliases := pod.Spec.HostAliases
+		hostsMount, err := makeHostsMount(podDir, podIPs, hostName, hostDomain, hostAliases, pod.Spec.HostNetwork)
+		if err != nil {
+			return nil, err
+		}
+		mounts = append(mounts, *hostsMount)
+	}
+	return mounts, nil
+}
+
+// makeHostsMount makes the mountpoint for the hosts file that the containers
+// in a pod are injected with. podIPs is provided instead of podIP as podIPs
+// are present even if dual-stack feature flag is not enabled.
+func makeHostsMount(podDir string, podIPs []string, hostName, hostDomainName string, hostAliases []v1.HostAlias, useHostNetwork bool) (*kubecontainer.Mount, error) {
+	hostsFilePath := filepath.Join(podDir, "etc-hosts")
+	if err := ensureHostsFile(hostsFilePath, podIPs, hostName, hostDomainName, hostAliases, useHostNetwork); err != nil {
+		return nil, err
+	}
+	return &kubecontainer.Mount{
+		Name:          "k8s-managed-etc-hosts",
+		ContainerPath: etcHostsPath,
+		HostPath:      hostsFilePath,
+		ReadOnly:      false,
+	}, nil
+}
+
+// ensureHostsFile ensures that the given host file has an up-to-date ip, host
+// name, and domain name.
+func ensureHostsFile(fileName string, hostIPs []string, hostName, hostDomainName string, hostAliases []v1.HostAlias, useHostNetwork bool) error {
+	var hostsFileContent []byte
+	var err error
+
+	if useHostNetwork {
+		// if Pod is using host network, read hosts file from the node's filesystem.
+		// `etcHostsPath` references the location of the hosts file on the node.
+		// `/etc/hosts` for *nix systems.
+		hostsFileContent, err = nodeHostsFileContent(etcHostsPath, hostAliases)
+		if err != nil {
+			return err
+		}
+	} else {
+		// if Pod is not using host network, create a managed hosts file with Pod IP and other information.
+		hostsFileContent = managedHostsFileContent(hostIPs, hostName, hostDomainName, hostAliases)
+	}
+
+	return os.WriteFile(fileName, hostsFileContent, 0644)
+}
+
+// nodeHostsFileContent reads the content of node's hosts file.
+func nodeHostsFileContent(hostsFilePath string, hostAliases []v1.HostAlias) ([]byte, error) {
+	hostsFileContent, err := os.ReadFile(hostsFilePath)
+	if err != nil {
+		return nil, err
+	}
+	var buffer bytes.Buffer
+	buffer.WriteString(managedHostsHeaderWithHostNetwork)
+	buffer.Write(hostsFileContent)
+	buffer.Write(hostsEntriesFromHostAliases(hostAliases))
+	return buffer.Bytes(), nil
+}
+
+// managedHostsFileContent generates the content of the managed etc hosts based on Pod IPs and other
+// information.
+func managedHostsFileContent(hostIPs []string, hostName, hostDomainName string, hostAliases []v1.HostAlias) []byte {
+	var buffer bytes.Buffer
+	buffer.WriteString(managedHostsHeader)
+	buffer.WriteString("127.0.0.1\tlocalhost\n")                      // ipv4 localhost
+	buffer.WriteString("::1\tlocalhost ip6-localhost ip6-loopback\n") // ipv6 localhost
+	buffer.WriteString("fe00::0\tip6-localnet\n")
+	buffer.WriteString("fe00::0\tip6-mcastprefix\n")
+	buffer.WriteString("fe00::1\tip6-allnodes\n")
+	buffer.WriteString("fe00::2\tip6-allrouters\n")
+	if len(hostDomainName) > 0 {
+		// host entry generated for all IPs in podIPs
+		// podIPs field is populated for clusters even
+		// dual-stack feature flag is not enabled.
+		for _, hostIP := range hostIPs {
+			buffer.WriteString(fmt.Sprintf("%s\t%s.%s\t%s\n", hostIP, hostName, hostDomainName, hostName))
+		}
+	} else {
+		for _, hostIP := range hostIPs {
+			buffer.WriteString(fmt.Sprintf("%s\t%s\n", hostIP, hostName))
+		}
+	}
+	buffer.Write(hostsEntriesFromHostAliases(hostAliases))
+	return buffer.Bytes()
+}
+
+func hostsEntriesFromHostAliases(hostAliases []v1.HostAlias) []byte {
+	if len(hostAliases) == 0 {
+		return []byte{}
+	}
+
+	var buffer bytes.Buffer
+	buffer.WriteString("\n")
+	buffer.WriteString("# Entries added by HostAliases.\n")
+	// for each IP, write all aliases onto single line in hosts file
+	for _, hostAlias := range hostAliases {
+		buffer.WriteString(fmt.Sprintf("%s\t%s\n", hostAlias.IP, strings.Join(hostAlias.Hostnames, "\t")))
+	}
+	return buffer.Bytes()
+}
+
+// translateMountPropagation transforms v1.MountPropagationMode to
+// runtimeapi.MountPropagation.
+func translateMountPropagation(mountMode *v1.MountPropagationMode) (runtimeapi.MountPropagation, error) {
+	switch {
+	case mountMode == nil:
+		// PRIVATE is the default
+		return runtimeapi.MountPropagation_PROPAGATION_PRIVATE, nil
+	case *mountMode == v1.MountPropagationHostToContainer:
+		return runtimeapi.MountPropagation_PROPAGATION_HOST_TO_CONTAINER, nil
+	case *mountMode == v1.MountPropagationBidirectional:
+		return runtimeapi.MountPropagation_PROPAGATION_BIDIRECTIONAL, nil
+	case *mountMode == v1.MountPropagationNone:
+		return runtimeapi.MountPropagation_PROPAGATION_PRIVATE, nil
+	default:
+		return 0, fmt.Errorf("invalid MountPropagation mode: %q", *mountMode)
+	}
+}
+
+// validatePathNoBacksteps makes sure the targetPath does not have any `..` path elements when split
+//
+// This assumes the OS of the apiserver and the nodes are the same. The same check should be done
+// on the node to ensure there are no backsteps.
+func validatePathNoBacksteps(targetPath string) error {
+	parts := strings.Split(filepath.ToSlash(targetPath), "/")
+	for _, item := range parts {
+		if item == ".." {
+			return fmt.Errorf("must not contain '..'")
+		}
+	}
+
+	return nil
+}
+
+// Make the environment variables for a pod in the given namespace.
+func (m *MyKubelet) makeEnvironmentVariables(pod *v1.Pod, container *v1.Container, podIP string, podIPs []string) ([]kubecontainer.EnvVar, error) {
+	var result []kubecontainer.EnvVar
+	// Determine the final values of variables:
+	//
+	// 1.  Determine the final value of each variable:
+	//     a.  If the variable's Value is set, expand the `$(var)` references to other
+	//         variables in the .Value field; the sources of variables are the declared
+	//         variables of the container
+	//     b.  If a source is defined for an environment variable, resolve the source
+	// 2.  Create the container's environment in the order variables are declared
+	var (
+		configMaps = make(map[string]*v1.ConfigMap)
+		secrets    = make(map[string]*v1.Secret)
+		tmpEnv     = make(map[string]string)
+		err        error
+	)
+
+	// Env will override EnvFrom variables.
+	// Process EnvFrom first then allow Env to replace existing values.
+	for _, envFrom := range container.EnvFrom {
+		switch {
+		case envFrom.ConfigMapRef != nil:
+			cm := envFrom.ConfigMapRef
+			name := cm.Name
+			configMap, ok := configMaps[name]
+			if !ok {
+				if m.KubeClient == nil {
+					return result, fmt.Errorf("couldn't get configMap %v/%v, no kubeClient defined", pod.Namespace, name)
+				}
+				optional := cm.Optional != nil && *cm.Optional
+				configMap, err = m.configMapManager.GetConfigMap(pod.Namespace, name)
+				if err != nil {
+					if errors.IsNotFound(err) && optional {
+						// ignore error when marked optional
+						continue
+					}
+					return result, err
+				}
+				configMaps[name] = configMap
+			}
+
+			invalidKeys := []string{}
+			for k, v := range configMap.Data {
+				if len(envFrom.Prefix) > 0 {
+					k = envFrom.Prefix + k
+				}
+				if errMsgs := utilvalidation.IsEnvVarName(k); len(errMsgs) != 0 {
+					invalidKeys = append(invalidKeys, k)
+					continue
+				}
+				tmpEnv[k] = v
+			}
+			if len(invalidKeys) > 0 {
+				sort.Strings(invalidKeys)
+				m.recorder.Eventf(pod, v1.EventTypeWarning, "InvalidEnvironmentVariableNames", "Keys [%s] from the EnvFrom configMap %s/%s were skipped since they are considered invalid environment variable names.", strings.Join(invalidKeys, ", "), pod.Namespace, name)
+			}
+		case envFrom.SecretRef != nil:
+			s := envFrom.SecretRef
+			name := s.Name
+			secret, ok := secrets[name]
+			if !ok {
+				if m.KubeClient == nil {
+					return result, fmt.Errorf("couldn't get secret %v/%v, no kubeClient defined", pod.Namespace, name)
+				}
+				optional := s.Optional != nil && *s.Optional
+				secret, err = m.secretManager.GetSecret(pod.Namespace, name)
+				if err != nil {
+					if errors.IsNotFound(err) && optional {
+						// ignore error when marked optional
+						continue
+					}
+					return result, err
+				}
+				secrets[name] = secret
+			}
+
+			invalidKeys := []string{}
+			for k, v := range secret.Data {
+				if len(envFrom.Prefix) > 0 {
+					k = envFrom.Prefix + k
+				}
+				if errMsgs := utilvalidation.IsEnvVarName(k); len(errMsgs) != 0 {
+					invalidKeys = append(invalidKeys, k)
+					continue
+				}
+				tmpEnv[k] = string(v)
+			}
+			if len(invalidKeys) > 0 {
+				sort.Strings(invalidKeys)
+				m.recorder.Eventf(pod, v1.EventTypeWarning, "InvalidEnvironmentVariableNames", "Keys [%s] from the EnvFrom secret %s/%s were skipped since they are considered invalid environment variable names.", strings.Join(invalidKeys, ", "), pod.Namespace, name)
+			}
+		}
+	}
+
+	mappingFunc := expansion.MappingFuncFor(tmpEnv)
+	for _, envVar := range container.Env {
+		runtimeVal := envVar.Value
+		if runtimeVal != "" {
+			// Step 1a: expand variable references
+			runtimeVal = expansion.Expand(runtimeVal, mappingFunc)
+		} else if envVar.ValueFrom != nil {
+			// Step 1b: resolve alternate env var sources
+			switch {
+			case envVar.ValueFrom.FieldRef != nil:
+				runtimeVal, err = m.podFieldSelectorRuntimeValue(envVar.ValueFrom.FieldRef, pod, podIP, podIPs)
+				if err != nil {
+					return result, err
+				}
+			case envVar.ValueFrom.ResourceFieldRef != nil:
+				defaultedPod, defaultedContainer, err := m.defaultPodLimitsForDownwardAPI(pod, container)
+				if err != nil {
+					return result, err
+				}
+				runtimeVal, err = containerResourceRuntimeValue(envVar.ValueFrom.ResourceFieldRef, defaultedPod, defaultedContainer)
+				if err != nil {
+					return result, err
+				}
+			case envVar.ValueFrom.ConfigMapKeyRef != nil:
+				cm := envVar.ValueFrom.ConfigMapKeyRef
+				name := cm.Name
+				key := cm.Key
+				optional := cm.Optional != nil && *cm.Optional
+				configMap, ok := configMaps[name]
+				if !ok {
+					if m.KubeClient == nil {
+						return result, fmt.Errorf("couldn't get configMap %v/%v, no kubeClient defined", pod.Namespace, name)
+					}
+					configMap, err = m.configMapManager.GetConfigMap(pod.Namespace, name)
+					if err != nil {
+						if errors.IsNotFound(err) && optional {
+							// ignore error when marked optional
+							continue
+						}
+						return result, err
+					}
+					configMaps[name] = configMap
+				}
+				runtimeVal, ok = configMap.Data[key]
+				if !ok {
+					if optional {
+						continue
+					}
+					return result, fmt.Errorf("couldn't find key %v in ConfigMap %v/%v", key, pod.Namespace, name)
+				}
+			case envVar.ValueFrom.SecretKeyRef != nil:
+				s := envVar.ValueFrom.SecretKeyRef
+				name := s.Name
+				key := s.Key
+				optional := s.Optional != nil && *s.Optional
+				secret, ok := secrets[name]
+				if !ok {
+					if m.KubeClient == nil {
+						return result, fmt.Errorf("couldn't get secret %v/%v, no kubeClient defined", pod.Namespace, name)
+					}
+					secret, err = m.secretManager.GetSecret(pod.Namespace, name)
+					if err != nil {
+						if errors.IsNotFound(err) && optional {
+							// ignore error when marked optional
+							continue
+						}
+						return result, err
+					}
+					secrets[name] = secret
+				}
+				runtimeValBytes, ok := secret.Data[key]
+				if !ok {
+					if optional {
+						continue
+					}
+					return result, fmt.Errorf("couldn't find key %v in Secret %v/%v", key, pod.Namespace, name)
+				}
+				runtimeVal = string(runtimeValBytes)
+			}
+		}
+
+		tmpEnv[envVar.Name] = runtimeVal
+	}
+
+	// Append the env vars
+	for k, v := range tmpEnv {
+		result = append(result, kubecontainer.EnvVar{Name: k, Value: v})
+	}
+
+	return result, nil
+}
+
+// podFieldSelectorRuntimeValue returns the runtime value of the given
+// selector for a pod.
+func (m *MyKubelet) podFieldSelectorRuntimeValue(fs *v1.ObjectFieldSelector, pod *v1.Pod, podIP string, podIPs []string) (string, error) {
+	internalFieldPath, _, err := podshelper.ConvertDownwardAPIFieldLabel(fs.APIVersion, fs.FieldPath, "")
+	if err != nil {
+		return "", err
+	}
+
+	if len(podIPs) > 0 {
+		podIP = podIPs[0]
+	}
+
+	switch internalFieldPath {
+	case "spec.nodeName":
+		return pod.Spec.NodeName, nil
+	case "spec.serviceAccountName":
+		return pod.Spec.ServiceAccountName, nil
+	case "status.hostIP":
+		hostIPs, err := m.getHostIPsAnyWay()
+		if err != nil {
+			return "", err
+		}
+		return hostIPs[0].String(), nil
+	case "status.podIP":
+		return podIP, nil
+	case "status.podIPs":
+		return strings.Join(podIPs, ","), nil
+	}
+	return fieldpath.ExtractFieldPathAsString(pod, internalFieldPath)
+}
+
+// containerResourceRuntimeValue returns the value of the provided container resource
+func containerResourceRuntimeValue(fs *v1.ResourceFieldSelector, pod *v1.Pod, container *v1.Container) (string, error) {
+	containerName := fs.ContainerName
+	if len(containerName) == 0 {
+		return resource.ExtractContainerResourceValue(fs, container)
+	}
+	return resource.ExtractResourceValueByContainerName(fs, pod, containerName)
+}
+
+// GetPodDNS returns DNS settings for the pod.
+// This function is defined in kubecontainer.RuntimeHelper interface so we
+// have to implement it.
+func (m *MyKubelet) GetPodDNS(pod *v1.Pod) (*runtimeapi.DNSConfig, error) {
+	return m.dnsConfigurer.GetPodDNS(pod)
+}
+
+// GetPodCgroupParent gets pod cgroup parent from container manager.
+func (m *MyKubelet) GetPodCgroupParent(pod *v1.Pod) string {
+	pcm := m.containerManager.NewPodContainerManager()
+	_, cgroupParent := pcm.GetPodContainerName(pod)
+	return cgroupParent
+}
+
+// cgroupsPerQOS returns whether pods run in cgroups of their own below the
+// QoS cgroups, which is not the case when cgroups are unavailable.
+func (m *MyKubelet) cgroupsPerQOS() bool {
+	return m.containerManager.Status().SoftRequirements == nil
+}
+
+// GetActivePods returns pods that have been admitted to the kubelet that
+// are not fully terminated. This is mapped to the "desired state" of the
+// kubelet - what pods should be running.
+func (m *MyKubelet) GetActivePods() []*v1.Pod {
+	allPods := m.PodManager.GetPods()
+	activePods := m.filterOutInactivePods(allPods)
+	return activePods
+}
+
+// filterOutInactivePods returns pods that are not in a terminal phase
+// or are known to be fully terminated. This method should only be used
+// when the set of pods being filtered is upstream of the pod worker, i.e.
+// the pods the pod manager is aware of.
+func (m *MyKubelet) filterOutInactivePods(pods []*v1.Pod) []*v1.Pod {
+	filteredPods := make([]*v1.Pod, 0, len(pods))
+	for _, p := range pods {
+		// if a pod is fully terminated by UID, it should be excluded from the
+		// list of pods
+		if m.PodWorkers.IsPodKnownTerminated(p.UID) {
+			continue
+		}
+
+		// terminal pods are considered inactive UNLESS they are actively terminating
+		if m.isAdmittedPodTerminal(p) && !m.PodWorkers.IsPodTerminationRequested(p.UID) {
+			continue
+		}
+
+		filteredPods = append(filteredPods, p)
+	}
+	return filteredPods
+}
+
+// isAdmittedPodTerminal returns true if the provided config source pod is in
+// a terminal phase, or if the Kubelet has already indicated the pod has reached
+// a terminal phase but the config source has not accepted it yet. This method
+// should only be used within the pod configuration loops that notify the pod
+// worker, other components should treat the pod worker as authoritative.
+func (m *MyKubelet) isAdmittedPodTerminal(pod *v1.Pod) bool {
+	// pods are considered inactive if the config source has observed a
+	// terminal phase (if the Kubelet recorded that the pod reached a terminal
+	// phase the pod should never be restarted)
+	if pod.Status.Phase == v1.PodSucceeded || pod.Status.Phase == v1.PodFailed {
+		return true
+	}
+	// a pod that has been marked terminal within the Kubelet is considered
+	// inactive (may have been rejected by Kubelet admision)
+	if status, ok := m.statusManager.GetPodStatus(pod.UID); ok {
+		if status.Phase == v1.PodSucceeded || status.Phase == v1.PodFailed {
+			return true
+		}
+	}
+	return false
+}
+
+// getPullSecretsForPod inspects the Pod and retrieves the referenced pull
+// secrets.
+func (m *MyKubelet) getPullSecretsForPod(pod *v1.Pod) []v1.Secret {
+	pullSecrets := []v1.Secret{}
+
+	for _, secretRef := range pod.Spec.ImagePullSecrets {
+		if len(secretRef.Name) == 0 {
+			// API validation permitted entries with empty names (https://issue.k8s.io/99454#issuecomment-787838112).
+			// Ignore to avoid unnecessary warnings.
+			continue
+		}
+		secret, err := m.secretManager.GetSecret(pod.Namespace, secretRef.Name)
+		if err != nil {
+			klog.InfoS("Unable to retrieve pull secret, the image pull may not succeed.", "pod", klog.KObj(pod), "secret", klog.KObj(secret), "err", err)
+			continue
+		}
+
+		pullSecrets = append(pullSecrets, *secret)
+	}
+
+	return pullSecrets
+}
+
+// GetExtraSupplementalGroupsForPod returns a list of the extra
+// supplemental groups for the Pod. These extra supplemental groups come
+// from annotations on persistent volumes that the pod depends on.
+func (m *MyKubelet) GetExtraSupplementalGroupsForPod(pod *v1.Pod) []int64 {
+	return nil
+}
+
+var _ kubecontainer.RuntimeHelper = &MyKubelet{}
+
+// killPod instructs the container runtime to kill the pod. This method requires that
+// the pod status contains the result of the last syncPod, otherwise it may fail to
+// terminate newly created containers and sandboxes.
+func (m *MyKubelet) killPod(pod *v1.Pod, p kubecontainer.Pod, gracePeriodOverride *int64) error {
+	// Call the container runtime KillPod method which stops all known running containers of the pod
+	if err := m.containerRuntime.KillPod(pod, p, gracePeriodOverride); err != nil {
+		return err
+	}
+	return nil
+}
+
+// validateContainerLogStatus returns the container ID for the desired container to retrieve logs for, based on the state
+// of the container. The previous flag will only return the logs for the last terminated container, otherwise, the current
+// running container is preferred over a previous termination. If info about the container is not available then a specific
+// error is returned to the end user.
+func (m *MyKubelet) validateContainerLogStatus(podName string, podStatus *v1.PodStatus, containerName string, previous bool) (containerID kubecontainer.ContainerID, err error) {
+	var cID string
+
+	cStatus, found := podutil.GetContainerStatus(podStatus.ContainerStatuses, containerName)
+	if !found {
+		cStatus, found = podutil.GetContainerStatus(podStatus.InitContainerStatuses, containerName)
+	}
+	if !found {
+		return kubecontainer.ContainerID{}, fmt.Errorf("container %q in pod %q is not available", containerName, podName)
+	}
+	lastState := cStatus.LastTerminationState
+	waiting, running, terminated := cStatus.State.Waiting, cStatus.State.Running, cStatus.State.Terminated
+
+	switch {
+	case previous:
+		if lastState.Terminated == nil || lastState.Terminated.ContainerID == "" {
+			return kubecontainer.ContainerID{}, fmt.Errorf("previous terminated container %q in pod %q not found", containerName, podName)
+		}
+		cID = lastState.Terminated.ContainerID
+
+	case running != nil:
+		cID = cStatus.ContainerID
+
+	case terminated != nil:
+		// in cases where the next container didn't start, terminated.ContainerID will be empty, so get logs from the lastState.Terminated.
+		if terminated.ContainerID == "" {
+			if lastState.Terminated != nil && lastState.Terminated.ContainerID != "" {
+				cID = lastState.Terminated.ContainerID
+			} else {
+				return kubecontainer.ContainerID{}, fmt.Errorf("container %q in pod %q is terminated", containerName, podName)
+			}
+		} else {
+			cID = terminated.ContainerID
+		}
+
+	case lastState.Terminated != nil:
+		if lastState.Terminated.ContainerID == "" {
+			return kubecontainer.ContainerID{}, fmt.Errorf("container %q in pod %q is terminated", containerName, podName)
+		}
+		cID = lastState.Terminated.ContainerID
+
+	case waiting != nil:
+		// output some info for the most common pending failures
+		return kubecontainer.ContainerID{}, fmt.Errorf("container %q in pod %q is waiting to start: %v", containerName, podName, waiting.Reason)
+	default:
+		// unrecognized state
+		return kubecontainer.ContainerID{}, fmt.Errorf("container %q in pod %q is waiting to start - no logs yet", containerName, podName)
+	}
+
+	// Use the container ID in the status. The container ID format for CRI logs is "type://id".
+	containerID = kubecontainer.ContainerID{}
+	if err := containerID.ParseString(cID); err != nil {
+		return kubecontainer.ContainerID{}, fmt.Errorf("unable to parse container ID %q: %v", cID, err)
+	}
+	return containerID, nil
+}
+
+// GetKubeletContainerLogs returns logs from the container
+// TODO: this method is returning logs of random container attempts, when it should be returning the most recent attempt
+// or all of them.
+func (m *MyKubelet) GetKubeletContainerLogs(ctx context.Context, podFullName, containerName string, logOptions *v1.PodLogOptions, stdout, stderr io.Writer) error {
+	// Pod workers periodically write status to statusManager. If status is not
+	// cached there, something is wrong (or kubelet just restarted and hasn't
+	// caught up yet). Just assume the pod is not ready yet.
+	name, namespace, err := kubecontainer.ParsePodFullName(podFullName)
+	if err != nil {
+		return fmt.Errorf("unable to parse pod full name %q: %v", podFullName, err)
+	}
+
+	pod, ok := m.PodManager.GetPodByName(namespace, name)
+	if !ok {
+		return fmt.Errorf("pod %q cannot be found - no logs available", name)
+	}
+
+	podUID := pod.UID
+	if mirrorPod, ok := m.PodManager.GetMirrorPodByPod(pod); ok {
+		podUID = mirrorPod.UID
+	}
+	podStatus, found := m.statusManager.GetPodStatus(podUID)
+	if !found {
+		// If there is no cached status, use the status from the
+		// apiserver. This is useful if kubelet has recently been
+		// restarted.
+		podStatus = pod.Status
+	}
+
+	containerID, err := m.validateContainerLogStatus(pod.Name, &podStatus, containerName, logOptions.Previous)
+	if err != nil {
+		return err
+	}
+
+	// Do a zero-byte write to stdout before handing off to the container runtime.
+	// This ensures at least one Write call is made to the writer when copying starts,
+	// even if we then block waiting for log output from the container.
+	if _, err := stdout.Write([]byte{}); err != nil {
+		return err
+	}
+
+	return m.containerRuntime.GetContainerLogs(ctx, pod, containerID, logOptions, stdout, stderr)
+}
+
+// GetPodByName provides the first pod that matches namespace and name, as
+// well as whether the pod was found.
+func (m *MyKubelet) GetPodByName(namespace, name string) (*v1.Pod, bool) {
+	return m.PodManager.GetPodByName(namespace, name)
+}
+
+// findContainer finds and returns the container with the given pod ID, full name, and container name.
+// It returns nil if not found.
+func (m *MyKubelet) findContainer(podFullName string, podUID types.UID, containerName string) (*kubecontainer.Container, error) {
+	pods, err := m.containerRuntime.GetPods(false)
+	if err != nil {
+		return nil, err
+	}
+	// Resolve and type convert back again.
+	// We need the static pod UID but the kubecontainer API works with types.UID.
+	podUID = types.UID(m.PodManager.TranslatePodUID(podUID))
+	pod := kubecontainer.Pods(pods).FindPod(podFullName, podUID)
+	return pod.FindContainerByName(containerName), nil
+}
+
+// GetExec gets the URL the exec will be served from.
+func (m *MyKubelet) GetExec(podFullName string, podUID types.UID, containerName string, cmd []string, streamOpts remotecommandserver.Options) (*url.URL, error) {
+	container, err := m.findContainer(podFullName, podUID, containerName)
+	if err != nil {
+		return nil, err
+	}
+	if container == nil {
+		return nil, fmt.Errorf("container not found (%q)", containerName)
+	}
+	return m.streamingRuntime.GetExec(container.ID, cmd, streamOpts.Stdin, streamOpts.Stdout, streamOpts.Stderr, streamOpts.TTY)
+}
+
+// GetAttach gets the URL the attach will be served from.
+func (m *MyKubelet) GetAttach(podFullName string, podUID types.UID, containerName string, streamOpts remotecommandserver.Options) (*url.URL, error) {
+	container, err := m.findContainer(podFullName, podUID, containerName)
+	if err != nil {
+		return nil, err
+	}
+	if container == nil {
+		return nil, fmt.Errorf("container %s not found in pod %s", containerName, podFullName)
+	}
+
+	// The TTY setting for attach must match the TTY setting in the initial container configuration,
+	// since whether the process is running in a TTY cannot be changed after it has started.  We
+	// need the api.Pod to get the TTY status.
+	pod, found := m.PodManager.GetPodByFullName(podFullName)
+	if !found || (string(podUID) != "" && pod.UID != podUID) {
+		return nil, fmt.Errorf("pod %s not found", podFullName)
+	}
+	containerSpec := kubecontainer.GetContainerSpec(pod, containerName)
+	if containerSpec == nil {
+		return nil, fmt.Errorf("container %s not found in pod %s", containerName, podFullName)
+	}
+	tty := containerSpec.TTY
+
+	return m.streamingRuntime.GetAttach(container.ID, streamOpts.Stdin, streamOpts.Stdout, streamOpts.Stderr, tty)
+}
+
+// GetPortForward gets the URL the port-forward will be served from.
+func (m *MyKubelet) GetPortForward(podName, podNamespace string, podUID types.UID, portForwardOpts portforward.V4Options) (*url.URL, error) {
+	pods, err := m.containerRuntime.GetPods(false)
+	if err != nil {
+		return nil, err
+	}
+	// Resolve and type convert back again.
+	// We need the static pod UID but the kubecontainer API works with types.UID.
+	podUID = types.UID(m.PodManager.TranslatePodUID(podUID))
+	podFullName := kubecontainer.BuildPodFullName(podName, podNamespace)
+	pod := kubecontainer.Pods(pods).FindPod(podFullName, podUID)
+	if pod.IsEmpty() {
+		return nil, fmt.Errorf("pod not found (%q)", podFullName)
+	}
+
+	return m.streamingRuntime.GetPortForward(podName, podNamespace, podUID, portForwardOpts.Ports)
+}
+
+// HandlePodCleanups performs a series of cleanup work, including terminating
+// pod workers, killing unwanted pods, and removing orphaned volumes/pod
+// directories. No config changes are sent to pod workers while this method
+// is executing which means no new pods can appear.
+// NOTE: This function is executed by the main sync loop, so it
+// should not contain any blocking calls.
+func (m *MyKubelet) HandlePodCleanups() error {
+	// The kubelet lacks checkpointing, so we need to introspect the set of pods
+	// in the cgroup tree prior to inspecting the set of pods in our pod manager.
+	// this ensures our view of the cgroup tree does not mistakenly observe pods
+	// that are added after the fact...
+	var (
+		cgroupPods map[types.UID]cm.CgroupName
+		err        error
+	)
+	if m.cgroupsPerQOS() {
+		pcm := m.containerManager.NewPodContainerManager()
+		cgroupPods, err = pcm.GetAllPodsFromCgroups()
+		if err != nil {
+			return fmt.Errorf("failed to get list of pods that still exist on cgroup mounts: %v", err)
+		}
+	}
+
+	allPods, _ := m.PodManager.GetPodsAndMirrorPods()
+
+	// Pod phase progresses monotonically. Once a pod has reached a final state,
+	// it should never leave regardless of the restart policy. The statuses
+	// of such pods should not be changed, and there is no need to sync them.
+	workingPods := m.PodWorkers.SyncKnownPods(allPods)
+
+	allPodsByUID := make(map[types.UID]*v1.Pod)
+	for _, pod := range allPods {
+		allPodsByUID[pod.UID] = pod
+	}
+
+	// Stop probing pods that are not running
+	possiblyRunningPods := make(map[types.UID]sets.Empty)
+	for uid, state := range workingPods {
+		switch state {
+		case SyncPod, TerminatingPod:
+			possiblyRunningPods[uid] = struct{}{}
+		}
+	}
+	m.probeManager.CleanupPods(possiblyRunningPods)
+
+	// Retrieve the list of running containers from the runtime to perform cleanup.
+	runningRuntimePods, err := m.containerRuntime.GetPods(false)
+	if err != nil {
+		klog.ErrorS(err, "Error listing containers")
+		return err
+	}
+	for _, runningPod := range runningRuntimePods {
+		switch workerState, ok := workingPods[runningPod.ID]; {
+		case ok && workerState == SyncPod, ok && workerState == TerminatingPod:
+			// if the pod worker is already in charge of this pod, we don't need to do anything
+			continue
+		default:
+			// If the pod isn't in the set that should be running and isn't already terminating, terminate
+			// now. This termination is aggressive because all known pods should already be in a known state
+			// (i.e. a removed static pod should already be terminating), so these are pods that were
+			// orphaned due to kubelet restart or bugs. Since housekeeping blocks other config changes, we
+			// know that another pod wasn't started in the background so we are safe to terminate the
+			// unknown pods.
+			if _, ok := allPodsByUID[runningPod.ID]; !ok {
+				klog.V(3).InfoS("Clean up orphaned pod containers", "podUID", runningPod.ID)
+				one := int64(1)
+				m.PodWorkers.UpdatePod(UpdatePodOptions{
+					UpdateType: kubetypes.SyncPodKill,
+					RunningPod: runningPod,
+					KillPodOptions: &KillPodOptions{
+						PodTerminationGracePeriodSecondsOverride: &one,
+					},
+				})
+			}
+		}
+	}
+
+	// Remove any orphaned statuses of pods the kubelet no longer knows.
+	podUIDs := make(map[types.UID]bool)
+	for _, pod := range allPods {
+		podUIDs[pod.UID] = true
+	}
+	m.statusManager.RemoveOrphanedStatuses(podUIDs)
+
+	// Remove any orphaned volumes.
+	// Note that we pass all pods (including terminated pods) to the function,
+	// so that we don't remove volumes associated with terminated but not yet
+	// deleted pods.
+	klog.V(3).InfoS("Clean up orphaned pod directories")
+	err = m.cleanupOrphanedPodDirs(allPods, runningRuntimePods)
+	if err != nil {
+		// We want all cleanup tasks to be run even if one of them failed. So
+		// we just log an error here and continue other cleanup tasks.
+		// This also applies to the other clean up tasks.
+		klog.ErrorS(err, "Failed cleaning up orphaned pod directories")
+	}
+
+	// Remove any cgroups in the hierarchy for pods that are no longer running.
+	if m.cgroupsPerQOS() {
+		pcm := m.containerManager.NewPodContainerManager()
+		klog.V(3).InfoS("Clean up orphaned pod cgroups")
+		m.cleanupOrphanedPodCgroups(pcm, cgroupPods, possiblyRunningPods)
+	}
+
+	// Remove any stale entries in the restart back-off
+	m.backOff.GC()
+
+	return nil
+}
+
+// cleanupOrphanedPodCgroups removes cgroups that should no longer exist.
+// it reconciles the cached state of cgroupPods with the specified list of runningPods
+func (m *MyKubelet) cleanupOrphanedPodCgroups(pcm cm.PodContainerManager, cgroupPods map[types.UID]cm.CgroupName, possiblyRunningPods map[types.UID]sets.Empty) {
+	// Iterate over all the found pods to verify if they should be running
+	for uid, val := range cgroupPods {
+		// if the pod is in the running set, its not a candidate for cleanup
+		if _, ok := possiblyRunningPods[uid]; ok {
+			continue
+		}
+
+		// If volumes have not been unmounted/detached, do not delete the cgroup
+		// so any memory backed volumes don't have their charges propagated to the
+		// parent croup.
+		if podVolumesExist := m.podVolumesExist(uid); podVolumesExist {
+			klog.V(3).InfoS("Orphaned pod found, but volumes not yet removed", "podUID", uid)
+			continue
+		}
+		klog.V(3).InfoS("Orphaned pod found, removing pod cgroups", "podUID", uid)
+		// Destroy all cgroups of pod that should not be running,
+		// by first killing all the attached processes to these cgroups.
+		// We ignore errors thrown by the method, as the housekeeping loop would
+		// again try to delete these unwanted pod cgroups
+		go pcm.Destroy(val)
+	}
+}
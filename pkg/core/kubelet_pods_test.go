@@ -0,0 +1,201 @@
+package core
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	kubecontainer "github.com/xuliangTang/mykubelet/pkg/kubelet/container"
+	v1 "k8s.io/api/core/v1"
+	runtimeapi "k8s.io/cri-api/pkg/apis/runtime/v1alpha2"
+)
+
+func TestValidateContainerLogStatus(t *testing.T) {
+	m := &MyKubelet{}
+	containerName := "x"
+	for desc, test := range map[string]struct {
+		status   v1.ContainerStatus
+		previous bool
+		expectID string
+		err      bool
+	}{
+		"running container": {
+			status: v1.ContainerStatus{
+				Name:        containerName,
+				ContainerID: "process://current",
+				State:       v1.ContainerState{Running: &v1.ContainerStateRunning{}},
+			},
+			expectID: "current",
+		},
+		"previous container": {
+			status: v1.ContainerStatus{
+				Name:                 containerName,
+				ContainerID:          "process://current",
+				State:                v1.ContainerState{Running: &v1.ContainerStateRunning{}},
+				LastTerminationState: v1.ContainerState{Terminated: &v1.ContainerStateTerminated{ContainerID: "process://previous"}},
+			},
+			previous: true,
+			expectID: "previous",
+		},
+		"previous container not found": {
+			status: v1.ContainerStatus{
+				Name:        containerName,
+				ContainerID: "process://current",
+				State:       v1.ContainerState{Running: &v1.ContainerStateRunning{}},
+			},
+			previous: true,
+			err:      true,
+		},
+		"terminated container without id falls back to the last one": {
+			status: v1.ContainerStatus{
+				Name:                 containerName,
+				State:                v1.ContainerState{Terminated: &v1.ContainerStateTerminated{}},
+				LastTerminationState: v1.ContainerState{Terminated: &v1.ContainerStateTerminated{ContainerID: "process://previous"}},
+			},
+			expectID: "previous",
+		},
+		"waiting container": {
+			status: v1.ContainerStatus{
+				Name:  containerName,
+				State: v1.ContainerState{Waiting: &v1.ContainerStateWaiting{Reason: "ContainerCreating"}},
+			},
+			err: true,
+		},
+	} {
+		t.Run(desc, func(t *testing.T) {
+			podStatus := &v1.PodStatus{ContainerStatuses: []v1.ContainerStatus{test.status}}
+			id, err := m.validateContainerLogStatus("pod", podStatus, containerName, test.previous)
+			if test.err {
+				if err == nil {
+					t.Fatalf("expected error, got container %v", id)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if id.ID != test.expectID {
+				t.Errorf("expected container %q, got %q", test.expectID, id.ID)
+			}
+		})
+	}
+}
+
+func TestSandboxInHostNetwork(t *testing.T) {
+	sandbox := func(network runtimeapi.NamespaceMode) *runtimeapi.PodSandboxStatus {
+		return &runtimeapi.PodSandboxStatus{
+			Linux: &runtimeapi.LinuxPodSandboxStatus{
+				Namespaces: &runtimeapi.Namespace{Options: &runtimeapi.NamespaceOption{Network: network}},
+			},
+		}
+	}
+	for desc, test := range map[string]struct {
+		status *kubecontainer.PodStatus
+		expect bool
+	}{
+		"no sandbox": {
+			status: &kubecontainer.PodStatus{},
+		},
+		"host network": {
+			status: &kubecontainer.PodStatus{SandboxStatuses: []*runtimeapi.PodSandboxStatus{sandbox(runtimeapi.NamespaceMode_NODE)}},
+			expect: true,
+		},
+		"pod network": {
+			status: &kubecontainer.PodStatus{SandboxStatuses: []*runtimeapi.PodSandboxStatus{sandbox(runtimeapi.NamespaceMode_POD)}},
+		},
+		"only the latest sandbox counts": {
+			status: &kubecontainer.PodStatus{SandboxStatuses: []*runtimeapi.PodSandboxStatus{
+				sandbox(runtimeapi.NamespaceMode_POD),
+				sandbox(runtimeapi.NamespaceMode_NODE),
+			}},
+		},
+		"no namespace options": {
+			status: &kubecontainer.PodStatus{SandboxStatuses: []*runtimeapi.PodSandboxStatus{{}}},
+		},
+	} {
+		t.Run(desc, func(t *testing.T) {
+			if got := sandboxInHostNetwork(test.status); got != test.expect {
+				t.Errorf("expected %v, got %v", test.expect, got)
+			}
+		})
+	}
+}
+
+func TestManagedHostsFileContent(t *testing.T) {
+	aliases := []v1.HostAlias{{IP: "10.0.0.9", Hostnames: []string{"db", "db.local"}}}
+	for desc, test := range map[string]struct {
+		ips      []string
+		domain   string
+		expected []string
+	}{
+		"pod IPs": {
+			ips:      []string{"10.1.0.5", "fd00::5"},
+			expected: []string{"10.1.0.5\tpod\n", "fd00::5\tpod\n"},
+		},
+		"pod IPs with a subdomain": {
+			ips:      []string{"10.1.0.5"},
+			domain:   "sub.ns.svc.cluster.local",
+			expected: []string{"10.1.0.5\tpod.sub.ns.svc.cluster.local\tpod\n"},
+		},
+	} {
+		t.Run(desc, func(t *testing.T) {
+			content := string(managedHostsFileContent(test.ips, "pod", test.domain, aliases))
+			if !strings.HasPrefix(content, managedHostsHeader+"127.0.0.1\tlocalhost\n") {
+				t.Errorf("expected the managed header and localhost first, got %q", content)
+			}
+			for _, e := range append(test.expected, "# Entries added by HostAliases.\n10.0.0.9\tdb\tdb.local\n") {
+				if !strings.Contains(content, e) {
+					t.Errorf("expected %q in %q", e, content)
+				}
+			}
+		})
+	}
+}
+
+func TestMakeHostsMount(t *testing.T) {
+	podDir := t.TempDir()
+	mount, err := makeHostsMount(podDir, []string{"192.168.1.10"}, "pod", "", nil, false)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if mount.ContainerPath != etcHostsPath || mount.HostPath != filepath.Join(podDir, "etc-hosts") {
+		t.Errorf("unexpected mount %+v", mount)
+	}
+	data, err := os.ReadFile(mount.HostPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), "192.168.1.10\tpod\n") {
+		t.Errorf("expected the pod hostname to resolve to the given IP, got %q", data)
+	}
+}
+
+func TestMakeMountsHostsFile(t *testing.T) {
+	pod := &v1.Pod{Spec: v1.PodSpec{Containers: []v1.Container{{Name: "c"}}}}
+	for desc, test := range map[string]struct {
+		podIPs                    []string
+		supportsSingleFileMapping bool
+		expectHosts               bool
+	}{
+		"pod with IPs":                  {podIPs: []string{"192.168.1.10"}, supportsSingleFileMapping: true, expectHosts: true},
+		"pod without IPs":               {supportsSingleFileMapping: true},
+		"runtime without file mappings": {podIPs: []string{"192.168.1.10"}},
+	} {
+		t.Run(desc, func(t *testing.T) {
+			mounts, err := makeMounts(pod, t.TempDir(), &pod.Spec.Containers[0], "pod", "", test.podIPs, nil, nil, test.supportsSingleFileMapping)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			hasHosts := false
+			for _, m := range mounts {
+				if m.ContainerPath == etcHostsPath {
+					hasHosts = true
+				}
+			}
+			if hasHosts != test.expectHosts {
+				t.Errorf("expected hosts mount %v, got %v", test.expectHosts, hasHosts)
+			}
+		})
+	}
+}
@@ -0,0 +1,89 @@
+package core
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"path/filepath"
+
+	"github.com/xuliangTang/mykubelet/pkg/kubelet/server"
+	certutil "k8s.io/client-go/util/cert"
+	"k8s.io/client-go/util/keyutil"
+	"k8s.io/klog/v2"
+)
+
+const (
+	// certDirName is the directory below the root directory holding the
+	// self-signed serving certificate of the kubelet.
+	certDirName = "pki"
+)
+
+// ListenAndServe runs the kubelet HTTPS server.
+func (m *MyKubelet) ListenAndServe() {
+	address := net.ParseIP(m.address)
+	if address == nil {
+		klog.ErrorS(nil, "Invalid address of the kubelet server", "address", m.address)
+		return
+	}
+	tlsOptions, err := m.initializeTLS()
+	if err != nil {
+		klog.ErrorS(err, "Failed to initialize the TLS of the kubelet server")
+		return
+	}
+	if err := server.ListenAndServeKubeletServer(m, m.streamingHandler, m.serverAuthorizer(), m.HostName, address, uint(m.port), tlsOptions); err != nil {
+		klog.ErrorS(err, "Failed to listen and serve")
+	}
+}
+
+// initializeTLS sets up the TLS options of the kubelet server. Without a
+// certificate and key, a self-signed certificate is generated in the root
+// directory and reused across restarts. Only the clients presenting a
+// certificate signed by the client CA are accepted.
+func (m *MyKubelet) initializeTLS() (*server.TLSOptions, error) {
+	certFile, keyFile := m.tlsCertFile, m.tlsPrivateKeyFile
+	if certFile == "" && keyFile == "" {
+		certFile = filepath.Join(m.getRootDir(), certDirName, "kubelet.crt")
+		keyFile = filepath.Join(m.getRootDir(), certDirName, "kubelet.key")
+
+		canReadCertAndKey, err := certutil.CanReadCertAndKey(certFile, keyFile)
+		if err != nil {
+			return nil, err
+		}
+		if !canReadCertAndKey {
+			cert, key, err := certutil.GenerateSelfSignedCertKey(m.HostName, nil, nil)
+			if err != nil {
+				return nil, fmt.Errorf("unable to generate self signed cert: %w", err)
+			}
+			if err := certutil.WriteCert(certFile, cert); err != nil {
+				return nil, err
+			}
+			if err := keyutil.WriteKey(keyFile, key); err != nil {
+				return nil, err
+			}
+			klog.V(4).InfoS("Using self-signed cert", "TLSCertFile", certFile, "TLSPrivateKeyFile", keyFile)
+		}
+	}
+
+	clientCAs, err := certutil.NewPool(m.clientCAFile)
+	if err != nil {
+		return nil, fmt.Errorf("unable to load client CA file %s: %w", m.clientCAFile, err)
+	}
+	return &server.TLSOptions{
+		Config: &tls.Config{
+			MinVersion: tls.VersionTLS12,
+			ClientCAs:  clientCAs,
+			ClientAuth: tls.RequireAndVerifyClientCert,
+		},
+		CertFile: certFile,
+		KeyFile:  keyFile,
+	}, nil
+}
+
+// serverAuthorizer returns the authorizer of the requests to the kubelet
+// server: the allow-list if one is configured, or else SubjectAccessReviews.
+func (m *MyKubelet) serverAuthorizer() server.Authorizer {
+	if len(m.authorizedUsers) > 0 || len(m.authorizedGroups) > 0 {
+		return server.NewAllowListAuthorizer(m.authorizedUsers, m.authorizedGroups)
+	}
+	return server.NewSubjectAccessReviewAuthorizer(m.KubeClient.AuthorizationV1().SubjectAccessReviews())
+}
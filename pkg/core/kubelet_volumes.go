@@ -0,0 +1,83 @@
+package core
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	kubecontainer "github.com/xuliangTang/mykubelet/pkg/kubelet/container"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/klog/v2"
+)
+
+// podVolumesExist checks with the volume manager and returns true any of the
+// pods for the specified volume are mounted.
+func (m *MyKubelet) podVolumesExist(podUID types.UID) bool {
+	return m.volumeManager.PodVolumesExist(podUID)
+}
+
+// listPodsFromDisk gets a list of pods that have data directories.
+func (m *MyKubelet) listPodsFromDisk() ([]types.UID, error) {
+	podInfos, err := os.ReadDir(m.getPodsDir())
+	if err != nil {
+		return nil, err
+	}
+	pods := []types.UID{}
+	for i := range podInfos {
+		if podInfos[i].IsDir() {
+			pods = append(pods, types.UID(podInfos[i].Name()))
+		}
+	}
+	return pods, nil
+}
+
+// cleanupOrphanedPodDirs removes the volumes of pods that should not be
+// running and that have no containers running.  Note that we roll up logs here since it runs in the main loop.
+func (m *MyKubelet) cleanupOrphanedPodDirs(pods []*v1.Pod, runningPods []*kubecontainer.Pod) error {
+	allPods := make(map[types.UID]struct{})
+	for _, pod := range pods {
+		allPods[pod.UID] = struct{}{}
+	}
+	for _, pod := range runningPods {
+		allPods[pod.ID] = struct{}{}
+	}
+
+	found, err := m.listPodsFromDisk()
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+
+	orphanRemovalErrors := []error{}
+	for _, uid := range found {
+		if _, ok := allPods[uid]; ok {
+			continue
+		}
+		// If volumes have not been unmounted/detached, do not delete directory.
+		// Doing so may result in corruption of data.
+		if err := m.volumeManager.UnmountVolumes(uid); err != nil {
+			orphanRemovalErrors = append(orphanRemovalErrors, fmt.Errorf("orphaned pod %q found, but error occurred when unmounting volumes: %v", uid, err))
+			continue
+		}
+
+		klog.V(3).InfoS("Orphaned pod found, removing", "podUID", uid)
+		if err := os.RemoveAll(m.GetPodDir(uid)); err != nil {
+			orphanRemovalErrors = append(orphanRemovalErrors, fmt.Errorf("orphaned pod %q found, but failed to remove pod dir %q: %v", uid, filepath.Base(m.GetPodDir(uid)), err))
+		}
+	}
+
+	logSpew := func(errs []error) {
+		if len(errs) > 0 {
+			klog.ErrorS(errs[0], "There were many similar errors. Turn up verbosity to see them.", "numErrs", len(errs))
+			for _, err := range errs {
+				klog.V(5).InfoS("Orphan pod", "err", err)
+			}
+		}
+	}
+	logSpew(orphanRemovalErrors)
+	return utilerrors.NewAggregate(orphanRemovalErrors)
+}
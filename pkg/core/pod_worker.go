@@ -2,7 +2,6 @@ package core
 
 import (
 	"context"
-	"fmt"
 	"github.com/xuliangTang/mykubelet/pkg/kubelet/pod"
 	"strings"
 	"sync"
@@ -862,38 +861,20 @@ func (p *podWorkers) allowStaticPodStart(fullname string, uid types.UID) bool {
 	return true
 }
 
-// 插入pod状态到podCache中，触发syncPodFn
-func insertPodCache(podId types.UID, podManager pod.Manager, podCache kubecontainer.Cache) error {
-	getPod, exist := podManager.GetPodByUID(podId)
-	if !exist {
-		return fmt.Errorf("pod not found")
-	}
-	podStatus := SetPodReady(getPod)
-	podCache.Set(podId, podStatus, nil, time.Now())
-	return nil
-}
-
 func (p *podWorkers) managePodLoop(podUpdates <-chan podWork) {
 	var lastSyncTime time.Time
 	var podStarted bool
 	for update := range podUpdates {
 		pod := update.Options.Pod
 
-		if !podStarted {
-			// fmt.Println("有pod进来了, name=", pod.Name, "uid=", pod.UID)
-			if insertErr := insertPodCache(pod.UID, p.podManager, p.podCache); insertErr != nil {
-				klog.Errorln("插入缓存失败:", insertErr)
-			} else {
-				if p.OnPreAdd != nil {
-					opts := &CallBackOptions{
-						Pod:           pod,
-						eventRecorder: p.recorder,
-						podCache:      p.podCache,
-					}
-					if onPreAddErr := p.OnPreAdd(opts); onPreAddErr != nil {
-						klog.Errorln("执行onAdd()回调出错:", onPreAddErr)
-					}
-				}
+		// 首次处理该pod时执行回调
+		if !podStarted && p.OnPreAdd != nil {
+			opts := &CallBackOptions{
+				Pod:           pod,
+				eventRecorder: p.recorder,
+			}
+			if onPreAddErr := p.OnPreAdd(opts); onPreAddErr != nil {
+				klog.Errorln("执行onPreAdd()回调出错:", onPreAddErr)
 			}
 		}
 
@@ -0,0 +1,53 @@
+package core
+
+import (
+	"context"
+
+	"github.com/xuliangTang/mykubelet/pkg/kubelet/volumemanager"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// kubeletVolumeHost is the kubelet's implementation of volumemanager.VolumeHost
+type kubeletVolumeHost struct {
+	kubelet *MyKubelet
+}
+
+var _ volumemanager.VolumeHost = &kubeletVolumeHost{}
+
+func (kvh *kubeletVolumeHost) GetPodVolumesDir(podUID types.UID) string {
+	return kvh.kubelet.getPodVolumesDir(podUID)
+}
+
+func (kvh *kubeletVolumeHost) GetPodVolumeDir(podUID types.UID, pluginName string, volumeName string) string {
+	return kvh.kubelet.getPodVolumeDir(podUID, pluginName, volumeName)
+}
+
+func (kvh *kubeletVolumeHost) GetNodeAllocatable() (v1.ResourceList, error) {
+	node, err := kvh.kubelet.getNodeAnyWay()
+	if err != nil {
+		return nil, err
+	}
+	allocatable := node.Status.Allocatable
+	// 节点未上报allocatable时，以capacity代替
+	if len(allocatable) == 0 {
+		allocatable = node.Status.Capacity
+	}
+	return allocatable, nil
+}
+
+func (kvh *kubeletVolumeHost) GetSecretFunc() func(namespace, name string) (*v1.Secret, error) {
+	return kvh.kubelet.secretManager.GetSecret
+}
+
+func (kvh *kubeletVolumeHost) GetConfigMapFunc() func(namespace, name string) (*v1.ConfigMap, error) {
+	return kvh.kubelet.configMapManager.GetConfigMap
+}
+
+func (kvh *kubeletVolumeHost) GetServiceAccountTokenFunc() func(namespace, name string, tr *authenticationv1.TokenRequest) (*authenticationv1.TokenRequest, error) {
+	return func(namespace, name string, tr *authenticationv1.TokenRequest) (*authenticationv1.TokenRequest, error) {
+		return kvh.kubelet.KubeClient.CoreV1().ServiceAccounts(namespace).CreateToken(context.TODO(), name, tr, metav1.CreateOptions{})
+	}
+}
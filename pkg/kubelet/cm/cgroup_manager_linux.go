@@ -0,0 +1,277 @@
+//go:build linux
+// +build linux
+
+package cm
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/klog/v2"
+)
+
+const (
+	// CgroupMountPoint is where the cgroup v2 unified hierarchy is mounted.
+	CgroupMountPoint = "/sys/fs/cgroup"
+
+	// destroyRetries and destroyRetryPeriod bound how long Destroy waits for
+	// the kernel to release a cgroup whose processes were just killed.
+	destroyRetries     = 10
+	destroyRetryPeriod = 100 * time.Millisecond
+)
+
+// requiredControllers are the cgroup v2 controllers container resources are enforced with.
+var requiredControllers = []string{"cpu", "memory", "pids"}
+
+// cgroupManagerImpl implements the CgroupManager interface on top of the
+// cgroup v2 unified hierarchy, where a cgroup is a directory below mountPoint.
+type cgroupManagerImpl struct {
+	mountPoint string
+}
+
+// Make sure that cgroupManagerImpl implements the CgroupManager interface
+var _ CgroupManager = &cgroupManagerImpl{}
+
+// NewCgroupManager is a factory method that returns a CgroupManager
+// for the unified hierarchy mounted at mountPoint.
+func NewCgroupManager(mountPoint string) CgroupManager {
+	return &cgroupManagerImpl{mountPoint: mountPoint}
+}
+
+// Name converts the cgroup to the driver specific value in cgroupfs form.
+func (m *cgroupManagerImpl) Name(name CgroupName) string {
+	return name.ToCgroupfs()
+}
+
+// CgroupName converts the literal cgroupfs name on the host to an internal identifier.
+func (m *cgroupManagerImpl) CgroupName(name string) CgroupName {
+	return ParseCgroupfsToCgroupName(name)
+}
+
+// buildCgroupPath returns the directory of the cgroup on the host.
+func (m *cgroupManagerImpl) buildCgroupPath(name CgroupName) string {
+	return filepath.Join(m.mountPoint, name.ToCgroupfs())
+}
+
+// Exists checks if the cgroup already exists
+func (m *cgroupManagerImpl) Exists(name CgroupName) bool {
+	info, err := os.Stat(m.buildCgroupPath(name))
+	return err == nil && info.IsDir()
+}
+
+// Create creates the specified cgroup, and the ancestors it is missing. The
+// required controllers are delegated to every level on the way down.
+func (m *cgroupManagerImpl) Create(cgroupConfig *CgroupConfig) error {
+	dir := m.mountPoint
+	for _, component := range cgroupConfig.Name {
+		if err := enableControllers(dir); err != nil {
+			return err
+		}
+		dir = filepath.Join(dir, component)
+		if err := os.Mkdir(dir, 0755); err != nil && !os.IsExist(err) {
+			return fmt.Errorf("failed to create cgroup %v: %v", cgroupConfig.Name, err)
+		}
+	}
+	return m.Update(cgroupConfig)
+}
+
+// enableControllers enables the required controllers for the children of the cgroup at dir.
+func enableControllers(dir string) error {
+	data, err := os.ReadFile(filepath.Join(dir, "cgroup.subtree_control"))
+	if err != nil {
+		return fmt.Errorf("failed to read controllers of cgroup %s: %v", dir, err)
+	}
+	enabled := sets.NewString(strings.Fields(string(data))...)
+	var missing []string
+	for _, controller := range requiredControllers {
+		if !enabled.Has(controller) {
+			missing = append(missing, "+"+controller)
+		}
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+	return writeFile(dir, "cgroup.subtree_control", strings.Join(missing, " "))
+}
+
+// Update cgroup configuration.
+func (m *cgroupManagerImpl) Update(cgroupConfig *CgroupConfig) error {
+	resources := cgroupConfig.ResourceParameters
+	if resources == nil {
+		return nil
+	}
+	dir := m.buildCgroupPath(cgroupConfig.Name)
+
+	if resources.CPUShares != nil {
+		if err := writeFile(dir, "cpu.weight", strconv.FormatUint(CPUSharesToCPUWeight(*resources.CPUShares), 10)); err != nil {
+			return err
+		}
+	}
+	if resources.CPUQuota != nil {
+		period := uint64(QuotaPeriod)
+		if resources.CPUPeriod != nil {
+			period = *resources.CPUPeriod
+		}
+		quota := "max"
+		if *resources.CPUQuota > 0 {
+			quota = strconv.FormatInt(*resources.CPUQuota, 10)
+		}
+		if err := writeFile(dir, "cpu.max", fmt.Sprintf("%s %d", quota, period)); err != nil {
+			return err
+		}
+	}
+	if resources.Memory != nil {
+		if err := writeFile(dir, "memory.max", formatLimit(*resources.Memory)); err != nil {
+			return err
+		}
+	}
+	if resources.MemoryMin != nil {
+		if err := writeFile(dir, "memory.min", strconv.FormatInt(*resources.MemoryMin, 10)); err != nil {
+			return err
+		}
+	}
+	if resources.PidsLimit != nil {
+		if err := writeFile(dir, "pids.max", formatLimit(*resources.PidsLimit)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// formatLimit formats a limit of the unified hierarchy, where "max" means unlimited.
+func formatLimit(limit int64) string {
+	if limit <= 0 {
+		return "max"
+	}
+	return strconv.FormatInt(limit, 10)
+}
+
+// Destroy removes the cgroup and its descendants. The cgroups must not have
+// processes left, the kernel may take a moment to release the ones of
+// processes that were just killed.
+func (m *cgroupManagerImpl) Destroy(cgroupConfig *CgroupConfig) error {
+	if err := removeCgroup(m.buildCgroupPath(cgroupConfig.Name)); err != nil {
+		return fmt.Errorf("failed to destroy cgroup %v: %v", cgroupConfig.Name, err)
+	}
+	return nil
+}
+
+func removeCgroup(dir string) error {
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if entry.IsDir() {
+			if err := removeCgroup(filepath.Join(dir, entry.Name())); err != nil {
+				return err
+			}
+		}
+	}
+
+	for i := 0; ; i++ {
+		err = os.Remove(dir)
+		if err == nil || os.IsNotExist(err) {
+			return nil
+		}
+		if i == destroyRetries {
+			return err
+		}
+		time.Sleep(destroyRetryPeriod)
+	}
+}
+
+// Pids returns the pids of the processes in the cgroup and its descendants.
+func (m *cgroupManagerImpl) Pids(name CgroupName) []int {
+	var pids []int
+	dir := m.buildCgroupPath(name)
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			// processes may go away, and their cgroups with them.
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if !info.IsDir() {
+			return nil
+		}
+		procs, err := readProcs(path)
+		if err != nil {
+			klog.V(4).InfoS("Failed to read the processes of cgroup", "path", path, "err", err)
+			return nil
+		}
+		pids = append(pids, procs...)
+		return nil
+	})
+	if err != nil {
+		klog.V(4).InfoS("Failed to walk cgroup", "cgroupName", name, "err", err)
+	}
+	return pids
+}
+
+// readProcs reads the pids in the cgroup.procs file of the cgroup at dir.
+func readProcs(dir string) ([]int, error) {
+	data, err := os.ReadFile(filepath.Join(dir, "cgroup.procs"))
+	if err != nil {
+		return nil, err
+	}
+	var pids []int
+	for _, field := range strings.Fields(string(data)) {
+		pid, err := strconv.Atoi(field)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pid %q: %v", field, err)
+		}
+		pids = append(pids, pid)
+	}
+	return pids, nil
+}
+
+// AddProcess moves the process into the specified cgroup.
+func (m *cgroupManagerImpl) AddProcess(name CgroupName, pid int) error {
+	return writeFile(m.buildCgroupPath(name), "cgroup.procs", strconv.Itoa(pid))
+}
+
+// Open opens the directory of the specified cgroup.
+func (m *cgroupManagerImpl) Open(name CgroupName) (*os.File, error) {
+	f, err := os.OpenFile(m.buildCgroupPath(name), os.O_RDONLY|syscall.O_DIRECTORY|syscall.O_CLOEXEC, 0)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open cgroup %v: %v", name, err)
+	}
+	return f, nil
+}
+
+// OOMKills returns the oom_kill counter of the memory.events file of the cgroup.
+func (m *cgroupManagerImpl) OOMKills(name CgroupName) (int64, error) {
+	data, err := os.ReadFile(filepath.Join(m.buildCgroupPath(name), "memory.events"))
+	if err != nil {
+		return 0, err
+	}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 2 && fields[0] == "oom_kill" {
+			return strconv.ParseInt(fields[1], 10, 64)
+		}
+	}
+	return 0, scanner.Err()
+}
+
+// writeFile writes value to the interface file of the cgroup at dir.
+func writeFile(dir, file, value string) error {
+	if err := os.WriteFile(filepath.Join(dir, file), []byte(value), 0); err != nil {
+		return fmt.Errorf("failed to write %q to %s: %v", value, filepath.Join(dir, file), err)
+	}
+	return nil
+}
@@ -0,0 +1,62 @@
+//go:build !linux
+// +build !linux
+
+package cm
+
+import (
+	"fmt"
+	"os"
+)
+
+// CgroupMountPoint is where the cgroup v2 unified hierarchy is mounted.
+const CgroupMountPoint = ""
+
+type unsupportedCgroupManager struct{}
+
+// Make sure that unsupportedCgroupManager implements the CgroupManager interface
+var _ CgroupManager = &unsupportedCgroupManager{}
+
+// NewCgroupManager returns a CgroupManager that fails every operation.
+func NewCgroupManager(mountPoint string) CgroupManager {
+	return &unsupportedCgroupManager{}
+}
+
+func (m *unsupportedCgroupManager) Name(name CgroupName) string {
+	return name.ToCgroupfs()
+}
+
+func (m *unsupportedCgroupManager) CgroupName(name string) CgroupName {
+	return ParseCgroupfsToCgroupName(name)
+}
+
+func (m *unsupportedCgroupManager) Exists(_ CgroupName) bool {
+	return false
+}
+
+func (m *unsupportedCgroupManager) Create(_ *CgroupConfig) error {
+	return fmt.Errorf("cgroup manager is not supported in this build")
+}
+
+func (m *unsupportedCgroupManager) Destroy(_ *CgroupConfig) error {
+	return nil
+}
+
+func (m *unsupportedCgroupManager) Update(_ *CgroupConfig) error {
+	return nil
+}
+
+func (m *unsupportedCgroupManager) Pids(_ CgroupName) []int {
+	return nil
+}
+
+func (m *unsupportedCgroupManager) AddProcess(_ CgroupName, _ int) error {
+	return fmt.Errorf("cgroup manager is not supported in this build")
+}
+
+func (m *unsupportedCgroupManager) Open(_ CgroupName) (*os.File, error) {
+	return nil, fmt.Errorf("cgroup manager is not supported in this build")
+}
+
+func (m *unsupportedCgroupManager) OOMKills(_ CgroupName) (int64, error) {
+	return 0, nil
+}
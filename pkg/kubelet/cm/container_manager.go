@@ -0,0 +1,44 @@
+package cm
+
+import (
+	v1 "k8s.io/api/core/v1"
+)
+
+// ActivePodsFunc is a function that returns a list of pods to reconcile.
+type ActivePodsFunc func() []*v1.Pod
+
+// ContainerManager manages the cgroups the containers of the node run in.
+type ContainerManager interface {
+	// Start runs the container manager's housekeeping.
+	// - Ensures that the top level QoS cgroups exist.
+	// - Keeps the resources of the QoS cgroups in sync with the active pods.
+	Start(activePods ActivePodsFunc) error
+
+	// NewPodContainerManager is a factory method which returns a podContainerManager object
+	// Returns a noop implementation if the cgroups of the node can not be used
+	NewPodContainerManager() PodContainerManager
+
+	// GetQOSContainersInfo returns the names of top level QoS containers
+	GetQOSContainersInfo() QOSContainersInfo
+
+	// UpdateQOSCgroups performs housekeeping updates to ensure that the top
+	// level QoS containers have their desired state in a thread-safe way
+	UpdateQOSCgroups() error
+
+	// Status returns internal Status.
+	Status() Status
+}
+
+// NodeConfig holds the settings of the container manager.
+type NodeConfig struct {
+	// CgroupRoot is the cgroup below which the pod cgroups are created.
+	CgroupRoot string
+	// PodPidsLimit is the maximum number of pids of a pod, -1 for unlimited.
+	PodPidsLimit int64
+}
+
+// Status holds the state of the container manager.
+type Status struct {
+	// Any soft requirements that were unsatisfied.
+	SoftRequirements error
+}
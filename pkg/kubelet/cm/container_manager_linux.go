@@ -0,0 +1,133 @@
+//go:build linux
+// +build linux
+
+package cm
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"golang.org/x/sys/unix"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/klog/v2"
+)
+
+type containerManagerImpl struct {
+	sync.RWMutex
+	NodeConfig
+	// The cgroup all pods run below
+	cgroupRoot CgroupName
+	// Interface for cgroup management
+	cgroupManager CgroupManager
+	// Interface for QoS cgroup management
+	qosContainerManager QOSContainerManager
+	// status holds the unsatisfied soft requirements, pods run without
+	// cgroups once it is set.
+	status Status
+}
+
+// NewContainerManager creates the container manager of the node. A node
+// without a usable cgroup v2 hierarchy gets a container manager that
+// enforces nothing and reports why.
+func NewContainerManager(nodeConfig NodeConfig) ContainerManager {
+	if err := validateSystemRequirements(CgroupMountPoint); err != nil {
+		klog.InfoS("Cgroups are unavailable, container resources will not be enforced", "err", err)
+		return NewStubContainerManager(err)
+	}
+
+	cgroupManager := NewCgroupManager(CgroupMountPoint)
+	cgroupRoot := NewCgroupName(ParseCgroupfsToCgroupName(nodeConfig.CgroupRoot), defaultNodeAllocatableCgroupName)
+	return &containerManagerImpl{
+		NodeConfig:          nodeConfig,
+		cgroupRoot:          cgroupRoot,
+		cgroupManager:       cgroupManager,
+		qosContainerManager: NewQOSContainerManager(cgroupManager, cgroupRoot),
+	}
+}
+
+// validateSystemRequirements checks that the cgroup v2 unified hierarchy is
+// mounted at mountPoint and offers the controllers container resources are
+// enforced with.
+func validateSystemRequirements(mountPoint string) error {
+	var st unix.Statfs_t
+	if err := unix.Statfs(mountPoint, &st); err != nil {
+		return fmt.Errorf("failed to stat %s: %v", mountPoint, err)
+	}
+	if st.Type != unix.CGROUP2_SUPER_MAGIC {
+		return fmt.Errorf("the cgroup v2 unified hierarchy is not mounted at %s", mountPoint)
+	}
+
+	data, err := os.ReadFile(filepath.Join(mountPoint, "cgroup.controllers"))
+	if err != nil {
+		return fmt.Errorf("failed to read the available cgroup controllers: %v", err)
+	}
+	available := sets.NewString(strings.Fields(string(data))...)
+	var missing []string
+	for _, controller := range requiredControllers {
+		if !available.Has(controller) {
+			missing = append(missing, controller)
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("cgroup controllers %v are not available", missing)
+	}
+	return nil
+}
+
+// Start creates the cgroup all pods run below, and the QoS cgroups in it.
+// The container manager falls back to not enforcing anything on failure.
+func (cm *containerManagerImpl) Start(activePods ActivePodsFunc) error {
+	rootContainer := &CgroupConfig{
+		Name:               cm.cgroupRoot,
+		ResourceParameters: &ResourceConfig{},
+	}
+	if err := cm.cgroupManager.Create(rootContainer); err != nil {
+		err = fmt.Errorf("failed to create the cgroup %v of the pods: %v", rootContainer.Name, err)
+		cm.setSoftRequirements(err)
+		return err
+	}
+	if err := cm.qosContainerManager.Start(activePods); err != nil {
+		err = fmt.Errorf("failed to initialize top level QOS containers: %v", err)
+		cm.setSoftRequirements(err)
+		return err
+	}
+	return nil
+}
+
+func (cm *containerManagerImpl) setSoftRequirements(err error) {
+	cm.Lock()
+	defer cm.Unlock()
+	cm.status.SoftRequirements = err
+}
+
+func (cm *containerManagerImpl) NewPodContainerManager() PodContainerManager {
+	if cm.Status().SoftRequirements != nil {
+		return &podContainerManagerStub{}
+	}
+	return &podContainerManagerImpl{
+		qosContainersInfo: cm.GetQOSContainersInfo(),
+		cgroupManager:     cm.cgroupManager,
+		mountPoint:        CgroupMountPoint,
+		podPidsLimit:      cm.PodPidsLimit,
+	}
+}
+
+func (cm *containerManagerImpl) GetQOSContainersInfo() QOSContainersInfo {
+	return cm.qosContainerManager.GetQOSContainersInfo()
+}
+
+func (cm *containerManagerImpl) UpdateQOSCgroups() error {
+	if cm.Status().SoftRequirements != nil {
+		return nil
+	}
+	return cm.qosContainerManager.UpdateCgroups()
+}
+
+func (cm *containerManagerImpl) Status() Status {
+	cm.RLock()
+	defer cm.RUnlock()
+	return cm.status
+}
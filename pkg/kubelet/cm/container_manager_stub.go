@@ -0,0 +1,40 @@
+package cm
+
+import (
+	"k8s.io/klog/v2"
+)
+
+// containerManagerStub is used on nodes whose cgroups can not be used:
+// containers run without resource enforcement.
+type containerManagerStub struct {
+	status Status
+}
+
+var _ ContainerManager = &containerManagerStub{}
+
+func (cm *containerManagerStub) Start(activePods ActivePodsFunc) error {
+	klog.V(2).InfoS("Starting stub container manager")
+	return nil
+}
+
+func (cm *containerManagerStub) NewPodContainerManager() PodContainerManager {
+	return &podContainerManagerStub{}
+}
+
+func (cm *containerManagerStub) GetQOSContainersInfo() QOSContainersInfo {
+	return QOSContainersInfo{}
+}
+
+func (cm *containerManagerStub) UpdateQOSCgroups() error {
+	return nil
+}
+
+func (cm *containerManagerStub) Status() Status {
+	return cm.status
+}
+
+// NewStubContainerManager creates a container manager that enforces nothing,
+// reporting err as its unsatisfied soft requirement.
+func NewStubContainerManager(err error) ContainerManager {
+	return &containerManagerStub{status: Status{SoftRequirements: err}}
+}
@@ -0,0 +1,14 @@
+//go:build !linux
+// +build !linux
+
+package cm
+
+import (
+	"fmt"
+)
+
+// NewContainerManager creates a container manager that enforces nothing,
+// cgroups are only supported on linux.
+func NewContainerManager(nodeConfig NodeConfig) ContainerManager {
+	return NewStubContainerManager(fmt.Errorf("cgroups are not supported on this platform"))
+}
@@ -0,0 +1,228 @@
+package cm
+
+import (
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/xuliangTang/mykubelet/pkg/api/v1/resource"
+	v1qos "github.com/xuliangTang/mykubelet/pkg/apis/core/v1/helper/qos"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+const (
+	// These limits are defined in the kernel:
+	// https://github.com/torvalds/linux/blob/0bddd227f3dc55975e2b8dfa7fc6f959b062a2c7/kernel/sched/sched.h#L427-L428
+	MinShares = 2
+	MaxShares = 262144
+
+	SharesPerCPU  = 1024
+	MilliCPUToCPU = 1000
+
+	// QuotaPeriod is 100000 microseconds, or 100ms
+	QuotaPeriod = 100000
+	// MinQuotaPeriod is 1000 microseconds, or 1ms
+	MinQuotaPeriod = 1000
+
+	// podCgroupNamePrefix is the prefix of the cgroup name of a pod
+	podCgroupNamePrefix = "pod"
+	// defaultNodeAllocatableCgroupName is the name of the cgroup all pods run below
+	defaultNodeAllocatableCgroupName = "kubepods"
+)
+
+// RootCgroupName is the CgroupName of the root of the hierarchy.
+var RootCgroupName = CgroupName([]string{})
+
+// NewCgroupName composes a new cgroup name.
+// Use RootCgroupName as base to start at the root.
+// This function does some basic check for invalid characters at the name.
+func NewCgroupName(base CgroupName, components ...string) CgroupName {
+	for _, component := range components {
+		// Forbit using "_" in internal names. When remapping internal
+		// names to systemd cgroup driver, we want to remap "-" => "_",
+		// so we forbid "_" so that we can always reverse the mapping.
+		if strings.Contains(component, "/") || strings.Contains(component, "_") {
+			panic(fmt.Errorf("invalid character in component [%q] of CgroupName", component))
+		}
+	}
+	return CgroupName(append(append([]string{}, base...), components...))
+}
+
+// ToCgroupfs converts the internal cgroup name to its cgroupfs form.
+func (cgroupName CgroupName) ToCgroupfs() string {
+	return "/" + path.Join(cgroupName...)
+}
+
+// ParseCgroupfsToCgroupName converts the literal cgroupfs name on the host to an internal identifier.
+func ParseCgroupfsToCgroupName(name string) CgroupName {
+	components := strings.Split(strings.TrimPrefix(name, "/"), "/")
+	if len(components) == 1 && components[0] == "" {
+		components = []string{}
+	}
+	return CgroupName(components)
+}
+
+// MilliCPUToQuota converts milliCPU to CFS quota and period values.
+// Input parameters and resulting value is number of microseconds.
+func MilliCPUToQuota(milliCPU int64, period int64) (quota int64) {
+	// CFS quota is measured in two values:
+	//  - cfs_period_us=100ms (the amount of time to measure usage across given by period)
+	//  - cfs_quota=20ms (the amount of cpu time allowed to be used across a period)
+	// so in the above example, you are limited to 20% of a single CPU
+	// for multi-cpu environments, you just scale equivalent amounts
+	// see https://www.kernel.org/doc/Documentation/scheduler/sched-bwc.txt for details
+
+	if milliCPU == 0 {
+		return
+	}
+
+	// we then convert your milliCPU to a value normalized over a period
+	quota = (milliCPU * period) / MilliCPUToCPU
+
+	// quota needs to be a minimum of 1ms.
+	if quota < MinQuotaPeriod {
+		quota = MinQuotaPeriod
+	}
+	return
+}
+
+// MilliCPUToShares converts the milliCPU to CFS shares.
+func MilliCPUToShares(milliCPU int64) uint64 {
+	if milliCPU == 0 {
+		// Docker converts zero milliCPU to unset, which maps to kernel default
+		// for unset: 1024. Return 2 here to really match kernel default for
+		// zero milliCPU.
+		return MinShares
+	}
+	// Conceptually (milliCPU / milliCPUToCPU) * sharesPerCPU, but factored to improve rounding.
+	shares := (milliCPU * SharesPerCPU) / MilliCPUToCPU
+	if shares < MinShares {
+		return MinShares
+	}
+	if shares > MaxShares {
+		return MaxShares
+	}
+	return uint64(shares)
+}
+
+// CPUSharesToCPUWeight converts CFS shares to the cpu.weight of cgroup v2,
+// the same way runc does: [2-262144] is mapped to [1-10000].
+func CPUSharesToCPUWeight(cpuShares uint64) uint64 {
+	if cpuShares == 0 {
+		return 0
+	}
+	return 1 + ((cpuShares-2)*9999)/262142
+}
+
+// ResourceConfigForPod takes the input pod and outputs the cgroup resource config.
+func ResourceConfigForPod(pod *v1.Pod, podPidsLimit int64) *ResourceConfig {
+	// sum requests and limits.
+	reqs, limits := resource.PodRequestsAndLimits(pod)
+
+	cpuRequests := int64(0)
+	cpuLimits := int64(0)
+	memoryLimits := int64(0)
+	memoryRequests := int64(0)
+	if request, found := reqs[v1.ResourceCPU]; found {
+		cpuRequests = request.MilliValue()
+	}
+	if limit, found := limits[v1.ResourceCPU]; found {
+		cpuLimits = limit.MilliValue()
+	}
+	if limit, found := limits[v1.ResourceMemory]; found {
+		memoryLimits = limit.Value()
+	}
+	if request, found := reqs[v1.ResourceMemory]; found {
+		memoryRequests = request.Value()
+	}
+
+	// convert to CFS values
+	cpuPeriod := uint64(QuotaPeriod)
+	cpuShares := MilliCPUToShares(cpuRequests)
+	cpuQuota := MilliCPUToQuota(cpuLimits, int64(cpuPeriod))
+
+	// track if limits were applied for each resource.
+	memoryLimitsDeclared := true
+	cpuLimitsDeclared := true
+	for _, container := range append(append([]v1.Container{}, pod.Spec.InitContainers...), pod.Spec.Containers...) {
+		if container.Resources.Limits.Cpu().IsZero() {
+			cpuLimitsDeclared = false
+		}
+		if container.Resources.Limits.Memory().IsZero() {
+			memoryLimitsDeclared = false
+		}
+	}
+
+	// determine the qos class
+	qosClass := v1qos.GetPodQOS(pod)
+
+	// build the result
+	result := &ResourceConfig{}
+	if qosClass == v1.PodQOSGuaranteed {
+		result.CPUShares = &cpuShares
+		result.CPUQuota = &cpuQuota
+		result.CPUPeriod = &cpuPeriod
+		result.Memory = &memoryLimits
+	} else if qosClass == v1.PodQOSBurstable {
+		result.CPUShares = &cpuShares
+		if cpuLimitsDeclared {
+			result.CPUQuota = &cpuQuota
+			result.CPUPeriod = &cpuPeriod
+		}
+		if memoryLimitsDeclared {
+			result.Memory = &memoryLimits
+		}
+	} else {
+		shares := uint64(MinShares)
+		result.CPUShares = &shares
+	}
+	if memoryRequests > 0 {
+		result.MemoryMin = &memoryRequests
+	}
+	if podPidsLimit > 0 {
+		result.PidsLimit = &podPidsLimit
+	}
+	return result
+}
+
+// ResourceConfigForContainer takes the input container and outputs the cgroup resource config.
+func ResourceConfigForContainer(container *v1.Container) *ResourceConfig {
+	cpuRequest := container.Resources.Requests.Cpu()
+	cpuLimit := container.Resources.Limits.Cpu()
+	memoryLimit := container.Resources.Limits.Memory().Value()
+	memoryRequest := container.Resources.Requests.Memory().Value()
+
+	result := &ResourceConfig{}
+	// If request is not specified, but limit is, we want request to default to limit.
+	// API server does this for new containers, but we repeat this logic in Kubelet
+	// for containers running on existing Kubernetes clusters.
+	var cpuShares uint64
+	if cpuRequest.IsZero() && !cpuLimit.IsZero() {
+		cpuShares = MilliCPUToShares(cpuLimit.MilliValue())
+	} else {
+		// if cpuRequest.Amount is nil, then MilliCPUToShares will return the minimal number
+		// of CPU shares.
+		cpuShares = MilliCPUToShares(cpuRequest.MilliValue())
+	}
+	result.CPUShares = &cpuShares
+
+	// if cpuLimit.Amount is nil, then the quota is 0 which allows full usage of cpu resource.
+	cpuPeriod := uint64(QuotaPeriod)
+	cpuQuota := MilliCPUToQuota(cpuLimit.MilliValue(), int64(cpuPeriod))
+	result.CPUQuota = &cpuQuota
+	result.CPUPeriod = &cpuPeriod
+
+	if memoryLimit != 0 {
+		result.Memory = &memoryLimit
+	}
+	if memoryRequest != 0 {
+		result.MemoryMin = &memoryRequest
+	}
+	return result
+}
+
+// GetPodCgroupNameSuffix returns the last element of the pod CgroupName identifier
+func GetPodCgroupNameSuffix(podUID types.UID) string {
+	return podCgroupNamePrefix + string(podUID)
+}
@@ -0,0 +1,222 @@
+//go:build linux
+// +build linux
+
+package cm
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"syscall"
+
+	v1qos "github.com/xuliangTang/mykubelet/pkg/apis/core/v1/helper/qos"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/klog/v2"
+)
+
+// podContainerManagerImpl implements podContainerManager interface.
+// It is the general implementation which allows pod level container
+// management if qos Cgroup is enabled.
+type podContainerManagerImpl struct {
+	// qosContainersInfo hold absolute paths of the top level qos containers
+	qosContainersInfo QOSContainersInfo
+	// cgroupManager is the cgroup Manager Object responsible for managing all
+	// pod cgroups.
+	cgroupManager CgroupManager
+	// mountPoint is where the unified hierarchy is mounted.
+	mountPoint string
+	// Maximum number of pids in a pod
+	podPidsLimit int64
+}
+
+// Make sure that podContainerManagerImpl implements the PodContainerManager interface
+var _ PodContainerManager = &podContainerManagerImpl{}
+
+// Exists checks if the pod's cgroup already exists
+func (m *podContainerManagerImpl) Exists(pod *v1.Pod) bool {
+	podContainerName, _ := m.GetPodContainerName(pod)
+	return m.cgroupManager.Exists(podContainerName)
+}
+
+// EnsureExists takes a pod as argument and makes sure that
+// pod cgroup exists if qos cgroup hierarchy flag is enabled.
+// If the pod level container doesn't already exist it is created.
+func (m *podContainerManagerImpl) EnsureExists(pod *v1.Pod) error {
+	podContainerName, _ := m.GetPodContainerName(pod)
+	// check if container already exist
+	alreadyExists := m.Exists(pod)
+	if !alreadyExists {
+		// Create the pod container
+		containerConfig := &CgroupConfig{
+			Name:               podContainerName,
+			ResourceParameters: ResourceConfigForPod(pod, m.podPidsLimit),
+		}
+		if err := m.cgroupManager.Create(containerConfig); err != nil {
+			return fmt.Errorf("failed to create container for %v : %v", podContainerName, err)
+		}
+	}
+	return nil
+}
+
+// GetPodContainerName returns the CgroupName identifier, and its literal cgroupfs form on the host.
+func (m *podContainerManagerImpl) GetPodContainerName(pod *v1.Pod) (CgroupName, string) {
+	podQOS := v1qos.GetPodQOS(pod)
+	// Get the parent QOS container name
+	var parentContainer CgroupName
+	switch podQOS {
+	case v1.PodQOSGuaranteed:
+		parentContainer = m.qosContainersInfo.Guaranteed
+	case v1.PodQOSBurstable:
+		parentContainer = m.qosContainersInfo.Burstable
+	case v1.PodQOSBestEffort:
+		parentContainer = m.qosContainersInfo.BestEffort
+	}
+	podContainer := GetPodCgroupNameSuffix(pod.UID)
+
+	// Get the absolute path of the cgroup
+	cgroupName := NewCgroupName(parentContainer, podContainer)
+	// Get the literal cgroupfs name
+	cgroupfsName := m.cgroupManager.Name(cgroupName)
+
+	return cgroupName, cgroupfsName
+}
+
+// Kill one process ID
+func (m *podContainerManagerImpl) killOnePid(pid int) error {
+	// os.FindProcess never returns an error on POSIX
+	// https://go-review.googlesource.com/c/go/+/19093
+	p, _ := os.FindProcess(pid)
+	if err := p.Kill(); err != nil {
+		// If the process already exited, that's fine.
+		if err == os.ErrProcessDone || err == syscall.ESRCH {
+			klog.V(3).InfoS("Process no longer exists", "pid", pid)
+			return nil
+		}
+		return err
+	}
+	return nil
+}
+
+// Scan through the whole cgroup directory and kill all processes either
+// attached to the pod cgroup or to a container cgroup under the pod cgroup
+func (m *podContainerManagerImpl) tryKillingCgroupProcesses(podCgroup CgroupName) error {
+	pidsToKill := m.cgroupManager.Pids(podCgroup)
+	// No pids charged to the terminated pod cgroup return
+	if len(pidsToKill) == 0 {
+		return nil
+	}
+
+	var errlist []error
+	// os.Kill often errors out,
+	// We try killing all the pids multiple times
+	removed := map[int]bool{}
+	for i := 0; i < 5; i++ {
+		if i != 0 {
+			klog.V(3).InfoS("Attempt failed to kill all unwanted process from cgroup, retrying", "attempt", i, "cgroupName", podCgroup)
+		}
+		errlist = []error{}
+		for _, pid := range pidsToKill {
+			if _, ok := removed[pid]; ok {
+				continue
+			}
+			klog.V(3).InfoS("Attempting to kill process from cgroup", "pid", pid, "cgroupName", podCgroup)
+			if err := m.killOnePid(pid); err != nil {
+				klog.V(3).InfoS("Failed to kill process from cgroup", "pid", pid, "cgroupName", podCgroup, "err", err)
+				errlist = append(errlist, err)
+			} else {
+				removed[pid] = true
+			}
+		}
+		if len(errlist) == 0 {
+			klog.V(3).InfoS("Successfully killed all unwanted processes from cgroup", "cgroupName", podCgroup)
+			return nil
+		}
+	}
+	return utilerrors.NewAggregate(errlist)
+}
+
+// Destroy destroys the pod container cgroup paths
+func (m *podContainerManagerImpl) Destroy(podCgroup CgroupName) error {
+	// Try killing all the processes attached to the pod cgroup
+	if err := m.tryKillingCgroupProcesses(podCgroup); err != nil {
+		klog.InfoS("Failed to kill all the processes attached to cgroup", "cgroupName", podCgroup, "err", err)
+		return fmt.Errorf("failed to kill all the processes attached to cgroup %v: %v", podCgroup, err)
+	}
+
+	// Now its safe to remove the pod's cgroup
+	containerConfig := &CgroupConfig{
+		Name:               podCgroup,
+		ResourceParameters: &ResourceConfig{},
+	}
+	if err := m.cgroupManager.Destroy(containerConfig); err != nil {
+		klog.InfoS("Failed to delete cgroup paths", "cgroupName", podCgroup, "err", err)
+		return fmt.Errorf("failed to delete cgroup paths for %v : %v", podCgroup, err)
+	}
+	return nil
+}
+
+// IsPodCgroup returns true if the literal cgroupfs name corresponds to a pod
+func (m *podContainerManagerImpl) IsPodCgroup(cgroupfs string) (bool, types.UID) {
+	// convert the literal cgroupfs form to the driver specific value
+	cgroupName := m.cgroupManager.CgroupName(cgroupfs)
+	if len(cgroupName) == 0 {
+		return false, types.UID("")
+	}
+	basePath := cgroupName[len(cgroupName)-1]
+	if !strings.HasPrefix(basePath, podCgroupNamePrefix) {
+		return false, types.UID("")
+	}
+	parts := strings.Split(basePath, podCgroupNamePrefix)
+	return true, types.UID(parts[1])
+}
+
+// GetAllPodsFromCgroups scans through all the QoS cgroups
+// Get list of pods whose cgroup still exist on the cgroup mounts
+func (m *podContainerManagerImpl) GetAllPodsFromCgroups() (map[types.UID]CgroupName, error) {
+	// Map for storing all the found pods on the disk
+	foundPods := make(map[types.UID]CgroupName)
+	qosContainersList := [3]CgroupName{m.qosContainersInfo.BestEffort, m.qosContainersInfo.Burstable, m.qosContainersInfo.Guaranteed}
+	// Scan through all the qos cgroups
+	for _, qosContainerName := range qosContainersList {
+		qcConversion := m.cgroupManager.Name(qosContainerName)
+		dirInfo, err := os.ReadDir(filepath.Join(m.mountPoint, qcConversion))
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return nil, fmt.Errorf("failed to read the cgroup directory %v : %v", qcConversion, err)
+		}
+		for i := range dirInfo {
+			// its not a directory, so continue on...
+			if !dirInfo[i].IsDir() {
+				continue
+			}
+			// convert the concrete cgroupfs name back to an internal identifier
+			// this is needed to handle path conversion for systemd environments.
+			// we pass the fully qualified path so decoding can work as expected
+			// since systemd encodes the path in each segment.
+			cgroupfsPath := path.Join(qcConversion, dirInfo[i].Name())
+			internalPath := m.cgroupManager.CgroupName(cgroupfsPath)
+			// we only care about base segment of the converted path since that
+			// is what we are reading currently to know if it is a pod or not.
+			basePath := internalPath[len(internalPath)-1]
+			if !strings.Contains(basePath, podCgroupNamePrefix) {
+				continue
+			}
+			// we then split the name on the pod prefix to determine the uid
+			parts := strings.Split(basePath, podCgroupNamePrefix)
+			// the uid is missing, so we log the unexpected cgroup not of form pod<uid>
+			if len(parts) != 2 {
+				klog.InfoS("Pod cgroup manager ignored unexpected cgroup because it is not a pod", "path", cgroupfsPath)
+				continue
+			}
+			podUID := parts[1]
+			foundPods[types.UID(podUID)] = internalPath
+		}
+	}
+	return foundPods, nil
+}
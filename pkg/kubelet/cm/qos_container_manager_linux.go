@@ -0,0 +1,169 @@
+//go:build linux
+// +build linux
+
+package cm
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/xuliangTang/mykubelet/pkg/api/v1/resource"
+	v1qos "github.com/xuliangTang/mykubelet/pkg/apis/core/v1/helper/qos"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/klog/v2"
+)
+
+const (
+	// how often the qos cgroup manager will perform periodic update
+	// of the qos level cgroup resource constraints
+	periodicQOSCgroupUpdateInterval = 1 * time.Minute
+)
+
+// QOSContainerManager manages the top level QoS cgroups.
+type QOSContainerManager interface {
+	Start(ActivePodsFunc) error
+	GetQOSContainersInfo() QOSContainersInfo
+	UpdateCgroups() error
+}
+
+type qosContainerManagerImpl struct {
+	sync.Mutex
+	qosContainersInfo QOSContainersInfo
+	cgroupManager     CgroupManager
+	activePods        ActivePodsFunc
+	cgroupRoot        CgroupName
+}
+
+// NewQOSContainerManager returns a QOSContainerManager creating the QoS cgroups below cgroupRoot.
+func NewQOSContainerManager(cgroupManager CgroupManager, cgroupRoot CgroupName) QOSContainerManager {
+	return &qosContainerManagerImpl{
+		cgroupManager: cgroupManager,
+		cgroupRoot:    cgroupRoot,
+	}
+}
+
+func (m *qosContainerManagerImpl) GetQOSContainersInfo() QOSContainersInfo {
+	return m.qosContainersInfo
+}
+
+func (m *qosContainerManagerImpl) Start(activePods ActivePodsFunc) error {
+	cm := m.cgroupManager
+	rootContainer := m.cgroupRoot
+	if !cm.Exists(rootContainer) {
+		return fmt.Errorf("root container %v doesn't exist", rootContainer)
+	}
+
+	// Top level for Qos containers are created only for Burstable
+	// and Best Effort classes
+	qosClasses := map[v1.PodQOSClass]CgroupName{
+		v1.PodQOSBurstable:  NewCgroupName(rootContainer, strings.ToLower(string(v1.PodQOSBurstable))),
+		v1.PodQOSBestEffort: NewCgroupName(rootContainer, strings.ToLower(string(v1.PodQOSBestEffort))),
+	}
+
+	// Create containers for both qos classes
+	for qosClass, containerName := range qosClasses {
+		resourceParameters := &ResourceConfig{}
+		// the BestEffort QoS class has a statically configured minShares value
+		if qosClass == v1.PodQOSBestEffort {
+			minShares := uint64(MinShares)
+			resourceParameters.CPUShares = &minShares
+		}
+
+		// containerConfig object stores the cgroup specifications
+		containerConfig := &CgroupConfig{
+			Name:               containerName,
+			ResourceParameters: resourceParameters,
+		}
+
+		// check if it exists
+		if !cm.Exists(containerName) {
+			if err := cm.Create(containerConfig); err != nil {
+				return fmt.Errorf("failed to create top level %v QOS cgroup : %v", qosClass, err)
+			}
+		} else {
+			// to ensure we actually have the right state, we update the config on startup
+			if err := cm.Update(containerConfig); err != nil {
+				return fmt.Errorf("failed to update top level %v QOS cgroup : %v", qosClass, err)
+			}
+		}
+	}
+	// Store the top level qos container names
+	m.qosContainersInfo = QOSContainersInfo{
+		Guaranteed: rootContainer,
+		Burstable:  qosClasses[v1.PodQOSBurstable],
+		BestEffort: qosClasses[v1.PodQOSBestEffort],
+	}
+	m.activePods = activePods
+
+	// update qos cgroup tiers on startup and in periodic intervals
+	// to ensure desired state is in sync with actual state.
+	go wait.Until(func() {
+		err := m.UpdateCgroups()
+		if err != nil {
+			klog.InfoS("Failed to reserve QoS requests", "err", err)
+		}
+	}, periodicQOSCgroupUpdateInterval, wait.NeverStop)
+
+	return nil
+}
+
+func (m *qosContainerManagerImpl) setCPUCgroupConfig(configs map[v1.PodQOSClass]*CgroupConfig) error {
+	pods := m.activePods()
+	burstablePodCPURequest := int64(0)
+	for i := range pods {
+		pod := pods[i]
+		qosClass := v1qos.GetPodQOS(pod)
+		if qosClass != v1.PodQOSBurstable {
+			// we only care about the burstable qos tier
+			continue
+		}
+		req, _ := resource.PodRequestsAndLimits(pod)
+		if request, found := req[v1.ResourceCPU]; found {
+			burstablePodCPURequest += request.MilliValue()
+		}
+	}
+
+	// make sure best effort is always 2 shares
+	bestEffortCPUShares := uint64(MinShares)
+	configs[v1.PodQOSBestEffort].ResourceParameters.CPUShares = &bestEffortCPUShares
+
+	// set burstable shares based on current observe state
+	burstableCPUShares := MilliCPUToShares(burstablePodCPURequest)
+	configs[v1.PodQOSBurstable].ResourceParameters.CPUShares = &burstableCPUShares
+	return nil
+}
+
+func (m *qosContainerManagerImpl) UpdateCgroups() error {
+	m.Lock()
+	defer m.Unlock()
+
+	qosConfigs := map[v1.PodQOSClass]*CgroupConfig{
+		v1.PodQOSBurstable: {
+			Name:               m.qosContainersInfo.Burstable,
+			ResourceParameters: &ResourceConfig{},
+		},
+		v1.PodQOSBestEffort: {
+			Name:               m.qosContainersInfo.BestEffort,
+			ResourceParameters: &ResourceConfig{},
+		},
+	}
+
+	// update the qos level cgroup settings for cpu shares
+	if err := m.setCPUCgroupConfig(qosConfigs); err != nil {
+		return err
+	}
+
+	for _, config := range qosConfigs {
+		err := m.cgroupManager.Update(config)
+		if err != nil {
+			klog.ErrorS(err, "Failed to update QoS cgroup configuration")
+			return err
+		}
+	}
+
+	klog.V(4).InfoS("Updated QoS cgroup configuration")
+	return nil
+}
@@ -436,8 +436,15 @@ type RunContainerOptions struct {
 }
 
 // VolumeInfo contains information about the volume.
+type VolumeInfo struct {
+	// Path of the materialized volume on the host.
+	HostPath string
+	// Whether the volume must be mounted read-only.
+	ReadOnly bool
+}
 
 // VolumeMap represents the map of volumes.
+type VolumeMap map[string]VolumeInfo
 
 // RuntimeConditionType is the types of required runtime conditions.
 type RuntimeConditionType string
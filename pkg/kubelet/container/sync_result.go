@@ -29,6 +29,10 @@ var (
 	ErrConfigPodSandbox = errors.New("ConfigPodSandboxError")
 	// ErrKillPodSandbox returned when runtime failed to stop pod's sandbox.
 	ErrKillPodSandbox = errors.New("KillPodSandboxError")
+	// ErrSetupNetwork returned when network setup failed.
+	ErrSetupNetwork = errors.New("SetupNetworkError")
+	// ErrTeardownNetwork returned when network tear down failed.
+	ErrTeardownNetwork = errors.New("TeardownNetworkError")
 )
 
 // SyncAction indicates different kind of actions in SyncPod() and KillPod(). Now there are only actions
@@ -0,0 +1,169 @@
+package fake
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"sync"
+	"time"
+
+	runtimeapi "k8s.io/cri-api/pkg/apis/runtime/v1alpha2"
+)
+
+// FakeImageSize is the size of every image of the fake image service.
+const FakeImageSize = 1024
+
+// FakeImageService is an in-memory implementation of the CRI image service.
+// Pulls succeed unless an error is injected.
+type FakeImageService struct {
+	runtimeapi.UnimplementedImageServiceServer
+
+	sync.Mutex
+	// images are keyed by the name they were pulled by.
+	images map[string]*runtimeapi.Image
+	// Auths are the credentials images were pulled with, keyed by image.
+	Auths map[string]*runtimeapi.AuthConfig
+	// errors are returned by the next calls of the methods they are keyed by.
+	errors map[string][]error
+}
+
+// NewFakeImageService creates a new FakeImageService.
+func NewFakeImageService() *FakeImageService {
+	return &FakeImageService{
+		images: make(map[string]*runtimeapi.Image),
+		Auths:  make(map[string]*runtimeapi.AuthConfig),
+		errors: make(map[string][]error),
+	}
+}
+
+// InjectError makes the next call of the method named f fail with err.
+func (r *FakeImageService) InjectError(f string, err error) {
+	r.Lock()
+	defer r.Unlock()
+
+	r.errors[f] = append(r.errors[f], err)
+}
+
+// popError returns the next error injected for the method named f. The
+// caller must hold the lock.
+func (r *FakeImageService) popError(f string) error {
+	errs := r.errors[f]
+	if len(errs) == 0 {
+		return nil
+	}
+	r.errors[f] = errs[1:]
+	return errs[0]
+}
+
+// findImage returns the image pulled by the name or having the ID. The caller must hold the lock.
+func (r *FakeImageService) findImage(image string) *runtimeapi.Image {
+	if img, ok := r.images[image]; ok {
+		return img
+	}
+	for _, img := range r.images {
+		if img.Id == image {
+			return img
+		}
+	}
+	return nil
+}
+
+// ListImages returns the pulled images matching the filter.
+func (r *FakeImageService) ListImages(ctx context.Context, req *runtimeapi.ListImagesRequest) (*runtimeapi.ListImagesResponse, error) {
+	r.Lock()
+	defer r.Unlock()
+	if err := r.popError("ListImages"); err != nil {
+		return nil, err
+	}
+
+	var images []*runtimeapi.Image
+	if filter := req.GetFilter().GetImage().GetImage(); filter != "" {
+		if img := r.findImage(filter); img != nil {
+			images = append(images, img)
+		}
+	} else {
+		for _, img := range r.images {
+			images = append(images, img)
+		}
+	}
+
+	return &runtimeapi.ListImagesResponse{Images: images}, nil
+}
+
+// ImageStatus returns the image, or no image if it has not been pulled.
+func (r *FakeImageService) ImageStatus(ctx context.Context, req *runtimeapi.ImageStatusRequest) (*runtimeapi.ImageStatusResponse, error) {
+	r.Lock()
+	defer r.Unlock()
+	if err := r.popError("ImageStatus"); err != nil {
+		return nil, err
+	}
+
+	return &runtimeapi.ImageStatusResponse{Image: r.findImage(req.GetImage().GetImage())}, nil
+}
+
+// PullImage records the image, its ID is the digest of its name.
+func (r *FakeImageService) PullImage(ctx context.Context, req *runtimeapi.PullImageRequest) (*runtimeapi.PullImageResponse, error) {
+	r.Lock()
+	defer r.Unlock()
+	if err := r.popError("PullImage"); err != nil {
+		return nil, err
+	}
+
+	image := req.GetImage().GetImage()
+	sum := sha256.Sum256([]byte(image))
+	id := "sha256:" + hex.EncodeToString(sum[:])
+	r.images[image] = &runtimeapi.Image{
+		Id:       id,
+		RepoTags: []string{image},
+		Size_:    FakeImageSize,
+	}
+	r.Auths[image] = req.Auth
+
+	return &runtimeapi.PullImageResponse{ImageRef: id}, nil
+}
+
+// RemoveImage removes the image.
+func (r *FakeImageService) RemoveImage(ctx context.Context, req *runtimeapi.RemoveImageRequest) (*runtimeapi.RemoveImageResponse, error) {
+	r.Lock()
+	defer r.Unlock()
+	if err := r.popError("RemoveImage"); err != nil {
+		return nil, err
+	}
+
+	if img := r.findImage(req.GetImage().GetImage()); img != nil {
+		for name, i := range r.images {
+			if i.Id == img.Id {
+				delete(r.images, name)
+			}
+		}
+	}
+
+	return &runtimeapi.RemoveImageResponse{}, nil
+}
+
+// ImageFsInfo returns the space used by the images. The images are reported
+// on the filesystem of the temporary directory, for its capacity to be read.
+func (r *FakeImageService) ImageFsInfo(ctx context.Context, req *runtimeapi.ImageFsInfoRequest) (*runtimeapi.ImageFsInfoResponse, error) {
+	r.Lock()
+	defer r.Unlock()
+	if err := r.popError("ImageFsInfo"); err != nil {
+		return nil, err
+	}
+
+	var used uint64
+	for _, img := range r.images {
+		used += img.Size_
+	}
+
+	return &runtimeapi.ImageFsInfoResponse{
+		ImageFilesystems: []*runtimeapi.FilesystemUsage{
+			{
+				Timestamp:  time.Now().UnixNano(),
+				FsId:       &runtimeapi.FilesystemIdentifier{Mountpoint: os.TempDir()},
+				UsedBytes:  &runtimeapi.UInt64Value{Value: used},
+				InodesUsed: &runtimeapi.UInt64Value{Value: uint64(len(r.images))},
+			},
+		},
+	}, nil
+}
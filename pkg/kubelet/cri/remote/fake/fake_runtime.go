@@ -0,0 +1,518 @@
+package fake
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"k8s.io/apimachinery/pkg/labels"
+	runtimeapi "k8s.io/cri-api/pkg/apis/runtime/v1alpha2"
+)
+
+const (
+	// FakeRuntimeName is the name of the fake runtime.
+	FakeRuntimeName = "fakeRuntime"
+	// FakeVersion is the version of the fake runtime and of its API.
+	FakeVersion = "0.1.0"
+	// FakePodSandboxIPPrefix is the prefix of the IPs given to pod sandboxes.
+	FakePodSandboxIPPrefix = "10.88.0."
+)
+
+// RemoteRuntime represents a fake remote container runtime. It serves the
+// CRI runtime and image services in-process, keeping sandboxes, containers
+// and images in memory.
+type RemoteRuntime struct {
+	server *grpc.Server
+	// Fake runtime service.
+	RuntimeService *FakeRuntimeService
+	// Fake image service.
+	ImageService *FakeImageService
+}
+
+// NewFakeRemoteRuntime creates a new RemoteRuntime.
+func NewFakeRemoteRuntime() *RemoteRuntime {
+	f := &RemoteRuntime{
+		server:         grpc.NewServer(),
+		RuntimeService: NewFakeRuntimeService(),
+		ImageService:   NewFakeImageService(),
+	}
+	runtimeapi.RegisterRuntimeServiceServer(f.server, f.RuntimeService)
+	runtimeapi.RegisterImageServiceServer(f.server, f.ImageService)
+
+	return f
+}
+
+// Start starts the fake remote runtime on the unix socket endpoint.
+func (f *RemoteRuntime) Start(endpoint string) error {
+	if err := os.Remove(endpoint); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to remove stale socket %q: %v", endpoint, err)
+	}
+	l, err := net.Listen("unix", endpoint)
+	if err != nil {
+		return fmt.Errorf("failed to listen on %q: %v", endpoint, err)
+	}
+
+	go f.server.Serve(l)
+
+	return nil
+}
+
+// Stop stops the fake remote runtime.
+func (f *RemoteRuntime) Stop() {
+	f.server.Stop()
+}
+
+// FakeRuntimeService is an in-memory implementation of the CRI runtime
+// service. Exec, attach and port-forward are not implemented.
+type FakeRuntimeService struct {
+	runtimeapi.UnimplementedRuntimeServiceServer
+
+	sync.Mutex
+	// nextIP is the last octet of the IP given to the next sandbox.
+	nextIP        int
+	sandboxes     map[string]*runtimeapi.PodSandboxStatus
+	containers    map[string]*fakeContainer
+	runtimeConfig *runtimeapi.RuntimeConfig
+	// errors are returned by the next calls of the methods they are keyed by.
+	errors map[string][]error
+}
+
+// fakeContainer is a container of the fake runtime.
+type fakeContainer struct {
+	status    *runtimeapi.ContainerStatus
+	sandboxID string
+}
+
+// NewFakeRuntimeService creates a new FakeRuntimeService.
+func NewFakeRuntimeService() *FakeRuntimeService {
+	return &FakeRuntimeService{
+		nextIP:     2,
+		sandboxes:  make(map[string]*runtimeapi.PodSandboxStatus),
+		containers: make(map[string]*fakeContainer),
+		errors:     make(map[string][]error),
+	}
+}
+
+// InjectError makes the next call of the method named f fail with err.
+func (r *FakeRuntimeService) InjectError(f string, err error) {
+	r.Lock()
+	defer r.Unlock()
+
+	r.errors[f] = append(r.errors[f], err)
+}
+
+// popError returns the next error injected for the method named f. The
+// caller must hold the lock.
+func (r *FakeRuntimeService) popError(f string) error {
+	errs := r.errors[f]
+	if len(errs) == 0 {
+		return nil
+	}
+	r.errors[f] = errs[1:]
+	return errs[0]
+}
+
+// SetContainerExited marks a running container as exited with the exit
+// code, as if its process had exited by itself.
+func (r *FakeRuntimeService) SetContainerExited(id string, exitCode int32) error {
+	r.Lock()
+	defer r.Unlock()
+
+	c, ok := r.containers[id]
+	if !ok {
+		return fmt.Errorf("container %q not found", id)
+	}
+	c.status.State = runtimeapi.ContainerState_CONTAINER_EXITED
+	c.status.FinishedAt = time.Now().UnixNano()
+	c.status.ExitCode = exitCode
+	return nil
+}
+
+// Version returns the runtime name, runtime version and runtime API version.
+func (r *FakeRuntimeService) Version(ctx context.Context, req *runtimeapi.VersionRequest) (*runtimeapi.VersionResponse, error) {
+	r.Lock()
+	defer r.Unlock()
+	if err := r.popError("Version"); err != nil {
+		return nil, err
+	}
+
+	return &runtimeapi.VersionResponse{
+		Version:           FakeVersion,
+		RuntimeName:       FakeRuntimeName,
+		RuntimeVersion:    FakeVersion,
+		RuntimeApiVersion: FakeVersion,
+	}, nil
+}
+
+// RunPodSandbox creates a ready pod sandbox with an IP of its own, or on the
+// host network if the config asks for it.
+func (r *FakeRuntimeService) RunPodSandbox(ctx context.Context, req *runtimeapi.RunPodSandboxRequest) (*runtimeapi.RunPodSandboxResponse, error) {
+	r.Lock()
+	defer r.Unlock()
+	if err := r.popError("RunPodSandbox"); err != nil {
+		return nil, err
+	}
+
+	config := req.GetConfig()
+	if config.GetMetadata() == nil {
+		return nil, status.Error(codes.InvalidArgument, "sandbox metadata is not set")
+	}
+	id := buildSandboxName(config.Metadata)
+	if _, ok := r.sandboxes[id]; ok {
+		return nil, status.Errorf(codes.AlreadyExists, "sandbox %q already exists", id)
+	}
+
+	namespaces := config.GetLinux().GetSecurityContext().GetNamespaceOptions()
+	network := &runtimeapi.PodSandboxNetworkStatus{}
+	if namespaces.GetNetwork() != runtimeapi.NamespaceMode_NODE {
+		network.Ip = fmt.Sprintf("%s%d", FakePodSandboxIPPrefix, r.nextIP)
+		r.nextIP++
+	}
+	r.sandboxes[id] = &runtimeapi.PodSandboxStatus{
+		Id:        id,
+		Metadata:  config.Metadata,
+		State:     runtimeapi.PodSandboxState_SANDBOX_READY,
+		CreatedAt: time.Now().UnixNano(),
+		Network:   network,
+		Linux: &runtimeapi.LinuxPodSandboxStatus{
+			Namespaces: &runtimeapi.Namespace{
+				Options: namespaces,
+			},
+		},
+		Labels:         config.Labels,
+		Annotations:    config.Annotations,
+		RuntimeHandler: req.RuntimeHandler,
+	}
+
+	return &runtimeapi.RunPodSandboxResponse{PodSandboxId: id}, nil
+}
+
+// StopPodSandbox marks the sandbox as not ready and exits its containers.
+func (r *FakeRuntimeService) StopPodSandbox(ctx context.Context, req *runtimeapi.StopPodSandboxRequest) (*runtimeapi.StopPodSandboxResponse, error) {
+	r.Lock()
+	defer r.Unlock()
+	if err := r.popError("StopPodSandbox"); err != nil {
+		return nil, err
+	}
+
+	s, ok := r.sandboxes[req.PodSandboxId]
+	if !ok {
+		return nil, status.Errorf(codes.NotFound, "sandbox %q not found", req.PodSandboxId)
+	}
+	s.State = runtimeapi.PodSandboxState_SANDBOX_NOTREADY
+	for _, c := range r.containers {
+		if c.sandboxID == s.Id {
+			stopContainer(c.status, 137)
+		}
+	}
+
+	return &runtimeapi.StopPodSandboxResponse{}, nil
+}
+
+// RemovePodSandbox removes the sandbox and its containers.
+func (r *FakeRuntimeService) RemovePodSandbox(ctx context.Context, req *runtimeapi.RemovePodSandboxRequest) (*runtimeapi.RemovePodSandboxResponse, error) {
+	r.Lock()
+	defer r.Unlock()
+	if err := r.popError("RemovePodSandbox"); err != nil {
+		return nil, err
+	}
+
+	delete(r.sandboxes, req.PodSandboxId)
+	for id, c := range r.containers {
+		if c.sandboxID == req.PodSandboxId {
+			delete(r.containers, id)
+		}
+	}
+
+	return &runtimeapi.RemovePodSandboxResponse{}, nil
+}
+
+// PodSandboxStatus returns the status of the sandbox.
+func (r *FakeRuntimeService) PodSandboxStatus(ctx context.Context, req *runtimeapi.PodSandboxStatusRequest) (*runtimeapi.PodSandboxStatusResponse, error) {
+	r.Lock()
+	defer r.Unlock()
+	if err := r.popError("PodSandboxStatus"); err != nil {
+		return nil, err
+	}
+
+	s, ok := r.sandboxes[req.PodSandboxId]
+	if !ok {
+		return nil, status.Errorf(codes.NotFound, "sandbox %q not found", req.PodSandboxId)
+	}
+
+	return &runtimeapi.PodSandboxStatusResponse{Status: s}, nil
+}
+
+// ListPodSandbox returns the sandboxes matching the filter.
+func (r *FakeRuntimeService) ListPodSandbox(ctx context.Context, req *runtimeapi.ListPodSandboxRequest) (*runtimeapi.ListPodSandboxResponse, error) {
+	r.Lock()
+	defer r.Unlock()
+	if err := r.popError("ListPodSandbox"); err != nil {
+		return nil, err
+	}
+
+	filter := req.GetFilter()
+	var items []*runtimeapi.PodSandbox
+	for id, s := range r.sandboxes {
+		if filter != nil {
+			if filter.Id != "" && filter.Id != id {
+				continue
+			}
+			if filter.State != nil && filter.GetState().State != s.State {
+				continue
+			}
+			if !matchLabels(filter.LabelSelector, s.Labels) {
+				continue
+			}
+		}
+		items = append(items, &runtimeapi.PodSandbox{
+			Id:             s.Id,
+			Metadata:       s.Metadata,
+			State:          s.State,
+			CreatedAt:      s.CreatedAt,
+			Labels:         s.Labels,
+			Annotations:    s.Annotations,
+			RuntimeHandler: s.RuntimeHandler,
+		})
+	}
+
+	return &runtimeapi.ListPodSandboxResponse{Items: items}, nil
+}
+
+// CreateContainer creates a container in a ready sandbox.
+func (r *FakeRuntimeService) CreateContainer(ctx context.Context, req *runtimeapi.CreateContainerRequest) (*runtimeapi.CreateContainerResponse, error) {
+	r.Lock()
+	defer r.Unlock()
+	if err := r.popError("CreateContainer"); err != nil {
+		return nil, err
+	}
+
+	s, ok := r.sandboxes[req.PodSandboxId]
+	if !ok {
+		return nil, status.Errorf(codes.NotFound, "sandbox %q not found", req.PodSandboxId)
+	}
+	if s.State != runtimeapi.PodSandboxState_SANDBOX_READY {
+		return nil, status.Errorf(codes.FailedPrecondition, "sandbox %q is not ready", req.PodSandboxId)
+	}
+	config := req.GetConfig()
+	if config.GetMetadata() == nil || config.GetImage() == nil {
+		return nil, status.Error(codes.InvalidArgument, "container metadata or image is not set")
+	}
+	id := buildContainerName(s.Metadata, config.Metadata)
+	if _, ok := r.containers[id]; ok {
+		return nil, status.Errorf(codes.AlreadyExists, "container %q already exists", id)
+	}
+
+	logPath := ""
+	if config.LogPath != "" {
+		logPath = req.GetSandboxConfig().GetLogDirectory() + "/" + config.LogPath
+	}
+	r.containers[id] = &fakeContainer{
+		sandboxID: req.PodSandboxId,
+		status: &runtimeapi.ContainerStatus{
+			Id:          id,
+			Metadata:    config.Metadata,
+			State:       runtimeapi.ContainerState_CONTAINER_CREATED,
+			CreatedAt:   time.Now().UnixNano(),
+			Image:       config.Image,
+			ImageRef:    config.Image.Image,
+			Labels:      config.Labels,
+			Annotations: config.Annotations,
+			Mounts:      config.Mounts,
+			LogPath:     logPath,
+		},
+	}
+
+	return &runtimeapi.CreateContainerResponse{ContainerId: id}, nil
+}
+
+// StartContainer starts a created container.
+func (r *FakeRuntimeService) StartContainer(ctx context.Context, req *runtimeapi.StartContainerRequest) (*runtimeapi.StartContainerResponse, error) {
+	r.Lock()
+	defer r.Unlock()
+	if err := r.popError("StartContainer"); err != nil {
+		return nil, err
+	}
+
+	c, ok := r.containers[req.ContainerId]
+	if !ok {
+		return nil, status.Errorf(codes.NotFound, "container %q not found", req.ContainerId)
+	}
+	if c.status.State != runtimeapi.ContainerState_CONTAINER_CREATED {
+		return nil, status.Errorf(codes.FailedPrecondition, "container %q is not in created state", req.ContainerId)
+	}
+	c.status.State = runtimeapi.ContainerState_CONTAINER_RUNNING
+	c.status.StartedAt = time.Now().UnixNano()
+
+	return &runtimeapi.StartContainerResponse{}, nil
+}
+
+// StopContainer stops a running container. It exits with the exit code of
+// a process killed by SIGKILL.
+func (r *FakeRuntimeService) StopContainer(ctx context.Context, req *runtimeapi.StopContainerRequest) (*runtimeapi.StopContainerResponse, error) {
+	r.Lock()
+	defer r.Unlock()
+	if err := r.popError("StopContainer"); err != nil {
+		return nil, err
+	}
+
+	c, ok := r.containers[req.ContainerId]
+	if !ok {
+		return nil, status.Errorf(codes.NotFound, "container %q not found", req.ContainerId)
+	}
+	stopContainer(c.status, 137)
+
+	return &runtimeapi.StopContainerResponse{}, nil
+}
+
+// RemoveContainer removes the container.
+func (r *FakeRuntimeService) RemoveContainer(ctx context.Context, req *runtimeapi.RemoveContainerRequest) (*runtimeapi.RemoveContainerResponse, error) {
+	r.Lock()
+	defer r.Unlock()
+	if err := r.popError("RemoveContainer"); err != nil {
+		return nil, err
+	}
+
+	delete(r.containers, req.ContainerId)
+
+	return &runtimeapi.RemoveContainerResponse{}, nil
+}
+
+// ListContainers returns the containers matching the filter.
+func (r *FakeRuntimeService) ListContainers(ctx context.Context, req *runtimeapi.ListContainersRequest) (*runtimeapi.ListContainersResponse, error) {
+	r.Lock()
+	defer r.Unlock()
+	if err := r.popError("ListContainers"); err != nil {
+		return nil, err
+	}
+
+	filter := req.GetFilter()
+	var containers []*runtimeapi.Container
+	for id, c := range r.containers {
+		if filter != nil {
+			if filter.Id != "" && filter.Id != id {
+				continue
+			}
+			if filter.PodSandboxId != "" && filter.PodSandboxId != c.sandboxID {
+				continue
+			}
+			if filter.State != nil && filter.GetState().State != c.status.State {
+				continue
+			}
+			if !matchLabels(filter.LabelSelector, c.status.Labels) {
+				continue
+			}
+		}
+		containers = append(containers, &runtimeapi.Container{
+			Id:           c.status.Id,
+			PodSandboxId: c.sandboxID,
+			Metadata:     c.status.Metadata,
+			Image:        c.status.Image,
+			ImageRef:     c.status.ImageRef,
+			State:        c.status.State,
+			CreatedAt:    c.status.CreatedAt,
+			Labels:       c.status.Labels,
+			Annotations:  c.status.Annotations,
+		})
+	}
+
+	return &runtimeapi.ListContainersResponse{Containers: containers}, nil
+}
+
+// ContainerStatus returns the status of the container.
+func (r *FakeRuntimeService) ContainerStatus(ctx context.Context, req *runtimeapi.ContainerStatusRequest) (*runtimeapi.ContainerStatusResponse, error) {
+	r.Lock()
+	defer r.Unlock()
+	if err := r.popError("ContainerStatus"); err != nil {
+		return nil, err
+	}
+
+	c, ok := r.containers[req.ContainerId]
+	if !ok {
+		return nil, status.Errorf(codes.NotFound, "container %q not found", req.ContainerId)
+	}
+
+	return &runtimeapi.ContainerStatusResponse{Status: c.status}, nil
+}
+
+// ExecSync runs nothing, commands succeed without output in running containers.
+func (r *FakeRuntimeService) ExecSync(ctx context.Context, req *runtimeapi.ExecSyncRequest) (*runtimeapi.ExecSyncResponse, error) {
+	r.Lock()
+	defer r.Unlock()
+	if err := r.popError("ExecSync"); err != nil {
+		return nil, err
+	}
+
+	c, ok := r.containers[req.ContainerId]
+	if !ok {
+		return nil, status.Errorf(codes.NotFound, "container %q not found", req.ContainerId)
+	}
+	if c.status.State != runtimeapi.ContainerState_CONTAINER_RUNNING {
+		return nil, status.Errorf(codes.FailedPrecondition, "container %q is not running", req.ContainerId)
+	}
+
+	return &runtimeapi.ExecSyncResponse{}, nil
+}
+
+// UpdateRuntimeConfig records the runtime config.
+func (r *FakeRuntimeService) UpdateRuntimeConfig(ctx context.Context, req *runtimeapi.UpdateRuntimeConfigRequest) (*runtimeapi.UpdateRuntimeConfigResponse, error) {
+	r.Lock()
+	defer r.Unlock()
+	if err := r.popError("UpdateRuntimeConfig"); err != nil {
+		return nil, err
+	}
+
+	r.runtimeConfig = req.RuntimeConfig
+
+	return &runtimeapi.UpdateRuntimeConfigResponse{}, nil
+}
+
+// Status reports the runtime and its network as ready.
+func (r *FakeRuntimeService) Status(ctx context.Context, req *runtimeapi.StatusRequest) (*runtimeapi.StatusResponse, error) {
+	r.Lock()
+	defer r.Unlock()
+	if err := r.popError("Status"); err != nil {
+		return nil, err
+	}
+
+	return &runtimeapi.StatusResponse{
+		Status: &runtimeapi.RuntimeStatus{
+			Conditions: []*runtimeapi.RuntimeCondition{
+				{Type: runtimeapi.RuntimeReady, Status: true},
+				{Type: runtimeapi.NetworkReady, Status: true},
+			},
+		},
+	}, nil
+}
+
+// stopContainer marks a container that is not exited yet as exited.
+func stopContainer(s *runtimeapi.ContainerStatus, exitCode int32) {
+	if s.State == runtimeapi.ContainerState_CONTAINER_EXITED {
+		return
+	}
+	s.State = runtimeapi.ContainerState_CONTAINER_EXITED
+	s.FinishedAt = time.Now().UnixNano()
+	s.ExitCode = exitCode
+}
+
+// matchLabels returns whether the labels have all the key/values of the selector.
+func matchLabels(selector, l map[string]string) bool {
+	return labels.SelectorFromSet(selector).Matches(labels.Set(l))
+}
+
+// buildSandboxName builds the ID of a sandbox from its metadata, unique per attempt.
+func buildSandboxName(metadata *runtimeapi.PodSandboxMetadata) string {
+	return fmt.Sprintf("%s_%s_%s_%d", metadata.Name, metadata.Namespace, metadata.Uid, metadata.Attempt)
+}
+
+// buildContainerName builds the ID of a container from its metadata and the
+// metadata of its sandbox, unique per attempt.
+func buildContainerName(sandbox *runtimeapi.PodSandboxMetadata, metadata *runtimeapi.ContainerMetadata) string {
+	return fmt.Sprintf("%s_%s_%d", buildSandboxName(sandbox), metadata.Name, metadata.Attempt)
+}
@@ -0,0 +1,128 @@
+package images
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	kubecontainer "github.com/xuliangTang/mykubelet/pkg/kubelet/container"
+	"github.com/xuliangTang/mykubelet/pkg/kubelet/events"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/client-go/util/flowcontrol"
+	runtimeapi "k8s.io/cri-api/pkg/apis/runtime/v1alpha2"
+	"k8s.io/klog/v2"
+)
+
+// imageManager provides the functionalities for image pulling.
+type imageManager struct {
+	recorder     record.EventRecorder
+	imageService kubecontainer.ImageService
+	backOff      *flowcontrol.Backoff
+}
+
+var _ ImageManager = &imageManager{}
+
+// NewImageManager instantiates a new ImageManager object. Pulls are serial:
+// the image service pulls one image at a time.
+func NewImageManager(recorder record.EventRecorder, imageService kubecontainer.ImageService, imageBackOff *flowcontrol.Backoff) ImageManager {
+	return &imageManager{
+		recorder:     recorder,
+		imageService: imageService,
+		backOff:      imageBackOff,
+	}
+}
+
+// shouldPullImage returns whether we should pull an image according to
+// the presence and pull policy of the image.
+func shouldPullImage(container *v1.Container, imagePresent bool) bool {
+	switch pullPolicy(container) {
+	case v1.PullNever:
+		return false
+	case v1.PullAlways:
+		return true
+	default:
+		return !imagePresent
+	}
+}
+
+// pullPolicy returns the pull policy of the container. Without one, the
+// :latest tag is pulled Always and any other tag IfNotPresent, the default
+// of the API server.
+func pullPolicy(container *v1.Container) v1.PullPolicy {
+	if container.ImagePullPolicy != "" {
+		return container.ImagePullPolicy
+	}
+	if isLatest(container.Image) {
+		return v1.PullAlways
+	}
+	return v1.PullIfNotPresent
+}
+
+// isLatest returns whether the image is tagged :latest, or not tagged at all.
+// An image pinned to a digest never is.
+func isLatest(image string) bool {
+	if strings.Contains(image, "@") {
+		return false
+	}
+	name := image[strings.LastIndex(image, "/")+1:]
+	i := strings.LastIndex(name, ":")
+	return i < 0 || name[i+1:] == "latest"
+}
+
+// records an event using ref, event msg.  log to glog using prefix, msg, logFn
+func (m *imageManager) logIt(ref *v1.ObjectReference, eventtype, event, prefix, msg string, logFn func(args ...interface{})) {
+	if ref != nil {
+		m.recorder.Event(ref, eventtype, event, msg)
+	} else {
+		logFn(fmt.Sprint(prefix, " ", msg))
+	}
+}
+
+// EnsureImageExists pulls the image for the specified pod and container, and returns
+// (imageRef, error message, error).
+func (m *imageManager) EnsureImageExists(pod *v1.Pod, container *v1.Container, pullSecrets []v1.Secret, podSandboxConfig *runtimeapi.PodSandboxConfig) (string, string, error) {
+	logPrefix := fmt.Sprintf("%s/%s/%s", pod.Namespace, pod.Name, container.Image)
+	ref, err := kubecontainer.GenerateContainerRef(pod, container)
+	if err != nil {
+		klog.ErrorS(err, "Couldn't make a ref to pod", "pod", klog.KObj(pod), "containerName", container.Name)
+	}
+
+	spec := kubecontainer.ImageSpec{Image: container.Image}
+	imageRef, err := m.imageService.GetImageRef(spec)
+	if err != nil {
+		msg := fmt.Sprintf("Failed to inspect image %q: %v", container.Image, err)
+		m.logIt(ref, v1.EventTypeWarning, events.FailedToInspectImage, logPrefix, msg, klog.Warning)
+		return "", msg, ErrImageInspect
+	}
+
+	present := imageRef != ""
+	if !shouldPullImage(container, present) {
+		if present {
+			msg := fmt.Sprintf("Container image %q already present on machine", container.Image)
+			m.logIt(ref, v1.EventTypeNormal, events.PulledImage, logPrefix, msg, klog.Info)
+			return imageRef, "", nil
+		}
+		msg := fmt.Sprintf("Container image %q is not present with pull policy of Never", container.Image)
+		m.logIt(ref, v1.EventTypeWarning, events.ErrImageNeverPullPolicy, logPrefix, msg, klog.Warning)
+		return "", msg, ErrImageNeverPull
+	}
+
+	backOffKey := fmt.Sprintf("%s_%s", pod.UID, container.Image)
+	if m.backOff.IsInBackOffSinceUpdate(backOffKey, m.backOff.Clock.Now()) {
+		msg := fmt.Sprintf("Back-off pulling image %q", container.Image)
+		m.logIt(ref, v1.EventTypeNormal, events.BackOffPullImage, logPrefix, msg, klog.Info)
+		return "", msg, ErrImagePullBackOff
+	}
+	m.logIt(ref, v1.EventTypeNormal, events.PullingImage, logPrefix, fmt.Sprintf("Pulling image %q", container.Image), klog.Info)
+	startTime := time.Now()
+	imageRef, err = m.imageService.PullImage(spec, pullSecrets, podSandboxConfig)
+	if err != nil {
+		m.logIt(ref, v1.EventTypeWarning, events.FailedToPullImage, logPrefix, fmt.Sprintf("Failed to pull image %q: %v", container.Image, err), klog.Warning)
+		m.backOff.Next(backOffKey, m.backOff.Clock.Now())
+		return "", err.Error(), ErrImagePull
+	}
+	m.logIt(ref, v1.EventTypeNormal, events.PulledImage, logPrefix, fmt.Sprintf("Successfully pulled image %q in %v", container.Image, time.Since(startTime)), klog.Info)
+	m.backOff.GC()
+	return imageRef, "", nil
+}
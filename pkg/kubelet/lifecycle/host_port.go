@@ -0,0 +1,145 @@
+package lifecycle
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+
+	"github.com/xuliangTang/mykubelet/pkg/kubelet/util/format"
+	v1 "k8s.io/api/core/v1"
+)
+
+const (
+	// HostPortReason is the reason of a pod rejected because one of its
+	// host ports is already used by another pod.
+	HostPortReason = "HostPort"
+
+	// defaultBindAllHostIP is the host IP of a host port without one.
+	defaultBindAllHostIP = "0.0.0.0"
+)
+
+type hostPortAdmitHandler struct {
+	forwardedProtocols []v1.Protocol
+}
+
+var _ PodAdmitHandler = &hostPortAdmitHandler{}
+
+// NewHostPortAdmitHandler returns a PodAdmitHandler rejecting pods with a
+// host port that one of the other active pods already uses. Pods with a
+// network of their own are also rejected for a host port whose protocol is
+// not among forwardedProtocols, unless it is nil.
+func NewHostPortAdmitHandler(forwardedProtocols []v1.Protocol) PodAdmitHandler {
+	return &hostPortAdmitHandler{forwardedProtocols: forwardedProtocols}
+}
+
+func (h *hostPortAdmitHandler) Admit(attrs *PodAdmitAttributes) PodAdmitResult {
+	if h.forwardedProtocols != nil && !attrs.Pod.Spec.HostNetwork {
+		for _, port := range hostPorts(attrs.Pod) {
+			if !h.forwarded(port.protocol) {
+				return PodAdmitResult{
+					Admit:   false,
+					Reason:  HostPortReason,
+					Message: fmt.Sprintf("Predicate %s failed: host port %s can not be forwarded, the protocol is not supported", HostPortReason, formatHostPort(port)),
+				}
+			}
+		}
+	}
+
+	used := make(hostPortInfo)
+	for _, pod := range attrs.OtherPods {
+		for _, port := range hostPorts(pod) {
+			used.add(port, pod)
+		}
+	}
+	// The ports of the pod are added as they are checked, so that a port
+	// the pod uses twice conflicts too.
+	for _, port := range hostPorts(attrs.Pod) {
+		if other := used.conflict(port); other != nil {
+			message := fmt.Sprintf("Predicate %s failed: host port %s is already used by pod %s", HostPortReason, formatHostPort(port), format.Pod(other))
+			if other == attrs.Pod {
+				message = fmt.Sprintf("Predicate %s failed: host port %s is used twice by the pod", HostPortReason, formatHostPort(port))
+			}
+			return PodAdmitResult{
+				Admit:   false,
+				Reason:  HostPortReason,
+				Message: message,
+			}
+		}
+		used.add(port, attrs.Pod)
+	}
+	return PodAdmitResult{Admit: true}
+}
+
+// forwarded returns whether host ports of the protocol are forwarded to pods.
+func (h *hostPortAdmitHandler) forwarded(protocol v1.Protocol) bool {
+	for _, p := range h.forwardedProtocols {
+		if p == protocol {
+			return true
+		}
+	}
+	return false
+}
+
+// hostPort is a host port of a pod, with its host IP and protocol defaulted.
+type hostPort struct {
+	ip       string
+	protocol v1.Protocol
+	port     int32
+}
+
+// hostPorts returns the host ports of the containers of the pod.
+func hostPorts(pod *v1.Pod) []hostPort {
+	var ports []hostPort
+	for _, container := range pod.Spec.Containers {
+		for _, port := range container.Ports {
+			if port.HostPort <= 0 {
+				continue
+			}
+			p := hostPort{ip: port.HostIP, protocol: port.Protocol, port: port.HostPort}
+			if ip := net.ParseIP(p.ip); ip == nil || ip.IsUnspecified() {
+				// No host IP, "0.0.0.0" and "::" all bind the port on
+				// every host IP.
+				p.ip = defaultBindAllHostIP
+			} else {
+				p.ip = ip.String()
+			}
+			if p.protocol == "" {
+				p.protocol = v1.ProtocolTCP
+			}
+			ports = append(ports, p)
+		}
+	}
+	return ports
+}
+
+func formatHostPort(p hostPort) string {
+	return fmt.Sprintf("%s/%s", net.JoinHostPort(p.ip, strconv.Itoa(int(p.port))), p.protocol)
+}
+
+// hostPortInfo records the pods using each host port, by protocol and
+// port and then by host IP.
+type hostPortInfo map[hostPort]map[string]*v1.Pod
+
+func (h hostPortInfo) add(p hostPort, pod *v1.Pod) {
+	key := hostPort{protocol: p.protocol, port: p.port}
+	if h[key] == nil {
+		h[key] = make(map[string]*v1.Pod)
+	}
+	h[key][p.ip] = pod
+}
+
+// conflict returns a pod using the host port. A port bound to all host IPs
+// conflicts with the port on any host IP.
+func (h hostPortInfo) conflict(p hostPort) *v1.Pod {
+	ips := h[hostPort{protocol: p.protocol, port: p.port}]
+	if p.ip == defaultBindAllHostIP {
+		for _, pod := range ips {
+			return pod
+		}
+		return nil
+	}
+	if pod, ok := ips[defaultBindAllHostIP]; ok {
+		return pod
+	}
+	return ips[p.ip]
+}
@@ -0,0 +1,149 @@
+package lifecycle
+
+import (
+	"strings"
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+func newHostPortPod(name string, ports ...v1.ContainerPort) *v1.Pod {
+	return &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "ns", UID: types.UID(name)},
+		Spec: v1.PodSpec{
+			Containers: []v1.Container{{Name: "c", Ports: ports}},
+		},
+	}
+}
+
+func port(hostIP string, protocol v1.Protocol, hostPort int32) v1.ContainerPort {
+	return v1.ContainerPort{ContainerPort: 8080, HostIP: hostIP, Protocol: protocol, HostPort: hostPort}
+}
+
+func TestHostPortAdmit(t *testing.T) {
+	for desc, test := range map[string]struct {
+		pod                *v1.Pod
+		otherPods          []*v1.Pod
+		forwardedProtocols []v1.Protocol
+		admit              bool
+		message            string
+	}{
+		"no host ports": {
+			pod:       newHostPortPod("pod", v1.ContainerPort{ContainerPort: 80}),
+			otherPods: []*v1.Pod{newHostPortPod("other", v1.ContainerPort{ContainerPort: 80})},
+			admit:     true,
+		},
+		"different ports": {
+			pod:       newHostPortPod("pod", port("", "", 80)),
+			otherPods: []*v1.Pod{newHostPortPod("other", port("", "", 81))},
+			admit:     true,
+		},
+		"different protocols": {
+			pod:       newHostPortPod("pod", port("", v1.ProtocolUDP, 53)),
+			otherPods: []*v1.Pod{newHostPortPod("other", port("", v1.ProtocolTCP, 53))},
+			admit:     true,
+		},
+		"protocol defaults to TCP": {
+			pod:       newHostPortPod("pod", port("", "", 80)),
+			otherPods: []*v1.Pod{newHostPortPod("other", port("", v1.ProtocolTCP, 80))},
+			message:   "host port 0.0.0.0:80/TCP is already used by pod other_ns",
+		},
+		"different host IPs": {
+			pod:       newHostPortPod("pod", port("127.0.0.1", "", 80)),
+			otherPods: []*v1.Pod{newHostPortPod("other", port("127.0.0.2", "", 80))},
+			admit:     true,
+		},
+		"same host IP": {
+			pod:       newHostPortPod("pod", port("127.0.0.1", "", 80)),
+			otherPods: []*v1.Pod{newHostPortPod("other", port("127.0.0.1", "", 80))},
+			message:   "host port 127.0.0.1:80/TCP is already used by pod other_ns",
+		},
+		"same IPv6 host IP written differently": {
+			pod:       newHostPortPod("pod", port("fd00:0::1", "", 80)),
+			otherPods: []*v1.Pod{newHostPortPod("other", port("fd00::1", "", 80))},
+			message:   "host port [fd00::1]:80/TCP is already used by pod other_ns",
+		},
+		"empty host IP conflicts with a specific one": {
+			pod:       newHostPortPod("pod", port("", "", 80)),
+			otherPods: []*v1.Pod{newHostPortPod("other", port("127.0.0.1", "", 80))},
+			message:   "is already used by pod other_ns",
+		},
+		"specific host IP conflicts with 0.0.0.0": {
+			pod:       newHostPortPod("pod", port("127.0.0.1", "", 80)),
+			otherPods: []*v1.Pod{newHostPortPod("other", port("0.0.0.0", "", 80))},
+			message:   "is already used by pod other_ns",
+		},
+		":: conflicts with a specific host IP": {
+			pod:       newHostPortPod("pod", port("::", "", 80)),
+			otherPods: []*v1.Pod{newHostPortPod("other", port("127.0.0.1", "", 80))},
+			message:   "is already used by pod other_ns",
+		},
+		"specific host IP conflicts with ::": {
+			pod:       newHostPortPod("pod", port("fd00::1", "", 80)),
+			otherPods: []*v1.Pod{newHostPortPod("other", port("::", "", 80))},
+			message:   "is already used by pod other_ns",
+		},
+		"0.0.0.0 conflicts with ::": {
+			pod:       newHostPortPod("pod", port("0.0.0.0", "", 80)),
+			otherPods: []*v1.Pod{newHostPortPod("other", port("::", "", 80))},
+			message:   "is already used by pod other_ns",
+		},
+		"port used twice by the pod": {
+			pod:     newHostPortPod("pod", port("", "", 80), port("", v1.ProtocolTCP, 80)),
+			message: "host port 0.0.0.0:80/TCP is used twice by the pod",
+		},
+		"port used by two containers of the pod": {
+			pod: func() *v1.Pod {
+				pod := newHostPortPod("pod", port("127.0.0.1", "", 80))
+				pod.Spec.Containers = append(pod.Spec.Containers, v1.Container{Name: "d", Ports: []v1.ContainerPort{port("", "", 80)}})
+				return pod
+			}(),
+			message: "is used twice by the pod",
+		},
+		"same port with different protocols in the pod": {
+			pod:   newHostPortPod("pod", port("", v1.ProtocolTCP, 53), port("", v1.ProtocolUDP, 53)),
+			admit: true,
+		},
+		"forwarded protocols": {
+			pod:                newHostPortPod("pod", port("", "", 80), port("", v1.ProtocolUDP, 53)),
+			forwardedProtocols: []v1.Protocol{v1.ProtocolTCP, v1.ProtocolUDP},
+			admit:              true,
+		},
+		"protocol not forwarded": {
+			pod:                newHostPortPod("pod", port("", "", 80), port("", v1.ProtocolSCTP, 9999)),
+			forwardedProtocols: []v1.Protocol{v1.ProtocolTCP, v1.ProtocolUDP},
+			message:            "host port 0.0.0.0:9999/SCTP can not be forwarded",
+		},
+		"protocol not forwarded to a pod in the host network": {
+			pod: func() *v1.Pod {
+				pod := newHostPortPod("pod", port("", v1.ProtocolSCTP, 9999))
+				pod.Spec.HostNetwork = true
+				return pod
+			}(),
+			forwardedProtocols: []v1.Protocol{v1.ProtocolTCP, v1.ProtocolUDP},
+			admit:              true,
+		},
+		"any protocol without forwarded protocols": {
+			pod:   newHostPortPod("pod", port("", v1.ProtocolSCTP, 9999)),
+			admit: true,
+		},
+	} {
+		t.Run(desc, func(t *testing.T) {
+			result := NewHostPortAdmitHandler(test.forwardedProtocols).Admit(&PodAdmitAttributes{Pod: test.pod, OtherPods: test.otherPods})
+			if result.Admit != test.admit {
+				t.Fatalf("expected admit %v, got %+v", test.admit, result)
+			}
+			if test.admit {
+				return
+			}
+			if result.Reason != HostPortReason {
+				t.Errorf("expected reason %q, got %q", HostPortReason, result.Reason)
+			}
+			if !strings.Contains(result.Message, test.message) {
+				t.Errorf("expected message %q to contain %q", result.Message, test.message)
+			}
+		})
+	}
+}
@@ -0,0 +1,99 @@
+package lifecycle
+
+import (
+	"fmt"
+	"strings"
+
+	podutil "github.com/xuliangTang/mykubelet/pkg/api/v1/pod"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+)
+
+const (
+	// UnsupportedSecurityContextReason is the reason of a pod rejected
+	// because of security context fields the runtime can not apply.
+	UnsupportedSecurityContextReason = "UnsupportedSecurityContext"
+
+	// appArmorContainerAnnotationKeyPrefix is the prefix of the annotations
+	// selecting the AppArmor profile of a container.
+	appArmorContainerAnnotationKeyPrefix = "container.apparmor.security.beta.kubernetes.io/"
+	// appArmorProfileNameUnconfined is the AppArmor profile of unconfined processes.
+	appArmorProfileNameUnconfined = "unconfined"
+)
+
+type securityContextAdmitHandler struct{}
+
+var _ PodAdmitHandler = &securityContextAdmitHandler{}
+
+// NewSecurityContextAdmitHandler returns a PodAdmitHandler rejecting pods
+// that request security context fields the process runtime does not apply,
+// instead of running them with the field silently ignored. CRI runtimes
+// apply these fields themselves.
+func NewSecurityContextAdmitHandler() PodAdmitHandler {
+	return &securityContextAdmitHandler{}
+}
+
+func (h *securityContextAdmitHandler) Admit(attrs *PodAdmitAttributes) PodAdmitResult {
+	unsupported := unsupportedSecurityContextFields(attrs.Pod)
+	if len(unsupported) == 0 {
+		return PodAdmitResult{Admit: true}
+	}
+	return PodAdmitResult{
+		Admit:   false,
+		Reason:  UnsupportedSecurityContextReason,
+		Message: fmt.Sprintf("requests security context fields not supported by this node: %s", strings.Join(unsupported, ", ")),
+	}
+}
+
+// unsupportedSecurityContextFields returns the paths of the fields of the pod
+// that request SELinux, AppArmor, seccomp, sysctls, unmasked /proc or Windows
+// options, none of which the process runtime applies.
+func unsupportedSecurityContextFields(pod *v1.Pod) []string {
+	var unsupported []string
+	if sc := pod.Spec.SecurityContext; sc != nil {
+		fldPath := field.NewPath("spec", "securityContext")
+		if sc.SELinuxOptions != nil {
+			unsupported = append(unsupported, fldPath.Child("seLinuxOptions").String())
+		}
+		if sc.WindowsOptions != nil {
+			unsupported = append(unsupported, fldPath.Child("windowsOptions").String())
+		}
+		if len(sc.Sysctls) > 0 {
+			unsupported = append(unsupported, fldPath.Child("sysctls").String())
+		}
+		if confinedSeccompProfile(sc.SeccompProfile) {
+			unsupported = append(unsupported, fldPath.Child("seccompProfile").String())
+		}
+	}
+
+	podutil.VisitContainersWithPath(&pod.Spec, field.NewPath("spec"), func(c *v1.Container, fldPath *field.Path) bool {
+		if profile, ok := pod.Annotations[appArmorContainerAnnotationKeyPrefix+c.Name]; ok && profile != appArmorProfileNameUnconfined {
+			unsupported = append(unsupported, field.NewPath("metadata", "annotations").Key(appArmorContainerAnnotationKeyPrefix+c.Name).String())
+		}
+		sc := c.SecurityContext
+		if sc == nil {
+			return true
+		}
+		fldPath = fldPath.Child("securityContext")
+		if sc.SELinuxOptions != nil {
+			unsupported = append(unsupported, fldPath.Child("seLinuxOptions").String())
+		}
+		if sc.WindowsOptions != nil {
+			unsupported = append(unsupported, fldPath.Child("windowsOptions").String())
+		}
+		if confinedSeccompProfile(sc.SeccompProfile) {
+			unsupported = append(unsupported, fldPath.Child("seccompProfile").String())
+		}
+		if sc.ProcMount != nil && *sc.ProcMount != v1.DefaultProcMount {
+			unsupported = append(unsupported, fldPath.Child("procMount").String())
+		}
+		return true
+	})
+	return unsupported
+}
+
+// confinedSeccompProfile returns whether the profile restricts the syscalls
+// of the processes.
+func confinedSeccompProfile(profile *v1.SeccompProfile) bool {
+	return profile != nil && profile.Type != v1.SeccompProfileTypeUnconfined
+}
@@ -0,0 +1,207 @@
+package logs
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	runtimeapi "k8s.io/cri-api/pkg/apis/runtime/v1alpha2"
+	"k8s.io/klog/v2"
+)
+
+const (
+	// timestampFormat is format of the timestamp suffix for rotated log.
+	// See https://golang.org/pkg/time/#Time.Format.
+	timestampFormat = "20060102-150405"
+
+	// maxLineSize is the longest line written to the log file in one piece.
+	// Longer output lines are split into partial lines.
+	maxLineSize = 16 * 1024
+)
+
+// LogRotatePolicy is a policy for container log rotation. The policy applies to all
+// containers managed by kubelet.
+type LogRotatePolicy struct {
+	// MaxSize in bytes of the container log file before it is rotated. Negative
+	// number means to disable container log rotation.
+	MaxSize int64
+	// MaxFiles is the maximum number of log files that can be present.
+	// If rotating the logs creates excess files, the oldest file is removed.
+	MaxFiles int
+}
+
+// GetAllLogs gets all inuse (rotated/compressed) logs for a specific container log.
+// Returned logs are sorted in oldest to newest order.
+// TODO(#59902): Leverage this function to support log rotation in `kubectl logs`.
+func GetAllLogs(log string) ([]string, error) {
+	// pattern is used to match all rotated files.
+	pattern := fmt.Sprintf("%s.*", log)
+	logs, err := filepath.Glob(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list all log files with pattern %q: %v", pattern, err)
+	}
+	sort.Strings(logs)
+	logs = append(logs, log)
+	return logs, nil
+}
+
+// ContainerLogWriter writes the output streams of a container into its log
+// file in CRI log format, rotating the file according to a LogRotatePolicy:
+//
+//	2016-10-06T00:17:09.669794202Z stdout P log content 1
+//	2016-10-06T00:17:09.669794203Z stderr F log content 2
+type ContainerLogWriter struct {
+	path   string
+	policy LogRotatePolicy
+
+	// mu guards file and size, stdout and stderr are copied concurrently.
+	mu   sync.Mutex
+	file *os.File
+	size int64
+}
+
+// NewContainerLogWriter opens the log file at path for appending.
+func NewContainerLogWriter(path string, policy LogRotatePolicy) (*ContainerLogWriter, error) {
+	w := &ContainerLogWriter{path: path, policy: policy}
+	if err := w.open(); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+func (w *ContainerLogWriter) open() error {
+	f, err := os.OpenFile(w.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0640)
+	if err != nil {
+		return fmt.Errorf("failed to open log file %q: %v", w.path, err)
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return fmt.Errorf("failed to stat log file %q: %v", w.path, err)
+	}
+	w.file = f
+	w.size = info.Size()
+	return nil
+}
+
+// CopyStream copies r into the log file line by line, tagging every line
+// with stream. It returns once r hits EOF or fails.
+func (w *ContainerLogWriter) CopyStream(stream runtimeapi.LogStreamType, r io.Reader) {
+	br := bufio.NewReaderSize(r, maxLineSize)
+	for {
+		line, isPrefix, err := br.ReadLine()
+		if len(line) > 0 || (err == nil && !isPrefix) {
+			tag := runtimeapi.LogTagFull
+			if isPrefix {
+				tag = runtimeapi.LogTagPartial
+			}
+			if werr := w.writeLine(stream, tag, line); werr != nil {
+				klog.ErrorS(werr, "Failed to write container log", "path", w.path)
+			}
+		}
+		if err != nil {
+			if err != io.EOF {
+				klog.ErrorS(err, "Failed to read container output", "path", w.path, "stream", stream)
+			}
+			return
+		}
+	}
+}
+
+// writeLine writes one line in CRI log format.
+func (w *ContainerLogWriter) writeLine(stream runtimeapi.LogStreamType, tag runtimeapi.LogTag, content []byte) error {
+	timestamp := time.Now().Format(timeFormatOut)
+	line := make([]byte, 0, len(timestamp)+len(stream)+len(tag)+len(content)+4)
+	line = append(line, timestamp...)
+	line = append(line, delimiter[0])
+	line = append(line, stream...)
+	line = append(line, delimiter[0])
+	line = append(line, tag...)
+	line = append(line, delimiter[0])
+	line = append(line, content...)
+	line = append(line, eol[0])
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.file == nil {
+		return fmt.Errorf("log file %q is closed", w.path)
+	}
+	if w.policy.MaxSize > 0 && w.size > 0 && w.size+int64(len(line)) > w.policy.MaxSize {
+		if err := w.rotateLocked(); err != nil {
+			// 轮转失败时继续写入当前文件，避免丢失日志
+			klog.ErrorS(err, "Failed to rotate container log", "path", w.path)
+		}
+	}
+	n, err := w.file.Write(line)
+	w.size += int64(n)
+	return err
+}
+
+// rotateLocked renames the current log file with a timestamp suffix, removes
+// the rotated files exceeding MaxFiles and reopens the log file. The caller
+// must hold mu.
+func (w *ContainerLogWriter) rotateLocked() error {
+	if err := w.file.Close(); err != nil {
+		return err
+	}
+	w.file = nil
+
+	rotated := fmt.Sprintf("%s.%s", w.path, time.Now().Format(timestampFormat))
+	// Several rotations within one second get an increasing suffix.
+	for i := 1; ; i++ {
+		if _, err := os.Stat(rotated); os.IsNotExist(err) {
+			break
+		}
+		rotated = fmt.Sprintf("%s.%s.%d", w.path, time.Now().Format(timestampFormat), i)
+	}
+	if err := os.Rename(w.path, rotated); err != nil {
+		if openErr := w.open(); openErr != nil {
+			return openErr
+		}
+		return fmt.Errorf("failed to rotate log %q to %q: %v", w.path, rotated, err)
+	}
+	if err := w.removeExcessLogs(); err != nil {
+		klog.ErrorS(err, "Failed to remove excess container logs", "path", w.path)
+	}
+	return w.open()
+}
+
+// removeExcessLogs removes old logs to make sure there are only at most
+// MaxFiles log files, including the current one which is about to be
+// recreated.
+func (w *ContainerLogWriter) removeExcessLogs() error {
+	logs, err := GetAllLogs(w.path)
+	if err != nil {
+		return err
+	}
+	// The current log is renamed already, drop it from the list.
+	logs = logs[:len(logs)-1]
+	maxRotated := w.policy.MaxFiles - 1
+	if maxRotated < 0 {
+		maxRotated = 0
+	}
+	for len(logs) > maxRotated {
+		if err := os.Remove(logs[0]); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		logs = logs[1:]
+	}
+	return nil
+}
+
+// Close closes the log file.
+func (w *ContainerLogWriter) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.file == nil {
+		return nil
+	}
+	err := w.file.Close()
+	w.file = nil
+	return err
+}
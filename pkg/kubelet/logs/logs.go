@@ -0,0 +1,358 @@
+package logs
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/xuliangTang/mykubelet/pkg/kubelet/types"
+	"github.com/xuliangTang/mykubelet/pkg/util/tail"
+	v1 "k8s.io/api/core/v1"
+	runtimeapi "k8s.io/cri-api/pkg/apis/runtime/v1alpha2"
+	"k8s.io/klog/v2"
+)
+
+// Notice that the current CRI logs implementation only reads the current log
+// file of a container.
+// * It will not retrieve logs in rotated log file.
+// * If log rotation happens when following the log, the rest of the old file
+//   is read before following the new one.
+
+const (
+	// timeFormatOut is the format for writing timestamps to output.
+	timeFormatOut = types.RFC3339NanoFixed
+	// timeFormatIn is the format for parsing timestamps from other logs.
+	timeFormatIn = types.RFC3339NanoLenient
+
+	// logPollPeriod is the period to check a followed log file for new
+	// content, rotation and whether its container is still running.
+	logPollPeriod = 250 * time.Millisecond
+)
+
+var (
+	// eol is the end-of-line sign in the log.
+	eol = []byte{'\n'}
+	// delimiter is the delimiter for timestamp and stream type in log line.
+	delimiter = []byte{' '}
+	// tagDelimiter is the delimiter for log tags.
+	tagDelimiter = []byte(runtimeapi.LogTagDelimiter)
+)
+
+// logMessage is the CRI internal log type.
+type logMessage struct {
+	timestamp time.Time
+	stream    runtimeapi.LogStreamType
+	log       []byte
+}
+
+// reset resets the log to nil.
+func (l *logMessage) reset() {
+	l.timestamp = time.Time{}
+	l.stream = ""
+	l.log = nil
+}
+
+// LogOptions is the CRI internal type of all log options.
+type LogOptions struct {
+	tail      int64
+	bytes     int64
+	since     time.Time
+	follow    bool
+	timestamp bool
+}
+
+// NewLogOptions convert the v1.PodLogOptions to CRI internal LogOptions.
+func NewLogOptions(apiOpts *v1.PodLogOptions, now time.Time) *LogOptions {
+	opts := &LogOptions{
+		tail:      -1, // -1 by default which means read all logs.
+		bytes:     -1, // -1 by default which means read all logs.
+		follow:    apiOpts.Follow,
+		timestamp: apiOpts.Timestamps,
+	}
+	if apiOpts.TailLines != nil {
+		opts.tail = *apiOpts.TailLines
+	}
+	if apiOpts.LimitBytes != nil {
+		opts.bytes = *apiOpts.LimitBytes
+	}
+	if apiOpts.SinceSeconds != nil {
+		opts.since = now.Add(-time.Duration(*apiOpts.SinceSeconds) * time.Second)
+	}
+	if apiOpts.SinceTime != nil && apiOpts.SinceTime.After(opts.since) {
+		opts.since = apiOpts.SinceTime.Time
+	}
+	return opts
+}
+
+// parseCRILog parses logs in CRI log format. CRI Log format example:
+//
+//	2016-10-06T00:17:09.669794202Z stdout P log content 1
+//	2016-10-06T00:17:09.669794203Z stderr F log content 2
+func parseCRILog(log []byte, msg *logMessage) error {
+	var err error
+	// Parse timestamp
+	idx := bytes.Index(log, delimiter)
+	if idx < 0 {
+		return fmt.Errorf("timestamp is not found")
+	}
+	msg.timestamp, err = time.Parse(timeFormatIn, string(log[:idx]))
+	if err != nil {
+		return fmt.Errorf("unexpected timestamp format %q: %v", timeFormatIn, err)
+	}
+
+	// Parse stream type
+	log = log[idx+1:]
+	idx = bytes.Index(log, delimiter)
+	if idx < 0 {
+		return fmt.Errorf("stream type is not found")
+	}
+	msg.stream = runtimeapi.LogStreamType(log[:idx])
+	if msg.stream != runtimeapi.Stdout && msg.stream != runtimeapi.Stderr {
+		return fmt.Errorf("unexpected stream type %q", msg.stream)
+	}
+
+	// Parse log tag
+	log = log[idx+1:]
+	idx = bytes.Index(log, delimiter)
+	if idx < 0 {
+		return fmt.Errorf("log tag is not found")
+	}
+	// Keep this forward compatible.
+	tags := bytes.Split(log[:idx], tagDelimiter)
+	partial := runtimeapi.LogTag(tags[0]) == runtimeapi.LogTagPartial
+	// Trim the tailing new line if this is a partial line.
+	if partial && len(log) > 0 && log[len(log)-1] == '\n' {
+		log = log[:len(log)-1]
+	}
+
+	// Get log content
+	msg.log = log[idx+1:]
+
+	return nil
+}
+
+// logWriter controls the writing into the stream based on the log options.
+type logWriter struct {
+	stdout io.Writer
+	stderr io.Writer
+	opts   *LogOptions
+	remain int64
+}
+
+// errMaximumWrite is returned when all bytes have been written.
+var errMaximumWrite = errors.New("maximum write")
+
+// errShortWrite is returned when the message is not fully written.
+var errShortWrite = errors.New("short write")
+
+func newLogWriter(stdout io.Writer, stderr io.Writer, opts *LogOptions) *logWriter {
+	w := &logWriter{
+		stdout: stdout,
+		stderr: stderr,
+		opts:   opts,
+		remain: math.MaxInt64, // initialize it as infinity
+	}
+	if opts.bytes >= 0 {
+		w.remain = opts.bytes
+	}
+	return w
+}
+
+// writeLogs writes logs into stdout, stderr.
+func (w *logWriter) write(msg *logMessage, addPrefix bool) error {
+	if msg.timestamp.Before(w.opts.since) {
+		// Skip the line because it's older than since
+		return nil
+	}
+	line := msg.log
+	if w.opts.timestamp && addPrefix {
+		prefix := append([]byte(msg.timestamp.Format(timeFormatOut)), delimiter[0])
+		line = append(prefix, line...)
+	}
+	// If the line is longer than the remaining bytes, cut it.
+	if int64(len(line)) > w.remain {
+		line = line[:w.remain]
+	}
+	// Get the proper stream to write to.
+	var stream io.Writer
+	switch msg.stream {
+	case runtimeapi.Stdout:
+		stream = w.stdout
+	case runtimeapi.Stderr:
+		stream = w.stderr
+	default:
+		return fmt.Errorf("unexpected stream type %q", msg.stream)
+	}
+	n, err := stream.Write(line)
+	w.remain -= int64(n)
+	if err != nil {
+		return err
+	}
+	// If the line has not been fully written, return errShortWrite
+	if n < len(line) {
+		return errShortWrite
+	}
+	// If there are no more bytes left, return errMaximumWrite
+	if w.remain <= 0 {
+		return errMaximumWrite
+	}
+	return nil
+}
+
+// ContainerRunningFunc reports whether the container with the given id is
+// still running.
+type ContainerRunningFunc func(containerID string) (bool, error)
+
+// ReadLogs read the container log and redirect into stdout and stderr.
+// Note that containerID is only needed when following the log, or else
+// just pass in empty string "".
+func ReadLogs(ctx context.Context, path, containerID string, opts *LogOptions, isContainerRunning ContainerRunningFunc, stdout, stderr io.Writer) error {
+	// We explicitly resolve symlinks before reading the logs, so that a
+	// recreated file can be detected by comparing it to the opened one.
+	evaluated, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return fmt.Errorf("failed to try resolving symlinks in path %q: %v", path, err)
+	}
+	path = evaluated
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open log file %q: %v", path, err)
+	}
+	defer func() { f.Close() }()
+
+	// Search start point based on tail line.
+	start, err := tail.FindTailLineStartIndex(f, opts.tail)
+	if err != nil {
+		return fmt.Errorf("failed to tail %d lines of log file %q: %v", opts.tail, path, err)
+	}
+	if _, err := f.Seek(start, io.SeekStart); err != nil {
+		return fmt.Errorf("failed to seek %d in log file %q: %v", start, path, err)
+	}
+
+	limitedMode := (opts.tail >= 0) && (!opts.follow)
+	limitedNum := opts.tail
+	// Start parsing the logs.
+	r := bufio.NewReader(f)
+	var stop, rotated bool
+	isNewLine := true
+	found := true
+	writer := newLogWriter(stdout, stderr, opts)
+	msg := &logMessage{}
+	for {
+		if stop || (limitedMode && limitedNum == 0) {
+			klog.V(2).InfoS("Finished parsing log file", "path", path)
+			return nil
+		}
+		l, err := r.ReadBytes(eol[0])
+		if err != nil {
+			if err != io.EOF { // This is an real error
+				return fmt.Errorf("failed to read log file %q: %v", path, err)
+			}
+			if opts.follow {
+				// Reset seek so that if this is an incomplete line,
+				// it will be read again.
+				if _, err := f.Seek(-int64(len(l)), io.SeekCurrent); err != nil {
+					return fmt.Errorf("failed to reset seek in log file %q: %v", path, err)
+				}
+				// The container is not running, we got to the end of the log.
+				if !found && !rotated {
+					return nil
+				}
+				if rotated {
+					// The old file has been consumed, continue with the new one.
+					newF, err := os.Open(path)
+					if err != nil {
+						if os.IsNotExist(err) {
+							// 新文件尚未创建，等待下一个周期再重试
+							select {
+							case <-ctx.Done():
+								return fmt.Errorf("context cancelled")
+							case <-time.After(logPollPeriod):
+							}
+							continue
+						}
+						return fmt.Errorf("failed to open log file %q: %v", path, err)
+					}
+					f.Close()
+					f = newF
+					r = bufio.NewReader(f)
+					rotated = false
+					continue
+				}
+				// Wait until the next log change.
+				found, rotated, err = waitLogs(ctx, containerID, path, f, isContainerRunning)
+				if err != nil {
+					return err
+				}
+				// If the container exited consume data until the next EOF
+				continue
+			}
+			// Should stop after writing the remaining content.
+			stop = true
+			if len(l) == 0 {
+				continue
+			}
+			klog.InfoS("Incomplete line in log file", "path", path, "line", l)
+		}
+		// Parse the log line.
+		msg.reset()
+		if err := parseCRILog(l, msg); err != nil {
+			klog.ErrorS(err, "Failed when parsing line in log file", "path", path, "line", l)
+			continue
+		}
+		// Write the log line into the stream.
+		if err := writer.write(msg, isNewLine); err != nil {
+			if err == errMaximumWrite {
+				klog.V(2).InfoS("Finished parsing log file, hit bytes limit", "path", path, "limit", opts.bytes)
+				return nil
+			}
+			klog.ErrorS(err, "Failed when writing line to log file", "path", path, "line", msg)
+			return err
+		}
+		if limitedMode {
+			limitedNum--
+		}
+		if len(msg.log) > 0 {
+			isNewLine = msg.log[len(msg.log)-1] == eol[0]
+		} else {
+			isNewLine = true
+		}
+	}
+}
+
+// waitLogs waits for the next log change of the opened file f at path.
+// The first return value is whether the container is still running, and
+// the second is whether the log file was rotated.
+func waitLogs(ctx context.Context, id string, path string, f *os.File, isContainerRunning ContainerRunningFunc) (bool, bool, error) {
+	// no need to wait if the pod is not running
+	if running, err := isContainerRunning(id); !running {
+		return false, false, err
+	}
+
+	select {
+	case <-ctx.Done():
+		return false, false, fmt.Errorf("context cancelled")
+	case <-time.After(logPollPeriod):
+	}
+
+	opened, err := f.Stat()
+	if err != nil {
+		return true, false, err
+	}
+	current, err := os.Stat(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			// 轮转过程中文件短暂不存在，下次再检查
+			return true, false, nil
+		}
+		return true, false, err
+	}
+	return true, !os.SameFile(opened, current), nil
+}
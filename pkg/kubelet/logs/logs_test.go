@@ -0,0 +1,289 @@
+package logs
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	runtimeapi "k8s.io/cri-api/pkg/apis/runtime/v1alpha2"
+)
+
+// syncBuffer is a bytes.Buffer that can be read while ReadLogs writes to it.
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+var testBaseTime = time.Date(2022, 8, 1, 10, 0, 0, 0, time.UTC)
+
+// criLine formats a CRI log line written i seconds after testBaseTime.
+func criLine(i int, stream runtimeapi.LogStreamType, tag runtimeapi.LogTag, log string) string {
+	ts := testBaseTime.Add(time.Duration(i) * time.Second).Format(timeFormatOut)
+	return fmt.Sprintf("%s %s %s %s\n", ts, stream, tag, log)
+}
+
+func writeLogFile(t *testing.T, path string, lines ...string) {
+	t.Helper()
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0640)
+	if err != nil {
+		t.Fatalf("failed to open log file: %v", err)
+	}
+	defer f.Close()
+	for _, l := range lines {
+		if _, err := f.WriteString(l); err != nil {
+			t.Fatalf("failed to write log file: %v", err)
+		}
+	}
+}
+
+func notRunning(string) (bool, error) { return false, nil }
+
+func TestNewLogOptions(t *testing.T) {
+	tail := int64(10)
+	limit := int64(100)
+	sinceSeconds := int64(30)
+	now := testBaseTime.Add(time.Hour)
+	sinceTime := metav1.NewTime(now.Add(-10 * time.Second))
+
+	for desc, test := range map[string]struct {
+		apiOpts *v1.PodLogOptions
+		expect  *LogOptions
+	}{
+		"default options": {
+			apiOpts: &v1.PodLogOptions{},
+			expect:  &LogOptions{tail: -1, bytes: -1},
+		},
+		"tail, limitBytes, follow and timestamps": {
+			apiOpts: &v1.PodLogOptions{TailLines: &tail, LimitBytes: &limit, Follow: true, Timestamps: true},
+			expect:  &LogOptions{tail: tail, bytes: limit, follow: true, timestamp: true},
+		},
+		"sinceSeconds": {
+			apiOpts: &v1.PodLogOptions{SinceSeconds: &sinceSeconds},
+			expect:  &LogOptions{tail: -1, bytes: -1, since: now.Add(-30 * time.Second)},
+		},
+		"the later of sinceSeconds and sinceTime": {
+			apiOpts: &v1.PodLogOptions{SinceSeconds: &sinceSeconds, SinceTime: &sinceTime},
+			expect:  &LogOptions{tail: -1, bytes: -1, since: sinceTime.Time},
+		},
+	} {
+		t.Run(desc, func(t *testing.T) {
+			opts := NewLogOptions(test.apiOpts, now)
+			if *opts != *test.expect {
+				t.Errorf("expected %+v, got %+v", *test.expect, *opts)
+			}
+		})
+	}
+}
+
+func TestParseCRILog(t *testing.T) {
+	for desc, test := range map[string]struct {
+		line   string
+		expect *logMessage
+		err    bool
+	}{
+		"full stdout line": {
+			line:   criLine(0, runtimeapi.Stdout, runtimeapi.LogTagFull, "hello"),
+			expect: &logMessage{timestamp: testBaseTime, stream: runtimeapi.Stdout, log: []byte("hello\n")},
+		},
+		"partial stderr line": {
+			line:   criLine(1, runtimeapi.Stderr, runtimeapi.LogTagPartial, "hel"),
+			expect: &logMessage{timestamp: testBaseTime.Add(time.Second), stream: runtimeapi.Stderr, log: []byte("hel")},
+		},
+		"unknown stream": {
+			line: testBaseTime.Format(timeFormatOut) + " stdin F hello\n",
+			err:  true,
+		},
+		"missing timestamp": {
+			line: "hello\n",
+			err:  true,
+		},
+	} {
+		t.Run(desc, func(t *testing.T) {
+			msg := &logMessage{}
+			err := parseCRILog([]byte(test.line), msg)
+			if test.err {
+				if err == nil {
+					t.Fatalf("expected error, got %+v", msg)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !msg.timestamp.Equal(test.expect.timestamp) || msg.stream != test.expect.stream || !bytes.Equal(msg.log, test.expect.log) {
+				t.Errorf("expected %+v, got %+v", test.expect, msg)
+			}
+		})
+	}
+}
+
+func TestReadLogs(t *testing.T) {
+	lines := []string{
+		criLine(0, runtimeapi.Stdout, runtimeapi.LogTagFull, "line1"),
+		criLine(1, runtimeapi.Stderr, runtimeapi.LogTagFull, "line2"),
+		criLine(2, runtimeapi.Stdout, runtimeapi.LogTagPartial, "line3-"),
+		criLine(3, runtimeapi.Stdout, runtimeapi.LogTagFull, "end"),
+		criLine(4, runtimeapi.Stdout, runtimeapi.LogTagFull, "line4"),
+	}
+	path := filepath.Join(t.TempDir(), "0.log")
+	writeLogFile(t, path, lines...)
+
+	for desc, test := range map[string]struct {
+		opts           *LogOptions
+		expectedStdout string
+		expectedStderr string
+	}{
+		"all logs": {
+			opts:           &LogOptions{tail: -1, bytes: -1},
+			expectedStdout: "line1\nline3-end\nline4\n",
+			expectedStderr: "line2\n",
+		},
+		"tail": {
+			opts:           &LogOptions{tail: 2, bytes: -1},
+			expectedStdout: "end\nline4\n",
+		},
+		"tail zero": {
+			opts: &LogOptions{tail: 0, bytes: -1},
+		},
+		"since": {
+			opts:           &LogOptions{tail: -1, bytes: -1, since: testBaseTime.Add(2 * time.Second)},
+			expectedStdout: "line3-end\nline4\n",
+		},
+		"limitBytes": {
+			opts:           &LogOptions{tail: -1, bytes: 8},
+			expectedStdout: "line1\n",
+			expectedStderr: "li",
+		},
+		"timestamps": {
+			opts: &LogOptions{tail: 2, bytes: -1, timestamp: true},
+			expectedStdout: testBaseTime.Add(3*time.Second).Format(timeFormatOut) + " end\n" +
+				testBaseTime.Add(4*time.Second).Format(timeFormatOut) + " line4\n",
+		},
+		"timestamps only prefix the start of a partial line": {
+			opts: &LogOptions{tail: -1, bytes: -1, since: testBaseTime.Add(2 * time.Second), timestamp: true},
+			expectedStdout: testBaseTime.Add(2*time.Second).Format(timeFormatOut) + " line3-end\n" +
+				testBaseTime.Add(4*time.Second).Format(timeFormatOut) + " line4\n",
+		},
+		// A previous container is no longer running, so following its log
+		// returns once the file has been consumed.
+		"previous container followed": {
+			opts:           &LogOptions{tail: -1, bytes: -1, follow: true},
+			expectedStdout: "line1\nline3-end\nline4\n",
+			expectedStderr: "line2\n",
+		},
+	} {
+		t.Run(desc, func(t *testing.T) {
+			stdout := &bytes.Buffer{}
+			stderr := &bytes.Buffer{}
+			if err := ReadLogs(context.Background(), path, "", test.opts, notRunning, stdout, stderr); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if stdout.String() != test.expectedStdout {
+				t.Errorf("expected stdout %q, got %q", test.expectedStdout, stdout.String())
+			}
+			if stderr.String() != test.expectedStderr {
+				t.Errorf("expected stderr %q, got %q", test.expectedStderr, stderr.String())
+			}
+		})
+	}
+}
+
+func TestReadLogsFollowAcrossRotation(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "0.log")
+	writeLogFile(t, path, criLine(0, runtimeapi.Stdout, runtimeapi.LogTagFull, "before"))
+
+	var mu sync.Mutex
+	running := true
+	isRunning := func(string) (bool, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		return running, nil
+	}
+
+	stdout := &syncBuffer{}
+	done := make(chan error, 1)
+	go func() {
+		done <- ReadLogs(context.Background(), path, "id", &LogOptions{tail: -1, bytes: -1, follow: true}, isRunning, stdout, stdout)
+	}()
+
+	waitFor := func(expected string) {
+		t.Helper()
+		deadline := time.Now().Add(5 * time.Second)
+		for stdout.String() != expected {
+			if time.Now().After(deadline) {
+				t.Fatalf("expected output %q, got %q", expected, stdout.String())
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+	waitFor("before\n")
+
+	// Rotate: append to the old file, rename it and leave the new file
+	// missing for a few poll periods before creating it.
+	writeLogFile(t, path, criLine(1, runtimeapi.Stdout, runtimeapi.LogTagFull, "rotated"))
+	if err := os.Rename(path, path+".1"); err != nil {
+		t.Fatalf("failed to rotate log file: %v", err)
+	}
+	time.Sleep(3 * logPollPeriod)
+	writeLogFile(t, path, criLine(2, runtimeapi.Stdout, runtimeapi.LogTagFull, "after"))
+	waitFor("before\nrotated\nafter\n")
+
+	mu.Lock()
+	running = false
+	mu.Unlock()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("ReadLogs did not return after the container stopped")
+	}
+}
+
+func TestReadLogsFollowCancelledWhileRotating(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "0.log")
+	writeLogFile(t, path, criLine(0, runtimeapi.Stdout, runtimeapi.LogTagFull, "before"))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	running := func(string) (bool, error) { return true, nil }
+	done := make(chan error, 1)
+	go func() {
+		done <- ReadLogs(ctx, path, "id", &LogOptions{tail: -1, bytes: -1, follow: true}, running, &syncBuffer{}, &syncBuffer{})
+	}()
+
+	time.Sleep(logPollPeriod / 2)
+	if err := os.Rename(path, path+".1"); err != nil {
+		t.Fatalf("failed to rotate log file: %v", err)
+	}
+	time.Sleep(3 * logPollPeriod)
+	cancel()
+	select {
+	case err := <-done:
+		if err == nil {
+			t.Fatal("expected an error after the context was cancelled")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("ReadLogs did not return after the context was cancelled")
+	}
+}
@@ -0,0 +1,390 @@
+package dns
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+	runtimeapi "k8s.io/cri-api/pkg/apis/runtime/v1alpha2"
+)
+
+const testHostResolvConf = `# generated
+nameserver 192.168.0.1
+nameserver 192.168.0.2
+search host.example.com example.com.
+options timeout:2 ndots:1
+`
+
+var (
+	testClusterDNS    = []net.IP{net.ParseIP("10.96.0.10")}
+	testClusterDomain = "cluster.local"
+)
+
+func newTestConfigurer(t *testing.T, clusterDNS []net.IP, resolvConf string) (*Configurer, *record.FakeRecorder) {
+	t.Helper()
+	resolverConfig := ""
+	if resolvConf != "" {
+		resolverConfig = filepath.Join(t.TempDir(), "resolv.conf")
+		if err := os.WriteFile(resolverConfig, []byte(resolvConf), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	recorder := record.NewFakeRecorder(20)
+	nodeRef := &v1.ObjectReference{Kind: "Node", Name: "node"}
+	return NewConfigurer(recorder, nodeRef, clusterDNS, testClusterDomain, resolverConfig), recorder
+}
+
+func newTestPod(policy v1.DNSPolicy, hostNetwork bool) *v1.Pod {
+	return &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "pod", Namespace: "ns", UID: "uid"},
+		Spec: v1.PodSpec{
+			DNSPolicy:   policy,
+			HostNetwork: hostNetwork,
+		},
+	}
+}
+
+// events returns the events recorded so far.
+func events(recorder *record.FakeRecorder) []string {
+	var events []string
+	for {
+		select {
+		case e := <-recorder.Events:
+			events = append(events, e)
+		default:
+			return events
+		}
+	}
+}
+
+func TestParseResolvConf(t *testing.T) {
+	for desc, test := range map[string]struct {
+		data        string
+		nameservers []string
+		searches    []string
+		options     []string
+		err         bool
+	}{
+		"empty": {
+			nameservers: []string{},
+			searches:    []string{},
+			options:     []string{},
+		},
+		"full": {
+			data:        testHostResolvConf,
+			nameservers: []string{"192.168.0.1", "192.168.0.2"},
+			searches:    []string{"host.example.com", "example.com"},
+			options:     []string{"ndots:1", "timeout:2"},
+		},
+		"last search wins and root domain is dropped": {
+			data:        "search a.com b.com\nsearch c.com .\n",
+			nameservers: []string{},
+			searches:    []string{"c.com"},
+			options:     []string{},
+		},
+		"later options overwrite earlier ones": {
+			data:        "options ndots:1 rotate\noptions ndots:2\n",
+			nameservers: []string{},
+			searches:    []string{},
+			options:     []string{"ndots:2", "rotate"},
+		},
+		"empty nameserver": {
+			data: "nameserver\n",
+			err:  true,
+		},
+	} {
+		t.Run(desc, func(t *testing.T) {
+			nameservers, searches, options, err := parseResolvConf(strings.NewReader(test.data))
+			if test.err {
+				if err == nil {
+					t.Fatal("expected error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(nameservers, test.nameservers) || !reflect.DeepEqual(searches, test.searches) || !reflect.DeepEqual(options, test.options) {
+				t.Errorf("expected %v %v %v, got %v %v %v", test.nameservers, test.searches, test.options, nameservers, searches, options)
+			}
+		})
+	}
+}
+
+func TestGetPodDNS(t *testing.T) {
+	ndots := "3"
+	clusterSearches := []string{"ns.svc.cluster.local", "svc.cluster.local", "cluster.local", "host.example.com", "example.com"}
+	hostConfig := &runtimeapi.DNSConfig{
+		Servers:  []string{"192.168.0.1", "192.168.0.2"},
+		Searches: []string{"host.example.com", "example.com"},
+		Options:  []string{"ndots:1", "timeout:2"},
+	}
+
+	for desc, test := range map[string]struct {
+		clusterDNS     []net.IP
+		resolvConf     string
+		pod            *v1.Pod
+		dnsConfig      *v1.PodDNSConfig
+		expected       *runtimeapi.DNSConfig
+		expectedEvents []string
+	}{
+		"ClusterFirst": {
+			clusterDNS: testClusterDNS,
+			resolvConf: testHostResolvConf,
+			pod:        newTestPod(v1.DNSClusterFirst, false),
+			expected: &runtimeapi.DNSConfig{
+				Servers:  []string{"10.96.0.10"},
+				Searches: clusterSearches,
+				Options:  []string{"ndots:5"},
+			},
+		},
+		"ClusterFirst on the host network falls back to Default": {
+			clusterDNS: testClusterDNS,
+			resolvConf: testHostResolvConf,
+			pod:        newTestPod(v1.DNSClusterFirst, true),
+			expected:   hostConfig,
+		},
+		"ClusterFirst without cluster DNS falls back to Default": {
+			resolvConf:     testHostResolvConf,
+			pod:            newTestPod(v1.DNSClusterFirst, false),
+			expected:       hostConfig,
+			expectedEvents: []string{"Warning MissingClusterDNS", "Warning MissingClusterDNS"},
+		},
+		"ClusterFirstWithHostNet": {
+			clusterDNS: testClusterDNS,
+			resolvConf: testHostResolvConf,
+			pod:        newTestPod(v1.DNSClusterFirstWithHostNet, true),
+			expected: &runtimeapi.DNSConfig{
+				Servers:  []string{"10.96.0.10"},
+				Searches: clusterSearches,
+				Options:  []string{"ndots:5"},
+			},
+		},
+		"Default": {
+			clusterDNS: testClusterDNS,
+			resolvConf: testHostResolvConf,
+			pod:        newTestPod(v1.DNSDefault, false),
+			expected:   hostConfig,
+		},
+		"Default without resolver config disables lookups": {
+			clusterDNS: testClusterDNS,
+			pod:        newTestPod(v1.DNSDefault, false),
+			expected: &runtimeapi.DNSConfig{
+				Servers:  []string{"127.0.0.1"},
+				Searches: []string{"."},
+			},
+		},
+		"None": {
+			clusterDNS: testClusterDNS,
+			resolvConf: testHostResolvConf,
+			pod:        newTestPod(v1.DNSNone, false),
+			dnsConfig: &v1.PodDNSConfig{
+				Nameservers: []string{"1.1.1.1", "1.1.1.1"},
+				Searches:    []string{"custom.example.com"},
+				Options:     []v1.PodDNSConfigOption{{Name: "ndots", Value: &ndots}, {Name: "edns0"}},
+			},
+			expected: &runtimeapi.DNSConfig{
+				Servers:  []string{"1.1.1.1"},
+				Searches: []string{"custom.example.com"},
+				Options:  []string{"edns0", "ndots:3"},
+			},
+		},
+		"ClusterFirst merges dnsConfig": {
+			clusterDNS: testClusterDNS,
+			resolvConf: testHostResolvConf,
+			pod:        newTestPod(v1.DNSClusterFirst, false),
+			dnsConfig: &v1.PodDNSConfig{
+				Nameservers: []string{"1.1.1.1"},
+				Searches:    []string{"cluster.local", "custom.example.com"},
+				Options:     []v1.PodDNSConfigOption{{Name: "ndots", Value: &ndots}},
+			},
+			expected: &runtimeapi.DNSConfig{
+				Servers:  []string{"10.96.0.10", "1.1.1.1"},
+				Searches: append(append([]string{}, clusterSearches...), "custom.example.com"),
+				Options:  []string{"ndots:3"},
+			},
+		},
+	} {
+		t.Run(desc, func(t *testing.T) {
+			c, recorder := newTestConfigurer(t, test.clusterDNS, test.resolvConf)
+			test.pod.Spec.DNSConfig = test.dnsConfig
+			dnsConfig, err := c.GetPodDNS(test.pod)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(dnsConfig.Servers, test.expected.Servers) ||
+				!reflect.DeepEqual(dnsConfig.Searches, test.expected.Searches) ||
+				!reflect.DeepEqual(dnsConfig.Options, test.expected.Options) {
+				t.Errorf("expected %+v, got %+v", test.expected, dnsConfig)
+			}
+			expectEvents(t, events(recorder), test.expectedEvents...)
+		})
+	}
+}
+
+func TestGetPodDNSMissingResolvConf(t *testing.T) {
+	c, _ := newTestConfigurer(t, testClusterDNS, "")
+	c.ResolverConfig = filepath.Join(t.TempDir(), "missing")
+	if _, err := c.GetPodDNS(newTestPod(v1.DNSDefault, false)); err == nil {
+		t.Fatal("expected an error for a missing resolver config")
+	}
+}
+
+// expectEvents checks that the events start with the expected type and reason.
+func expectEvents(t *testing.T, events []string, expected ...string) {
+	t.Helper()
+	if len(events) != len(expected) {
+		t.Fatalf("expected events %v, got %v", expected, events)
+	}
+	for i, e := range expected {
+		if !strings.HasPrefix(events[i], e) {
+			t.Errorf("expected event %q to start with %q", events[i], e)
+		}
+	}
+}
+
+func TestFormDNSSearchFitsLimits(t *testing.T) {
+	longDomain := strings.Repeat("a", 254)
+	// Six domains of 50 characters make a search line of 305 characters.
+	var wideDomains []string
+	for i := 0; i < 6; i++ {
+		wideDomains = append(wideDomains, fmt.Sprintf("%d%s", i, strings.Repeat("b", 49)))
+	}
+
+	for desc, test := range map[string]struct {
+		searches []string
+		expected []string
+		exceeded bool
+	}{
+		"within limits": {
+			searches: []string{"a.com", "b.com"},
+			expected: []string{"a.com", "b.com"},
+		},
+		"too many search paths": {
+			searches: []string{"1.com", "2.com", "3.com", "4.com", "5.com", "6.com", "7.com"},
+			expected: []string{"1.com", "2.com", "3.com", "4.com", "5.com", "6.com"},
+			exceeded: true,
+		},
+		"search path too long": {
+			searches: []string{"a.com", longDomain, "b.com"},
+			expected: []string{"a.com", "b.com"},
+			exceeded: true,
+		},
+		"search line too long": {
+			searches: wideDomains,
+			expected: wideDomains[:5],
+			exceeded: true,
+		},
+	} {
+		t.Run(desc, func(t *testing.T) {
+			c, recorder := newTestConfigurer(t, testClusterDNS, "")
+			searches := c.formDNSSearchFitsLimits(append([]string{}, test.searches...), newTestPod(v1.DNSClusterFirst, false))
+			if !reflect.DeepEqual(searches, test.expected) {
+				t.Errorf("expected %v, got %v", test.expected, searches)
+			}
+			if test.exceeded {
+				expectEvents(t, events(recorder), "Warning DNSConfigForming Search Line limits were exceeded")
+			} else {
+				expectEvents(t, events(recorder))
+			}
+		})
+	}
+}
+
+func TestFormDNSNameserversFitsLimits(t *testing.T) {
+	c, recorder := newTestConfigurer(t, testClusterDNS, "")
+	pod := newTestPod(v1.DNSNone, false)
+
+	servers := c.formDNSNameserversFitsLimits([]string{"1.1.1.1", "2.2.2.2"}, pod)
+	if !reflect.DeepEqual(servers, []string{"1.1.1.1", "2.2.2.2"}) {
+		t.Errorf("expected the nameservers to be kept, got %v", servers)
+	}
+	expectEvents(t, events(recorder))
+
+	servers = c.formDNSNameserversFitsLimits([]string{"1.1.1.1", "2.2.2.2", "3.3.3.3", "4.4.4.4"}, pod)
+	if !reflect.DeepEqual(servers, []string{"1.1.1.1", "2.2.2.2", "3.3.3.3"}) {
+		t.Errorf("expected the first %d nameservers, got %v", MaxDNSNameservers, servers)
+	}
+	expectEvents(t, events(recorder), "Warning DNSConfigForming Nameserver limits were exceeded")
+}
+
+func TestGetPodDNSSearchLimits(t *testing.T) {
+	c, recorder := newTestConfigurer(t, testClusterDNS, testHostResolvConf)
+	pod := newTestPod(v1.DNSClusterFirst, false)
+	// The cluster and host searches already make five search paths.
+	pod.Spec.DNSConfig = &v1.PodDNSConfig{Searches: []string{"a.com", "b.com"}}
+
+	dnsConfig, err := c.GetPodDNS(pod)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(dnsConfig.Searches) != MaxDNSSearchPaths || dnsConfig.Searches[MaxDNSSearchPaths-1] != "a.com" {
+		t.Errorf("expected the search paths to be cut to %d, got %v", MaxDNSSearchPaths, dnsConfig.Searches)
+	}
+	expectEvents(t, events(recorder), "Warning DNSConfigForming Search Line limits were exceeded")
+}
+
+func TestCheckLimitsForResolvConf(t *testing.T) {
+	for desc, test := range map[string]struct {
+		resolvConf string
+		exceeded   bool
+	}{
+		"within limits": {
+			resolvConf: testHostResolvConf,
+		},
+		"too many search paths with the cluster domain": {
+			resolvConf: "search a.com b.com c.com d.com\n",
+			exceeded:   true,
+		},
+		"search path too long": {
+			resolvConf: "search " + strings.Repeat("a", 254) + "\n",
+			exceeded:   true,
+		},
+	} {
+		t.Run(desc, func(t *testing.T) {
+			c, recorder := newTestConfigurer(t, testClusterDNS, test.resolvConf)
+			c.CheckLimitsForResolvConf()
+			if test.exceeded {
+				expectEvents(t, events(recorder), "Warning CheckLimitsForResolvConf")
+			} else {
+				expectEvents(t, events(recorder))
+			}
+		})
+	}
+}
+
+func TestWriteResolvConf(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "resolv.conf")
+	dnsConfig := &runtimeapi.DNSConfig{
+		Servers:  []string{"10.96.0.10"},
+		Searches: []string{"ns.svc.cluster.local", "svc.cluster.local"},
+		Options:  []string{"ndots:5"},
+	}
+	if err := WriteResolvConf(path, dnsConfig); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "nameserver 10.96.0.10\nsearch ns.svc.cluster.local svc.cluster.local\noptions ndots:5\n"
+	if string(data) != expected {
+		t.Errorf("expected %q, got %q", expected, data)
+	}
+
+	// The settings are parsed back as written.
+	nameservers, searches, options, err := parseResolvConf(strings.NewReader(string(data)))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(nameservers, dnsConfig.Servers) || !reflect.DeepEqual(searches, dnsConfig.Searches) || !reflect.DeepEqual(options, dnsConfig.Options) {
+		t.Errorf("expected %+v, got %v %v %v", dnsConfig, nameservers, searches, options)
+	}
+}
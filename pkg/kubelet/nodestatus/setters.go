@@ -0,0 +1,150 @@
+package nodestatus
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/xuliangTang/mykubelet/pkg/kubelet/events"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/klog/v2"
+)
+
+// NodeCgroupsUnavailable means the kubelet can not enforce the resources of
+// containers, because the cgroups of the node can not be used.
+const NodeCgroupsUnavailable v1.NodeConditionType = "CgroupsUnavailable"
+
+// Setter modifies the node in-place, and returns an error if the modification failed.
+// Setters may partially mutate the node before returning an error.
+type Setter func(node *v1.Node) error
+
+// DaemonEndpoints returns a Setter that updates the daemon endpoints on the node.
+func DaemonEndpoints(daemonEndpoints *v1.NodeDaemonEndpoints) Setter {
+	return func(node *v1.Node) error {
+		node.Status.DaemonEndpoints = *daemonEndpoints
+		return nil
+	}
+}
+
+// ReadyCondition returns a Setter that updates the v1.NodeReady condition on the node.
+// The node is ready while the container runtime and its network are.
+func ReadyCondition(
+	nowFunc func() time.Time, // typically Kubelet.clock.Now
+	runtimeErrorsFunc func() error, // typically Kubelet.runtimeState.runtimeErrors
+	networkErrorsFunc func() error, // typically Kubelet.runtimeState.networkErrors
+	recordEventFunc func(eventType, event string), // typically Kubelet.recordNodeStatusEvent
+) Setter {
+	return func(node *v1.Node) error {
+		// NodeReady condition needs to be the last in the list of node conditions.
+		// This is due to an issue with version skewed kubelet and master components.
+		currentTime := metav1.NewTime(nowFunc())
+		newNodeReadyCondition := v1.NodeCondition{
+			Type:              v1.NodeReady,
+			Status:            v1.ConditionTrue,
+			Reason:            "KubeletReady",
+			Message:           "kubelet is posting ready status",
+			LastHeartbeatTime: currentTime,
+		}
+		errs := []error{runtimeErrorsFunc(), networkErrorsFunc()}
+		if aggregatedErr := errors.NewAggregate(errs); aggregatedErr != nil {
+			newNodeReadyCondition = v1.NodeCondition{
+				Type:              v1.NodeReady,
+				Status:            v1.ConditionFalse,
+				Reason:            "KubeletNotReady",
+				Message:           aggregatedErr.Error(),
+				LastHeartbeatTime: currentTime,
+			}
+		}
+
+		readyConditionUpdated := false
+		needToRecordEvent := false
+		for i := range node.Status.Conditions {
+			if node.Status.Conditions[i].Type == v1.NodeReady {
+				if node.Status.Conditions[i].Status == newNodeReadyCondition.Status {
+					newNodeReadyCondition.LastTransitionTime = node.Status.Conditions[i].LastTransitionTime
+				} else {
+					newNodeReadyCondition.LastTransitionTime = currentTime
+					needToRecordEvent = true
+				}
+				node.Status.Conditions[i] = newNodeReadyCondition
+				readyConditionUpdated = true
+				break
+			}
+		}
+		if !readyConditionUpdated {
+			newNodeReadyCondition.LastTransitionTime = currentTime
+			node.Status.Conditions = append(node.Status.Conditions, newNodeReadyCondition)
+		}
+		if needToRecordEvent {
+			if newNodeReadyCondition.Status == v1.ConditionTrue {
+				recordEventFunc(v1.EventTypeNormal, events.NodeReady)
+			} else {
+				recordEventFunc(v1.EventTypeNormal, events.NodeNotReady)
+				klog.InfoS("Node became not ready", "node", klog.KObj(node), "condition", newNodeReadyCondition)
+			}
+		}
+		return nil
+	}
+}
+
+// CgroupsCondition returns a Setter that updates the CgroupsUnavailable condition on the node.
+func CgroupsCondition(nowFunc func() time.Time, // typically Kubelet.clock.Now
+	cgroupsErrorFunc func() error, // typically Kubelet.containerManager.Status().SoftRequirements
+	recordEventFunc func(eventType, event string), // typically Kubelet.recordNodeStatusEvent
+) Setter {
+	return func(node *v1.Node) error {
+		currentTime := metav1.NewTime(nowFunc())
+		var condition *v1.NodeCondition
+
+		// Check if NodeCgroupsUnavailable condition already exists and if it does, just pick it up for update.
+		for i := range node.Status.Conditions {
+			if node.Status.Conditions[i].Type == NodeCgroupsUnavailable {
+				condition = &node.Status.Conditions[i]
+			}
+		}
+
+		newCondition := false
+		// If the NodeCgroupsUnavailable condition doesn't exist, create one
+		if condition == nil {
+			condition = &v1.NodeCondition{
+				Type:   NodeCgroupsUnavailable,
+				Status: v1.ConditionUnknown,
+			}
+			// cannot be appended to node.Status.Conditions here because it gets
+			// copied to the slice. So if we append to the slice here none of the
+			// updates we make below are reflected in the slice.
+			newCondition = true
+		}
+
+		// Update the heartbeat time
+		condition.LastHeartbeatTime = currentTime
+
+		// Note: The conditions below take care of the case when a new NodeCgroupsUnavailable condition is
+		// created and as well as the case when the condition already exists. When a new condition
+		// is created its status is set to v1.ConditionUnknown which matches either
+		// condition.Status != v1.ConditionTrue or
+		// condition.Status != v1.ConditionFalse in the conditions below depending on whether
+		// the cgroups are available or not.
+		if err := cgroupsErrorFunc(); err != nil {
+			if condition.Status != v1.ConditionTrue {
+				condition.Status = v1.ConditionTrue
+				condition.Reason = "KubeletHasNoCgroups"
+				condition.LastTransitionTime = currentTime
+				recordEventFunc(v1.EventTypeWarning, "NodeHasNoCgroups")
+			}
+			condition.Message = fmt.Sprintf("kubelet does not enforce container resources: %v", err)
+		} else if condition.Status != v1.ConditionFalse {
+			condition.Status = v1.ConditionFalse
+			condition.Reason = "KubeletHasCgroups"
+			condition.Message = "kubelet enforces container resources with cgroup v2"
+			condition.LastTransitionTime = currentTime
+			recordEventFunc(v1.EventTypeNormal, "NodeHasCgroups")
+		}
+
+		if newCondition {
+			node.Status.Conditions = append(node.Status.Conditions, *condition)
+		}
+		return nil
+	}
+}
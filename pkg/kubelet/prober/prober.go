@@ -7,11 +7,13 @@ import (
 	"net/http"
 	"net/url"
 	"strconv"
+	"strings"
 	"time"
 
 	kubecontainer "github.com/xuliangTang/mykubelet/pkg/kubelet/container"
 	"github.com/xuliangTang/mykubelet/pkg/kubelet/events"
 	"github.com/xuliangTang/mykubelet/pkg/kubelet/prober/results"
+	"github.com/xuliangTang/mykubelet/pkg/kubelet/util/format"
 	"github.com/xuliangTang/mykubelet/pkg/probe"
 	execprobe "github.com/xuliangTang/mykubelet/pkg/probe/exec"
 	httpprobe "github.com/xuliangTang/mykubelet/pkg/probe/http"
@@ -37,6 +39,9 @@ type prober struct {
 	startupHTTP   httpprobe.Prober
 	tcp           tcpprobe.Prober
 	runner        kubecontainer.CommandRunner
+	// sharesHostNetwork returns whether the containers of the pod run in
+	// the network namespace of the host.
+	sharesHostNetwork func(pod *v1.Pod) bool
 
 	recorder record.EventRecorder
 }
@@ -45,17 +50,19 @@ type prober struct {
 // several container info managers.
 func newProber(
 	runner kubecontainer.CommandRunner,
+	sharesHostNetwork func(pod *v1.Pod) bool,
 	recorder record.EventRecorder) *prober {
 
 	const followNonLocalRedirects = false
 	return &prober{
-		exec:          execprobe.New(),
-		readinessHTTP: httpprobe.New(followNonLocalRedirects),
-		livenessHTTP:  httpprobe.New(followNonLocalRedirects),
-		startupHTTP:   httpprobe.New(followNonLocalRedirects),
-		tcp:           tcpprobe.New(),
-		runner:        runner,
-		recorder:      recorder,
+		exec:              execprobe.New(),
+		readinessHTTP:     httpprobe.New(followNonLocalRedirects),
+		livenessHTTP:      httpprobe.New(followNonLocalRedirects),
+		startupHTTP:       httpprobe.New(followNonLocalRedirects),
+		tcp:               tcpprobe.New(),
+		runner:            runner,
+		sharesHostNetwork: sharesHostNetwork,
+		recorder:          recorder,
 	}
 }
 
@@ -134,9 +141,68 @@ func buildHeader(headerList []v1.HTTPHeader) http.Header {
 	return headers
 }
 
-// 不支持
 func (pb *prober) runProbe(probeType probeType, p *v1.Probe, pod *v1.Pod, status v1.PodStatus, container v1.Container, containerID kubecontainer.ContainerID) (probe.Result, string, error) {
-	return probe.Result(""), "", nil
+	timeout := time.Duration(p.TimeoutSeconds) * time.Second
+	if p.Exec != nil {
+		klog.V(4).InfoS("Exec-Probe runProbe", "pod", klog.KObj(pod), "containerName", container.Name, "execCommand", p.Exec.Command)
+		command := kubecontainer.ExpandContainerCommandOnlyStatic(p.Exec.Command, container.Env)
+		return pb.exec.Probe(pb.newExecInContainer(container, containerID, command, timeout))
+	}
+	if p.HTTPGet != nil {
+		scheme := strings.ToLower(string(p.HTTPGet.Scheme))
+		host := p.HTTPGet.Host
+		if host == "" {
+			host = pb.podHost(pod, status)
+		}
+		port, err := extractPort(p.HTTPGet.Port, container)
+		if err != nil {
+			return probe.Unknown, "", err
+		}
+		path := p.HTTPGet.Path
+		klog.V(4).InfoS("HTTP-Probe Host", "scheme", scheme, "host", host, "port", port, "path", path)
+		url := formatURL(scheme, host, port, path)
+		headers := buildHeader(p.HTTPGet.HTTPHeaders)
+		klog.V(4).InfoS("HTTP-Probe Headers", "headers", headers)
+		switch probeType {
+		case liveness:
+			return pb.livenessHTTP.Probe(url, headers, timeout)
+		case startup:
+			return pb.startupHTTP.Probe(url, headers, timeout)
+		default:
+			return pb.readinessHTTP.Probe(url, headers, timeout)
+		}
+	}
+	if p.TCPSocket != nil {
+		port, err := extractPort(p.TCPSocket.Port, container)
+		if err != nil {
+			return probe.Unknown, "", err
+		}
+		host := p.TCPSocket.Host
+		if host == "" {
+			host = pb.podHost(pod, status)
+		}
+		klog.V(4).InfoS("TCP-Probe Host", "host", host, "port", port, "timeout", timeout)
+		return pb.tcp.Probe(host, port, timeout)
+	}
+
+	klog.InfoS("Failed to find probe builder for container", "containerName", container.Name)
+	return probe.Unknown, "", fmt.Errorf("missing probe handler for %s:%s", format.Pod(pod), container.Name)
+}
+
+// podHost returns the address probes without a host connect to: the IP of
+// the pod. The IP of a pod sharing the network of the host is the IP of the
+// node, or the loopback address while neither is known.
+func (pb *prober) podHost(pod *v1.Pod, status v1.PodStatus) string {
+	if status.PodIP != "" {
+		return status.PodIP
+	}
+	if pb.sharesHostNetwork == nil || !pb.sharesHostNetwork(pod) {
+		return ""
+	}
+	if status.HostIP != "" {
+		return status.HostIP
+	}
+	return "127.0.0.1"
 }
 
 func extractPort(param intstr.IntOrString, container v1.Container) (int, error) {
@@ -72,9 +72,10 @@ func NewManager(
 	readinessManager results.Manager,
 	startupManager results.Manager,
 	runner kubecontainer.CommandRunner,
+	sharesHostNetwork func(pod *v1.Pod) bool,
 	recorder record.EventRecorder) Manager {
 
-	prober := newProber(runner, recorder)
+	prober := newProber(runner, sharesHostNetwork, recorder)
 	return &manager{
 		statusManager:    statusManager,
 		prober:           prober,
@@ -0,0 +1,331 @@
+package prober
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+
+	kubecontainer "github.com/xuliangTang/mykubelet/pkg/kubelet/container"
+	"github.com/xuliangTang/mykubelet/pkg/kubelet/prober/results"
+	"github.com/xuliangTang/mykubelet/pkg/probe"
+	execprobe "github.com/xuliangTang/mykubelet/pkg/probe/exec"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/utils/exec"
+)
+
+var testContainerID = kubecontainer.ContainerID{Type: "process", ID: "id"}
+
+type fakeRunner struct {
+	id      kubecontainer.ContainerID
+	cmd     []string
+	timeout time.Duration
+	output  []byte
+	err     error
+}
+
+func (r *fakeRunner) RunInContainer(id kubecontainer.ContainerID, cmd []string, timeout time.Duration) ([]byte, error) {
+	r.id, r.cmd, r.timeout = id, cmd, timeout
+	return r.output, r.err
+}
+
+func newTestProber(runner kubecontainer.CommandRunner, sharesHostNetwork bool) *prober {
+	return newProber(runner, func(*v1.Pod) bool { return sharesHostNetwork }, record.NewFakeRecorder(10))
+}
+
+// listenerPort returns the port the listener listens on.
+func listenerPort(t *testing.T, addr net.Addr) int {
+	t.Helper()
+	_, port, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := strconv.Atoi(port)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func TestRunExecProbe(t *testing.T) {
+	for desc, test := range map[string]struct {
+		output         string
+		err            error
+		expectedResult probe.Result
+		expectedOutput string
+		expectError    bool
+	}{
+		"success": {
+			output:         "ok",
+			expectedResult: probe.Success,
+			expectedOutput: "ok",
+		},
+		"non-zero exit code": {
+			output:         "not ready",
+			err:            exec.CodeExitError{Err: errors.New("exit status 1"), Code: 1},
+			expectedResult: probe.Failure,
+			expectedOutput: "not ready",
+		},
+		"timeout": {
+			err:            execprobe.NewTimeoutError(errors.New("command timed out"), time.Second),
+			expectedResult: probe.Failure,
+			expectedOutput: "command timed out",
+		},
+		"runner error": {
+			err:            errors.New("container not found"),
+			expectedResult: probe.Unknown,
+			expectError:    true,
+		},
+	} {
+		t.Run(desc, func(t *testing.T) {
+			runner := &fakeRunner{output: []byte(test.output), err: test.err}
+			pb := newTestProber(runner, false)
+			container := v1.Container{Name: "c", Env: []v1.EnvVar{{Name: "FILE", Value: "/tmp/ready"}}}
+			p := &v1.Probe{
+				ProbeHandler:   v1.ProbeHandler{Exec: &v1.ExecAction{Command: []string{"cat", "$(FILE)"}}},
+				TimeoutSeconds: 3,
+			}
+
+			result, output, err := pb.runProbe(readiness, p, &v1.Pod{}, v1.PodStatus{}, container, testContainerID)
+			if test.expectError != (err != nil) {
+				t.Fatalf("expected error %v, got %v", test.expectError, err)
+			}
+			if result != test.expectedResult || output != test.expectedOutput {
+				t.Errorf("expected %q %q, got %q %q", test.expectedResult, test.expectedOutput, result, output)
+			}
+			if runner.id != testContainerID || !reflect.DeepEqual(runner.cmd, []string{"cat", "/tmp/ready"}) || runner.timeout != 3*time.Second {
+				t.Errorf("unexpected command %v in %v with timeout %v", runner.cmd, runner.id, runner.timeout)
+			}
+		})
+	}
+}
+
+func TestRunHTTPProbe(t *testing.T) {
+	var header http.Header
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header = r.Header
+		switch r.URL.Path {
+		case "/healthz":
+			w.Write([]byte("ok"))
+		default:
+			http.Error(w, "unhealthy", http.StatusInternalServerError)
+		}
+	}))
+	defer server.Close()
+	port := listenerPort(t, server.Listener.Addr())
+
+	for desc, test := range map[string]struct {
+		host              string
+		path              string
+		port              intstr.IntOrString
+		status            v1.PodStatus
+		sharesHostNetwork bool
+		expectedResult    probe.Result
+	}{
+		"pod IP": {
+			path:           "/healthz",
+			port:           intstr.FromInt(port),
+			status:         v1.PodStatus{PodIP: "127.0.0.1"},
+			expectedResult: probe.Success,
+		},
+		"named port": {
+			path:           "/healthz",
+			port:           intstr.FromString("http"),
+			status:         v1.PodStatus{PodIP: "127.0.0.1"},
+			expectedResult: probe.Success,
+		},
+		"explicit host": {
+			host:           "127.0.0.1",
+			path:           "/healthz",
+			port:           intstr.FromInt(port),
+			status:         v1.PodStatus{PodIP: "192.0.2.1"},
+			expectedResult: probe.Success,
+		},
+		"host network pod on the node IP": {
+			path:              "/healthz",
+			port:              intstr.FromInt(port),
+			status:            v1.PodStatus{HostIP: "127.0.0.1"},
+			sharesHostNetwork: true,
+			expectedResult:    probe.Success,
+		},
+		"host network pod without IPs on loopback": {
+			path:              "/healthz",
+			port:              intstr.FromInt(port),
+			sharesHostNetwork: true,
+			expectedResult:    probe.Success,
+		},
+		"server error": {
+			path:           "/broken",
+			port:           intstr.FromInt(port),
+			status:         v1.PodStatus{PodIP: "127.0.0.1"},
+			expectedResult: probe.Failure,
+		},
+	} {
+		t.Run(desc, func(t *testing.T) {
+			header = nil
+			pb := newTestProber(&fakeRunner{}, test.sharesHostNetwork)
+			container := v1.Container{Name: "c", Ports: []v1.ContainerPort{{Name: "http", ContainerPort: int32(port)}}}
+			p := &v1.Probe{
+				ProbeHandler: v1.ProbeHandler{HTTPGet: &v1.HTTPGetAction{
+					Host:        test.host,
+					Path:        test.path,
+					Port:        test.port,
+					Scheme:      v1.URISchemeHTTP,
+					HTTPHeaders: []v1.HTTPHeader{{Name: "X-Probe", Value: "readiness"}},
+				}},
+				TimeoutSeconds: 1,
+			}
+
+			result, output, err := pb.runProbe(readiness, p, &v1.Pod{}, test.status, container, testContainerID)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if result != test.expectedResult {
+				t.Errorf("expected %q, got %q: %s", test.expectedResult, result, output)
+			}
+			if header.Get("X-Probe") != "readiness" {
+				t.Errorf("expected the probe headers to be sent, got %v", header)
+			}
+		})
+	}
+}
+
+func TestRunHTTPProbeInvalidPort(t *testing.T) {
+	pb := newTestProber(&fakeRunner{}, false)
+	p := &v1.Probe{ProbeHandler: v1.ProbeHandler{HTTPGet: &v1.HTTPGetAction{Port: intstr.FromString("missing")}}}
+	result, _, err := pb.runProbe(readiness, p, &v1.Pod{}, v1.PodStatus{PodIP: "127.0.0.1"}, v1.Container{Name: "c"}, testContainerID)
+	if err == nil || result != probe.Unknown {
+		t.Fatalf("expected an unknown result with an error, got %q, %v", result, err)
+	}
+}
+
+func TestRunTCPProbe(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			conn.Close()
+		}
+	}()
+	port := listenerPort(t, l.Addr())
+
+	closed, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	closedPort := listenerPort(t, closed.Addr())
+	closed.Close()
+
+	for desc, test := range map[string]struct {
+		port              intstr.IntOrString
+		status            v1.PodStatus
+		sharesHostNetwork bool
+		expectedResult    probe.Result
+	}{
+		"pod IP": {
+			port:           intstr.FromInt(port),
+			status:         v1.PodStatus{PodIP: "127.0.0.1"},
+			expectedResult: probe.Success,
+		},
+		"named port": {
+			port:           intstr.FromString("tcp"),
+			status:         v1.PodStatus{PodIP: "127.0.0.1"},
+			expectedResult: probe.Success,
+		},
+		"host network pod without IPs on loopback": {
+			port:              intstr.FromInt(port),
+			sharesHostNetwork: true,
+			expectedResult:    probe.Success,
+		},
+		"closed port": {
+			port:           intstr.FromInt(closedPort),
+			status:         v1.PodStatus{PodIP: "127.0.0.1"},
+			expectedResult: probe.Failure,
+		},
+	} {
+		t.Run(desc, func(t *testing.T) {
+			pb := newTestProber(&fakeRunner{}, test.sharesHostNetwork)
+			container := v1.Container{Name: "c", Ports: []v1.ContainerPort{{Name: "tcp", ContainerPort: int32(port)}}}
+			p := &v1.Probe{
+				ProbeHandler:   v1.ProbeHandler{TCPSocket: &v1.TCPSocketAction{Port: test.port}},
+				TimeoutSeconds: 1,
+			}
+			result, output, err := pb.runProbe(liveness, p, &v1.Pod{}, test.status, container, testContainerID)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if result != test.expectedResult {
+				t.Errorf("expected %q, got %q: %s", test.expectedResult, result, output)
+			}
+		})
+	}
+}
+
+func TestPodHost(t *testing.T) {
+	for desc, test := range map[string]struct {
+		status            v1.PodStatus
+		sharesHostNetwork bool
+		expected          string
+	}{
+		"pod IP":                            {status: v1.PodStatus{PodIP: "10.1.0.5", HostIP: "192.168.0.2"}, expected: "10.1.0.5"},
+		"pod without IP":                    {status: v1.PodStatus{HostIP: "192.168.0.2"}},
+		"host network pod without pod IP":   {status: v1.PodStatus{HostIP: "192.168.0.2"}, sharesHostNetwork: true, expected: "192.168.0.2"},
+		"host network pod without any IP":   {sharesHostNetwork: true, expected: "127.0.0.1"},
+		"host network pod with the node IP": {status: v1.PodStatus{PodIP: "192.168.0.2"}, sharesHostNetwork: true, expected: "192.168.0.2"},
+	} {
+		t.Run(desc, func(t *testing.T) {
+			pb := newTestProber(&fakeRunner{}, test.sharesHostNetwork)
+			if host := pb.podHost(&v1.Pod{}, test.status); host != test.expected {
+				t.Errorf("expected %q, got %q", test.expected, host)
+			}
+		})
+	}
+}
+
+func TestProbe(t *testing.T) {
+	for desc, test := range map[string]struct {
+		probe    *v1.Probe
+		output   string
+		err      error
+		expected results.Result
+	}{
+		"no probe": {
+			expected: results.Success,
+		},
+		"success": {
+			probe:    &v1.Probe{ProbeHandler: v1.ProbeHandler{Exec: &v1.ExecAction{Command: []string{"true"}}}},
+			expected: results.Success,
+		},
+		"failure": {
+			probe:    &v1.Probe{ProbeHandler: v1.ProbeHandler{Exec: &v1.ExecAction{Command: []string{"false"}}}},
+			err:      exec.CodeExitError{Err: errors.New("exit status 1"), Code: 1},
+			expected: results.Failure,
+		},
+		"no handler": {
+			probe:    &v1.Probe{},
+			expected: results.Failure,
+		},
+	} {
+		t.Run(desc, func(t *testing.T) {
+			pb := newTestProber(&fakeRunner{output: []byte(test.output), err: test.err}, false)
+			container := v1.Container{Name: "c", LivenessProbe: test.probe}
+			result, _ := pb.probe(liveness, &v1.Pod{}, v1.PodStatus{}, container, testContainerID)
+			if result != test.expected {
+				t.Errorf("expected %v, got %v", test.expected, result)
+			}
+		})
+	}
+}
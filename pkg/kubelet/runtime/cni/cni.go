@@ -0,0 +1,431 @@
+// Package cni sets up the network of pod sandboxes with CNI plugins. The
+// plugins are found in bin dirs and run with the exec protocol of the CNI
+// specification, for the first network configuration of the conf dir:
+//
+//	<confDir>/*.conflist  a network configuration list
+//	<confDir>/*.conf      a single plugin configuration
+//	<confDir>/*.json      a single plugin configuration
+//
+// The result of every ADD is cached below the cache dir, along with the
+// configuration it was set up with, for CHECK and DEL.
+package cni
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/klog/v2"
+)
+
+const (
+	// DefaultConfDir is the directory the network configurations are read from by default.
+	DefaultConfDir = "/etc/cni/net.d"
+	// DefaultBinDir is the directory the plugins are found in by default.
+	DefaultBinDir = "/opt/cni/bin"
+
+	// The name of the interface of the pod
+	defaultInterfaceName = "eth0"
+
+	// The capability of plugins taking the pod CIDRs of the node as the
+	// ranges to allocate IPs from
+	ipRangesCapability = "ipRanges"
+	// The capability of plugins taking the IPs the pod asks for
+	ipsCapability = "ips"
+
+	resultsDirName = "results"
+)
+
+// PodNetwork is the pod sandbox a network is set up for.
+type PodNetwork struct {
+	Name      string
+	Namespace string
+	UID       types.UID
+	// SandboxID is the CNI container id.
+	SandboxID string
+	// NetNS is the path of the network namespace of the sandbox, it may be
+	// empty on teardown once the namespace is gone.
+	NetNS string
+	// PodCIDRs are passed to plugins with the ipRanges capability.
+	PodCIDRs []string
+	// IPs are the IPs allocated to the sandbox by the kubelet, in CIDR
+	// notation. They are passed to plugins with the ips capability.
+	IPs []string
+}
+
+// cachedResult is what is cached for a sandbox whose network was added.
+type cachedResult struct {
+	ContainerID string          `json:"containerId"`
+	IfName      string          `json:"ifName"`
+	Config      []byte          `json:"config"`
+	Result      json.RawMessage `json:"result,omitempty"`
+}
+
+// Plugin runs the CNI plugins of the network configured in the conf dir.
+type Plugin struct {
+	confDir  string
+	binDirs  []string
+	cacheDir string
+
+	// lock protects network.
+	lock sync.RWMutex
+	// network is the configuration of the network new pods are added to,
+	// nil until a valid configuration is found in confDir.
+	network *networkConfigList
+}
+
+// NewPlugin creates a plugin running the network configured in confDir with
+// the plugins found in binDirs. ADD results are cached below cacheDir.
+func NewPlugin(confDir string, binDirs []string, cacheDir string) (*Plugin, error) {
+	if err := os.MkdirAll(filepath.Join(cacheDir, resultsDirName), 0700); err != nil {
+		return nil, fmt.Errorf("failed to create %q: %v", cacheDir, err)
+	}
+	p := &Plugin{
+		confDir:  confDir,
+		binDirs:  binDirs,
+		cacheDir: cacheDir,
+	}
+	if err := p.syncNetworkConfig(); err != nil {
+		klog.InfoS("No network configuration found yet", "confDir", confDir, "err", err)
+	}
+	return p, nil
+}
+
+// Status reloads the network configuration, and returns an error if no
+// valid configuration is found. Pods are only added to a network once it
+// is configured.
+func (p *Plugin) Status() error {
+	return p.syncNetworkConfig()
+}
+
+// NetworkName returns the name of the configured network, empty if none is.
+func (p *Plugin) NetworkName() string {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+	if p.network == nil {
+		return ""
+	}
+	return p.network.Name
+}
+
+func (p *Plugin) syncNetworkConfig() error {
+	network, err := loadDefaultNetwork(p.confDir)
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	if err != nil {
+		p.network = nil
+		return err
+	}
+	if p.network == nil || p.network.Name != network.Name {
+		klog.InfoS("Using CNI network configuration", "network", network.Name, "confDir", p.confDir)
+	}
+	p.network = network
+	return nil
+}
+
+// loadDefaultNetwork loads the first valid network configuration of
+// confDir in lexicographic order.
+func loadDefaultNetwork(confDir string) (*networkConfigList, error) {
+	entries, err := os.ReadDir(confDir)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to read the cni config dir %q: %v", confDir, err)
+	}
+	var files []string
+	for _, entry := range entries {
+		switch filepath.Ext(entry.Name()) {
+		case ".conf", ".conflist", ".json":
+			if !entry.IsDir() {
+				files = append(files, filepath.Join(confDir, entry.Name()))
+			}
+		}
+	}
+	sort.Strings(files)
+	for _, file := range files {
+		network, err := loadNetworkConfig(file)
+		if err != nil {
+			klog.InfoS("Skipping invalid CNI config file", "path", file, "err", err)
+			continue
+		}
+		return network, nil
+	}
+	return nil, fmt.Errorf("no valid networks found in %s", confDir)
+}
+
+func loadNetworkConfig(path string) (*networkConfigList, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if filepath.Ext(path) != ".conflist" {
+		// A single plugin, wrapped into a list.
+		var raw map[string]interface{}
+		if err := json.Unmarshal(data, &raw); err != nil {
+			return nil, err
+		}
+		name, _ := raw["name"].(string)
+		version, _ := raw["cniVersion"].(string)
+		if data, err = json.Marshal(map[string]interface{}{
+			"name":       name,
+			"cniVersion": version,
+			"plugins":    []interface{}{raw},
+		}); err != nil {
+			return nil, err
+		}
+	}
+	return parseNetworkConfigList(data)
+}
+
+func parseNetworkConfigList(data []byte) (*networkConfigList, error) {
+	var list struct {
+		networkConfigList
+		Plugins []map[string]interface{} `json:"plugins"`
+	}
+	if err := json.Unmarshal(data, &list); err != nil {
+		return nil, err
+	}
+	network := list.networkConfigList
+	if network.Name == "" {
+		return nil, fmt.Errorf("network has no name")
+	}
+	if len(list.Plugins) == 0 {
+		return nil, fmt.Errorf("network %q has no plugins", network.Name)
+	}
+	for i, raw := range list.Plugins {
+		plugin := &pluginConfig{raw: raw}
+		plugin.Type, _ = raw["type"].(string)
+		if plugin.Type == "" {
+			return nil, fmt.Errorf("plugin %d of network %q has no type", i, network.Name)
+		}
+		if capabilities, ok := raw["capabilities"].(map[string]interface{}); ok {
+			plugin.Capabilities = make(map[string]bool)
+			for name, enabled := range capabilities {
+				plugin.Capabilities[name], _ = enabled.(bool)
+			}
+		}
+		network.Plugins = append(network.Plugins, plugin)
+	}
+	network.Bytes = data
+	return &network, nil
+}
+
+// SetUpPod adds the sandbox to the network, running ADD for every plugin
+// of the list in order. The result of the last plugin is cached and
+// returned.
+func (p *Plugin) SetUpPod(ctx context.Context, pod PodNetwork) (*Result, error) {
+	p.lock.RLock()
+	network := p.network
+	p.lock.RUnlock()
+	if network == nil {
+		return nil, fmt.Errorf("cni config uninitialized")
+	}
+
+	// The configuration is cached before ADD, so that a sandbox whose ADD
+	// failed half way is still torn down with it.
+	if err := p.cacheResult(pod.SandboxID, network.Bytes, nil); err != nil {
+		return nil, err
+	}
+	var prevResult []byte
+	for _, plugin := range network.Plugins {
+		out, err := p.execPlugin(ctx, "ADD", network, plugin, pod, prevResult)
+		if err != nil {
+			return nil, fmt.Errorf("plugin type=%q name=%q failed (add): %v", plugin.Type, network.Name, err)
+		}
+		prevResult = out
+	}
+	result, err := parseResult(prevResult)
+	if err != nil {
+		return nil, err
+	}
+	if err := p.cacheResult(pod.SandboxID, network.Bytes, prevResult); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// TearDownPod removes the sandbox from the network it was added to,
+// running DEL for every plugin of the list in reverse order. It is a no-op
+// for sandboxes that were never added.
+func (p *Plugin) TearDownPod(ctx context.Context, pod PodNetwork) error {
+	cached, err := p.loadResult(pod.SandboxID)
+	if err != nil {
+		return err
+	}
+	if cached == nil {
+		return nil
+	}
+	network, err := parseNetworkConfigList(cached.Config)
+	if err != nil {
+		return fmt.Errorf("failed to parse the cached network config of %q: %v", pod.SandboxID, err)
+	}
+	var prevResult []byte
+	if len(cached.Result) != 0 && versionAtLeast(network.CNIVersion, 0, 4) {
+		prevResult = cached.Result
+	}
+	for i := len(network.Plugins) - 1; i >= 0; i-- {
+		plugin := network.Plugins[i]
+		if _, err := p.execPlugin(ctx, "DEL", network, plugin, pod, prevResult); err != nil {
+			return fmt.Errorf("plugin type=%q name=%q failed (delete): %v", plugin.Type, network.Name, err)
+		}
+	}
+	if err := os.Remove(p.resultPath(pod.SandboxID)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// CheckPod checks that the network of the sandbox is still as it was set
+// up, running CHECK for every plugin of the list in order. Networks before
+// CNI 0.4.0, and those with checks disabled, are not checked.
+func (p *Plugin) CheckPod(ctx context.Context, pod PodNetwork) error {
+	cached, err := p.loadResult(pod.SandboxID)
+	if err != nil {
+		return err
+	}
+	if cached == nil || len(cached.Result) == 0 {
+		return fmt.Errorf("no cached result for %q", pod.SandboxID)
+	}
+	network, err := parseNetworkConfigList(cached.Config)
+	if err != nil {
+		return fmt.Errorf("failed to parse the cached network config of %q: %v", pod.SandboxID, err)
+	}
+	if network.DisableCheck || !versionAtLeast(network.CNIVersion, 0, 4) {
+		return nil
+	}
+	for _, plugin := range network.Plugins {
+		if _, err := p.execPlugin(ctx, "CHECK", network, plugin, pod, cached.Result); err != nil {
+			return fmt.Errorf("plugin type=%q name=%q failed (check): %v", plugin.Type, network.Name, err)
+		}
+	}
+	return nil
+}
+
+// pluginStdin returns the configuration a plugin is run with: the plugin
+// configuration, with the name and version of the network, the result of
+// the previous plugin and the runtime config of its capabilities.
+func pluginStdin(network *networkConfigList, plugin *pluginConfig, pod PodNetwork, prevResult []byte) ([]byte, error) {
+	conf := make(map[string]interface{}, len(plugin.raw)+3)
+	for k, v := range plugin.raw {
+		conf[k] = v
+	}
+	conf["name"] = network.Name
+	conf["cniVersion"] = network.CNIVersion
+	if len(prevResult) != 0 {
+		conf["prevResult"] = json.RawMessage(prevResult)
+	}
+	runtimeConfig := map[string]interface{}{}
+	if plugin.Capabilities[ipRangesCapability] && len(pod.PodCIDRs) != 0 {
+		var ranges [][]map[string]string
+		for _, cidr := range pod.PodCIDRs {
+			ranges = append(ranges, []map[string]string{{"subnet": cidr}})
+		}
+		runtimeConfig[ipRangesCapability] = ranges
+	}
+	if plugin.Capabilities[ipsCapability] && len(pod.IPs) != 0 {
+		runtimeConfig[ipsCapability] = pod.IPs
+	}
+	if len(runtimeConfig) != 0 {
+		conf["runtimeConfig"] = runtimeConfig
+	}
+	return json.Marshal(conf)
+}
+
+// execPlugin runs command for the plugin, and returns what it printed.
+func (p *Plugin) execPlugin(ctx context.Context, command string, network *networkConfigList, plugin *pluginConfig, pod PodNetwork, prevResult []byte) ([]byte, error) {
+	path, err := p.findPlugin(plugin.Type)
+	if err != nil {
+		return nil, err
+	}
+	stdin, err := pluginStdin(network, plugin, pod, prevResult)
+	if err != nil {
+		return nil, err
+	}
+
+	env := []string{
+		"CNI_COMMAND=" + command,
+		"CNI_CONTAINERID=" + pod.SandboxID,
+		"CNI_NETNS=" + pod.NetNS,
+		"CNI_IFNAME=" + defaultInterfaceName,
+		"CNI_PATH=" + strings.Join(p.binDirs, string(os.PathListSeparator)),
+		fmt.Sprintf("CNI_ARGS=IgnoreUnknown=1;K8S_POD_NAMESPACE=%s;K8S_POD_NAME=%s;K8S_POD_INFRA_CONTAINER_ID=%s;K8S_POD_UID=%s",
+			pod.Namespace, pod.Name, pod.SandboxID, pod.UID),
+	}
+	for _, e := range os.Environ() {
+		if !strings.HasPrefix(e, "CNI_") {
+			env = append(env, e)
+		}
+	}
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, path)
+	cmd.Env = env
+	cmd.Stdin = bytes.NewReader(stdin)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	klog.V(4).InfoS("Running CNI plugin", "command", command, "plugin", path, "podSandboxID", pod.SandboxID)
+	if err := cmd.Run(); err != nil {
+		pluginErr := &Error{}
+		if jsonErr := json.Unmarshal(stdout.Bytes(), pluginErr); jsonErr == nil && pluginErr.Msg != "" {
+			return nil, pluginErr
+		}
+		return nil, fmt.Errorf("netplugin failed with no error message: %v, stderr: %q", err, stderr.String())
+	}
+	return stdout.Bytes(), nil
+}
+
+// findPlugin returns the path of the plugin of the given type in the bin dirs.
+func (p *Plugin) findPlugin(pluginType string) (string, error) {
+	for _, dir := range p.binDirs {
+		path := filepath.Join(dir, pluginType)
+		if info, err := os.Stat(path); err == nil && info.Mode().IsRegular() {
+			return path, nil
+		}
+	}
+	return "", fmt.Errorf("failed to find plugin %q in path %s", pluginType, p.binDirs)
+}
+
+func (p *Plugin) resultPath(sandboxID string) string {
+	return filepath.Join(p.cacheDir, resultsDirName, sandboxID)
+}
+
+// cacheResult atomically writes the configuration and the result of the
+// network of the sandbox.
+func (p *Plugin) cacheResult(sandboxID string, config, result []byte) error {
+	data, err := json.Marshal(cachedResult{
+		ContainerID: sandboxID,
+		IfName:      defaultInterfaceName,
+		Config:      config,
+		Result:      result,
+	})
+	if err != nil {
+		return err
+	}
+	path := p.resultPath(sandboxID)
+	tmp := filepath.Join(filepath.Dir(path), "."+sandboxID)
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return fmt.Errorf("failed to cache the network result of %q: %v", sandboxID, err)
+	}
+	return os.Rename(tmp, path)
+}
+
+// loadResult reads the cached network of the sandbox, nil if there is none.
+func (p *Plugin) loadResult(sandboxID string) (*cachedResult, error) {
+	data, err := os.ReadFile(p.resultPath(sandboxID))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	cached := &cachedResult{}
+	if err := json.Unmarshal(data, cached); err != nil {
+		return nil, fmt.Errorf("failed to decode the cached network result of %q: %v", sandboxID, err)
+	}
+	return cached, nil
+}
@@ -0,0 +1,479 @@
+package cni
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// stubPlugin is a shell script standing in for the plugins of a network. It
+// records every call in the calls dir, and prints the output set for its
+// type and command.
+const stubPlugin = `#!/bin/sh
+plugin=$(basename "$0")
+n=$(( $(ls "$STUB_DIR/calls" | wc -l) / 2 ))
+call=$(printf '%s/calls/%03d-%s-%s' "$STUB_DIR" "$n" "$plugin" "$CNI_COMMAND")
+cat > "$call.stdin"
+env | grep '^CNI_' > "$call.env"
+out="$STUB_DIR/$plugin-$CNI_COMMAND"
+if [ -f "$out.stdout" ]; then cat "$out.stdout"; fi
+if [ -f "$out.stderr" ]; then cat "$out.stderr" >&2; fi
+if [ -f "$out.exit" ]; then exit "$(cat "$out.exit")"; fi
+exit 0
+`
+
+const (
+	testSandboxID = "sandbox"
+	resultA       = `{"cniVersion":"%s","interfaces":[{"name":"cni0"}],"ips":[{"interface":0,"address":"10.1.0.1/24"}]}`
+	resultB       = `{"cniVersion":"%s","interfaces":[{"name":"cni0"},{"name":"eth0","sandbox":"/proc/1/ns/net"}],"ips":[{"interface":1,"address":"10.1.0.5/24","gateway":"10.1.0.1"}]}`
+)
+
+type stubCall struct {
+	plugin  string
+	command string
+	stdin   map[string]interface{}
+	env     map[string]string
+}
+
+type stub struct {
+	t       *testing.T
+	dir     string
+	confDir string
+}
+
+// newTestPlugin returns a Plugin running the stub plugins stub-a and stub-b.
+func newTestPlugin(t *testing.T) (*Plugin, *stub) {
+	t.Helper()
+	dir := t.TempDir()
+	s := &stub{t: t, dir: dir, confDir: filepath.Join(dir, "net.d")}
+	binDir := filepath.Join(dir, "bin")
+	for _, d := range []string{s.confDir, binDir, filepath.Join(dir, "calls")} {
+		if err := os.MkdirAll(d, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, name := range []string{"stub-a", "stub-b"} {
+		if err := os.WriteFile(filepath.Join(binDir, name), []byte(stubPlugin), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Setenv("STUB_DIR", dir)
+
+	p, err := NewPlugin(s.confDir, []string{filepath.Join(dir, "missing"), binDir}, filepath.Join(dir, "cache"))
+	if err != nil {
+		t.Fatalf("failed to create plugin: %v", err)
+	}
+	return p, s
+}
+
+// writeConf writes a network of stub-a and stub-b in the given CNI version,
+// and reloads it.
+func (s *stub) writeConf(p *Plugin, name, version string, extra string) {
+	s.t.Helper()
+	conf := fmt.Sprintf(`{"name":%q,"cniVersion":%q%s,"plugins":[
+		{"type":"stub-a","foo":"bar","capabilities":{"ipRanges":true,"ips":true}},
+		{"type":"stub-b"}]}`, name, version, extra)
+	if err := os.WriteFile(filepath.Join(s.confDir, "10-net.conflist"), []byte(conf), 0644); err != nil {
+		s.t.Fatal(err)
+	}
+	if err := p.Status(); err != nil {
+		s.t.Fatalf("unexpected status error: %v", err)
+	}
+}
+
+// setOutput sets what the plugin prints to stdout and stderr, and its exit
+// code, for the command.
+func (s *stub) setOutput(plugin, command, stdout, stderr string, exitCode int) {
+	s.t.Helper()
+	base := filepath.Join(s.dir, plugin+"-"+command)
+	for ext, content := range map[string]string{".stdout": stdout, ".stderr": stderr, ".exit": fmt.Sprint(exitCode)} {
+		if err := os.WriteFile(base+ext, []byte(content), 0644); err != nil {
+			s.t.Fatal(err)
+		}
+	}
+}
+
+// calls returns the calls recorded since the last one, and forgets them.
+func (s *stub) calls() []stubCall {
+	s.t.Helper()
+	callsDir := filepath.Join(s.dir, "calls")
+	entries, err := os.ReadDir(callsDir)
+	if err != nil {
+		s.t.Fatal(err)
+	}
+	var names []string
+	for _, e := range entries {
+		if strings.HasSuffix(e.Name(), ".stdin") {
+			names = append(names, strings.TrimSuffix(e.Name(), ".stdin"))
+		}
+	}
+	sort.Strings(names)
+
+	var calls []stubCall
+	for _, name := range names {
+		parts := strings.SplitN(name, "-", 2)
+		i := strings.LastIndex(parts[1], "-")
+		call := stubCall{plugin: parts[1][:i], command: parts[1][i+1:], env: map[string]string{}}
+		stdin, err := os.ReadFile(filepath.Join(callsDir, name+".stdin"))
+		if err != nil {
+			s.t.Fatal(err)
+		}
+		if err := json.Unmarshal(stdin, &call.stdin); err != nil {
+			s.t.Fatalf("invalid stdin %q: %v", stdin, err)
+		}
+		env, err := os.ReadFile(filepath.Join(callsDir, name+".env"))
+		if err != nil {
+			s.t.Fatal(err)
+		}
+		for _, l := range strings.Split(strings.TrimSpace(string(env)), "\n") {
+			if kv := strings.SplitN(l, "=", 2); len(kv) == 2 {
+				call.env[kv[0]] = kv[1]
+			}
+		}
+		calls = append(calls, call)
+	}
+	for _, e := range entries {
+		os.Remove(filepath.Join(callsDir, e.Name()))
+	}
+	return calls
+}
+
+func expectCalls(t *testing.T, calls []stubCall, expected ...string) {
+	t.Helper()
+	var got []string
+	for _, c := range calls {
+		got = append(got, c.plugin+" "+c.command)
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Fatalf("expected calls %v, got %v", expected, got)
+	}
+}
+
+// expectPrevResult checks the prevResult the call got, none if expected is empty.
+func expectPrevResult(t *testing.T, call stubCall, expected string) {
+	t.Helper()
+	prev, ok := call.stdin["prevResult"]
+	if expected == "" {
+		if ok {
+			t.Errorf("%s %s: expected no prevResult, got %v", call.plugin, call.command, prev)
+		}
+		return
+	}
+	var expect interface{}
+	if err := json.Unmarshal([]byte(expected), &expect); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(prev, expect) {
+		t.Errorf("%s %s: expected prevResult %v, got %v", call.plugin, call.command, expect, prev)
+	}
+}
+
+func testPodNetwork() PodNetwork {
+	return PodNetwork{
+		Name:      "pod",
+		Namespace: "ns",
+		UID:       "uid",
+		SandboxID: testSandboxID,
+		NetNS:     "/proc/1/ns/net",
+		PodCIDRs:  []string{"10.1.0.0/24"},
+		IPs:       []string{"10.1.0.5/24"},
+	}
+}
+
+func TestSetUpPod(t *testing.T) {
+	p, s := newTestPlugin(t)
+	s.writeConf(p, "net", "0.4.0", "")
+	s.setOutput("stub-a", "ADD", fmt.Sprintf(resultA, "0.4.0"), "", 0)
+	s.setOutput("stub-b", "ADD", fmt.Sprintf(resultB, "0.4.0"), "", 0)
+
+	result, err := p.SetUpPod(context.Background(), testPodNetwork())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	ips, err := result.PodIPs()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(ips, []string{"10.1.0.5"}) {
+		t.Errorf("expected the IPs of the last plugin, got %v", ips)
+	}
+
+	calls := s.calls()
+	expectCalls(t, calls, "stub-a ADD", "stub-b ADD")
+	a, b := calls[0], calls[1]
+	for k, v := range map[string]string{
+		"CNI_COMMAND":     "ADD",
+		"CNI_CONTAINERID": testSandboxID,
+		"CNI_NETNS":       "/proc/1/ns/net",
+		"CNI_IFNAME":      "eth0",
+		"CNI_ARGS":        "IgnoreUnknown=1;K8S_POD_NAMESPACE=ns;K8S_POD_NAME=pod;K8S_POD_INFRA_CONTAINER_ID=sandbox;K8S_POD_UID=uid",
+	} {
+		if a.env[k] != v {
+			t.Errorf("expected %s=%q, got %q", k, v, a.env[k])
+		}
+	}
+	if a.stdin["name"] != "net" || a.stdin["cniVersion"] != "0.4.0" || a.stdin["foo"] != "bar" {
+		t.Errorf("expected the plugin config with the name and version of the network, got %v", a.stdin)
+	}
+	expectedRuntimeConfig := map[string]interface{}{
+		"ipRanges": []interface{}{[]interface{}{map[string]interface{}{"subnet": "10.1.0.0/24"}}},
+		"ips":      []interface{}{"10.1.0.5/24"},
+	}
+	if !reflect.DeepEqual(a.stdin["runtimeConfig"], expectedRuntimeConfig) {
+		t.Errorf("expected runtimeConfig %v, got %v", expectedRuntimeConfig, a.stdin["runtimeConfig"])
+	}
+	expectPrevResult(t, a, "")
+	if _, ok := b.stdin["runtimeConfig"]; ok {
+		t.Errorf("expected no runtimeConfig for a plugin without capabilities, got %v", b.stdin["runtimeConfig"])
+	}
+	expectPrevResult(t, b, fmt.Sprintf(resultA, "0.4.0"))
+
+	cached, err := p.loadResult(testSandboxID)
+	if err != nil || cached == nil {
+		t.Fatalf("expected a cached result, got %v, %v", cached, err)
+	}
+	if string(cached.Result) != fmt.Sprintf(resultB, "0.4.0") {
+		t.Errorf("expected the result of the last plugin to be cached, got %s", cached.Result)
+	}
+}
+
+func TestSetUpPodWithoutNetwork(t *testing.T) {
+	p, s := newTestPlugin(t)
+	if err := p.Status(); err == nil {
+		t.Fatal("expected a status error without network config")
+	}
+	if _, err := p.SetUpPod(context.Background(), testPodNetwork()); err == nil {
+		t.Fatal("expected an error without network config")
+	}
+	expectCalls(t, s.calls())
+}
+
+func TestTearDownPod(t *testing.T) {
+	for _, version := range []string{"0.3.1", "0.4.0", "1.0.0"} {
+		t.Run(version, func(t *testing.T) {
+			p, s := newTestPlugin(t)
+			s.writeConf(p, "net", version, "")
+			s.setOutput("stub-a", "ADD", fmt.Sprintf(resultA, version), "", 0)
+			s.setOutput("stub-b", "ADD", fmt.Sprintf(resultB, version), "", 0)
+			if _, err := p.SetUpPod(context.Background(), testPodNetwork()); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			s.calls()
+
+			// The network the sandbox was added to is torn down, even
+			// though another network is configured now.
+			s.writeConf(p, "other", "1.0.0", "")
+			pod := testPodNetwork()
+			pod.NetNS = ""
+			if err := p.TearDownPod(context.Background(), pod); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			calls := s.calls()
+			expectCalls(t, calls, "stub-b DEL", "stub-a DEL")
+			for _, call := range calls {
+				if call.stdin["name"] != "net" || call.stdin["cniVersion"] != version {
+					t.Errorf("expected the cached network, got %v", call.stdin)
+				}
+				if call.env["CNI_CONTAINERID"] != testSandboxID {
+					t.Errorf("expected CNI_CONTAINERID %q, got %q", testSandboxID, call.env["CNI_CONTAINERID"])
+				}
+				// prevResult is only passed to DEL since CNI 0.4.0.
+				if version == "0.3.1" {
+					expectPrevResult(t, call, "")
+				} else {
+					expectPrevResult(t, call, fmt.Sprintf(resultB, version))
+				}
+			}
+
+			if cached, err := p.loadResult(testSandboxID); err != nil || cached != nil {
+				t.Errorf("expected the cached result to be removed, got %v, %v", cached, err)
+			}
+			if err := p.TearDownPod(context.Background(), pod); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			expectCalls(t, s.calls())
+		})
+	}
+}
+
+func TestTearDownPodAfterFailedSetUp(t *testing.T) {
+	p, s := newTestPlugin(t)
+	s.writeConf(p, "net", "0.4.0", "")
+	s.setOutput("stub-a", "ADD", fmt.Sprintf(resultA, "0.4.0"), "", 0)
+	s.setOutput("stub-b", "ADD", `{"code":11,"msg":"no IP left"}`, "", 1)
+
+	if _, err := p.SetUpPod(context.Background(), testPodNetwork()); err == nil {
+		t.Fatal("expected the set up to fail")
+	}
+	expectCalls(t, s.calls(), "stub-a ADD", "stub-b ADD")
+
+	if err := p.TearDownPod(context.Background(), testPodNetwork()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	calls := s.calls()
+	expectCalls(t, calls, "stub-b DEL", "stub-a DEL")
+	for _, call := range calls {
+		expectPrevResult(t, call, "")
+	}
+}
+
+func TestCheckPod(t *testing.T) {
+	for desc, test := range map[string]struct {
+		version       string
+		extra         string
+		checkOutput   string
+		expectedCalls []string
+		err           bool
+	}{
+		"0.4.0": {
+			version:       "0.4.0",
+			expectedCalls: []string{"stub-a CHECK", "stub-b CHECK"},
+		},
+		"1.0.0": {
+			version:       "1.0.0",
+			expectedCalls: []string{"stub-a CHECK", "stub-b CHECK"},
+		},
+		"0.3.1 has no CHECK": {
+			version: "0.3.1",
+		},
+		"disableCheck": {
+			version: "1.0.0",
+			extra:   `,"disableCheck":true`,
+		},
+		"failed check": {
+			version:       "1.0.0",
+			checkOutput:   `{"code":100,"msg":"interface is gone"}`,
+			expectedCalls: []string{"stub-a CHECK"},
+			err:           true,
+		},
+	} {
+		t.Run(desc, func(t *testing.T) {
+			p, s := newTestPlugin(t)
+			s.writeConf(p, "net", test.version, test.extra)
+			s.setOutput("stub-a", "ADD", fmt.Sprintf(resultA, test.version), "", 0)
+			s.setOutput("stub-b", "ADD", fmt.Sprintf(resultB, test.version), "", 0)
+			if test.checkOutput != "" {
+				s.setOutput("stub-a", "CHECK", test.checkOutput, "", 1)
+			}
+			if _, err := p.SetUpPod(context.Background(), testPodNetwork()); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			s.calls()
+
+			err := p.CheckPod(context.Background(), testPodNetwork())
+			if test.err != (err != nil) {
+				t.Fatalf("expected error %v, got %v", test.err, err)
+			}
+			calls := s.calls()
+			expectCalls(t, calls, test.expectedCalls...)
+			for _, call := range calls {
+				expectPrevResult(t, call, fmt.Sprintf(resultB, test.version))
+			}
+		})
+	}
+}
+
+func TestCheckPodNotSetUp(t *testing.T) {
+	p, s := newTestPlugin(t)
+	s.writeConf(p, "net", "1.0.0", "")
+	if err := p.CheckPod(context.Background(), testPodNetwork()); err == nil {
+		t.Fatal("expected an error for a sandbox that was never added")
+	}
+	expectCalls(t, s.calls())
+}
+
+func TestPluginErrors(t *testing.T) {
+	for desc, test := range map[string]struct {
+		plugin   string
+		stdout   string
+		stderr   string
+		exitCode int
+		expected []string
+	}{
+		"CNI error": {
+			plugin:   "stub-a",
+			stdout:   `{"cniVersion":"1.0.0","code":7,"msg":"invalid config","details":"no subnet"}`,
+			exitCode: 1,
+			expected: []string{`plugin type="stub-a" name="net" failed (add)`, "invalid config; no subnet"},
+		},
+		"no error message": {
+			plugin:   "stub-a",
+			stderr:   "segmentation fault",
+			exitCode: 2,
+			expected: []string{`plugin type="stub-a" name="net" failed (add)`, "netplugin failed with no error message", "segmentation fault"},
+		},
+		"invalid result": {
+			plugin:   "stub-b",
+			stdout:   "not json",
+			expected: []string{"failed to decode the result"},
+		},
+	} {
+		t.Run(desc, func(t *testing.T) {
+			p, s := newTestPlugin(t)
+			s.writeConf(p, "net", "1.0.0", "")
+			s.setOutput("stub-a", "ADD", fmt.Sprintf(resultA, "1.0.0"), "", 0)
+			s.setOutput("stub-b", "ADD", fmt.Sprintf(resultB, "1.0.0"), "", 0)
+			s.setOutput(test.plugin, "ADD", test.stdout, test.stderr, test.exitCode)
+
+			_, err := p.SetUpPod(context.Background(), testPodNetwork())
+			if err == nil {
+				t.Fatal("expected an error")
+			}
+			for _, e := range test.expected {
+				if !strings.Contains(err.Error(), e) {
+					t.Errorf("expected error %q to contain %q", err, e)
+				}
+			}
+		})
+	}
+}
+
+func TestPluginNotFound(t *testing.T) {
+	p, s := newTestPlugin(t)
+	conf := `{"name":"net","cniVersion":"1.0.0","type":"missing"}`
+	if err := os.WriteFile(filepath.Join(s.confDir, "10-net.conf"), []byte(conf), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Status(); err != nil {
+		t.Fatalf("unexpected status error: %v", err)
+	}
+	_, err := p.SetUpPod(context.Background(), testPodNetwork())
+	if err == nil || !strings.Contains(err.Error(), `failed to find plugin "missing"`) {
+		t.Fatalf("expected the plugin not to be found, got %v", err)
+	}
+}
+
+func TestLoadDefaultNetwork(t *testing.T) {
+	dir := t.TempDir()
+	for name, content := range map[string]string{
+		"00-invalid.conflist": `{"name":"invalid","cniVersion":"1.0.0","plugins":[]}`,
+		"05-notes.txt":        `{"name":"ignored","cniVersion":"1.0.0","type":"bridge"}`,
+		"10-single.conf":      `{"name":"single","cniVersion":"0.3.1","type":"bridge","capabilities":{"ipRanges":true}}`,
+		"20-list.conflist":    `{"name":"list","cniVersion":"1.0.0","plugins":[{"type":"bridge"}]}`,
+	} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	network, err := loadDefaultNetwork(dir)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if network.Name != "single" || network.CNIVersion != "0.3.1" {
+		t.Fatalf("expected the first valid network, got %q %q", network.Name, network.CNIVersion)
+	}
+	if len(network.Plugins) != 1 || network.Plugins[0].Type != "bridge" || !network.Plugins[0].Capabilities["ipRanges"] {
+		t.Errorf("expected the single plugin to be wrapped into a list, got %+v", network.Plugins)
+	}
+
+	if _, err := loadDefaultNetwork(t.TempDir()); err == nil {
+		t.Error("expected an error for an empty config dir")
+	}
+}
@@ -0,0 +1,143 @@
+package cni
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// networkConfigList is a network configuration list of the conf dir. A
+// single plugin configuration is loaded as a list of one plugin.
+type networkConfigList struct {
+	Name         string          `json:"name"`
+	CNIVersion   string          `json:"cniVersion"`
+	DisableCheck bool            `json:"disableCheck,omitempty"`
+	Plugins      []*pluginConfig `json:"-"`
+
+	// Bytes is the configuration the list was parsed from.
+	Bytes []byte `json:"-"`
+}
+
+// pluginConfig is the configuration of one plugin of a list.
+type pluginConfig struct {
+	Type         string          `json:"type"`
+	Capabilities map[string]bool `json:"capabilities,omitempty"`
+
+	// raw is the whole configuration, passed on to the plugin.
+	raw map[string]interface{}
+}
+
+// Result is the result of an ADD, in the format of the CNI version of the
+// network. Only the IPs are interpreted, the rest is kept as reported by
+// the plugin for the next plugins of the list and for CHECK and DEL.
+type Result struct {
+	CNIVersion string       `json:"cniVersion"`
+	Interfaces []*Interface `json:"interfaces,omitempty"`
+	IPs        []*IPConfig  `json:"ips,omitempty"`
+
+	// IP4 and IP6 are the IPs of results before CNI 0.3.0.
+	IP4 *IPConfig `json:"ip4,omitempty"`
+	IP6 *IPConfig `json:"ip6,omitempty"`
+
+	// raw is the result as printed by the plugin.
+	raw []byte
+}
+
+// Interface is an interface created by a plugin.
+type Interface struct {
+	Name    string `json:"name"`
+	Mac     string `json:"mac,omitempty"`
+	Sandbox string `json:"sandbox,omitempty"`
+}
+
+// IPConfig is an IP assigned by a plugin.
+type IPConfig struct {
+	// Interface is the index of the interface the IP is on in Interfaces.
+	Interface *int   `json:"interface,omitempty"`
+	Address   string `json:"address,omitempty"`
+	Gateway   string `json:"gateway,omitempty"`
+
+	// IP is the address of results before CNI 0.3.0.
+	IP string `json:"ip,omitempty"`
+}
+
+// Error is the error printed by a plugin that failed.
+type Error struct {
+	Code    uint   `json:"code"`
+	Msg     string `json:"msg"`
+	Details string `json:"details,omitempty"`
+}
+
+func (e *Error) Error() string {
+	details := ""
+	if e.Details != "" {
+		details = "; " + e.Details
+	}
+	return fmt.Sprintf("%v%s", e.Msg, details)
+}
+
+// parseResult parses the result printed by a plugin.
+func parseResult(data []byte) (*Result, error) {
+	result := &Result{}
+	if err := json.Unmarshal(data, result); err != nil {
+		return nil, fmt.Errorf("failed to decode the result %q: %v", string(data), err)
+	}
+	result.raw = data
+	return result, nil
+}
+
+// PodIPs returns the IPs of the interfaces in the sandbox, in the order the
+// plugins reported them.
+func (r *Result) PodIPs() ([]string, error) {
+	var ips []string
+	add := func(address string) error {
+		ip, _, err := net.ParseCIDR(address)
+		if err != nil {
+			if ip = net.ParseIP(address); ip == nil {
+				return fmt.Errorf("invalid IP %q in the result", address)
+			}
+		}
+		ips = append(ips, ip.String())
+		return nil
+	}
+
+	for _, c := range r.IPs {
+		if c.Interface != nil && *c.Interface >= 0 && *c.Interface < len(r.Interfaces) &&
+			r.Interfaces[*c.Interface].Sandbox == "" {
+			// The IP is on an interface of the host, e.g. a bridge.
+			continue
+		}
+		if err := add(c.Address); err != nil {
+			return nil, err
+		}
+	}
+	for _, c := range []*IPConfig{r.IP4, r.IP6} {
+		if c == nil {
+			continue
+		}
+		if err := add(c.IP); err != nil {
+			return nil, err
+		}
+	}
+	return ips, nil
+}
+
+// versionAtLeast returns whether the CNI version is at least
+// major.minor.0. An unparseable version is treated as the oldest one.
+func versionAtLeast(version string, major, minor int) bool {
+	parts := strings.SplitN(version, ".", 3)
+	if len(parts) < 2 {
+		return false
+	}
+	vmajor, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return false
+	}
+	vminor, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return false
+	}
+	return vmajor > major || vmajor == major && vminor >= minor
+}
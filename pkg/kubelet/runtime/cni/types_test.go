@@ -0,0 +1,86 @@
+package cni
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestResultPodIPs(t *testing.T) {
+	for desc, test := range map[string]struct {
+		result string
+		expect []string
+		err    bool
+	}{
+		"0.2.0": {
+			result: `{"cniVersion":"0.2.0","ip4":{"ip":"10.1.0.5/24","gateway":"10.1.0.1"},"ip6":{"ip":"fd00::5/64"}}`,
+			expect: []string{"10.1.0.5", "fd00::5"},
+		},
+		"0.3.1": {
+			result: `{"cniVersion":"0.3.1",
+				"interfaces":[{"name":"cni0","mac":"aa:bb:cc:dd:ee:ff"},{"name":"eth0","sandbox":"/proc/1/ns/net"}],
+				"ips":[{"version":"4","interface":0,"address":"10.1.0.1/24"},{"version":"4","interface":1,"address":"10.1.0.5/24","gateway":"10.1.0.1"}]}`,
+			expect: []string{"10.1.0.5"},
+		},
+		"0.4.0 dual-stack": {
+			result: `{"cniVersion":"0.4.0",
+				"interfaces":[{"name":"eth0","sandbox":"/proc/1/ns/net"}],
+				"ips":[{"version":"6","interface":0,"address":"fd00::5/64"},{"version":"4","interface":0,"address":"10.1.0.5/24"}]}`,
+			expect: []string{"fd00::5", "10.1.0.5"},
+		},
+		"1.0.0 without interfaces": {
+			result: `{"cniVersion":"1.0.0","ips":[{"address":"10.1.0.5/24"}]}`,
+			expect: []string{"10.1.0.5"},
+		},
+		"plain IP": {
+			result: `{"cniVersion":"1.0.0","ips":[{"address":"10.1.0.5"}]}`,
+			expect: []string{"10.1.0.5"},
+		},
+		"invalid IP": {
+			result: `{"cniVersion":"1.0.0","ips":[{"address":"10.1.0"}]}`,
+			err:    true,
+		},
+	} {
+		t.Run(desc, func(t *testing.T) {
+			result, err := parseResult([]byte(test.result))
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			ips, err := result.PodIPs()
+			if test.err {
+				if err == nil {
+					t.Fatalf("expected error, got %v", ips)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(ips, test.expect) {
+				t.Errorf("expected %v, got %v", test.expect, ips)
+			}
+		})
+	}
+}
+
+func TestParseResultInvalid(t *testing.T) {
+	if _, err := parseResult([]byte("not json")); err == nil {
+		t.Fatal("expected error")
+	}
+}
+
+func TestVersionAtLeast(t *testing.T) {
+	for _, test := range []struct {
+		version string
+		expect  bool
+	}{
+		{"0.3.1", false},
+		{"0.4.0", true},
+		{"1.0.0", true},
+		{"", false},
+		{"x.y", false},
+	} {
+		if got := versionAtLeast(test.version, 0, 4); got != test.expect {
+			t.Errorf("versionAtLeast(%q, 0, 4): expected %v, got %v", test.version, test.expect, got)
+		}
+	}
+}
@@ -0,0 +1,19 @@
+package cri
+
+import (
+	"time"
+
+	kubecontainer "github.com/xuliangTang/mykubelet/pkg/kubelet/container"
+)
+
+// RunInContainer synchronously executes the command in the container, and returns the output.
+// The runtime kills the command once timeout elapses, zero means no timeout.
+// The stdout and stderr are returned one after the other, with a CodeExitError
+// if the command exits with a non-zero code.
+func (m *criManager) RunInContainer(id kubecontainer.ContainerID, cmd []string, timeout time.Duration) ([]byte, error) {
+	stdout, stderr, err := m.runtimeService.ExecSync(id.ID, cmd, timeout)
+	// This does not correctly interleave stdout & stderr, but should be sufficient
+	// for logging purposes. A combined output option will need to be added to the ExecSyncRequest
+	// if more precise output ordering is ever required.
+	return append(stdout, stderr...), err
+}
@@ -0,0 +1,353 @@
+package cri
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	kubecontainer "github.com/xuliangTang/mykubelet/pkg/kubelet/container"
+	"k8s.io/apimachinery/pkg/types"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/apimachinery/pkg/util/sets"
+	runtimeapi "k8s.io/cri-api/pkg/apis/runtime/v1alpha2"
+	"k8s.io/klog/v2"
+)
+
+// podStateProvider can determine if none of the elements are necessary to retain (pod content)
+// or if none of the runtime elements are necessary to retain (containers)
+type podStateProvider interface {
+	ShouldPodContentBeRemoved(types.UID) bool
+	ShouldPodRuntimeBeRemoved(types.UID) bool
+}
+
+// containerGCInfo is the internal information kept for containers being considered for GC.
+type containerGCInfo struct {
+	// The ID of the container.
+	id string
+	// The name of the container.
+	name string
+	// Creation time for the container.
+	createTime time.Time
+	// If true, the container is in unknown state. Garbage collector should try
+	// to stop containers before removal.
+	unknown bool
+}
+
+// sandboxGCInfo is the internal information kept for sandboxes being considered for GC.
+type sandboxGCInfo struct {
+	// The ID of the sandbox.
+	id string
+	// Creation time for the sandbox.
+	createTime time.Time
+	// If true, the sandbox is ready or still has containers.
+	active bool
+}
+
+// evictUnit is considered for eviction as units of (UID, container name) pair.
+type evictUnit struct {
+	// UID of the pod.
+	uid types.UID
+	// Name of the container in the pod.
+	name string
+}
+
+type containersByEvictUnit map[evictUnit][]containerGCInfo
+type sandboxesByPodUID map[types.UID][]sandboxGCInfo
+
+// NumContainers returns the number of containers in this map.
+func (cu containersByEvictUnit) NumContainers() int {
+	num := 0
+	for key := range cu {
+		num += len(cu[key])
+	}
+	return num
+}
+
+// NumEvictUnits returns the number of pod in this map.
+func (cu containersByEvictUnit) NumEvictUnits() int {
+	return len(cu)
+}
+
+// Newest first.
+type byCreated []containerGCInfo
+
+func (a byCreated) Len() int           { return len(a) }
+func (a byCreated) Swap(i, j int)      { a[i], a[j] = a[j], a[i] }
+func (a byCreated) Less(i, j int) bool { return a[i].createTime.After(a[j].createTime) }
+
+// Newest first.
+type sandboxByCreated []sandboxGCInfo
+
+func (a sandboxByCreated) Len() int           { return len(a) }
+func (a sandboxByCreated) Swap(i, j int)      { a[i], a[j] = a[j], a[i] }
+func (a sandboxByCreated) Less(i, j int) bool { return a[i].createTime.After(a[j].createTime) }
+
+// enforceMaxContainersPerEvictUnit enforces MaxPerPodContainer for each evictUnit.
+func (m *criManager) enforceMaxContainersPerEvictUnit(evictUnits containersByEvictUnit, MaxContainers int) {
+	for key := range evictUnits {
+		toRemove := len(evictUnits[key]) - MaxContainers
+
+		if toRemove > 0 {
+			evictUnits[key] = m.removeOldestN(evictUnits[key], toRemove)
+		}
+	}
+}
+
+// removeOldestN removes the oldest toRemove containers and returns the resulting slice.
+func (m *criManager) removeOldestN(containers []containerGCInfo, toRemove int) []containerGCInfo {
+	// Remove from oldest to newest (last to first).
+	numToKeep := len(containers) - toRemove
+	if numToKeep > 0 {
+		sort.Sort(byCreated(containers))
+	}
+	for i := len(containers) - 1; i >= numToKeep; i-- {
+		if containers[i].unknown {
+			// Containers in known state could be running, we should try
+			// to stop it before removal.
+			id := m.buildContainerID(containers[i].id)
+			message := "Container is in unknown state, try killing it before removal"
+			if err := m.killContainer(nil, id, containers[i].name, message, nil); err != nil {
+				klog.ErrorS(err, "Failed to stop container", "containerID", containers[i].id)
+				continue
+			}
+		}
+		if err := m.removeContainer(containers[i].id); err != nil {
+			klog.ErrorS(err, "Failed to remove container", "containerID", containers[i].id)
+		}
+	}
+
+	// Assume we removed the containers so that we're not too aggressive.
+	return containers[:numToKeep]
+}
+
+// removeOldestNSandboxes removes the oldest inactive toRemove sandboxes.
+func (m *criManager) removeOldestNSandboxes(sandboxes []sandboxGCInfo, toRemove int) {
+	numToKeep := len(sandboxes) - toRemove
+	if numToKeep > 0 {
+		sort.Sort(sandboxByCreated(sandboxes))
+	}
+	// Remove from oldest to newest (last to first).
+	for i := len(sandboxes) - 1; i >= numToKeep; i-- {
+		if !sandboxes[i].active {
+			m.removeSandbox(sandboxes[i].id)
+		}
+	}
+}
+
+// removeSandbox removes the sandbox by sandboxID.
+func (m *criManager) removeSandbox(sandboxID string) {
+	klog.V(4).InfoS("Removing sandbox", "sandboxID", sandboxID)
+	// In normal cases, kubelet should've already called StopPodSandbox before
+	// GC kicks in. To guard against the rare cases where this is not true, try
+	// stopping the sandbox before removing it.
+	if err := m.runtimeService.StopPodSandbox(sandboxID); err != nil {
+		klog.ErrorS(err, "Failed to stop sandbox before removing", "sandboxID", sandboxID)
+		return
+	}
+	if err := m.runtimeService.RemovePodSandbox(sandboxID); err != nil {
+		klog.ErrorS(err, "Failed to remove sandbox", "sandboxID", sandboxID)
+	}
+}
+
+// evictableContainers gets all containers that are evictable. Evictable containers are: not running
+// and created more than MinAge ago.
+func (m *criManager) evictableContainers(minAge time.Duration) (containersByEvictUnit, error) {
+	containers, err := m.getKubeletContainers(true)
+	if err != nil {
+		return containersByEvictUnit{}, err
+	}
+
+	evictUnits := make(containersByEvictUnit)
+	newestGCTime := time.Now().Add(-minAge)
+	for _, container := range containers {
+		// Prune out running containers.
+		if container.State == runtimeapi.ContainerState_CONTAINER_RUNNING {
+			continue
+		}
+
+		createdAt := time.Unix(0, container.CreatedAt)
+		if newestGCTime.Before(createdAt) {
+			continue
+		}
+
+		labeledInfo := getContainerInfoFromLabels(container.Labels)
+		containerInfo := containerGCInfo{
+			id:         container.Id,
+			name:       container.Metadata.Name,
+			createTime: createdAt,
+			unknown:    container.State == runtimeapi.ContainerState_CONTAINER_UNKNOWN,
+		}
+		key := evictUnit{
+			uid:  labeledInfo.PodUID,
+			name: containerInfo.name,
+		}
+		evictUnits[key] = append(evictUnits[key], containerInfo)
+	}
+
+	return evictUnits, nil
+}
+
+// evict all containers that are evictable
+func (m *criManager) evictContainers(gcPolicy kubecontainer.GCPolicy, allSourcesReady bool, evictNonDeletedPods bool) error {
+	// Separate containers by evict units.
+	evictUnits, err := m.evictableContainers(gcPolicy.MinAge)
+	if err != nil {
+		return err
+	}
+
+	// Remove deleted pod containers if all sources are ready.
+	if allSourcesReady {
+		for key, unit := range evictUnits {
+			if m.podStateProvider.ShouldPodContentBeRemoved(key.uid) || (evictNonDeletedPods && m.podStateProvider.ShouldPodRuntimeBeRemoved(key.uid)) {
+				m.removeOldestN(unit, len(unit)) // Remove all.
+				delete(evictUnits, key)
+			}
+		}
+	}
+
+	// Enforce max containers per evict unit.
+	if gcPolicy.MaxPerPodContainer >= 0 {
+		m.enforceMaxContainersPerEvictUnit(evictUnits, gcPolicy.MaxPerPodContainer)
+	}
+
+	// Enforce max total number of containers.
+	if gcPolicy.MaxContainers >= 0 && evictUnits.NumContainers() > gcPolicy.MaxContainers {
+		// Leave an equal number of containers per evict unit (min: 1).
+		numContainersPerEvictUnit := gcPolicy.MaxContainers / evictUnits.NumEvictUnits()
+		if numContainersPerEvictUnit < 1 {
+			numContainersPerEvictUnit = 1
+		}
+		m.enforceMaxContainersPerEvictUnit(evictUnits, numContainersPerEvictUnit)
+
+		// If we still need to evict, evict oldest first.
+		numContainers := evictUnits.NumContainers()
+		if numContainers > gcPolicy.MaxContainers {
+			flattened := make([]containerGCInfo, 0, numContainers)
+			for key := range evictUnits {
+				flattened = append(flattened, evictUnits[key]...)
+			}
+			sort.Sort(byCreated(flattened))
+
+			m.removeOldestN(flattened, numContainers-gcPolicy.MaxContainers)
+		}
+	}
+	return nil
+}
+
+// evictSandboxes remove all evictable sandboxes. An evictable sandbox must
+// meet the following requirements:
+//  1. not in ready state
+//  2. contains no containers.
+//  3. belong to a non-existent (i.e., already removed) pod, or is not the
+//     most recently created sandbox for the pod.
+func (m *criManager) evictSandboxes(evictNonDeletedPods bool) error {
+	containers, err := m.getKubeletContainers(true)
+	if err != nil {
+		return err
+	}
+
+	sandboxes, err := m.getKubeletSandboxes(true)
+	if err != nil {
+		return err
+	}
+
+	// collect all the PodSandboxId of container
+	sandboxIDs := sets.NewString()
+	for _, container := range containers {
+		sandboxIDs.Insert(container.PodSandboxId)
+	}
+
+	sandboxesByPod := make(sandboxesByPodUID)
+	for _, sandbox := range sandboxes {
+		podUID := types.UID(sandbox.Metadata.Uid)
+		sandboxInfo := sandboxGCInfo{
+			id:         sandbox.Id,
+			createTime: time.Unix(0, sandbox.CreatedAt),
+		}
+
+		// Set ready sandboxes to be active.
+		if sandbox.State == runtimeapi.PodSandboxState_SANDBOX_READY {
+			sandboxInfo.active = true
+		}
+
+		// Set sandboxes that still have containers to be active.
+		if sandboxIDs.Has(sandbox.Id) {
+			sandboxInfo.active = true
+		}
+
+		sandboxesByPod[podUID] = append(sandboxesByPod[podUID], sandboxInfo)
+	}
+
+	for podUID, sandboxes := range sandboxesByPod {
+		if m.podStateProvider.ShouldPodContentBeRemoved(podUID) || (evictNonDeletedPods && m.podStateProvider.ShouldPodRuntimeBeRemoved(podUID)) {
+			// Remove all evictable sandboxes if the pod has been removed.
+			// Note that the latest dead sandbox is also removed if there is
+			// already an active one.
+			m.removeOldestNSandboxes(sandboxes, len(sandboxes))
+		} else {
+			// Keep latest one if the pod still exists.
+			m.removeOldestNSandboxes(sandboxes, len(sandboxes)-1)
+		}
+	}
+	return nil
+}
+
+// evictPodLogsDirectories evicts all evictable pod logs directories. Pod logs directories
+// are evictable if there are no corresponding pods.
+func (m *criManager) evictPodLogsDirectories(allSourcesReady bool) error {
+	if !allSourcesReady {
+		// Only remove pod logs directories when all sources are ready.
+		return nil
+	}
+	dirs, err := os.ReadDir(m.podLogsRootDirectory)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return fmt.Errorf("failed to read podLogsRootDirectory %q: %v", m.podLogsRootDirectory, err)
+	}
+	for _, dir := range dirs {
+		name := dir.Name()
+		podUID := parsePodUIDFromLogsDirectory(name)
+		if !m.podStateProvider.ShouldPodContentBeRemoved(podUID) {
+			continue
+		}
+		klog.V(4).InfoS("Removing pod logs", "podUID", podUID)
+		err := os.RemoveAll(filepath.Join(m.podLogsRootDirectory, name))
+		if err != nil {
+			klog.ErrorS(err, "Failed to remove pod logs directory", "path", name)
+		}
+	}
+	return nil
+}
+
+// GarbageCollect removes dead containers using the specified container gc policy.
+// Note that gc policy is not applied to sandboxes. Sandboxes are only removed when they are
+// not ready and containing no containers.
+//
+// GarbageCollect consists of the following steps:
+// * gets evictable containers which are not active and created more than gcPolicy.MinAge ago.
+// * removes oldest dead containers for each pod by enforcing gcPolicy.MaxPerPodContainer.
+// * removes oldest dead containers by enforcing gcPolicy.MaxContainers.
+// * gets evictable sandboxes which are not ready and contains no containers.
+// * removes evictable sandboxes.
+func (m *criManager) GarbageCollect(gcPolicy kubecontainer.GCPolicy, allSourcesReady bool, evictNonDeletedPods bool) error {
+	errors := []error{}
+	// Remove evictable containers
+	if err := m.evictContainers(gcPolicy, allSourcesReady, evictNonDeletedPods); err != nil {
+		errors = append(errors, err)
+	}
+
+	// Remove sandboxes with zero containers
+	if err := m.evictSandboxes(evictNonDeletedPods); err != nil {
+		errors = append(errors, err)
+	}
+
+	// Remove pod sandbox log directory
+	if err := m.evictPodLogsDirectories(allSourcesReady); err != nil {
+		errors = append(errors, err)
+	}
+	return utilerrors.NewAggregate(errors)
+}
@@ -0,0 +1,160 @@
+package cri
+
+import (
+	"fmt"
+	"time"
+
+	statsapi "github.com/xuliangTang/mykubelet/pkg/kubelet/apis/stats/v1alpha1"
+	kubecontainer "github.com/xuliangTang/mykubelet/pkg/kubelet/container"
+	"github.com/xuliangTang/mykubelet/pkg/kubelet/runtime/imagestore"
+	"github.com/xuliangTang/mykubelet/pkg/util/filesystem"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	runtimeapi "k8s.io/cri-api/pkg/apis/runtime/v1alpha2"
+	"k8s.io/klog/v2"
+)
+
+// PullImage pulls an image from the network to local storage using the supplied
+// secrets if necessary. The credential the secrets hold for the registry of
+// the image is passed on to the image service.
+func (m *criManager) PullImage(image kubecontainer.ImageSpec, pullSecrets []v1.Secret, podSandboxConfig *runtimeapi.PodSandboxConfig) (string, error) {
+	img := image.Image
+	imgSpec := toRuntimeAPIImageSpec(image)
+
+	auth := imagestore.AuthConfigFor(img, pullSecrets)
+	if auth == nil {
+		klog.V(3).InfoS("Pulling image without credentials", "image", img)
+	}
+	imageRef, err := m.imageService.PullImage(imgSpec, auth, podSandboxConfig)
+	if err != nil {
+		klog.ErrorS(err, "Failed to pull image", "image", img)
+		return "", err
+	}
+	return imageRef, nil
+}
+
+// GetImageRef gets the ID of the image which has already been in
+// the local storage. It returns ("", nil) if the image isn't in the local storage.
+func (m *criManager) GetImageRef(image kubecontainer.ImageSpec) (string, error) {
+	resp, err := m.imageService.ImageStatus(toRuntimeAPIImageSpec(image))
+	if err != nil {
+		klog.ErrorS(err, "Failed to get image status", "image", image.Image)
+		return "", err
+	}
+	if resp == nil {
+		return "", nil
+	}
+	return resp.Id, nil
+}
+
+// ListImages gets all images currently on the machine.
+func (m *criManager) ListImages() ([]kubecontainer.Image, error) {
+	var images []kubecontainer.Image
+
+	allImages, err := m.imageService.ListImages(nil)
+	if err != nil {
+		klog.ErrorS(err, "Failed to list images")
+		return nil, err
+	}
+
+	for _, img := range allImages {
+		images = append(images, kubecontainer.Image{
+			ID:          img.Id,
+			Size:        int64(img.Size_),
+			RepoTags:    img.RepoTags,
+			RepoDigests: img.RepoDigests,
+			Spec:        toKubeContainerImageSpec(img),
+		})
+	}
+
+	return images, nil
+}
+
+// RemoveImage removes the specified image.
+func (m *criManager) RemoveImage(image kubecontainer.ImageSpec) error {
+	err := m.imageService.RemoveImage(&runtimeapi.ImageSpec{Image: image.Image})
+	if err != nil {
+		klog.ErrorS(err, "Failed to remove image", "image", image.Image)
+		return err
+	}
+
+	return nil
+}
+
+// ImageStats returns the statistics of the image.
+// Notice that current logic doesn't really work for images which share layers (e.g. docker image),
+// this is a known issue, and we'll address this by getting imagefs stats directly from CRI.
+func (m *criManager) ImageStats() (*kubecontainer.ImageStats, error) {
+	allImages, err := m.imageService.ListImages(nil)
+	if err != nil {
+		klog.ErrorS(err, "Failed to list images")
+		return nil, err
+	}
+	stats := &kubecontainer.ImageStats{}
+	for _, img := range allImages {
+		stats.TotalStorageBytes += img.Size_
+	}
+	return stats, nil
+}
+
+// ImageFsStats returns the usage of the filesystem the image service stores
+// the images in, as reported by the image service.
+func (m *criManager) ImageFsStats() (*statsapi.FsStats, error) {
+	usages, err := m.imageService.ImageFsInfo()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get the usage of the image filesystem: %v", err)
+	}
+	if len(usages) == 0 {
+		return nil, fmt.Errorf("image service reported no image filesystem")
+	}
+	usage := usages[0]
+	fsStats := &statsapi.FsStats{
+		Time: metav1.NewTime(time.Unix(0, usage.Timestamp)),
+	}
+	if usage.UsedBytes != nil {
+		fsStats.UsedBytes = &usage.UsedBytes.Value
+	}
+	if usage.InodesUsed != nil {
+		fsStats.InodesUsed = &usage.InodesUsed.Value
+	}
+	if mountpoint := usage.GetFsId().GetMountpoint(); mountpoint != "" {
+		available, capacity, err := filesystem.Info(mountpoint)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get the usage of the image filesystem: %v", err)
+		}
+		fsStats.AvailableBytes = &available
+		fsStats.CapacityBytes = &capacity
+	}
+	return fsStats, nil
+}
+
+func toKubeContainerImageSpec(image *runtimeapi.Image) kubecontainer.ImageSpec {
+	var annotations []kubecontainer.Annotation
+
+	if image.Spec != nil && len(image.Spec.Annotations) > 0 {
+		for k, v := range image.Spec.Annotations {
+			annotations = append(annotations, kubecontainer.Annotation{
+				Name:  k,
+				Value: v,
+			})
+		}
+	}
+
+	return kubecontainer.ImageSpec{
+		Image:       image.Id,
+		Annotations: annotations,
+	}
+}
+
+func toRuntimeAPIImageSpec(imageSpec kubecontainer.ImageSpec) *runtimeapi.ImageSpec {
+	var annotations = make(map[string]string)
+	if imageSpec.Annotations != nil {
+		for _, a := range imageSpec.Annotations {
+			annotations[a.Name] = a.Value
+		}
+	}
+	return &runtimeapi.ImageSpec{
+		Image:       imageSpec.Image,
+		Annotations: annotations,
+	}
+}
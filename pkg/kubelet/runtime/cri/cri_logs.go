@@ -0,0 +1,64 @@
+package cri
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	kubecontainer "github.com/xuliangTang/mykubelet/pkg/kubelet/container"
+	"github.com/xuliangTang/mykubelet/pkg/kubelet/logs"
+	v1 "k8s.io/api/core/v1"
+	runtimeapi "k8s.io/cri-api/pkg/apis/runtime/v1alpha2"
+	"k8s.io/klog/v2"
+)
+
+// GetContainerLogs returns logs of a specific container.
+func (m *criManager) GetContainerLogs(ctx context.Context, pod *v1.Pod, containerID kubecontainer.ContainerID, logOptions *v1.PodLogOptions, stdout, stderr io.Writer) error {
+	status, err := m.runtimeService.ContainerStatus(containerID.ID)
+	if err != nil {
+		klog.V(4).InfoS("Failed to get container status", "containerID", containerID.String(), "err", err)
+		return fmt.Errorf("unable to retrieve container logs for %v", containerID.String())
+	}
+	return m.ReadLogs(ctx, status.GetLogPath(), containerID.ID, logOptions, stdout, stderr)
+}
+
+// ReadLogs read the container log and redirect into stdout and stderr.
+func (m *criManager) ReadLogs(ctx context.Context, path, containerID string, apiOpts *v1.PodLogOptions, stdout, stderr io.Writer) error {
+	// Convert v1.PodLogOptions into internal log options.
+	opts := logs.NewLogOptions(apiOpts, time.Now())
+
+	return logs.ReadLogs(ctx, path, containerID, opts, m.isContainerRunning, stdout, stderr)
+}
+
+// isContainerRunning returns whether the container with the given id is running.
+func (m *criManager) isContainerRunning(containerID string) (bool, error) {
+	status, err := m.runtimeService.ContainerStatus(containerID)
+	if err != nil {
+		return false, err
+	}
+	return status.State == runtimeapi.ContainerState_CONTAINER_RUNNING, nil
+}
+
+// removeContainerLog removes the container log.
+func (m *criManager) removeContainerLog(containerID string) error {
+	status, err := m.runtimeService.ContainerStatus(containerID)
+	if err != nil {
+		return fmt.Errorf("failed to get container status %q: %v", containerID, err)
+	}
+	path := status.GetLogPath()
+	if path == "" {
+		return nil
+	}
+	logs, err := logs.GetAllLogs(path)
+	if err != nil {
+		return err
+	}
+	for _, log := range logs {
+		if err := os.Remove(log); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to remove container %q log %q: %v", containerID, log, err)
+		}
+	}
+	return nil
+}
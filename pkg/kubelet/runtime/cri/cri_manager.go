@@ -0,0 +1,835 @@
+package cri
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+
+	kubecontainer "github.com/xuliangTang/mykubelet/pkg/kubelet/container"
+	"github.com/xuliangTang/mykubelet/pkg/kubelet/cri/remote"
+	"github.com/xuliangTang/mykubelet/pkg/kubelet/images"
+	"github.com/xuliangTang/mykubelet/pkg/kubelet/lifecycle"
+	"github.com/xuliangTang/mykubelet/pkg/kubelet/stats"
+	kubetypes "github.com/xuliangTang/mykubelet/pkg/kubelet/types"
+	"github.com/xuliangTang/mykubelet/pkg/kubelet/util/format"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	utilnet "k8s.io/apimachinery/pkg/util/net"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/client-go/util/flowcontrol"
+	runtimeapi "k8s.io/cri-api/pkg/apis/runtime/v1alpha2"
+	"k8s.io/klog/v2"
+)
+
+const (
+	// The api version of kubelet runtime api
+	kubeRuntimeAPIVersion = "0.1.0"
+)
+
+var (
+	// ErrVersionNotSupported is returned when the api version of runtime interface is not supported
+	ErrVersionNotSupported = errors.New("runtime api version is not supported")
+)
+
+// CRIRuntime is the interface implemented by the CRI runtime manager.
+type CRIRuntime interface {
+	kubecontainer.Runtime
+	kubecontainer.CommandRunner
+	kubecontainer.StreamingRuntime
+	stats.ContainerLister
+	images.StatsProvider
+}
+
+// criManager runs the containers of a pod in a CRI runtime, such as
+// containerd, through its runtime and image services.
+type criManager struct {
+	// The name of the runtime, it is the type of the IDs of its containers.
+	runtimeName string
+
+	// Root directory of the pod logs. The runtime writes the container logs
+	// into the directories the kubelet creates below it.
+	podLogsRootDirectory string
+
+	// runtimeHelper wraps kubelet to generate runtime container options.
+	runtimeHelper kubecontainer.RuntimeHelper
+	recorder      record.EventRecorder
+
+	// Runner of lifecycle events.
+	runner kubecontainer.HandlerRunner
+
+	// podStateProvider tells the garbage collector which pods are gone.
+	podStateProvider podStateProvider
+
+	// imagePuller pulls the images of containers according to their pull
+	// policy, backing off failed pulls.
+	imagePuller images.ImageManager
+
+	// gRPC service clients
+	runtimeService remote.RuntimeService
+	imageService   remote.ImageManagerService
+}
+
+// NewCRIRuntimeManager creates a new runtime manager driving the CRI runtime
+// and image services. The runtime must support the CRI v1alpha2 API.
+// Failed image pulls are backed off with imageBackOff.
+func NewCRIRuntimeManager(runtimeService remote.RuntimeService, imageService remote.ImageManagerService, podLogsRootDirectory string, runtimeHelper kubecontainer.RuntimeHelper, podStateProvider podStateProvider, recorder record.EventRecorder, imageBackOff *flowcontrol.Backoff) (CRIRuntime, error) {
+	m := &criManager{
+		podLogsRootDirectory: podLogsRootDirectory,
+		runtimeHelper:        runtimeHelper,
+		podStateProvider:     podStateProvider,
+		recorder:             recorder,
+		runtimeService:       runtimeService,
+		imageService:         imageService,
+	}
+
+	typedVersion, err := m.getTypedVersion()
+	if err != nil {
+		klog.ErrorS(err, "Get runtime version failed")
+		return nil, err
+	}
+
+	// Only matching kubeRuntimeAPIVersion is supported now
+	if typedVersion.Version != kubeRuntimeAPIVersion {
+		klog.ErrorS(err, "This runtime api version is not supported",
+			"apiVersion", typedVersion.Version,
+			"supportedAPIVersion", kubeRuntimeAPIVersion)
+		return nil, ErrVersionNotSupported
+	}
+
+	m.runtimeName = typedVersion.RuntimeName
+	klog.InfoS("Container runtime initialized",
+		"containerRuntime", typedVersion.RuntimeName,
+		"version", typedVersion.RuntimeVersion,
+		"apiVersion", typedVersion.RuntimeApiVersion)
+
+	// Lifecycle hooks are sent with the settings of HTTP probes: no proxy,
+	// and the serving certificate of the container is not verified.
+	httpClient := &http.Client{
+		Transport: utilnet.SetTransportDefaults(&http.Transport{
+			TLSClientConfig:   &tls.Config{InsecureSkipVerify: true},
+			DisableKeepAlives: true,
+			Proxy:             http.ProxyURL(nil),
+		}),
+	}
+	m.runner = lifecycle.NewHandlerRunner(httpClient, m, m)
+	m.imagePuller = images.NewImageManager(recorder, m, imageBackOff)
+	return m, nil
+}
+
+// Type returns the type of the container runtime.
+func (m *criManager) Type() string {
+	return m.runtimeName
+}
+
+// SupportsSingleFileMapping returns whether the container runtime supports single file mappings or not.
+func (m *criManager) SupportsSingleFileMapping() bool {
+	return true
+}
+
+func (m *criManager) getTypedVersion() (*runtimeapi.VersionResponse, error) {
+	typedVersion, err := m.runtimeService.Version(kubeRuntimeAPIVersion)
+	if err != nil {
+		return nil, fmt.Errorf("get remote runtime typed version failed: %v", err)
+	}
+	return typedVersion, nil
+}
+
+// Version returns the version information of the container runtime.
+func (m *criManager) Version() (kubecontainer.Version, error) {
+	typedVersion, err := m.getTypedVersion()
+	if err != nil {
+		return nil, err
+	}
+
+	return newCRIVersion(typedVersion.RuntimeVersion)
+}
+
+// APIVersion returns the cached API version information of the container
+// runtime. Implementation is expected to update this cache periodically.
+// This may be different from the runtime engine's version.
+func (m *criManager) APIVersion() (kubecontainer.Version, error) {
+	typedVersion, err := m.getTypedVersion()
+	if err != nil {
+		return nil, err
+	}
+
+	return newCRIVersion(typedVersion.RuntimeApiVersion)
+}
+
+// Status returns the status of the runtime. An error is returned if the Status
+// function itself fails, nil otherwise.
+func (m *criManager) Status() (*kubecontainer.RuntimeStatus, error) {
+	status, err := m.runtimeService.Status()
+	if err != nil {
+		return nil, err
+	}
+	return toKubeRuntimeStatus(status), nil
+}
+
+// toKubeRuntimeStatus converts the runtimeapi.RuntimeStatus to kubecontainer.RuntimeStatus.
+func toKubeRuntimeStatus(status *runtimeapi.RuntimeStatus) *kubecontainer.RuntimeStatus {
+	conditions := []kubecontainer.RuntimeCondition{}
+	for _, c := range status.GetConditions() {
+		conditions = append(conditions, kubecontainer.RuntimeCondition{
+			Type:    kubecontainer.RuntimeConditionType(c.Type),
+			Status:  c.Status,
+			Reason:  c.Reason,
+			Message: c.Message,
+		})
+	}
+	return &kubecontainer.RuntimeStatus{Conditions: conditions}
+}
+
+// GetPods returns a list of containers grouped by pods. The boolean parameter
+// specifies whether the runtime returns all containers including those already
+// exited and dead containers (used for garbage collection).
+func (m *criManager) GetPods(all bool) ([]*kubecontainer.Pod, error) {
+	pods := make(map[types.UID]*kubecontainer.Pod)
+	sandboxes, err := m.getKubeletSandboxes(all)
+	if err != nil {
+		return nil, err
+	}
+	for i := range sandboxes {
+		s := sandboxes[i]
+		if s.Metadata == nil {
+			klog.V(4).InfoS("Sandbox does not have metadata", "sandbox", s)
+			continue
+		}
+		podUID := types.UID(s.Metadata.Uid)
+		if _, ok := pods[podUID]; !ok {
+			pods[podUID] = &kubecontainer.Pod{
+				ID:        podUID,
+				Name:      s.Metadata.Name,
+				Namespace: s.Metadata.Namespace,
+			}
+		}
+		p := pods[podUID]
+		converted, err := m.sandboxToKubeContainer(s)
+		if err != nil {
+			klog.V(4).InfoS("Convert sandbox of pod failed", "runtimeName", m.runtimeName, "sandbox", s, "podUID", podUID, "err", err)
+			continue
+		}
+		p.Sandboxes = append(p.Sandboxes, converted)
+	}
+
+	containers, err := m.getKubeletContainers(all)
+	if err != nil {
+		return nil, err
+	}
+	for i := range containers {
+		c := containers[i]
+		if c.Metadata == nil {
+			klog.V(4).InfoS("Container does not have metadata", "container", c)
+			continue
+		}
+
+		labelledInfo := getContainerInfoFromLabels(c.Labels)
+		pod, found := pods[labelledInfo.PodUID]
+		if !found {
+			pod = &kubecontainer.Pod{
+				ID:        labelledInfo.PodUID,
+				Name:      labelledInfo.PodName,
+				Namespace: labelledInfo.PodNamespace,
+			}
+			pods[labelledInfo.PodUID] = pod
+		}
+
+		converted, err := m.toKubeContainer(c)
+		if err != nil {
+			klog.V(4).InfoS("Convert container of pod failed", "runtimeName", m.runtimeName, "container", c, "podUID", labelledInfo.PodUID, "err", err)
+			continue
+		}
+
+		pod.Containers = append(pod.Containers, converted)
+	}
+
+	// Convert map to list.
+	var result []*kubecontainer.Pod
+	for _, pod := range pods {
+		result = append(result, pod)
+	}
+
+	return result, nil
+}
+
+// GetPodStatus retrieves the status of the pod, including the
+// information of all containers in the pod that are visible in Runtime.
+// Sandboxes and containers are sorted newest first, the IPs of the pod are
+// the ones of its latest sandbox if it is ready.
+func (m *criManager) GetPodStatus(uid types.UID, name, namespace string) (*kubecontainer.PodStatus, error) {
+	// Now we retain restart count of container as a container label. Each time a container
+	// restarts, pod will read the restart count from the registered dead container, increment
+	// it to get the new restart count, and then add a label with the new restart count on
+	// the newly started container.
+	// However, there are some limitations of this method:
+	//	1. When all dead containers were garbage collected, the container status could
+	//	not get the historical value and would be *inaccurate*. Fortunately, the chance
+	//	is really slim.
+	//	2. When working with old version containers which have no restart count label,
+	//	we can only assume their restart count is 0.
+	// Anyhow, we only promised "best-effort" restart count reporting, we can just ignore
+	// these limitations now.
+	podSandboxIDs, err := m.getSandboxIDByPodUID(uid, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	pod := &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: namespace,
+			UID:       uid,
+		},
+	}
+
+	podFullName := format.Pod(pod)
+
+	klog.V(4).InfoS("getSandboxIDByPodUID got sandbox IDs for pod", "podSandboxID", podSandboxIDs, "pod", klog.KObj(pod))
+
+	sandboxStatuses := []*runtimeapi.PodSandboxStatus{}
+	podIPs := []string{}
+	for idx, podSandboxID := range podSandboxIDs {
+		podSandboxStatus, err := m.runtimeService.PodSandboxStatus(podSandboxID)
+		if err != nil {
+			klog.ErrorS(err, "PodSandboxStatus of sandbox for pod", "podSandboxID", podSandboxID, "pod", klog.KObj(pod))
+			return nil, err
+		}
+		sandboxStatuses = append(sandboxStatuses, podSandboxStatus)
+		// Only get pod IP from latest sandbox
+		if idx == 0 && podSandboxStatus.State == runtimeapi.PodSandboxState_SANDBOX_READY {
+			podIPs = m.determinePodSandboxIPs(namespace, name, podSandboxStatus)
+		}
+	}
+
+	// Get statuses of all containers visible in the pod.
+	containerStatuses, err := m.getPodContainerStatuses(uid, name, namespace)
+	if err != nil {
+		klog.ErrorS(err, "getPodContainerStatuses for pod failed", "pod", podFullName)
+		return nil, err
+	}
+
+	return &kubecontainer.PodStatus{
+		ID:                uid,
+		Name:              name,
+		Namespace:         namespace,
+		IPs:               podIPs,
+		SandboxStatuses:   sandboxStatuses,
+		ContainerStatuses: containerStatuses,
+	}, nil
+}
+
+// DeleteContainer removes a container.
+func (m *criManager) DeleteContainer(containerID kubecontainer.ContainerID) error {
+	return m.removeContainer(containerID.ID)
+}
+
+// UpdatePodCIDR is just a passthrough method to update the runtimeConfig of the shim
+// with the podCIDR supplied by the kubelet.
+func (m *criManager) UpdatePodCIDR(podCIDR string) error {
+	klog.InfoS("Updating runtime config through cri with podcidr", "CIDR", podCIDR)
+	return m.runtimeService.UpdateRuntimeConfig(
+		&runtimeapi.RuntimeConfig{
+			NetworkConfig: &runtimeapi.NetworkConfig{
+				PodCidr: podCIDR,
+			},
+		})
+}
+
+// podActions keeps information what to do for a pod.
+type podActions struct {
+	// Stop all running (regular, init and ephemeral) containers and the sandbox for the pod.
+	KillPod bool
+	// Whether need to create a new sandbox. If needed to kill pod and create
+	// a new pod sandbox, all init containers need to be purged (i.e., removed).
+	CreateSandbox bool
+	// The id of existing sandbox. It is used for starting containers in ContainersToStart.
+	SandboxID string
+	// The attempt number of creating sandboxes for the pod.
+	Attempt uint32
+
+	// The next init container to start.
+	NextInitContainerToStart *v1.Container
+	// ContainersToStart keeps a list of indexes for the containers to start,
+	// where the index is the index of the specific container in the pod spec (
+	// pod.Spec.Containers.
+	ContainersToStart []int
+	// ContainersToKill keeps a map of containers that need to be killed, note that
+	// the key is the container ID of the container, while
+	// the value contains necessary information to kill a container.
+	ContainersToKill map[kubecontainer.ContainerID]containerToKillInfo
+}
+
+// containerToKillInfo contains necessary information to kill a container.
+type containerToKillInfo struct {
+	// The spec of the container.
+	container *v1.Container
+	// The name of the container.
+	name string
+	// The message indicates why the container will be killed.
+	message string
+}
+
+// podSandboxChanged checks whether the spec of the pod is changed and returns
+// (changed, new attempt, original sandboxID if exist).
+func (m *criManager) podSandboxChanged(pod *v1.Pod, podStatus *kubecontainer.PodStatus) (bool, uint32, string) {
+	if len(podStatus.SandboxStatuses) == 0 {
+		klog.V(2).InfoS("No sandbox for pod can be found. Need to start a new one", "pod", klog.KObj(pod))
+		return true, 0, ""
+	}
+
+	readySandboxCount := 0
+	for _, s := range podStatus.SandboxStatuses {
+		if s.State == runtimeapi.PodSandboxState_SANDBOX_READY {
+			readySandboxCount++
+		}
+	}
+
+	// Needs to create a new sandbox when readySandboxCount > 1 or the ready sandbox is not the latest one.
+	sandboxStatus := podStatus.SandboxStatuses[0]
+	if readySandboxCount > 1 {
+		klog.V(2).InfoS("Multiple sandboxes are ready for Pod. Need to reconcile them", "pod", klog.KObj(pod))
+		return true, sandboxStatus.Metadata.Attempt + 1, sandboxStatus.Id
+	}
+	if sandboxStatus.State != runtimeapi.PodSandboxState_SANDBOX_READY {
+		klog.V(2).InfoS("No ready sandbox for pod can be found. Need to start a new one", "pod", klog.KObj(pod))
+		return true, sandboxStatus.Metadata.Attempt + 1, sandboxStatus.Id
+	}
+
+	// Needs to create a new sandbox when network namespace changed.
+	if sandboxStatus.GetLinux().GetNamespaces().GetOptions().GetNetwork() != networkNamespaceForPod(pod) {
+		klog.V(2).InfoS("Sandbox for pod has changed. Need to start a new one", "pod", klog.KObj(pod))
+		return true, sandboxStatus.Metadata.Attempt + 1, ""
+	}
+
+	// Needs to create a new sandbox when the sandbox does not have an IP address.
+	if !kubecontainer.IsHostNetworkPod(pod) && sandboxStatus.GetNetwork().GetIp() == "" {
+		klog.V(2).InfoS("Sandbox for pod has no IP address. Need to start a new one", "pod", klog.KObj(pod))
+		return true, sandboxStatus.Metadata.Attempt + 1, sandboxStatus.Id
+	}
+
+	return false, sandboxStatus.Metadata.Attempt, sandboxStatus.Id
+}
+
+// computePodActions checks whether the pod spec has changed and returns the changes if true.
+func (m *criManager) computePodActions(pod *v1.Pod, podStatus *kubecontainer.PodStatus) podActions {
+	klog.V(5).InfoS("Syncing Pod", "pod", klog.KObj(pod))
+
+	createPodSandbox, attempt, sandboxID := m.podSandboxChanged(pod, podStatus)
+	changes := podActions{
+		KillPod:           createPodSandbox,
+		CreateSandbox:     createPodSandbox,
+		SandboxID:         sandboxID,
+		Attempt:           attempt,
+		ContainersToStart: []int{},
+		ContainersToKill:  make(map[kubecontainer.ContainerID]containerToKillInfo),
+	}
+
+	// If we need to (re-)create the pod sandbox, everything will need to be
+	// killed and recreated, and init containers should be purged.
+	if createPodSandbox {
+		if !shouldRestartOnFailure(pod) && attempt != 0 && len(podStatus.ContainerStatuses) != 0 {
+			// Should not restart the pod, just return.
+			// we should not create a sandbox for a pod if it is already done.
+			// if all containers are done and should not be started, there is no need to create a new sandbox.
+			// this stops confusing logs on pods whose containers all have exit codes, but we recreate a sandbox before terminating it.
+			changes.CreateSandbox = false
+			return changes
+		}
+
+		// Start all containers by default but exclude the ones that succeeded if
+		// RestartPolicy is OnFailure.
+		var containersToStart []int
+		for idx, c := range pod.Spec.Containers {
+			if pod.Spec.RestartPolicy == v1.RestartPolicyOnFailure && containerSucceeded(&c, podStatus) {
+				continue
+			}
+			containersToStart = append(containersToStart, idx)
+		}
+		// We should not create a sandbox for a Pod if initialization is done and there is no container to start.
+		if len(containersToStart) == 0 {
+			_, _, done := findNextInitContainerToRun(pod, podStatus)
+			if done {
+				changes.CreateSandbox = false
+				return changes
+			}
+		}
+
+		if len(pod.Spec.InitContainers) != 0 {
+			// Pod has init containers, return the first one.
+			changes.NextInitContainerToStart = &pod.Spec.InitContainers[0]
+			return changes
+		}
+		changes.ContainersToStart = containersToStart
+		return changes
+	}
+
+	// Check initialization progress.
+	initLastStatus, next, done := findNextInitContainerToRun(pod, podStatus)
+	if !done {
+		if next != nil {
+			initFailed := initLastStatus != nil && isInitContainerFailed(initLastStatus)
+			if initFailed && !shouldRestartOnFailure(pod) {
+				changes.KillPod = true
+			} else {
+				// Always try to stop containers in unknown state first.
+				if initLastStatus != nil && initLastStatus.State == kubecontainer.ContainerStateUnknown {
+					changes.ContainersToKill[initLastStatus.ID] = containerToKillInfo{
+						name:      next.Name,
+						container: next,
+						message: fmt.Sprintf("Init container is in %q state, try killing it before restart",
+							initLastStatus.State),
+					}
+				}
+				changes.NextInitContainerToStart = next
+			}
+		}
+		// Initialization failed or still in progress. Skip inspecting non-init
+		// containers.
+		return changes
+	}
+
+	// Number of running containers to keep.
+	keepCount := 0
+	for idx, container := range pod.Spec.Containers {
+		containerStatus := podStatus.FindContainerStatusByName(container.Name)
+
+		// If container does not exist, or is not running, check whether we
+		// need to restart it.
+		if containerStatus == nil || containerStatus.State != kubecontainer.ContainerStateRunning {
+			if kubecontainer.ShouldContainerBeRestarted(&container, pod, podStatus) {
+				klog.V(3).InfoS("Container of pod is not in the desired state and shall be started", "containerName", container.Name, "pod", klog.KObj(pod))
+				changes.ContainersToStart = append(changes.ContainersToStart, idx)
+				if containerStatus != nil && containerStatus.State == kubecontainer.ContainerStateUnknown {
+					// If container is in unknown state, we don't know whether it
+					// is actually running or not, always try killing it before
+					// restart to avoid having 2 running instances of the same container.
+					changes.ContainersToKill[containerStatus.ID] = containerToKillInfo{
+						name:      containerStatus.Name,
+						container: &pod.Spec.Containers[idx],
+						message: fmt.Sprintf("Container is in %q state, try killing it before restart",
+							containerStatus.State),
+					}
+				}
+			}
+			continue
+		}
+
+		// The container is running, but kill the container if any of the following condition is met.
+		var message string
+		restart := shouldRestartOnFailure(pod)
+		if expectedHash := kubecontainer.HashContainer(&container); containerStatus.Hash != expectedHash {
+			message = fmt.Sprintf("Container %s definition changed", container.Name)
+			// Restart regardless of the restart policy because the container
+			// spec changed.
+			restart = true
+		} else {
+			// Keep the container.
+			keepCount++
+			continue
+		}
+
+		// We need to kill the container, but if we also want to restart the
+		// container afterwards, make the intent clear in the message. Also do
+		// not kill the container if the restart policy is Never.
+		if restart {
+			message = fmt.Sprintf("%s, will be restarted", message)
+			changes.ContainersToStart = append(changes.ContainersToStart, idx)
+		}
+
+		changes.ContainersToKill[containerStatus.ID] = containerToKillInfo{
+			name:      containerStatus.Name,
+			container: &pod.Spec.Containers[idx],
+			message:   message,
+		}
+		klog.V(2).InfoS("Message for Container of pod", "containerName", container.Name, "containerStatusID", containerStatus.ID, "pod", klog.KObj(pod), "containerMessage", message)
+	}
+
+	if keepCount == 0 && len(changes.ContainersToStart) == 0 {
+		changes.KillPod = true
+	}
+	return changes
+}
+
+// SyncPod syncs the running pod into the desired pod by executing following steps:
+//
+//  1. Compute sandbox and container changes.
+//  2. Kill pod sandbox if necessary.
+//  3. Kill any containers that should not be running.
+//  4. Create sandbox if necessary.
+//  5. Start the next init container.
+//  6. Start non-init containers.
+func (m *criManager) SyncPod(pod *v1.Pod, podStatus *kubecontainer.PodStatus, pullSecrets []v1.Secret, backOff *flowcontrol.Backoff) (result kubecontainer.PodSyncResult) {
+	// Step 1: Compute sandbox and container changes.
+	podContainerChanges := m.computePodActions(pod, podStatus)
+	klog.V(3).InfoS("computePodActions got for pod", "podActions", podContainerChanges, "pod", klog.KObj(pod))
+	if podContainerChanges.CreateSandbox {
+		ref, err := kubecontainer.GenerateContainerRef(pod, &v1.Container{})
+		if err != nil {
+			klog.ErrorS(err, "Couldn't make a ref to pod", "pod", klog.KObj(pod))
+		}
+		if podContainerChanges.SandboxID != "" {
+			m.recorder.Eventf(ref, v1.EventTypeNormal, "SandboxChanged", "Pod sandbox changed, it will be killed and re-created.")
+		} else {
+			klog.V(4).InfoS("SyncPod received new pod, will create a sandbox for it", "pod", klog.KObj(pod))
+		}
+	}
+
+	// Step 2: Kill the pod if the sandbox has changed.
+	if podContainerChanges.KillPod {
+		if podContainerChanges.CreateSandbox {
+			klog.V(4).InfoS("Stopping PodSandbox for pod, will start new one", "pod", klog.KObj(pod))
+		} else {
+			klog.V(4).InfoS("Stopping PodSandbox for pod, because all other containers are dead", "pod", klog.KObj(pod))
+		}
+
+		killResult := m.killPodWithSyncResult(pod, kubecontainer.ConvertPodStatusToRunningPod(m.runtimeName, podStatus), nil)
+		result.AddPodSyncResult(killResult)
+		if killResult.Error() != nil {
+			klog.ErrorS(killResult.Error(), "killPodWithSyncResult failed")
+			return
+		}
+
+		if podContainerChanges.CreateSandbox {
+			m.purgeInitContainers(pod, podStatus)
+		}
+	} else {
+		// Step 3: kill any running containers in this pod which are not to keep.
+		for containerID, containerInfo := range podContainerChanges.ContainersToKill {
+			klog.V(3).InfoS("Killing unwanted container for pod", "containerName", containerInfo.name, "containerID", containerID, "pod", klog.KObj(pod))
+			killContainerResult := kubecontainer.NewSyncResult(kubecontainer.KillContainer, containerInfo.name)
+			result.AddSyncResult(killContainerResult)
+			if err := m.killContainer(pod, containerID, containerInfo.name, containerInfo.message, nil); err != nil {
+				killContainerResult.Fail(kubecontainer.ErrKillContainer, err.Error())
+				klog.ErrorS(err, "killContainer for pod failed", "containerName", containerInfo.name, "containerID", containerID, "pod", klog.KObj(pod))
+				return
+			}
+		}
+	}
+
+	// Keep terminated init containers fairly aggressively controlled
+	// This is an optimization because container removals are typically handled
+	// by container garbage collector.
+	m.pruneInitContainersBeforeStart(pod, podStatus)
+
+	// We pass the value of the PRIMARY podIP and list of podIPs down to
+	// generatePodSandboxConfig and generateContainerConfig, which in turn
+	// passes it to various other functions, in order to facilitate functionality
+	// that requires this value (hosts file and downward API) and avoid races determining
+	// the pod IP in cases where a container requires restart but the
+	// podIP isn't in the status manager yet. The list of podIPs is used to
+	// generate the hosts file.
+	//
+	// We default to the IPs in the passed-in pod status, and overwrite them if the
+	// sandbox needs to be (re)started.
+	var podIPs []string
+	if podStatus != nil {
+		podIPs = podStatus.IPs
+	}
+
+	// Step 4: Create a sandbox for the pod if necessary.
+	podSandboxID := podContainerChanges.SandboxID
+	if podContainerChanges.CreateSandbox {
+		var msg string
+		var err error
+
+		klog.V(4).InfoS("Creating PodSandbox for pod", "pod", klog.KObj(pod))
+		createSandboxResult := kubecontainer.NewSyncResult(kubecontainer.CreatePodSandbox, format.Pod(pod))
+		result.AddSyncResult(createSandboxResult)
+		podSandboxID, msg, err = m.createPodSandbox(pod, podContainerChanges.Attempt)
+		if err != nil {
+			createSandboxResult.Fail(kubecontainer.ErrCreatePodSandbox, msg)
+			klog.ErrorS(err, "CreatePodSandbox for pod failed", "pod", klog.KObj(pod))
+			ref, referr := kubecontainer.GenerateContainerRef(pod, &v1.Container{})
+			if referr != nil {
+				klog.ErrorS(referr, "Couldn't make a ref to pod", "pod", klog.KObj(pod))
+			}
+			m.recorder.Eventf(ref, v1.EventTypeWarning, "FailedCreatePodSandBox", "Failed to create pod sandbox: %v", err)
+			return
+		}
+		klog.V(4).InfoS("Created PodSandbox for pod", "podSandboxID", podSandboxID, "pod", klog.KObj(pod))
+
+		podSandboxStatus, err := m.runtimeService.PodSandboxStatus(podSandboxID)
+		if err != nil {
+			ref, referr := kubecontainer.GenerateContainerRef(pod, &v1.Container{})
+			if referr != nil {
+				klog.ErrorS(referr, "Couldn't make a ref to pod", "pod", klog.KObj(pod))
+			}
+			m.recorder.Eventf(ref, v1.EventTypeWarning, "FailedStatusPodSandBox", "Unable to get pod sandbox status: %v", err)
+			klog.ErrorS(err, "Failed to get pod sandbox status; Skipping pod", "pod", klog.KObj(pod))
+			result.Fail(err)
+			return
+		}
+
+		// If we ever allow updating a pod from non-host-network to
+		// host-network, we may use a stale IP.
+		if !kubecontainer.IsHostNetworkPod(pod) {
+			// Overwrite the podIPs passed in the pod status, since we just started the pod sandbox.
+			podIPs = m.determinePodSandboxIPs(pod.Namespace, pod.Name, podSandboxStatus)
+			klog.V(4).InfoS("Determined the ip for pod after sandbox changed", "IPs", podIPs, "pod", klog.KObj(pod))
+		}
+	}
+
+	// the start containers routines depend on pod ip(as in primary pod ip)
+	// instead of trying to figure out if we have 0 < len(podIPs)
+	// everytime, we short circuit it here
+	podIP := ""
+	if len(podIPs) != 0 {
+		podIP = podIPs[0]
+	}
+
+	// Get podSandboxConfig for containers to start.
+	configPodSandboxResult := kubecontainer.NewSyncResult(kubecontainer.ConfigPodSandbox, podSandboxID)
+	result.AddSyncResult(configPodSandboxResult)
+	podSandboxConfig, err := m.generatePodSandboxConfig(pod, podContainerChanges.Attempt)
+	if err != nil {
+		message := fmt.Sprintf("GeneratePodSandboxConfig for pod %q failed: %v", format.Pod(pod), err)
+		klog.ErrorS(err, "GeneratePodSandboxConfig for pod failed", "pod", klog.KObj(pod))
+		configPodSandboxResult.Fail(kubecontainer.ErrConfigPodSandbox, message)
+		return
+	}
+
+	// Helper containing boilerplate common to starting all types of containers.
+	// typeName is a description used to describe this type of container in log messages,
+	// currently: "container" or "init container".
+	start := func(typeName string, container *v1.Container) error {
+		startContainerResult := kubecontainer.NewSyncResult(kubecontainer.StartContainer, container.Name)
+		result.AddSyncResult(startContainerResult)
+
+		isInBackOff, msg, err := m.doBackOff(pod, container, podStatus, backOff)
+		if isInBackOff {
+			startContainerResult.Fail(err, msg)
+			klog.V(4).InfoS("Backing Off restarting container in pod", "containerType", typeName, "container", container, "pod", klog.KObj(pod))
+			return err
+		}
+
+		klog.V(4).InfoS("Creating container in pod", "containerType", typeName, "container", container, "pod", klog.KObj(pod))
+		if msg, err := m.startContainer(podSandboxID, podSandboxConfig, pod, container, podStatus, pullSecrets, podIP, podIPs); err != nil {
+			startContainerResult.Fail(err, msg)
+			// known errors that are logged in other places are logged at higher levels here to avoid
+			// repetitive log spam
+			switch {
+			case err == images.ErrImagePullBackOff:
+				klog.V(3).InfoS("Container start failed in pod", "containerType", typeName, "containerName", container.Name, "pod", klog.KObj(pod), "containerMessage", msg, "err", err)
+			default:
+				utilruntime.HandleError(fmt.Errorf("%v %+v start failed in pod %v: %v: %s", typeName, container, format.Pod(pod), err, msg))
+			}
+			return err
+		}
+
+		return nil
+	}
+
+	// Step 5: start the init container.
+	if container := podContainerChanges.NextInitContainerToStart; container != nil {
+		// Start the next init container.
+		if err := start("init container", container); err != nil {
+			return
+		}
+
+		// Successfully started the container; clear the entry in the failure
+		klog.V(4).InfoS("Completed init container for pod", "containerName", container.Name, "pod", klog.KObj(pod))
+	}
+
+	// Step 6: start containers in podContainerChanges.ContainersToStart.
+	for _, idx := range podContainerChanges.ContainersToStart {
+		start("container", &pod.Spec.Containers[idx])
+	}
+
+	return
+}
+
+// KillPod kills all the containers of a pod. Pod may be nil, running pod must not be.
+// gracePeriodOverride if specified allows the caller to override the pod default grace period.
+// only hard kill paths are allowed to specify a gracePeriodOverride in the kubelet in order to not corrupt user data.
+// it is useful when doing SIGKILL for hard eviction scenarios, or max grace period during soft eviction scenarios.
+func (m *criManager) KillPod(pod *v1.Pod, runningPod kubecontainer.Pod, gracePeriodOverride *int64) error {
+	err := m.killPodWithSyncResult(pod, runningPod, gracePeriodOverride)
+	return err.Error()
+}
+
+// killPodWithSyncResult kills a runningPod and returns SyncResult.
+// Note: The pod passed in could be *nil* when kubelet restarted.
+func (m *criManager) killPodWithSyncResult(pod *v1.Pod, runningPod kubecontainer.Pod, gracePeriodOverride *int64) (result kubecontainer.PodSyncResult) {
+	killContainerResults := m.killContainersWithSyncResult(pod, runningPod, gracePeriodOverride)
+	for _, containerResult := range killContainerResults {
+		result.AddSyncResult(containerResult)
+	}
+
+	// Stop all sandboxes belongs to same pod
+	for _, podSandbox := range runningPod.Sandboxes {
+		killSandboxResult := kubecontainer.NewSyncResult(kubecontainer.KillPodSandbox, runningPod.ID)
+		result.AddSyncResult(killSandboxResult)
+		if err := m.runtimeService.StopPodSandbox(podSandbox.ID.ID); err != nil {
+			killSandboxResult.Fail(kubecontainer.ErrKillPodSandbox, err.Error())
+			klog.ErrorS(nil, "Failed to stop sandbox", "podSandboxID", podSandbox.ID)
+		}
+	}
+
+	return
+}
+
+// killContainersWithSyncResult kills all pod's containers with sync results.
+func (m *criManager) killContainersWithSyncResult(pod *v1.Pod, runningPod kubecontainer.Pod, gracePeriodOverride *int64) (syncResults []*kubecontainer.SyncResult) {
+	containerResults := make(chan *kubecontainer.SyncResult, len(runningPod.Containers))
+	wg := sync.WaitGroup{}
+
+	wg.Add(len(runningPod.Containers))
+	for _, container := range runningPod.Containers {
+		go func(container *kubecontainer.Container) {
+			defer utilruntime.HandleCrash()
+			defer wg.Done()
+
+			killContainerResult := kubecontainer.NewSyncResult(kubecontainer.KillContainer, container.Name)
+			if err := m.killContainer(pod, container.ID, container.Name, "", gracePeriodOverride); err != nil {
+				killContainerResult.Fail(kubecontainer.ErrKillContainer, err.Error())
+				// Use runningPod for logging as the pod passed in could be *nil*.
+				klog.ErrorS(err, "Kill container failed", "pod", klog.KRef(runningPod.Namespace, runningPod.Name), "podUID", runningPod.ID,
+					"containerName", container.Name, "containerID", container.ID)
+			}
+			containerResults <- killContainerResult
+		}(container)
+	}
+	wg.Wait()
+	close(containerResults)
+
+	for containerResult := range containerResults {
+		syncResults = append(syncResults, containerResult)
+	}
+	return
+}
+
+// getSandboxIDByPodUID gets the sandbox ID by podUID and returns ([]sandboxID, error).
+// Param state could be nil in order to get all sandboxes belonging to same pod.
+func (m *criManager) getSandboxIDByPodUID(podUID types.UID, state *runtimeapi.PodSandboxState) ([]string, error) {
+	filter := &runtimeapi.PodSandboxFilter{
+		LabelSelector: map[string]string{kubetypes.KubernetesPodUIDLabel: string(podUID)},
+	}
+	if state != nil {
+		filter.State = &runtimeapi.PodSandboxStateValue{
+			State: *state,
+		}
+	}
+	sandboxes, err := m.runtimeService.ListPodSandbox(filter)
+	if err != nil {
+		klog.ErrorS(err, "Failed to list sandboxes for pod", "podUID", podUID)
+		return nil, err
+	}
+
+	if len(sandboxes) == 0 {
+		return nil, nil
+	}
+
+	// Sort with newest first.
+	sandboxIDs := make([]string, len(sandboxes))
+	sort.Sort(podSandboxByCreated(sandboxes))
+	for i, s := range sandboxes {
+		sandboxIDs[i] = s.Id
+	}
+
+	return sandboxIDs, nil
+}
@@ -0,0 +1,389 @@
+package cri
+
+import (
+	"errors"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/xuliangTang/mykubelet/pkg/api/legacyscheme"
+	apisv1 "github.com/xuliangTang/mykubelet/pkg/apis/core/v1"
+	kubecontainer "github.com/xuliangTang/mykubelet/pkg/kubelet/container"
+	"github.com/xuliangTang/mykubelet/pkg/kubelet/cri/remote"
+	"github.com/xuliangTang/mykubelet/pkg/kubelet/cri/remote/fake"
+	"github.com/xuliangTang/mykubelet/pkg/kubelet/images"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/client-go/util/flowcontrol"
+	runtimeapi "k8s.io/cri-api/pkg/apis/runtime/v1alpha2"
+)
+
+func init() {
+	// Events refer to the pod, whose kind is looked up in the scheme.
+	if err := apisv1.AddToScheme(legacyscheme.Scheme); err != nil {
+		panic(err)
+	}
+}
+
+type fakeRuntimeHelper struct {
+	podDir string
+}
+
+func (h *fakeRuntimeHelper) GenerateRunContainerOptions(pod *v1.Pod, container *v1.Container, podIP string, podIPs []string) (*kubecontainer.RunContainerOptions, func(), error) {
+	return &kubecontainer.RunContainerOptions{}, nil, nil
+}
+
+func (h *fakeRuntimeHelper) GetPodDNS(pod *v1.Pod) (*runtimeapi.DNSConfig, error) {
+	return nil, nil
+}
+
+func (h *fakeRuntimeHelper) GetPodCgroupParent(pod *v1.Pod) string {
+	return ""
+}
+
+func (h *fakeRuntimeHelper) GetPodDir(podUID types.UID) string {
+	return filepath.Join(h.podDir, string(podUID))
+}
+
+func (h *fakeRuntimeHelper) GeneratePodHostNameAndDomain(pod *v1.Pod) (string, string, error) {
+	return pod.Name, "", nil
+}
+
+func (h *fakeRuntimeHelper) GetExtraSupplementalGroupsForPod(pod *v1.Pod) []int64 {
+	return nil
+}
+
+type fakePodStateProvider struct{}
+
+func (fakePodStateProvider) ShouldPodContentBeRemoved(types.UID) bool { return false }
+func (fakePodStateProvider) ShouldPodRuntimeBeRemoved(types.UID) bool { return false }
+
+// newTestCRIManager starts a fake CRI runtime on a unix socket and returns a
+// criManager connected to it.
+func newTestCRIManager(t *testing.T) (*criManager, *fake.RemoteRuntime, *record.FakeRecorder) {
+	t.Helper()
+	dir := t.TempDir()
+	endpoint := filepath.Join(dir, "cri.sock")
+	fakeRuntime := fake.NewFakeRemoteRuntime()
+	if err := fakeRuntime.Start(endpoint); err != nil {
+		t.Fatalf("failed to start fake runtime: %v", err)
+	}
+	t.Cleanup(fakeRuntime.Stop)
+
+	runtimeService, err := remote.NewRemoteRuntimeService(endpoint, 10*time.Second)
+	if err != nil {
+		t.Fatalf("failed to connect to the runtime service: %v", err)
+	}
+	imageService, err := remote.NewRemoteImageService(endpoint, 10*time.Second)
+	if err != nil {
+		t.Fatalf("failed to connect to the image service: %v", err)
+	}
+	recorder := record.NewFakeRecorder(100)
+	runtime, err := NewCRIRuntimeManager(runtimeService, imageService, filepath.Join(dir, "pods"),
+		&fakeRuntimeHelper{podDir: filepath.Join(dir, "kubelet")}, fakePodStateProvider{}, recorder,
+		flowcontrol.NewBackOff(time.Second, time.Minute))
+	if err != nil {
+		t.Fatalf("failed to create the runtime manager: %v", err)
+	}
+	return runtime.(*criManager), fakeRuntime, recorder
+}
+
+func makeTestPod() *v1.Pod {
+	return &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			UID:       "12345678",
+			Name:      "foo",
+			Namespace: "new",
+		},
+		Spec: v1.PodSpec{
+			Containers: []v1.Container{
+				{Name: "foo1", Image: "busybox", ImagePullPolicy: v1.PullIfNotPresent},
+				{Name: "foo2", Image: "nginx", ImagePullPolicy: v1.PullIfNotPresent},
+			},
+		},
+	}
+}
+
+// syncTestPod syncs the pod from its current status in the runtime.
+func syncTestPod(t *testing.T, m *criManager, pod *v1.Pod) *kubecontainer.PodSyncResult {
+	t.Helper()
+	podStatus, err := m.GetPodStatus(pod.UID, pod.Name, pod.Namespace)
+	if err != nil {
+		t.Fatalf("failed to get pod status: %v", err)
+	}
+	result := m.SyncPod(pod, podStatus, nil, flowcontrol.NewBackOff(time.Second, time.Minute))
+	return &result
+}
+
+// drainEvents returns the reasons of the events recorded so far.
+func drainEvents(recorder *record.FakeRecorder) []string {
+	var reasons []string
+	for {
+		select {
+		case event := <-recorder.Events:
+			// Events are formatted as "<type> <reason> <message>".
+			reasons = append(reasons, strings.Fields(event)[1])
+		default:
+			return reasons
+		}
+	}
+}
+
+func hasString(list []string, s string) bool {
+	for _, l := range list {
+		if l == s {
+			return true
+		}
+	}
+	return false
+}
+
+func TestSyncPod(t *testing.T) {
+	m, _, recorder := newTestCRIManager(t)
+	pod := makeTestPod()
+
+	result := syncTestPod(t, m, pod)
+	if err := result.Error(); err != nil {
+		t.Fatalf("unexpected sync error: %v", err)
+	}
+
+	podStatus, err := m.GetPodStatus(pod.UID, pod.Name, pod.Namespace)
+	if err != nil {
+		t.Fatalf("failed to get pod status: %v", err)
+	}
+	if len(podStatus.SandboxStatuses) != 1 || podStatus.SandboxStatuses[0].State != runtimeapi.PodSandboxState_SANDBOX_READY {
+		t.Fatalf("expected one ready sandbox, got %+v", podStatus.SandboxStatuses)
+	}
+	if len(podStatus.IPs) != 1 || !strings.HasPrefix(podStatus.IPs[0], fake.FakePodSandboxIPPrefix) {
+		t.Errorf("expected the IP of the sandbox, got %v", podStatus.IPs)
+	}
+	var names []string
+	for _, c := range podStatus.ContainerStatuses {
+		if c.State != kubecontainer.ContainerStateRunning {
+			t.Errorf("expected container %q to be running, got %q", c.Name, c.State)
+		}
+		names = append(names, c.Name)
+	}
+	sort.Strings(names)
+	if strings.Join(names, ",") != "foo1,foo2" {
+		t.Errorf("expected containers foo1,foo2, got %v", names)
+	}
+
+	pods, err := m.GetPods(false)
+	if err != nil {
+		t.Fatalf("failed to get pods: %v", err)
+	}
+	if len(pods) != 1 || pods[0].ID != pod.UID || len(pods[0].Containers) != 2 || len(pods[0].Sandboxes) != 1 {
+		t.Errorf("expected the running pod with its sandbox and containers, got %+v", pods)
+	}
+
+	events := drainEvents(recorder)
+	for _, reason := range []string{"Pulled", "Created", "Started"} {
+		if !hasString(events, reason) {
+			t.Errorf("expected a %s event, got %v", reason, events)
+		}
+	}
+
+	// A second sync keeps the running containers.
+	result = syncTestPod(t, m, pod)
+	if err := result.Error(); err != nil {
+		t.Fatalf("unexpected sync error: %v", err)
+	}
+	if len(result.SyncResults) != 1 || result.SyncResults[0].Action != kubecontainer.ConfigPodSandbox {
+		t.Errorf("expected no action on the running pod, got %+v", result.SyncResults)
+	}
+}
+
+func TestSyncPodRestartsExitedContainer(t *testing.T) {
+	m, fakeRuntime, _ := newTestCRIManager(t)
+	pod := makeTestPod()
+	if err := syncTestPod(t, m, pod).Error(); err != nil {
+		t.Fatalf("unexpected sync error: %v", err)
+	}
+
+	podStatus, err := m.GetPodStatus(pod.UID, pod.Name, pod.Namespace)
+	if err != nil {
+		t.Fatalf("failed to get pod status: %v", err)
+	}
+	exited := podStatus.FindContainerStatusByName("foo1")
+	if err := fakeRuntime.RuntimeService.SetContainerExited(exited.ID.ID, 1); err != nil {
+		t.Fatalf("failed to exit container: %v", err)
+	}
+
+	if err := syncTestPod(t, m, pod).Error(); err != nil {
+		t.Fatalf("unexpected sync error: %v", err)
+	}
+	podStatus, err = m.GetPodStatus(pod.UID, pod.Name, pod.Namespace)
+	if err != nil {
+		t.Fatalf("failed to get pod status: %v", err)
+	}
+	restarted := podStatus.FindContainerStatusByName("foo1")
+	if restarted.ID == exited.ID || restarted.State != kubecontainer.ContainerStateRunning || restarted.RestartCount != 1 {
+		t.Errorf("expected foo1 to be restarted, got %+v", restarted)
+	}
+}
+
+func TestKillPod(t *testing.T) {
+	m, _, _ := newTestCRIManager(t)
+	pod := makeTestPod()
+	if err := syncTestPod(t, m, pod).Error(); err != nil {
+		t.Fatalf("unexpected sync error: %v", err)
+	}
+
+	podStatus, err := m.GetPodStatus(pod.UID, pod.Name, pod.Namespace)
+	if err != nil {
+		t.Fatalf("failed to get pod status: %v", err)
+	}
+	runningPod := kubecontainer.ConvertPodStatusToRunningPod(m.runtimeName, podStatus)
+	if err := m.KillPod(pod, runningPod, nil); err != nil {
+		t.Fatalf("failed to kill pod: %v", err)
+	}
+
+	podStatus, err = m.GetPodStatus(pod.UID, pod.Name, pod.Namespace)
+	if err != nil {
+		t.Fatalf("failed to get pod status: %v", err)
+	}
+	if len(podStatus.IPs) != 0 {
+		t.Errorf("expected no IP for a pod without ready sandbox, got %v", podStatus.IPs)
+	}
+	for _, s := range podStatus.SandboxStatuses {
+		if s.State != runtimeapi.PodSandboxState_SANDBOX_NOTREADY {
+			t.Errorf("expected sandbox %q to be stopped, got %v", s.Id, s.State)
+		}
+	}
+	for _, c := range podStatus.ContainerStatuses {
+		if c.State != kubecontainer.ContainerStateExited {
+			t.Errorf("expected container %q to be exited, got %q", c.Name, c.State)
+		}
+	}
+}
+
+func TestKillPodStopContainerError(t *testing.T) {
+	m, fakeRuntime, _ := newTestCRIManager(t)
+	pod := makeTestPod()
+	pod.Spec.Containers = pod.Spec.Containers[:1]
+	if err := syncTestPod(t, m, pod).Error(); err != nil {
+		t.Fatalf("unexpected sync error: %v", err)
+	}
+	podStatus, err := m.GetPodStatus(pod.UID, pod.Name, pod.Namespace)
+	if err != nil {
+		t.Fatalf("failed to get pod status: %v", err)
+	}
+
+	fakeRuntime.RuntimeService.InjectError("StopContainer", errors.New("stop failed"))
+	err = m.KillPod(pod, kubecontainer.ConvertPodStatusToRunningPod(m.runtimeName, podStatus), nil)
+	if err == nil || !strings.Contains(err.Error(), "stop failed") {
+		t.Errorf("expected the stop error, got %v", err)
+	}
+}
+
+func TestSyncPodErrors(t *testing.T) {
+	for desc, test := range map[string]struct {
+		inject         func(*fake.RemoteRuntime)
+		expectedAction kubecontainer.SyncAction
+		expectedErr    error
+		expectedEvent  string
+	}{
+		"sandbox creation fails": {
+			inject: func(f *fake.RemoteRuntime) {
+				f.RuntimeService.InjectError("RunPodSandbox", errors.New("no sandbox"))
+			},
+			expectedAction: kubecontainer.CreatePodSandbox,
+			expectedErr:    kubecontainer.ErrCreatePodSandbox,
+			expectedEvent:  "FailedCreatePodSandBox",
+		},
+		"image pull fails": {
+			inject: func(f *fake.RemoteRuntime) {
+				f.ImageService.InjectError("PullImage", errors.New("no image"))
+			},
+			expectedAction: kubecontainer.StartContainer,
+			expectedErr:    images.ErrImagePull,
+			expectedEvent:  "Failed",
+		},
+		"container creation fails": {
+			inject: func(f *fake.RemoteRuntime) {
+				f.RuntimeService.InjectError("CreateContainer", errors.New("no container"))
+			},
+			expectedAction: kubecontainer.StartContainer,
+			expectedErr:    ErrCreateContainer,
+			expectedEvent:  "Failed",
+		},
+		"container start fails": {
+			inject: func(f *fake.RemoteRuntime) {
+				f.RuntimeService.InjectError("StartContainer", errors.New("no start"))
+			},
+			expectedAction: kubecontainer.StartContainer,
+			expectedErr:    kubecontainer.ErrRunContainer,
+			expectedEvent:  "Failed",
+		},
+	} {
+		t.Run(desc, func(t *testing.T) {
+			m, fakeRuntime, recorder := newTestCRIManager(t)
+			pod := makeTestPod()
+			pod.Spec.Containers = pod.Spec.Containers[:1]
+			test.inject(fakeRuntime)
+
+			result := syncTestPod(t, m, pod)
+			if result.Error() == nil {
+				t.Fatal("expected the sync to fail")
+			}
+			var failed *kubecontainer.SyncResult
+			for _, r := range result.SyncResults {
+				if r.Error != nil {
+					failed = r
+				}
+			}
+			if failed == nil || failed.Action != test.expectedAction || failed.Error != test.expectedErr {
+				t.Errorf("expected %s to fail with %v, got %+v", test.expectedAction, test.expectedErr, failed)
+			}
+			if events := drainEvents(recorder); !hasString(events, test.expectedEvent) {
+				t.Errorf("expected a %s event, got %v", test.expectedEvent, events)
+			}
+
+			// The next sync recovers once the runtime does.
+			if err := syncTestPod(t, m, pod).Error(); err != nil && test.expectedErr != images.ErrImagePull {
+				t.Errorf("unexpected error on the next sync: %v", err)
+			}
+		})
+	}
+}
+
+func TestGetPodStatusErrors(t *testing.T) {
+	m, fakeRuntime, _ := newTestCRIManager(t)
+	pod := makeTestPod()
+	if err := syncTestPod(t, m, pod).Error(); err != nil {
+		t.Fatalf("unexpected sync error: %v", err)
+	}
+
+	for _, method := range []string{"ListPodSandbox", "PodSandboxStatus", "ListContainers", "ContainerStatus"} {
+		fakeRuntime.RuntimeService.InjectError(method, errors.New("unavailable"))
+		if _, err := m.GetPodStatus(pod.UID, pod.Name, pod.Namespace); err == nil {
+			t.Errorf("expected GetPodStatus to fail when %s fails", method)
+		}
+	}
+	if _, err := m.GetPodStatus(pod.UID, pod.Name, pod.Namespace); err != nil {
+		t.Errorf("unexpected error once the runtime recovered: %v", err)
+	}
+}
+
+func TestNewCRIRuntimeManagerVersionError(t *testing.T) {
+	endpoint := filepath.Join(t.TempDir(), "cri.sock")
+	fakeRuntime := fake.NewFakeRemoteRuntime()
+	if err := fakeRuntime.Start(endpoint); err != nil {
+		t.Fatalf("failed to start fake runtime: %v", err)
+	}
+	defer fakeRuntime.Stop()
+	runtimeService, err := remote.NewRemoteRuntimeService(endpoint, 10*time.Second)
+	if err != nil {
+		t.Fatalf("failed to connect to the runtime service: %v", err)
+	}
+
+	fakeRuntime.RuntimeService.InjectError("Version", errors.New("unavailable"))
+	if _, err := NewCRIRuntimeManager(runtimeService, nil, t.TempDir(), &fakeRuntimeHelper{}, fakePodStateProvider{}, record.NewFakeRecorder(10), nil); err == nil {
+		t.Error("expected an error when the runtime version can not be read")
+	}
+}
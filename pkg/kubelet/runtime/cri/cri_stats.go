@@ -0,0 +1,37 @@
+package cri
+
+import (
+	"time"
+
+	"github.com/xuliangTang/mykubelet/pkg/kubelet/stats"
+	runtimeapi "k8s.io/cri-api/pkg/apis/runtime/v1alpha2"
+)
+
+// ListContainerInfo returns the running containers, for their usage to be
+// sampled. The runtime does not tell the processes and cgroups of its
+// containers, only the usage of their logs is sampled.
+func (m *criManager) ListContainerInfo() ([]stats.ContainerInfo, error) {
+	containers, err := m.getKubeletContainers(false)
+	if err != nil {
+		return nil, err
+	}
+
+	var infos []stats.ContainerInfo
+	for _, c := range containers {
+		status, err := m.runtimeService.ContainerStatus(c.Id)
+		if err != nil || status.State != runtimeapi.ContainerState_CONTAINER_RUNNING {
+			continue
+		}
+		labeledInfo := getContainerInfoFromLabels(c.Labels)
+		infos = append(infos, stats.ContainerInfo{
+			ID:           c.Id,
+			Name:         labeledInfo.ContainerName,
+			PodUID:       labeledInfo.PodUID,
+			PodName:      labeledInfo.PodName,
+			PodNamespace: labeledInfo.PodNamespace,
+			StartTime:    time.Unix(0, status.StartedAt),
+			LogPath:      status.LogPath,
+		})
+	}
+	return infos, nil
+}
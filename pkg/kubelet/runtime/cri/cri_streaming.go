@@ -0,0 +1,67 @@
+package cri
+
+import (
+	"fmt"
+	"net/url"
+
+	kubecontainer "github.com/xuliangTang/mykubelet/pkg/kubelet/container"
+	"github.com/xuliangTang/mykubelet/pkg/kubelet/util/format"
+	"k8s.io/apimachinery/pkg/types"
+	runtimeapi "k8s.io/cri-api/pkg/apis/runtime/v1alpha2"
+)
+
+// GetExec gets the URL the runtime serves the exec from. The streaming
+// server of the runtime returns absolute URLs, the kubelet server proxies
+// them.
+func (m *criManager) GetExec(id kubecontainer.ContainerID, cmd []string, stdin, stdout, stderr, tty bool) (*url.URL, error) {
+	req := &runtimeapi.ExecRequest{
+		ContainerId: id.ID,
+		Cmd:         cmd,
+		Tty:         tty,
+		Stdin:       stdin,
+		Stdout:      stdout,
+		Stderr:      stderr,
+	}
+	resp, err := m.runtimeService.Exec(req)
+	if err != nil {
+		return nil, err
+	}
+	return url.Parse(resp.Url)
+}
+
+// GetAttach gets the URL the runtime serves the attach from.
+func (m *criManager) GetAttach(id kubecontainer.ContainerID, stdin, stdout, stderr, tty bool) (*url.URL, error) {
+	req := &runtimeapi.AttachRequest{
+		ContainerId: id.ID,
+		Stdin:       stdin,
+		Stdout:      stdout,
+		Stderr:      stderr,
+		Tty:         tty,
+	}
+	resp, err := m.runtimeService.Attach(req)
+	if err != nil {
+		return nil, err
+	}
+	return url.Parse(resp.Url)
+}
+
+// GetPortForward gets the URL the runtime serves the port-forward from.
+func (m *criManager) GetPortForward(podName, podNamespace string, podUID types.UID, ports []int32) (*url.URL, error) {
+	readyState := runtimeapi.PodSandboxState_SANDBOX_READY
+	sandboxIDs, err := m.getSandboxIDByPodUID(podUID, &readyState)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find sandboxID for pod %s: %v", format.PodDesc(podName, podNamespace, podUID), err)
+	}
+	if len(sandboxIDs) == 0 {
+		return nil, fmt.Errorf("failed to find sandboxID for pod %s", format.PodDesc(podName, podNamespace, podUID))
+	}
+	req := &runtimeapi.PortForwardRequest{
+		PodSandboxId: sandboxIDs[0],
+		Port:         ports,
+	}
+	resp, err := m.runtimeService.PortForward(req)
+	if err != nil {
+		return nil, err
+	}
+	return url.Parse(resp.Url)
+}
@@ -0,0 +1,209 @@
+package cri
+
+import (
+	"strconv"
+
+	kubecontainer "github.com/xuliangTang/mykubelet/pkg/kubelet/container"
+	kubetypes "github.com/xuliangTang/mykubelet/pkg/kubelet/types"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/klog/v2"
+)
+
+const (
+	podTerminationGracePeriodLabel = "io.kubernetes.pod.terminationGracePeriod"
+
+	containerHashLabel                     = "io.kubernetes.container.hash"
+	containerRestartCountLabel             = "io.kubernetes.container.restartCount"
+	containerTerminationMessagePathLabel   = "io.kubernetes.container.terminationMessagePath"
+	containerTerminationMessagePolicyLabel = "io.kubernetes.container.terminationMessagePolicy"
+)
+
+type labeledPodSandboxInfo struct {
+	// Labels from v1.Pod
+	Labels       map[string]string
+	PodName      string
+	PodNamespace string
+	PodUID       types.UID
+}
+
+type annotatedPodSandboxInfo struct {
+	// Annotations from v1.Pod
+	Annotations map[string]string
+}
+
+type labeledContainerInfo struct {
+	ContainerName string
+	PodName       string
+	PodNamespace  string
+	PodUID        types.UID
+}
+
+type annotatedContainerInfo struct {
+	Hash                      uint64
+	RestartCount              int
+	PodTerminationGracePeriod *int64
+	TerminationMessagePath    string
+	TerminationMessagePolicy  v1.TerminationMessagePolicy
+}
+
+// newPodLabels creates pod labels from v1.Pod.
+func newPodLabels(pod *v1.Pod) map[string]string {
+	labels := map[string]string{}
+
+	// Get labels from v1.Pod
+	for k, v := range pod.Labels {
+		labels[k] = v
+	}
+
+	labels[kubetypes.KubernetesPodNameLabel] = pod.Name
+	labels[kubetypes.KubernetesPodNamespaceLabel] = pod.Namespace
+	labels[kubetypes.KubernetesPodUIDLabel] = string(pod.UID)
+
+	return labels
+}
+
+// newPodAnnotations creates pod annotations from v1.Pod.
+func newPodAnnotations(pod *v1.Pod) map[string]string {
+	annotations := map[string]string{}
+	for k, v := range pod.Annotations {
+		annotations[k] = v
+	}
+	return annotations
+}
+
+// newContainerLabels creates container labels from v1.Container and v1.Pod.
+func newContainerLabels(container *v1.Container, pod *v1.Pod) map[string]string {
+	labels := map[string]string{}
+	labels[kubetypes.KubernetesPodNameLabel] = pod.Name
+	labels[kubetypes.KubernetesPodNamespaceLabel] = pod.Namespace
+	labels[kubetypes.KubernetesPodUIDLabel] = string(pod.UID)
+	labels[kubetypes.KubernetesContainerNameLabel] = container.Name
+
+	return labels
+}
+
+// newContainerAnnotations creates container annotations from v1.Container and v1.Pod.
+func newContainerAnnotations(container *v1.Container, pod *v1.Pod, restartCount int) map[string]string {
+	annotations := map[string]string{}
+
+	annotations[containerHashLabel] = strconv.FormatUint(kubecontainer.HashContainer(container), 16)
+	annotations[containerRestartCountLabel] = strconv.Itoa(restartCount)
+	annotations[containerTerminationMessagePathLabel] = container.TerminationMessagePath
+	annotations[containerTerminationMessagePolicyLabel] = string(container.TerminationMessagePolicy)
+
+	if pod.Spec.TerminationGracePeriodSeconds != nil {
+		annotations[podTerminationGracePeriodLabel] = strconv.FormatInt(*pod.Spec.TerminationGracePeriodSeconds, 10)
+	}
+
+	return annotations
+}
+
+// getPodSandboxInfoFromLabels gets labeledPodSandboxInfo from labels.
+func getPodSandboxInfoFromLabels(labels map[string]string) *labeledPodSandboxInfo {
+	podSandboxInfo := &labeledPodSandboxInfo{
+		Labels:       make(map[string]string),
+		PodName:      getStringValueFromLabel(labels, kubetypes.KubernetesPodNameLabel),
+		PodNamespace: getStringValueFromLabel(labels, kubetypes.KubernetesPodNamespaceLabel),
+		PodUID:       types.UID(getStringValueFromLabel(labels, kubetypes.KubernetesPodUIDLabel)),
+	}
+
+	// Remain only labels from v1.Pod
+	for k, v := range labels {
+		if k != kubetypes.KubernetesPodNameLabel && k != kubetypes.KubernetesPodNamespaceLabel && k != kubetypes.KubernetesPodUIDLabel {
+			podSandboxInfo.Labels[k] = v
+		}
+	}
+
+	return podSandboxInfo
+}
+
+// getPodSandboxInfoFromAnnotations gets annotatedPodSandboxInfo from annotations.
+func getPodSandboxInfoFromAnnotations(annotations map[string]string) *annotatedPodSandboxInfo {
+	return &annotatedPodSandboxInfo{
+		Annotations: annotations,
+	}
+}
+
+// getContainerInfoFromLabels gets labeledContainerInfo from labels.
+func getContainerInfoFromLabels(labels map[string]string) *labeledContainerInfo {
+	return &labeledContainerInfo{
+		PodName:       getStringValueFromLabel(labels, kubetypes.KubernetesPodNameLabel),
+		PodNamespace:  getStringValueFromLabel(labels, kubetypes.KubernetesPodNamespaceLabel),
+		PodUID:        types.UID(getStringValueFromLabel(labels, kubetypes.KubernetesPodUIDLabel)),
+		ContainerName: getStringValueFromLabel(labels, kubetypes.KubernetesContainerNameLabel),
+	}
+}
+
+// getContainerInfoFromAnnotations gets annotatedContainerInfo from annotations.
+func getContainerInfoFromAnnotations(annotations map[string]string) *annotatedContainerInfo {
+	var err error
+	containerInfo := &annotatedContainerInfo{
+		TerminationMessagePath:   getStringValueFromLabel(annotations, containerTerminationMessagePathLabel),
+		TerminationMessagePolicy: v1.TerminationMessagePolicy(getStringValueFromLabel(annotations, containerTerminationMessagePolicyLabel)),
+	}
+
+	if containerInfo.Hash, err = getUint64ValueFromLabel(annotations, containerHashLabel); err != nil {
+		klog.ErrorS(err, "Unable to get label value from annotations", "label", containerHashLabel, "annotations", annotations)
+	}
+	if containerInfo.RestartCount, err = getIntValueFromLabel(annotations, containerRestartCountLabel); err != nil {
+		klog.ErrorS(err, "Unable to get label value from annotations", "label", containerRestartCountLabel, "annotations", annotations)
+	}
+	if containerInfo.PodTerminationGracePeriod, err = getInt64PointerFromLabel(annotations, podTerminationGracePeriodLabel); err != nil {
+		klog.ErrorS(err, "Unable to get label value from annotations", "label", podTerminationGracePeriodLabel, "annotations", annotations)
+	}
+
+	return containerInfo
+}
+
+func getStringValueFromLabel(labels map[string]string, label string) string {
+	if value, found := labels[label]; found {
+		return value
+	}
+	// Do not report error, because there should be many old containers without label now.
+	klog.V(3).InfoS("Container doesn't have requested label, it may be an old or invalid container", "label", label)
+	// Return empty string "" for these containers, the caller will get value by other ways.
+	return ""
+}
+
+func getIntValueFromLabel(labels map[string]string, label string) (int, error) {
+	if strValue, found := labels[label]; found {
+		intValue, err := strconv.Atoi(strValue)
+		if err != nil {
+			// This really should not happen. Just set value to 0 to handle this abnormal case
+			return 0, err
+		}
+		return intValue, nil
+	}
+	// Do not report error, because there should be many old containers without label now.
+	klog.V(3).InfoS("Container doesn't have requested label, it may be an old or invalid container", "label", label)
+	// Just set the value to 0
+	return 0, nil
+}
+
+func getUint64ValueFromLabel(labels map[string]string, label string) (uint64, error) {
+	if strValue, found := labels[label]; found {
+		intValue, err := strconv.ParseUint(strValue, 16, 64)
+		if err != nil {
+			// This really should not happen. Just set value to 0 to handle this abnormal case
+			return 0, err
+		}
+		return intValue, nil
+	}
+	// Do not report error, because there should be many old containers without label now.
+	klog.V(3).InfoS("Container doesn't have requested label, it may be an old or invalid container", "label", label)
+	// Just set the value to 0
+	return 0, nil
+}
+
+func getInt64PointerFromLabel(labels map[string]string, label string) (*int64, error) {
+	if strValue, found := labels[label]; found {
+		int64Value, err := strconv.ParseInt(strValue, 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		return &int64Value, nil
+	}
+	// If the label is not found, return pointer nil.
+	return nil, nil
+}
@@ -0,0 +1,370 @@
+// Package hostport forwards the host ports of pods with a network namespace
+// of their own to their IPs. The forwarding is done in userspace: the kubelet
+// listens on every host port and copies the traffic to and from the pod, no
+// iptables rules are involved.
+package hostport
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/klog/v2"
+	netutils "k8s.io/utils/net"
+)
+
+const (
+	// dialTimeout is how long a connection to the pod may take to establish.
+	dialTimeout = 10 * time.Second
+	// udpBufferSize is the size of the biggest UDP datagram forwarded.
+	udpBufferSize = 65535
+)
+
+// udpIdleTimeout is how long the UDP session of a client is kept without
+// any traffic.
+var udpIdleTimeout = time.Minute
+
+// ForwardedProtocols are the protocols of the host ports forwarded to pods.
+var ForwardedProtocols = []v1.Protocol{v1.ProtocolTCP, v1.ProtocolUDP}
+
+// PortMapping is a host port forwarded to a port of the pod.
+type PortMapping struct {
+	Protocol      v1.Protocol `json:"protocol"`
+	HostIP        string      `json:"hostIP,omitempty"`
+	HostPort      int32       `json:"hostPort"`
+	ContainerPort int32       `json:"containerPort"`
+}
+
+func (pm *PortMapping) String() string {
+	return fmt.Sprintf("%s/%s", net.JoinHostPort(pm.HostIP, strconv.Itoa(int(pm.HostPort))), pm.Protocol)
+}
+
+// PortMappings returns the ports of the containers of the pod that have a
+// host port.
+func PortMappings(pod *v1.Pod) []*PortMapping {
+	var mappings []*PortMapping
+	for _, container := range pod.Spec.Containers {
+		for _, port := range container.Ports {
+			if port.HostPort <= 0 {
+				continue
+			}
+			protocol := port.Protocol
+			if protocol == "" {
+				protocol = v1.ProtocolTCP
+			}
+			mappings = append(mappings, &PortMapping{
+				Protocol:      protocol,
+				HostIP:        port.HostIP,
+				HostPort:      port.HostPort,
+				ContainerPort: port.ContainerPort,
+			})
+		}
+	}
+	return mappings
+}
+
+// forwarder forwards one host port until it is closed.
+type forwarder interface {
+	close()
+}
+
+// Manager forwards the host ports of pod sandboxes.
+type Manager struct {
+	lock       sync.Mutex
+	forwarders map[string][]forwarder
+}
+
+// NewManager creates a manager forwarding no host port.
+func NewManager() *Manager {
+	return &Manager{forwarders: make(map[string][]forwarder)}
+}
+
+// Add starts forwarding the host ports of the sandbox with the given id to
+// the pod IP of the family of their host IP, the first pod IP if the host IP
+// is not set. No port is forwarded if one of them can not be opened. It is a
+// no-op if the ports of the sandbox are already forwarded.
+func (m *Manager) Add(id string, mappings []*PortMapping, podIPs []string) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if _, ok := m.forwarders[id]; ok || len(mappings) == 0 {
+		return nil
+	}
+
+	var forwarders []forwarder
+	for _, pm := range mappings {
+		f, err := newForwarder(pm, podIPs)
+		if err != nil {
+			for _, f := range forwarders {
+				f.close()
+			}
+			return fmt.Errorf("failed to open host port %s: %v", pm, err)
+		}
+		forwarders = append(forwarders, f)
+	}
+	m.forwarders[id] = forwarders
+	klog.V(4).InfoS("Forwarding host ports of pod sandbox", "podSandboxID", id, "portMappings", mappings)
+	return nil
+}
+
+// Remove stops forwarding the host ports of the sandbox with the given id,
+// and closes the connections forwarded to it. It is a no-op if none of its
+// ports are forwarded.
+func (m *Manager) Remove(id string) {
+	m.lock.Lock()
+	forwarders, ok := m.forwarders[id]
+	delete(m.forwarders, id)
+	m.lock.Unlock()
+	if !ok {
+		return
+	}
+	for _, f := range forwarders {
+		f.close()
+	}
+	klog.V(4).InfoS("Stopped forwarding host ports of pod sandbox", "podSandboxID", id)
+}
+
+func newForwarder(pm *PortMapping, podIPs []string) (forwarder, error) {
+	podIP, err := targetIP(pm.HostIP, podIPs)
+	if err != nil {
+		return nil, err
+	}
+	listenAddr := net.JoinHostPort(pm.HostIP, strconv.Itoa(int(pm.HostPort)))
+	target := net.JoinHostPort(podIP, strconv.Itoa(int(pm.ContainerPort)))
+	switch pm.Protocol {
+	case v1.ProtocolTCP:
+		return newTCPForwarder(listenAddr, target)
+	case v1.ProtocolUDP:
+		return newUDPForwarder(listenAddr, target)
+	default:
+		return nil, fmt.Errorf("protocol %s is not supported", pm.Protocol)
+	}
+}
+
+// targetIP returns the pod IP of the family of hostIP, the first pod IP if
+// hostIP is not set.
+func targetIP(hostIP string, podIPs []string) (string, error) {
+	if len(podIPs) == 0 {
+		return "", fmt.Errorf("pod has no IP")
+	}
+	if hostIP == "" {
+		return podIPs[0], nil
+	}
+	isIPv6 := netutils.IsIPv6String(hostIP)
+	for _, ip := range podIPs {
+		if netutils.IsIPv6String(ip) == isIPv6 {
+			return ip, nil
+		}
+	}
+	return "", fmt.Errorf("pod has no IP of the family of host IP %s", hostIP)
+}
+
+// tcpForwarder accepts the connections to a host port and forwards each of
+// them over a connection of its own to the pod.
+type tcpForwarder struct {
+	listener net.Listener
+	target   string
+
+	lock   sync.Mutex
+	conns  map[net.Conn]struct{}
+	closed bool
+}
+
+func newTCPForwarder(listenAddr, target string) (*tcpForwarder, error) {
+	listener, err := net.Listen("tcp", listenAddr)
+	if err != nil {
+		return nil, err
+	}
+	f := &tcpForwarder{
+		listener: listener,
+		target:   target,
+		conns:    make(map[net.Conn]struct{}),
+	}
+	go f.serve()
+	return f, nil
+}
+
+func (f *tcpForwarder) serve() {
+	for {
+		conn, err := f.listener.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			klog.ErrorS(err, "Failed to accept a connection to a host port", "address", f.listener.Addr())
+			time.Sleep(100 * time.Millisecond)
+			continue
+		}
+		go f.forward(conn)
+	}
+}
+
+// forward copies the traffic between a client and the pod until both
+// directions are closed.
+func (f *tcpForwarder) forward(conn net.Conn) {
+	backend, err := net.DialTimeout("tcp", f.target, dialTimeout)
+	if err != nil {
+		klog.V(4).InfoS("Failed to connect to pod for a host port", "address", f.listener.Addr(), "target", f.target, "err", err)
+		conn.Close()
+		return
+	}
+	if !f.track(conn, backend) {
+		conn.Close()
+		backend.Close()
+		return
+	}
+	defer f.untrack(conn, backend)
+
+	done := make(chan struct{}, 2)
+	copyHalf := func(dst, src net.Conn) {
+		io.Copy(dst, src)
+		if c, ok := dst.(*net.TCPConn); ok {
+			c.CloseWrite()
+		}
+		done <- struct{}{}
+	}
+	go copyHalf(backend, conn)
+	go copyHalf(conn, backend)
+	<-done
+	<-done
+}
+
+// track records the connections of a forwarded connection, so that they are
+// closed with the forwarder. It returns false once the forwarder is closed.
+func (f *tcpForwarder) track(conns ...net.Conn) bool {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	if f.closed {
+		return false
+	}
+	for _, c := range conns {
+		f.conns[c] = struct{}{}
+	}
+	return true
+}
+
+func (f *tcpForwarder) untrack(conns ...net.Conn) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	for _, c := range conns {
+		c.Close()
+		delete(f.conns, c)
+	}
+}
+
+func (f *tcpForwarder) close() {
+	f.listener.Close()
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	f.closed = true
+	for c := range f.conns {
+		c.Close()
+	}
+}
+
+// udpForwarder forwards the datagrams sent to a host port over one socket
+// per client to the pod, and the replies back to the client.
+type udpForwarder struct {
+	conn   net.PacketConn
+	target *net.UDPAddr
+
+	lock    sync.Mutex
+	clients map[string]*net.UDPConn
+	closed  bool
+}
+
+func newUDPForwarder(listenAddr, target string) (*udpForwarder, error) {
+	targetAddr, err := net.ResolveUDPAddr("udp", target)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := net.ListenPacket("udp", listenAddr)
+	if err != nil {
+		return nil, err
+	}
+	f := &udpForwarder{
+		conn:    conn,
+		target:  targetAddr,
+		clients: make(map[string]*net.UDPConn),
+	}
+	go f.serve()
+	return f, nil
+}
+
+func (f *udpForwarder) serve() {
+	buf := make([]byte, udpBufferSize)
+	for {
+		n, client, err := f.conn.ReadFrom(buf)
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			klog.ErrorS(err, "Failed to read from a host port", "address", f.conn.LocalAddr())
+			continue
+		}
+		backend, err := f.clientConn(client)
+		if err != nil {
+			klog.V(4).InfoS("Failed to connect to pod for a host port", "address", f.conn.LocalAddr(), "target", f.target, "err", err)
+			continue
+		}
+		backend.SetReadDeadline(time.Now().Add(udpIdleTimeout))
+		if _, err := backend.Write(buf[:n]); err != nil {
+			klog.V(4).InfoS("Failed to forward a datagram to pod", "address", f.conn.LocalAddr(), "target", f.target, "err", err)
+		}
+	}
+}
+
+// clientConn returns the socket forwarding the datagrams of a client,
+// opening it for a new client.
+func (f *udpForwarder) clientConn(client net.Addr) (*net.UDPConn, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	if f.closed {
+		return nil, net.ErrClosed
+	}
+	if backend, ok := f.clients[client.String()]; ok {
+		return backend, nil
+	}
+	backend, err := net.DialUDP("udp", nil, f.target)
+	if err != nil {
+		return nil, err
+	}
+	f.clients[client.String()] = backend
+	go f.reply(client, backend)
+	return backend, nil
+}
+
+// reply sends the replies of the pod back to a client, until the client
+// has been idle for udpIdleTimeout.
+func (f *udpForwarder) reply(client net.Addr, backend *net.UDPConn) {
+	defer func() {
+		f.lock.Lock()
+		delete(f.clients, client.String())
+		f.lock.Unlock()
+		backend.Close()
+	}()
+	buf := make([]byte, udpBufferSize)
+	for {
+		n, err := backend.Read(buf)
+		if err != nil {
+			return
+		}
+		if _, err := f.conn.WriteTo(buf[:n], client); err != nil {
+			return
+		}
+	}
+}
+
+func (f *udpForwarder) close() {
+	f.conn.Close()
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	f.closed = true
+	for _, backend := range f.clients {
+		backend.Close()
+	}
+}
@@ -0,0 +1,302 @@
+package hostport
+
+import (
+	"io"
+	"net"
+	"strconv"
+	"testing"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+)
+
+const testTimeout = 5 * time.Second
+
+// freePort returns a port of the loopback address that is not in use.
+func freePort(t *testing.T, network string) int32 {
+	t.Helper()
+	var addr net.Addr
+	switch network {
+	case "tcp":
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer l.Close()
+		addr = l.Addr()
+	default:
+		c, err := net.ListenPacket("udp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer c.Close()
+		addr = c.LocalAddr()
+	}
+	_, port, _ := net.SplitHostPort(addr.String())
+	p, _ := strconv.Atoi(port)
+	return int32(p)
+}
+
+func port(addr net.Addr) int32 {
+	_, p, _ := net.SplitHostPort(addr.String())
+	n, _ := strconv.Atoi(p)
+	return int32(n)
+}
+
+// startTCPBackend starts a pod server calling handle for each connection,
+// and returns its port.
+func startTCPBackend(t *testing.T, handle func(net.Conn)) int32 {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				handle(conn)
+			}()
+		}
+	}()
+	return port(l.Addr())
+}
+
+// addTestMapping forwards a free host port of the loopback address to the
+// container port of a pod on the loopback address, and returns the address
+// of the host port.
+func addTestMapping(t *testing.T, m *Manager, id string, protocol v1.Protocol, containerPort int32) string {
+	t.Helper()
+	network := "tcp"
+	if protocol == v1.ProtocolUDP {
+		network = "udp"
+	}
+	pm := &PortMapping{Protocol: protocol, HostIP: "127.0.0.1", HostPort: freePort(t, network), ContainerPort: containerPort}
+	if err := m.Add(id, []*PortMapping{pm}, []string{"127.0.0.1"}); err != nil {
+		t.Fatalf("failed to add the port mapping: %v", err)
+	}
+	t.Cleanup(func() { m.Remove(id) })
+	return net.JoinHostPort(pm.HostIP, strconv.Itoa(int(pm.HostPort)))
+}
+
+func TestTCPForwarding(t *testing.T) {
+	m := NewManager()
+	// The backend replies once the client closed its side of the connection.
+	backendPort := startTCPBackend(t, func(conn net.Conn) {
+		data, err := io.ReadAll(conn)
+		if err != nil {
+			return
+		}
+		conn.Write(append([]byte("reply to "), data...))
+	})
+	addr := addTestMapping(t, m, "sandbox", v1.ProtocolTCP, backendPort)
+
+	conn, err := net.DialTimeout("tcp", addr, testTimeout)
+	if err != nil {
+		t.Fatalf("failed to connect to the host port: %v", err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(testTimeout))
+	if _, err := conn.Write([]byte("hello")); err != nil {
+		t.Fatal(err)
+	}
+	if err := conn.(*net.TCPConn).CloseWrite(); err != nil {
+		t.Fatal(err)
+	}
+	data, err := io.ReadAll(conn)
+	if err != nil {
+		t.Fatalf("failed to read the reply: %v", err)
+	}
+	if string(data) != "reply to hello" {
+		t.Errorf("expected the reply after the half-close, got %q", data)
+	}
+}
+
+func TestUDPForwarding(t *testing.T) {
+	defer func(timeout time.Duration) { udpIdleTimeout = timeout }(udpIdleTimeout)
+	udpIdleTimeout = 200 * time.Millisecond
+
+	backend, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer backend.Close()
+	go func() {
+		buf := make([]byte, udpBufferSize)
+		for {
+			n, client, err := backend.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			backend.WriteTo(append([]byte("reply to "), buf[:n]...), client)
+		}
+	}()
+	m := NewManager()
+	addr := addTestMapping(t, m, "sandbox", v1.ProtocolUDP, port(backend.LocalAddr()))
+
+	conn, err := net.Dial("udp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(testTimeout))
+	buf := make([]byte, udpBufferSize)
+	for _, msg := range []string{"hello", "again"} {
+		if _, err := conn.Write([]byte(msg)); err != nil {
+			t.Fatal(err)
+		}
+		n, err := conn.Read(buf)
+		if err != nil {
+			t.Fatalf("failed to read the reply: %v", err)
+		}
+		if reply := string(buf[:n]); reply != "reply to "+msg {
+			t.Errorf("expected the reply to %q, got %q", msg, reply)
+		}
+	}
+
+	// The session of the client expires once it is idle.
+	m.lock.Lock()
+	f := m.forwarders["sandbox"][0].(*udpForwarder)
+	m.lock.Unlock()
+	clients := func() int {
+		f.lock.Lock()
+		defer f.lock.Unlock()
+		return len(f.clients)
+	}
+	if n := clients(); n != 1 {
+		t.Fatalf("expected a session of the client, got %d", n)
+	}
+	deadline := time.Now().Add(testTimeout)
+	for clients() != 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("expected the idle session of the client to expire")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// A new session is opened for the next datagram.
+	if _, err := conn.Write([]byte("back")); err != nil {
+		t.Fatal(err)
+	}
+	n, err := conn.Read(buf)
+	if err != nil {
+		t.Fatalf("failed to read the reply: %v", err)
+	}
+	if reply := string(buf[:n]); reply != "reply to back" {
+		t.Errorf("expected the reply after the session expired, got %q", reply)
+	}
+}
+
+func TestRemove(t *testing.T) {
+	m := NewManager()
+	accepted := make(chan struct{})
+	backendPort := startTCPBackend(t, func(conn net.Conn) {
+		close(accepted)
+		io.Copy(io.Discard, conn)
+	})
+	addr := addTestMapping(t, m, "sandbox", v1.ProtocolTCP, backendPort)
+
+	conn, err := net.DialTimeout("tcp", addr, testTimeout)
+	if err != nil {
+		t.Fatalf("failed to connect to the host port: %v", err)
+	}
+	defer conn.Close()
+	select {
+	case <-accepted:
+	case <-time.After(testTimeout):
+		t.Fatal("expected the connection to be forwarded")
+	}
+
+	m.Remove("sandbox")
+	// The forwarded connection is closed.
+	conn.SetReadDeadline(time.Now().Add(testTimeout))
+	if _, err := conn.Read(make([]byte, 1)); err != io.EOF {
+		t.Errorf("expected the connection to be closed, got %v", err)
+	}
+	// The host port is closed.
+	if c, err := net.DialTimeout("tcp", addr, testTimeout); err == nil {
+		c.Close()
+		t.Error("expected the host port to be closed")
+	}
+	// Removing it again is a no-op.
+	m.Remove("sandbox")
+}
+
+func TestAddFailure(t *testing.T) {
+	m := NewManager()
+	tcpPort := freePort(t, "tcp")
+	for desc, test := range map[string]struct {
+		mappings []*PortMapping
+		podIPs   []string
+	}{
+		"unsupported protocol": {
+			mappings: []*PortMapping{
+				{Protocol: v1.ProtocolTCP, HostIP: "127.0.0.1", HostPort: tcpPort, ContainerPort: 80},
+				{Protocol: v1.ProtocolSCTP, HostIP: "127.0.0.1", HostPort: 9999, ContainerPort: 80},
+			},
+			podIPs: []string{"127.0.0.1"},
+		},
+		"no pod IP of the family of the host IP": {
+			mappings: []*PortMapping{
+				{Protocol: v1.ProtocolTCP, HostIP: "127.0.0.1", HostPort: tcpPort, ContainerPort: 80},
+				{Protocol: v1.ProtocolTCP, HostIP: "::1", HostPort: tcpPort, ContainerPort: 80},
+			},
+			podIPs: []string{"127.0.0.1"},
+		},
+		"no pod IP": {
+			mappings: []*PortMapping{{Protocol: v1.ProtocolTCP, HostPort: tcpPort, ContainerPort: 80}},
+		},
+	} {
+		t.Run(desc, func(t *testing.T) {
+			if err := m.Add("sandbox", test.mappings, test.podIPs); err == nil {
+				m.Remove("sandbox")
+				t.Fatal("expected an error")
+			}
+			if _, ok := m.forwarders["sandbox"]; ok {
+				t.Error("expected no port to be forwarded")
+			}
+			// The ports opened before the failure are closed.
+			l, err := net.Listen("tcp", net.JoinHostPort("127.0.0.1", strconv.Itoa(int(tcpPort))))
+			if err != nil {
+				t.Fatalf("expected the host port to be closed: %v", err)
+			}
+			l.Close()
+		})
+	}
+}
+
+func TestTargetIP(t *testing.T) {
+	for desc, test := range map[string]struct {
+		hostIP   string
+		podIPs   []string
+		expected string
+	}{
+		"no host IP":           {podIPs: []string{"fd00::2", "10.0.0.2"}, expected: "fd00::2"},
+		"IPv4 host IP":         {hostIP: "127.0.0.1", podIPs: []string{"fd00::2", "10.0.0.2"}, expected: "10.0.0.2"},
+		"IPv6 host IP":         {hostIP: "::1", podIPs: []string{"10.0.0.2", "fd00::2"}, expected: "fd00::2"},
+		"no IP of the family":  {hostIP: "::1", podIPs: []string{"10.0.0.2"}},
+		"no pod IP":            {},
+		"no pod IP of host IP": {hostIP: "127.0.0.1"},
+	} {
+		t.Run(desc, func(t *testing.T) {
+			ip, err := targetIP(test.hostIP, test.podIPs)
+			if test.expected == "" {
+				if err == nil {
+					t.Errorf("expected an error, got %q", ip)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if ip != test.expected {
+				t.Errorf("expected %q, got %q", test.expected, ip)
+			}
+		})
+	}
+}
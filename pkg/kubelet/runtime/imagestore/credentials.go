@@ -0,0 +1,99 @@
+package imagestore
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+
+	v1 "k8s.io/api/core/v1"
+	runtimeapi "k8s.io/cri-api/pkg/apis/runtime/v1alpha2"
+)
+
+// credential is a username and password for a registry.
+type credential struct {
+	Username string `json:"username,omitempty"`
+	Password string `json:"password,omitempty"`
+	Auth     string `json:"auth,omitempty"`
+}
+
+// dockerConfigJSON is the content of a kubernetes.io/dockerconfigjson secret.
+type dockerConfigJSON struct {
+	Auths map[string]credential `json:"auths"`
+}
+
+// credentialFor returns the credential the pull secrets hold for the
+// registry of the reference, nil if there is none.
+func credentialFor(ref reference, pullSecrets []v1.Secret) *credential {
+	for _, secret := range pullSecrets {
+		var auths map[string]credential
+		switch {
+		case len(secret.Data[v1.DockerConfigJsonKey]) > 0:
+			config := dockerConfigJSON{}
+			if err := json.Unmarshal(secret.Data[v1.DockerConfigJsonKey], &config); err != nil {
+				continue
+			}
+			auths = config.Auths
+		case len(secret.Data[v1.DockerConfigKey]) > 0:
+			if err := json.Unmarshal(secret.Data[v1.DockerConfigKey], &auths); err != nil {
+				continue
+			}
+		}
+		for server, cred := range auths {
+			if !matchRegistry(server, ref) {
+				continue
+			}
+			if cred.Username == "" && cred.Auth != "" {
+				decoded, err := base64.StdEncoding.DecodeString(cred.Auth)
+				if err != nil {
+					continue
+				}
+				parts := strings.SplitN(string(decoded), ":", 2)
+				if len(parts) != 2 {
+					continue
+				}
+				cred.Username, cred.Password = parts[0], parts[1]
+			}
+			return &cred
+		}
+	}
+	return nil
+}
+
+// AuthConfigFor returns the credential the pull secrets hold for the
+// registry of the image, in the form CRI image services take it. It returns
+// nil if there is none.
+func AuthConfigFor(image string, pullSecrets []v1.Secret) *runtimeapi.AuthConfig {
+	ref, err := parseReference(image)
+	if err != nil {
+		return nil
+	}
+	cred := credentialFor(ref, pullSecrets)
+	if cred == nil {
+		return nil
+	}
+	return &runtimeapi.AuthConfig{
+		Username:      cred.Username,
+		Password:      cred.Password,
+		ServerAddress: ref.registryHost(),
+	}
+}
+
+// matchRegistry returns whether the server of a docker config, with or
+// without scheme and path, is the registry of the reference.
+func matchRegistry(server string, ref reference) bool {
+	host := server
+	if i := strings.Index(host, "://"); i >= 0 {
+		host = host[i+3:]
+	}
+	if i := strings.Index(host, "/"); i >= 0 {
+		host = host[:i]
+	}
+	if ref.domain == defaultDomain {
+		switch host {
+		case defaultDomain, "index.docker.io", defaultRegistryHost:
+			return true
+		}
+		return false
+	}
+	return host == ref.domain
+}
@@ -0,0 +1,156 @@
+package imagestore
+
+import (
+	"archive/tar"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path"
+)
+
+const (
+	// archiveManifestName is the member of a docker save tarball listing its images.
+	archiveManifestName = "manifest.json"
+	// annotationArchiveMember is the annotation of a descriptor holding the
+	// member of the tarball the blob is read from.
+	annotationArchiveMember = "member"
+	// maxArchiveSymlinks is how many symlinks are followed to a member.
+	maxArchiveSymlinks = 8
+)
+
+// archiveSource reads an image from a docker save tarball. The image is the
+// one tagged with the name, or the first one.
+type archiveSource struct {
+	file string
+	name string
+}
+
+func newArchiveSource(image string) *archiveSource {
+	file, name := splitLocalImage(image, archivePrefix)
+	return &archiveSource{file: file, name: name}
+}
+
+// manifest builds a manifest out of the entry of the image in manifest.json.
+// The layers of a tarball are only verified against the diff IDs of the config.
+func (s *archiveSource) manifest() (*manifest, string, error) {
+	rc, err := s.member(archiveManifestName)
+	if err != nil {
+		return nil, "", err
+	}
+	data, err := io.ReadAll(io.LimitReader(rc, maxManifestSize))
+	rc.Close()
+	if err != nil {
+		return nil, "", err
+	}
+	var entries []archiveManifest
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, "", fmt.Errorf("failed to decode %s of %q: %v", archiveManifestName, s.file, err)
+	}
+
+	entry, err := s.selectEntry(entries)
+	if err != nil {
+		return nil, "", err
+	}
+	m := &manifest{
+		SchemaVersion: 2,
+		Config: descriptor{
+			Annotations: map[string]string{annotationArchiveMember: entry.Config},
+		},
+	}
+	for _, layer := range entry.Layers {
+		m.Layers = append(m.Layers, descriptor{
+			Annotations: map[string]string{annotationArchiveMember: layer},
+		})
+	}
+	return m, "", nil
+}
+
+func (s *archiveSource) selectEntry(entries []archiveManifest) (*archiveManifest, error) {
+	if len(entries) == 0 {
+		return nil, fmt.Errorf("no image in %q", s.file)
+	}
+	if s.name == "" {
+		return &entries[0], nil
+	}
+	wanted, err := normalizeImage(s.name)
+	if err != nil {
+		return nil, err
+	}
+	for i := range entries {
+		for _, tag := range entries[i].RepoTags {
+			if normalized, err := normalizeImage(tag); err == nil && normalized == wanted {
+				return &entries[i], nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("no image %q in %q", s.name, s.file)
+}
+
+func (s *archiveSource) blob(desc descriptor) (io.ReadCloser, error) {
+	name, ok := desc.Annotations[annotationArchiveMember]
+	if !ok {
+		return nil, fmt.Errorf("blob %s is not in %q", desc.Digest, s.file)
+	}
+	return s.member(name)
+}
+
+// member opens a member of the tarball. The tarball is scanned from the start
+// for every member, it has no index. Layers shared by several images of the
+// tarball are symlinks to the same member.
+func (s *archiveSource) member(name string) (io.ReadCloser, error) {
+	name = path.Clean("/" + name)
+	for links := 0; links < maxArchiveSymlinks; links++ {
+		rc, target, err := s.openMember(name)
+		if err != nil || target == "" {
+			return rc, err
+		}
+		if path.IsAbs(target) {
+			name = path.Clean(target)
+		} else {
+			name = path.Join(path.Dir(name), target)
+		}
+	}
+	return nil, fmt.Errorf("too many symlinks resolving %s in %q", name, s.file)
+}
+
+// openMember opens the regular member name, or returns the target of the
+// symlink name.
+func (s *archiveSource) openMember(name string) (io.ReadCloser, string, error) {
+	f, err := os.Open(s.file)
+	if err != nil {
+		return nil, "", err
+	}
+	tr := tar.NewReader(f)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			f.Close()
+			return nil, "", fmt.Errorf("no %s in %q", name, s.file)
+		}
+		if err != nil {
+			f.Close()
+			return nil, "", fmt.Errorf("failed to read %q: %v", s.file, err)
+		}
+		if path.Clean("/"+hdr.Name) != name {
+			continue
+		}
+		switch hdr.Typeflag {
+		case tar.TypeReg, tar.TypeRegA:
+			return &tarMember{Reader: tr, f: f}, "", nil
+		case tar.TypeSymlink:
+			f.Close()
+			return nil, hdr.Linkname, nil
+		}
+	}
+}
+
+// tarMember reads a member of a tarball, closing it closes the tarball.
+type tarMember struct {
+	io.Reader
+	f *os.File
+}
+
+func (m *tarMember) Close() error {
+	return m.f.Close()
+}
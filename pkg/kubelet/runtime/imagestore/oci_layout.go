@@ -0,0 +1,67 @@
+package imagestore
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// layoutSource reads an image from an OCI image layout directory. The image
+// is the manifest of the index tagged with the name, or the only one.
+type layoutSource struct {
+	dir  string
+	name string
+}
+
+func newLayoutSource(image string) *layoutSource {
+	dir, name := splitLocalImage(image, layoutPrefix)
+	return &layoutSource{dir: dir, name: name}
+}
+
+func (s *layoutSource) manifest() (*manifest, string, error) {
+	data, err := os.ReadFile(filepath.Join(s.dir, "index.json"))
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to read the index of OCI layout %q: %v", s.dir, err)
+	}
+	idx := &index{}
+	if err := json.Unmarshal(data, idx); err != nil {
+		return nil, "", fmt.Errorf("failed to decode the index of OCI layout %q: %v", s.dir, err)
+	}
+
+	var desc *descriptor
+	for i := range idx.Manifests {
+		refName := idx.Manifests[i].Annotations[annotationRefName]
+		switch {
+		case s.name == "" && len(idx.Manifests) == 1,
+			s.name == "" && refName == defaultTag,
+			s.name != "" && (refName == s.name || strings.HasSuffix(refName, ":"+s.name)):
+			desc = &idx.Manifests[i]
+		}
+		if desc != nil {
+			break
+		}
+	}
+	if desc == nil {
+		return nil, "", fmt.Errorf("no image %q in OCI layout %q", s.name, s.dir)
+	}
+
+	fetch := func(digest string) ([]byte, error) {
+		return readBlob(s, descriptor{Digest: digest})
+	}
+	data, err = fetch(desc.Digest)
+	if err != nil {
+		return nil, "", err
+	}
+	return resolveManifest(data, desc.Digest, fetch)
+}
+
+func (s *layoutSource) blob(desc descriptor) (io.ReadCloser, error) {
+	parts := strings.SplitN(desc.Digest, ":", 2)
+	if len(parts) != 2 || strings.ContainsAny(parts[1], "/.") {
+		return nil, fmt.Errorf("invalid digest %q", desc.Digest)
+	}
+	return os.Open(filepath.Join(s.dir, "blobs", parts[0], parts[1]))
+}
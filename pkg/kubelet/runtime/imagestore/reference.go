@@ -0,0 +1,131 @@
+package imagestore
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+const (
+	// Prefixes of the images pulled from local sources instead of a registry.
+	layoutPrefix  = "oci:"
+	archivePrefix = "docker-archive:"
+
+	defaultDomain    = "docker.io"
+	officialRepoName = "library"
+	defaultTag       = "latest"
+	// defaultRegistryHost is the host serving the registry API of defaultDomain.
+	defaultRegistryHost = "registry-1.docker.io"
+)
+
+var (
+	pathComponentRegexp = regexp.MustCompile(`^[a-z0-9]+(?:(?:[._]|__|[-]*)[a-z0-9]+)*$`)
+	tagRegexp           = regexp.MustCompile(`^[\w][\w.-]{0,127}$`)
+	digestRegexp        = regexp.MustCompile(`^sha256:[a-f0-9]{64}$`)
+)
+
+// reference is a parsed image reference of a registry,
+// [domain/]path[:tag][@digest].
+type reference struct {
+	domain string
+	path   string
+	tag    string
+	digest string
+}
+
+// parseReference parses and normalizes the reference the way docker does:
+// busybox is docker.io/library/busybox:latest.
+func parseReference(s string) (reference, error) {
+	var ref reference
+	name := s
+	if i := strings.Index(name, "@"); i >= 0 {
+		ref.digest = name[i+1:]
+		name = name[:i]
+		if !digestRegexp.MatchString(ref.digest) {
+			return reference{}, fmt.Errorf("invalid digest in image reference %q", s)
+		}
+	}
+	if i := strings.LastIndex(name, ":"); i >= 0 && !strings.Contains(name[i+1:], "/") {
+		ref.tag = name[i+1:]
+		name = name[:i]
+		if !tagRegexp.MatchString(ref.tag) {
+			return reference{}, fmt.Errorf("invalid tag in image reference %q", s)
+		}
+	}
+
+	ref.domain, ref.path = defaultDomain, name
+	if i := strings.Index(name, "/"); i >= 0 {
+		first := name[:i]
+		if strings.ContainsAny(first, ".:") || first == "localhost" {
+			ref.domain, ref.path = first, name[i+1:]
+		}
+	}
+	if ref.domain == defaultDomain && !strings.Contains(ref.path, "/") {
+		ref.path = officialRepoName + "/" + ref.path
+	}
+	if ref.path == "" {
+		return reference{}, fmt.Errorf("invalid image reference %q", s)
+	}
+	for _, component := range strings.Split(ref.path, "/") {
+		if !pathComponentRegexp.MatchString(component) {
+			return reference{}, fmt.Errorf("invalid image reference %q", s)
+		}
+	}
+	if ref.tag == "" && ref.digest == "" {
+		ref.tag = defaultTag
+	}
+	return ref, nil
+}
+
+// name returns the repository of the reference.
+func (r reference) name() string {
+	return r.domain + "/" + r.path
+}
+
+// String returns the normalized reference. A reference with a digest is
+// pinned to it, its tag is dropped.
+func (r reference) String() string {
+	if r.digest != "" {
+		return r.name() + "@" + r.digest
+	}
+	return r.name() + ":" + r.tag
+}
+
+// manifestRef returns what the manifest of the image is fetched by.
+func (r reference) manifestRef() string {
+	if r.digest != "" {
+		return r.digest
+	}
+	return r.tag
+}
+
+// registryHost returns the host serving the registry API of the reference.
+func (r reference) registryHost() string {
+	if r.domain == defaultDomain {
+		return defaultRegistryHost
+	}
+	return r.domain
+}
+
+// normalizeImage returns the name an image is stored by. Images of local
+// sources keep the name they are referenced by.
+func normalizeImage(image string) (string, error) {
+	if strings.HasPrefix(image, layoutPrefix) || strings.HasPrefix(image, archivePrefix) {
+		return image, nil
+	}
+	ref, err := parseReference(image)
+	if err != nil {
+		return "", err
+	}
+	return ref.String(), nil
+}
+
+// splitLocalImage splits an image of a local source, <prefix><path>[:<name>],
+// into the path of the source and the name of the image inside of it.
+func splitLocalImage(image, prefix string) (string, string) {
+	rest := strings.TrimPrefix(image, prefix)
+	if i := strings.Index(rest, ":"); i >= 0 {
+		return rest[:i], rest[i+1:]
+	}
+	return rest, ""
+}
@@ -0,0 +1,234 @@
+package imagestore
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// manifestMediaTypes are the manifests accepted from a registry.
+var manifestMediaTypes = []string{
+	mediaTypeOCIManifest,
+	mediaTypeOCIIndex,
+	mediaTypeDockerManifest,
+	mediaTypeDockerList,
+}
+
+// registrySource reads an image from a registry speaking the OCI
+// distribution API. HTTPS is tried first, a registry that does not speak it
+// is reached over plain HTTP.
+type registrySource struct {
+	ref        reference
+	client     *http.Client
+	credential *credential
+
+	// scheme is the scheme the registry was reached with.
+	scheme string
+	// authorization is the value of the Authorization header once the
+	// registry asked for one.
+	authorization string
+}
+
+func newRegistrySource(ref reference, client *http.Client, credential *credential) *registrySource {
+	return &registrySource{ref: ref, client: client, credential: credential}
+}
+
+func (s *registrySource) manifest() (*manifest, string, error) {
+	fetch := func(ref string) ([]byte, error) {
+		data, _, err := s.fetchManifest(ref)
+		return data, err
+	}
+	data, digest, err := s.fetchManifest(s.ref.manifestRef())
+	if err != nil {
+		return nil, "", err
+	}
+	if s.ref.digest != "" {
+		if err := verifyDigest(data, s.ref.digest); err != nil {
+			return nil, "", err
+		}
+		digest = s.ref.digest
+	}
+	return resolveManifest(data, digest, fetch)
+}
+
+// fetchManifest fetches the manifest with the given tag or digest and
+// returns it with its digest.
+func (s *registrySource) fetchManifest(ref string) ([]byte, string, error) {
+	resp, err := s.get("manifests/"+ref, strings.Join(manifestMediaTypes, ", "))
+	if err != nil {
+		return nil, "", err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxManifestSize+1))
+	if err != nil {
+		return nil, "", err
+	}
+	if len(data) > maxManifestSize {
+		return nil, "", fmt.Errorf("manifest %s of %s is too large", ref, s.ref.name())
+	}
+	return data, digestOf(data), nil
+}
+
+func (s *registrySource) blob(desc descriptor) (io.ReadCloser, error) {
+	resp, err := s.get("blobs/"+desc.Digest, "")
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+// get sends a GET request for a path of the repository, authenticating
+// if the registry asks for it.
+func (s *registrySource) get(path, accept string) (*http.Response, error) {
+	resp, err := s.do(path, accept)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode == http.StatusUnauthorized && s.authorization == "" {
+		challenge := resp.Header.Get("WWW-Authenticate")
+		resp.Body.Close()
+		if err := s.authenticate(challenge); err != nil {
+			return nil, err
+		}
+		if resp, err = s.do(path, accept); err != nil {
+			return nil, err
+		}
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("failed to fetch %s of %s: %s", path, s.ref.name(), resp.Status)
+	}
+	return resp, nil
+}
+
+func (s *registrySource) do(path, accept string) (*http.Response, error) {
+	send := func(scheme string) (*http.Response, error) {
+		req, err := http.NewRequest(http.MethodGet, fmt.Sprintf("%s://%s/v2/%s/%s", scheme, s.ref.registryHost(), s.ref.path, path), nil)
+		if err != nil {
+			return nil, err
+		}
+		if accept != "" {
+			req.Header.Set("Accept", accept)
+		}
+		if s.authorization != "" {
+			req.Header.Set("Authorization", s.authorization)
+		}
+		return s.client.Do(req)
+	}
+
+	if s.scheme != "" {
+		return send(s.scheme)
+	}
+	resp, err := send("https")
+	if err == nil {
+		s.scheme = "https"
+		return resp, nil
+	}
+	resp, httpErr := send("http")
+	if httpErr != nil {
+		return nil, fmt.Errorf("failed to reach registry %s: %v", s.ref.registryHost(), err)
+	}
+	s.scheme = "http"
+	return resp, nil
+}
+
+// authenticate answers the challenge of the registry, with the credential of
+// the pull secrets if there is one.
+func (s *registrySource) authenticate(challenge string) error {
+	scheme, params := parseChallenge(challenge)
+	switch strings.ToLower(scheme) {
+	case "basic":
+		if s.credential == nil {
+			return fmt.Errorf("registry %s requires credentials", s.ref.registryHost())
+		}
+		req, _ := http.NewRequest(http.MethodGet, "/", nil)
+		req.SetBasicAuth(s.credential.Username, s.credential.Password)
+		s.authorization = req.Header.Get("Authorization")
+		return nil
+	case "bearer":
+		token, err := s.fetchToken(params)
+		if err != nil {
+			return err
+		}
+		s.authorization = "Bearer " + token
+		return nil
+	default:
+		return fmt.Errorf("unsupported authentication challenge %q of registry %s", challenge, s.ref.registryHost())
+	}
+}
+
+// fetchToken fetches a pull token from the token server of the registry.
+func (s *registrySource) fetchToken(params map[string]string) (string, error) {
+	realm, err := url.Parse(params["realm"])
+	if err != nil || realm.Scheme == "" {
+		return "", fmt.Errorf("invalid token realm %q of registry %s", params["realm"], s.ref.registryHost())
+	}
+	query := realm.Query()
+	if service := params["service"]; service != "" {
+		query.Set("service", service)
+	}
+	scope := params["scope"]
+	if scope == "" {
+		scope = fmt.Sprintf("repository:%s:pull", s.ref.path)
+	}
+	query.Set("scope", scope)
+	realm.RawQuery = query.Encode()
+
+	req, err := http.NewRequest(http.MethodGet, realm.String(), nil)
+	if err != nil {
+		return "", err
+	}
+	if s.credential != nil {
+		req.SetBasicAuth(s.credential.Username, s.credential.Password)
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("failed to fetch a token for %s: %s", s.ref.name(), resp.Status)
+	}
+	var token struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxManifestSize)).Decode(&token); err != nil {
+		return "", fmt.Errorf("failed to decode the token for %s: %v", s.ref.name(), err)
+	}
+	if token.Token != "" {
+		return token.Token, nil
+	}
+	return token.AccessToken, nil
+}
+
+// parseChallenge parses a WWW-Authenticate header such as
+// Bearer realm="https://auth.docker.io/token",service="registry.docker.io".
+func parseChallenge(challenge string) (string, map[string]string) {
+	params := map[string]string{}
+	scheme, rest, _ := strings.Cut(strings.TrimSpace(challenge), " ")
+	for len(rest) > 0 {
+		rest = strings.TrimLeft(rest, " ,")
+		key, value, ok := strings.Cut(rest, "=")
+		if !ok {
+			break
+		}
+		if strings.HasPrefix(value, `"`) {
+			end := strings.Index(value[1:], `"`)
+			if end < 0 {
+				params[strings.ToLower(key)] = value[1:]
+				break
+			}
+			params[strings.ToLower(key)] = value[1 : end+1]
+			rest = value[end+2:]
+		} else {
+			v, r, _ := strings.Cut(value, ",")
+			params[strings.ToLower(key)] = v
+			rest = r
+		}
+	}
+	return scheme, params
+}
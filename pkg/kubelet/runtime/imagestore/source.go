@@ -0,0 +1,123 @@
+package imagestore
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"io"
+	"runtime"
+	"strings"
+)
+
+const (
+	// maxManifestSize limits the size of manifests, indexes and configs.
+	maxManifestSize = 8 * 1024 * 1024
+	// maxIndexDepth limits how deep indexes may nest.
+	maxIndexDepth = 4
+)
+
+// source is where the manifest, config and layers of an image are read from.
+type source interface {
+	// manifest returns the manifest of the image for the platform of the
+	// node, and the digest it is pulled by if the source has one.
+	manifest() (*manifest, string, error)
+	// blob opens the content of a blob of the manifest.
+	blob(desc descriptor) (io.ReadCloser, error)
+}
+
+// resolveManifest returns the manifest of the document, selecting the one
+// for the platform of the node if the document is an index. fetch returns
+// the document with the given digest. The digest returned is the one of the
+// document, which is the digest the image is pulled by.
+func resolveManifest(data []byte, digest string, fetch func(digest string) ([]byte, error)) (*manifest, string, error) {
+	for depth := 0; depth < maxIndexDepth; depth++ {
+		m := &manifest{}
+		if err := json.Unmarshal(data, m); err != nil {
+			return nil, "", fmt.Errorf("failed to decode manifest: %v", err)
+		}
+		isIndex := m.MediaType == mediaTypeOCIIndex || m.MediaType == mediaTypeDockerList || (m.MediaType == "" && len(m.Manifests) > 0)
+		if !isIndex {
+			if m.SchemaVersion != 2 {
+				return nil, "", fmt.Errorf("unsupported manifest schema version %d", m.SchemaVersion)
+			}
+			return m, digest, nil
+		}
+
+		desc, err := selectPlatform(m.Manifests)
+		if err != nil {
+			return nil, "", err
+		}
+		if data, err = fetch(desc.Digest); err != nil {
+			return nil, "", err
+		}
+		if err := verifyDigest(data, desc.Digest); err != nil {
+			return nil, "", err
+		}
+	}
+	return nil, "", fmt.Errorf("image indexes nested too deep")
+}
+
+// selectPlatform returns the manifest of an index built for the platform of
+// the node. Manifests without a platform are taken for any.
+func selectPlatform(manifests []descriptor) (descriptor, error) {
+	for _, desc := range manifests {
+		if desc.Platform == nil || (desc.Platform.OS == runtime.GOOS && desc.Platform.Architecture == runtime.GOARCH) {
+			return desc, nil
+		}
+	}
+	return descriptor{}, fmt.Errorf("no image for platform %s/%s", runtime.GOOS, runtime.GOARCH)
+}
+
+// readBlob reads a small blob and verifies its digest.
+func readBlob(src source, desc descriptor) ([]byte, error) {
+	rc, err := src.blob(desc)
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	data, err := io.ReadAll(io.LimitReader(rc, maxManifestSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > maxManifestSize {
+		return nil, fmt.Errorf("blob %s is too large", desc.Digest)
+	}
+	if desc.Digest != "" {
+		if err := verifyDigest(data, desc.Digest); err != nil {
+			return nil, err
+		}
+	}
+	return data, nil
+}
+
+// digestOf returns the sha256 digest of data.
+func digestOf(data []byte) string {
+	sum := sha256.Sum256(data)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+// verifyDigest checks data against its expected digest.
+func verifyDigest(data []byte, expected string) error {
+	if !strings.HasPrefix(expected, "sha256:") {
+		return fmt.Errorf("unsupported digest %q", expected)
+	}
+	if actual := digestOf(data); actual != expected {
+		return fmt.Errorf("digest mismatch: expected %s, got %s", expected, actual)
+	}
+	return nil
+}
+
+// digester computes the sha256 digest of what is written to it.
+type digester struct {
+	hash.Hash
+}
+
+func newDigester() *digester {
+	return &digester{sha256.New()}
+}
+
+func (d *digester) digest() string {
+	return "sha256:" + hex.EncodeToString(d.Sum(nil))
+}
@@ -0,0 +1,437 @@
+// Package imagestore keeps the images of the process runtime. Images are
+// pulled from one of three kinds of source:
+//   - oci:<dir>[:<tag>], an OCI image layout directory
+//   - docker-archive:<file>[:<reference>], a docker save tarball
+//   - any other reference, a registry speaking the OCI distribution API
+//
+// The layers of an image are unpacked into a root filesystem addressed by
+// the digest of the image config.
+package imagestore
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	kubecontainer "github.com/xuliangTang/mykubelet/pkg/kubelet/container"
+	v1 "k8s.io/api/core/v1"
+	utilnet "k8s.io/apimachinery/pkg/util/net"
+	runtimeapi "k8s.io/cri-api/pkg/apis/runtime/v1alpha2"
+	"k8s.io/klog/v2"
+)
+
+const (
+	imagesDirName   = "images"
+	imageFileName   = "image.json"
+	rootfsDirName   = "rootfs"
+	pullingDirName  = ".pulling"
+	removingDirName = ".removing"
+)
+
+// Store keeps the images below its root directory, one directory per image
+// named after the hex digest of its config:
+//
+//	images/<hex>/image.json  the record of the image
+//	images/<hex>/rootfs      the unpacked layers of the image
+type Store struct {
+	root   string
+	client *http.Client
+
+	// pullLock serializes the pulls, the way the kubelet does by default.
+	pullLock sync.Mutex
+	// lock protects images.
+	lock   sync.RWMutex
+	images map[string]*Image
+}
+
+var _ kubecontainer.ImageService = &Store{}
+
+// NewStore creates a store keeping its images below root, and loads the
+// images pulled before.
+func NewStore(root string) (*Store, error) {
+	imagesDir := filepath.Join(root, imagesDirName)
+	if err := os.MkdirAll(imagesDir, 0700); err != nil {
+		return nil, fmt.Errorf("failed to create %q: %v", imagesDir, err)
+	}
+	s := &Store{
+		root: root,
+		client: &http.Client{
+			Transport: utilnet.SetTransportDefaults(&http.Transport{
+				Proxy: http.ProxyFromEnvironment,
+				DialContext: (&net.Dialer{
+					Timeout:   30 * time.Second,
+					KeepAlive: 30 * time.Second,
+				}).DialContext,
+				ResponseHeaderTimeout: time.Minute,
+			}),
+		},
+		images: make(map[string]*Image),
+	}
+	if err := s.load(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// load reads the records of the images. Leftovers of interrupted pulls and
+// removals are cleaned up.
+func (s *Store) load() error {
+	imagesDir := filepath.Join(s.root, imagesDirName)
+	entries, err := os.ReadDir(imagesDir)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		dir := filepath.Join(imagesDir, entry.Name())
+		if strings.HasPrefix(entry.Name(), ".") {
+			if err := os.RemoveAll(dir); err != nil {
+				klog.ErrorS(err, "Failed to remove leftover image directory", "path", dir)
+			}
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(dir, imageFileName))
+		if err != nil {
+			klog.ErrorS(err, "Failed to read image record", "path", dir)
+			continue
+		}
+		image := &Image{}
+		if err := json.Unmarshal(data, image); err != nil {
+			klog.ErrorS(err, "Failed to decode image record", "path", dir)
+			continue
+		}
+		s.images[image.ID] = image
+	}
+	return nil
+}
+
+// PullImage pulls an image into the store and returns its ID.
+func (s *Store) PullImage(image kubecontainer.ImageSpec, pullSecrets []v1.Secret, podSandboxConfig *runtimeapi.PodSandboxConfig) (string, error) {
+	name, err := normalizeImage(image.Image)
+	if err != nil {
+		return "", err
+	}
+
+	var (
+		src        source
+		repoDigest func(digest string) string
+	)
+	switch {
+	case strings.HasPrefix(image.Image, layoutPrefix):
+		src = newLayoutSource(image.Image)
+	case strings.HasPrefix(image.Image, archivePrefix):
+		src = newArchiveSource(image.Image)
+	default:
+		ref, err := parseReference(image.Image)
+		if err != nil {
+			return "", err
+		}
+		src = newRegistrySource(ref, s.client, credentialFor(ref, pullSecrets))
+		repoDigest = func(digest string) string {
+			return ref.name() + "@" + digest
+		}
+	}
+
+	s.pullLock.Lock()
+	defer s.pullLock.Unlock()
+
+	m, manifestDigest, err := src.manifest()
+	if err != nil {
+		return "", err
+	}
+	configData, err := readBlob(src, m.Config)
+	if err != nil {
+		return "", fmt.Errorf("failed to read the config of image %q: %v", image.Image, err)
+	}
+	config := &imageConfig{}
+	if err := json.Unmarshal(configData, config); err != nil {
+		return "", fmt.Errorf("failed to decode the config of image %q: %v", image.Image, err)
+	}
+	if len(config.RootFS.DiffIDs) != len(m.Layers) {
+		return "", fmt.Errorf("image %q has %d layers but %d diff IDs", image.Image, len(m.Layers), len(config.RootFS.DiffIDs))
+	}
+	id := digestOf(configData)
+
+	s.lock.RLock()
+	_, exists := s.images[id]
+	s.lock.RUnlock()
+	if !exists {
+		klog.V(2).InfoS("Unpacking image", "image", image.Image, "imageID", id, "layers", len(m.Layers))
+		record, err := s.unpack(id, src, m, config)
+		if err != nil {
+			return "", fmt.Errorf("failed to unpack image %q: %v", image.Image, err)
+		}
+		s.lock.Lock()
+		s.images[id] = record
+		s.lock.Unlock()
+	}
+
+	var digests []string
+	if repoDigest != nil && manifestDigest != "" {
+		digests = append(digests, repoDigest(manifestDigest))
+	}
+	if err := s.tag(id, name, digests); err != nil {
+		return "", err
+	}
+	return id, nil
+}
+
+// unpack unpacks the layers of the image into a new image directory.
+func (s *Store) unpack(id string, src source, m *manifest, config *imageConfig) (*Image, error) {
+	tmp := filepath.Join(s.root, imagesDirName, pullingDirName)
+	if err := os.RemoveAll(tmp); err != nil {
+		return nil, err
+	}
+	rootfs := filepath.Join(tmp, rootfsDirName)
+	if err := os.MkdirAll(rootfs, 0755); err != nil {
+		return nil, err
+	}
+	for i, layer := range m.Layers {
+		if err := unpackBlob(rootfs, src, layer, config.RootFS.DiffIDs[i]); err != nil {
+			os.RemoveAll(tmp)
+			return nil, fmt.Errorf("layer %d: %v", i, err)
+		}
+	}
+	size, err := dirSize(rootfs)
+	if err != nil {
+		os.RemoveAll(tmp)
+		return nil, err
+	}
+
+	record := &Image{
+		ID:         id,
+		Size:       size,
+		User:       config.Config.User,
+		Env:        config.Config.Env,
+		Entrypoint: config.Config.Entrypoint,
+		Cmd:        config.Config.Cmd,
+		WorkingDir: config.Config.WorkingDir,
+	}
+	if err := writeImage(tmp, record); err != nil {
+		os.RemoveAll(tmp)
+		return nil, err
+	}
+	// A directory without a readable record is not an image of the store.
+	if err := os.RemoveAll(s.imageDir(id)); err != nil {
+		os.RemoveAll(tmp)
+		return nil, err
+	}
+	if err := os.Rename(tmp, s.imageDir(id)); err != nil {
+		os.RemoveAll(tmp)
+		return nil, err
+	}
+	return record, nil
+}
+
+// unpackBlob unpacks a layer blob onto rootfs, verifying its digest and the
+// digest of its uncompressed content.
+func unpackBlob(rootfs string, src source, layer descriptor, diffID string) error {
+	rc, err := src.blob(layer)
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+
+	blobDigester := newDigester()
+	r, err := decompress(io.TeeReader(rc, blobDigester))
+	if err != nil {
+		return err
+	}
+	diffDigester := newDigester()
+	tee := io.TeeReader(r, diffDigester)
+	if err := unpackLayer(rootfs, tee); err != nil {
+		return err
+	}
+	// The tar may be followed by padding the digests cover.
+	if _, err := io.Copy(io.Discard, tee); err != nil {
+		return err
+	}
+	if _, err := io.Copy(io.Discard, io.TeeReader(rc, blobDigester)); err != nil {
+		return err
+	}
+	if layer.Digest != "" && blobDigester.digest() != layer.Digest {
+		return fmt.Errorf("digest mismatch: expected %s, got %s", layer.Digest, blobDigester.digest())
+	}
+	if diffDigester.digest() != diffID {
+		return fmt.Errorf("diff ID mismatch: expected %s, got %s", diffID, diffDigester.digest())
+	}
+	return nil
+}
+
+// tag makes name and the digests refer to the image, a tag moves from the
+// image it referred to before.
+func (s *Store) tag(id, name string, digests []string) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	for otherID, other := range s.images {
+		if otherID == id {
+			continue
+		}
+		if tags := removeString(other.RepoTags, name); len(tags) != len(other.RepoTags) {
+			other.RepoTags = tags
+			if err := writeImage(s.imageDir(otherID), other); err != nil {
+				return err
+			}
+		}
+	}
+
+	image := s.images[id]
+	image.RepoTags = addString(image.RepoTags, name)
+	for _, digest := range digests {
+		image.RepoDigests = addString(image.RepoDigests, digest)
+	}
+	return writeImage(s.imageDir(id), image)
+}
+
+// GetImageRef returns the ID of the image if it is in the store, and "" otherwise.
+func (s *Store) GetImageRef(image kubecontainer.ImageSpec) (string, error) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	if record := s.findLocked(image.Image); record != nil {
+		return record.ID, nil
+	}
+	return "", nil
+}
+
+// GetImage returns the image referred to by a name, digest or ID.
+func (s *Store) GetImage(image string) (*Image, bool) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	record := s.findLocked(image)
+	if record == nil {
+		return nil, false
+	}
+	copied := *record
+	return &copied, true
+}
+
+// findLocked returns the image referred to by a name, digest or ID. The
+// caller must hold the lock.
+func (s *Store) findLocked(image string) *Image {
+	if record, ok := s.images[image]; ok {
+		return record
+	}
+	name, err := normalizeImage(image)
+	if err != nil {
+		return nil
+	}
+	for _, record := range s.images {
+		for _, ref := range append(record.RepoTags, record.RepoDigests...) {
+			if ref == name {
+				return record
+			}
+		}
+	}
+	return nil
+}
+
+// RootfsPath returns the root filesystem of the image with the given ID.
+func (s *Store) RootfsPath(id string) string {
+	return filepath.Join(s.imageDir(id), rootfsDirName)
+}
+
+// ListImages returns the images of the store.
+func (s *Store) ListImages() ([]kubecontainer.Image, error) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	images := make([]kubecontainer.Image, 0, len(s.images))
+	for _, record := range s.images {
+		images = append(images, kubecontainer.Image{
+			ID:          record.ID,
+			RepoTags:    append([]string(nil), record.RepoTags...),
+			RepoDigests: append([]string(nil), record.RepoDigests...),
+			Size:        record.Size,
+			Spec:        kubecontainer.ImageSpec{Image: record.ID},
+		})
+	}
+	sort.Slice(images, func(i, j int) bool {
+		return images[i].ID < images[j].ID
+	})
+	return images, nil
+}
+
+// RemoveImage removes the image with all its tags. Removing an image which
+// is not in the store is not an error.
+func (s *Store) RemoveImage(image kubecontainer.ImageSpec) error {
+	s.lock.Lock()
+	record := s.findLocked(image.Image)
+	if record == nil {
+		s.lock.Unlock()
+		return nil
+	}
+	delete(s.images, record.ID)
+	s.lock.Unlock()
+
+	// The directory is renamed first so that a half removed image is never loaded.
+	removing := filepath.Join(s.root, imagesDirName, removingDirName+"-"+hexOf(record.ID))
+	if err := os.Rename(s.imageDir(record.ID), removing); err != nil {
+		return fmt.Errorf("failed to remove image %q: %v", record.ID, err)
+	}
+	if err := os.RemoveAll(removing); err != nil {
+		return fmt.Errorf("failed to remove image %q: %v", record.ID, err)
+	}
+	return nil
+}
+
+// ImageStats returns the disk usage of the images.
+func (s *Store) ImageStats() (*kubecontainer.ImageStats, error) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	stats := &kubecontainer.ImageStats{}
+	for _, record := range s.images {
+		stats.TotalStorageBytes += uint64(record.Size)
+	}
+	return stats, nil
+}
+
+// imageDir returns the directory of the image with the given ID.
+func (s *Store) imageDir(id string) string {
+	return filepath.Join(s.root, imagesDirName, hexOf(id))
+}
+
+// hexOf returns the hex part of a digest.
+func hexOf(digest string) string {
+	if i := strings.Index(digest, ":"); i >= 0 {
+		return digest[i+1:]
+	}
+	return digest
+}
+
+// writeImage atomically writes the record of an image into dir.
+func writeImage(dir string, image *Image) error {
+	data, err := json.Marshal(image)
+	if err != nil {
+		return err
+	}
+	tmp := filepath.Join(dir, "."+imageFileName)
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, filepath.Join(dir, imageFileName))
+}
+
+func addString(list []string, s string) []string {
+	for _, item := range list {
+		if item == s {
+			return list
+		}
+	}
+	return append(list, s)
+}
+
+func removeString(list []string, s string) []string {
+	var result []string
+	for _, item := range list {
+		if item != s {
+			result = append(result, item)
+		}
+	}
+	return result
+}
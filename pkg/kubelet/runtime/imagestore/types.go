@@ -0,0 +1,92 @@
+package imagestore
+
+const (
+	mediaTypeOCIManifest    = "application/vnd.oci.image.manifest.v1+json"
+	mediaTypeOCIIndex       = "application/vnd.oci.image.index.v1+json"
+	mediaTypeDockerManifest = "application/vnd.docker.distribution.manifest.v2+json"
+	mediaTypeDockerList     = "application/vnd.docker.distribution.manifest.list.v2+json"
+
+	// annotationRefName is the annotation of an OCI layout index entry
+	// holding the tag of the manifest.
+	annotationRefName = "org.opencontainers.image.ref.name"
+)
+
+// descriptor describes the content of a blob.
+type descriptor struct {
+	MediaType   string            `json:"mediaType,omitempty"`
+	Digest      string            `json:"digest"`
+	Size        int64             `json:"size"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+	Platform    *platform         `json:"platform,omitempty"`
+}
+
+// platform is the platform a manifest of an index is built for.
+type platform struct {
+	Architecture string `json:"architecture"`
+	OS           string `json:"os"`
+	Variant      string `json:"variant,omitempty"`
+}
+
+// manifest is an OCI image manifest, or a docker schema 2 manifest which has
+// the same shape.
+type manifest struct {
+	SchemaVersion int          `json:"schemaVersion"`
+	MediaType     string       `json:"mediaType,omitempty"`
+	Config        descriptor   `json:"config"`
+	Layers        []descriptor `json:"layers"`
+	// Manifests is only set when the document turns out to be an index.
+	Manifests []descriptor `json:"manifests,omitempty"`
+}
+
+// index is an OCI image index, or a docker manifest list.
+type index struct {
+	SchemaVersion int          `json:"schemaVersion"`
+	MediaType     string       `json:"mediaType,omitempty"`
+	Manifests     []descriptor `json:"manifests"`
+}
+
+// imageConfig is the part of an OCI image config the store cares about.
+type imageConfig struct {
+	Architecture string          `json:"architecture"`
+	OS           string          `json:"os"`
+	Config       containerConfig `json:"config"`
+	RootFS       struct {
+		Type    string   `json:"type"`
+		DiffIDs []string `json:"diff_ids"`
+	} `json:"rootfs"`
+}
+
+// containerConfig is the default configuration of a container of the image.
+type containerConfig struct {
+	User       string   `json:"User,omitempty"`
+	Env        []string `json:"Env,omitempty"`
+	Entrypoint []string `json:"Entrypoint,omitempty"`
+	Cmd        []string `json:"Cmd,omitempty"`
+	WorkingDir string   `json:"WorkingDir,omitempty"`
+}
+
+// archiveManifest is an entry of the manifest.json of a docker save tarball.
+type archiveManifest struct {
+	Config   string   `json:"Config"`
+	RepoTags []string `json:"RepoTags"`
+	Layers   []string `json:"Layers"`
+}
+
+// Image is an image of the store.
+type Image struct {
+	// ID is the digest of the image config.
+	ID string `json:"id"`
+	// RepoTags and RepoDigests are the references the image was pulled by.
+	RepoTags    []string `json:"repoTags,omitempty"`
+	RepoDigests []string `json:"repoDigests,omitempty"`
+	// Size is the disk usage of the unpacked image.
+	Size int64 `json:"size"`
+
+	// User, Env, Entrypoint, Cmd and WorkingDir are the defaults of the
+	// containers of the image.
+	User       string   `json:"user,omitempty"`
+	Env        []string `json:"env,omitempty"`
+	Entrypoint []string `json:"entrypoint,omitempty"`
+	Cmd        []string `json:"cmd,omitempty"`
+	WorkingDir string   `json:"workingDir,omitempty"`
+}
@@ -0,0 +1,215 @@
+package imagestore
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/xuliangTang/mykubelet/pkg/util/filesystem"
+)
+
+const (
+	// whiteoutPrefix marks a file of a lower layer removed by the layer.
+	whiteoutPrefix = ".wh."
+	// whiteoutOpaqueDir marks a directory whose content of the lower layers
+	// is replaced by the layer.
+	whiteoutOpaqueDir = whiteoutPrefix + whiteoutPrefix + ".opq"
+
+	// paxSchilyXattr is the prefix of the PAX records holding extended attributes.
+	paxSchilyXattr = "SCHILY.xattr."
+)
+
+var (
+	gzipMagic = []byte{0x1f, 0x8b}
+	zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+)
+
+// decompress returns the uncompressed content of a layer blob, which is
+// either a plain or a gzip compressed tar.
+func decompress(r io.Reader) (io.Reader, error) {
+	br := bufio.NewReader(r)
+	magic, err := br.Peek(4)
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	switch {
+	case bytes.HasPrefix(magic, gzipMagic):
+		return gzip.NewReader(br)
+	case bytes.HasPrefix(magic, zstdMagic):
+		return nil, fmt.Errorf("zstd compressed layers are not supported")
+	default:
+		return br, nil
+	}
+}
+
+// unpackLayer applies the layer tar read from r onto root, which holds the
+// layers below it. Whiteouts remove what the lower layers created.
+func unpackLayer(root string, r io.Reader) error {
+	tr := tar.NewReader(r)
+	// created is what the layer itself has created, opaque directories only
+	// hide the content of the lower layers.
+	created := map[string]bool{}
+	type dirTimes struct {
+		path  string
+		atime time.Time
+		mtime time.Time
+	}
+	var dirs []dirTimes
+
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read layer: %v", err)
+		}
+		name := path.Clean("/" + hdr.Name)
+		if name == "/" {
+			continue
+		}
+		dir, base := path.Split(name)
+		parent, err := filesystem.SecureJoin(root, dir)
+		if err != nil {
+			return err
+		}
+
+		if base == whiteoutOpaqueDir {
+			entries, err := os.ReadDir(parent)
+			if err != nil && !os.IsNotExist(err) {
+				return err
+			}
+			for _, entry := range entries {
+				if created[path.Join(dir, entry.Name())] {
+					continue
+				}
+				if err := os.RemoveAll(filepath.Join(parent, entry.Name())); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+		if strings.HasPrefix(base, whiteoutPrefix) {
+			target, err := whiteoutTarget(parent, strings.TrimPrefix(base, whiteoutPrefix))
+			if err != nil {
+				return fmt.Errorf("invalid whiteout %q: %v", hdr.Name, err)
+			}
+			if err := os.RemoveAll(target); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if err := os.MkdirAll(parent, 0755); err != nil {
+			return err
+		}
+		target := filepath.Join(parent, base)
+		if fi, err := os.Lstat(target); err == nil {
+			if !(fi.IsDir() && hdr.Typeflag == tar.TypeDir) {
+				if err := os.RemoveAll(target); err != nil {
+					return err
+				}
+			}
+		}
+
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			if err := os.Mkdir(target, 0755); err != nil && !os.IsExist(err) {
+				return err
+			}
+			dirs = append(dirs, dirTimes{path: target, atime: hdr.AccessTime, mtime: hdr.ModTime})
+		case tar.TypeReg, tar.TypeRegA:
+			f, err := os.OpenFile(target, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+			if err != nil {
+				return err
+			}
+			_, err = io.Copy(f, tr)
+			if closeErr := f.Close(); err == nil {
+				err = closeErr
+			}
+			if err != nil {
+				return err
+			}
+		case tar.TypeSymlink:
+			if err := os.Symlink(hdr.Linkname, target); err != nil {
+				return err
+			}
+		case tar.TypeLink:
+			source, err := filesystem.SecureJoin(root, hdr.Linkname)
+			if err != nil {
+				return err
+			}
+			if err := os.Link(source, target); err != nil {
+				return err
+			}
+		case tar.TypeChar, tar.TypeBlock, tar.TypeFifo:
+			if err := mknod(target, hdr); err != nil {
+				return err
+			}
+		default:
+			// Global headers and anything unknown are skipped.
+			continue
+		}
+		created[name] = true
+		if hdr.Typeflag == tar.TypeLink {
+			continue
+		}
+
+		if err := os.Lchown(target, hdr.Uid, hdr.Gid); err != nil && os.Geteuid() == 0 {
+			return err
+		}
+		if hdr.Typeflag != tar.TypeSymlink {
+			// chown clears the setuid and setgid bits, the mode goes last.
+			if err := os.Chmod(target, hdr.FileInfo().Mode()); err != nil {
+				return err
+			}
+		}
+		for key, value := range hdr.PAXRecords {
+			if xattr := strings.TrimPrefix(key, paxSchilyXattr); xattr != key {
+				setXattr(target, xattr, value)
+			}
+		}
+		if hdr.Typeflag != tar.TypeDir {
+			setTimes(target, hdr.AccessTime, hdr.ModTime)
+		}
+	}
+
+	// The times of the directories are set once their content is written.
+	for i := len(dirs) - 1; i >= 0; i-- {
+		setTimes(dirs[i].path, dirs[i].atime, dirs[i].mtime)
+	}
+	return nil
+}
+
+// whiteoutTarget returns the path of the file name removed by a whiteout in
+// the directory parent, which is already resolved below the root. The name
+// must be the one of a file of parent, so that nothing out of it is removed.
+func whiteoutTarget(parent, name string) (string, error) {
+	if name == "" || name == "." || name == ".." || strings.ContainsAny(name, "/"+string(filepath.Separator)) {
+		return "", fmt.Errorf("%q is not a file name", name)
+	}
+	return filepath.Join(parent, name), nil
+}
+
+// dirSize returns the size of the files below dir.
+func dirSize(dir string) (int64, error) {
+	var size int64
+	err := filepath.Walk(dir, func(_ string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.Mode().IsRegular() {
+			size += info.Size()
+		}
+		return nil
+	})
+	return size, err
+}
@@ -0,0 +1,41 @@
+//go:build linux
+// +build linux
+
+package imagestore
+
+import (
+	"archive/tar"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// mknod creates the device or fifo of the header.
+func mknod(path string, hdr *tar.Header) error {
+	mode := uint32(hdr.Mode & 07777)
+	switch hdr.Typeflag {
+	case tar.TypeChar:
+		mode |= unix.S_IFCHR
+	case tar.TypeBlock:
+		mode |= unix.S_IFBLK
+	case tar.TypeFifo:
+		mode |= unix.S_IFIFO
+	}
+	return unix.Mknod(path, mode, int(unix.Mkdev(uint32(hdr.Devmajor), uint32(hdr.Devminor))))
+}
+
+// setXattr sets an extended attribute of the file, without following
+// symlinks. Attributes the filesystem does not support are dropped.
+func setXattr(path, name, value string) {
+	unix.Lsetxattr(path, name, []byte(value), 0)
+}
+
+// setTimes sets the access and modification times of the file, without
+// following symlinks.
+func setTimes(path string, atime, mtime time.Time) {
+	if atime.IsZero() {
+		atime = mtime
+	}
+	ts := []unix.Timespec{unix.NsecToTimespec(atime.UnixNano()), unix.NsecToTimespec(mtime.UnixNano())}
+	unix.UtimesNanoAt(unix.AT_FDCWD, path, ts, unix.AT_SYMLINK_NOFOLLOW)
+}
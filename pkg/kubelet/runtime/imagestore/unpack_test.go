@@ -0,0 +1,209 @@
+package imagestore
+
+import (
+	"archive/tar"
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// testEntry is an entry of a test layer: a directory if its name ends with
+// a slash, a symlink or hardlink to link, or a file with content.
+type testEntry struct {
+	name     string
+	content  string
+	symlink  string
+	hardlink string
+}
+
+func makeTestLayer(t *testing.T, entries ...testEntry) *bytes.Buffer {
+	t.Helper()
+	buf := &bytes.Buffer{}
+	tw := tar.NewWriter(buf)
+	for _, e := range entries {
+		hdr := &tar.Header{Name: e.name, Mode: 0644, Typeflag: tar.TypeReg, Size: int64(len(e.content))}
+		switch {
+		case strings.HasSuffix(e.name, "/"):
+			hdr.Typeflag, hdr.Mode, hdr.Size = tar.TypeDir, 0755, 0
+		case e.symlink != "":
+			hdr.Typeflag, hdr.Linkname, hdr.Size = tar.TypeSymlink, e.symlink, 0
+		case e.hardlink != "":
+			hdr.Typeflag, hdr.Linkname, hdr.Size = tar.TypeLink, e.hardlink, 0
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(e.content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf
+}
+
+// listFiles returns the paths below root, with the content of the files.
+func listFiles(t *testing.T, root string) map[string]string {
+	t.Helper()
+	files := map[string]string{}
+	err := filepath.Walk(root, func(p string, info os.FileInfo, err error) error {
+		if err != nil || p == root {
+			return err
+		}
+		rel, _ := filepath.Rel(root, p)
+		switch {
+		case info.IsDir():
+			files[rel+"/"] = ""
+		case info.Mode()&os.ModeSymlink != 0:
+			link, _ := os.Readlink(p)
+			files[rel] = "-> " + link
+		default:
+			data, err := os.ReadFile(p)
+			if err != nil {
+				return err
+			}
+			files[rel] = string(data)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return files
+}
+
+func TestUnpackLayer(t *testing.T) {
+	lower := []testEntry{
+		{name: "etc/"},
+		{name: "etc/hosts", content: "hosts"},
+		{name: "etc/passwd", content: "passwd"},
+		{name: "etc/link", symlink: "passwd"},
+		{name: "var/"},
+		{name: "var/lib/"},
+		{name: "var/lib/a", content: "a"},
+		{name: "var/lib/b", content: "b"},
+	}
+	for desc, test := range map[string]struct {
+		layer    []testEntry
+		expected map[string]string
+	}{
+		"files replaced": {
+			layer: []testEntry{
+				{name: "etc/hosts", content: "new hosts"},
+				{name: "var/lib/", content: ""},
+				{name: "var/lib/a", symlink: "b"},
+			},
+			expected: map[string]string{
+				"etc/": "", "etc/hosts": "new hosts", "etc/passwd": "passwd", "etc/link": "-> passwd",
+				"var/": "", "var/lib/": "", "var/lib/a": "-> b", "var/lib/b": "b",
+			},
+		},
+		"whiteouts remove files": {
+			layer: []testEntry{
+				{name: "etc/.wh.hosts"},
+				{name: "etc/.wh.link"},
+				{name: ".wh.var"},
+			},
+			expected: map[string]string{"etc/": "", "etc/passwd": "passwd"},
+		},
+		"whiteouts of missing files": {
+			layer: []testEntry{
+				{name: "etc/.wh.missing"},
+				{name: "missing/.wh.missing"},
+			},
+			expected: map[string]string{
+				"etc/": "", "etc/hosts": "hosts", "etc/passwd": "passwd", "etc/link": "-> passwd",
+				"var/": "", "var/lib/": "", "var/lib/a": "a", "var/lib/b": "b",
+			},
+		},
+		"opaque directory hides the lower layers": {
+			layer: []testEntry{
+				{name: "var/lib/"},
+				{name: "var/lib/c", content: "c"},
+				{name: "var/lib/.wh..wh..opq"},
+			},
+			expected: map[string]string{
+				"etc/": "", "etc/hosts": "hosts", "etc/passwd": "passwd", "etc/link": "-> passwd",
+				"var/": "", "var/lib/": "", "var/lib/c": "c",
+			},
+		},
+		"hardlinks": {
+			layer: []testEntry{
+				{name: "etc/hosts2", hardlink: "etc/hosts"},
+				{name: "etc/passwd2", hardlink: "/etc/link"},
+				{name: "var/escaped", hardlink: "../../etc/passwd"},
+			},
+			expected: map[string]string{
+				"etc/": "", "etc/hosts": "hosts", "etc/passwd": "passwd", "etc/link": "-> passwd",
+				"etc/hosts2": "hosts", "etc/passwd2": "passwd", "var/escaped": "passwd",
+				"var/": "", "var/lib/": "", "var/lib/a": "a", "var/lib/b": "b",
+			},
+		},
+		"whiteout through a symlink stays in the root": {
+			layer: []testEntry{
+				{name: "up", symlink: "../.."},
+				{name: "up/.wh.etc"},
+			},
+			expected: map[string]string{
+				"up": "-> ../..", "var/": "", "var/lib/": "", "var/lib/a": "a", "var/lib/b": "b",
+			},
+		},
+	} {
+		t.Run(desc, func(t *testing.T) {
+			root := filepath.Join(t.TempDir(), "rootfs")
+			if err := os.Mkdir(root, 0755); err != nil {
+				t.Fatal(err)
+			}
+			if err := unpackLayer(root, makeTestLayer(t, lower...)); err != nil {
+				t.Fatalf("failed to unpack the lower layer: %v", err)
+			}
+			if err := unpackLayer(root, makeTestLayer(t, test.layer...)); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if files := listFiles(t, root); !reflect.DeepEqual(files, test.expected) {
+				t.Errorf("expected %v, got %v", test.expected, files)
+			}
+		})
+	}
+}
+
+func TestUnpackLayerInvalidWhiteouts(t *testing.T) {
+	for desc, name := range map[string]string{
+		"empty name":        "etc/.wh.",
+		"current directory": "etc/.wh..",
+		"parent directory":  "etc/.wh...",
+		"root parent":       ".wh...",
+	} {
+		t.Run(desc, func(t *testing.T) {
+			dir := t.TempDir()
+			root := filepath.Join(dir, "rootfs")
+			if err := os.Mkdir(root, 0755); err != nil {
+				t.Fatal(err)
+			}
+			outside := filepath.Join(dir, "outside")
+			if err := os.WriteFile(outside, []byte("outside"), 0644); err != nil {
+				t.Fatal(err)
+			}
+			if err := unpackLayer(root, makeTestLayer(t, testEntry{name: "etc/"}, testEntry{name: "etc/hosts", content: "hosts"})); err != nil {
+				t.Fatalf("failed to unpack the lower layer: %v", err)
+			}
+
+			if err := unpackLayer(root, makeTestLayer(t, testEntry{name: name})); err == nil {
+				t.Error("expected the whiteout to be rejected")
+			}
+			var files []string
+			for f := range listFiles(t, dir) {
+				files = append(files, f)
+			}
+			sort.Strings(files)
+			if expected := []string{"outside", "rootfs/", "rootfs/etc/", "rootfs/etc/hosts"}; !reflect.DeepEqual(files, expected) {
+				t.Errorf("expected %v to be left, got %v", expected, files)
+			}
+		})
+	}
+}
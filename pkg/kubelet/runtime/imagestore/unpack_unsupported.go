@@ -0,0 +1,26 @@
+//go:build !linux
+// +build !linux
+
+package imagestore
+
+import (
+	"archive/tar"
+	"fmt"
+	"os"
+	"time"
+)
+
+// mknod is not supported on this platform.
+func mknod(path string, hdr *tar.Header) error {
+	return fmt.Errorf("can not create the special file %q on this platform", hdr.Name)
+}
+
+// setXattr drops extended attributes on this platform.
+func setXattr(path, name, value string) {}
+
+// setTimes sets the times of the file, symlinks are left alone.
+func setTimes(path string, atime, mtime time.Time) {
+	if fi, err := os.Lstat(path); err == nil && fi.Mode()&os.ModeSymlink == 0 {
+		os.Chtimes(path, atime, mtime)
+	}
+}
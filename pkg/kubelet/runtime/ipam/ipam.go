@@ -0,0 +1,295 @@
+// Package ipam allocates the IPs of pod sandboxes from the pod CIDRs of the
+// node, one IP per family of CIDR. The allocations are checkpointed to a file
+// so that the IPs of the pods outlive a kubelet restart.
+package ipam
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"k8s.io/klog/v2"
+	netutils "k8s.io/utils/net"
+)
+
+// ErrNoPodCIDR is returned by Allocate while the node has no pod CIDR.
+var ErrNoPodCIDR = errors.New("node has no pod CIDR")
+
+// checkpoint is the content of the checkpoint file.
+type checkpoint struct {
+	// CIDRs are the pod CIDRs of the node the IPs were allocated from.
+	CIDRs []string `json:"cidrs,omitempty"`
+	// Allocations are the IPs allocated to each sandbox, keyed by sandbox id.
+	Allocations map[string][]string `json:"allocations"`
+}
+
+// ipRange is the part of a pod CIDR IPs are allocated from.
+type ipRange struct {
+	cidr *net.IPNet
+	// first and last are the first and the last allocatable IP. The network
+	// address and the gateway at the first host address are reserved, and
+	// so is the broadcast address of an IPv4 range.
+	first, last *big.Int
+	// next is where the search for a free IP starts, IPs are handed out
+	// round robin so that a released IP is not reused right away.
+	next *big.Int
+}
+
+func newIPRange(cidr *net.IPNet) (*ipRange, error) {
+	reserved := int64(2)
+	if netutils.IsIPv4CIDR(cidr) {
+		reserved++
+	}
+	if size := netutils.RangeSize(cidr); size <= reserved {
+		return nil, fmt.Errorf("pod CIDR %s is too small", cidr)
+	}
+	ones, bits := cidr.Mask.Size()
+	base := netutils.BigForIP(cidr.IP)
+	first := new(big.Int).Add(base, big.NewInt(2))
+	last := new(big.Int).Lsh(big.NewInt(1), uint(bits-ones))
+	last.Add(last, base).Sub(last, big.NewInt(1))
+	if netutils.IsIPv4CIDR(cidr) {
+		last.Sub(last, big.NewInt(1))
+	}
+	return &ipRange{cidr: cidr, first: first, last: last, next: new(big.Int).Set(first)}, nil
+}
+
+// Allocator allocates the IPs of pod sandboxes.
+type Allocator struct {
+	path string
+
+	// lock protects all the fields below.
+	lock        sync.Mutex
+	cidrs       []string
+	ranges      []*ipRange
+	allocations map[string][]net.IP
+	// allocated maps every allocated IP to the sandbox holding it.
+	allocated map[string]string
+}
+
+// NewAllocator creates an allocator checkpointing to the file at path, and
+// restores the allocations checkpointed by a previous kubelet.
+func NewAllocator(path string) (*Allocator, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0750); err != nil {
+		return nil, fmt.Errorf("failed to create %q: %v", filepath.Dir(path), err)
+	}
+	a := &Allocator{
+		path:        path,
+		allocations: make(map[string][]net.IP),
+		allocated:   make(map[string]string),
+	}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return a, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read ipam checkpoint %q: %v", path, err)
+	}
+	var cp checkpoint
+	if err := json.Unmarshal(data, &cp); err != nil {
+		return nil, fmt.Errorf("failed to decode ipam checkpoint %q: %v", path, err)
+	}
+	for id, ips := range cp.Allocations {
+		for _, s := range ips {
+			ip := net.ParseIP(s)
+			if ip == nil {
+				return nil, fmt.Errorf("ipam checkpoint %q has an invalid IP %q", path, s)
+			}
+			a.allocations[id] = append(a.allocations[id], ip)
+			a.allocated[ip.String()] = id
+		}
+	}
+	if err := a.setCIDRs(cp.CIDRs); err != nil {
+		klog.ErrorS(err, "Ignoring the pod CIDRs of the ipam checkpoint", "path", path)
+	}
+	return a, nil
+}
+
+// SetCIDRs sets the pod CIDRs IPs are allocated from, at most one per IP
+// family. IPs allocated from previous pod CIDRs stay allocated until their
+// sandbox releases them.
+func (a *Allocator) SetCIDRs(cidrs []string) error {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	if err := a.setCIDRs(cidrs); err != nil {
+		return err
+	}
+	return a.checkpoint()
+}
+
+func (a *Allocator) setCIDRs(cidrs []string) error {
+	if equalStrings(a.cidrs, cidrs) {
+		return nil
+	}
+	var ranges []*ipRange
+	families := map[bool]bool{}
+	for _, s := range cidrs {
+		_, cidr, err := net.ParseCIDR(s)
+		if err != nil {
+			return fmt.Errorf("invalid pod CIDR %q: %v", s, err)
+		}
+		isIPv6 := netutils.IsIPv6CIDR(cidr)
+		if families[isIPv6] {
+			return fmt.Errorf("pod CIDRs %q have more than one CIDR of the same IP family", cidrs)
+		}
+		families[isIPv6] = true
+		r, err := newIPRange(cidr)
+		if err != nil {
+			return err
+		}
+		ranges = append(ranges, r)
+	}
+	a.cidrs = append([]string(nil), cidrs...)
+	a.ranges = ranges
+	return nil
+}
+
+// Allocate allocates one IP from each pod CIDR to the sandbox with the given
+// id, the first IP is of the family of the first pod CIDR. It returns the IPs
+// already allocated to the sandbox if there are any.
+func (a *Allocator) Allocate(id string) ([]net.IP, error) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	if ips, ok := a.allocations[id]; ok {
+		return ips, nil
+	}
+	if len(a.ranges) == 0 {
+		return nil, ErrNoPodCIDR
+	}
+
+	var ips []net.IP
+	for _, r := range a.ranges {
+		ip, err := a.allocateFrom(r)
+		if err != nil {
+			return nil, err
+		}
+		ips = append(ips, ip)
+	}
+	a.allocations[id] = ips
+	for _, ip := range ips {
+		a.allocated[ip.String()] = id
+	}
+	if err := a.checkpoint(); err != nil {
+		a.release(id)
+		return nil, err
+	}
+	return ips, nil
+}
+
+// allocateFrom finds the next free IP of the range. The caller must hold the lock.
+func (a *Allocator) allocateFrom(r *ipRange) (net.IP, error) {
+	start := r.next
+	cur := new(big.Int).Set(start)
+	for {
+		ip := netutils.AddIPOffset(cur, 0)
+		if ip4 := ip.To4(); ip4 != nil {
+			ip = ip4
+		}
+		if cur.Add(cur, big.NewInt(1)).Cmp(r.last) > 0 {
+			cur.Set(r.first)
+		}
+		if _, ok := a.allocated[ip.String()]; !ok {
+			r.next = cur
+			return ip, nil
+		}
+		if cur.Cmp(start) == 0 {
+			return nil, fmt.Errorf("no IP left in pod CIDR %s", r.cidr)
+		}
+	}
+}
+
+// Release releases the IPs allocated to the sandbox with the given id. It is
+// a no-op if the sandbox has no IPs.
+func (a *Allocator) Release(id string) error {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	if _, ok := a.allocations[id]; !ok {
+		return nil
+	}
+	a.release(id)
+	return a.checkpoint()
+}
+
+// ReleaseUnknown releases the IPs of all sandboxes that are not known, such
+// as the sandboxes that went away while the kubelet was down.
+func (a *Allocator) ReleaseUnknown(known func(id string) bool) error {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	released := false
+	for id, ips := range a.allocations {
+		if !known(id) {
+			klog.InfoS("Releasing the IPs of an unknown sandbox", "podSandboxID", id, "IPs", ips)
+			a.release(id)
+			released = true
+		}
+	}
+	if !released {
+		return nil
+	}
+	return a.checkpoint()
+}
+
+// release drops the allocation of a sandbox. The caller must hold the lock.
+func (a *Allocator) release(id string) {
+	for _, ip := range a.allocations[id] {
+		delete(a.allocated, ip.String())
+	}
+	delete(a.allocations, id)
+}
+
+// CIDRs returns the pod CIDRs IPs are allocated from.
+func (a *Allocator) CIDRs() []string {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	return a.cidrs
+}
+
+// Get returns the IPs allocated to the sandbox with the given id.
+func (a *Allocator) Get(id string) []net.IP {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	return a.allocations[id]
+}
+
+// checkpoint atomically writes the allocations to the checkpoint file. The
+// caller must hold the lock.
+func (a *Allocator) checkpoint() error {
+	cp := checkpoint{
+		CIDRs:       a.cidrs,
+		Allocations: make(map[string][]string, len(a.allocations)),
+	}
+	for id, ips := range a.allocations {
+		for _, ip := range ips {
+			cp.Allocations[id] = append(cp.Allocations[id], ip.String())
+		}
+	}
+	data, err := json.Marshal(cp)
+	if err != nil {
+		return err
+	}
+	tmp := filepath.Join(filepath.Dir(a.path), "."+filepath.Base(a.path))
+	if err := os.WriteFile(tmp, data, 0640); err != nil {
+		return fmt.Errorf("failed to write ipam checkpoint: %v", err)
+	}
+	if err := os.Rename(tmp, a.path); err != nil {
+		return fmt.Errorf("failed to write ipam checkpoint: %v", err)
+	}
+	return nil
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,289 @@
+package ipam
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func newTestAllocator(t *testing.T, cidrs ...string) (*Allocator, string) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "ipam", "checkpoint")
+	a, err := NewAllocator(path)
+	if err != nil {
+		t.Fatalf("failed to create the allocator: %v", err)
+	}
+	if len(cidrs) > 0 {
+		if err := a.SetCIDRs(cidrs); err != nil {
+			t.Fatalf("failed to set the pod CIDRs: %v", err)
+		}
+	}
+	return a, path
+}
+
+func ipStrings(ips []net.IP) []string {
+	var s []string
+	for _, ip := range ips {
+		s = append(s, ip.String())
+	}
+	return s
+}
+
+// allocate allocates the IPs of the sandbox id, and returns them.
+func allocate(t *testing.T, a *Allocator, id string) []string {
+	t.Helper()
+	ips, err := a.Allocate(id)
+	if err != nil {
+		t.Fatalf("failed to allocate the IPs of %q: %v", id, err)
+	}
+	return ipStrings(ips)
+}
+
+func TestAllocate(t *testing.T) {
+	for desc, test := range map[string]struct {
+		cidrs []string
+		// expected are the IPs of the sandboxes allocated in order, until
+		// the pod CIDRs have no IP left.
+		expected [][]string
+	}{
+		"IPv4 skips the network, gateway and broadcast addresses": {
+			cidrs:    []string{"10.0.0.0/29"},
+			expected: [][]string{{"10.0.0.2"}, {"10.0.0.3"}, {"10.0.0.4"}, {"10.0.0.5"}, {"10.0.0.6"}},
+		},
+		"smallest IPv4 CIDR": {
+			cidrs:    []string{"10.0.0.4/30"},
+			expected: [][]string{{"10.0.0.6"}},
+		},
+		"IPv6 has no broadcast address": {
+			cidrs:    []string{"fd00::/126"},
+			expected: [][]string{{"fd00::2"}, {"fd00::3"}},
+		},
+		"dual-stack": {
+			cidrs:    []string{"10.0.0.0/30", "fd00::/126"},
+			expected: [][]string{{"10.0.0.2", "fd00::2"}},
+		},
+		"dual-stack with IPv6 first": {
+			cidrs:    []string{"fd00::/126", "10.0.0.0/29"},
+			expected: [][]string{{"fd00::2", "10.0.0.2"}, {"fd00::3", "10.0.0.3"}},
+		},
+	} {
+		t.Run(desc, func(t *testing.T) {
+			a, _ := newTestAllocator(t, test.cidrs...)
+			var allocated [][]string
+			for i := 0; ; i++ {
+				ips, err := a.Allocate(string(rune('a' + i)))
+				if err != nil {
+					break
+				}
+				allocated = append(allocated, ipStrings(ips))
+			}
+			if !reflect.DeepEqual(allocated, test.expected) {
+				t.Errorf("expected %v, got %v", test.expected, allocated)
+			}
+		})
+	}
+}
+
+func TestAllocateSameSandbox(t *testing.T) {
+	a, _ := newTestAllocator(t, "10.0.0.0/24")
+	first := allocate(t, a, "a")
+	if again := allocate(t, a, "a"); !reflect.DeepEqual(again, first) {
+		t.Errorf("expected the IPs of the sandbox %v, got %v", first, again)
+	}
+	if ips := ipStrings(a.Get("a")); !reflect.DeepEqual(ips, first) {
+		t.Errorf("expected %v, got %v", first, ips)
+	}
+	if ips := a.Get("b"); ips != nil {
+		t.Errorf("expected no IPs of an unknown sandbox, got %v", ips)
+	}
+}
+
+func TestAllocateExhaustionAndWraparound(t *testing.T) {
+	a, _ := newTestAllocator(t, "10.0.0.0/29")
+	for _, id := range []string{"a", "b", "c", "d", "e"} {
+		allocate(t, a, id)
+	}
+	if _, err := a.Allocate("f"); err == nil {
+		t.Fatal("expected the pod CIDR to be exhausted")
+	}
+
+	// Released IPs are reused once the search wraps around.
+	if err := a.Release("b"); err != nil {
+		t.Fatal(err)
+	}
+	if err := a.Release("d"); err != nil {
+		t.Fatal(err)
+	}
+	if ips := allocate(t, a, "f"); !reflect.DeepEqual(ips, []string{"10.0.0.3"}) {
+		t.Errorf("expected the first released IP, got %v", ips)
+	}
+	if ips := allocate(t, a, "g"); !reflect.DeepEqual(ips, []string{"10.0.0.5"}) {
+		t.Errorf("expected the second released IP, got %v", ips)
+	}
+	if _, err := a.Allocate("h"); err == nil {
+		t.Error("expected the pod CIDR to be exhausted again")
+	}
+}
+
+func TestAllocateRoundRobin(t *testing.T) {
+	a, _ := newTestAllocator(t, "10.0.0.0/24")
+	allocate(t, a, "a")
+	if err := a.Release("a"); err != nil {
+		t.Fatal(err)
+	}
+	if ips := allocate(t, a, "b"); !reflect.DeepEqual(ips, []string{"10.0.0.3"}) {
+		t.Errorf("expected the released IP not to be reused right away, got %v", ips)
+	}
+}
+
+func TestAllocateErrors(t *testing.T) {
+	a, _ := newTestAllocator(t)
+	if _, err := a.Allocate("a"); err != ErrNoPodCIDR {
+		t.Errorf("expected %v, got %v", ErrNoPodCIDR, err)
+	}
+
+	for desc, cidrs := range map[string][]string{
+		"invalid CIDR":        {"10.0.0.0"},
+		"too small":           {"10.0.0.0/31"},
+		"too small IPv6":      {"fd00::/127"},
+		"two IPv4 CIDRs":      {"10.0.0.0/24", "10.1.0.0/24"},
+		"two IPv6 CIDRs":      {"fd00::/64", "10.0.0.0/24", "fd01::/64"},
+		"second CIDR invalid": {"10.0.0.0/24", "fd00::"},
+	} {
+		t.Run(desc, func(t *testing.T) {
+			a, _ := newTestAllocator(t, "10.2.0.0/24")
+			if err := a.SetCIDRs(cidrs); err == nil {
+				t.Error("expected an error")
+			}
+			if current := a.CIDRs(); !reflect.DeepEqual(current, []string{"10.2.0.0/24"}) {
+				t.Errorf("expected the pod CIDRs to be kept, got %v", current)
+			}
+		})
+	}
+}
+
+func TestSetCIDRsKeepsAllocations(t *testing.T) {
+	a, _ := newTestAllocator(t, "10.0.0.0/24")
+	first := allocate(t, a, "a")
+	if err := a.SetCIDRs([]string{"10.1.0.0/24"}); err != nil {
+		t.Fatal(err)
+	}
+	if ips := ipStrings(a.Get("a")); !reflect.DeepEqual(ips, first) {
+		t.Errorf("expected the IPs of the previous pod CIDR to be kept, got %v", ips)
+	}
+	if ips := allocate(t, a, "b"); !reflect.DeepEqual(ips, []string{"10.1.0.2"}) {
+		t.Errorf("expected an IP of the new pod CIDR, got %v", ips)
+	}
+}
+
+func TestCheckpointRestore(t *testing.T) {
+	a, path := newTestAllocator(t, "10.0.0.0/29", "fd00::/120")
+	allocate(t, a, "a")
+	b := allocate(t, a, "b")
+	allocate(t, a, "c")
+	if err := a.Release("a"); err != nil {
+		t.Fatal(err)
+	}
+
+	restored, err := NewAllocator(path)
+	if err != nil {
+		t.Fatalf("failed to restore the allocator: %v", err)
+	}
+	if cidrs := restored.CIDRs(); !reflect.DeepEqual(cidrs, []string{"10.0.0.0/29", "fd00::/120"}) {
+		t.Errorf("expected the pod CIDRs to be restored, got %v", cidrs)
+	}
+	if ips := ipStrings(restored.Get("b")); !reflect.DeepEqual(ips, b) {
+		t.Errorf("expected the IPs of b %v to be restored, got %v", b, ips)
+	}
+	if ips := restored.Get("a"); ips != nil {
+		t.Errorf("expected the IPs of a to be released, got %v", ips)
+	}
+	// The restored allocations are not handed out again.
+	if ips := allocate(t, restored, "d"); !reflect.DeepEqual(ips, []string{"10.0.0.2", "fd00::2"}) {
+		t.Errorf("expected the IPs released by a, got %v", ips)
+	}
+	if ips := allocate(t, restored, "e"); !reflect.DeepEqual(ips, []string{"10.0.0.5", "fd00::5"}) {
+		t.Errorf("expected the next free IPs, got %v", ips)
+	}
+
+	// No temporary file is left behind.
+	entries, err := os.ReadDir(filepath.Dir(path))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].Name() != filepath.Base(path) {
+		t.Errorf("expected only the checkpoint, got %v", entries)
+	}
+}
+
+func TestCheckpointRestoreErrors(t *testing.T) {
+	for desc, content := range map[string]string{
+		"invalid JSON": "{",
+		"invalid IP":   `{"allocations":{"a":["10.0.0"]}}`,
+	} {
+		t.Run(desc, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "checkpoint")
+			if err := os.WriteFile(path, []byte(content), 0640); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := NewAllocator(path); err == nil {
+				t.Error("expected an error")
+			}
+		})
+	}
+
+	// Invalid pod CIDRs are dropped, the allocations are kept.
+	path := filepath.Join(t.TempDir(), "checkpoint")
+	if err := os.WriteFile(path, []byte(`{"cidrs":["10.0.0.0/31"],"allocations":{"a":["10.0.0.2"]}}`), 0640); err != nil {
+		t.Fatal(err)
+	}
+	a, err := NewAllocator(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cidrs := a.CIDRs(); len(cidrs) != 0 {
+		t.Errorf("expected no pod CIDRs, got %v", cidrs)
+	}
+	if ips := ipStrings(a.Get("a")); !reflect.DeepEqual(ips, []string{"10.0.0.2"}) {
+		t.Errorf("expected the allocation to be restored, got %v", ips)
+	}
+}
+
+func TestReleaseUnknown(t *testing.T) {
+	a, path := newTestAllocator(t, "10.0.0.0/24")
+	allocate(t, a, "a")
+	b := allocate(t, a, "b")
+	allocate(t, a, "c")
+
+	known := map[string]bool{"b": true}
+	if err := a.ReleaseUnknown(func(id string) bool { return known[id] }); err != nil {
+		t.Fatal(err)
+	}
+	for _, id := range []string{"a", "c"} {
+		if ips := a.Get(id); ips != nil {
+			t.Errorf("expected the IPs of %s to be released, got %v", id, ips)
+		}
+	}
+	if ips := ipStrings(a.Get("b")); !reflect.DeepEqual(ips, b) {
+		t.Errorf("expected the IPs of b to be kept, got %v", ips)
+	}
+
+	// The release is checkpointed.
+	restored, err := NewAllocator(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ips := restored.Get("a"); ips != nil {
+		t.Errorf("expected the release to be checkpointed, got %v", ips)
+	}
+	if ips := ipStrings(restored.Get("b")); !reflect.DeepEqual(ips, b) {
+		t.Errorf("expected the IPs of b to be restored, got %v", ips)
+	}
+
+	// Releasing a sandbox without IPs is a no-op.
+	if err := a.Release("a"); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
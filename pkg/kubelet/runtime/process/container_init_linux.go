@@ -0,0 +1,272 @@
+//go:build linux
+// +build linux
+
+package process
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+const (
+	// containerInitName is the argv[0] the kubelet binary is re-executed with
+	// to apply what the kernel can not be told through SysProcAttr, before
+	// executing the command of the container in place.
+	containerInitName = "mykubelet-container-init"
+
+	// containerInitExitCode is the exit code of a container init that failed.
+	containerInitExitCode = 126
+
+	// rootfsFd is the descriptor of the root filesystem handed to the
+	// container init, the first extra file of its command.
+	rootfsFd = 3
+)
+
+// containerInitConfig is handed to the container init as its first argument.
+type containerInitConfig struct {
+	// Bounding is the bounding set to keep, nil to leave it untouched.
+	Bounding []int `json:"bounding,omitempty"`
+	// Ambient are the capabilities of a non-root process.
+	Ambient []int `json:"ambient,omitempty"`
+	// NoNewPrivileges sets no_new_privs.
+	NoNewPrivileges bool `json:"noNewPrivileges,omitempty"`
+	// Chroot changes root into the directory open as rootfsFd, with Dir as
+	// the working directory. The command is looked up in it.
+	Chroot bool   `json:"chroot,omitempty"`
+	Dir    string `json:"dir,omitempty"`
+}
+
+func init() {
+	// The container init runs before anything else of the kubelet, whatever
+	// the main package is.
+	if len(os.Args) > 0 && os.Args[0] == containerInitName {
+		containerInit()
+	}
+}
+
+// containerInit applies the container init config then executes the
+// command, it never returns.
+func containerInit() {
+	// Capabilities and no_new_privs are attributes of the thread.
+	runtime.LockOSThread()
+	if err := runContainerInit(os.Args[1:]); err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", containerInitName, err)
+		os.Exit(containerInitExitCode)
+	}
+}
+
+func runContainerInit(args []string) error {
+	if len(args) < 3 {
+		return fmt.Errorf("expected a config, a path and an argv, got %q", args)
+	}
+	var config containerInitConfig
+	if err := json.Unmarshal([]byte(args[0]), &config); err != nil {
+		return fmt.Errorf("invalid config: %v", err)
+	}
+	path, argv := args[1], args[2:]
+
+	if config.Chroot {
+		// The directory is entered through its descriptor, a non-root
+		// process may not be allowed to search the directories above it.
+		if err := unix.Fchdir(rootfsFd); err != nil {
+			return fmt.Errorf("failed to enter the root filesystem: %v", err)
+		}
+		if err := unix.Chroot("."); err != nil {
+			return fmt.Errorf("failed to change root: %v", err)
+		}
+		unix.Close(rootfsFd)
+		dir := config.Dir
+		if dir == "" {
+			dir = "/"
+		}
+		if err := os.Chdir(dir); err != nil {
+			return fmt.Errorf("failed to change into the working directory: %v", err)
+		}
+		// The PATH of the environment is the one of the container.
+		if !strings.Contains(path, "/") {
+			resolved, err := exec.LookPath(path)
+			if err != nil {
+				return err
+			}
+			path = resolved
+		}
+	}
+	if config.Bounding != nil {
+		if err := limitCapabilities(config.Bounding, config.Ambient); err != nil {
+			return err
+		}
+	}
+	if config.NoNewPrivileges {
+		if err := unix.Prctl(unix.PR_SET_NO_NEW_PRIVS, 1, 0, 0, 0); err != nil {
+			return fmt.Errorf("failed to set no_new_privs: %v", err)
+		}
+	}
+	return syscall.Exec(path, argv, os.Environ())
+}
+
+// limitCapabilities drops the capabilities out of the bounding set, which is
+// what a root process gets on exec. A non-root process is left with the
+// ambient capabilities only, CAP_SETPCAP needed to drop the bounding set
+// included.
+func limitCapabilities(bounding, ambient []int) error {
+	keep := make(map[int]bool, len(bounding))
+	for _, c := range bounding {
+		keep[c] = true
+	}
+	for c := 0; c <= lastCapability(); c++ {
+		if keep[c] {
+			continue
+		}
+		if err := unix.Prctl(unix.PR_CAPBSET_DROP, uintptr(c), 0, 0, 0); err != nil && err != unix.EINVAL {
+			return fmt.Errorf("failed to drop capability %d from the bounding set: %v", c, err)
+		}
+	}
+
+	hdr := unix.CapUserHeader{Version: unix.LINUX_CAPABILITY_VERSION_3}
+	var data [2]unix.CapUserData
+	if err := unix.Capget(&hdr, &data[0]); err != nil {
+		return fmt.Errorf("failed to get capabilities: %v", err)
+	}
+	if os.Getuid() == 0 {
+		// Inheritable capabilities would be regained by root on exec.
+		var mask [2]uint32
+		for _, c := range bounding {
+			mask[c/32] |= 1 << (uint(c) % 32)
+		}
+		for i := range data {
+			data[i].Inheritable &= mask[i]
+		}
+	} else {
+		if err := unix.Prctl(unix.PR_CAP_AMBIENT, unix.PR_CAP_AMBIENT_CLEAR_ALL, 0, 0, 0); err != nil {
+			return fmt.Errorf("failed to clear ambient capabilities: %v", err)
+		}
+		var mask [2]uint32
+		for _, c := range ambient {
+			mask[c/32] |= 1 << (uint(c) % 32)
+		}
+		for i := range data {
+			data[i].Effective = mask[i]
+			data[i].Permitted = mask[i]
+			data[i].Inheritable = mask[i]
+		}
+	}
+	if err := unix.Capset(&hdr, &data[0]); err != nil {
+		return fmt.Errorf("failed to set capabilities: %v", err)
+	}
+	if os.Getuid() != 0 {
+		for _, c := range ambient {
+			if err := unix.Prctl(unix.PR_CAP_AMBIENT, unix.PR_CAP_AMBIENT_RAISE, uintptr(c), 0, 0); err != nil {
+				return fmt.Errorf("failed to raise ambient capability %d: %v", c, err)
+			}
+		}
+	}
+	return nil
+}
+
+// lastCapability returns the highest capability number of the kernel.
+func lastCapability() int {
+	data, err := os.ReadFile("/proc/sys/kernel/cap_last_cap")
+	if err != nil {
+		return unix.CAP_LAST_CAP
+	}
+	last, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil {
+		return unix.CAP_LAST_CAP
+	}
+	return last
+}
+
+// capabilityNumbers returns the numbers of the named capabilities.
+func capabilityNumbers(names []string) []int {
+	numbers := make([]int, 0, len(names))
+	for _, name := range names {
+		for i, known := range capabilityNames {
+			if known == name {
+				numbers = append(numbers, i)
+			}
+		}
+	}
+	return numbers
+}
+
+// applySecurityConfig makes cmd run with the security config. The credential
+// and the ambient capabilities are applied through SysProcAttr, the bounding
+// set and no_new_privs by the container init cmd is re-executed through. With
+// chroot the container init also changes root into the root filesystem cmd is
+// started with by startInRootfs, the path and the working directory of cmd
+// are in the root filesystem then.
+func applySecurityConfig(cmd *exec.Cmd, config *securityConfig, chroot bool) error {
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	if config.UID != nil {
+		groups := make([]uint32, 0, len(config.Groups))
+		for _, g := range config.Groups {
+			groups = append(groups, uint32(g))
+		}
+		cmd.SysProcAttr.Credential = &syscall.Credential{
+			Uid:    uint32(*config.UID),
+			Gid:    uint32(*config.GID),
+			Groups: groups,
+		}
+	}
+
+	initConfig := containerInitConfig{NoNewPrivileges: config.NoNewPrivileges, Chroot: chroot}
+	if chroot {
+		initConfig.Dir, cmd.Dir = cmd.Dir, ""
+	}
+	// Only a root kubelet can take capabilities away. A privileged process
+	// keeps them all, but the container init still has to give up the ones
+	// it needs to change root when running as another user.
+	if os.Geteuid() == 0 && (!config.Privileged || chroot) {
+		if config.Privileged {
+			initConfig.Bounding = capabilityNumbers(capabilityNames)
+		} else {
+			initConfig.Bounding = capabilityNumbers(config.Capabilities)
+		}
+		if config.UID != nil && *config.UID != 0 {
+			if !config.Privileged {
+				initConfig.Ambient = capabilityNumbers(config.AmbientCapabilities)
+			}
+			// The container init of a non-root process needs CAP_SETPCAP to
+			// drop the bounding set and CAP_SYS_CHROOT to change root, it
+			// gives them up before executing the command.
+			ambient := append([]int{unix.CAP_SETPCAP}, initConfig.Ambient...)
+			if chroot {
+				ambient = append(ambient, unix.CAP_SYS_CHROOT)
+			}
+			cmd.SysProcAttr.AmbientCaps = nil
+			for _, c := range ambient {
+				cmd.SysProcAttr.AmbientCaps = append(cmd.SysProcAttr.AmbientCaps, uintptr(c))
+			}
+		}
+	}
+	if initConfig.Bounding == nil && !initConfig.NoNewPrivileges && !chroot {
+		return nil
+	}
+
+	path := cmd.Path
+	if !chroot {
+		var err error
+		if path, err = exec.LookPath(cmd.Path); err != nil {
+			return err
+		}
+	}
+	data, err := json.Marshal(initConfig)
+	if err != nil {
+		return err
+	}
+	// /proc/self/exe of the forked child is the kubelet binary, even if
+	// the file was replaced since the kubelet started.
+	cmd.Args = append([]string{containerInitName, string(data), path}, cmd.Args...)
+	cmd.Path = "/proc/self/exe"
+	return nil
+}
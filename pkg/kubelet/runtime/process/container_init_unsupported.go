@@ -0,0 +1,21 @@
+//go:build !linux
+// +build !linux
+
+package process
+
+import (
+	"fmt"
+	"os/exec"
+)
+
+// applySecurityConfig only supports running processes as the user of the
+// kubelet, in the root filesystem of the host, on this platform.
+func applySecurityConfig(cmd *exec.Cmd, config *securityConfig, chroot bool) error {
+	if chroot {
+		return fmt.Errorf("image root filesystems are not supported on this platform")
+	}
+	if config.UID != nil || config.NoNewPrivileges {
+		return fmt.Errorf("security context is not supported on this platform")
+	}
+	return nil
+}
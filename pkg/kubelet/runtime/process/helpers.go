@@ -0,0 +1,159 @@
+package process
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+
+	kubecontainer "github.com/xuliangTang/mykubelet/pkg/kubelet/container"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	utilversion "k8s.io/apimachinery/pkg/util/version"
+)
+
+// processVersion implements kubecontainer.Version on top of a semantic version.
+type processVersion struct {
+	*utilversion.Version
+}
+
+func newProcessVersion(version string) (*processVersion, error) {
+	v, err := utilversion.ParseSemantic(version)
+	if err != nil {
+		return nil, err
+	}
+	return &processVersion{v}, nil
+}
+
+func (v *processVersion) Compare(other string) (int, error) {
+	return v.Version.Compare(other)
+}
+
+// newID returns a random 64 character hex string, in the same shape as the
+// container IDs generated by docker and containerd.
+func newID() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate id: %v", err)
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// buildContainerID returns the kubecontainer.ContainerID of a process container.
+func buildContainerID(id string) kubecontainer.ContainerID {
+	return kubecontainer.ContainerID{Type: processRuntimeName, ID: id}
+}
+
+// exitCodeFromError converts the error returned by exec.Cmd.Wait into an exit code.
+// Processes terminated by a signal are reported as 128+signal, as a shell would.
+func exitCodeFromError(err error) int {
+	if err == nil {
+		return 0
+	}
+	exitErr, ok := err.(*exec.ExitError)
+	if !ok {
+		return unknownExitCode
+	}
+	if ws, ok := exitErr.Sys().(syscall.WaitStatus); ok && ws.Signaled() {
+		return 128 + int(ws.Signal())
+	}
+	return exitErr.ExitCode()
+}
+
+// reasonForExitCode returns the reason reported for a container that exited by itself.
+func reasonForExitCode(exitCode int) string {
+	if exitCode == 0 {
+		return reasonCompleted
+	}
+	return reasonError
+}
+
+// shouldRestartOnFailure returns whether the containers of the pod are
+// restarted after they failed.
+func shouldRestartOnFailure(pod *v1.Pod) bool {
+	return pod.Spec.RestartPolicy != v1.RestartPolicyNever
+}
+
+// containerSucceeded returns whether the latest instance of the container
+// exited with exit code 0.
+func containerSucceeded(c *v1.Container, podStatus *kubecontainer.PodStatus) bool {
+	cStatus := podStatus.FindContainerStatusByName(c.Name)
+	if cStatus == nil || cStatus.State == kubecontainer.ContainerStateRunning {
+		return false
+	}
+	return cStatus.ExitCode == 0
+}
+
+// getStableKey generates a key (string) to uniquely identify a
+// (pod, container) tuple. The key should include the content of the
+// container, so that any change to the container generates a new key.
+func getStableKey(pod *v1.Pod, container *v1.Container) string {
+	hash := strconv.FormatUint(kubecontainer.HashContainer(container), 16)
+	return fmt.Sprintf("%s_%s_%s_%s_%s", pod.Name, pod.Namespace, string(pod.UID), container.Name, hash)
+}
+
+// isInitContainerFailed returns whether the init container has to be run again.
+func isInitContainerFailed(status *kubecontainer.Status) bool {
+	// When oomkilled occurs, init container should be considered as a failure.
+	if strings.Contains(status.Reason, "OOMKilled") {
+		return true
+	}
+
+	if status.State == kubecontainer.ContainerStateExited && status.ExitCode != 0 {
+		return true
+	}
+
+	if status.State == kubecontainer.ContainerStateUnknown {
+		return true
+	}
+
+	return false
+}
+
+// logPathDelimiter is the delimiter used in the log path.
+const logPathDelimiter = "_"
+
+// buildContainerLogsDirectory builds absolute log directory path for a container in pod.
+func buildContainerLogsDirectory(podLogsRootDirectory, podNamespace, podName string, podUID types.UID, containerName string) string {
+	return filepath.Join(buildPodLogsDirectory(podLogsRootDirectory, podNamespace, podName, podUID), containerName)
+}
+
+// buildPodLogsDirectory builds absolute log directory path for a pod sandbox.
+func buildPodLogsDirectory(podLogsRootDirectory, podNamespace, podName string, podUID types.UID) string {
+	return filepath.Join(podLogsRootDirectory, strings.Join([]string{podNamespace, podName,
+		string(podUID)}, logPathDelimiter))
+}
+
+// buildContainerLogsPath builds log path for container relative to pod logs directory.
+func buildContainerLogsPath(containerName string, restartCount int) string {
+	return filepath.Join(containerName, fmt.Sprintf("%d.log", restartCount))
+}
+
+// checkDirWritable checks that dir exists, creating it if needed, and that
+// files can be created in it.
+func checkDirWritable(dir string) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(dir, ".check-")
+	if err != nil {
+		return err
+	}
+	f.Close()
+	return os.Remove(f.Name())
+}
+
+// ipStrings returns the string form of the IPs.
+func ipStrings(ips []net.IP) []string {
+	s := make([]string, 0, len(ips))
+	for _, ip := range ips {
+		s = append(s, ip.String())
+	}
+	return s
+}
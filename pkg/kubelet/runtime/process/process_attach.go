@@ -0,0 +1,249 @@
+package process
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"sync"
+
+	kubecontainer "github.com/xuliangTang/mykubelet/pkg/kubelet/container"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/tools/remotecommand"
+	"k8s.io/klog/v2"
+)
+
+// containerStreams are the stdio streams of a container process that clients
+// attach to. The process writes its output into the container log, which
+// copies it to the attached clients too.
+type containerStreams struct {
+	// stdin is written to by attached clients, nil if the container has no
+	// stdin. With a tty it is the master of the terminal.
+	stdin     io.WriteCloser
+	stdinOnce bool
+	closeOnce sync.Once
+	// tty is the master of the terminal of a container with a tty, the
+	// process reads and writes its slave.
+	tty *os.File
+	// childFiles are the ends of the streams handed to the process, the
+	// kubelet holds them until the process started.
+	childFiles []*os.File
+
+	stdout, stderr *streamBroadcaster
+	// done is closed once the output of the process was copied.
+	done chan struct{}
+}
+
+// newContainerStreams connects the stdin of cmd to a pipe if the container
+// has a stdin, or all the stdio of cmd to a terminal if it has a tty. The
+// output of cmd is left to the container log.
+func newContainerStreams(container *v1.Container, cmd *exec.Cmd) (*containerStreams, error) {
+	s := &containerStreams{
+		stdinOnce: container.StdinOnce,
+		stdout:    newStreamBroadcaster(),
+		stderr:    newStreamBroadcaster(),
+		done:      make(chan struct{}),
+	}
+	if container.TTY {
+		master, slave, err := openTerminal()
+		if err != nil {
+			return nil, fmt.Errorf("failed to allocate a terminal: %v", err)
+		}
+		s.tty = master
+		s.childFiles = []*os.File{slave}
+		if container.Stdin {
+			s.stdin = master
+		}
+		cmd.Stdin, cmd.Stdout, cmd.Stderr = slave, slave, slave
+		// The container process leads the session of its terminal.
+		setSession(cmd, true)
+		return s, nil
+	}
+	if container.Stdin {
+		r, w, err := os.Pipe()
+		if err != nil {
+			return nil, err
+		}
+		s.stdin = w
+		s.childFiles = []*os.File{r}
+		cmd.Stdin = r
+	}
+	return s, nil
+}
+
+// started releases the ends of the streams held by the process.
+func (s *containerStreams) started() {
+	for _, f := range s.childFiles {
+		f.Close()
+	}
+	s.childFiles = nil
+}
+
+// closeStdin closes the stdin of the process, which reads EOF then. The
+// terminal of a container with a tty stays open until close.
+func (s *containerStreams) closeStdin() {
+	if s.stdin == nil || s.tty != nil {
+		return
+	}
+	s.closeOnce.Do(func() {
+		s.stdin.Close()
+	})
+}
+
+// close releases the streams once the output of the process was copied.
+func (s *containerStreams) close() {
+	s.started()
+	s.closeStdin()
+	if s.tty != nil {
+		s.tty.Close()
+	}
+	s.stdout.close()
+	s.stderr.close()
+	close(s.done)
+}
+
+// streamBroadcaster copies an output stream of a process to the attached
+// clients. A client whose stream fails is detached.
+type streamBroadcaster struct {
+	lock    sync.Mutex
+	writers map[*attachedWriter]struct{}
+	closed  bool
+}
+
+// attachedWriter is the output stream of an attached client. failed is
+// closed once writing to it failed.
+type attachedWriter struct {
+	w      io.Writer
+	failed chan struct{}
+}
+
+func newStreamBroadcaster() *streamBroadcaster {
+	return &streamBroadcaster{writers: make(map[*attachedWriter]struct{})}
+}
+
+// Write copies p to the attached clients, it never fails.
+func (b *streamBroadcaster) Write(p []byte) (int, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	for w := range b.writers {
+		if _, err := w.w.Write(p); err != nil {
+			klog.V(4).InfoS("Detaching client from container output", "err", err)
+			delete(b.writers, w)
+			close(w.failed)
+		}
+	}
+	return len(p), nil
+}
+
+// add attaches w. It returns nil if the output already ended.
+func (b *streamBroadcaster) add(w io.Writer) *attachedWriter {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	if b.closed {
+		return nil
+	}
+	aw := &attachedWriter{w: w, failed: make(chan struct{})}
+	b.writers[aw] = struct{}{}
+	return aw
+}
+
+// remove detaches w.
+func (b *streamBroadcaster) remove(w *attachedWriter) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	delete(b.writers, w)
+}
+
+// close detaches every client, the output ended.
+func (b *streamBroadcaster) close() {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.closed = true
+	b.writers = make(map[*attachedWriter]struct{})
+}
+
+// AttachContainer attaches to the process of a running container. The
+// output of the process is copied to stdout and stderr until it exits, or
+// the client goes away. stdin is copied to the process if the container has
+// a stdin. The client detaches once its stdin ends, unless the container is
+// StdinOnce without a tty: the stdin of the process is closed then, and its
+// output copied until it exits.
+func (m *processManager) AttachContainer(id kubecontainer.ContainerID, stdin io.Reader, stdout, stderr io.WriteCloser, tty bool, resize <-chan remotecommand.TerminalSize) error {
+	m.lock.RLock()
+	record, ok := m.containers[id.ID]
+	var (
+		state   kubecontainer.State
+		streams *containerStreams
+	)
+	if ok {
+		state, streams = record.State, record.streams
+	}
+	m.lock.RUnlock()
+	if !ok {
+		return fmt.Errorf("container %q not found", id.ID)
+	}
+	if state != kubecontainer.ContainerStateRunning {
+		return fmt.Errorf("container %q is not running", id.ID)
+	}
+	if streams == nil {
+		return fmt.Errorf("container %q was started by a previous kubelet, it can not be attached to", id.ID)
+	}
+
+	// The client is detached once its output stream fails, or its input
+	// stream ends.
+	detached := make(chan struct{})
+	var detachOnce sync.Once
+	detach := func() {
+		detachOnce.Do(func() { close(detached) })
+	}
+	defer detach()
+	for _, o := range []struct {
+		w io.Writer
+		b *streamBroadcaster
+	}{{stdout, streams.stdout}, {stderr, streams.stderr}} {
+		if o.w == nil {
+			continue
+		}
+		aw := o.b.add(o.w)
+		if aw == nil {
+			// The output already ended.
+			return nil
+		}
+		defer o.b.remove(aw)
+		go func() {
+			select {
+			case <-aw.failed:
+				detach()
+			case <-detached:
+			}
+		}()
+	}
+	if resize != nil && streams.tty != nil {
+		go func() {
+			for size := range resize {
+				if err := setTerminalSize(streams.tty, size); err != nil {
+					klog.V(4).InfoS("Failed to resize the terminal of container", "containerID", id.ID, "err", err)
+				}
+			}
+		}()
+	}
+	if stdin != nil && streams.stdin != nil {
+		go func() {
+			if _, err := io.Copy(streams.stdin, stdin); err != nil {
+				klog.V(4).InfoS("Failed to copy stdin to container", "containerID", id.ID, "err", err)
+			}
+			if streams.stdinOnce && streams.tty == nil {
+				// The process reads EOF, its output is copied until it ends.
+				streams.closeStdin()
+				return
+			}
+			detach()
+		}()
+	}
+
+	select {
+	case <-streams.done:
+	case <-detached:
+	}
+	return nil
+}
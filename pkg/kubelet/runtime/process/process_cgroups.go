@@ -0,0 +1,76 @@
+package process
+
+import (
+	"os"
+	"os/exec"
+
+	"github.com/xuliangTang/mykubelet/pkg/kubelet/cm"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/klog/v2"
+)
+
+// createContainerCgroup creates the cgroup of a container below the cgroup of
+// its pod, and returns its literal cgroupfs name. It returns an empty name when
+// the pod has no cgroup, in which case the resources are not enforced.
+func (m *processManager) createContainerCgroup(pod *v1.Pod, container *v1.Container, id string) (string, error) {
+	cgroupParent := m.runtimeHelper.GetPodCgroupParent(pod)
+	if cgroupParent == "" {
+		return "", nil
+	}
+	name := cm.NewCgroupName(m.cgroupManager.CgroupName(cgroupParent), id)
+	if err := m.cgroupManager.Create(&cm.CgroupConfig{
+		Name:               name,
+		ResourceParameters: cm.ResourceConfigForContainer(container),
+	}); err != nil {
+		return "", err
+	}
+	return m.cgroupManager.Name(name), nil
+}
+
+// startInContainerCgroup starts cmd in the namespaces and the root filesystem
+// of the sandbox, directly in the cgroup of the container: its resources are
+// enforced from its first instruction, and the children it forks are
+// accounted to the container.
+func (m *processManager) startInContainerCgroup(cmd *exec.Cmd, record *containerRecord, sandbox *sandboxRecord) error {
+	if record.CgroupPath != "" {
+		// The cgroup is opened before joining the mount namespace of the
+		// sandbox, where the cgroup filesystem of the host may not be mounted.
+		f, err := m.cgroupManager.Open(m.cgroupManager.CgroupName(record.CgroupPath))
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		setCgroup(cmd, f)
+	}
+	return startInRootfs(cmd, sandbox, record.Rootfs)
+}
+
+// isOOMKilled returns whether the OOM killer killed a process of the container.
+func (m *processManager) isOOMKilled(record *containerRecord) bool {
+	if record.CgroupPath == "" {
+		return false
+	}
+	kills, err := m.cgroupManager.OOMKills(m.cgroupManager.CgroupName(record.CgroupPath))
+	if err != nil {
+		klog.V(4).InfoS("Failed to read OOM kills of container", "containerID", record.ID, "err", err)
+		return false
+	}
+	return kills > 0
+}
+
+// destroyContainerCgroup kills the processes left in the cgroup of the
+// container, including those that left its process group, and removes it.
+func (m *processManager) destroyContainerCgroup(record *containerRecord) {
+	if record.CgroupPath == "" {
+		return
+	}
+	name := m.cgroupManager.CgroupName(record.CgroupPath)
+	for _, pid := range m.cgroupManager.Pids(name) {
+		if p, err := os.FindProcess(pid); err == nil {
+			p.Kill()
+		}
+	}
+	if err := m.cgroupManager.Destroy(&cm.CgroupConfig{Name: name}); err != nil {
+		klog.V(4).InfoS("Failed to remove container cgroup", "containerID", record.ID, "cgroup", record.CgroupPath, "err", err)
+	}
+}
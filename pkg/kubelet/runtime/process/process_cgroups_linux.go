@@ -0,0 +1,20 @@
+//go:build linux
+// +build linux
+
+package process
+
+import (
+	"os"
+	"os/exec"
+	"syscall"
+)
+
+// setCgroup makes the process of cmd start in the cgroup opened as f, so
+// that it never runs outside of it.
+func setCgroup(cmd *exec.Cmd, f *os.File) {
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.UseCgroupFD = true
+	cmd.SysProcAttr.CgroupFD = int(f.Fd())
+}
@@ -0,0 +1,12 @@
+//go:build !linux
+// +build !linux
+
+package process
+
+import (
+	"os"
+	"os/exec"
+)
+
+func setCgroup(cmd *exec.Cmd, f *os.File) {
+}
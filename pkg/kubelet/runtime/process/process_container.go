@@ -0,0 +1,730 @@
+package process
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	kubecontainer "github.com/xuliangTang/mykubelet/pkg/kubelet/container"
+	"github.com/xuliangTang/mykubelet/pkg/kubelet/events"
+	"github.com/xuliangTang/mykubelet/pkg/kubelet/images"
+	"github.com/xuliangTang/mykubelet/pkg/kubelet/runtime/imagestore"
+	"github.com/xuliangTang/mykubelet/pkg/kubelet/util/format"
+	"github.com/xuliangTang/mykubelet/pkg/securitycontext"
+	v1 "k8s.io/api/core/v1"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/client-go/util/flowcontrol"
+	"k8s.io/klog/v2"
+)
+
+var (
+	// ErrCreateContainerConfig - failed to create container config
+	ErrCreateContainerConfig = errors.New("CreateContainerConfigError")
+	// ErrCreateContainer - failed to create container
+	ErrCreateContainer = errors.New("CreateContainerError")
+	// ErrPostStartHook - failed to execute PostStartHook
+	ErrPostStartHook = errors.New("PostStartHookError")
+)
+
+const (
+	// killWaitTimeout is how long killContainer waits for a killed process to be reaped.
+	killWaitTimeout = 10 * time.Second
+
+	// minimumGracePeriodInSeconds is the minimal shutdown window given to a container.
+	minimumGracePeriodInSeconds = 2
+
+	// defaultPathEnv is the PATH of a container that does not define its own.
+	defaultPathEnv = "/usr/local/sbin:/usr/local/bin:/usr/sbin:/usr/bin:/sbin:/bin"
+
+	// volumeMountsEnv tells a process run in the root filesystem of the host
+	// where the volumes mounted into the container live on the host. Its
+	// value is a comma separated list of containerPath=hostPath entries,
+	// suffixed with ":ro" for read-only mounts.
+	volumeMountsEnv = "MYKUBELET_VOLUME_MOUNTS"
+)
+
+// recordContainerEvent should be used by the runtime manager for all container related events.
+// it has sanity checks to ensure that we do not write events that can abuse our masters.
+// in particular, it ensures that a containerID never appears in an event message as that
+// is prone to causing a lot of distinct events that do not count well.
+// it replaces any reference to a containerID with the containerName which is stable, and is what users know.
+func (m *processManager) recordContainerEvent(pod *v1.Pod, container *v1.Container, containerID, eventType, reason, message string, args ...interface{}) {
+	ref, err := kubecontainer.GenerateContainerRef(pod, container)
+	if err != nil {
+		klog.ErrorS(err, "Can't make a container ref", "pod", klog.KObj(pod), "podUID", pod.UID, "containerName", container.Name)
+		return
+	}
+	eventMessage := message
+	if len(args) > 0 {
+		eventMessage = fmt.Sprintf(message, args...)
+	}
+	m.recorder.Event(ref, eventType, reason, eventMessage)
+}
+
+// startContainer starts a container and returns a message indicates why it is failed on error.
+// It starts the container through the following steps:
+// * pull the image of the container
+// * generate the container options
+// * create the container record and open its log file
+// * mount the root filesystem of the container (if it runs in its image)
+// * start the container process
+// * run the post start lifecycle hooks (if applicable)
+func (m *processManager) startContainer(podSandboxID string, pod *v1.Pod, container *v1.Container, podStatus *kubecontainer.PodStatus, pullSecrets []v1.Secret) (string, error) {
+	sandbox, ok := m.getSandbox(podSandboxID)
+	if !ok {
+		return fmt.Sprintf("pod sandbox %q not found", podSandboxID), ErrCreateContainer
+	}
+
+	// Step 1: pull the image. The root filesystem of the image is only
+	// mounted in the mount namespace of the pod.
+	if m.images != nil && sandbox.Namespaces == nil {
+		return fmt.Sprintf("pod sandbox %q has no mount namespace", podSandboxID), ErrCreateContainer
+	}
+	imageRef, msg, err := m.imagePuller.EnsureImageExists(pod, container, pullSecrets, nil)
+	if err != nil {
+		m.recordContainerEvent(pod, container, "", v1.EventTypeWarning, events.FailedToCreateContainer, "Error: %v", err)
+		return msg, err
+	}
+	var image *imagestore.Image
+	imageRootfs := ""
+	if m.images != nil {
+		var ok bool
+		if image, ok = m.images.GetImage(imageRef); !ok {
+			msg := fmt.Sprintf("image %q was removed right after it was pulled", container.Image)
+			m.recordContainerEvent(pod, container, "", v1.EventTypeWarning, events.FailedToCreateContainer, "Error: %s", msg)
+			return msg, images.ErrImagePull
+		}
+		imageRootfs = m.images.RootfsPath(image.ID)
+	}
+
+	// Step 2: generate the container options.
+	// For a new container, the RestartCount should be 0
+	restartCount := 0
+	containerStatus := podStatus.FindContainerStatusByName(container.Name)
+	if containerStatus != nil {
+		restartCount = containerStatus.RestartCount + 1
+	}
+
+	podIP := ""
+	if len(podStatus.IPs) != 0 {
+		podIP = podStatus.IPs[0]
+	}
+	opts, cleanupAction, err := m.runtimeHelper.GenerateRunContainerOptions(pod, container, podIP, podStatus.IPs)
+	if cleanupAction != nil {
+		defer cleanupAction()
+	}
+	if err != nil {
+		m.recordContainerEvent(pod, container, "", v1.EventTypeWarning, events.FailedToCreateContainer, "Error: %v", err)
+		return err.Error(), ErrCreateContainerConfig
+	}
+	// The resolv.conf of the sandbox is mounted the way the hosts file is,
+	// unless the container mounts its own.
+	if sandbox.ResolvConfPath != "" && !hasMountOn(opts.Mounts, etcResolvConfPath) {
+		opts.Mounts = append(opts.Mounts, kubecontainer.Mount{
+			Name:          "k8s-managed-resolv-conf",
+			ContainerPath: etcResolvConfPath,
+			HostPath:      sandbox.ResolvConfPath,
+		})
+	}
+
+	imageUser := ""
+	if image != nil {
+		imageUser = image.User
+	}
+	security, err := newSecurityConfig(pod, container, m.runtimeHelper.GetExtraSupplementalGroupsForPod(pod), imageRootfs, imageUser)
+	if err != nil {
+		m.recordContainerEvent(pod, container, "", v1.EventTypeWarning, events.FailedToCreateContainer, "Error: %v", err)
+		return err.Error(), ErrCreateContainerConfig
+	}
+	// Verify RunAsNonRoot. Processes run as the user of their image, or of
+	// the kubelet, unless their security context sets one.
+	uid := int64(os.Getuid())
+	if security.UID != nil {
+		uid = *security.UID
+	}
+	if err := verifyRunAsNonRoot(pod, container, &uid, ""); err != nil {
+		m.recordContainerEvent(pod, container, "", v1.EventTypeWarning, events.FailedToCreateContainer, "Error: %v", err)
+		return err.Error(), ErrCreateContainerConfig
+	}
+
+	id, err := newID()
+	if err != nil {
+		m.recordContainerEvent(pod, container, "", v1.EventTypeWarning, events.FailedToCreateContainer, "Error: %v", err)
+		return err.Error(), ErrCreateContainer
+	}
+	rootfs := ""
+	if image != nil {
+		rootfs = filepath.Join(m.store.containerDir(id), rootfsDirName)
+	}
+	cmd, err := m.buildContainerCmd(container, opts, security, image, rootfs)
+	if err != nil {
+		m.recordContainerEvent(pod, container, "", v1.EventTypeWarning, events.FailedToCreateContainer, "Error: %v", err)
+		return err.Error(), ErrCreateContainer
+	}
+
+	// Step 3: create the container record.
+	logDir := buildContainerLogsDirectory(m.podLogsRootDirectory, pod.Namespace, pod.Name, pod.UID, container.Name)
+	if err := os.MkdirAll(logDir, 0755); err != nil {
+		m.recordContainerEvent(pod, container, "", v1.EventTypeWarning, events.FailedToCreateContainer, "Error: %v", err)
+		return err.Error(), ErrCreateContainer
+	}
+	logPath := filepath.Join(buildPodLogsDirectory(m.podLogsRootDirectory, pod.Namespace, pod.Name, pod.UID), buildContainerLogsPath(container.Name, restartCount))
+	logger, err := newContainerLogger(logPath, m.logRotatePolicy, container, cmd)
+	if err != nil {
+		m.recordContainerEvent(pod, container, "", v1.EventTypeWarning, events.FailedToCreateContainer, "Error: %v", err)
+		return err.Error(), ErrCreateContainer
+	}
+
+	cgroupPath, err := m.createContainerCgroup(pod, container, id)
+	if err != nil {
+		logger.close()
+		m.recordContainerEvent(pod, container, "", v1.EventTypeWarning, events.FailedToCreateContainer, "Error: %v", err)
+		return err.Error(), ErrCreateContainer
+	}
+
+	imageID := container.Image
+	if image != nil {
+		imageID = image.ID
+	}
+	record := &containerRecord{
+		ID:           id,
+		SandboxID:    sandbox.ID,
+		PodUID:       pod.UID,
+		PodName:      pod.Name,
+		PodNamespace: pod.Namespace,
+		Name:         container.Name,
+		Image:        container.Image,
+		ImageID:      imageID,
+		Hash:         kubecontainer.HashContainer(container),
+		Attempt:      restartCount,
+		State:        kubecontainer.ContainerStateCreated,
+		CreatedAt:    time.Now(),
+		LogPath:      logPath,
+		Env:          cmd.Env,
+		WorkingDir:   containerWorkingDir(container, image),
+		CgroupPath:   cgroupPath,
+		Security:     security,
+		Rootfs:       rootfs,
+		TTY:          container.TTY,
+		streams:      logger.streams,
+		done:         make(chan struct{}),
+	}
+	if err := m.store.saveContainer(record); err != nil {
+		logger.close()
+		m.destroyContainerCgroup(record)
+		m.recordContainerEvent(pod, container, id, v1.EventTypeWarning, events.FailedToCreateContainer, "Error: %v", err)
+		return err.Error(), ErrCreateContainer
+	}
+	m.lock.Lock()
+	m.containers[id] = record
+	m.lock.Unlock()
+	m.recordContainerEvent(pod, container, id, v1.EventTypeNormal, events.CreatedContainer, fmt.Sprintf("Created container %s", container.Name))
+
+	// Step 4: mount the root filesystem, or the files of the pod in the root
+	// filesystem of the host, and start the container process in the
+	// namespaces of the sandbox and in the cgroup of the container.
+	start := func() error {
+		if image != nil {
+			effectiveSc := securitycontext.DetermineEffectiveSecurityContext(pod, container)
+			if err := m.mountContainerRootfs(sandbox, rootfs, &rootfsSpec{
+				Image:      imageRootfs,
+				Mounts:     opts.Mounts,
+				WorkingDir: record.WorkingDir,
+				ReadOnly:   effectiveSc.ReadOnlyRootFilesystem != nil && *effectiveSc.ReadOnlyRootFilesystem,
+			}); err != nil {
+				return err
+			}
+		} else if sandbox.Namespaces != nil {
+			if err := m.mountPodFiles(sandbox, opts.Mounts); err != nil {
+				return err
+			}
+		}
+		return m.startInContainerCgroup(cmd, record, sandbox)
+	}
+	if err := start(); err != nil {
+		logger.close()
+		m.destroyContainerCgroup(record)
+		m.unmountContainerRootfs(record)
+		m.lock.Lock()
+		record.State = kubecontainer.ContainerStateExited
+		record.ExitCode = 128
+		record.Reason = reasonStartError
+		record.Message = err.Error()
+		record.FinishedAt = time.Now()
+		m.saveContainerLocked(record)
+		m.lock.Unlock()
+		close(record.done)
+
+		m.recordContainerEvent(pod, container, id, v1.EventTypeWarning, events.FailedToStartContainer, "Error: %v", err)
+		return err.Error(), kubecontainer.ErrRunContainer
+	}
+
+	m.lock.Lock()
+	record.State = kubecontainer.ContainerStateRunning
+	record.StartedAt = time.Now()
+	record.Pid = cmd.Process.Pid
+	m.saveContainerLocked(record)
+	m.lock.Unlock()
+	logger.start()
+	go m.waitContainer(record, cmd)
+
+	m.recordContainerEvent(pod, container, id, v1.EventTypeNormal, events.StartedContainer, fmt.Sprintf("Started container %s", container.Name))
+
+	// Step 5: execute the post start hook.
+	if container.Lifecycle != nil && container.Lifecycle.PostStart != nil {
+		kubeContainerID := buildContainerID(id)
+		msg, handlerErr := m.runner.Run(kubeContainerID, pod, container, container.Lifecycle.PostStart)
+		if handlerErr != nil {
+			klog.ErrorS(handlerErr, "Failed to execute PostStartHook", "pod", klog.KObj(pod), "podUID", pod.UID,
+				"containerName", container.Name, "containerID", kubeContainerID.String())
+			m.recordContainerEvent(pod, container, kubeContainerID.ID, v1.EventTypeWarning, events.FailedPostStartHook, msg)
+			if err := m.killContainer(pod, kubeContainerID, container.Name, "FailedPostStartHook", nil); err != nil {
+				klog.ErrorS(err, "Failed to kill container", "pod", klog.KObj(pod), "podUID", pod.UID,
+					"containerName", container.Name, "containerID", kubeContainerID.String())
+			}
+			return msg, ErrPostStartHook
+		}
+	}
+
+	return "", nil
+}
+
+// buildContainerCmd builds the command running the process of the container.
+// The process only sees the environment generated for the container, plus a
+// default PATH and HOSTNAME the way container runtimes set them up, and the
+// mapping of its volume mounts. It runs with the security config of the container.
+//
+// A container run in the root filesystem of its image gets the defaults of
+// the image: its entrypoint and cmd unless the container overrides them, its
+// environment below the one of the container and its working directory.
+func (m *processManager) buildContainerCmd(container *v1.Container, opts *kubecontainer.RunContainerOptions, security *securityConfig, image *imagestore.Image, rootfs string) (*exec.Cmd, error) {
+	command, args := kubecontainer.ExpandContainerCommandAndArgs(container, opts.Envs)
+	var imageEnv []string
+	if image != nil {
+		if len(container.Command) == 0 {
+			command = image.Entrypoint
+			if len(container.Args) == 0 {
+				args = image.Cmd
+			}
+		}
+		imageEnv = image.Env
+	}
+	argv := append(append([]string(nil), command...), args...)
+	if len(argv) == 0 || (image == nil && len(command) == 0) {
+		return nil, fmt.Errorf("no command specified for container %q", container.Name)
+	}
+
+	env := make([]string, 0, len(imageEnv)+len(opts.Envs)+3)
+	index := make(map[string]int)
+	setEnv := func(name, value string) {
+		if i, ok := index[name]; ok {
+			env[i] = name + "=" + value
+			return
+		}
+		index[name] = len(env)
+		env = append(env, name+"="+value)
+	}
+	for _, e := range imageEnv {
+		name, value, _ := strings.Cut(e, "=")
+		setEnv(name, value)
+	}
+	for _, e := range opts.Envs {
+		setEnv(e.Name, e.Value)
+	}
+	if _, ok := index["PATH"]; !ok {
+		setEnv("PATH", defaultPathEnv)
+	}
+	if opts.Hostname != "" {
+		setEnv("HOSTNAME", opts.Hostname)
+	}
+	// Volumes are mounted into the root filesystem of an image.
+	if len(opts.Mounts) > 0 && rootfs == "" {
+		setEnv(volumeMountsEnv, formatMounts(opts.Mounts))
+	}
+
+	var cmd *exec.Cmd
+	if rootfs != "" {
+		// The command is looked up in the root filesystem by the container init.
+		cmd = &exec.Cmd{Path: argv[0], Args: argv}
+	} else {
+		cmd = exec.Command(argv[0], argv[1:]...)
+	}
+	cmd.Dir = containerWorkingDir(container, image)
+	cmd.Env = env
+	setProcessGroup(cmd)
+	if err := applySecurityConfig(cmd, security, rootfs != ""); err != nil {
+		return nil, err
+	}
+	return cmd, nil
+}
+
+// containerWorkingDir returns the working directory of the container: its
+// own, or the one of its image, or the root of the image.
+func containerWorkingDir(container *v1.Container, image *imagestore.Image) string {
+	if container.WorkingDir != "" || image == nil {
+		return container.WorkingDir
+	}
+	if image.WorkingDir != "" {
+		return image.WorkingDir
+	}
+	return "/"
+}
+
+// formatMounts formats the mounts as the value of volumeMountsEnv.
+func formatMounts(mounts []kubecontainer.Mount) string {
+	entries := make([]string, 0, len(mounts))
+	for _, mount := range mounts {
+		entry := mount.ContainerPath + "=" + mount.HostPath
+		if mount.ReadOnly {
+			entry += ":ro"
+		}
+		entries = append(entries, entry)
+	}
+	return strings.Join(entries, ",")
+}
+
+// waitContainer reaps the process of a container and records how it exited.
+func (m *processManager) waitContainer(record *containerRecord, cmd *exec.Cmd) {
+	// The processes of a container go away with its main process, the way
+	// they would with the init process of a pid namespace. They are killed
+	// before the main process is reaped, as its pid may be reused after.
+	if err := waitProcessExit(cmd.Process.Pid); err != nil {
+		klog.V(4).InfoS("Failed to wait for container process", "containerID", record.ID, "err", err)
+	}
+	if _, err := signalProcessGroup(record.Pid, syscall.SIGKILL); err != nil {
+		klog.V(4).InfoS("Failed to kill remaining container processes", "containerID", record.ID, "err", err)
+	}
+	err := cmd.Wait()
+	exitCode := exitCodeFromError(err)
+	oomKilled := exitCode != 0 && m.isOOMKilled(record)
+	m.destroyContainerCgroup(record)
+	m.unmountContainerRootfs(record)
+
+	m.lock.Lock()
+	record.State = kubecontainer.ContainerStateExited
+	record.ExitCode = exitCode
+	record.FinishedAt = time.Now()
+	if oomKilled {
+		record.Reason = reasonOOMKilled
+		record.ExitCode = 137
+	}
+	if record.Reason == "" {
+		record.Reason = reasonForExitCode(exitCode)
+	}
+	m.saveContainerLocked(record)
+	m.lock.Unlock()
+	close(record.done)
+
+	klog.V(3).InfoS("Container exited", "podUID", record.PodUID, "containerName", record.Name, "containerID", record.ID, "exitCode", exitCode)
+}
+
+// saveContainerLocked persists the record. The caller must hold the lock.
+func (m *processManager) saveContainerLocked(record *containerRecord) {
+	if err := m.store.saveContainer(record); err != nil {
+		klog.ErrorS(err, "Failed to persist container record", "containerID", record.ID)
+	}
+}
+
+// executePreStopHook runs the pre-stop lifecycle hooks if applicable and returns the duration it takes.
+func (m *processManager) executePreStopHook(pod *v1.Pod, containerID kubecontainer.ContainerID, containerSpec *v1.Container, gracePeriod int64) int64 {
+	klog.V(3).InfoS("Running preStop hook", "pod", klog.KObj(pod), "podUID", pod.UID, "containerName", containerSpec.Name, "containerID", containerID.String())
+
+	start := time.Now()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		defer utilruntime.HandleCrash()
+		if msg, err := m.runner.Run(containerID, pod, containerSpec, containerSpec.Lifecycle.PreStop); err != nil {
+			klog.ErrorS(err, "PreStop hook failed", "pod", klog.KObj(pod), "podUID", pod.UID,
+				"containerName", containerSpec.Name, "containerID", containerID.String())
+			m.recordContainerEvent(pod, containerSpec, containerID.ID, v1.EventTypeWarning, events.FailedPreStopHook, msg)
+		}
+	}()
+
+	select {
+	case <-time.After(time.Duration(gracePeriod) * time.Second):
+		klog.V(2).InfoS("PreStop hook not completed in grace period", "pod", klog.KObj(pod), "podUID", pod.UID,
+			"containerName", containerSpec.Name, "containerID", containerID.String(), "gracePeriod", gracePeriod)
+	case <-done:
+		klog.V(3).InfoS("PreStop hook completed", "pod", klog.KObj(pod), "podUID", pod.UID,
+			"containerName", containerSpec.Name, "containerID", containerID.String())
+	}
+
+	return int64(time.Since(start).Seconds())
+}
+
+// killContainer kills a container through the following steps:
+// * Run the pre-stop lifecycle hooks (if applicable).
+// * Stop the container.
+func (m *processManager) killContainer(pod *v1.Pod, containerID kubecontainer.ContainerID, containerName string, message string, gracePeriodOverride *int64) error {
+	m.lock.RLock()
+	record, ok := m.containers[containerID.ID]
+	m.lock.RUnlock()
+	if !ok {
+		klog.V(3).InfoS("Container to kill not found, assuming it is gone", "containerName", containerName, "containerID", containerID.String())
+		return nil
+	}
+
+	var containerSpec *v1.Container
+	if pod != nil {
+		containerSpec = kubecontainer.GetContainerSpec(pod, containerName)
+	}
+
+	// The pod may be nil for orphaned containers, they get the minimal grace period.
+	gracePeriod := int64(minimumGracePeriodInSeconds)
+	if pod != nil {
+		switch {
+		case pod.DeletionGracePeriodSeconds != nil:
+			gracePeriod = *pod.DeletionGracePeriodSeconds
+		case pod.Spec.TerminationGracePeriodSeconds != nil:
+			gracePeriod = *pod.Spec.TerminationGracePeriodSeconds
+		}
+	}
+
+	if len(message) == 0 {
+		message = fmt.Sprintf("Stopping container %s", containerName)
+	}
+	if containerSpec != nil {
+		m.recordContainerEvent(pod, containerSpec, containerID.ID, v1.EventTypeNormal, events.KillingContainer, message)
+	}
+
+	// Run the pre-stop lifecycle hooks if applicable and if there is enough time to run it.
+	// A container whose process is already gone has nothing left to drain.
+	if containerSpec != nil && containerSpec.Lifecycle != nil && containerSpec.Lifecycle.PreStop != nil && gracePeriod > 0 && !record.exited() {
+		gracePeriod = gracePeriod - m.executePreStopHook(pod, containerID, containerSpec, gracePeriod)
+	}
+	// always give containers a minimal shutdown window to avoid unnecessary SIGKILLs
+	if gracePeriod < minimumGracePeriodInSeconds {
+		gracePeriod = minimumGracePeriodInSeconds
+	}
+	if gracePeriodOverride != nil {
+		gracePeriod = *gracePeriodOverride
+		klog.V(3).InfoS("Killing container with a grace period override", "pod", klog.KRef(record.PodNamespace, record.PodName), "podUID", record.PodUID,
+			"containerName", containerName, "containerID", containerID.String(), "gracePeriod", gracePeriod)
+	}
+
+	klog.V(2).InfoS("Killing container with a grace period", "pod", klog.KRef(record.PodNamespace, record.PodName), "podUID", record.PodUID,
+		"containerName", containerName, "containerID", containerID.String(), "gracePeriod", gracePeriod)
+
+	if err := m.stopContainer(pod, containerSpec, record, gracePeriod); err != nil {
+		klog.ErrorS(err, "Container termination failed with gracePeriod", "pod", klog.KRef(record.PodNamespace, record.PodName), "podUID", record.PodUID,
+			"containerName", containerName, "containerID", containerID.String(), "gracePeriod", gracePeriod)
+		return err
+	}
+	klog.V(3).InfoS("Container exited normally", "pod", klog.KRef(record.PodNamespace, record.PodName), "podUID", record.PodUID,
+		"containerName", containerName, "containerID", containerID.String())
+
+	return nil
+}
+
+// stopContainer sends SIGTERM to the process group of the container and
+// escalates to SIGKILL if the container has not exited after gracePeriod
+// seconds. pod and containerSpec are only used for events and may be nil.
+func (m *processManager) stopContainer(pod *v1.Pod, containerSpec *v1.Container, record *containerRecord, gracePeriod int64) error {
+	if record.exited() {
+		return nil
+	}
+
+	m.lock.RLock()
+	pid := record.Pid
+	m.lock.RUnlock()
+
+	if gracePeriod > 0 {
+		klog.V(4).InfoS("Sending SIGTERM to container process group", "containerID", record.ID, "pid", pid)
+		if _, err := signalProcessGroup(pid, syscall.SIGTERM); err != nil {
+			return fmt.Errorf("failed to stop container %q: %v", record.Name, err)
+		}
+		select {
+		case <-record.done:
+			return nil
+		case <-time.After(time.Duration(gracePeriod) * time.Second):
+		}
+
+		if containerSpec != nil {
+			m.recordContainerEvent(pod, containerSpec, record.ID, v1.EventTypeWarning, events.ExceededGracePeriod,
+				"Container %s did not exit within the grace period of %d seconds, killing it", containerSpec.Name, gracePeriod)
+		}
+	}
+
+	klog.V(4).InfoS("Sending SIGKILL to container process group", "containerID", record.ID, "pid", pid)
+	if _, err := signalProcessGroup(pid, syscall.SIGKILL); err != nil {
+		return fmt.Errorf("failed to kill container %q: %v", record.Name, err)
+	}
+
+	select {
+	case <-record.done:
+		return nil
+	case <-time.After(killWaitTimeout):
+		return fmt.Errorf("timeout waiting for container %q to exit", record.Name)
+	}
+}
+
+// doBackOff checks whether the container is waiting out a back-off after its
+// last exit, and records the next back-off for it otherwise.
+func (m *processManager) doBackOff(pod *v1.Pod, container *v1.Container, podStatus *kubecontainer.PodStatus, backOff *flowcontrol.Backoff) (bool, string, error) {
+	if backOff == nil {
+		return false, "", nil
+	}
+
+	var cStatus *kubecontainer.Status
+	for _, c := range podStatus.ContainerStatuses {
+		if c.Name == container.Name && c.State == kubecontainer.ContainerStateExited {
+			cStatus = c
+			break
+		}
+	}
+
+	if cStatus == nil {
+		return false, "", nil
+	}
+
+	klog.V(3).InfoS("Checking backoff for container in pod", "containerName", container.Name, "pod", klog.KObj(pod))
+	// Use the finished time of the latest exited container as the start point to calculate whether to do back-off.
+	ts := cStatus.FinishedAt
+	// backOff requires a unique key to identify the container.
+	key := getStableKey(pod, container)
+	if backOff.IsInBackOffSince(key, ts) {
+		if containerRef, err := kubecontainer.GenerateContainerRef(pod, container); err == nil {
+			m.recorder.Eventf(containerRef, v1.EventTypeWarning, events.BackOffStartContainer, "Back-off restarting failed container")
+		}
+		err := fmt.Errorf("back-off %s restarting failed container=%s pod=%s", backOff.Get(key), container.Name, format.Pod(pod))
+		klog.V(3).InfoS("Back-off restarting failed container", "err", err.Error())
+		return true, err.Error(), kubecontainer.ErrCrashLoopBackOff
+	}
+
+	backOff.Next(key, ts)
+	return false, "", nil
+}
+
+// removeContainer removes the record and the on-disk state of an exited container.
+func (m *processManager) removeContainer(containerID string) error {
+	klog.V(4).InfoS("Removing container", "containerID", containerID)
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	return m.removeContainerLocked(containerID)
+}
+
+// pruneInitContainersBeforeStart ensures that before we begin creating init
+// containers, we have reduced the number of outstanding init containers still
+// present. This reduces load on the container garbage collector by only
+// preserving the most recent terminated init container.
+func (m *processManager) pruneInitContainersBeforeStart(pod *v1.Pod, podStatus *kubecontainer.PodStatus) {
+	// only the last execution of each init container should be preserved, and only preserve it if it is in the
+	// list of init containers to keep.
+	initContainerNames := sets.NewString()
+	for _, container := range pod.Spec.InitContainers {
+		initContainerNames.Insert(container.Name)
+	}
+	for name := range initContainerNames {
+		count := 0
+		for _, status := range podStatus.ContainerStatuses {
+			if status.Name != name ||
+				(status.State != kubecontainer.ContainerStateExited &&
+					status.State != kubecontainer.ContainerStateUnknown) {
+				continue
+			}
+			// Remove init containers in unknown state. It should have
+			// been stopped before pruneInitContainersBeforeStart is
+			// called.
+			count++
+			// keep the first init container for this name
+			if count == 1 {
+				continue
+			}
+			// prune all other init containers that match this container name
+			klog.V(4).InfoS("Removing init container", "containerName", status.Name, "containerID", status.ID.ID, "count", count)
+			if err := m.removeContainer(status.ID.ID); err != nil {
+				utilruntime.HandleError(fmt.Errorf("failed to remove pod init container %q: %v; Skipping pod %q", status.Name, err, format.Pod(pod)))
+				continue
+			}
+		}
+	}
+}
+
+// Remove all init containers. Note that this function does not check the state
+// of the container because it assumes all init containers have been stopped
+// before the call happens.
+func (m *processManager) purgeInitContainers(pod *v1.Pod, podStatus *kubecontainer.PodStatus) {
+	initContainerNames := sets.NewString()
+	for _, container := range pod.Spec.InitContainers {
+		initContainerNames.Insert(container.Name)
+	}
+	for name := range initContainerNames {
+		count := 0
+		for _, status := range podStatus.ContainerStatuses {
+			if status.Name != name {
+				continue
+			}
+			count++
+			// Purge all init containers that match this container name
+			klog.V(4).InfoS("Removing init container", "containerName", status.Name, "containerID", status.ID.ID, "count", count)
+			if err := m.removeContainer(status.ID.ID); err != nil {
+				utilruntime.HandleError(fmt.Errorf("failed to remove pod init container %q: %v; Skipping pod %q", status.Name, err, format.Pod(pod)))
+				continue
+			}
+		}
+	}
+}
+
+// findNextInitContainerToRun returns the status of the last failed container, the
+// index of next init container to start, or done if there are no further init containers.
+// Status is only returned if an init container is failed, in which case next will
+// point to the current container.
+func findNextInitContainerToRun(pod *v1.Pod, podStatus *kubecontainer.PodStatus) (status *kubecontainer.Status, next *v1.Container, done bool) {
+	if len(pod.Spec.InitContainers) == 0 {
+		return nil, nil, true
+	}
+
+	// If any of the main containers have status and are Running, then all init containers must
+	// have been executed at some point in the past.  However, they could have been removed
+	// from the container runtime now, and if we proceed, it would appear as if they
+	// never ran and will re-execute improperly.
+	for i := range pod.Spec.Containers {
+		container := &pod.Spec.Containers[i]
+		status := podStatus.FindContainerStatusByName(container.Name)
+		if status != nil && status.State == kubecontainer.ContainerStateRunning {
+			return nil, nil, true
+		}
+	}
+
+	// If there are failed containers, return the status of the last failed one.
+	for i := len(pod.Spec.InitContainers) - 1; i >= 0; i-- {
+		container := &pod.Spec.InitContainers[i]
+		status := podStatus.FindContainerStatusByName(container.Name)
+		if status != nil && isInitContainerFailed(status) {
+			return status, container, false
+		}
+	}
+
+	// There are no failed containers now.
+	for i := len(pod.Spec.InitContainers) - 1; i >= 0; i-- {
+		container := &pod.Spec.InitContainers[i]
+		status := podStatus.FindContainerStatusByName(container.Name)
+		if status == nil {
+			continue
+		}
+
+		// container is still running, return not done.
+		if status.State == kubecontainer.ContainerStateRunning {
+			return nil, nil, false
+		}
+
+		if status.State == kubecontainer.ContainerStateExited {
+			// all init containers successful
+			if i == (len(pod.Spec.InitContainers) - 1) {
+				return nil, nil, true
+			}
+
+			// all containers up to i successful, go to i+1
+			return nil, &pod.Spec.InitContainers[i+1], false
+		}
+	}
+
+	return nil, &pod.Spec.InitContainers[0], false
+}
@@ -0,0 +1,70 @@
+package process
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	kubecontainer "github.com/xuliangTang/mykubelet/pkg/kubelet/container"
+)
+
+func TestKillContainerExceedingGracePeriod(t *testing.T) {
+	m, recorder := newTestManager(t)
+	pod := makeTestPod(shellContainer("foo1", "trap 'echo TERM' TERM; echo ready; while true; do sleep 0.1; done"))
+	gracePeriod := int64(2)
+	pod.Spec.TerminationGracePeriodSeconds = &gracePeriod
+
+	if err := syncTestPod(t, m, pod, nil).Error(); err != nil {
+		t.Fatalf("unexpected sync error: %v", err)
+	}
+	status := waitForContainerState(t, m, pod, "foo1", kubecontainer.ContainerStateRunning)
+	m.lock.RLock()
+	logPath := m.containers[status.ID.ID].LogPath
+	m.lock.RUnlock()
+	waitForContainerLog(t, logPath, "ready")
+	drainEvents(recorder)
+
+	start := time.Now()
+	if err := m.killContainer(pod, status.ID, "foo1", "Stopping container", nil); err != nil {
+		t.Fatalf("unexpected kill error: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed < time.Duration(gracePeriod)*time.Second {
+		t.Errorf("expected the container to be killed after its grace period, took %v", elapsed)
+	}
+
+	status = getTestPodStatus(t, m, pod).FindContainerStatusByName("foo1")
+	if status.State != kubecontainer.ContainerStateExited || status.ExitCode != 128+9 || status.Reason != reasonError {
+		t.Errorf("expected the container to be killed by SIGKILL, got %+v", status)
+	}
+	if events := drainEvents(recorder); !reflect.DeepEqual(events, []string{"Killing", "ExceededGracePeriod"}) {
+		t.Errorf("expected Killing then ExceededGracePeriod events, got %v", events)
+	}
+
+	// The container got SIGTERM first.
+	waitForContainerLog(t, logPath, "TERM")
+}
+
+func TestContainerProcessesKilledOnExit(t *testing.T) {
+	m, _ := newTestManager(t)
+	pidFile := filepath.Join(t.TempDir(), "pid")
+	pod := makeTestPod(shellContainer("foo1", "sleep 1000 & echo $! > "+pidFile+"; exit 0"))
+
+	if err := syncTestPod(t, m, pod, nil).Error(); err != nil {
+		t.Fatalf("unexpected sync error: %v", err)
+	}
+	waitForContainerState(t, m, pod, "foo1", kubecontainer.ContainerStateExited)
+
+	data, err := os.ReadFile(pidFile)
+	if err != nil {
+		t.Fatalf("failed to read the pid of the background process: %v", err)
+	}
+	pid, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil {
+		t.Fatalf("unexpected pid %q: %v", data, err)
+	}
+	waitForProcessExit(t, pid)
+}
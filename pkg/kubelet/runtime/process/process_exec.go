@@ -0,0 +1,177 @@
+package process
+
+import (
+	"bytes"
+	"fmt"
+	"os/exec"
+	"strings"
+	"syscall"
+	"time"
+
+	kubecontainer "github.com/xuliangTang/mykubelet/pkg/kubelet/container"
+	probeexec "github.com/xuliangTang/mykubelet/pkg/probe/exec"
+	"k8s.io/klog/v2"
+	utilexec "k8s.io/utils/exec"
+)
+
+// execWaitDelay bounds how long RunInContainer waits for the output of a
+// command that exited, or was killed, while a process it forked still holds
+// its stdout or stderr open.
+const execWaitDelay = time.Second
+
+// RunInContainer synchronously executes the command in the container, and returns the output.
+// The command is killed once timeout elapses, zero means no timeout. The
+// combined stdout and stderr are returned, with a CodeExitError if the command
+// exits with a non-zero code.
+func (m *processManager) RunInContainer(id kubecontainer.ContainerID, cmd []string, timeout time.Duration) ([]byte, error) {
+	c, record, sandbox, err := m.newContainerCommand(id, cmd, false)
+	if err != nil {
+		return nil, err
+	}
+	// The command leads a process group of its own, so that the processes it
+	// forks are killed with it on timeout.
+	if !leadsProcessGroup(c) {
+		setProcessGroup(c)
+	}
+	var output bytes.Buffer
+	c.Stdout = &output
+	c.Stderr = &output
+	c.WaitDelay = execWaitDelay
+	wait, err := m.startContainerCommand(c, record, sandbox)
+	if err != nil {
+		return nil, err
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- wait()
+	}()
+	var timeoutCh <-chan time.Time
+	if timeout > 0 {
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		timeoutCh = timer.C
+	}
+	select {
+	case err = <-done:
+	case <-timeoutCh:
+		if _, err := signalProcessGroup(c.Process.Pid, syscall.SIGKILL); err != nil {
+			klog.V(4).InfoS("Failed to kill timed out command", "containerID", id.ID, "pid", c.Process.Pid, "err", err)
+		}
+		<-done
+		return output.Bytes(), probeexec.NewTimeoutError(fmt.Errorf("command %q timed out", strings.Join(cmd, " ")), timeout)
+	}
+	if err := commandExitError(cmd, err, output.Bytes()); err != nil {
+		return output.Bytes(), err
+	}
+	return output.Bytes(), nil
+}
+
+// newContainerCommand builds a command run in a running container, with
+// the environment, working directory and security config of the container
+// process, and in the namespaces and the root filesystem of its sandbox.
+// The command joins the process group of the container so that it goes away
+// with the container, unless it leads a session of its own: with tty, or if
+// the container process leads the session of its terminal.
+func (m *processManager) newContainerCommand(id kubecontainer.ContainerID, cmd []string, tty bool) (*exec.Cmd, *containerRecord, *sandboxRecord, error) {
+	if len(cmd) == 0 {
+		return nil, nil, nil, fmt.Errorf("no command specified to run in container %q", id.ID)
+	}
+
+	m.lock.RLock()
+	record, ok := m.containers[id.ID]
+	var (
+		state        kubecontainer.State
+		pid          int
+		env          []string
+		workingDir   string
+		security     *securityConfig
+		rootfs       string
+		containerTTY bool
+		sandbox      *sandboxRecord
+	)
+	if ok {
+		state, pid, env, workingDir, security, rootfs, containerTTY = record.State, record.Pid, record.Env, record.WorkingDir, record.Security, record.Rootfs, record.TTY
+		sandbox, ok = m.sandboxes[record.SandboxID]
+	}
+	m.lock.RUnlock()
+	if !ok {
+		return nil, nil, nil, fmt.Errorf("container %q not found", id.ID)
+	}
+	if state != kubecontainer.ContainerStateRunning {
+		return nil, nil, nil, fmt.Errorf("container %q is not running", id.ID)
+	}
+
+	var c *exec.Cmd
+	if rootfs != "" {
+		// The command is looked up in the root filesystem by the container init.
+		c = &exec.Cmd{Path: cmd[0], Args: cmd}
+	} else {
+		c = exec.Command(cmd[0], cmd[1:]...)
+	}
+	c.Env = env
+	c.Dir = workingDir
+	if tty || containerTTY {
+		setSession(c, tty)
+	} else {
+		// The process group is looked up in the pid namespace of the command.
+		pgid := pid
+		if sandbox.Namespaces != nil && sandbox.Namespaces.PID {
+			var err error
+			if pgid, err = namespacedPid(pid); err != nil {
+				return nil, nil, nil, fmt.Errorf("failed to find the pid of container %q in its pid namespace: %v", id.ID, err)
+			}
+		}
+		joinProcessGroup(c, pgid)
+	}
+	if security != nil {
+		if err := applySecurityConfig(c, security, rootfs != ""); err != nil {
+			return nil, nil, nil, err
+		}
+	}
+	return c, record, sandbox, nil
+}
+
+// startContainerCommand starts a command built by newContainerCommand, in the
+// cgroup of the container. It returns the function waiting for the command
+// to exit. A command leading a session or a process group of its own is
+// killed with its group if the container exits first.
+func (m *processManager) startContainerCommand(c *exec.Cmd, record *containerRecord, sandbox *sandboxRecord) (func() error, error) {
+	// The command is accounted to the container, and limited with it.
+	if err := m.startInContainerCgroup(c, record, sandbox); err != nil {
+		return nil, err
+	}
+	if !leadsProcessGroup(c) {
+		return c.Wait, nil
+	}
+	exited := make(chan struct{})
+	go func() {
+		select {
+		case <-record.done:
+			if _, err := signalProcessGroup(c.Process.Pid, syscall.SIGKILL); err != nil {
+				klog.V(4).InfoS("Failed to kill command of exited container", "containerID", record.ID, "pid", c.Process.Pid, "err", err)
+			}
+		case <-exited:
+		}
+	}()
+	return func() error {
+		defer close(exited)
+		return c.Wait()
+	}, nil
+}
+
+// commandExitError converts the error of a command that exited with a
+// non-zero code into a CodeExitError.
+func commandExitError(cmd []string, err error, output []byte) error {
+	if err == nil {
+		return nil
+	}
+	if _, ok := err.(*exec.ExitError); !ok {
+		return err
+	}
+	exitCode := exitCodeFromError(err)
+	return utilexec.CodeExitError{
+		Err:  fmt.Errorf("command '%s' exited with %d: %s", strings.Join(cmd, " "), exitCode, output),
+		Code: exitCode,
+	}
+}
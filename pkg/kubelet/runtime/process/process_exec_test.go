@@ -0,0 +1,158 @@
+package process
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	kubecontainer "github.com/xuliangTang/mykubelet/pkg/kubelet/container"
+	probeexec "github.com/xuliangTang/mykubelet/pkg/probe/exec"
+	utilexec "k8s.io/utils/exec"
+)
+
+// startTestContainer starts a pod with a single long running container, and
+// returns the ID of the container.
+func startTestContainer(t *testing.T, m *processManager) kubecontainer.ContainerID {
+	t.Helper()
+	pod := makeTestPod(shellContainer("foo1", "exec sleep 1000"))
+	m.runtimeHelper.(*fakeRuntimeHelper).envs = []kubecontainer.EnvVar{{Name: "NAME", Value: "foo"}}
+	if err := syncTestPod(t, m, pod, nil).Error(); err != nil {
+		t.Fatalf("unexpected sync error: %v", err)
+	}
+	return waitForContainerState(t, m, pod, "foo1", kubecontainer.ContainerStateRunning).ID
+}
+
+// waitForProcessExit waits until the process pid is gone, or is a zombie
+// left to be reaped by init.
+func waitForProcessExit(t *testing.T, pid int) {
+	t.Helper()
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		stat, err := os.ReadFile(filepath.Join("/proc", strconv.Itoa(pid), "stat"))
+		if err != nil || strings.Contains(string(stat), ") Z ") {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("expected process %d to be killed, got %q", pid, stat)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestRunInContainer(t *testing.T) {
+	m, _ := newTestManager(t)
+	id := startTestContainer(t, m)
+
+	for desc, test := range map[string]struct {
+		script         string
+		expectedOutput string
+		// expectedCode is the expected exit code, zero for no error.
+		expectedCode int
+	}{
+		"success": {
+			script:         "echo hello from $NAME",
+			expectedOutput: "hello from foo\n",
+		},
+		"combined output": {
+			script:         "echo out; echo err >&2",
+			expectedOutput: "out\nerr\n",
+		},
+		"non-zero exit code": {
+			script:         "echo failed; exit 3",
+			expectedOutput: "failed\n",
+			expectedCode:   3,
+		},
+		"killed by a signal": {
+			script:       "kill -9 $$",
+			expectedCode: 128 + 9,
+		},
+	} {
+		t.Run(desc, func(t *testing.T) {
+			output, err := m.RunInContainer(id, []string{"/bin/sh", "-c", test.script}, 10*time.Second)
+			if string(output) != test.expectedOutput {
+				t.Errorf("expected output %q, got %q", test.expectedOutput, output)
+			}
+			if test.expectedCode == 0 {
+				if err != nil {
+					t.Errorf("unexpected error: %v", err)
+				}
+				return
+			}
+			exitErr, ok := err.(utilexec.CodeExitError)
+			if !ok {
+				t.Fatalf("expected a CodeExitError, got %#v", err)
+			}
+			if exitErr.ExitStatus() != test.expectedCode || !exitErr.Exited() {
+				t.Errorf("expected exit code %d, got %d", test.expectedCode, exitErr.ExitStatus())
+			}
+		})
+	}
+}
+
+func TestRunInContainerTimeout(t *testing.T) {
+	m, _ := newTestManager(t)
+	id := startTestContainer(t, m)
+	pidFile := filepath.Join(t.TempDir(), "pid")
+
+	timeout := 200 * time.Millisecond
+	start := time.Now()
+	output, err := m.RunInContainer(id, []string{"/bin/sh", "-c", "sleep 1000 & echo $! > " + pidFile + "; echo started; sleep 1000"}, timeout)
+	elapsed := time.Since(start)
+
+	timeoutErr, ok := err.(*probeexec.TimeoutError)
+	if !ok {
+		t.Fatalf("expected a TimeoutError, got %#v", err)
+	}
+	if timeoutErr.Timeout() != timeout {
+		t.Errorf("expected timeout %v, got %v", timeout, timeoutErr.Timeout())
+	}
+	if string(output) != "started\n" {
+		t.Errorf("expected the output until the timeout, got %q", output)
+	}
+	// The processes forked by the command do not hold its output open.
+	if elapsed >= execWaitDelay {
+		t.Errorf("expected the command to be killed on timeout, took %v", elapsed)
+	}
+
+	data, err := os.ReadFile(pidFile)
+	if err != nil {
+		t.Fatalf("failed to read the pid of the background process: %v", err)
+	}
+	pid, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil {
+		t.Fatalf("unexpected pid %q: %v", data, err)
+	}
+	waitForProcessExit(t, pid)
+
+	// The container itself is left running.
+	if _, err := m.RunInContainer(id, []string{"/bin/true"}, 0); err != nil {
+		t.Errorf("expected the container to be running, got %v", err)
+	}
+}
+
+func TestRunInContainerErrors(t *testing.T) {
+	m, _ := newTestManager(t)
+	id := startTestContainer(t, m)
+
+	for desc, test := range map[string]struct {
+		id  kubecontainer.ContainerID
+		cmd []string
+	}{
+		"no command":        {id: id},
+		"missing container": {id: buildContainerID("missing"), cmd: []string{"/bin/true"}},
+		"missing command":   {id: id, cmd: []string{filepath.Join(t.TempDir(), "missing")}},
+	} {
+		t.Run(desc, func(t *testing.T) {
+			_, err := m.RunInContainer(test.id, test.cmd, time.Second)
+			if err == nil {
+				t.Fatal("expected an error")
+			}
+			if _, ok := err.(utilexec.CodeExitError); ok {
+				t.Errorf("expected the command not to run, got %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,88 @@
+//go:build linux
+// +build linux
+
+package process
+
+import (
+	"errors"
+	"os/exec"
+	"syscall"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// setProcessGroup makes the process of cmd the leader of a new process
+// group, so that the container can be signalled as a whole.
+func setProcessGroup(cmd *exec.Cmd) {
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.Setpgid = true
+	cmd.SysProcAttr.Pgid = 0
+}
+
+// leadsProcessGroup returns whether the process of cmd is started as the
+// leader of a new process group, or of a new session.
+func leadsProcessGroup(cmd *exec.Cmd) bool {
+	if cmd.SysProcAttr == nil {
+		return false
+	}
+	return cmd.SysProcAttr.Setsid || (cmd.SysProcAttr.Setpgid && cmd.SysProcAttr.Pgid == 0)
+}
+
+// joinProcessGroup makes the process of cmd a member of the process group
+// led by pgid, so that it is signalled together with the container.
+func joinProcessGroup(cmd *exec.Cmd, pgid int) {
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.Setpgid = true
+	cmd.SysProcAttr.Pgid = pgid
+}
+
+// setSession makes the process of cmd the leader of a new session, and of
+// its process group. With tty the terminal of its stdin becomes the
+// controlling terminal of the session.
+func setSession(cmd *exec.Cmd, tty bool) {
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.Setpgid = false
+	cmd.SysProcAttr.Pgid = 0
+	cmd.SysProcAttr.Setsid = true
+	cmd.SysProcAttr.Setctty = tty
+	cmd.SysProcAttr.Ctty = 0
+}
+
+// signalProcessGroup sends sig to every process in the group led by pid. It
+// returns false if the group has no process left.
+func signalProcessGroup(pid int, sig syscall.Signal) (bool, error) {
+	if pid <= 0 {
+		return false, nil
+	}
+	err := syscall.Kill(-pid, sig)
+	if errors.Is(err, syscall.ESRCH) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// waitProcessExit blocks until the process pid exits, without reaping it.
+// The pid, and so the process group it leads, cannot be reused until the
+// process is reaped.
+func waitProcessExit(pid int) error {
+	// The siginfo argument is filled in by the kernel and otherwise ignored,
+	// it only has to be large enough.
+	var siginfo [16]uint64
+	const pPid = 1
+	for {
+		_, _, errno := syscall.Syscall6(syscall.SYS_WAITID, pPid, uintptr(pid), uintptr(unsafe.Pointer(&siginfo)), syscall.WEXITED|unix.WNOWAIT, 0, 0)
+		if errno != syscall.EINTR {
+			if errno != 0 {
+				return errno
+			}
+			return nil
+		}
+	}
+}
@@ -0,0 +1,42 @@
+//go:build !linux
+// +build !linux
+
+package process
+
+import (
+	"os"
+	"os/exec"
+	"syscall"
+)
+
+func setProcessGroup(cmd *exec.Cmd) {
+}
+
+func leadsProcessGroup(cmd *exec.Cmd) bool {
+	return false
+}
+
+func joinProcessGroup(cmd *exec.Cmd, pgid int) {
+}
+
+func setSession(cmd *exec.Cmd, tty bool) {
+}
+
+// signalProcessGroup only signals the process itself, process groups are
+// not supported on this platform.
+func signalProcessGroup(pid int, sig syscall.Signal) (bool, error) {
+	p, err := os.FindProcess(pid)
+	if err != nil {
+		return false, nil
+	}
+	if err := p.Signal(sig); err != nil {
+		return false, nil
+	}
+	return true, nil
+}
+
+// waitProcessExit returns immediately, the process is only waited for when
+// it is reaped on this platform.
+func waitProcessExit(pid int) error {
+	return nil
+}
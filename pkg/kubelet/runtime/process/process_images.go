@@ -0,0 +1,105 @@
+package process
+
+import (
+	"fmt"
+	"path/filepath"
+
+	statsapi "github.com/xuliangTang/mykubelet/pkg/kubelet/apis/stats/v1alpha1"
+	kubecontainer "github.com/xuliangTang/mykubelet/pkg/kubelet/container"
+	"github.com/xuliangTang/mykubelet/pkg/kubelet/runtime/imagestore"
+	"github.com/xuliangTang/mykubelet/pkg/util/filesystem"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	runtimeapi "k8s.io/cri-api/pkg/apis/runtime/v1alpha2"
+)
+
+// imagesDirName is the directory of the runtime state holding the image store.
+const imagesDirName = "images"
+
+// newImageStore creates the image store of the runtime. Containers run in the
+// root filesystem of their image only when the pods have mount namespaces of
+// their own, without one they run the binaries of the host.
+func newImageStore(rootDir string, namespaceIsolation bool) (*imagestore.Store, error) {
+	if !namespaceIsolation {
+		return nil, nil
+	}
+	return imagestore.NewStore(filepath.Join(rootDir, imagesDirName))
+}
+
+// PullImage pulls the image into the store. Without image store it is a
+// no-op: process containers run binaries of the host.
+func (m *processManager) PullImage(image kubecontainer.ImageSpec, pullSecrets []v1.Secret, podSandboxConfig *runtimeapi.PodSandboxConfig) (string, error) {
+	if m.images == nil {
+		return image.Image, nil
+	}
+	return m.images.PullImage(image, pullSecrets, podSandboxConfig)
+}
+
+// GetImageRef returns the ID of the image if it is in the store. Without
+// image store it returns the image name itself, every image is considered present.
+func (m *processManager) GetImageRef(image kubecontainer.ImageSpec) (string, error) {
+	if m.images == nil {
+		return image.Image, nil
+	}
+	return m.images.GetImageRef(image)
+}
+
+// ListImages returns the images of the store, none without image store.
+func (m *processManager) ListImages() ([]kubecontainer.Image, error) {
+	if m.images == nil {
+		return nil, nil
+	}
+	return m.images.ListImages()
+}
+
+// RemoveImage removes the image from the store. The root filesystem of an
+// image can not go away under a running container, removing it fails.
+func (m *processManager) RemoveImage(image kubecontainer.ImageSpec) error {
+	if m.images == nil {
+		return nil
+	}
+	record, ok := m.images.GetImage(image.Image)
+	if !ok {
+		return nil
+	}
+	m.lock.RLock()
+	for _, c := range m.containers {
+		if c.ImageID == record.ID && c.State == kubecontainer.ContainerStateRunning {
+			m.lock.RUnlock()
+			return fmt.Errorf("image %q is in use by container %q", image.Image, c.ID)
+		}
+	}
+	m.lock.RUnlock()
+	return m.images.RemoveImage(image)
+}
+
+// ImageStats returns the disk usage of the images, empty without image store.
+func (m *processManager) ImageStats() (*kubecontainer.ImageStats, error) {
+	if m.images == nil {
+		return &kubecontainer.ImageStats{}, nil
+	}
+	return m.images.ImageStats()
+}
+
+// ImageFsStats returns the usage of the filesystem holding the images. Without
+// image store it is the filesystem of the runtime state, no image uses it.
+func (m *processManager) ImageFsStats() (*statsapi.FsStats, error) {
+	dir := m.rootDir
+	if m.images != nil {
+		dir = filepath.Join(m.rootDir, imagesDirName)
+	}
+	available, capacity, err := filesystem.Info(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get the usage of the image filesystem: %v", err)
+	}
+	imageStats, err := m.ImageStats()
+	if err != nil {
+		return nil, err
+	}
+	return &statsapi.FsStats{
+		Time:           metav1.Now(),
+		AvailableBytes: &available,
+		CapacityBytes:  &capacity,
+		UsedBytes:      &imageStats.TotalStorageBytes,
+	}, nil
+}
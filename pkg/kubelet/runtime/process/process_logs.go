@@ -0,0 +1,157 @@
+package process
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"sync"
+	"time"
+
+	kubecontainer "github.com/xuliangTang/mykubelet/pkg/kubelet/container"
+	"github.com/xuliangTang/mykubelet/pkg/kubelet/logs"
+	v1 "k8s.io/api/core/v1"
+	runtimeapi "k8s.io/cri-api/pkg/apis/runtime/v1alpha2"
+	"k8s.io/klog/v2"
+)
+
+// containerLogger copies the stdout and stderr of a container process into
+// the log file of the container, and to the clients attached to the
+// container. The process writes into pipes rather than directly into the
+// file so that every line is written in CRI log format. A process with a tty
+// writes both into its terminal, which is copied as stdout.
+type containerLogger struct {
+	writer           *logs.ContainerLogWriter
+	stdoutR, stdoutW *os.File
+	stderrR, stderrW *os.File
+	// streams are the stdio streams of the process clients attach to.
+	streams *containerStreams
+}
+
+// newContainerLogger opens the log file at path and connects the stdio
+// streams of cmd, the one of container. Either start or close must be called
+// afterwards.
+func newContainerLogger(path string, policy logs.LogRotatePolicy, container *v1.Container, cmd *exec.Cmd) (*containerLogger, error) {
+	writer, err := logs.NewContainerLogWriter(path, policy)
+	if err != nil {
+		return nil, err
+	}
+	l := &containerLogger{writer: writer}
+	if l.streams, err = newContainerStreams(container, cmd); err != nil {
+		l.close()
+		return nil, err
+	}
+	if l.streams.tty != nil {
+		return l, nil
+	}
+	if l.stdoutR, l.stdoutW, err = os.Pipe(); err != nil {
+		l.close()
+		return nil, err
+	}
+	if l.stderrR, l.stderrW, err = os.Pipe(); err != nil {
+		l.close()
+		return nil, err
+	}
+	cmd.Stdout = l.stdoutW
+	cmd.Stderr = l.stderrW
+	return l, nil
+}
+
+// start begins copying once the process has been started. The write ends of
+// the pipes are only held by the process from now on, so copying stops when
+// the process and all of its children have closed them.
+func (l *containerLogger) start() {
+	l.streams.started()
+	if l.streams.tty != nil {
+		go func() {
+			l.writer.CopyStream(runtimeapi.Stdout, io.TeeReader(terminalReader{l.streams.tty}, l.streams.stdout))
+			l.close()
+		}()
+		return
+	}
+	l.stdoutW.Close()
+	l.stderrW.Close()
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		l.writer.CopyStream(runtimeapi.Stdout, io.TeeReader(l.stdoutR, l.streams.stdout))
+	}()
+	go func() {
+		defer wg.Done()
+		l.writer.CopyStream(runtimeapi.Stderr, io.TeeReader(l.stderrR, l.streams.stderr))
+	}()
+	go func() {
+		wg.Wait()
+		l.close()
+	}()
+}
+
+// close releases the pipes, the streams and the log file.
+func (l *containerLogger) close() {
+	for _, f := range []*os.File{l.stdoutR, l.stdoutW, l.stderrR, l.stderrW} {
+		if f != nil {
+			f.Close()
+		}
+	}
+	if l.streams != nil {
+		l.streams.close()
+	}
+	if err := l.writer.Close(); err != nil {
+		klog.ErrorS(err, "Failed to close container log")
+	}
+}
+
+// GetContainerLogs returns logs of a specific container.
+func (m *processManager) GetContainerLogs(ctx context.Context, pod *v1.Pod, containerID kubecontainer.ContainerID, logOptions *v1.PodLogOptions, stdout, stderr io.Writer) error {
+	m.lock.RLock()
+	record, ok := m.containers[containerID.ID]
+	var logPath string
+	if ok {
+		logPath = record.LogPath
+	}
+	m.lock.RUnlock()
+	if !ok || logPath == "" {
+		klog.V(4).InfoS("Failed to get container status", "containerID", containerID.String())
+		return fmt.Errorf("unable to retrieve container logs for %v", containerID.String())
+	}
+	return m.ReadLogs(ctx, logPath, containerID.ID, logOptions, stdout, stderr)
+}
+
+// ReadLogs read the container log and redirect into stdout and stderr.
+func (m *processManager) ReadLogs(ctx context.Context, path, containerID string, apiOpts *v1.PodLogOptions, stdout, stderr io.Writer) error {
+	// Convert v1.PodLogOptions into internal log options.
+	opts := logs.NewLogOptions(apiOpts, time.Now())
+
+	return logs.ReadLogs(ctx, path, containerID, opts, m.isContainerRunning, stdout, stderr)
+}
+
+// isContainerRunning returns whether the container with the given id is running.
+func (m *processManager) isContainerRunning(containerID string) (bool, error) {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+	record, ok := m.containers[containerID]
+	if !ok {
+		return false, fmt.Errorf("container %q not found", containerID)
+	}
+	return record.State == kubecontainer.ContainerStateRunning, nil
+}
+
+// removeContainerLog removes the container log.
+func (m *processManager) removeContainerLog(record *containerRecord) error {
+	if record.LogPath == "" {
+		return nil
+	}
+	logs, err := logs.GetAllLogs(record.LogPath)
+	if err != nil {
+		return err
+	}
+	for _, log := range logs {
+		if err := os.Remove(log); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to remove container %q log %q: %v", record.ID, log, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,908 @@
+package process
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/xuliangTang/mykubelet/pkg/kubelet/cm"
+	kubecontainer "github.com/xuliangTang/mykubelet/pkg/kubelet/container"
+	"github.com/xuliangTang/mykubelet/pkg/kubelet/cri/streaming"
+	"github.com/xuliangTang/mykubelet/pkg/kubelet/events"
+	"github.com/xuliangTang/mykubelet/pkg/kubelet/images"
+	"github.com/xuliangTang/mykubelet/pkg/kubelet/lifecycle"
+	"github.com/xuliangTang/mykubelet/pkg/kubelet/logs"
+	"github.com/xuliangTang/mykubelet/pkg/kubelet/runtime/cni"
+	"github.com/xuliangTang/mykubelet/pkg/kubelet/runtime/hostport"
+	"github.com/xuliangTang/mykubelet/pkg/kubelet/runtime/imagestore"
+	"github.com/xuliangTang/mykubelet/pkg/kubelet/runtime/ipam"
+	"github.com/xuliangTang/mykubelet/pkg/kubelet/stats"
+	"github.com/xuliangTang/mykubelet/pkg/kubelet/util/format"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	utilnet "k8s.io/apimachinery/pkg/util/net"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/client-go/util/flowcontrol"
+	runtimeapi "k8s.io/cri-api/pkg/apis/runtime/v1alpha2"
+	"k8s.io/klog/v2"
+)
+
+const (
+	// The runtime name of the process runtime
+	processRuntimeName = "process"
+	// The version of the process runtime
+	processRuntimeVersion = "0.1.0"
+	// The API version reported by the process runtime
+	processRuntimeAPIVersion = "0.1.0"
+
+	// The file the IPs allocated to pod sandboxes are checkpointed to
+	ipamCheckpointFileName = "ipam.json"
+
+	// Exit code reported when the exit status of a process cannot be determined
+	unknownExitCode = 255
+
+	reasonCompleted = "Completed"
+	reasonError     = "Error"
+	// reasonStartError is the reason of a container whose process could not be started
+	reasonStartError = "StartError"
+	// reasonStatusUnknown is the reason of a container whose process outlived a kubelet restart
+	reasonStatusUnknown = "ContainerStatusUnknown"
+	// reasonOOMKilled is the reason of a container killed by the OOM killer
+	reasonOOMKilled = "OOMKilled"
+)
+
+// ProcessRuntime is the interface implemented by the process runtime manager.
+type ProcessRuntime interface {
+	kubecontainer.Runtime
+	kubecontainer.CommandRunner
+	kubecontainer.StreamingRuntime
+	kubecontainer.Attacher
+	// ServeHTTP serves the URLs returned by the StreamingRuntime.
+	http.Handler
+	stats.ContainerLister
+	images.StatsProvider
+}
+
+// processManager runs the containers of a pod as plain processes on the host.
+// It keeps one record per container instance and per pod sandbox, persisted
+// below rootDir.
+type processManager struct {
+	// Root directory of the runtime state.
+	rootDir string
+	store   *recordStore
+
+	// Root directory of the pod logs, and how container logs are rotated.
+	podLogsRootDirectory string
+	logRotatePolicy      logs.LogRotatePolicy
+
+	// runtimeHelper wraps kubelet to generate runtime container options.
+	runtimeHelper kubecontainer.RuntimeHelper
+	recorder      record.EventRecorder
+
+	// Runner of lifecycle events.
+	runner kubecontainer.HandlerRunner
+
+	// podStateProvider tells the garbage collector which pods are gone.
+	podStateProvider podStateProvider
+
+	// cgroupManager manages the cgroups enforcing the resources of containers.
+	cgroupManager cm.CgroupManager
+
+	// namespaceIsolation gives every pod its own pid, UTS, IPC and mount
+	// namespaces, held by the process of its sandbox.
+	namespaceIsolation bool
+	// images is the store of the images containers run in, nil when they
+	// run the binaries of the host.
+	images *imagestore.Store
+	// imagePuller pulls the images of containers according to their pull
+	// policy, backing off failed pulls.
+	imagePuller images.ImageManager
+
+	// streamingServer serves the exec, attach and port-forward streams.
+	streamingServer streaming.Server
+
+	version    *processVersion
+	apiVersion *processVersion
+
+	// lock protects containers, sandboxes and the fields of their records.
+	lock       sync.RWMutex
+	containers map[string]*containerRecord
+	sandboxes  map[string]*sandboxRecord
+
+	// ipam allocates the IPs of the sandboxes with a network namespace of
+	// their own, from the pod CIDRs of the node.
+	ipam *ipam.Allocator
+	// networkPlugin sets up the network namespaces of the pods not in the
+	// network of the host, nil if pods share the network of the host.
+	networkPlugin *cni.Plugin
+	// hostPorts forwards the host ports of the pods with a network namespace
+	// of their own to their IPs.
+	hostPorts *hostport.Manager
+	// nodeIPs returns the IPs of the node, which are the IPs of the pods
+	// sharing the network of the host.
+	nodeIPs func() ([]net.IP, error)
+}
+
+// NewProcessRuntimeManager creates a new process runtime whose state lives in rootDir.
+// Container logs are written below podLogsRootDirectory. With namespaceIsolation
+// the containers of a pod run in namespaces of their own, in the root
+// filesystem of their image, and with a networkPlugin the pods not in the
+// network of the host get a network namespace set up by it. The other pods
+// have the IPs returned by nodeIPs. Failed image pulls are backed off with
+// imageBackOff.
+func NewProcessRuntimeManager(rootDir string, podLogsRootDirectory string, logRotatePolicy logs.LogRotatePolicy, runtimeHelper kubecontainer.RuntimeHelper, podStateProvider podStateProvider, recorder record.EventRecorder, namespaceIsolation bool, networkPlugin *cni.Plugin, nodeIPs func() ([]net.IP, error), imageBackOff *flowcontrol.Backoff) (ProcessRuntime, error) {
+	store, err := newRecordStore(rootDir)
+	if err != nil {
+		return nil, err
+	}
+	version, err := newProcessVersion(processRuntimeVersion)
+	if err != nil {
+		return nil, err
+	}
+	apiVersion, err := newProcessVersion(processRuntimeAPIVersion)
+	if err != nil {
+		return nil, err
+	}
+	imageStore, err := newImageStore(rootDir, namespaceIsolation)
+	if err != nil {
+		return nil, err
+	}
+	allocator, err := ipam.NewAllocator(filepath.Join(rootDir, ipamCheckpointFileName))
+	if err != nil {
+		return nil, err
+	}
+
+	m := &processManager{
+		rootDir:              rootDir,
+		store:                store,
+		podLogsRootDirectory: podLogsRootDirectory,
+		logRotatePolicy:      logRotatePolicy,
+		runtimeHelper:        runtimeHelper,
+		podStateProvider:     podStateProvider,
+		recorder:             recorder,
+		cgroupManager:        cm.NewCgroupManager(cm.CgroupMountPoint),
+		namespaceIsolation:   namespaceIsolation,
+		images:               imageStore,
+		ipam:                 allocator,
+		networkPlugin:        networkPlugin,
+		hostPorts:            hostport.NewManager(),
+		nodeIPs:              nodeIPs,
+		version:              version,
+		apiVersion:           apiVersion,
+		containers:           make(map[string]*containerRecord),
+		sandboxes:            make(map[string]*sandboxRecord),
+	}
+	// Lifecycle hooks are sent with the settings of HTTP probes: no proxy,
+	// and the serving certificate of the container is not verified.
+	httpClient := &http.Client{
+		Transport: utilnet.SetTransportDefaults(&http.Transport{
+			TLSClientConfig:   &tls.Config{InsecureSkipVerify: true},
+			DisableKeepAlives: true,
+			Proxy:             http.ProxyURL(nil),
+		}),
+	}
+	m.runner = lifecycle.NewHandlerRunner(httpClient, m, m)
+	m.imagePuller = images.NewImageManager(recorder, m, imageBackOff)
+	if m.streamingServer, err = newStreamingServer(m); err != nil {
+		return nil, err
+	}
+	if err := m.restore(); err != nil {
+		return nil, err
+	}
+	if networkPlugin != nil {
+		go wait.Until(m.checkPodNetworks, networkCheckPeriod, wait.NeverStop)
+	}
+	return m, nil
+}
+
+// restore loads the records persisted by a previous kubelet. Processes that
+// are still alive are adopted and watched until they go away.
+func (m *processManager) restore() error {
+	sandboxes, err := m.store.loadSandboxes()
+	if err != nil {
+		return fmt.Errorf("failed to load sandboxes: %v", err)
+	}
+	for _, s := range sandboxes {
+		m.sandboxes[s.ID] = s
+		if s.Namespaces == nil {
+			continue
+		}
+		s.done = make(chan struct{})
+		if s.State == runtimeapi.PodSandboxState_SANDBOX_READY && processAlive(s.Namespaces.Pid) && isSandboxProcess(s.Namespaces.Pid) {
+			klog.InfoS("Adopting sandbox process from a previous run", "podSandboxID", s.ID, "pid", s.Namespaces.Pid)
+			go m.watchAdoptedSandbox(s)
+			// The host ports were forwarded by the previous kubelet.
+			if s.NetworkSetUp && len(s.IPs) != 0 {
+				if err := m.hostPorts.Add(s.ID, s.HostPorts, s.IPs); err != nil {
+					klog.ErrorS(err, "Failed to forward the host ports of an adopted sandbox", "podSandboxID", s.ID)
+				}
+			}
+			continue
+		}
+		m.markSandboxExited(s)
+	}
+	// Sandboxes stopped by the kubelet release their IPs, the IPs of the
+	// sandboxes whose records are gone are released here, and so are the
+	// IPs allocated to sandboxes sharing the network of the host.
+	if err := m.ipam.ReleaseUnknown(func(id string) bool {
+		s, ok := m.sandboxes[id]
+		return ok && s.hasPodNetwork()
+	}); err != nil {
+		return fmt.Errorf("failed to release the IPs of removed sandboxes: %v", err)
+	}
+
+	containers, err := m.store.loadContainers()
+	if err != nil {
+		return fmt.Errorf("failed to load containers: %v", err)
+	}
+	for _, c := range containers {
+		c.done = make(chan struct{})
+		m.containers[c.ID] = c
+		if c.State != kubecontainer.ContainerStateRunning {
+			close(c.done)
+			continue
+		}
+		if processAlive(c.Pid) {
+			klog.InfoS("Adopting container process from a previous run", "containerID", c.ID, "pid", c.Pid)
+			go m.watchAdoptedContainer(c)
+			continue
+		}
+		oomKilled := m.isOOMKilled(c)
+		m.destroyContainerCgroup(c)
+		m.unmountContainerRootfs(c)
+		m.markContainerLost(c, oomKilled)
+	}
+	return nil
+}
+
+// processAlive returns whether a process with the given pid exists.
+func processAlive(pid int) bool {
+	if pid <= 0 {
+		return false
+	}
+	p, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+	return p.Signal(syscall.Signal(0)) == nil
+}
+
+// watchAdoptedContainer polls a process that is not a child of this kubelet
+// until it exits. Its exit code can not be collected.
+func (m *processManager) watchAdoptedContainer(c *containerRecord) {
+	for processAlive(c.Pid) {
+		time.Sleep(time.Second)
+	}
+	if _, err := signalProcessGroup(c.Pid, syscall.SIGKILL); err != nil {
+		klog.V(4).InfoS("Failed to kill remaining container processes", "containerID", c.ID, "err", err)
+	}
+	oomKilled := m.isOOMKilled(c)
+	m.destroyContainerCgroup(c)
+	m.unmountContainerRootfs(c)
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.markContainerLost(c, oomKilled)
+}
+
+// markContainerLost marks a container whose exit status is unknown as exited.
+// The caller must hold the lock if the record is already published.
+func (m *processManager) markContainerLost(c *containerRecord, oomKilled bool) {
+	c.State = kubecontainer.ContainerStateExited
+	c.ExitCode = 137
+	if oomKilled {
+		c.Reason = reasonOOMKilled
+		c.Message = ""
+	} else {
+		c.Reason = reasonStatusUnknown
+		c.Message = "The container process was lost across a kubelet restart"
+	}
+	if c.FinishedAt.IsZero() {
+		c.FinishedAt = time.Now()
+	}
+	if err := m.store.saveContainer(c); err != nil {
+		klog.ErrorS(err, "Failed to persist container record", "containerID", c.ID)
+	}
+	if !c.exited() {
+		close(c.done)
+	}
+}
+
+// Type returns the type of the container runtime.
+func (m *processManager) Type() string {
+	return processRuntimeName
+}
+
+// SupportsSingleFileMapping returns whether the container runtime supports single file mappings or not.
+// Files are bind mounted in the mount namespace of the pod, containers of the
+// host share its files.
+func (m *processManager) SupportsSingleFileMapping() bool {
+	return m.namespaceIsolation
+}
+
+// Version returns the version information of the container runtime.
+func (m *processManager) Version() (kubecontainer.Version, error) {
+	return m.version, nil
+}
+
+// APIVersion returns the cached API version information of the container
+// runtime.
+func (m *processManager) APIVersion() (kubecontainer.Version, error) {
+	return m.apiVersion, nil
+}
+
+// checkRuntime checks that pods can be run, returning the reason of the
+// failed check with its error.
+func (m *processManager) checkRuntime() (string, error) {
+	if err := m.store.checkWritable(); err != nil {
+		return "StateNotWritable", fmt.Errorf("runtime state directory is not writable: %v", err)
+	}
+	if err := checkDirWritable(m.podLogsRootDirectory); err != nil {
+		return "LogsNotWritable", fmt.Errorf("pod logs directory is not writable: %v", err)
+	}
+	if m.namespaceIsolation {
+		if err := checkSandboxInit(m.networkPlugin != nil); err != nil {
+			return "SandboxInitUnavailable", fmt.Errorf("sandbox init is not available: %v", err)
+		}
+	}
+	return "", nil
+}
+
+// Status returns the status of the runtime. The runtime is ready while its
+// state and the container logs can be written, and the sandbox init can be
+// run with namespace isolation. The network is ready once the network plugin
+// has a network configured, and always without a plugin: the pods then share
+// the network of the host.
+func (m *processManager) Status() (*kubecontainer.RuntimeStatus, error) {
+	runtimeReady := kubecontainer.RuntimeCondition{Type: kubecontainer.RuntimeReady, Status: true}
+	if reason, err := m.checkRuntime(); err != nil {
+		runtimeReady.Status = false
+		runtimeReady.Reason = reason
+		runtimeReady.Message = err.Error()
+	}
+	networkReady := kubecontainer.RuntimeCondition{Type: kubecontainer.NetworkReady, Status: true}
+	if m.networkPlugin != nil {
+		if err := m.networkPlugin.Status(); err != nil {
+			networkReady.Status = false
+			networkReady.Reason = "NetworkPluginNotReady"
+			networkReady.Message = fmt.Sprintf("Network plugin returns error: %v", err)
+		}
+	}
+	return &kubecontainer.RuntimeStatus{
+		Conditions: []kubecontainer.RuntimeCondition{
+			runtimeReady,
+			networkReady,
+		},
+	}, nil
+}
+
+// GetPods returns a list of containers grouped by pods. The boolean parameter
+// specifies whether the runtime returns all containers including those already
+// exited and dead containers (used for garbage collection).
+func (m *processManager) GetPods(all bool) ([]*kubecontainer.Pod, error) {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+
+	pods := make(map[types.UID]*kubecontainer.Pod)
+	getPod := func(uid types.UID, name, namespace string) *kubecontainer.Pod {
+		p, ok := pods[uid]
+		if !ok {
+			p = &kubecontainer.Pod{ID: uid, Name: name, Namespace: namespace}
+			pods[uid] = p
+		}
+		return p
+	}
+
+	for _, s := range m.sandboxes {
+		if !all && s.State != runtimeapi.PodSandboxState_SANDBOX_READY {
+			continue
+		}
+		p := getPod(s.PodUID, s.PodName, s.PodNamespace)
+		p.Sandboxes = append(p.Sandboxes, s.toContainer())
+	}
+	for _, c := range m.containers {
+		if !all && c.State != kubecontainer.ContainerStateRunning {
+			continue
+		}
+		p := getPod(c.PodUID, c.PodName, c.PodNamespace)
+		p.Containers = append(p.Containers, c.toContainer())
+	}
+
+	result := make([]*kubecontainer.Pod, 0, len(pods))
+	for _, p := range pods {
+		result = append(result, p)
+	}
+	return result, nil
+}
+
+// GetPodStatus retrieves the status of the pod, including the
+// information of all containers in the pod that are visible in Runtime.
+// Sandboxes and containers are sorted newest first.
+func (m *processManager) GetPodStatus(uid types.UID, name, namespace string) (*kubecontainer.PodStatus, error) {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+
+	var sandboxes []*sandboxRecord
+	for _, s := range m.sandboxes {
+		if s.PodUID == uid {
+			sandboxes = append(sandboxes, s)
+		}
+	}
+	sort.Slice(sandboxes, func(i, j int) bool {
+		return sandboxes[i].CreatedAt.After(sandboxes[j].CreatedAt)
+	})
+
+	var containerStatuses []*kubecontainer.Status
+	for _, c := range m.containers {
+		if c.PodUID == uid {
+			containerStatuses = append(containerStatuses, c.toStatus())
+		}
+	}
+	sort.Sort(sort.Reverse(kubecontainer.SortContainerStatusesByCreationTime(containerStatuses)))
+
+	sandboxStatuses := make([]*runtimeapi.PodSandboxStatus, len(sandboxes))
+	podIPs := []string{}
+	for i, s := range sandboxes {
+		sandboxStatuses[i] = s.toStatus()
+		// Only get pod IP from latest sandbox
+		if i == 0 && s.State == runtimeapi.PodSandboxState_SANDBOX_READY {
+			podIPs = append(podIPs, m.sandboxIPs(s)...)
+		}
+	}
+
+	return &kubecontainer.PodStatus{
+		ID:                uid,
+		Name:              name,
+		Namespace:         namespace,
+		IPs:               podIPs,
+		ContainerStatuses: containerStatuses,
+		SandboxStatuses:   sandboxStatuses,
+	}, nil
+}
+
+// DeleteContainer removes a container. If the container is still running, an error is returned.
+func (m *processManager) DeleteContainer(containerID kubecontainer.ContainerID) error {
+	return m.removeContainer(containerID.ID)
+}
+
+// removeContainerLocked removes the record and the on-disk state of an exited container.
+// The caller must hold the lock.
+func (m *processManager) removeContainerLocked(id string) error {
+	c, ok := m.containers[id]
+	if !ok {
+		return nil
+	}
+	if c.State == kubecontainer.ContainerStateRunning {
+		return fmt.Errorf("container %q is still running", id)
+	}
+	// Remove the container log.
+	if err := m.removeContainerLog(c); err != nil {
+		return err
+	}
+	if err := m.store.removeContainer(id); err != nil {
+		return fmt.Errorf("failed to remove container %q: %v", id, err)
+	}
+	delete(m.containers, id)
+	return nil
+}
+
+// UpdatePodCIDR sets the comma separated pod CIDRs of the node the IPs of
+// new sandboxes are allocated from.
+func (m *processManager) UpdatePodCIDR(podCIDR string) error {
+	klog.InfoS("Updating the pod CIDRs IPs are allocated from", "CIDR", podCIDR)
+	return m.ipam.SetCIDRs(strings.Split(podCIDR, ","))
+}
+
+// podActions keeps information what to do for a pod.
+type podActions struct {
+	// Stop all running (regular, init and ephemeral) containers and the sandbox for the pod.
+	KillPod bool
+	// Whether need to create a new sandbox. If needed to kill pod and create
+	// a new pod sandbox, all init containers need to be purged (i.e., removed).
+	CreateSandbox bool
+	// The id of existing sandbox. It is used for starting containers in ContainersToStart.
+	SandboxID string
+	// The attempt number of creating sandboxes for the pod.
+	Attempt uint32
+
+	// The next init container to start.
+	NextInitContainerToStart *v1.Container
+	// ContainersToStart keeps a list of indexes for the containers to start,
+	// where the index is the index of the specific container in the pod spec (
+	// pod.Spec.Containers.
+	ContainersToStart []int
+	// ContainersToKill keeps a map of containers that need to be killed, note that
+	// the key is the container ID of the container, while
+	// the value contains necessary information to kill a container.
+	ContainersToKill map[kubecontainer.ContainerID]containerToKillInfo
+}
+
+// containerToKillInfo contains necessary information to kill a container.
+type containerToKillInfo struct {
+	// The spec of the container.
+	container *v1.Container
+	// The name of the container.
+	name string
+	// The message indicates why the container will be killed.
+	message string
+}
+
+// podSandboxChanged checks whether the spec of the pod is changed and returns
+// (changed, new attempt, original sandboxID if exist).
+func (m *processManager) podSandboxChanged(pod *v1.Pod, podStatus *kubecontainer.PodStatus) (bool, uint32, string) {
+	if len(podStatus.SandboxStatuses) == 0 {
+		klog.V(2).InfoS("No sandbox for pod can be found. Need to start a new one", "pod", klog.KObj(pod))
+		return true, 0, ""
+	}
+
+	readySandboxCount := 0
+	for _, s := range podStatus.SandboxStatuses {
+		if s.State == runtimeapi.PodSandboxState_SANDBOX_READY {
+			readySandboxCount++
+		}
+	}
+
+	// Needs to create a new sandbox when readySandboxCount > 1 or the ready sandbox is not the latest one.
+	sandboxStatus := podStatus.SandboxStatuses[0]
+	if readySandboxCount > 1 {
+		klog.V(2).InfoS("Multiple sandboxes are ready for Pod. Need to reconcile them", "pod", klog.KObj(pod))
+		return true, sandboxStatus.Metadata.Attempt + 1, sandboxStatus.Id
+	}
+	if sandboxStatus.State != runtimeapi.PodSandboxState_SANDBOX_READY {
+		klog.V(2).InfoS("No ready sandbox for pod can be found. Need to start a new one", "pod", klog.KObj(pod))
+		return true, sandboxStatus.Metadata.Attempt + 1, sandboxStatus.Id
+	}
+	return false, sandboxStatus.Metadata.Attempt, sandboxStatus.Id
+}
+
+// computePodActions checks whether the pod spec has changed and returns the changes if true.
+func (m *processManager) computePodActions(pod *v1.Pod, podStatus *kubecontainer.PodStatus) podActions {
+	klog.V(5).InfoS("Syncing Pod", "pod", klog.KObj(pod))
+
+	createPodSandbox, attempt, sandboxID := m.podSandboxChanged(pod, podStatus)
+	changes := podActions{
+		KillPod:           createPodSandbox,
+		CreateSandbox:     createPodSandbox,
+		SandboxID:         sandboxID,
+		Attempt:           attempt,
+		ContainersToStart: []int{},
+		ContainersToKill:  make(map[kubecontainer.ContainerID]containerToKillInfo),
+	}
+
+	// If we need to (re-)create the pod sandbox, everything will need to be
+	// killed and recreated, and init containers should be purged.
+	if createPodSandbox {
+		if !shouldRestartOnFailure(pod) && attempt != 0 && len(podStatus.ContainerStatuses) != 0 {
+			// Should not restart the pod, just return.
+			// we should not create a sandbox for a pod if it is already done.
+			// if all containers are done and should not be started, there is no need to create a new sandbox.
+			// this stops confusing logs on pods whose containers all have exit codes, but we recreate a sandbox before terminating it.
+			changes.CreateSandbox = false
+			return changes
+		}
+
+		// Start all containers by default but exclude the ones that succeeded if
+		// RestartPolicy is OnFailure.
+		var containersToStart []int
+		for idx, c := range pod.Spec.Containers {
+			if pod.Spec.RestartPolicy == v1.RestartPolicyOnFailure && containerSucceeded(&c, podStatus) {
+				continue
+			}
+			containersToStart = append(containersToStart, idx)
+		}
+		// We should not create a sandbox for a Pod if initialization is done and there is no container to start.
+		if len(containersToStart) == 0 {
+			_, _, done := findNextInitContainerToRun(pod, podStatus)
+			if done {
+				changes.CreateSandbox = false
+				return changes
+			}
+		}
+
+		if len(pod.Spec.InitContainers) != 0 {
+			// Pod has init containers, return the first one.
+			changes.NextInitContainerToStart = &pod.Spec.InitContainers[0]
+			return changes
+		}
+		changes.ContainersToStart = containersToStart
+		return changes
+	}
+
+	// Check initialization progress.
+	initLastStatus, next, done := findNextInitContainerToRun(pod, podStatus)
+	if !done {
+		if next != nil {
+			initFailed := initLastStatus != nil && isInitContainerFailed(initLastStatus)
+			if initFailed && !shouldRestartOnFailure(pod) {
+				changes.KillPod = true
+			} else {
+				// Always try to stop containers in unknown state first.
+				if initLastStatus != nil && initLastStatus.State == kubecontainer.ContainerStateUnknown {
+					changes.ContainersToKill[initLastStatus.ID] = containerToKillInfo{
+						name:      next.Name,
+						container: next,
+						message: fmt.Sprintf("Init container is in %q state, try killing it before restart",
+							initLastStatus.State),
+					}
+				}
+				changes.NextInitContainerToStart = next
+			}
+		}
+		// Initialization failed or still in progress. Skip inspecting non-init
+		// containers.
+		return changes
+	}
+
+	// Number of running containers to keep.
+	keepCount := 0
+	for idx, container := range pod.Spec.Containers {
+		containerStatus := podStatus.FindContainerStatusByName(container.Name)
+
+		// If container does not exist, or is not running, check whether we
+		// need to restart it.
+		if containerStatus == nil || containerStatus.State != kubecontainer.ContainerStateRunning {
+			if kubecontainer.ShouldContainerBeRestarted(&container, pod, podStatus) {
+				klog.V(3).InfoS("Container of pod is not in the desired state and shall be started", "containerName", container.Name, "pod", klog.KObj(pod))
+				changes.ContainersToStart = append(changes.ContainersToStart, idx)
+			}
+			continue
+		}
+
+		// The container is running, but kill the container if any of the following condition is met.
+		var message string
+		restart := shouldRestartOnFailure(pod)
+		if expectedHash := kubecontainer.HashContainer(&container); containerStatus.Hash != expectedHash {
+			message = fmt.Sprintf("Container %s definition changed", container.Name)
+			// Restart regardless of the restart policy because the container
+			// spec changed.
+			restart = true
+		} else {
+			// Keep the container.
+			keepCount++
+			continue
+		}
+
+		// We need to kill the container, but if we also want to restart the
+		// container afterwards, make the intent clear in the message. Also do
+		// not kill the container if the restart policy is Never.
+		if restart {
+			message = fmt.Sprintf("%s, will be restarted", message)
+			changes.ContainersToStart = append(changes.ContainersToStart, idx)
+		}
+
+		changes.ContainersToKill[containerStatus.ID] = containerToKillInfo{
+			name:      containerStatus.Name,
+			container: &pod.Spec.Containers[idx],
+			message:   message,
+		}
+		klog.V(2).InfoS("Message for Container of pod", "containerName", container.Name, "containerStatusID", containerStatus.ID, "pod", klog.KObj(pod), "containerMessage", message)
+	}
+
+	if keepCount == 0 && len(changes.ContainersToStart) == 0 {
+		changes.KillPod = true
+	}
+	return changes
+}
+
+// SyncPod syncs the running pod into the desired pod by executing following steps:
+//
+//  1. Compute sandbox and container changes.
+//  2. Kill pod sandbox if necessary.
+//  3. Kill any containers that should not be running.
+//  4. Create sandbox if necessary.
+//  5. Start the next init container.
+//  6. Start non-init containers.
+func (m *processManager) SyncPod(pod *v1.Pod, podStatus *kubecontainer.PodStatus, pullSecrets []v1.Secret, backOff *flowcontrol.Backoff) (result kubecontainer.PodSyncResult) {
+	// Step 1: Compute sandbox and container changes.
+	podContainerChanges := m.computePodActions(pod, podStatus)
+	klog.V(3).InfoS("computePodActions got for pod", "podActions", podContainerChanges, "pod", klog.KObj(pod))
+	if podContainerChanges.CreateSandbox {
+		if podContainerChanges.SandboxID != "" {
+			klog.V(4).InfoS("Stopping PodSandbox for pod, will start new one", "pod", klog.KObj(pod))
+		} else {
+			klog.V(4).InfoS("SyncPod received new pod, will create a sandbox for it", "pod", klog.KObj(pod))
+		}
+	}
+
+	// Step 2: Kill the pod if the sandbox has changed.
+	if podContainerChanges.KillPod {
+		if podContainerChanges.CreateSandbox {
+			klog.V(4).InfoS("Stopping PodSandbox for pod, will start new one", "pod", klog.KObj(pod))
+		} else {
+			klog.V(4).InfoS("Stopping PodSandbox for pod, because all other containers are dead", "pod", klog.KObj(pod))
+		}
+
+		killResult := m.killPodWithSyncResult(pod, kubecontainer.ConvertPodStatusToRunningPod(m.Type(), podStatus), nil)
+		result.AddPodSyncResult(killResult)
+		if killResult.Error() != nil {
+			klog.ErrorS(killResult.Error(), "killPodWithSyncResult failed")
+			return
+		}
+
+		if podContainerChanges.CreateSandbox {
+			m.purgeInitContainers(pod, podStatus)
+		}
+	} else {
+		// Step 3: kill any running containers in this pod which are not to keep.
+		for containerID, containerInfo := range podContainerChanges.ContainersToKill {
+			klog.V(3).InfoS("Killing unwanted container for pod", "containerName", containerInfo.name, "containerID", containerID, "pod", klog.KObj(pod))
+			killContainerResult := kubecontainer.NewSyncResult(kubecontainer.KillContainer, containerInfo.name)
+			result.AddSyncResult(killContainerResult)
+			if err := m.killContainer(pod, containerID, containerInfo.name, containerInfo.message, nil); err != nil {
+				killContainerResult.Fail(kubecontainer.ErrKillContainer, err.Error())
+				klog.ErrorS(err, "killContainer for pod failed", "containerName", containerInfo.name, "containerID", containerID, "pod", klog.KObj(pod))
+				return
+			}
+		}
+	}
+
+	// Keep terminated init containers fairly aggressively controlled
+	// This is an optimization because container removals are typically handled
+	// by container garbage collector.
+	m.pruneInitContainersBeforeStart(pod, podStatus)
+
+	// Step 4: Create a sandbox for the pod if necessary.
+	podSandboxID := podContainerChanges.SandboxID
+	if podContainerChanges.CreateSandbox {
+		createSandboxResult := kubecontainer.NewSyncResult(kubecontainer.CreatePodSandbox, format.Pod(pod))
+		result.AddSyncResult(createSandboxResult)
+		var err error
+		podSandboxID, err = m.createPodSandbox(pod, podContainerChanges.Attempt)
+		if err != nil {
+			createSandboxResult.Fail(kubecontainer.ErrCreatePodSandbox, err.Error())
+			klog.ErrorS(err, "CreatePodSandbox for pod failed", "pod", klog.KObj(pod))
+			m.recorder.Eventf(pod, v1.EventTypeWarning, events.FailedCreatePodSandBox, "Failed to create pod sandbox: %v", err)
+			return
+		}
+		klog.V(4).InfoS("Created PodSandbox for pod", "podSandboxID", podSandboxID, "pod", klog.KObj(pod))
+
+		if s, ok := m.getSandbox(podSandboxID); ok && s.hasPodNetwork() {
+			setupNetworkResult := kubecontainer.NewSyncResult(kubecontainer.SetupNetwork, format.Pod(pod))
+			result.AddSyncResult(setupNetworkResult)
+			if err := m.setUpPodNetwork(podSandboxID); err != nil {
+				setupNetworkResult.Fail(kubecontainer.ErrSetupNetwork, err.Error())
+				klog.ErrorS(err, "Failed to set up the network of pod sandbox", "podSandboxID", podSandboxID, "pod", klog.KObj(pod))
+				m.recorder.Eventf(pod, v1.EventTypeWarning, events.FailedCreatePodSandBox, "Failed to create pod sandbox: failed to set up network: %v", err)
+				// A sandbox without its network is of no use, the next sync
+				// creates a new one.
+				if err := m.tearDownPodNetwork(podSandboxID); err != nil {
+					klog.ErrorS(err, "Failed to tear down the network of pod sandbox", "podSandboxID", podSandboxID)
+				}
+				if err := m.stopPodSandbox(podSandboxID); err != nil {
+					klog.ErrorS(err, "Failed to stop sandbox", "podSandboxID", podSandboxID)
+				}
+				return
+			}
+		}
+
+		// Overwrite the podIPs passed in the pod status, since we just started the pod sandbox.
+		if s, ok := m.getSandbox(podSandboxID); ok {
+			if ips := m.sandboxIPs(s); len(ips) != 0 {
+				podStatus.IPs = ips
+				klog.V(4).InfoS("Determined the ip for pod after sandbox changed", "IPs", podStatus.IPs, "pod", klog.KObj(pod))
+			}
+		}
+	}
+
+	// Helper containing boilerplate common to starting all types of containers.
+	// typeName is a description used to describe this type of container in log messages,
+	// currently: "container" or "init container".
+	start := func(typeName string, container *v1.Container) error {
+		startContainerResult := kubecontainer.NewSyncResult(kubecontainer.StartContainer, container.Name)
+		result.AddSyncResult(startContainerResult)
+
+		isInBackOff, msg, err := m.doBackOff(pod, container, podStatus, backOff)
+		if isInBackOff {
+			startContainerResult.Fail(err, msg)
+			klog.V(4).InfoS("Backing Off restarting container in pod", "containerType", typeName, "container", container, "pod", klog.KObj(pod))
+			return err
+		}
+
+		klog.V(4).InfoS("Creating container in pod", "containerType", typeName, "container", container, "pod", klog.KObj(pod))
+		if msg, err := m.startContainer(podSandboxID, pod, container, podStatus, pullSecrets); err != nil {
+			startContainerResult.Fail(err, msg)
+			// known errors that are logged in other places are logged at higher levels here to avoid
+			// repetitive log spam
+			switch {
+			case err == images.ErrImagePullBackOff:
+				klog.V(3).InfoS("Container start failed in pod", "containerType", typeName, "containerName", container.Name, "pod", klog.KObj(pod), "containerMessage", msg, "err", err)
+			case err == kubecontainer.ErrRunContainer:
+				klog.V(3).InfoS("Container start failed in pod", "containerType", typeName, "containerName", container.Name, "pod", klog.KObj(pod), "containerMessage", msg, "err", err)
+			default:
+				utilruntime.HandleError(fmt.Errorf("%v %+v start failed in pod %v: %v: %s", typeName, container, format.Pod(pod), err, msg))
+			}
+			return err
+		}
+
+		return nil
+	}
+
+	// Step 5: start the init container.
+	if container := podContainerChanges.NextInitContainerToStart; container != nil {
+		// Start the next init container.
+		if err := start("init container", container); err != nil {
+			return
+		}
+
+		// Successfully started the container; clear the entry in the failure
+		klog.V(4).InfoS("Completed init container for pod", "containerName", container.Name, "pod", klog.KObj(pod))
+	}
+
+	// Step 6: start containers in podContainerChanges.ContainersToStart.
+	for _, idx := range podContainerChanges.ContainersToStart {
+		start("container", &pod.Spec.Containers[idx])
+	}
+
+	return
+}
+
+// KillPod kills all the containers of a pod. Pod may be nil, running pod must not be.
+// gracePeriodOverride if specified allows the caller to override the pod default grace period.
+func (m *processManager) KillPod(pod *v1.Pod, runningPod kubecontainer.Pod, gracePeriodOverride *int64) error {
+	err := m.killPodWithSyncResult(pod, runningPod, gracePeriodOverride)
+	return err.Error()
+}
+
+// killPodWithSyncResult kills a runningPod and returns SyncResult.
+func (m *processManager) killPodWithSyncResult(pod *v1.Pod, runningPod kubecontainer.Pod, gracePeriodOverride *int64) (result kubecontainer.PodSyncResult) {
+	killContainerResults := m.killContainersWithSyncResult(pod, runningPod, gracePeriodOverride)
+	for _, containerResult := range killContainerResults {
+		result.AddSyncResult(containerResult)
+	}
+
+	// Stop all sandboxes belongs to same pod
+	for _, podSandbox := range runningPod.Sandboxes {
+		teardownNetworkResult := kubecontainer.NewSyncResult(kubecontainer.TeardownNetwork, runningPod.ID)
+		result.AddSyncResult(teardownNetworkResult)
+		if err := m.tearDownPodNetwork(podSandbox.ID.ID); err != nil {
+			teardownNetworkResult.Fail(kubecontainer.ErrTeardownNetwork, err.Error())
+			klog.ErrorS(err, "Failed to tear down the network of sandbox", "podSandboxID", podSandbox.ID)
+		}
+		killSandboxResult := kubecontainer.NewSyncResult(kubecontainer.KillPodSandbox, runningPod.ID)
+		result.AddSyncResult(killSandboxResult)
+		if err := m.stopPodSandbox(podSandbox.ID.ID); err != nil {
+			killSandboxResult.Fail(kubecontainer.ErrKillPodSandbox, err.Error())
+			klog.ErrorS(nil, "Failed to stop sandbox", "podSandboxID", podSandbox.ID)
+		}
+	}
+
+	return
+}
+
+// killContainersWithSyncResult kills all pod's containers with sync results.
+func (m *processManager) killContainersWithSyncResult(pod *v1.Pod, runningPod kubecontainer.Pod, gracePeriodOverride *int64) (syncResults []*kubecontainer.SyncResult) {
+	containerResults := make(chan *kubecontainer.SyncResult, len(runningPod.Containers))
+	wg := sync.WaitGroup{}
+
+	wg.Add(len(runningPod.Containers))
+	for _, container := range runningPod.Containers {
+		go func(container *kubecontainer.Container) {
+			defer wg.Done()
+
+			killContainerResult := kubecontainer.NewSyncResult(kubecontainer.KillContainer, container.Name)
+			if err := m.killContainer(pod, container.ID, container.Name, "", gracePeriodOverride); err != nil {
+				killContainerResult.Fail(kubecontainer.ErrKillContainer, err.Error())
+				// Use runningPod for logging as the pod passed in could be *nil*.
+				klog.ErrorS(err, "Kill container failed", "pod", klog.KRef(runningPod.Namespace, runningPod.Name), "podUID", runningPod.ID,
+					"containerName", container.Name, "containerID", container.ID)
+			}
+			containerResults <- killContainerResult
+		}(container)
+	}
+	wg.Wait()
+	close(containerResults)
+
+	for containerResult := range containerResults {
+		syncResults = append(syncResults, containerResult)
+	}
+	return
+}
@@ -0,0 +1,963 @@
+package process
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/xuliangTang/mykubelet/pkg/api/legacyscheme"
+	apisv1 "github.com/xuliangTang/mykubelet/pkg/apis/core/v1"
+	kubecontainer "github.com/xuliangTang/mykubelet/pkg/kubelet/container"
+	"github.com/xuliangTang/mykubelet/pkg/kubelet/logs"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/client-go/util/flowcontrol"
+	runtimeapi "k8s.io/cri-api/pkg/apis/runtime/v1alpha2"
+)
+
+func init() {
+	// Events refer to the pod, whose kind is looked up in the scheme.
+	if err := apisv1.AddToScheme(legacyscheme.Scheme); err != nil {
+		panic(err)
+	}
+}
+
+type fakeRuntimeHelper struct {
+	podDir    string
+	envs      []kubecontainer.EnvVar
+	dnsConfig *runtimeapi.DNSConfig
+}
+
+func (h *fakeRuntimeHelper) GenerateRunContainerOptions(pod *v1.Pod, container *v1.Container, podIP string, podIPs []string) (*kubecontainer.RunContainerOptions, func(), error) {
+	return &kubecontainer.RunContainerOptions{Envs: h.envs}, nil, nil
+}
+
+func (h *fakeRuntimeHelper) GetPodDNS(pod *v1.Pod) (*runtimeapi.DNSConfig, error) {
+	if h.dnsConfig == nil {
+		return &runtimeapi.DNSConfig{}, nil
+	}
+	return h.dnsConfig, nil
+}
+
+func (h *fakeRuntimeHelper) GetPodCgroupParent(pod *v1.Pod) string {
+	return ""
+}
+
+func (h *fakeRuntimeHelper) GetPodDir(podUID types.UID) string {
+	return filepath.Join(h.podDir, string(podUID))
+}
+
+func (h *fakeRuntimeHelper) GeneratePodHostNameAndDomain(pod *v1.Pod) (string, string, error) {
+	return pod.Name, "", nil
+}
+
+func (h *fakeRuntimeHelper) GetExtraSupplementalGroupsForPod(pod *v1.Pod) []int64 {
+	return nil
+}
+
+type fakePodStateProvider struct{}
+
+func (fakePodStateProvider) ShouldPodContentBeRemoved(types.UID) bool { return false }
+func (fakePodStateProvider) ShouldPodRuntimeBeRemoved(types.UID) bool { return false }
+
+var testNodeIP = net.ParseIP("192.168.0.10")
+
+// newTestManager returns a process runtime running the containers of pods
+// as plain processes of the host, without cgroups nor namespaces.
+func newTestManager(t *testing.T) (*processManager, *record.FakeRecorder) {
+	t.Helper()
+	dir := t.TempDir()
+	recorder := record.NewFakeRecorder(100)
+	nodeIPs := func() ([]net.IP, error) { return []net.IP{testNodeIP}, nil }
+	runtime, err := NewProcessRuntimeManager(filepath.Join(dir, "state"), filepath.Join(dir, "pods"), logs.LogRotatePolicy{MaxSize: -1},
+		&fakeRuntimeHelper{podDir: filepath.Join(dir, "kubelet")}, fakePodStateProvider{}, recorder, false, nil, nodeIPs,
+		flowcontrol.NewBackOff(time.Second, time.Minute))
+	if err != nil {
+		t.Fatalf("failed to create the runtime manager: %v", err)
+	}
+	m := runtime.(*processManager)
+	t.Cleanup(func() { killAllContainers(m) })
+	return m, recorder
+}
+
+// killAllContainers kills the processes left running by a test.
+func killAllContainers(m *processManager) {
+	m.lock.RLock()
+	var records []*containerRecord
+	for _, c := range m.containers {
+		records = append(records, c)
+	}
+	m.lock.RUnlock()
+	for _, c := range records {
+		m.stopContainer(nil, nil, c, 0)
+	}
+}
+
+// shellContainer returns a container running script with /bin/sh.
+func shellContainer(name, script string) v1.Container {
+	return v1.Container{Name: name, Image: "busybox", Command: []string{"/bin/sh", "-c", script}}
+}
+
+func makeTestPod(containers ...v1.Container) *v1.Pod {
+	return &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			UID:       "12345678",
+			Name:      "foo",
+			Namespace: "new",
+		},
+		Spec: v1.PodSpec{
+			Containers:    containers,
+			RestartPolicy: v1.RestartPolicyAlways,
+		},
+	}
+}
+
+// syncTestPod syncs the pod from its current status in the runtime.
+func syncTestPod(t *testing.T, m *processManager, pod *v1.Pod, backOff *flowcontrol.Backoff) *kubecontainer.PodSyncResult {
+	t.Helper()
+	result := m.SyncPod(pod, getTestPodStatus(t, m, pod), nil, backOff)
+	return &result
+}
+
+func getTestPodStatus(t *testing.T, m *processManager, pod *v1.Pod) *kubecontainer.PodStatus {
+	t.Helper()
+	podStatus, err := m.GetPodStatus(pod.UID, pod.Name, pod.Namespace)
+	if err != nil {
+		t.Fatalf("failed to get pod status: %v", err)
+	}
+	return podStatus
+}
+
+// waitForContainerState waits until the latest instance of the container is
+// in the given state, and returns its status.
+func waitForContainerState(t *testing.T, m *processManager, pod *v1.Pod, name string, state kubecontainer.State) *kubecontainer.Status {
+	t.Helper()
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		status := getTestPodStatus(t, m, pod).FindContainerStatusByName(name)
+		if status != nil && status.State == state {
+			return status
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("container %q did not reach state %q, got %+v", name, state, status)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// waitForContainerLog waits until the log file at path has the stdout line.
+func waitForContainerLog(t *testing.T, path, line string) {
+	t.Helper()
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		data, _ := os.ReadFile(path)
+		if strings.Contains(string(data), " stdout F "+line+"\n") {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("expected %q in the log of the container, got %q", line, data)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// drainEvents returns the reasons of the events recorded so far.
+func drainEvents(recorder *record.FakeRecorder) []string {
+	var reasons []string
+	for {
+		select {
+		case event := <-recorder.Events:
+			// Events are formatted as "<type> <reason> <message>".
+			reasons = append(reasons, strings.Fields(event)[1])
+		default:
+			return reasons
+		}
+	}
+}
+
+func hasString(list []string, s string) bool {
+	for _, l := range list {
+		if l == s {
+			return true
+		}
+	}
+	return false
+}
+
+// testSandbox returns the status of a sandbox of the test pod.
+func testSandbox(id string, state runtimeapi.PodSandboxState, attempt uint32) *runtimeapi.PodSandboxStatus {
+	return &runtimeapi.PodSandboxStatus{
+		Id:       id,
+		State:    state,
+		Metadata: &runtimeapi.PodSandboxMetadata{Attempt: attempt},
+	}
+}
+
+// testContainerStatus returns the status of an instance of container.
+func testContainerStatus(container *v1.Container, id string, state kubecontainer.State, exitCode int) *kubecontainer.Status {
+	return &kubecontainer.Status{
+		ID:       buildContainerID(id),
+		Name:     container.Name,
+		State:    state,
+		ExitCode: exitCode,
+		Hash:     kubecontainer.HashContainer(container),
+	}
+}
+
+func TestComputePodActions(t *testing.T) {
+	m, _ := newTestManager(t)
+	ready := runtimeapi.PodSandboxState_SANDBOX_READY
+	notReady := runtimeapi.PodSandboxState_SANDBOX_NOTREADY
+	running := kubecontainer.ContainerStateRunning
+	exited := kubecontainer.ContainerStateExited
+
+	for desc, test := range map[string]struct {
+		restartPolicy v1.RestartPolicy
+		// status returns the status of the pod with the containers foo1,
+		// foo2 and foo3.
+		status   func(c []v1.Container) *kubecontainer.PodStatus
+		mutate   func(pod *v1.Pod)
+		expected podActions
+		// toKill are the indexes of the containers expected to be killed.
+		toKill []int
+	}{
+		"new pod": {
+			status: func(c []v1.Container) *kubecontainer.PodStatus {
+				return &kubecontainer.PodStatus{}
+			},
+			expected: podActions{KillPod: true, CreateSandbox: true, ContainersToStart: []int{0, 1, 2}},
+		},
+		"all containers running": {
+			status: func(c []v1.Container) *kubecontainer.PodStatus {
+				return &kubecontainer.PodStatus{
+					SandboxStatuses: []*runtimeapi.PodSandboxStatus{testSandbox("s", ready, 0)},
+					ContainerStatuses: []*kubecontainer.Status{
+						testContainerStatus(&c[0], "c0", running, 0),
+						testContainerStatus(&c[1], "c1", running, 0),
+						testContainerStatus(&c[2], "c2", running, 0),
+					},
+				}
+			},
+			expected: podActions{SandboxID: "s", ContainersToStart: []int{}},
+		},
+		"sandbox not ready": {
+			status: func(c []v1.Container) *kubecontainer.PodStatus {
+				return &kubecontainer.PodStatus{
+					SandboxStatuses: []*runtimeapi.PodSandboxStatus{testSandbox("s", notReady, 2)},
+					ContainerStatuses: []*kubecontainer.Status{
+						testContainerStatus(&c[0], "c0", running, 0),
+					},
+				}
+			},
+			expected: podActions{KillPod: true, CreateSandbox: true, SandboxID: "s", Attempt: 3, ContainersToStart: []int{0, 1, 2}},
+		},
+		"multiple ready sandboxes": {
+			status: func(c []v1.Container) *kubecontainer.PodStatus {
+				return &kubecontainer.PodStatus{
+					SandboxStatuses: []*runtimeapi.PodSandboxStatus{testSandbox("s2", ready, 1), testSandbox("s1", ready, 0)},
+				}
+			},
+			expected: podActions{KillPod: true, CreateSandbox: true, SandboxID: "s2", Attempt: 2, ContainersToStart: []int{0, 1, 2}},
+		},
+		"sandbox not ready and all containers done with restartPolicy Never": {
+			restartPolicy: v1.RestartPolicyNever,
+			status: func(c []v1.Container) *kubecontainer.PodStatus {
+				return &kubecontainer.PodStatus{
+					SandboxStatuses: []*runtimeapi.PodSandboxStatus{testSandbox("s", notReady, 0)},
+					ContainerStatuses: []*kubecontainer.Status{
+						testContainerStatus(&c[0], "c0", exited, 0),
+						testContainerStatus(&c[1], "c1", exited, 1),
+						testContainerStatus(&c[2], "c2", exited, 0),
+					},
+				}
+			},
+			expected: podActions{KillPod: true, SandboxID: "s", Attempt: 1, ContainersToStart: []int{}},
+		},
+		"sandbox not ready with restartPolicy OnFailure skips succeeded containers": {
+			restartPolicy: v1.RestartPolicyOnFailure,
+			status: func(c []v1.Container) *kubecontainer.PodStatus {
+				return &kubecontainer.PodStatus{
+					SandboxStatuses: []*runtimeapi.PodSandboxStatus{testSandbox("s", notReady, 0)},
+					ContainerStatuses: []*kubecontainer.Status{
+						testContainerStatus(&c[0], "c0", exited, 0),
+						testContainerStatus(&c[1], "c1", exited, 1),
+					},
+				}
+			},
+			expected: podActions{KillPod: true, CreateSandbox: true, SandboxID: "s", Attempt: 1, ContainersToStart: []int{1, 2}},
+		},
+		"sandbox not ready and all containers succeeded with restartPolicy OnFailure": {
+			restartPolicy: v1.RestartPolicyOnFailure,
+			status: func(c []v1.Container) *kubecontainer.PodStatus {
+				return &kubecontainer.PodStatus{
+					SandboxStatuses: []*runtimeapi.PodSandboxStatus{testSandbox("s", notReady, 0)},
+					ContainerStatuses: []*kubecontainer.Status{
+						testContainerStatus(&c[0], "c0", exited, 0),
+						testContainerStatus(&c[1], "c1", exited, 0),
+						testContainerStatus(&c[2], "c2", exited, 0),
+					},
+				}
+			},
+			expected: podActions{KillPod: true, SandboxID: "s", Attempt: 1, ContainersToStart: []int{}},
+		},
+		"succeeded container restarted with restartPolicy Always": {
+			status: func(c []v1.Container) *kubecontainer.PodStatus {
+				return &kubecontainer.PodStatus{
+					SandboxStatuses: []*runtimeapi.PodSandboxStatus{testSandbox("s", ready, 0)},
+					ContainerStatuses: []*kubecontainer.Status{
+						testContainerStatus(&c[0], "c0", running, 0),
+						testContainerStatus(&c[1], "c1", exited, 0),
+						testContainerStatus(&c[2], "c2", running, 0),
+					},
+				}
+			},
+			expected: podActions{SandboxID: "s", ContainersToStart: []int{1}},
+		},
+		"failed container restarted with restartPolicy OnFailure": {
+			restartPolicy: v1.RestartPolicyOnFailure,
+			status: func(c []v1.Container) *kubecontainer.PodStatus {
+				return &kubecontainer.PodStatus{
+					SandboxStatuses: []*runtimeapi.PodSandboxStatus{testSandbox("s", ready, 0)},
+					ContainerStatuses: []*kubecontainer.Status{
+						testContainerStatus(&c[0], "c0", running, 0),
+						testContainerStatus(&c[1], "c1", exited, 0),
+						testContainerStatus(&c[2], "c2", exited, 2),
+					},
+				}
+			},
+			expected: podActions{SandboxID: "s", ContainersToStart: []int{2}},
+		},
+		"exited containers not restarted with restartPolicy Never": {
+			restartPolicy: v1.RestartPolicyNever,
+			status: func(c []v1.Container) *kubecontainer.PodStatus {
+				return &kubecontainer.PodStatus{
+					SandboxStatuses: []*runtimeapi.PodSandboxStatus{testSandbox("s", ready, 0)},
+					ContainerStatuses: []*kubecontainer.Status{
+						testContainerStatus(&c[0], "c0", running, 0),
+						testContainerStatus(&c[1], "c1", exited, 0),
+						testContainerStatus(&c[2], "c2", exited, 2),
+					},
+				}
+			},
+			expected: podActions{SandboxID: "s", ContainersToStart: []int{}},
+		},
+		"pod killed once no container is left to run": {
+			restartPolicy: v1.RestartPolicyNever,
+			status: func(c []v1.Container) *kubecontainer.PodStatus {
+				return &kubecontainer.PodStatus{
+					SandboxStatuses: []*runtimeapi.PodSandboxStatus{testSandbox("s", ready, 0)},
+					ContainerStatuses: []*kubecontainer.Status{
+						testContainerStatus(&c[0], "c0", exited, 0),
+						testContainerStatus(&c[1], "c1", exited, 0),
+						testContainerStatus(&c[2], "c2", exited, 2),
+					},
+				}
+			},
+			expected: podActions{KillPod: true, SandboxID: "s", ContainersToStart: []int{}},
+		},
+		"deleted pod not restarted": {
+			status: func(c []v1.Container) *kubecontainer.PodStatus {
+				return &kubecontainer.PodStatus{
+					SandboxStatuses: []*runtimeapi.PodSandboxStatus{testSandbox("s", ready, 0)},
+					ContainerStatuses: []*kubecontainer.Status{
+						testContainerStatus(&c[0], "c0", running, 0),
+						testContainerStatus(&c[1], "c1", exited, 1),
+						testContainerStatus(&c[2], "c2", running, 0),
+					},
+				}
+			},
+			mutate: func(pod *v1.Pod) {
+				now := metav1.Now()
+				pod.DeletionTimestamp = &now
+			},
+			expected: podActions{SandboxID: "s", ContainersToStart: []int{}},
+		},
+		"changed container killed and restarted": {
+			restartPolicy: v1.RestartPolicyNever,
+			status: func(c []v1.Container) *kubecontainer.PodStatus {
+				changed := testContainerStatus(&c[1], "c1", running, 0)
+				changed.Hash++
+				return &kubecontainer.PodStatus{
+					SandboxStatuses: []*runtimeapi.PodSandboxStatus{testSandbox("s", ready, 0)},
+					ContainerStatuses: []*kubecontainer.Status{
+						testContainerStatus(&c[0], "c0", running, 0),
+						changed,
+						testContainerStatus(&c[2], "c2", running, 0),
+					},
+				}
+			},
+			expected: podActions{SandboxID: "s", ContainersToStart: []int{1}},
+			toKill:   []int{1},
+		},
+	} {
+		t.Run(desc, func(t *testing.T) {
+			pod := makeTestPod(shellContainer("foo1", "true"), shellContainer("foo2", "true"), shellContainer("foo3", "true"))
+			if test.restartPolicy != "" {
+				pod.Spec.RestartPolicy = test.restartPolicy
+			}
+			if test.mutate != nil {
+				test.mutate(pod)
+			}
+			status := test.status(pod.Spec.Containers)
+			actions := m.computePodActions(pod, status)
+
+			expected := test.expected
+			expected.ContainersToKill = make(map[kubecontainer.ContainerID]containerToKillInfo)
+			for _, idx := range test.toKill {
+				c := &pod.Spec.Containers[idx]
+				expected.ContainersToKill[status.FindContainerStatusByName(c.Name).ID] = containerToKillInfo{
+					name:      c.Name,
+					container: c,
+					message:   actions.ContainersToKill[status.FindContainerStatusByName(c.Name).ID].message,
+				}
+			}
+			if !reflect.DeepEqual(actions, expected) {
+				t.Errorf("expected %+v, got %+v", expected, actions)
+			}
+		})
+	}
+}
+
+func TestComputePodActionsWithInitContainers(t *testing.T) {
+	m, _ := newTestManager(t)
+	ready := runtimeapi.PodSandboxState_SANDBOX_READY
+	notReady := runtimeapi.PodSandboxState_SANDBOX_NOTREADY
+	running := kubecontainer.ContainerStateRunning
+	exited := kubecontainer.ContainerStateExited
+	unknown := kubecontainer.ContainerStateUnknown
+
+	for desc, test := range map[string]struct {
+		restartPolicy v1.RestartPolicy
+		// status returns the status of the pod with the init containers
+		// init1 and init2, and the container foo1.
+		status func(init, c []v1.Container) *kubecontainer.PodStatus
+		// nextInit is the index of the init container expected to start
+		// next, -1 for none.
+		nextInit int
+		expected podActions
+		// killInit are the indexes of the init containers expected to be killed.
+		killInit []int
+	}{
+		"new pod starts the first init container": {
+			status: func(init, c []v1.Container) *kubecontainer.PodStatus {
+				return &kubecontainer.PodStatus{}
+			},
+			nextInit: 0,
+			expected: podActions{KillPod: true, CreateSandbox: true, ContainersToStart: []int{}},
+		},
+		"running init container": {
+			status: func(init, c []v1.Container) *kubecontainer.PodStatus {
+				return &kubecontainer.PodStatus{
+					SandboxStatuses:   []*runtimeapi.PodSandboxStatus{testSandbox("s", ready, 0)},
+					ContainerStatuses: []*kubecontainer.Status{testContainerStatus(&init[0], "i0", running, 0)},
+				}
+			},
+			nextInit: -1,
+			expected: podActions{SandboxID: "s", ContainersToStart: []int{}},
+		},
+		"succeeded init container starts the next one": {
+			status: func(init, c []v1.Container) *kubecontainer.PodStatus {
+				return &kubecontainer.PodStatus{
+					SandboxStatuses:   []*runtimeapi.PodSandboxStatus{testSandbox("s", ready, 0)},
+					ContainerStatuses: []*kubecontainer.Status{testContainerStatus(&init[0], "i0", exited, 0)},
+				}
+			},
+			nextInit: 1,
+			expected: podActions{SandboxID: "s", ContainersToStart: []int{}},
+		},
+		"all init containers succeeded": {
+			status: func(init, c []v1.Container) *kubecontainer.PodStatus {
+				return &kubecontainer.PodStatus{
+					SandboxStatuses: []*runtimeapi.PodSandboxStatus{testSandbox("s", ready, 0)},
+					ContainerStatuses: []*kubecontainer.Status{
+						testContainerStatus(&init[1], "i1", exited, 0),
+						testContainerStatus(&init[0], "i0", exited, 0),
+					},
+				}
+			},
+			nextInit: -1,
+			expected: podActions{SandboxID: "s", ContainersToStart: []int{0}},
+		},
+		"failed init container restarted": {
+			status: func(init, c []v1.Container) *kubecontainer.PodStatus {
+				return &kubecontainer.PodStatus{
+					SandboxStatuses: []*runtimeapi.PodSandboxStatus{testSandbox("s", ready, 0)},
+					ContainerStatuses: []*kubecontainer.Status{
+						testContainerStatus(&init[1], "i1", exited, 1),
+						testContainerStatus(&init[0], "i0", exited, 0),
+					},
+				}
+			},
+			nextInit: 1,
+			expected: podActions{SandboxID: "s", ContainersToStart: []int{}},
+		},
+		"failed init container with restartPolicy Never kills the pod": {
+			restartPolicy: v1.RestartPolicyNever,
+			status: func(init, c []v1.Container) *kubecontainer.PodStatus {
+				return &kubecontainer.PodStatus{
+					SandboxStatuses:   []*runtimeapi.PodSandboxStatus{testSandbox("s", ready, 0)},
+					ContainerStatuses: []*kubecontainer.Status{testContainerStatus(&init[0], "i0", exited, 1)},
+				}
+			},
+			nextInit: -1,
+			expected: podActions{KillPod: true, SandboxID: "s", ContainersToStart: []int{}},
+		},
+		"init container in unknown state killed and restarted": {
+			status: func(init, c []v1.Container) *kubecontainer.PodStatus {
+				return &kubecontainer.PodStatus{
+					SandboxStatuses:   []*runtimeapi.PodSandboxStatus{testSandbox("s", ready, 0)},
+					ContainerStatuses: []*kubecontainer.Status{testContainerStatus(&init[0], "i0", unknown, 0)},
+				}
+			},
+			nextInit: 0,
+			expected: podActions{SandboxID: "s", ContainersToStart: []int{}},
+			killInit: []int{0},
+		},
+		"running container means the init containers are done": {
+			status: func(init, c []v1.Container) *kubecontainer.PodStatus {
+				return &kubecontainer.PodStatus{
+					SandboxStatuses:   []*runtimeapi.PodSandboxStatus{testSandbox("s", ready, 0)},
+					ContainerStatuses: []*kubecontainer.Status{testContainerStatus(&c[0], "c0", running, 0)},
+				}
+			},
+			nextInit: -1,
+			expected: podActions{SandboxID: "s", ContainersToStart: []int{}},
+		},
+		"new sandbox restarts the init containers": {
+			status: func(init, c []v1.Container) *kubecontainer.PodStatus {
+				return &kubecontainer.PodStatus{
+					SandboxStatuses: []*runtimeapi.PodSandboxStatus{testSandbox("s", notReady, 0)},
+					ContainerStatuses: []*kubecontainer.Status{
+						testContainerStatus(&c[0], "c0", exited, 1),
+						testContainerStatus(&init[1], "i1", exited, 0),
+						testContainerStatus(&init[0], "i0", exited, 0),
+					},
+				}
+			},
+			nextInit: 0,
+			expected: podActions{KillPod: true, CreateSandbox: true, SandboxID: "s", Attempt: 1, ContainersToStart: []int{}},
+		},
+		"new sandbox without container to start": {
+			restartPolicy: v1.RestartPolicyOnFailure,
+			status: func(init, c []v1.Container) *kubecontainer.PodStatus {
+				return &kubecontainer.PodStatus{
+					SandboxStatuses: []*runtimeapi.PodSandboxStatus{testSandbox("s", notReady, 0)},
+					ContainerStatuses: []*kubecontainer.Status{
+						testContainerStatus(&c[0], "c0", exited, 0),
+						testContainerStatus(&init[1], "i1", exited, 0),
+						testContainerStatus(&init[0], "i0", exited, 0),
+					},
+				}
+			},
+			nextInit: -1,
+			expected: podActions{KillPod: true, SandboxID: "s", Attempt: 1, ContainersToStart: []int{}},
+		},
+	} {
+		t.Run(desc, func(t *testing.T) {
+			pod := makeTestPod(shellContainer("foo1", "true"))
+			pod.Spec.InitContainers = []v1.Container{shellContainer("init1", "true"), shellContainer("init2", "true")}
+			if test.restartPolicy != "" {
+				pod.Spec.RestartPolicy = test.restartPolicy
+			}
+			status := test.status(pod.Spec.InitContainers, pod.Spec.Containers)
+			actions := m.computePodActions(pod, status)
+
+			expected := test.expected
+			if test.nextInit >= 0 {
+				expected.NextInitContainerToStart = &pod.Spec.InitContainers[test.nextInit]
+			}
+			expected.ContainersToKill = make(map[kubecontainer.ContainerID]containerToKillInfo)
+			for _, idx := range test.killInit {
+				c := &pod.Spec.InitContainers[idx]
+				id := status.FindContainerStatusByName(c.Name).ID
+				expected.ContainersToKill[id] = containerToKillInfo{name: c.Name, container: c, message: actions.ContainersToKill[id].message}
+			}
+			if !reflect.DeepEqual(actions, expected) {
+				t.Errorf("expected %+v, got %+v", expected, actions)
+			}
+		})
+	}
+}
+
+func TestDoBackOff(t *testing.T) {
+	m, recorder := newTestManager(t)
+	pod := makeTestPod(shellContainer("foo1", "exit 1"))
+	container := &pod.Spec.Containers[0]
+	exited := testContainerStatus(container, "c0", kubecontainer.ContainerStateExited, 1)
+	exited.FinishedAt = time.Now()
+	podStatus := &kubecontainer.PodStatus{ContainerStatuses: []*kubecontainer.Status{exited}}
+	backOff := flowcontrol.NewBackOff(time.Minute, 5*time.Minute)
+
+	if inBackOff, _, err := m.doBackOff(pod, container, &kubecontainer.PodStatus{}, backOff); inBackOff || err != nil {
+		t.Fatalf("expected a container that never exited not to be in back-off, got %v, %v", inBackOff, err)
+	}
+	if inBackOff, _, err := m.doBackOff(pod, container, podStatus, backOff); inBackOff || err != nil {
+		t.Fatalf("expected the first restart not to be in back-off, got %v, %v", inBackOff, err)
+	}
+	inBackOff, msg, err := m.doBackOff(pod, container, podStatus, backOff)
+	if !inBackOff || err != kubecontainer.ErrCrashLoopBackOff || !strings.Contains(msg, "back-off 1m0s restarting failed container=foo1") {
+		t.Fatalf("expected the second restart to be in back-off, got %v, %q, %v", inBackOff, msg, err)
+	}
+	if events := drainEvents(recorder); !hasString(events, "BackOff") {
+		t.Errorf("expected a BackOff event, got %v", events)
+	}
+	if inBackOff, _, _ := m.doBackOff(pod, container, podStatus, nil); inBackOff {
+		t.Error("expected no back-off without a back-off")
+	}
+}
+
+func TestSyncPod(t *testing.T) {
+	m, recorder := newTestManager(t)
+	pod := makeTestPod(shellContainer("foo1", "echo hello from $NAME; exec sleep 1000"), shellContainer("foo2", "exec sleep 1000"))
+	m.runtimeHelper.(*fakeRuntimeHelper).envs = []kubecontainer.EnvVar{{Name: "NAME", Value: "foo"}}
+
+	result := syncTestPod(t, m, pod, nil)
+	if err := result.Error(); err != nil {
+		t.Fatalf("unexpected sync error: %v", err)
+	}
+	podStatus := getTestPodStatus(t, m, pod)
+	if len(podStatus.SandboxStatuses) != 1 || podStatus.SandboxStatuses[0].State != runtimeapi.PodSandboxState_SANDBOX_READY {
+		t.Fatalf("expected one ready sandbox, got %v", podStatus.SandboxStatuses)
+	}
+	if !reflect.DeepEqual(podStatus.IPs, []string{testNodeIP.String()}) {
+		t.Errorf("expected the pod to have the node IPs, got %v", podStatus.IPs)
+	}
+	if len(podStatus.ContainerStatuses) != 2 {
+		t.Fatalf("expected two containers, got %v", podStatus.ContainerStatuses)
+	}
+	for _, c := range podStatus.ContainerStatuses {
+		if c.State != kubecontainer.ContainerStateRunning || c.Hash != kubecontainer.HashContainer(kubecontainer.GetContainerSpec(pod, c.Name)) {
+			t.Errorf("expected container %q to be running with the hash of its spec, got %+v", c.Name, c)
+		}
+	}
+	events := drainEvents(recorder)
+	for _, reason := range []string{"Created", "Started"} {
+		if !hasString(events, reason) {
+			t.Errorf("expected a %s event, got %v", reason, events)
+		}
+	}
+
+	// The output of the containers goes to their log file.
+	logPath := filepath.Join(buildPodLogsDirectory(m.podLogsRootDirectory, pod.Namespace, pod.Name, pod.UID), buildContainerLogsPath("foo1", 0))
+	waitForContainerLog(t, logPath, "hello from foo")
+
+	// A second sync keeps the running containers.
+	result = syncTestPod(t, m, pod, nil)
+	if err := result.Error(); err != nil || len(result.SyncResults) != 0 {
+		t.Errorf("expected nothing to do, got %+v", result)
+	}
+	pods, err := m.GetPods(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pods) != 1 || len(pods[0].Containers) != 2 || len(pods[0].Sandboxes) != 1 {
+		t.Errorf("expected one pod with two running containers, got %+v", pods)
+	}
+}
+
+func TestSyncPodRestartsExitedContainer(t *testing.T) {
+	m, _ := newTestManager(t)
+	pod := makeTestPod(shellContainer("foo1", "exit 3"))
+	backOff := flowcontrol.NewBackOff(time.Minute, 5*time.Minute)
+
+	if err := syncTestPod(t, m, pod, backOff).Error(); err != nil {
+		t.Fatalf("unexpected sync error: %v", err)
+	}
+	status := waitForContainerState(t, m, pod, "foo1", kubecontainer.ContainerStateExited)
+	if status.ExitCode != 3 || status.Reason != reasonError || status.RestartCount != 0 {
+		t.Errorf("expected the container to exit with code 3, got %+v", status)
+	}
+
+	// The first restart is immediate.
+	if err := syncTestPod(t, m, pod, backOff).Error(); err != nil {
+		t.Fatalf("unexpected sync error: %v", err)
+	}
+	status = waitForContainerState(t, m, pod, "foo1", kubecontainer.ContainerStateExited)
+	if status.RestartCount != 1 {
+		t.Errorf("expected the container to be restarted once, got %+v", status)
+	}
+	podStatus := getTestPodStatus(t, m, pod)
+	if len(podStatus.ContainerStatuses) != 2 || len(podStatus.SandboxStatuses) != 1 {
+		t.Errorf("expected two instances of the container in the same sandbox, got %+v", podStatus)
+	}
+
+	// The next one waits out the back-off.
+	result := syncTestPod(t, m, pod, backOff)
+	if result.Error() == nil || len(result.SyncResults) != 1 || result.SyncResults[0].Error != kubecontainer.ErrCrashLoopBackOff {
+		t.Fatalf("expected the restart to be backed off, got %+v", result)
+	}
+	if n := len(getTestPodStatus(t, m, pod).ContainerStatuses); n != 2 {
+		t.Errorf("expected no new instance of the container, got %d", n)
+	}
+}
+
+func TestSyncPodRestartPolicy(t *testing.T) {
+	for desc, test := range map[string]struct {
+		restartPolicy v1.RestartPolicy
+		script        string
+		restarted     bool
+	}{
+		"Always restarts succeeded containers": {restartPolicy: v1.RestartPolicyAlways, script: "exit 0", restarted: true},
+		"OnFailure restarts failed containers": {restartPolicy: v1.RestartPolicyOnFailure, script: "exit 1", restarted: true},
+		"OnFailure keeps succeeded containers": {restartPolicy: v1.RestartPolicyOnFailure, script: "exit 0"},
+		"Never keeps failed containers":        {restartPolicy: v1.RestartPolicyNever, script: "exit 1"},
+	} {
+		t.Run(desc, func(t *testing.T) {
+			m, _ := newTestManager(t)
+			pod := makeTestPod(shellContainer("foo1", test.script))
+			pod.Spec.RestartPolicy = test.restartPolicy
+
+			if err := syncTestPod(t, m, pod, nil).Error(); err != nil {
+				t.Fatalf("unexpected sync error: %v", err)
+			}
+			waitForContainerState(t, m, pod, "foo1", kubecontainer.ContainerStateExited)
+			if err := syncTestPod(t, m, pod, nil).Error(); err != nil {
+				t.Fatalf("unexpected sync error: %v", err)
+			}
+
+			podStatus := getTestPodStatus(t, m, pod)
+			if restarted := len(podStatus.ContainerStatuses) == 2; restarted != test.restarted {
+				t.Errorf("expected restarted %v, got %d instances", test.restarted, len(podStatus.ContainerStatuses))
+			}
+			// The sandbox of a pod with nothing left to run is stopped.
+			sandboxReady := podStatus.SandboxStatuses[0].State == runtimeapi.PodSandboxState_SANDBOX_READY
+			if sandboxReady != test.restarted {
+				t.Errorf("expected sandbox ready %v, got %v", test.restarted, sandboxReady)
+			}
+		})
+	}
+}
+
+func TestSyncPodInitContainers(t *testing.T) {
+	m, _ := newTestManager(t)
+	dir := t.TempDir()
+	pod := makeTestPod(shellContainer("foo1", "echo foo1 >> "+dir+"/order; exec sleep 1000"))
+	pod.Spec.InitContainers = []v1.Container{
+		shellContainer("init1", "echo init1 >> "+dir+"/order"),
+		shellContainer("init2", "echo init2 >> "+dir+"/order"),
+	}
+
+	// Each sync starts the next init container once the previous one
+	// succeeded, and the containers once they all did.
+	for _, name := range []string{"init1", "init2"} {
+		if err := syncTestPod(t, m, pod, nil).Error(); err != nil {
+			t.Fatalf("unexpected sync error: %v", err)
+		}
+		podStatus := getTestPodStatus(t, m, pod)
+		if podStatus.FindContainerStatusByName("foo1") != nil {
+			t.Fatalf("expected foo1 not to start before %s, got %+v", name, podStatus.ContainerStatuses)
+		}
+		if status := waitForContainerState(t, m, pod, name, kubecontainer.ContainerStateExited); status.ExitCode != 0 {
+			t.Fatalf("expected %s to succeed, got %+v", name, status)
+		}
+	}
+	if err := syncTestPod(t, m, pod, nil).Error(); err != nil {
+		t.Fatalf("unexpected sync error: %v", err)
+	}
+	waitForContainerState(t, m, pod, "foo1", kubecontainer.ContainerStateRunning)
+
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		data, _ := os.ReadFile(filepath.Join(dir, "order"))
+		if string(data) == "init1\ninit2\nfoo1\n" {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("expected the init containers to run in order before foo1, got %q", data)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestSyncPodFailedInitContainer(t *testing.T) {
+	m, _ := newTestManager(t)
+	pod := makeTestPod(shellContainer("foo1", "exec sleep 1000"))
+	pod.Spec.InitContainers = []v1.Container{shellContainer("init1", "exit 1")}
+	pod.Spec.RestartPolicy = v1.RestartPolicyNever
+
+	if err := syncTestPod(t, m, pod, nil).Error(); err != nil {
+		t.Fatalf("unexpected sync error: %v", err)
+	}
+	waitForContainerState(t, m, pod, "init1", kubecontainer.ContainerStateExited)
+	if err := syncTestPod(t, m, pod, nil).Error(); err != nil {
+		t.Fatalf("unexpected sync error: %v", err)
+	}
+	podStatus := getTestPodStatus(t, m, pod)
+	if podStatus.FindContainerStatusByName("foo1") != nil {
+		t.Errorf("expected foo1 not to start after init1 failed, got %+v", podStatus.ContainerStatuses)
+	}
+	if podStatus.SandboxStatuses[0].State != runtimeapi.PodSandboxState_SANDBOX_NOTREADY {
+		t.Errorf("expected the sandbox to be stopped, got %v", podStatus.SandboxStatuses[0].State)
+	}
+}
+
+func TestSyncPodStartError(t *testing.T) {
+	m, recorder := newTestManager(t)
+	container := shellContainer("foo1", "true")
+	container.WorkingDir = filepath.Join(t.TempDir(), "missing")
+	pod := makeTestPod(container)
+
+	result := syncTestPod(t, m, pod, nil)
+	var startResult *kubecontainer.SyncResult
+	for _, r := range result.SyncResults {
+		if r.Action == kubecontainer.StartContainer {
+			startResult = r
+		}
+	}
+	if startResult == nil || startResult.Error != kubecontainer.ErrRunContainer {
+		t.Fatalf("expected the container start to fail, got %+v", result)
+	}
+	status := getTestPodStatus(t, m, pod).FindContainerStatusByName("foo1")
+	if status == nil || status.State != kubecontainer.ContainerStateExited || status.ExitCode != 128 || status.Reason != reasonStartError {
+		t.Errorf("expected the container to be exited with a start error, got %+v", status)
+	}
+	if events := drainEvents(recorder); !hasString(events, "Failed") {
+		t.Errorf("expected a Failed event, got %v", events)
+	}
+}
+
+func TestKillPod(t *testing.T) {
+	m, recorder := newTestManager(t)
+	pod := makeTestPod(shellContainer("foo1", "exec sleep 1000"), shellContainer("foo2", "exec sleep 1000"))
+	gracePeriod := int64(10)
+	pod.Spec.TerminationGracePeriodSeconds = &gracePeriod
+
+	if err := syncTestPod(t, m, pod, nil).Error(); err != nil {
+		t.Fatalf("unexpected sync error: %v", err)
+	}
+	podStatus := getTestPodStatus(t, m, pod)
+	runningPod := kubecontainer.ConvertPodStatusToRunningPod(m.Type(), podStatus)
+	drainEvents(recorder)
+
+	start := time.Now()
+	if err := m.KillPod(pod, runningPod, nil); err != nil {
+		t.Fatalf("unexpected kill error: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed >= time.Duration(gracePeriod)*time.Second {
+		t.Errorf("expected the containers to exit on SIGTERM, took %v", elapsed)
+	}
+
+	podStatus = getTestPodStatus(t, m, pod)
+	if podStatus.SandboxStatuses[0].State != runtimeapi.PodSandboxState_SANDBOX_NOTREADY || len(podStatus.IPs) != 0 {
+		t.Errorf("expected the sandbox to be stopped without IPs, got %v, %v", podStatus.SandboxStatuses[0], podStatus.IPs)
+	}
+	var names []string
+	for _, c := range podStatus.ContainerStatuses {
+		names = append(names, c.Name)
+		if c.State != kubecontainer.ContainerStateExited || c.ExitCode != 128+15 {
+			t.Errorf("expected container %q to be terminated by SIGTERM, got %+v", c.Name, c)
+		}
+	}
+	sort.Strings(names)
+	if !reflect.DeepEqual(names, []string{"foo1", "foo2"}) {
+		t.Errorf("expected both containers, got %v", names)
+	}
+	if events := drainEvents(recorder); !reflect.DeepEqual(events, []string{"Killing", "Killing"}) {
+		t.Errorf("expected a Killing event per container, got %v", events)
+	}
+	if pods, _ := m.GetPods(false); len(pods) != 0 {
+		t.Errorf("expected no running pod, got %+v", pods)
+	}
+
+	// Killing a pod again is a no-op.
+	if err := m.KillPod(pod, runningPod, nil); err != nil {
+		t.Errorf("unexpected error killing the pod again: %v", err)
+	}
+}
+
+func TestKillPodWithoutSpec(t *testing.T) {
+	m, _ := newTestManager(t)
+	pod := makeTestPod(shellContainer("foo1", "trap '' TERM; while true; do sleep 0.1; done"))
+	if err := syncTestPod(t, m, pod, nil).Error(); err != nil {
+		t.Fatalf("unexpected sync error: %v", err)
+	}
+	runningPod := kubecontainer.ConvertPodStatusToRunningPod(m.Type(), getTestPodStatus(t, m, pod))
+
+	// Orphaned containers are killed with the grace period override.
+	gracePeriod := int64(0)
+	if err := m.KillPod(nil, runningPod, &gracePeriod); err != nil {
+		t.Fatalf("unexpected kill error: %v", err)
+	}
+	status := getTestPodStatus(t, m, pod).FindContainerStatusByName("foo1")
+	if status.State != kubecontainer.ContainerStateExited || status.ExitCode != 128+9 {
+		t.Errorf("expected the container to be killed by SIGKILL, got %+v", status)
+	}
+}
+
+func TestGetPodStatus(t *testing.T) {
+	m, _ := newTestManager(t)
+	pod := makeTestPod(shellContainer("foo1", "exit 0"))
+
+	podStatus := getTestPodStatus(t, m, pod)
+	if len(podStatus.SandboxStatuses) != 0 || len(podStatus.ContainerStatuses) != 0 || len(podStatus.IPs) != 0 {
+		t.Fatalf("expected an empty status for an unknown pod, got %+v", podStatus)
+	}
+
+	// Run the pod twice, in two sandboxes.
+	for i := 0; i < 2; i++ {
+		if err := syncTestPod(t, m, pod, nil).Error(); err != nil {
+			t.Fatalf("unexpected sync error: %v", err)
+		}
+		waitForContainerState(t, m, pod, "foo1", kubecontainer.ContainerStateExited)
+		runningPod := kubecontainer.ConvertPodStatusToRunningPod(m.Type(), getTestPodStatus(t, m, pod))
+		if err := m.KillPod(pod, runningPod, nil); err != nil {
+			t.Fatalf("unexpected kill error: %v", err)
+		}
+		// Let the second container be created strictly after the first.
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	podStatus = getTestPodStatus(t, m, pod)
+	if podStatus.ID != pod.UID || podStatus.Name != pod.Name || podStatus.Namespace != pod.Namespace {
+		t.Errorf("unexpected pod identity %q %q %q", podStatus.ID, podStatus.Name, podStatus.Namespace)
+	}
+	if len(podStatus.SandboxStatuses) != 2 || len(podStatus.ContainerStatuses) != 2 {
+		t.Fatalf("expected two sandboxes and two containers, got %+v", podStatus)
+	}
+	if podStatus.SandboxStatuses[0].Metadata.Attempt != 1 || podStatus.SandboxStatuses[1].Metadata.Attempt != 0 {
+		t.Errorf("expected the newest sandbox first, got %v", podStatus.SandboxStatuses)
+	}
+	if !podStatus.ContainerStatuses[0].CreatedAt.After(podStatus.ContainerStatuses[1].CreatedAt) {
+		t.Errorf("expected the newest container first, got %+v", podStatus.ContainerStatuses)
+	}
+}
+
+func TestWriteResolvConf(t *testing.T) {
+	m, _ := newTestManager(t)
+	m.runtimeHelper.(*fakeRuntimeHelper).dnsConfig = &runtimeapi.DNSConfig{
+		Servers:  []string{"10.0.0.10"},
+		Searches: []string{"new.svc.cluster.local", "svc.cluster.local"},
+		Options:  []string{"ndots:5"},
+	}
+	pod := makeTestPod(shellContainer("foo1", "true"))
+
+	path, err := m.writeResolvConf(pod, "sandbox")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if expected := filepath.Join(m.store.sandboxDir("sandbox"), resolvConfFileName); path != expected {
+		t.Errorf("expected the resolv.conf next to the sandbox record %q, got %q", expected, path)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := "nameserver 10.0.0.10\nsearch new.svc.cluster.local svc.cluster.local\noptions ndots:5\n"; string(data) != expected {
+		t.Errorf("expected %q, got %q", expected, data)
+	}
+
+	// The file goes away with the sandbox.
+	if err := m.store.removeSandbox("sandbox"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("expected the resolv.conf to be removed, got %v", err)
+	}
+}
@@ -0,0 +1,337 @@
+//go:build linux
+// +build linux
+
+package process
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+const (
+	// sandboxInitName is the argv[0] the kubelet binary is re-executed with
+	// to hold the namespaces of a pod. It is the init process of the pid
+	// namespace of the pod.
+	sandboxInitName = "mykubelet-sandbox-init"
+
+	// sandboxInitReady is written by the sandbox init once the namespaces
+	// are set up.
+	sandboxInitReady = "ready"
+
+	// sandboxInitTimeout is how long the sandbox init may take to set up the namespaces.
+	sandboxInitTimeout = 10 * time.Second
+)
+
+// sandboxInitConfig is handed to the sandbox init as its first argument.
+type sandboxInitConfig struct {
+	// Hostname is set in the UTS namespace of the pod, if not empty.
+	Hostname string `json:"hostname,omitempty"`
+	// MountProc mounts a procfs of the pid namespace of the pod over /proc.
+	MountProc bool `json:"mountProc,omitempty"`
+	// Loopback brings up the loopback interface of the network namespace of the pod.
+	Loopback bool `json:"loopback,omitempty"`
+}
+
+func init() {
+	if len(os.Args) > 0 && os.Args[0] == sandboxInitName {
+		sandboxInit()
+	}
+}
+
+// sandboxInit sets up the namespaces it was cloned into, reports on stdout
+// and then waits to be killed, it never returns.
+func sandboxInit() {
+	if err := setupSandboxNamespaces(os.Args[1:]); err != nil {
+		fmt.Fprintf(os.Stdout, "%s: %v\n", sandboxInitName, err)
+		os.Exit(containerInitExitCode)
+	}
+	fmt.Fprintln(os.Stdout, sandboxInitReady)
+	os.Stdout.Close()
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, unix.SIGCHLD, unix.SIGTERM, unix.SIGINT)
+	for sig := range signals {
+		if sig != unix.SIGCHLD {
+			os.Exit(0)
+		}
+		// Orphaned processes of the pod are reparented to the init of its
+		// pid namespace, which reaps them.
+		for {
+			var status unix.WaitStatus
+			pid, err := unix.Wait4(-1, &status, unix.WNOHANG, nil)
+			if pid <= 0 || err != nil {
+				break
+			}
+		}
+	}
+}
+
+func setupSandboxNamespaces(args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("expected a config, got %q", args)
+	}
+	var config sandboxInitConfig
+	if err := json.Unmarshal([]byte(args[0]), &config); err != nil {
+		return fmt.Errorf("invalid config: %v", err)
+	}
+
+	// Mounts of the host still propagate into the pod, mounts of the pod
+	// never propagate back.
+	if err := unix.Mount("", "/", "", unix.MS_REC|unix.MS_SLAVE, ""); err != nil {
+		return fmt.Errorf("failed to make the mounts of the pod slaves: %v", err)
+	}
+	if config.MountProc {
+		if err := unix.Mount("proc", "/proc", "proc", unix.MS_NOSUID|unix.MS_NODEV|unix.MS_NOEXEC, ""); err != nil {
+			return fmt.Errorf("failed to mount /proc: %v", err)
+		}
+	}
+	if config.Hostname != "" {
+		if err := unix.Sethostname([]byte(config.Hostname)); err != nil {
+			return fmt.Errorf("failed to set hostname: %v", err)
+		}
+	}
+	if config.Loopback {
+		if err := setLoopbackUp(); err != nil {
+			return fmt.Errorf("failed to bring up the loopback interface: %v", err)
+		}
+	}
+	return nil
+}
+
+// setLoopbackUp brings up the loopback interface of the network namespace
+// of the calling thread.
+func setLoopbackUp() error {
+	fd, err := unix.Socket(unix.AF_INET, unix.SOCK_DGRAM|unix.SOCK_CLOEXEC, 0)
+	if err != nil {
+		return err
+	}
+	defer unix.Close(fd)
+	ifr, err := unix.NewIfreq("lo")
+	if err != nil {
+		return err
+	}
+	if err := unix.IoctlIfreq(fd, unix.SIOCGIFFLAGS, ifr); err != nil {
+		return err
+	}
+	ifr.SetUint16(ifr.Uint16() | unix.IFF_UP)
+	return unix.IoctlIfreq(fd, unix.SIOCSIFFLAGS, ifr)
+}
+
+// startSandboxProcess starts the sandbox init in new namespaces and waits
+// until they are set up. The pid of the process is recorded in ns.
+func startSandboxProcess(ns *sandboxNamespaces) (*exec.Cmd, error) {
+	data, err := json.Marshal(sandboxInitConfig{
+		Hostname:  ns.Hostname,
+		MountProc: ns.PID,
+		Loopback:  ns.Network,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	cloneflags := uintptr(unix.CLONE_NEWNS)
+	if ns.PID {
+		cloneflags |= unix.CLONE_NEWPID
+	}
+	if ns.IPC {
+		cloneflags |= unix.CLONE_NEWIPC
+	}
+	if ns.UTS {
+		cloneflags |= unix.CLONE_NEWUTS
+	}
+	if ns.Network {
+		cloneflags |= unix.CLONE_NEWNET
+	}
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	// /proc/self/exe of the forked child is the kubelet binary, even if
+	// the file was replaced since the kubelet started.
+	cmd := &exec.Cmd{
+		Path:   "/proc/self/exe",
+		Args:   []string{sandboxInitName, string(data)},
+		Stdout: w,
+		// The sandbox outlives the kubelet, like the containers do.
+		SysProcAttr: &syscall.SysProcAttr{
+			Cloneflags: cloneflags,
+			Setpgid:    true,
+		},
+	}
+	err = cmd.Start()
+	w.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	result := make(chan string, 1)
+	go func() {
+		line, _ := bufio.NewReader(r).ReadString('\n')
+		result <- strings.TrimSpace(line)
+	}()
+	select {
+	case line := <-result:
+		if line == sandboxInitReady {
+			ns.Pid = cmd.Process.Pid
+			return cmd, nil
+		}
+		cmd.Process.Kill()
+		cmd.Wait()
+		if line == "" {
+			return nil, fmt.Errorf("sandbox init exited before setting up the namespaces")
+		}
+		return nil, fmt.Errorf("%s", line)
+	case <-time.After(sandboxInitTimeout):
+		cmd.Process.Kill()
+		cmd.Wait()
+		return nil, fmt.Errorf("timed out waiting for sandbox init to set up the namespaces")
+	}
+}
+
+// checkSandboxInit checks that the kubelet binary the sandbox init is
+// re-executed from is available, and that the kernel supports the
+// namespaces pods are isolated with, the network namespace too with
+// podNetwork.
+func checkSandboxInit(podNetwork bool) error {
+	info, err := os.Stat("/proc/self/exe")
+	if err != nil {
+		return fmt.Errorf("the kubelet binary is not available: %v", err)
+	}
+	if !info.Mode().IsRegular() || info.Mode().Perm()&0111 == 0 {
+		return fmt.Errorf("the kubelet binary is not executable")
+	}
+	namespaces := []string{"mnt", "pid", "ipc", "uts"}
+	if podNetwork {
+		namespaces = append(namespaces, "net")
+	}
+	for _, ns := range namespaces {
+		if _, err := os.Stat(filepath.Join("/proc/self/ns", ns)); err != nil {
+			return fmt.Errorf("the %s namespace is not supported: %v", ns, err)
+		}
+	}
+	return nil
+}
+
+// runInNamespaces runs fn in the namespaces held by the sandbox process.
+// The namespaces are joined by a locked thread fn runs on, so that processes
+// started by fn are forked in them. The thread is never unlocked so that it
+// is terminated with the goroutine and no other goroutine runs in them.
+func runInNamespaces(ns *sandboxNamespaces, fn func() error) error {
+	type namespace struct {
+		name   string
+		nstype int
+	}
+	namespaces := []namespace{{"mnt", unix.CLONE_NEWNS}}
+	if ns.PID {
+		// The pid namespace only applies to the children of the thread.
+		namespaces = append(namespaces, namespace{"pid", unix.CLONE_NEWPID})
+	}
+	if ns.IPC {
+		namespaces = append(namespaces, namespace{"ipc", unix.CLONE_NEWIPC})
+	}
+	if ns.UTS {
+		namespaces = append(namespaces, namespace{"uts", unix.CLONE_NEWUTS})
+	}
+	if ns.Network {
+		namespaces = append(namespaces, namespace{"net", unix.CLONE_NEWNET})
+	}
+
+	files := make([]*os.File, 0, len(namespaces))
+	defer func() {
+		for _, f := range files {
+			f.Close()
+		}
+	}()
+	for _, n := range namespaces {
+		f, err := os.Open(filepath.Join("/proc", strconv.Itoa(ns.Pid), "ns", n.name))
+		if err != nil {
+			return fmt.Errorf("failed to open the %s namespace of the pod: %v", n.name, err)
+		}
+		files = append(files, f)
+	}
+
+	result := make(chan error, 1)
+	go func() {
+		runtime.LockOSThread()
+		// The thread shares its filesystem attributes with the other threads
+		// of the kubelet, which forbids it to change its mount namespace.
+		if err := unix.Unshare(unix.CLONE_FS); err != nil {
+			result <- fmt.Errorf("failed to unshare the filesystem attributes: %v", err)
+			return
+		}
+		for i, n := range namespaces {
+			if err := unix.Setns(int(files[i].Fd()), n.nstype); err != nil {
+				result <- fmt.Errorf("failed to join the %s namespace of the pod: %v", n.name, err)
+				return
+			}
+		}
+		result <- fn()
+	}()
+	return <-result
+}
+
+// runInNetworkNamespace runs fn in the network namespace held by the sandbox
+// process only, on a locked thread that is never unlocked like the one of
+// runInNamespaces. Sockets opened by fn stay in the network namespace.
+func runInNetworkNamespace(ns *sandboxNamespaces, fn func() error) error {
+	f, err := os.Open(filepath.Join("/proc", strconv.Itoa(ns.Pid), "ns", "net"))
+	if err != nil {
+		return fmt.Errorf("failed to open the net namespace of the pod: %v", err)
+	}
+	defer f.Close()
+
+	result := make(chan error, 1)
+	go func() {
+		runtime.LockOSThread()
+		if err := unix.Setns(int(f.Fd()), unix.CLONE_NEWNET); err != nil {
+			result <- fmt.Errorf("failed to join the net namespace of the pod: %v", err)
+			return
+		}
+		result <- fn()
+	}()
+	return <-result
+}
+
+// namespacedPid returns the pid of a process in its own pid namespace.
+func namespacedPid(pid int) (int, error) {
+	data, err := os.ReadFile(filepath.Join("/proc", strconv.Itoa(pid), "status"))
+	if err != nil {
+		return 0, err
+	}
+	for _, line := range bytes.Split(data, []byte("\n")) {
+		if !bytes.HasPrefix(line, []byte("NSpid:")) {
+			continue
+		}
+		fields := strings.Fields(string(line[len("NSpid:"):]))
+		if len(fields) == 0 {
+			break
+		}
+		return strconv.Atoi(fields[len(fields)-1])
+	}
+	return 0, fmt.Errorf("no NSpid of process %d", pid)
+}
+
+// isSandboxProcess returns whether pid is the process of a sandbox, and not
+// an unrelated process that reused the pid.
+func isSandboxProcess(pid int) bool {
+	data, err := os.ReadFile(filepath.Join("/proc", strconv.Itoa(pid), "cmdline"))
+	if err != nil {
+		return false
+	}
+	return string(bytes.SplitN(data, []byte{0}, 2)[0]) == sandboxInitName
+}
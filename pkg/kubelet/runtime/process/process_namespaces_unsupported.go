@@ -0,0 +1,35 @@
+//go:build !linux
+// +build !linux
+
+package process
+
+import (
+	"fmt"
+	"os/exec"
+)
+
+// startSandboxProcess is not supported on this platform, pods share the
+// namespaces of the host.
+func startSandboxProcess(ns *sandboxNamespaces) (*exec.Cmd, error) {
+	return nil, fmt.Errorf("namespace isolation is not supported on this platform")
+}
+
+func checkSandboxInit(podNetwork bool) error {
+	return fmt.Errorf("namespace isolation is not supported on this platform")
+}
+
+func runInNamespaces(ns *sandboxNamespaces, fn func() error) error {
+	return fmt.Errorf("namespace isolation is not supported on this platform")
+}
+
+func runInNetworkNamespace(ns *sandboxNamespaces, fn func() error) error {
+	return fmt.Errorf("namespace isolation is not supported on this platform")
+}
+
+func namespacedPid(pid int) (int, error) {
+	return pid, nil
+}
+
+func isSandboxProcess(pid int) bool {
+	return false
+}
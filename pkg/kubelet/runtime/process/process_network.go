@@ -0,0 +1,201 @@
+package process
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/xuliangTang/mykubelet/pkg/kubelet/events"
+	"github.com/xuliangTang/mykubelet/pkg/kubelet/runtime/cni"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+	runtimeapi "k8s.io/cri-api/pkg/apis/runtime/v1alpha2"
+	"k8s.io/klog/v2"
+)
+
+const (
+	// networkPluginTimeout is how long a CNI plugin may take for one command.
+	networkPluginTimeout = time.Minute
+	// networkCheckPeriod is how often the networks of the ready sandboxes are checked.
+	networkCheckPeriod = time.Minute
+)
+
+// hasPodNetwork returns whether the sandbox has a network namespace of its
+// own, set up by the network plugin.
+func (r *sandboxRecord) hasPodNetwork() bool {
+	return r.Namespaces != nil && r.Namespaces.Network
+}
+
+// sandboxIPs returns the IPs of the sandbox: the IPs set up by the network
+// plugin for a sandbox with a network namespace of its own, and the IPs of
+// the node for a sandbox sharing the network of the host.
+func (m *processManager) sandboxIPs(s *sandboxRecord) []string {
+	if s.hasPodNetwork() {
+		return s.IPs
+	}
+	ips, err := m.nodeIPs()
+	if err != nil {
+		klog.V(4).InfoS("Cannot get node IPs", "podSandboxID", s.ID, "err", err)
+		return nil
+	}
+	return ipStrings(ips)
+}
+
+// podNetwork returns the pod network of the sandbox for the network plugin.
+// The network namespace is only known while the sandbox process is alive.
+func (m *processManager) podNetwork(s *sandboxRecord) cni.PodNetwork {
+	network := cni.PodNetwork{
+		Name:      s.PodName,
+		Namespace: s.PodNamespace,
+		UID:       s.PodUID,
+		SandboxID: s.ID,
+		PodCIDRs:  m.ipam.CIDRs(),
+		IPs:       m.allocatedIPs(s.ID),
+	}
+	if !s.exited() {
+		network.NetNS = filepath.Join("/proc", strconv.Itoa(s.Namespaces.Pid), "ns", "net")
+	}
+	return network
+}
+
+// allocatedIPs returns the IPs allocated to the sandbox by the IPAM, with the
+// prefix length of the pod CIDR they were allocated from.
+func (m *processManager) allocatedIPs(id string) []string {
+	var ips []string
+	for _, ip := range m.ipam.Get(id) {
+		addr := ip.String()
+		for _, cidr := range m.ipam.CIDRs() {
+			if _, ipNet, err := net.ParseCIDR(cidr); err == nil && ipNet.Contains(ip) {
+				ones, _ := ipNet.Mask.Size()
+				addr = fmt.Sprintf("%s/%d", ip, ones)
+				break
+			}
+		}
+		ips = append(ips, addr)
+	}
+	return ips
+}
+
+// setUpPodNetwork adds the network namespace of the sandbox to the network
+// of the network plugin, records the IPs of the pod and forwards its host
+// ports to them.
+func (m *processManager) setUpPodNetwork(id string) error {
+	s, ok := m.getSandbox(id)
+	if !ok {
+		return fmt.Errorf("pod sandbox %q not found", id)
+	}
+	if !s.hasPodNetwork() {
+		return nil
+	}
+
+	// The sandbox is marked first, so that a network set up half way is
+	// torn down too.
+	m.lock.Lock()
+	s.NetworkSetUp = true
+	err := m.store.saveSandbox(s)
+	m.lock.Unlock()
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), networkPluginTimeout)
+	defer cancel()
+	result, err := m.networkPlugin.SetUpPod(ctx, m.podNetwork(s))
+	if err != nil {
+		return err
+	}
+	ips, err := result.PodIPs()
+	if err != nil {
+		return err
+	}
+	klog.V(4).InfoS("Set up the network of pod sandbox", "podSandboxID", id, "IPs", ips)
+	// A plugin without the ips capability allocates IPs of its own, the
+	// IPs allocated by the kubelet are then of no use.
+	if !sets.NewString(ips...).HasAll(ipStrings(m.ipam.Get(id))...) {
+		if err := m.ipam.Release(id); err != nil {
+			klog.ErrorS(err, "Failed to release the IPs of pod sandbox", "podSandboxID", id)
+		}
+	}
+
+	m.lock.Lock()
+	s.IPs = ips
+	err = m.store.saveSandbox(s)
+	m.lock.Unlock()
+	if err != nil {
+		return err
+	}
+	return m.hostPorts.Add(id, s.HostPorts, ips)
+}
+
+// tearDownPodNetwork stops forwarding the host ports of the sandbox and
+// removes it from the network of the network plugin. It is a no-op if its
+// network is not set up.
+func (m *processManager) tearDownPodNetwork(id string) error {
+	s, ok := m.getSandbox(id)
+	if !ok {
+		return nil
+	}
+	m.hostPorts.Remove(id)
+	m.lock.RLock()
+	setUp := s.NetworkSetUp
+	m.lock.RUnlock()
+	if !setUp {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), networkPluginTimeout)
+	defer cancel()
+	if err := m.networkPlugin.TearDownPod(ctx, m.podNetwork(s)); err != nil {
+		return err
+	}
+	klog.V(4).InfoS("Tore down the network of pod sandbox", "podSandboxID", id)
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	s.NetworkSetUp = false
+	s.IPs = nil
+	return m.store.saveSandbox(s)
+}
+
+// checkPodNetworks checks the networks of the ready sandboxes. A sandbox
+// whose network is broken is marked as not ready, the kubelet then
+// recreates the pod.
+func (m *processManager) checkPodNetworks() {
+	var sandboxes []*sandboxRecord
+	m.lock.RLock()
+	for _, s := range m.sandboxes {
+		if s.State == runtimeapi.PodSandboxState_SANDBOX_READY && s.NetworkSetUp && len(s.IPs) != 0 {
+			sandboxes = append(sandboxes, s)
+		}
+	}
+	m.lock.RUnlock()
+
+	for _, s := range sandboxes {
+		ctx, cancel := context.WithTimeout(context.Background(), networkPluginTimeout)
+		err := m.networkPlugin.CheckPod(ctx, m.podNetwork(s))
+		cancel()
+		if err == nil {
+			continue
+		}
+		klog.ErrorS(err, "Network of pod sandbox failed the check", "podSandboxID", s.ID, "pod", klog.KRef(s.PodNamespace, s.PodName))
+		ref := &v1.ObjectReference{
+			Kind:      "Pod",
+			Name:      s.PodName,
+			Namespace: s.PodNamespace,
+			UID:       s.PodUID,
+		}
+		m.recorder.Eventf(ref, v1.EventTypeWarning, events.NetworkNotReady, "Network of pod sandbox %s failed the check, it will be re-created: %v", s.ID, err)
+
+		m.lock.Lock()
+		if s.State == runtimeapi.PodSandboxState_SANDBOX_READY {
+			s.State = runtimeapi.PodSandboxState_SANDBOX_NOTREADY
+			if err := m.store.saveSandbox(s); err != nil {
+				klog.ErrorS(err, "Failed to persist sandbox record", "podSandboxID", s.ID)
+			}
+		}
+		m.lock.Unlock()
+	}
+}
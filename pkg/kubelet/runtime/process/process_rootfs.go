@@ -0,0 +1,115 @@
+package process
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+
+	kubecontainer "github.com/xuliangTang/mykubelet/pkg/kubelet/container"
+	"k8s.io/klog/v2"
+)
+
+const (
+	// The directories of a container holding its root filesystem: an
+	// overlay mounted on rootfs, whose writes go to upper.
+	rootfsDirName      = "rootfs"
+	rootfsUpperDirName = "upper"
+	rootfsWorkDirName  = "work"
+
+	// etcResolvConfPath is where the resolv.conf of the sandbox is mounted.
+	etcResolvConfPath = "/etc/resolv.conf"
+)
+
+// rootfsSpec describes the root filesystem of a container run in the root
+// filesystem of its image.
+type rootfsSpec struct {
+	// Image is the unpacked root filesystem of the image, the read-only
+	// lower layer of the overlay.
+	Image string
+	// Mounts are the volumes bind mounted into the root filesystem.
+	Mounts []kubecontainer.Mount
+	// WorkingDir is created if the image does not have it.
+	WorkingDir string
+	// ReadOnly makes the root filesystem read-only, the volumes keep their mode.
+	ReadOnly bool
+}
+
+// mountContainerRootfs mounts the root filesystem of a container on rootfs
+// in the mount namespace of its pod, the mounts are not visible from the
+// host. The overlay keeps its layers next to rootfs, in the directory of the
+// container.
+func (m *processManager) mountContainerRootfs(sandbox *sandboxRecord, rootfs string, spec *rootfsSpec) error {
+	dir := filepath.Dir(rootfs)
+	for _, d := range []string{rootfs, filepath.Join(dir, rootfsUpperDirName), filepath.Join(dir, rootfsWorkDirName)} {
+		if err := os.MkdirAll(d, 0755); err != nil {
+			return err
+		}
+	}
+	err := runInSandbox(sandbox, func() error {
+		return setupRootfs(rootfs, dir, spec)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to set up the root filesystem: %v", err)
+	}
+	return nil
+}
+
+// unmountContainerRootfs unmounts the root filesystem of an exited container.
+// The mounts of a pod whose sandbox exited went away with its mount namespace.
+func (m *processManager) unmountContainerRootfs(record *containerRecord) {
+	if record.Rootfs == "" {
+		return
+	}
+	sandbox, ok := m.getSandbox(record.SandboxID)
+	if !ok || sandbox.Namespaces == nil || sandbox.exited() {
+		return
+	}
+	err := runInSandbox(sandbox, func() error {
+		return unmountRootfs(record.Rootfs)
+	})
+	if err != nil {
+		klog.V(4).InfoS("Failed to unmount the root filesystem of container", "containerID", record.ID, "err", err)
+	}
+}
+
+// hasMountOn returns whether one of mounts is mounted on containerPath.
+func hasMountOn(mounts []kubecontainer.Mount, containerPath string) bool {
+	for _, mount := range mounts {
+		if mount.ContainerPath == containerPath {
+			return true
+		}
+	}
+	return false
+}
+
+// mountPodFiles mounts the hosts and resolv.conf files of the pod among
+// mounts over the ones of the host in the mount namespace of the pod, for the
+// containers run in the root filesystem of the host.
+func (m *processManager) mountPodFiles(sandbox *sandboxRecord, mounts []kubecontainer.Mount) error {
+	err := runInSandbox(sandbox, func() error {
+		return bindPodFiles(mounts)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to mount the files of the pod: %v", err)
+	}
+	return nil
+}
+
+// startInRootfs starts cmd in the namespaces of the sandbox, in the root
+// filesystem rootfs if not empty. The root filesystem is handed to the
+// container init as an open directory.
+func startInRootfs(cmd *exec.Cmd, sandbox *sandboxRecord, rootfs string) error {
+	if rootfs == "" {
+		return startInSandbox(cmd, sandbox)
+	}
+	return runInSandbox(sandbox, func() error {
+		dir, err := os.Open(rootfs)
+		if err != nil {
+			return err
+		}
+		defer dir.Close()
+		cmd.ExtraFiles = []*os.File{dir}
+		return cmd.Start()
+	})
+}
@@ -0,0 +1,224 @@
+//go:build linux
+// +build linux
+
+package process
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	kubecontainer "github.com/xuliangTang/mykubelet/pkg/kubelet/container"
+	"github.com/xuliangTang/mykubelet/pkg/util/filesystem"
+	"golang.org/x/sys/unix"
+)
+
+// devices are the device nodes of the host bind mounted into /dev of a container.
+var devices = []string{"/dev/null", "/dev/zero", "/dev/full", "/dev/random", "/dev/urandom", "/dev/tty"}
+
+// devSymlinks are the symlinks of /dev of a container.
+var devSymlinks = map[string]string{
+	"/dev/fd":     "/proc/self/fd",
+	"/dev/stdin":  "/proc/self/fd/0",
+	"/dev/stdout": "/proc/self/fd/1",
+	"/dev/stderr": "/proc/self/fd/2",
+	"/dev/ptmx":   "pts/ptmx",
+}
+
+// hostFiles are the files of the host containers share, read-only, unless
+// the kubelet mounts the files of the pod over them.
+var hostFiles = []string{etcResolvConfPath, "/etc/hosts"}
+
+// isHostFile returns whether containerPath is one of the hostFiles.
+func isHostFile(containerPath string) bool {
+	for _, file := range hostFiles {
+		if containerPath == file {
+			return true
+		}
+	}
+	return false
+}
+
+// setupRootfs mounts the root filesystem of a container on rootfs: an
+// overlay of the image whose writes go to the directory of the container,
+// with the filesystems a container expects and its volumes mounted in it.
+// Everything is unmounted again on error.
+func setupRootfs(rootfs, dir string, spec *rootfsSpec) (err error) {
+	data := fmt.Sprintf("lowerdir=%s,upperdir=%s,workdir=%s", spec.Image, filepath.Join(dir, rootfsUpperDirName), filepath.Join(dir, rootfsWorkDirName))
+	if err := unix.Mount("overlay", rootfs, "overlay", 0, data); err != nil {
+		return fmt.Errorf("failed to mount the overlay: %v", err)
+	}
+	defer func() {
+		if err != nil {
+			unmountRootfs(rootfs)
+		}
+	}()
+
+	// /proc is the procfs of the pid namespace of the pod.
+	if err := bindMount(rootfs, "/proc", "/proc", false); err != nil {
+		return err
+	}
+	if err := mountSys(rootfs); err != nil {
+		return err
+	}
+	if err := setupDev(rootfs); err != nil {
+		return err
+	}
+	for _, file := range hostFiles {
+		if hasMountOn(spec.Mounts, file) {
+			continue
+		}
+		if _, err := os.Stat(file); err != nil {
+			continue
+		}
+		if err := bindMount(rootfs, file, file, true); err != nil {
+			return err
+		}
+	}
+	for _, mount := range spec.Mounts {
+		if err := bindMount(rootfs, mount.HostPath, mount.ContainerPath, mount.ReadOnly); err != nil {
+			return err
+		}
+	}
+
+	workingDir, err := filesystem.SecureJoin(rootfs, spec.WorkingDir)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(workingDir, 0755); err != nil {
+		return fmt.Errorf("failed to create the working directory %q: %v", spec.WorkingDir, err)
+	}
+
+	if spec.ReadOnly {
+		if err := unix.Mount("", rootfs, "", unix.MS_BIND|unix.MS_REMOUNT|unix.MS_RDONLY, ""); err != nil {
+			return fmt.Errorf("failed to make the root filesystem read-only: %v", err)
+		}
+	}
+	return nil
+}
+
+// mountSys mounts a read-only sysfs on /sys, without the cgroup
+// filesystems mounted below the /sys of the host.
+func mountSys(rootfs string) error {
+	sys, err := filesystem.SecureJoin(rootfs, "/sys")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(sys, 0755); err != nil {
+		return err
+	}
+	if err := unix.Mount("sysfs", sys, "sysfs", unix.MS_RDONLY|unix.MS_NOSUID|unix.MS_NODEV|unix.MS_NOEXEC, ""); err != nil {
+		return fmt.Errorf("failed to mount /sys: %v", err)
+	}
+	return nil
+}
+
+// setupDev mounts the /dev of a container: a tmpfs with the devices of the
+// host, a devpts of its own and a tmpfs for shared memory.
+func setupDev(rootfs string) error {
+	dev, err := filesystem.SecureJoin(rootfs, "/dev")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dev, 0755); err != nil {
+		return err
+	}
+	if err := unix.Mount("tmpfs", dev, "tmpfs", unix.MS_NOSUID|unix.MS_STRICTATIME, "mode=755,size=65536k"); err != nil {
+		return fmt.Errorf("failed to mount /dev: %v", err)
+	}
+	for _, device := range devices {
+		if _, err := os.Stat(device); err != nil {
+			continue
+		}
+		if err := bindMount(rootfs, device, device, false); err != nil {
+			return err
+		}
+	}
+
+	pts := filepath.Join(dev, "pts")
+	if err := os.Mkdir(pts, 0755); err != nil {
+		return err
+	}
+	if err := unix.Mount("devpts", pts, "devpts", unix.MS_NOSUID|unix.MS_NOEXEC, "newinstance,ptmxmode=0666,mode=0620"); err != nil {
+		return fmt.Errorf("failed to mount /dev/pts: %v", err)
+	}
+	shm := filepath.Join(dev, "shm")
+	if err := os.Mkdir(shm, 01777); err != nil {
+		return err
+	}
+	if err := unix.Mount("shm", shm, "tmpfs", unix.MS_NOSUID|unix.MS_NODEV|unix.MS_NOEXEC, "mode=1777,size=65536k"); err != nil {
+		return fmt.Errorf("failed to mount /dev/shm: %v", err)
+	}
+	for link, target := range devSymlinks {
+		if err := os.Symlink(target, filepath.Join(rootfs, link)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// bindMount bind mounts source of the host on the path of the container,
+// creating the mount point if the image does not have it.
+func bindMount(rootfs, source, containerPath string, readOnly bool) error {
+	target, err := filesystem.SecureJoin(rootfs, containerPath)
+	if err != nil {
+		return err
+	}
+	info, err := os.Stat(source)
+	if err != nil {
+		return fmt.Errorf("failed to mount %q: %v", containerPath, err)
+	}
+	if info.IsDir() {
+		err = os.MkdirAll(target, 0755)
+	} else if err = os.MkdirAll(filepath.Dir(target), 0755); err == nil {
+		var f *os.File
+		if f, err = os.OpenFile(target, os.O_CREATE|os.O_RDONLY, 0644); err == nil {
+			f.Close()
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("failed to create the mount point of %q: %v", containerPath, err)
+	}
+
+	if err := unix.Mount(source, target, "", unix.MS_BIND|unix.MS_REC, ""); err != nil {
+		return fmt.Errorf("failed to mount %q: %v", containerPath, err)
+	}
+	if readOnly {
+		if err := unix.Mount("", target, "", unix.MS_BIND|unix.MS_REMOUNT|unix.MS_RDONLY, ""); err != nil {
+			return fmt.Errorf("failed to make %q read-only: %v", containerPath, err)
+		}
+	}
+	return nil
+}
+
+// bindPodFiles bind mounts the hostFiles of the pod among mounts over the
+// ones of the host, in the mount namespace of the calling thread. A file
+// already mounted by a previous container of the pod is left alone.
+func bindPodFiles(mounts []kubecontainer.Mount) error {
+	for _, mount := range mounts {
+		if !isHostFile(mount.ContainerPath) {
+			continue
+		}
+		source, err := os.Stat(mount.HostPath)
+		if err != nil {
+			return fmt.Errorf("failed to mount %q: %v", mount.ContainerPath, err)
+		}
+		if target, err := os.Stat(mount.ContainerPath); err == nil && os.SameFile(source, target) {
+			continue
+		}
+		if err := bindMount("/", mount.HostPath, mount.ContainerPath, mount.ReadOnly); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// unmountRootfs lazily unmounts the root filesystem with everything mounted
+// in it.
+func unmountRootfs(rootfs string) error {
+	if err := unix.Unmount(rootfs, unix.MNT_DETACH); err != nil && !errors.Is(err, unix.EINVAL) && !errors.Is(err, unix.ENOENT) {
+		return err
+	}
+	return nil
+}
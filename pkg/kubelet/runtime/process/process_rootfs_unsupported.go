@@ -0,0 +1,26 @@
+//go:build !linux
+// +build !linux
+
+package process
+
+import (
+	"fmt"
+
+	kubecontainer "github.com/xuliangTang/mykubelet/pkg/kubelet/container"
+)
+
+// setupRootfs is not supported on this platform, containers run the binaries
+// of the host.
+func setupRootfs(rootfs, dir string, spec *rootfsSpec) error {
+	return fmt.Errorf("image root filesystems are not supported on this platform")
+}
+
+func unmountRootfs(rootfs string) error {
+	return nil
+}
+
+// bindPodFiles is not supported on this platform, containers share the files
+// of the host.
+func bindPodFiles(mounts []kubecontainer.Mount) error {
+	return fmt.Errorf("pod files are not supported on this platform")
+}
@@ -0,0 +1,294 @@
+package process
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"time"
+
+	"github.com/xuliangTang/mykubelet/pkg/kubelet/network/dns"
+	"github.com/xuliangTang/mykubelet/pkg/kubelet/runtime/hostport"
+	"github.com/xuliangTang/mykubelet/pkg/kubelet/runtime/ipam"
+	v1 "k8s.io/api/core/v1"
+	runtimeapi "k8s.io/cri-api/pkg/apis/runtime/v1alpha2"
+	"k8s.io/klog/v2"
+)
+
+// sandboxNamespaces describes the namespaces of an isolated pod. The pod
+// always gets its own mount namespace, the other kinds can be shared with
+// the host.
+type sandboxNamespaces struct {
+	// Pid is the pid of the process holding the namespaces.
+	Pid int `json:"pid"`
+	// PID, IPC and UTS are whether the pod has its own namespace of the kind.
+	PID bool `json:"pidNamespace"`
+	IPC bool `json:"ipcNamespace"`
+	UTS bool `json:"utsNamespace"`
+	// Network is whether the pod has its own network namespace, set up by
+	// the network plugin.
+	Network bool `json:"networkNamespace,omitempty"`
+	// Hostname is the hostname of the pod, set in its UTS namespace.
+	Hostname string `json:"hostname,omitempty"`
+}
+
+// options returns the namespace options reported in the sandbox status.
+func (n *sandboxNamespaces) options() *runtimeapi.NamespaceOption {
+	mode := func(isolated bool) runtimeapi.NamespaceMode {
+		if isolated {
+			return runtimeapi.NamespaceMode_POD
+		}
+		return runtimeapi.NamespaceMode_NODE
+	}
+	if n == nil {
+		return &runtimeapi.NamespaceOption{
+			Network: runtimeapi.NamespaceMode_NODE,
+			Pid:     runtimeapi.NamespaceMode_NODE,
+			Ipc:     runtimeapi.NamespaceMode_NODE,
+		}
+	}
+	return &runtimeapi.NamespaceOption{
+		Network: mode(n.Network),
+		Pid:     mode(n.PID),
+		Ipc:     mode(n.IPC),
+	}
+}
+
+// newSandboxNamespaces returns the namespaces of an isolated pod. hostPID and
+// hostIPC keep the namespace of the host, and so does hostNetwork for the UTS
+// namespace: a pod in the network of the host has the hostname of the host.
+// Other pods get a network namespace of their own if there is a network
+// plugin to set it up.
+func (m *processManager) newSandboxNamespaces(pod *v1.Pod) (*sandboxNamespaces, error) {
+	ns := &sandboxNamespaces{
+		PID:     !pod.Spec.HostPID,
+		IPC:     !pod.Spec.HostIPC,
+		UTS:     !pod.Spec.HostNetwork,
+		Network: !pod.Spec.HostNetwork && m.networkPlugin != nil,
+	}
+	if ns.UTS {
+		hostname, _, err := m.runtimeHelper.GeneratePodHostNameAndDomain(pod)
+		if err != nil {
+			return nil, err
+		}
+		ns.Hostname = hostname
+	}
+	return ns, nil
+}
+
+// createPodSandbox creates a pod sandbox and returns (podSandBoxID, error).
+// A process sandbox is a record grouping the containers of one pod run. In
+// the namespace isolation mode it also starts the process holding the
+// namespaces of the pod. A sandbox with a network namespace gets its IPs
+// allocated from the pod CIDRs by the local IPAM, its network is set up
+// afterwards by setUpPodNetwork with these IPs. The other sandboxes share
+// the network of the host and have no IPs of their own.
+func (m *processManager) createPodSandbox(pod *v1.Pod, attempt uint32) (string, error) {
+	id, err := newID()
+	if err != nil {
+		return "", err
+	}
+	s := &sandboxRecord{
+		ID:           id,
+		PodUID:       pod.UID,
+		PodName:      pod.Name,
+		PodNamespace: pod.Namespace,
+		Attempt:      attempt,
+		State:        runtimeapi.PodSandboxState_SANDBOX_READY,
+		CreatedAt:    time.Now(),
+	}
+
+	var ns *sandboxNamespaces
+	if m.namespaceIsolation {
+		if ns, err = m.newSandboxNamespaces(pod); err != nil {
+			return "", fmt.Errorf("failed to generate sandbox namespaces for pod %q: %v", pod.Name, err)
+		}
+	}
+	// cleanup gives back the IPs and removes the files of a sandbox that
+	// failed to be created.
+	cleanup := func() {
+		if err := m.ipam.Release(id); err != nil {
+			klog.ErrorS(err, "Failed to release the IPs of pod sandbox", "podSandboxID", id)
+		}
+		if err := m.store.removeSandbox(id); err != nil {
+			klog.ErrorS(err, "Failed to remove the files of pod sandbox", "podSandboxID", id)
+		}
+	}
+
+	// The resolv.conf of the pod is generated once per sandbox, and mounted
+	// into each of its containers.
+	if ns != nil {
+		if s.ResolvConfPath, err = m.writeResolvConf(pod, id); err != nil {
+			cleanup()
+			klog.ErrorS(err, "Failed to generate the resolv.conf of pod", "pod", klog.KObj(pod))
+			return "", fmt.Errorf("failed to generate the resolv.conf of pod %q: %v", pod.Name, err)
+		}
+	}
+
+	if ns != nil && ns.Network {
+		switch _, err := m.ipam.Allocate(id); {
+		case err == ipam.ErrNoPodCIDR:
+			klog.V(4).InfoS("Node has no pod CIDR, the network plugin allocates the IPs of the pod", "pod", klog.KObj(pod))
+		case err != nil:
+			cleanup()
+			klog.ErrorS(err, "Failed to allocate IPs for pod", "pod", klog.KObj(pod))
+			return "", fmt.Errorf("failed to allocate IPs for pod %q: %v", pod.Name, err)
+		}
+	}
+	var cmd *exec.Cmd
+	if ns != nil {
+		cmd, err = startSandboxProcess(ns)
+		if err != nil {
+			cleanup()
+			klog.ErrorS(err, "Failed to start sandbox process for pod", "pod", klog.KObj(pod))
+			return "", fmt.Errorf("failed to start sandbox process for pod %q: %v", pod.Name, err)
+		}
+		s.Namespaces = ns
+		s.done = make(chan struct{})
+		if ns.Network {
+			s.HostPorts = hostport.PortMappings(pod)
+		}
+	}
+
+	if err := m.store.saveSandbox(s); err != nil {
+		if cmd != nil {
+			cmd.Process.Kill()
+			cmd.Wait()
+		}
+		cleanup()
+		klog.ErrorS(err, "Failed to create sandbox for pod", "pod", klog.KObj(pod))
+		return "", fmt.Errorf("failed to create sandbox for pod %q: %v", pod.Name, err)
+	}
+
+	m.lock.Lock()
+	m.sandboxes[id] = s
+	m.lock.Unlock()
+	if cmd != nil {
+		go m.waitSandbox(s, cmd)
+	}
+	return id, nil
+}
+
+// writeResolvConf generates the resolv.conf of the sandbox with the given id
+// from the DNS settings of the pod, and returns its path.
+func (m *processManager) writeResolvConf(pod *v1.Pod, id string) (string, error) {
+	dnsConfig, err := m.runtimeHelper.GetPodDNS(pod)
+	if err != nil {
+		return "", err
+	}
+	dir := m.store.sandboxDir(id)
+	if err := os.MkdirAll(dir, 0750); err != nil {
+		return "", err
+	}
+	path := filepath.Join(dir, resolvConfFileName)
+	if err := dns.WriteResolvConf(path, dnsConfig); err != nil {
+		return "", err
+	}
+	return path, nil
+}
+
+// stopPodSandbox marks the sandbox as not ready, stops forwarding its host
+// ports and releases its IPs. The
+// process holding the namespaces of the sandbox is killed, and with it every
+// process left in the pid namespace of the pod.
+func (m *processManager) stopPodSandbox(id string) error {
+	m.lock.Lock()
+	s, ok := m.sandboxes[id]
+	if !ok {
+		m.lock.Unlock()
+		return fmt.Errorf("pod sandbox %q not found", id)
+	}
+	if s.State != runtimeapi.PodSandboxState_SANDBOX_NOTREADY {
+		s.State = runtimeapi.PodSandboxState_SANDBOX_NOTREADY
+		if err := m.store.saveSandbox(s); err != nil {
+			m.lock.Unlock()
+			return err
+		}
+	}
+	m.lock.Unlock()
+
+	m.hostPorts.Remove(id)
+	if err := m.ipam.Release(id); err != nil {
+		return fmt.Errorf("failed to release the IPs of pod sandbox %q: %v", id, err)
+	}
+	if s.Namespaces == nil || s.exited() {
+		return nil
+	}
+	if p, err := os.FindProcess(s.Namespaces.Pid); err == nil {
+		if err := p.Kill(); err != nil && !errors.Is(err, os.ErrProcessDone) {
+			return fmt.Errorf("failed to kill the process of pod sandbox %q: %v", id, err)
+		}
+	}
+	select {
+	case <-s.done:
+	case <-time.After(killWaitTimeout):
+		return fmt.Errorf("timed out waiting for the process of pod sandbox %q to exit", id)
+	}
+	return nil
+}
+
+// exited returns true if the sandbox has no process, or once it has exited.
+func (r *sandboxRecord) exited() bool {
+	if r.done == nil {
+		return true
+	}
+	select {
+	case <-r.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// waitSandbox reaps the process holding the namespaces of a sandbox.
+func (m *processManager) waitSandbox(s *sandboxRecord, cmd *exec.Cmd) {
+	err := cmd.Wait()
+	klog.V(3).InfoS("Sandbox process exited", "podSandboxID", s.ID, "pod", klog.KRef(s.PodNamespace, s.PodName), "err", err)
+	m.markSandboxExited(s)
+}
+
+// watchAdoptedSandbox polls the process of a sandbox that is not a child of
+// this kubelet until it exits.
+func (m *processManager) watchAdoptedSandbox(s *sandboxRecord) {
+	for processAlive(s.Namespaces.Pid) {
+		time.Sleep(time.Second)
+	}
+	klog.V(3).InfoS("Sandbox process exited", "podSandboxID", s.ID, "pod", klog.KRef(s.PodNamespace, s.PodName))
+	m.markSandboxExited(s)
+}
+
+// markSandboxExited marks a sandbox whose process went away as not ready,
+// its namespaces can not be joined anymore.
+func (m *processManager) markSandboxExited(s *sandboxRecord) {
+	m.lock.Lock()
+	if s.State != runtimeapi.PodSandboxState_SANDBOX_NOTREADY {
+		s.State = runtimeapi.PodSandboxState_SANDBOX_NOTREADY
+		if err := m.store.saveSandbox(s); err != nil {
+			klog.ErrorS(err, "Failed to persist sandbox record", "podSandboxID", s.ID)
+		}
+	}
+	m.lock.Unlock()
+	close(s.done)
+}
+
+// runInSandbox runs fn in the namespaces of the sandbox.
+func runInSandbox(s *sandboxRecord, fn func() error) error {
+	if s.Namespaces == nil {
+		return fn()
+	}
+	return runInNamespaces(s.Namespaces, fn)
+}
+
+// startInSandbox starts cmd in the namespaces of the sandbox.
+func startInSandbox(cmd *exec.Cmd, s *sandboxRecord) error {
+	return runInSandbox(s, cmd.Start)
+}
+
+// getSandbox returns the sandbox record with the given id.
+func (m *processManager) getSandbox(id string) (*sandboxRecord, bool) {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+	s, ok := m.sandboxes[id]
+	return s, ok
+}
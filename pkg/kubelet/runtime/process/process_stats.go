@@ -0,0 +1,31 @@
+package process
+
+import (
+	kubecontainer "github.com/xuliangTang/mykubelet/pkg/kubelet/container"
+	"github.com/xuliangTang/mykubelet/pkg/kubelet/stats"
+)
+
+// ListContainerInfo returns the running containers, for their usage to be sampled.
+func (m *processManager) ListContainerInfo() ([]stats.ContainerInfo, error) {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+
+	var infos []stats.ContainerInfo
+	for _, c := range m.containers {
+		if c.State != kubecontainer.ContainerStateRunning {
+			continue
+		}
+		infos = append(infos, stats.ContainerInfo{
+			ID:           c.ID,
+			Name:         c.Name,
+			PodUID:       c.PodUID,
+			PodName:      c.PodName,
+			PodNamespace: c.PodNamespace,
+			StartTime:    c.StartedAt,
+			Pid:          c.Pid,
+			CgroupPath:   c.CgroupPath,
+			LogPath:      c.LogPath,
+		})
+	}
+	return infos, nil
+}
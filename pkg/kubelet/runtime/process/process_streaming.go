@@ -0,0 +1,260 @@
+package process
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"sync"
+
+	kubecontainer "github.com/xuliangTang/mykubelet/pkg/kubelet/container"
+	"github.com/xuliangTang/mykubelet/pkg/kubelet/cri/streaming"
+	"github.com/xuliangTang/mykubelet/pkg/kubelet/util/format"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/remotecommand"
+	runtimeapi "k8s.io/cri-api/pkg/apis/runtime/v1alpha2"
+	"k8s.io/klog/v2"
+)
+
+// streamingBasePath is the path the streaming URLs of the process runtime
+// are relative to. They are served by the kubelet server through ServeHTTP.
+const streamingBasePath = "/cri/"
+
+// newStreamingServer creates the server of the exec, attach and port-forward
+// streams of the process runtime.
+func newStreamingServer(m *processManager) (streaming.Server, error) {
+	config := streaming.DefaultConfig
+	config.BaseURL = &url.URL{Path: streamingBasePath}
+	return streaming.NewServer(config, &streamingRuntime{m})
+}
+
+// ServeHTTP serves the streaming URLs returned by GetExec, GetAttach and
+// GetPortForward.
+func (m *processManager) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	m.streamingServer.ServeHTTP(w, r)
+}
+
+// GetExec gets the URL the exec will be served from.
+func (m *processManager) GetExec(id kubecontainer.ContainerID, cmd []string, stdin, stdout, stderr, tty bool) (*url.URL, error) {
+	req := &runtimeapi.ExecRequest{
+		ContainerId: id.ID,
+		Cmd:         cmd,
+		Tty:         tty,
+		Stdin:       stdin,
+		Stdout:      stdout,
+		Stderr:      stderr,
+	}
+	resp, err := m.streamingServer.GetExec(req)
+	if err != nil {
+		return nil, err
+	}
+	return url.Parse(resp.Url)
+}
+
+// GetAttach gets the URL the attach will be served from.
+func (m *processManager) GetAttach(id kubecontainer.ContainerID, stdin, stdout, stderr, tty bool) (*url.URL, error) {
+	req := &runtimeapi.AttachRequest{
+		ContainerId: id.ID,
+		Stdin:       stdin,
+		Stdout:      stdout,
+		Stderr:      stderr,
+		Tty:         tty,
+	}
+	resp, err := m.streamingServer.GetAttach(req)
+	if err != nil {
+		return nil, err
+	}
+	return url.Parse(resp.Url)
+}
+
+// GetPortForward gets the URL the port-forward will be served from.
+func (m *processManager) GetPortForward(podName, podNamespace string, podUID types.UID, ports []int32) (*url.URL, error) {
+	sandboxID, ok := m.readySandboxID(podUID)
+	if !ok {
+		return nil, fmt.Errorf("failed to find sandboxID for pod %s", format.PodDesc(podName, podNamespace, podUID))
+	}
+	req := &runtimeapi.PortForwardRequest{
+		PodSandboxId: sandboxID,
+		Port:         ports,
+	}
+	resp, err := m.streamingServer.GetPortForward(req)
+	if err != nil {
+		return nil, err
+	}
+	return url.Parse(resp.Url)
+}
+
+// readySandboxID returns the id of the ready sandbox of the pod.
+func (m *processManager) readySandboxID(podUID types.UID) (string, bool) {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+	for _, s := range m.sandboxes {
+		if s.PodUID == podUID && s.State == runtimeapi.PodSandboxState_SANDBOX_READY {
+			return s.ID, true
+		}
+	}
+	return "", false
+}
+
+// streamingRuntime executes the streaming requests of the streaming server
+// in the containers of the process runtime.
+type streamingRuntime struct {
+	m *processManager
+}
+
+var _ streaming.Runtime = &streamingRuntime{}
+
+// Exec runs cmd in the container the way RunInContainer does, copying its
+// stdio from and to the streams of the client. With tty the command runs
+// in a terminal of its own, resized as the client asks for.
+func (r *streamingRuntime) Exec(containerID string, cmd []string, in io.Reader, out, errw io.WriteCloser, tty bool, resize <-chan remotecommand.TerminalSize) error {
+	c, record, sandbox, err := r.m.newContainerCommand(buildContainerID(containerID), cmd, tty)
+	if err != nil {
+		return err
+	}
+
+	// copyStdin copies in to the stdin of the command, closing it once in
+	// ends so that the command reads EOF.
+	var copyStdin func(stdin io.WriteCloser)
+	if in != nil {
+		copyStdin = func(stdin io.WriteCloser) {
+			if _, err := io.Copy(stdin, in); err != nil {
+				klog.V(4).InfoS("Failed to copy stdin to exec", "containerID", containerID, "err", err)
+			}
+			stdin.Close()
+		}
+	}
+
+	if !tty {
+		var stdinW *os.File
+		if in != nil {
+			// The stdin of the command is a pipe the kubelet copies into, the
+			// command must not wait for the client to close its stdin once it
+			// exited.
+			stdinR, w, err := os.Pipe()
+			if err != nil {
+				return err
+			}
+			defer stdinR.Close()
+			c.Stdin, stdinW = stdinR, w
+		}
+		if out != nil {
+			c.Stdout = out
+		}
+		if errw != nil {
+			c.Stderr = errw
+		}
+		wait, err := r.m.startContainerCommand(c, record, sandbox)
+		if err != nil {
+			if stdinW != nil {
+				stdinW.Close()
+			}
+			return err
+		}
+		if stdinW != nil {
+			go copyStdin(stdinW)
+		}
+		return commandExitError(cmd, wait(), nil)
+	}
+
+	master, slave, err := openTerminal()
+	if err != nil {
+		return fmt.Errorf("failed to allocate a terminal: %v", err)
+	}
+	defer master.Close()
+	c.Stdin, c.Stdout, c.Stderr = slave, slave, slave
+	if resize != nil {
+		go func() {
+			for size := range resize {
+				if err := setTerminalSize(master, size); err != nil {
+					klog.V(4).InfoS("Failed to resize the terminal of exec", "containerID", containerID, "err", err)
+				}
+			}
+		}()
+	}
+	wait, err := r.m.startContainerCommand(c, record, sandbox)
+	slave.Close()
+	if err != nil {
+		return err
+	}
+	if copyStdin != nil {
+		go copyStdin(nopCloser{master})
+	}
+	var output sync.WaitGroup
+	if out != nil {
+		output.Add(1)
+		go func() {
+			defer output.Done()
+			io.Copy(out, terminalReader{master})
+		}()
+	}
+	err = wait()
+	// The output left in the terminal is read until its last holder closes it.
+	output.Wait()
+	return commandExitError(cmd, err, nil)
+}
+
+// Attach attaches to the process of the container.
+func (r *streamingRuntime) Attach(containerID string, in io.Reader, out, errw io.WriteCloser, tty bool, resize <-chan remotecommand.TerminalSize) error {
+	return r.m.AttachContainer(buildContainerID(containerID), in, out, errw, tty, resize)
+}
+
+// PortForward copies data between stream and the port of the sandbox. The
+// port is dialed on the loopback interface, in the network namespace of the
+// sandbox if it has one.
+func (r *streamingRuntime) PortForward(podSandboxID string, port int32, stream io.ReadWriteCloser) error {
+	defer stream.Close()
+	sandbox, ok := r.m.getSandbox(podSandboxID)
+	if !ok {
+		return fmt.Errorf("pod sandbox %q not found", podSandboxID)
+	}
+	r.m.lock.RLock()
+	state := sandbox.State
+	r.m.lock.RUnlock()
+	if state != runtimeapi.PodSandboxState_SANDBOX_READY {
+		return fmt.Errorf("pod sandbox %q is not ready", podSandboxID)
+	}
+
+	var conn net.Conn
+	dial := func() (err error) {
+		conn, err = net.Dial("tcp", net.JoinHostPort("localhost", strconv.Itoa(int(port))))
+		return err
+	}
+	var err error
+	if sandbox.hasPodNetwork() {
+		err = runInNetworkNamespace(sandbox.Namespaces, dial)
+	} else {
+		err = dial()
+	}
+	if err != nil {
+		return fmt.Errorf("failed to connect to port %d of pod sandbox %q: %v", port, podSandboxID, err)
+	}
+	defer conn.Close()
+
+	go func() {
+		if _, err := io.Copy(conn, stream); err != nil {
+			klog.V(4).InfoS("Failed to copy port-forward stream to the pod", "podSandboxID", podSandboxID, "port", port, "err", err)
+		}
+		// The client is done sending, the pod reads EOF.
+		if tcp, ok := conn.(*net.TCPConn); ok {
+			tcp.CloseWrite()
+		}
+	}()
+	if _, err := io.Copy(stream, conn); err != nil {
+		return fmt.Errorf("failed to copy data from port %d of pod sandbox %q: %v", port, podSandboxID, err)
+	}
+	return nil
+}
+
+// nopCloser keeps the terminal open once the stdin of the client ends, the
+// terminal is closed by Exec.
+type nopCloser struct {
+	io.Writer
+}
+
+func (nopCloser) Close() error {
+	return nil
+}
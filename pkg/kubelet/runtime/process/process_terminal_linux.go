@@ -0,0 +1,83 @@
+//go:build linux
+// +build linux
+
+package process
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+	"k8s.io/client-go/tools/remotecommand"
+)
+
+// openTerminal allocates a pseudo terminal. The slave is handed to the
+// process as its stdin, stdout and stderr, the kubelet reads and writes the
+// master.
+func openTerminal() (master, slave *os.File, err error) {
+	master, err = os.OpenFile("/dev/ptmx", os.O_RDWR|syscall.O_NOCTTY|syscall.O_CLOEXEC, 0)
+	if err != nil {
+		return nil, nil, err
+	}
+	var n int
+	// The descriptor is used through its raw connection, Fd would switch it
+	// to blocking mode.
+	if err := controlFile(master, func(fd int) error {
+		if err := unix.IoctlSetPointerInt(fd, unix.TIOCSPTLCK, 0); err != nil {
+			return fmt.Errorf("failed to unlock the terminal: %v", err)
+		}
+		var err error
+		if n, err = unix.IoctlGetInt(fd, unix.TIOCGPTN); err != nil {
+			return fmt.Errorf("failed to get the number of the terminal: %v", err)
+		}
+		return nil
+	}); err != nil {
+		master.Close()
+		return nil, nil, err
+	}
+	slave, err = os.OpenFile(fmt.Sprintf("/dev/pts/%d", n), os.O_RDWR|syscall.O_NOCTTY|syscall.O_CLOEXEC, 0)
+	if err != nil {
+		master.Close()
+		return nil, nil, err
+	}
+	return master, slave, nil
+}
+
+// setTerminalSize resizes the terminal of master.
+func setTerminalSize(master *os.File, size remotecommand.TerminalSize) error {
+	return controlFile(master, func(fd int) error {
+		return unix.IoctlSetWinsize(fd, unix.TIOCSWINSZ, &unix.Winsize{Row: size.Height, Col: size.Width})
+	})
+}
+
+// controlFile runs fn with the descriptor of f.
+func controlFile(f *os.File, fn func(fd int) error) error {
+	conn, err := f.SyscallConn()
+	if err != nil {
+		return err
+	}
+	var fnErr error
+	if err := conn.Control(func(fd uintptr) {
+		fnErr = fn(int(fd))
+	}); err != nil {
+		return err
+	}
+	return fnErr
+}
+
+// terminalReader reads the master of a terminal. Reading fails with EIO once
+// no process holds the slave anymore, which is the end of the output.
+type terminalReader struct {
+	master *os.File
+}
+
+func (r terminalReader) Read(p []byte) (int, error) {
+	n, err := r.master.Read(p)
+	if errors.Is(err, syscall.EIO) {
+		return n, io.EOF
+	}
+	return n, err
+}
@@ -0,0 +1,27 @@
+//go:build !linux
+// +build !linux
+
+package process
+
+import (
+	"fmt"
+	"os"
+
+	"k8s.io/client-go/tools/remotecommand"
+)
+
+func openTerminal() (master, slave *os.File, err error) {
+	return nil, nil, fmt.Errorf("terminals are not supported on this platform")
+}
+
+func setTerminalSize(master *os.File, size remotecommand.TerminalSize) error {
+	return nil
+}
+
+type terminalReader struct {
+	master *os.File
+}
+
+func (r terminalReader) Read(p []byte) (int, error) {
+	return r.master.Read(p)
+}
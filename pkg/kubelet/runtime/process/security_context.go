@@ -0,0 +1,368 @@
+package process
+
+import (
+	"fmt"
+	"os"
+	"os/user"
+	"strconv"
+	"strings"
+
+	"github.com/xuliangTang/mykubelet/pkg/kubelet/util/format"
+	"github.com/xuliangTang/mykubelet/pkg/securitycontext"
+	"github.com/xuliangTang/mykubelet/pkg/util/filesystem"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+)
+
+// capabilityAll adds or drops all the capabilities.
+const capabilityAll = "ALL"
+
+// capabilityNames are the names of the Linux capabilities, indexed by number.
+var capabilityNames = []string{
+	"CAP_CHOWN",
+	"CAP_DAC_OVERRIDE",
+	"CAP_DAC_READ_SEARCH",
+	"CAP_FOWNER",
+	"CAP_FSETID",
+	"CAP_KILL",
+	"CAP_SETGID",
+	"CAP_SETUID",
+	"CAP_SETPCAP",
+	"CAP_LINUX_IMMUTABLE",
+	"CAP_NET_BIND_SERVICE",
+	"CAP_NET_BROADCAST",
+	"CAP_NET_ADMIN",
+	"CAP_NET_RAW",
+	"CAP_IPC_LOCK",
+	"CAP_IPC_OWNER",
+	"CAP_SYS_MODULE",
+	"CAP_SYS_RAWIO",
+	"CAP_SYS_CHROOT",
+	"CAP_SYS_PTRACE",
+	"CAP_SYS_PACCT",
+	"CAP_SYS_ADMIN",
+	"CAP_SYS_BOOT",
+	"CAP_SYS_NICE",
+	"CAP_SYS_RESOURCE",
+	"CAP_SYS_TIME",
+	"CAP_SYS_TTY_CONFIG",
+	"CAP_MKNOD",
+	"CAP_LEASE",
+	"CAP_AUDIT_WRITE",
+	"CAP_AUDIT_CONTROL",
+	"CAP_SETFCAP",
+	"CAP_MAC_OVERRIDE",
+	"CAP_MAC_ADMIN",
+	"CAP_SYSLOG",
+	"CAP_WAKE_ALARM",
+	"CAP_BLOCK_SUSPEND",
+	"CAP_AUDIT_READ",
+	"CAP_PERFMON",
+	"CAP_BPF",
+	"CAP_CHECKPOINT_RESTORE",
+}
+
+// defaultCapabilities are the capabilities a container runs with unless its
+// security context adds or drops some, the same as the default of containerd.
+var defaultCapabilities = []string{
+	"CAP_CHOWN",
+	"CAP_DAC_OVERRIDE",
+	"CAP_FSETID",
+	"CAP_FOWNER",
+	"CAP_MKNOD",
+	"CAP_NET_RAW",
+	"CAP_SETGID",
+	"CAP_SETUID",
+	"CAP_SETFCAP",
+	"CAP_SETPCAP",
+	"CAP_NET_BIND_SERVICE",
+	"CAP_SYS_CHROOT",
+	"CAP_KILL",
+	"CAP_AUDIT_WRITE",
+}
+
+// securityConfig is what the security context of a container translates to
+// for its processes. It is kept in the container record, so that commands run
+// in the container get the same.
+type securityConfig struct {
+	// Credential of the processes, nil to run as the user of the kubelet.
+	UID    *int64  `json:"uid,omitempty"`
+	GID    *int64  `json:"gid,omitempty"`
+	Groups []int64 `json:"groups,omitempty"`
+
+	// Privileged processes keep all the capabilities of the kubelet.
+	Privileged bool `json:"privileged,omitempty"`
+	// Capabilities is the bounding set of the processes, the capabilities
+	// they get when running as root.
+	Capabilities []string `json:"capabilities,omitempty"`
+	// AmbientCapabilities are the capabilities the processes get when
+	// running as another user: the ones added explicitly.
+	AmbientCapabilities []string `json:"ambientCapabilities,omitempty"`
+
+	// NoNewPrivileges sets no_new_privs, so that the processes can not gain
+	// privileges through setuid binaries or file capabilities.
+	NoNewPrivileges bool `json:"noNewPrivileges,omitempty"`
+}
+
+// newSecurityConfig translates the effective security context of the
+// container. Processes run as the user of the kubelet unless the security
+// context sets one, or as the user of their image when they run in the root
+// filesystem rootfs of the image. readOnlyRootFilesystem is not part of it,
+// it applies to the root filesystem of the container when it has one.
+func newSecurityConfig(pod *v1.Pod, container *v1.Container, extraSupplementalGroups []int64, rootfs, imageUser string) (*securityConfig, error) {
+	effectiveSc := securitycontext.DetermineEffectiveSecurityContext(pod, container)
+	config := &securityConfig{
+		NoNewPrivileges: securitycontext.AddNoNewPrivileges(effectiveSc),
+	}
+
+	if rootfs != "" {
+		uid, gid, err := resolveImageUser(rootfs, imageUser)
+		if err != nil {
+			return nil, err
+		}
+		if effectiveSc.RunAsUser != nil {
+			uid = *effectiveSc.RunAsUser
+			gid = primaryGroupOf(rootfs, uid)
+		}
+		if effectiveSc.RunAsGroup != nil {
+			gid = *effectiveSc.RunAsGroup
+		}
+		config.UID, config.GID = &uid, &gid
+	} else if effectiveSc.RunAsUser != nil || effectiveSc.RunAsGroup != nil {
+		uid := int64(os.Getuid())
+		if effectiveSc.RunAsUser != nil {
+			uid = *effectiveSc.RunAsUser
+		}
+		gid := int64(os.Getgid())
+		if effectiveSc.RunAsGroup != nil {
+			gid = *effectiveSc.RunAsGroup
+		} else if effectiveSc.RunAsUser != nil {
+			gid = primaryGroupOf("", uid)
+		}
+		config.UID, config.GID = &uid, &gid
+	}
+	if podSc := pod.Spec.SecurityContext; podSc != nil {
+		config.Groups = append(config.Groups, podSc.SupplementalGroups...)
+		if podSc.FSGroup != nil {
+			config.Groups = append(config.Groups, *podSc.FSGroup)
+		}
+	}
+	config.Groups = append(config.Groups, extraSupplementalGroups...)
+	if len(config.Groups) > 0 && config.UID == nil {
+		uid, gid := int64(os.Getuid()), int64(os.Getgid())
+		config.UID, config.GID = &uid, &gid
+	}
+
+	if effectiveSc.Privileged != nil && *effectiveSc.Privileged {
+		config.Privileged = true
+		return config, nil
+	}
+	capabilities, added, err := determineCapabilities(effectiveSc.Capabilities)
+	if err != nil {
+		return nil, err
+	}
+	config.Capabilities = capabilities
+	if runAsRoot := (config.UID == nil && os.Getuid() == 0) || (config.UID != nil && *config.UID == 0); !runAsRoot {
+		config.AmbientCapabilities = added
+	}
+	return config, nil
+}
+
+// primaryGroupOf returns the primary group of the user in the passwd database
+// of the root filesystem, or of the host if rootfs is empty. It is 0 for
+// unknown users the way container runtimes do it.
+func primaryGroupOf(rootfs string, uid int64) int64 {
+	if rootfs != "" {
+		entries, err := readIDDatabase(rootfs, "/etc/passwd")
+		if err != nil {
+			return 0
+		}
+		for _, entry := range entries {
+			if len(entry) > 3 && entry[2] == strconv.FormatInt(uid, 10) {
+				if gid, err := strconv.ParseInt(entry[3], 10, 64); err == nil {
+					return gid
+				}
+			}
+		}
+		return 0
+	}
+	u, err := user.LookupId(strconv.FormatInt(uid, 10))
+	if err != nil {
+		return 0
+	}
+	gid, err := strconv.ParseInt(u.Gid, 10, 64)
+	if err != nil {
+		return 0
+	}
+	return gid
+}
+
+// resolveImageUser resolves the user of an image, user[:group] with names
+// or ids, in the passwd and group databases of its root filesystem. Images
+// run as root by default.
+func resolveImageUser(rootfs, imageUser string) (int64, int64, error) {
+	name, group, hasGroup := strings.Cut(imageUser, ":")
+	var uid, gid int64
+	if name != "" {
+		id, err := strconv.ParseInt(name, 10, 64)
+		if err == nil {
+			uid = id
+			gid = primaryGroupOf(rootfs, uid)
+		} else {
+			entries, err := readIDDatabase(rootfs, "/etc/passwd")
+			if err != nil {
+				return 0, 0, err
+			}
+			found := false
+			for _, entry := range entries {
+				if len(entry) > 3 && entry[0] == name {
+					uid, err = strconv.ParseInt(entry[2], 10, 64)
+					if err == nil {
+						gid, err = strconv.ParseInt(entry[3], 10, 64)
+					}
+					if err != nil {
+						return 0, 0, fmt.Errorf("invalid passwd entry of user %q of the image", name)
+					}
+					found = true
+					break
+				}
+			}
+			if !found {
+				return 0, 0, fmt.Errorf("unable to find user %q of the image", name)
+			}
+		}
+	}
+	if !hasGroup || group == "" {
+		return uid, gid, nil
+	}
+
+	if id, err := strconv.ParseInt(group, 10, 64); err == nil {
+		return uid, id, nil
+	}
+	entries, err := readIDDatabase(rootfs, "/etc/group")
+	if err != nil {
+		return 0, 0, err
+	}
+	for _, entry := range entries {
+		if len(entry) > 2 && entry[0] == group {
+			gid, err := strconv.ParseInt(entry[2], 10, 64)
+			if err != nil {
+				return 0, 0, fmt.Errorf("invalid group entry of group %q of the image", group)
+			}
+			return uid, gid, nil
+		}
+	}
+	return 0, 0, fmt.Errorf("unable to find group %q of the image", group)
+}
+
+// readIDDatabase returns the fields of the entries of /etc/passwd or
+// /etc/group in the root filesystem, none if the image does not have it.
+func readIDDatabase(rootfs, name string) ([][]string, error) {
+	path, err := filesystem.SecureJoin(rootfs, name)
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s of the image: %v", name, err)
+	}
+	var entries [][]string
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		entries = append(entries, strings.Split(line, ":"))
+	}
+	return entries, nil
+}
+
+// determineCapabilities returns the capabilities of the container, and those
+// of them added explicitly. ALL is applied before the individual capabilities,
+// so that adding ALL and dropping CHOWN leaves every capability but CHOWN.
+func determineCapabilities(capabilities *v1.Capabilities) ([]string, []string, error) {
+	caps := sets.NewString(defaultCapabilities...)
+	added := sets.NewString()
+	if capabilities == nil {
+		return caps.List(), nil, nil
+	}
+
+	for _, c := range capabilities.Add {
+		if strings.ToUpper(string(c)) == capabilityAll {
+			caps = sets.NewString(capabilityNames...)
+			added = sets.NewString(capabilityNames...)
+		}
+	}
+	for _, c := range capabilities.Drop {
+		if strings.ToUpper(string(c)) == capabilityAll {
+			caps = sets.NewString()
+			added = sets.NewString()
+		}
+	}
+	for _, c := range capabilities.Add {
+		if strings.ToUpper(string(c)) == capabilityAll {
+			continue
+		}
+		name, err := normalizeCapability(c)
+		if err != nil {
+			return nil, nil, err
+		}
+		caps.Insert(name)
+		added.Insert(name)
+	}
+	for _, c := range capabilities.Drop {
+		if strings.ToUpper(string(c)) == capabilityAll {
+			continue
+		}
+		name, err := normalizeCapability(c)
+		if err != nil {
+			return nil, nil, err
+		}
+		caps.Delete(name)
+		added.Delete(name)
+	}
+	return caps.List(), added.List(), nil
+}
+
+// normalizeCapability returns the CAP_ prefixed name of the capability.
+func normalizeCapability(capability v1.Capability) (string, error) {
+	name := strings.ToUpper(string(capability))
+	if !strings.HasPrefix(name, "CAP_") {
+		name = "CAP_" + name
+	}
+	for _, known := range capabilityNames {
+		if known == name {
+			return name, nil
+		}
+	}
+	return "", fmt.Errorf("unknown capability %q", capability)
+}
+
+// verifyRunAsNonRoot verifies RunAsNonRoot. uid is the user processes run as
+// unless the security context sets one: the user of the image or of the kubelet.
+func verifyRunAsNonRoot(pod *v1.Pod, container *v1.Container, uid *int64, username string) error {
+	effectiveSc := securitycontext.DetermineEffectiveSecurityContext(pod, container)
+	// If the option is not set, or if running as root is allowed, return nil.
+	if effectiveSc == nil || effectiveSc.RunAsNonRoot == nil || !*effectiveSc.RunAsNonRoot {
+		return nil
+	}
+
+	if effectiveSc.RunAsUser != nil {
+		if *effectiveSc.RunAsUser == 0 {
+			return fmt.Errorf("container's runAsUser breaks non-root policy (pod: %q, container: %s)", format.Pod(pod), container.Name)
+		}
+		return nil
+	}
+
+	switch {
+	case uid != nil && *uid == 0:
+		return fmt.Errorf("container has runAsNonRoot and image will run as root (pod: %q, container: %s)", format.Pod(pod), container.Name)
+	case uid == nil && len(username) > 0:
+		return fmt.Errorf("container has runAsNonRoot and image has non-numeric user (%s), cannot verify user is non-root (pod: %q, container: %s)", username, format.Pod(pod), container.Name)
+	default:
+		return nil
+	}
+}
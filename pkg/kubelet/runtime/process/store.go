@@ -0,0 +1,310 @@
+package process
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	kubecontainer "github.com/xuliangTang/mykubelet/pkg/kubelet/container"
+	"github.com/xuliangTang/mykubelet/pkg/kubelet/runtime/hostport"
+	"k8s.io/apimachinery/pkg/types"
+	runtimeapi "k8s.io/cri-api/pkg/apis/runtime/v1alpha2"
+)
+
+const (
+	containersDirName = "containers"
+	sandboxesDirName  = "sandboxes"
+	recordFileName    = "record.json"
+	// resolvConfFileName is the resolv.conf of a sandbox, next to its record.
+	resolvConfFileName = "resolv.conf"
+)
+
+// containerRecord is the runtime's bookkeeping for one container instance.
+// Every (re)start of a container in the pod spec produces a new record.
+type containerRecord struct {
+	ID           string    `json:"id"`
+	SandboxID    string    `json:"sandboxID"`
+	PodUID       types.UID `json:"podUID"`
+	PodName      string    `json:"podName"`
+	PodNamespace string    `json:"podNamespace"`
+	Name         string    `json:"name"`
+	Image        string    `json:"image"`
+	ImageID      string    `json:"imageID"`
+	Hash         uint64    `json:"hash"`
+	Attempt      int       `json:"attempt"`
+
+	State      kubecontainer.State `json:"state"`
+	CreatedAt  time.Time           `json:"createdAt"`
+	StartedAt  time.Time           `json:"startedAt"`
+	FinishedAt time.Time           `json:"finishedAt"`
+	ExitCode   int                 `json:"exitCode"`
+	Reason     string              `json:"reason"`
+	Message    string              `json:"message"`
+	Pid        int                 `json:"pid"`
+	LogPath    string              `json:"logPath"`
+
+	// Env and WorkingDir are the environment and working directory of the
+	// container process, commands run in the container inherit them.
+	Env        []string `json:"env,omitempty"`
+	WorkingDir string   `json:"workingDir,omitempty"`
+
+	// CgroupPath is the literal cgroupfs name of the cgroup enforcing the
+	// resources of the container, empty when they are not enforced.
+	CgroupPath string `json:"cgroupPath,omitempty"`
+
+	// Security is the security config of the processes of the container.
+	Security *securityConfig `json:"security,omitempty"`
+
+	// Rootfs is the root filesystem of the container, mounted in the mount
+	// namespace of its pod. It is empty when the container runs in the root
+	// filesystem of the host.
+	Rootfs string `json:"rootfs,omitempty"`
+
+	// TTY is true if the process of the container leads the session of its
+	// terminal, commands run in the container can not join its process group.
+	TTY bool `json:"tty,omitempty"`
+
+	// streams are the stdio streams of the process clients attach to, nil if
+	// the process was started by a previous kubelet.
+	streams *containerStreams
+
+	// done is closed once the process of the container has exited.
+	done chan struct{}
+}
+
+// exited returns true once the process of the container has exited.
+func (r *containerRecord) exited() bool {
+	select {
+	case <-r.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// toStatus converts the record into a kubecontainer.Status.
+func (r *containerRecord) toStatus() *kubecontainer.Status {
+	return &kubecontainer.Status{
+		ID:           buildContainerID(r.ID),
+		Name:         r.Name,
+		State:        r.State,
+		CreatedAt:    r.CreatedAt,
+		StartedAt:    r.StartedAt,
+		FinishedAt:   r.FinishedAt,
+		ExitCode:     r.ExitCode,
+		Image:        r.Image,
+		ImageID:      r.ImageID,
+		Hash:         r.Hash,
+		RestartCount: r.Attempt,
+		Reason:       r.Reason,
+		Message:      r.Message,
+	}
+}
+
+// toContainer converts the record into a kubecontainer.Container.
+func (r *containerRecord) toContainer() *kubecontainer.Container {
+	return &kubecontainer.Container{
+		ID:      buildContainerID(r.ID),
+		Name:    r.Name,
+		Image:   r.Image,
+		ImageID: r.ImageID,
+		Hash:    r.Hash,
+		State:   r.State,
+	}
+}
+
+// sandboxRecord is the runtime's bookkeeping for one pod sandbox instance.
+type sandboxRecord struct {
+	ID           string                     `json:"id"`
+	PodUID       types.UID                  `json:"podUID"`
+	PodName      string                     `json:"podName"`
+	PodNamespace string                     `json:"podNamespace"`
+	Attempt      uint32                     `json:"attempt"`
+	State        runtimeapi.PodSandboxState `json:"state"`
+	CreatedAt    time.Time                  `json:"createdAt"`
+
+	// Namespaces are the namespaces the sandbox holds for the containers of
+	// the pod, nil when they share the namespaces of the host.
+	Namespaces *sandboxNamespaces `json:"namespaces,omitempty"`
+
+	// IPs are the IPs allocated to the pod, the first one is its primary
+	// IP. They are empty for a pod in the network of the host.
+	IPs []string `json:"ips,omitempty"`
+	// NetworkSetUp is true from the moment the network plugin is asked to
+	// set up the network of the sandbox until its network is torn down.
+	NetworkSetUp bool `json:"networkSetUp,omitempty"`
+	// HostPorts are the host ports of the pod, forwarded to its IPs while
+	// its network is set up.
+	HostPorts []*hostport.PortMapping `json:"hostPorts,omitempty"`
+	// ResolvConfPath is the resolv.conf generated from the DNS settings of
+	// the pod, mounted into its containers. It is empty when they share the
+	// files of the host.
+	ResolvConfPath string `json:"resolvConfPath,omitempty"`
+
+	// done is closed once the process holding the namespaces has exited.
+	done chan struct{}
+}
+
+// toStatus converts the record into a runtimeapi.PodSandboxStatus.
+func (r *sandboxRecord) toStatus() *runtimeapi.PodSandboxStatus {
+	return &runtimeapi.PodSandboxStatus{
+		Id: r.ID,
+		Metadata: &runtimeapi.PodSandboxMetadata{
+			Name:      r.PodName,
+			Uid:       string(r.PodUID),
+			Namespace: r.PodNamespace,
+			Attempt:   r.Attempt,
+		},
+		State:     r.State,
+		CreatedAt: r.CreatedAt.UnixNano(),
+		Network:   r.networkStatus(),
+		Linux: &runtimeapi.LinuxPodSandboxStatus{
+			Namespaces: &runtimeapi.Namespace{
+				Options: r.Namespaces.options(),
+			},
+		},
+	}
+}
+
+// networkStatus returns the network status of the sandbox, nil if it has no IPs.
+func (r *sandboxRecord) networkStatus() *runtimeapi.PodSandboxNetworkStatus {
+	if len(r.IPs) == 0 {
+		return nil
+	}
+	status := &runtimeapi.PodSandboxNetworkStatus{Ip: r.IPs[0]}
+	for _, ip := range r.IPs[1:] {
+		status.AdditionalIps = append(status.AdditionalIps, &runtimeapi.PodIP{Ip: ip})
+	}
+	return status
+}
+
+// toContainer converts the sandbox into a kubecontainer.Container, the way
+// sandboxes are exposed in kubecontainer.Pod.
+func (r *sandboxRecord) toContainer() *kubecontainer.Container {
+	return &kubecontainer.Container{
+		ID:    buildContainerID(r.ID),
+		State: kubecontainer.SandboxToContainerState(r.State),
+	}
+}
+
+// recordStore persists container and sandbox records below the runtime root
+// directory so that exited containers survive a kubelet restart.
+type recordStore struct {
+	root string
+}
+
+func newRecordStore(root string) (*recordStore, error) {
+	for _, dir := range []string{filepath.Join(root, containersDirName), filepath.Join(root, sandboxesDirName)} {
+		if err := os.MkdirAll(dir, 0750); err != nil {
+			return nil, fmt.Errorf("failed to create %q: %v", dir, err)
+		}
+	}
+	return &recordStore{root: root}, nil
+}
+
+// checkWritable checks that records can still be written by the store.
+func (s *recordStore) checkWritable() error {
+	for _, dir := range []string{s.root, filepath.Join(s.root, containersDirName), filepath.Join(s.root, sandboxesDirName)} {
+		if err := checkDirWritable(dir); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// containerDir returns the directory holding everything of the given container.
+func (s *recordStore) containerDir(id string) string {
+	return filepath.Join(s.root, containersDirName, id)
+}
+
+// sandboxDir returns the directory holding everything of the given sandbox.
+func (s *recordStore) sandboxDir(id string) string {
+	return filepath.Join(s.root, sandboxesDirName, id)
+}
+
+func (s *recordStore) saveContainer(r *containerRecord) error {
+	return writeRecord(s.containerDir(r.ID), r)
+}
+
+func (s *recordStore) saveSandbox(r *sandboxRecord) error {
+	return writeRecord(s.sandboxDir(r.ID), r)
+}
+
+func (s *recordStore) removeContainer(id string) error {
+	return os.RemoveAll(s.containerDir(id))
+}
+
+func (s *recordStore) removeSandbox(id string) error {
+	return os.RemoveAll(s.sandboxDir(id))
+}
+
+// loadContainers reads all persisted container records.
+func (s *recordStore) loadContainers() ([]*containerRecord, error) {
+	var records []*containerRecord
+	err := readRecords(filepath.Join(s.root, containersDirName), func(data []byte) error {
+		r := &containerRecord{}
+		if err := json.Unmarshal(data, r); err != nil {
+			return err
+		}
+		records = append(records, r)
+		return nil
+	})
+	return records, err
+}
+
+// loadSandboxes reads all persisted sandbox records.
+func (s *recordStore) loadSandboxes() ([]*sandboxRecord, error) {
+	var records []*sandboxRecord
+	err := readRecords(filepath.Join(s.root, sandboxesDirName), func(data []byte) error {
+		r := &sandboxRecord{}
+		if err := json.Unmarshal(data, r); err != nil {
+			return err
+		}
+		records = append(records, r)
+		return nil
+	})
+	return records, err
+}
+
+// writeRecord atomically writes the json form of record into dir.
+func writeRecord(dir string, record interface{}) error {
+	if err := os.MkdirAll(dir, 0750); err != nil {
+		return err
+	}
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	tmp := filepath.Join(dir, "."+recordFileName)
+	if err := os.WriteFile(tmp, data, 0640); err != nil {
+		return err
+	}
+	return os.Rename(tmp, filepath.Join(dir, recordFileName))
+}
+
+// readRecords calls fn with the content of every record file found below dir.
+func readRecords(dir string, fn func(data []byte) error) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		path := filepath.Join(dir, entry.Name(), recordFileName)
+		data, err := os.ReadFile(path)
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return err
+		}
+		if err := fn(data); err != nil {
+			return fmt.Errorf("failed to decode %q: %v", path, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,142 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	authorizationv1 "k8s.io/api/authorization/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+	authorizationclient "k8s.io/client-go/kubernetes/typed/authorization/v1"
+)
+
+// UserInfo describes the user a request to the kubelet server is made by.
+type UserInfo struct {
+	Name   string
+	Groups []string
+}
+
+// Attributes are the attributes of a request the authorization decision is
+// made on. Every request to the kubelet server is a request on the proxy
+// subresource of the node.
+type Attributes struct {
+	User        UserInfo
+	Verb        string
+	Resource    string
+	Subresource string
+	Name        string
+}
+
+// Authorizer makes the authorization decision of the requests to the kubelet
+// server, after their client certificate has been verified.
+type Authorizer interface {
+	// Authorize returns whether the request is allowed, with the reason of
+	// the decision if any.
+	Authorize(ctx context.Context, attrs Attributes) (allowed bool, reason string, err error)
+}
+
+// authenticateRequest returns the user of the verified client certificate of
+// the request: the common name is the user name, and the organizations are
+// its groups, as with the x509 authenticator of the apiserver.
+func authenticateRequest(req *http.Request) (*UserInfo, bool) {
+	if req.TLS == nil || len(req.TLS.VerifiedChains) == 0 || len(req.TLS.VerifiedChains[0]) == 0 {
+		return nil, false
+	}
+	cert := req.TLS.VerifiedChains[0][0]
+	if cert.Subject.CommonName == "" {
+		return nil, false
+	}
+	return &UserInfo{
+		Name:   cert.Subject.CommonName,
+		Groups: cert.Subject.Organization,
+	}, true
+}
+
+// getRequestAttributes returns the attributes of the request on the node
+// named nodeName. The verb is derived from the HTTP method.
+func getRequestAttributes(user UserInfo, req *http.Request, nodeName string) Attributes {
+	verb := ""
+	switch req.Method {
+	case http.MethodPost:
+		verb = "create"
+	case http.MethodGet, http.MethodHead:
+		verb = "get"
+	case http.MethodPut:
+		verb = "update"
+	case http.MethodPatch:
+		verb = "patch"
+	case http.MethodDelete:
+		verb = "delete"
+	}
+	return Attributes{
+		User:        user,
+		Verb:        verb,
+		Resource:    "nodes",
+		Subresource: "proxy",
+		Name:        nodeName,
+	}
+}
+
+// sarAuthorizer authorizes the requests with SubjectAccessReviews sent to the
+// apiserver.
+type sarAuthorizer struct {
+	client authorizationclient.SubjectAccessReviewInterface
+}
+
+// NewSubjectAccessReviewAuthorizer returns an Authorizer asking the apiserver
+// whether the user may access the proxy subresource of the node.
+func NewSubjectAccessReviewAuthorizer(client authorizationclient.SubjectAccessReviewInterface) Authorizer {
+	return &sarAuthorizer{client: client}
+}
+
+func (a *sarAuthorizer) Authorize(ctx context.Context, attrs Attributes) (bool, string, error) {
+	review := &authorizationv1.SubjectAccessReview{
+		Spec: authorizationv1.SubjectAccessReviewSpec{
+			User:   attrs.User.Name,
+			Groups: attrs.User.Groups,
+			ResourceAttributes: &authorizationv1.ResourceAttributes{
+				Verb:        attrs.Verb,
+				Version:     "v1",
+				Resource:    attrs.Resource,
+				Subresource: attrs.Subresource,
+				Name:        attrs.Name,
+			},
+		},
+	}
+	result, err := a.client.Create(ctx, review, metav1.CreateOptions{})
+	if err != nil {
+		return false, "", fmt.Errorf("failed to create subject access review: %v", err)
+	}
+	if !result.Status.Allowed && result.Status.EvaluationError != "" {
+		return false, result.Status.Reason, fmt.Errorf("failed to evaluate subject access review: %s", result.Status.EvaluationError)
+	}
+	return result.Status.Allowed, result.Status.Reason, nil
+}
+
+// allowListAuthorizer allows the requests of a fixed set of users and groups.
+type allowListAuthorizer struct {
+	users  sets.String
+	groups sets.String
+}
+
+// NewAllowListAuthorizer returns an Authorizer allowing the requests of the
+// given users, and of the members of the given groups.
+func NewAllowListAuthorizer(users, groups []string) Authorizer {
+	return &allowListAuthorizer{
+		users:  sets.NewString(users...),
+		groups: sets.NewString(groups...),
+	}
+}
+
+func (a *allowListAuthorizer) Authorize(_ context.Context, attrs Attributes) (bool, string, error) {
+	if a.users.Has(attrs.User.Name) {
+		return true, "", nil
+	}
+	for _, group := range attrs.User.Groups {
+		if a.groups.Has(group) {
+			return true, "", nil
+		}
+	}
+	return false, fmt.Sprintf("user %q is not allowed", attrs.User.Name), nil
+}
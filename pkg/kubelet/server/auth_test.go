@@ -0,0 +1,207 @@
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	authorizationv1 "k8s.io/api/authorization/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	core "k8s.io/client-go/testing"
+)
+
+const testNodeName = "node"
+
+type fakeAuthorizer struct {
+	attrs   Attributes
+	allowed bool
+	err     error
+}
+
+func (a *fakeAuthorizer) Authorize(_ context.Context, attrs Attributes) (bool, string, error) {
+	a.attrs = attrs
+	return a.allowed, "", a.err
+}
+
+// withClientCert sets the verified client certificate of req.
+func withClientCert(req *http.Request, name string, groups ...string) *http.Request {
+	cert := &x509.Certificate{Subject: pkix.Name{CommonName: name, Organization: groups}}
+	req.TLS = &tls.ConnectionState{
+		PeerCertificates: []*x509.Certificate{cert},
+		VerifiedChains:   [][]*x509.Certificate{{cert}},
+	}
+	return req
+}
+
+func TestAuthFilter(t *testing.T) {
+	for desc, test := range map[string]struct {
+		req          *http.Request
+		auth         *fakeAuthorizer
+		expectedCode int
+		expectedVerb string
+		streamed     bool
+	}{
+		"no client certificate": {
+			req:          httptest.NewRequest(http.MethodPost, "/exec/ns/pod/container?command=ls&output=1", nil),
+			auth:         &fakeAuthorizer{allowed: true},
+			expectedCode: http.StatusUnauthorized,
+		},
+		"unverified client certificate": {
+			req: func() *http.Request {
+				req := httptest.NewRequest(http.MethodPost, "/exec/ns/pod/container?command=ls&output=1", nil)
+				req.TLS = &tls.ConnectionState{PeerCertificates: []*x509.Certificate{{Subject: pkix.Name{CommonName: "user"}}}}
+				return req
+			}(),
+			auth:         &fakeAuthorizer{allowed: true},
+			expectedCode: http.StatusUnauthorized,
+		},
+		"forbidden": {
+			req:          withClientCert(httptest.NewRequest(http.MethodPost, "/exec/ns/pod/container?command=ls&output=1", nil), "user"),
+			auth:         &fakeAuthorizer{},
+			expectedCode: http.StatusForbidden,
+			expectedVerb: "create",
+		},
+		"authorization error": {
+			req:          withClientCert(httptest.NewRequest(http.MethodGet, "/attach/ns/pod/container?output=1", nil), "user"),
+			auth:         &fakeAuthorizer{err: errors.New("boom")},
+			expectedCode: http.StatusInternalServerError,
+			expectedVerb: "get",
+		},
+		"allowed": {
+			req:          withClientCert(httptest.NewRequest(http.MethodPost, "/exec/ns/pod/container?command=ls&output=1", nil), "user", "group"),
+			auth:         &fakeAuthorizer{allowed: true},
+			expectedCode: http.StatusOK,
+			expectedVerb: "create",
+			streamed:     true,
+		},
+	} {
+		t.Run(desc, func(t *testing.T) {
+			streamed := false
+			streamingHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				streamed = true
+			})
+			s := NewServer(&fakeHost{}, streamingHandler, test.auth, testNodeName)
+			rec := httptest.NewRecorder()
+			s.ServeHTTP(rec, test.req)
+
+			if rec.Code != test.expectedCode {
+				t.Errorf("expected code %d, got %d: %s", test.expectedCode, rec.Code, rec.Body.String())
+			}
+			if streamed != test.streamed {
+				t.Errorf("expected streamed %v, got %v", test.streamed, streamed)
+			}
+			if test.expectedVerb == "" {
+				return
+			}
+			expectedAttrs := Attributes{
+				User:        UserInfo{Name: "user"},
+				Verb:        test.expectedVerb,
+				Resource:    "nodes",
+				Subresource: "proxy",
+				Name:        testNodeName,
+			}
+			attrs := test.auth.attrs
+			if attrs.User.Name != expectedAttrs.User.Name || attrs.Verb != expectedAttrs.Verb || attrs.Resource != expectedAttrs.Resource ||
+				attrs.Subresource != expectedAttrs.Subresource || attrs.Name != expectedAttrs.Name {
+				t.Errorf("expected attributes %+v, got %+v", expectedAttrs, attrs)
+			}
+		})
+	}
+}
+
+func TestAllowListAuthorizer(t *testing.T) {
+	a := NewAllowListAuthorizer([]string{"admin"}, []string{"system:masters"})
+	for desc, test := range map[string]struct {
+		user    UserInfo
+		allowed bool
+	}{
+		"allowed user":      {user: UserInfo{Name: "admin"}, allowed: true},
+		"allowed group":     {user: UserInfo{Name: "someone", Groups: []string{"dev", "system:masters"}}, allowed: true},
+		"unknown user":      {user: UserInfo{Name: "someone", Groups: []string{"dev"}}},
+		"group is not user": {user: UserInfo{Name: "system:masters"}},
+	} {
+		t.Run(desc, func(t *testing.T) {
+			allowed, _, err := a.Authorize(context.Background(), Attributes{User: test.user})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if allowed != test.allowed {
+				t.Errorf("expected allowed %v, got %v", test.allowed, allowed)
+			}
+		})
+	}
+}
+
+func TestSubjectAccessReviewAuthorizer(t *testing.T) {
+	for desc, test := range map[string]struct {
+		status    authorizationv1.SubjectAccessReviewStatus
+		createErr error
+		allowed   bool
+		err       bool
+	}{
+		"allowed":          {status: authorizationv1.SubjectAccessReviewStatus{Allowed: true}, allowed: true},
+		"denied":           {status: authorizationv1.SubjectAccessReviewStatus{Reason: "no"}},
+		"evaluation error": {status: authorizationv1.SubjectAccessReviewStatus{EvaluationError: "broken"}, err: true},
+		"request error":    {createErr: errors.New("unavailable"), err: true},
+	} {
+		t.Run(desc, func(t *testing.T) {
+			client := fake.NewSimpleClientset()
+			var review *authorizationv1.SubjectAccessReview
+			client.PrependReactor("create", "subjectaccessreviews", func(action core.Action) (bool, runtime.Object, error) {
+				review = action.(core.CreateAction).GetObject().(*authorizationv1.SubjectAccessReview)
+				if test.createErr != nil {
+					return true, nil, test.createErr
+				}
+				result := review.DeepCopy()
+				result.Status = test.status
+				return true, result, nil
+			})
+
+			a := NewSubjectAccessReviewAuthorizer(client.AuthorizationV1().SubjectAccessReviews())
+			attrs := Attributes{
+				User:        UserInfo{Name: "user", Groups: []string{"group"}},
+				Verb:        "create",
+				Resource:    "nodes",
+				Subresource: "proxy",
+				Name:        testNodeName,
+			}
+			allowed, _, err := a.Authorize(context.Background(), attrs)
+			if test.err != (err != nil) {
+				t.Fatalf("expected error %v, got %v", test.err, err)
+			}
+			if allowed != test.allowed {
+				t.Errorf("expected allowed %v, got %v", test.allowed, allowed)
+			}
+			if review == nil {
+				t.Fatal("expected a subject access review")
+			}
+			spec := review.Spec
+			if spec.User != "user" || len(spec.Groups) != 1 || spec.Groups[0] != "group" || spec.ResourceAttributes == nil ||
+				spec.ResourceAttributes.Verb != "create" || spec.ResourceAttributes.Resource != "nodes" ||
+				spec.ResourceAttributes.Subresource != "proxy" || spec.ResourceAttributes.Name != testNodeName {
+				t.Errorf("unexpected subject access review %+v", spec)
+			}
+		})
+	}
+}
+
+func TestListenAndServeRequiresClientCA(t *testing.T) {
+	for desc, tlsOptions := range map[string]*TLSOptions{
+		"no TLS":       nil,
+		"no client CA": {Config: &tls.Config{}},
+	} {
+		t.Run(desc, func(t *testing.T) {
+			err := ListenAndServeKubeletServer(&fakeHost{}, http.NotFoundHandler(), &fakeAuthorizer{}, testNodeName, net.ParseIP("127.0.0.1"), 0, tlsOptions)
+			if err == nil {
+				t.Fatal("expected the server to refuse to start")
+			}
+		})
+	}
+}
@@ -0,0 +1,323 @@
+package server
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	restful "github.com/emicklei/go-restful"
+	kubecontainer "github.com/xuliangTang/mykubelet/pkg/kubelet/container"
+	"github.com/xuliangTang/mykubelet/pkg/kubelet/cri/streaming"
+	"github.com/xuliangTang/mykubelet/pkg/kubelet/cri/streaming/portforward"
+	remotecommandserver "github.com/xuliangTang/mykubelet/pkg/kubelet/cri/streaming/remotecommand"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/proxy"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/klog/v2"
+)
+
+// Server is a http.Handler which exposes kubelet functionality over HTTP.
+type Server struct {
+	host             HostInterface
+	streamingHandler http.Handler
+	auth             Authorizer
+	nodeName         string
+	restfulCont      *restful.Container
+}
+
+// TLSOptions holds the TLS options.
+type TLSOptions struct {
+	Config   *tls.Config
+	CertFile string
+	KeyFile  string
+}
+
+// HostInterface contains all the kubelet methods required by the server.
+type HostInterface interface {
+	GetPodByName(namespace, name string) (*v1.Pod, bool)
+	GetExec(podFullName string, podUID types.UID, containerName string, cmd []string, streamOpts remotecommandserver.Options) (*url.URL, error)
+	GetAttach(podFullName string, podUID types.UID, containerName string, streamOpts remotecommandserver.Options) (*url.URL, error)
+	GetPortForward(podName, podNamespace string, podUID types.UID, portForwardOpts portforward.V4Options) (*url.URL, error)
+}
+
+// ListenAndServeKubeletServer initializes a server to respond to HTTP network requests on the Kubelet.
+// The streams of the relative URLs returned by host are served by
+// streamingHandler, those of absolute URLs are proxied.
+// Clients must present a certificate signed by the client CA of tlsOptions,
+// and be allowed by auth to access the node named nodeName.
+func ListenAndServeKubeletServer(host HostInterface, streamingHandler http.Handler, auth Authorizer, nodeName string, address net.IP, port uint, tlsOptions *TLSOptions) error {
+	if tlsOptions == nil || tlsOptions.Config == nil || tlsOptions.Config.ClientCAs == nil {
+		return fmt.Errorf("a client CA is required to serve exec, attach and port-forward requests")
+	}
+	if auth == nil {
+		return fmt.Errorf("an authorizer is required to serve exec, attach and port-forward requests")
+	}
+	tlsOptions.Config.ClientAuth = tls.RequireAndVerifyClientCert
+
+	klog.InfoS("Starting to listen", "address", address, "port", port)
+	handler := NewServer(host, streamingHandler, auth, nodeName)
+	s := &http.Server{
+		Addr:           net.JoinHostPort(address.String(), strconv.FormatUint(uint64(port), 10)),
+		Handler:        handler,
+		ReadTimeout:    4 * 60 * time.Minute,
+		WriteTimeout:   4 * 60 * time.Minute,
+		MaxHeaderBytes: 1 << 20,
+		TLSConfig:      tlsOptions.Config,
+	}
+	// Passing empty strings as the cert and key files means no
+	// cert/keys are specified and GetCertificate in the TLSConfig
+	// should be called instead.
+	return s.ListenAndServeTLS(tlsOptions.CertFile, tlsOptions.KeyFile)
+}
+
+// NewServer initializes and configures a kubelet.Server object to handle HTTP requests.
+// Every request is authorized by auth before it reaches a handler.
+func NewServer(host HostInterface, streamingHandler http.Handler, auth Authorizer, nodeName string) *Server {
+	server := &Server{
+		host:             host,
+		streamingHandler: streamingHandler,
+		auth:             auth,
+		nodeName:         nodeName,
+		restfulCont:      restful.NewContainer(),
+	}
+	server.InstallAuthFilter()
+	server.InstallDebuggingHandlers()
+	return server
+}
+
+// InstallAuthFilter installs the filter authenticating the requests with
+// their verified client certificate, and authorizing them.
+func (s *Server) InstallAuthFilter() {
+	s.restfulCont.Filter(func(req *restful.Request, resp *restful.Response, chain *restful.FilterChain) {
+		user, ok := authenticateRequest(req.Request)
+		if !ok {
+			resp.WriteErrorString(http.StatusUnauthorized, "Unauthorized")
+			return
+		}
+		attrs := getRequestAttributes(*user, req.Request, s.nodeName)
+		allowed, reason, err := s.auth.Authorize(req.Request.Context(), attrs)
+		if err != nil {
+			klog.ErrorS(err, "Authorization error", "user", attrs.User.Name, "verb", attrs.Verb, "resource", attrs.Resource, "subresource", attrs.Subresource)
+			msg := fmt.Sprintf("Authorization error (user=%s, verb=%s, resource=%s, subresource=%s)", attrs.User.Name, attrs.Verb, attrs.Resource, attrs.Subresource)
+			resp.WriteErrorString(http.StatusInternalServerError, msg)
+			return
+		}
+		if !allowed {
+			klog.V(2).InfoS("Forbidden", "user", attrs.User.Name, "verb", attrs.Verb, "resource", attrs.Resource, "subresource", attrs.Subresource, "reason", reason)
+			msg := fmt.Sprintf("Forbidden (user=%s, verb=%s, resource=%s, subresource=%s)", attrs.User.Name, attrs.Verb, attrs.Resource, attrs.Subresource)
+			resp.WriteErrorString(http.StatusForbidden, msg)
+			return
+		}
+		chain.ProcessFilter(req, resp)
+	})
+}
+
+// InstallDebuggingHandlers registers the HTTP request patterns that serve the
+// exec, attach and port-forward requests of the apiserver.
+func (s *Server) InstallDebuggingHandlers() {
+	klog.InfoS("Adding debug handlers to kubelet server")
+
+	ws := new(restful.WebService)
+	ws.
+		Path("/attach")
+	ws.Route(ws.GET("/{podNamespace}/{podID}/{containerName}").
+		To(s.getAttach).
+		Operation("getAttach"))
+	ws.Route(ws.POST("/{podNamespace}/{podID}/{containerName}").
+		To(s.getAttach).
+		Operation("getAttach"))
+	ws.Route(ws.GET("/{podNamespace}/{podID}/{uid}/{containerName}").
+		To(s.getAttach).
+		Operation("getAttach"))
+	ws.Route(ws.POST("/{podNamespace}/{podID}/{uid}/{containerName}").
+		To(s.getAttach).
+		Operation("getAttach"))
+	s.restfulCont.Add(ws)
+
+	ws = new(restful.WebService)
+	ws.
+		Path("/exec")
+	ws.Route(ws.GET("/{podNamespace}/{podID}/{containerName}").
+		To(s.getExec).
+		Operation("getExec"))
+	ws.Route(ws.POST("/{podNamespace}/{podID}/{containerName}").
+		To(s.getExec).
+		Operation("getExec"))
+	ws.Route(ws.GET("/{podNamespace}/{podID}/{uid}/{containerName}").
+		To(s.getExec).
+		Operation("getExec"))
+	ws.Route(ws.POST("/{podNamespace}/{podID}/{uid}/{containerName}").
+		To(s.getExec).
+		Operation("getExec"))
+	s.restfulCont.Add(ws)
+
+	ws = new(restful.WebService)
+	ws.
+		Path("/portForward")
+	ws.Route(ws.GET("/{podNamespace}/{podID}").
+		To(s.getPortForward).
+		Operation("getPortForward"))
+	ws.Route(ws.POST("/{podNamespace}/{podID}").
+		To(s.getPortForward).
+		Operation("getPortForward"))
+	ws.Route(ws.GET("/{podNamespace}/{podID}/{uid}").
+		To(s.getPortForward).
+		Operation("getPortForward"))
+	ws.Route(ws.POST("/{podNamespace}/{podID}/{uid}").
+		To(s.getPortForward).
+		Operation("getPortForward"))
+	s.restfulCont.Add(ws)
+}
+
+type execRequestParams struct {
+	podNamespace  string
+	podName       string
+	podUID        types.UID
+	containerName string
+	cmd           []string
+}
+
+func getExecRequestParams(req *restful.Request) execRequestParams {
+	return execRequestParams{
+		podNamespace:  req.PathParameter("podNamespace"),
+		podName:       req.PathParameter("podID"),
+		podUID:        types.UID(req.PathParameter("uid")),
+		containerName: req.PathParameter("containerName"),
+		cmd:           req.Request.URL.Query()[v1.ExecCommandParam],
+	}
+}
+
+type portForwardRequestParams struct {
+	podNamespace string
+	podName      string
+	podUID       types.UID
+}
+
+func getPortForwardRequestParams(req *restful.Request) portForwardRequestParams {
+	return portForwardRequestParams{
+		podNamespace: req.PathParameter("podNamespace"),
+		podName:      req.PathParameter("podID"),
+		podUID:       types.UID(req.PathParameter("uid")),
+	}
+}
+
+// getAttach handles requests to attach to a container.
+func (s *Server) getAttach(request *restful.Request, response *restful.Response) {
+	params := getExecRequestParams(request)
+	streamOpts, err := remotecommandserver.NewOptions(request.Request)
+	if err != nil {
+		utilruntime.HandleError(err)
+		response.WriteError(http.StatusBadRequest, err)
+		return
+	}
+	pod, ok := s.host.GetPodByName(params.podNamespace, params.podName)
+	if !ok {
+		response.WriteError(http.StatusNotFound, fmt.Errorf("pod does not exist"))
+		return
+	}
+
+	podFullName := kubecontainer.GetPodFullName(pod)
+	url, err := s.host.GetAttach(podFullName, params.podUID, params.containerName, *streamOpts)
+	if err != nil {
+		streaming.WriteError(err, response.ResponseWriter)
+		return
+	}
+
+	s.serveStream(response.ResponseWriter, request.Request, url)
+}
+
+// getExec handles requests to run a command inside a container.
+func (s *Server) getExec(request *restful.Request, response *restful.Response) {
+	params := getExecRequestParams(request)
+	streamOpts, err := remotecommandserver.NewOptions(request.Request)
+	if err != nil {
+		utilruntime.HandleError(err)
+		response.WriteError(http.StatusBadRequest, err)
+		return
+	}
+	pod, ok := s.host.GetPodByName(params.podNamespace, params.podName)
+	if !ok {
+		response.WriteError(http.StatusNotFound, fmt.Errorf("pod does not exist"))
+		return
+	}
+
+	podFullName := kubecontainer.GetPodFullName(pod)
+	url, err := s.host.GetExec(podFullName, params.podUID, params.containerName, params.cmd, *streamOpts)
+	if err != nil {
+		streaming.WriteError(err, response.ResponseWriter)
+		return
+	}
+	s.serveStream(response.ResponseWriter, request.Request, url)
+}
+
+// getPortForward handles a new restful port forward request. It determines the
+// pod name and uid and then calls ServePortForward.
+func (s *Server) getPortForward(request *restful.Request, response *restful.Response) {
+	params := getPortForwardRequestParams(request)
+
+	portForwardOptions, err := portforward.NewV4Options(request.Request)
+	if err != nil {
+		utilruntime.HandleError(err)
+		response.WriteError(http.StatusBadRequest, err)
+		return
+	}
+	pod, ok := s.host.GetPodByName(params.podNamespace, params.podName)
+	if !ok {
+		response.WriteError(http.StatusNotFound, fmt.Errorf("pod does not exist"))
+		return
+	}
+	if len(params.podUID) > 0 && pod.UID != params.podUID {
+		response.WriteError(http.StatusNotFound, fmt.Errorf("pod not found"))
+		return
+	}
+
+	url, err := s.host.GetPortForward(pod.Name, pod.Namespace, pod.UID, *portForwardOptions)
+	if err != nil {
+		streaming.WriteError(err, response.ResponseWriter)
+		return
+	}
+	s.serveStream(response.ResponseWriter, request.Request, url)
+}
+
+// serveStream serves the stream of the URL returned by the runtime. Absolute
+// URLs of the streaming server of a CRI runtime are proxied. Relative URLs
+// are handed to the streaming handler of the runtime as if the client had
+// been redirected to them.
+func (s *Server) serveStream(w http.ResponseWriter, r *http.Request, u *url.URL) {
+	if u.IsAbs() {
+		proxyStream(w, r, u)
+		return
+	}
+	if s.streamingHandler == nil {
+		http.Error(w, fmt.Sprintf("streaming from %q is not supported", u), http.StatusInternalServerError)
+		return
+	}
+	req := r.Clone(r.Context())
+	req.URL = r.URL.ResolveReference(u)
+	req.RequestURI = req.URL.RequestURI()
+	s.streamingHandler.ServeHTTP(w, req)
+}
+
+// proxyStream proxies stream to url.
+func proxyStream(w http.ResponseWriter, r *http.Request, url *url.URL) {
+	handler := proxy.NewUpgradeAwareHandler(url, nil /*transport*/, false /*wrapTransport*/, true /*upgradeRequired*/, &responder{})
+	handler.ServeHTTP(w, r)
+}
+
+// responder reports the errors of proxied streams.
+type responder struct{}
+
+func (r *responder) Error(w http.ResponseWriter, req *http.Request, err error) {
+	klog.ErrorS(err, "Error while proxying request")
+	http.Error(w, err.Error(), http.StatusInternalServerError)
+}
+
+// ServeHTTP responds to HTTP requests on the Kubelet.
+func (s *Server) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	s.restfulCont.ServeHTTP(w, req)
+}
@@ -0,0 +1,260 @@
+package server
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"testing"
+
+	kubecontainer "github.com/xuliangTang/mykubelet/pkg/kubelet/container"
+	"github.com/xuliangTang/mykubelet/pkg/kubelet/cri/streaming/portforward"
+	remotecommandserver "github.com/xuliangTang/mykubelet/pkg/kubelet/cri/streaming/remotecommand"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// fakeHost knows every pod but those in missingPods, and returns streamURL,
+// or a relative URL per stream kind when it is empty, for every stream.
+type fakeHost struct {
+	missingPods map[string]bool
+	streamURL   string
+	err         error
+
+	podFullName   string
+	podUID        types.UID
+	containerName string
+	cmd           []string
+}
+
+func (h *fakeHost) GetPodByName(namespace, name string) (*v1.Pod, bool) {
+	if h.missingPods[namespace+"/"+name] {
+		return nil, false
+	}
+	return &v1.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name, UID: "uid"}}, true
+}
+
+func (h *fakeHost) stream(kind string) (*url.URL, error) {
+	if h.err != nil {
+		return nil, h.err
+	}
+	if h.streamURL != "" {
+		return url.Parse(h.streamURL)
+	}
+	return &url.URL{Path: "/" + kind + "/token"}, nil
+}
+
+func (h *fakeHost) GetExec(podFullName string, podUID types.UID, containerName string, cmd []string, streamOpts remotecommandserver.Options) (*url.URL, error) {
+	h.podFullName, h.podUID, h.containerName, h.cmd = podFullName, podUID, containerName, cmd
+	return h.stream("exec")
+}
+
+func (h *fakeHost) GetAttach(podFullName string, podUID types.UID, containerName string, streamOpts remotecommandserver.Options) (*url.URL, error) {
+	h.podFullName, h.podUID, h.containerName = podFullName, podUID, containerName
+	return h.stream("attach")
+}
+
+func (h *fakeHost) GetPortForward(podName, podNamespace string, podUID types.UID, portForwardOpts portforward.V4Options) (*url.URL, error) {
+	h.podFullName, h.podUID = kubecontainer.BuildPodFullName(podName, podNamespace), podUID
+	return h.stream("portforward")
+}
+
+func newTestServer(host HostInterface, streamingHandler http.Handler) *Server {
+	return NewServer(host, streamingHandler, &fakeAuthorizer{allowed: true}, testNodeName)
+}
+
+// newTestRequest returns a request of an authenticated client.
+func newTestRequest(method, target string) *http.Request {
+	return withClientCert(httptest.NewRequest(method, target, nil), "user")
+}
+
+func TestServeStream(t *testing.T) {
+	for desc, test := range map[string]struct {
+		method            string
+		target            string
+		expectedPath      string
+		expectedPodUID    types.UID
+		expectedContainer string
+		expectedCmd       []string
+	}{
+		"exec": {
+			method:            http.MethodPost,
+			target:            "/exec/ns/pod/container?command=ls&command=-l&output=1",
+			expectedPath:      "/exec/token",
+			expectedContainer: "container",
+			expectedCmd:       []string{"ls", "-l"},
+		},
+		"exec with pod UID": {
+			method:            http.MethodGet,
+			target:            "/exec/ns/pod/uid/container?command=ls&output=1",
+			expectedPath:      "/exec/token",
+			expectedPodUID:    "uid",
+			expectedContainer: "container",
+			expectedCmd:       []string{"ls"},
+		},
+		"attach": {
+			method:            http.MethodPost,
+			target:            "/attach/ns/pod/container?output=1&error=1",
+			expectedPath:      "/attach/token",
+			expectedContainer: "container",
+		},
+		"port-forward": {
+			method:         http.MethodPost,
+			target:         "/portForward/ns/pod",
+			expectedPath:   "/portforward/token",
+			expectedPodUID: "uid",
+		},
+	} {
+		t.Run(desc, func(t *testing.T) {
+			var streamed *http.Request
+			streamingHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				streamed = r
+			})
+			host := &fakeHost{}
+			rec := httptest.NewRecorder()
+			newTestServer(host, streamingHandler).ServeHTTP(rec, newTestRequest(test.method, test.target))
+
+			if rec.Code != http.StatusOK {
+				t.Fatalf("expected code %d, got %d: %s", http.StatusOK, rec.Code, rec.Body.String())
+			}
+			if streamed == nil {
+				t.Fatal("expected the request to be streamed")
+			}
+			if streamed.URL.Path != test.expectedPath || streamed.RequestURI != test.expectedPath || streamed.Method != test.method {
+				t.Errorf("expected %s %s to be streamed, got %s %s (%s)", test.method, test.expectedPath, streamed.Method, streamed.URL.Path, streamed.RequestURI)
+			}
+			if host.podFullName != "pod_ns" || host.podUID != test.expectedPodUID || host.containerName != test.expectedContainer {
+				t.Errorf("unexpected stream of %q %q %q", host.podFullName, host.podUID, host.containerName)
+			}
+			if !reflect.DeepEqual(host.cmd, test.expectedCmd) {
+				t.Errorf("expected command %v, got %v", test.expectedCmd, host.cmd)
+			}
+		})
+	}
+}
+
+func TestServeStreamErrors(t *testing.T) {
+	for desc, test := range map[string]struct {
+		host         *fakeHost
+		target       string
+		expectedCode int
+	}{
+		"exec without streams": {
+			host:         &fakeHost{},
+			target:       "/exec/ns/pod/container?command=ls",
+			expectedCode: http.StatusBadRequest,
+		},
+		"exec in a missing pod": {
+			host:         &fakeHost{missingPods: map[string]bool{"ns/pod": true}},
+			target:       "/exec/ns/pod/container?command=ls&output=1",
+			expectedCode: http.StatusNotFound,
+		},
+		"attach to a missing pod": {
+			host:         &fakeHost{missingPods: map[string]bool{"ns/pod": true}},
+			target:       "/attach/ns/pod/container?output=1",
+			expectedCode: http.StatusNotFound,
+		},
+		"port-forward to a missing pod": {
+			host:         &fakeHost{missingPods: map[string]bool{"ns/pod": true}},
+			target:       "/portForward/ns/pod",
+			expectedCode: http.StatusNotFound,
+		},
+		"port-forward to another pod with the name": {
+			host:         &fakeHost{},
+			target:       "/portForward/ns/pod/other-uid",
+			expectedCode: http.StatusNotFound,
+		},
+		"absolute URL without upgrade": {
+			host:         &fakeHost{streamURL: "http://127.0.0.1:1/exec/token"},
+			target:       "/exec/ns/pod/container?command=ls&output=1",
+			expectedCode: http.StatusInternalServerError,
+		},
+		"runtime error": {
+			host:         &fakeHost{err: errors.New("container not found")},
+			target:       "/exec/ns/pod/container?command=ls&output=1",
+			expectedCode: http.StatusInternalServerError,
+		},
+	} {
+		t.Run(desc, func(t *testing.T) {
+			streamed := false
+			streamingHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				streamed = true
+			})
+			rec := httptest.NewRecorder()
+			newTestServer(test.host, streamingHandler).ServeHTTP(rec, newTestRequest(http.MethodPost, test.target))
+
+			if rec.Code != test.expectedCode {
+				t.Errorf("expected code %d, got %d: %s", test.expectedCode, rec.Code, rec.Body.String())
+			}
+			if streamed {
+				t.Error("expected the request not to be streamed")
+			}
+		})
+	}
+}
+
+func TestServeStreamProxy(t *testing.T) {
+	// The streaming server of the runtime upgrades the connection, and echoes
+	// what it reads.
+	var streamedPath string
+	runtimeServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		streamedPath = r.URL.RequestURI()
+		if r.Header.Get("Upgrade") != "test" {
+			http.Error(w, "upgrade required", http.StatusBadRequest)
+			return
+		}
+		conn, rw, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			t.Errorf("failed to hijack the connection: %v", err)
+			return
+		}
+		defer conn.Close()
+		fmt.Fprint(rw, "HTTP/1.1 101 Switching Protocols\r\nConnection: Upgrade\r\nUpgrade: test\r\n\r\n")
+		rw.Flush()
+		line, _ := rw.ReadString('\n')
+		fmt.Fprint(rw, line)
+		rw.Flush()
+	}))
+	defer runtimeServer.Close()
+
+	host := &fakeHost{streamURL: runtimeServer.URL + "/exec/token"}
+	s := newTestServer(host, nil)
+	kubeletServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.ServeHTTP(w, withClientCert(r, "user"))
+	}))
+	defer kubeletServer.Close()
+
+	conn, err := net.Dial("tcp", kubeletServer.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	fmt.Fprintf(conn, "POST /exec/ns/pod/container?command=ls&output=1 HTTP/1.1\r\nHost: %s\r\nConnection: Upgrade\r\nUpgrade: test\r\n\r\n", kubeletServer.Listener.Addr())
+	r := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(r, nil)
+	if err != nil {
+		t.Fatalf("failed to read the response: %v", err)
+	}
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		body, _ := io.ReadAll(resp.Body)
+		t.Fatalf("expected the connection to be upgraded, got %d: %s", resp.StatusCode, body)
+	}
+	if streamedPath != "/exec/token" {
+		t.Errorf("expected the stream of /exec/token to be proxied, got %q", streamedPath)
+	}
+	if host.podFullName != "pod_ns" || host.containerName != "container" || !reflect.DeepEqual(host.cmd, []string{"ls"}) {
+		t.Errorf("unexpected stream of %q %q %v", host.podFullName, host.containerName, host.cmd)
+	}
+
+	fmt.Fprint(conn, "ping\n")
+	line, err := r.ReadString('\n')
+	if err != nil || line != "ping\n" {
+		t.Errorf("expected the stream to be echoed, got %q, %v", line, err)
+	}
+}
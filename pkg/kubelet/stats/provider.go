@@ -0,0 +1,439 @@
+package stats
+
+import (
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	statsapi "github.com/xuliangTang/mykubelet/pkg/kubelet/apis/stats/v1alpha1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/klog/v2"
+)
+
+const (
+	// samplePeriod is the interval at which the usage of containers is sampled.
+	samplePeriod = 10 * time.Second
+
+	// windowSize is the number of samples kept in memory per container.
+	windowSize = 12
+
+	// fsSamplePeriod is the interval at which pod directories are walked.
+	// Walking a directory tree is much more expensive than reading counters.
+	fsSamplePeriod = time.Minute
+)
+
+// ContainerInfo describes a running container and where its usage is read from.
+type ContainerInfo struct {
+	ID           string
+	Name         string
+	PodUID       types.UID
+	PodName      string
+	PodNamespace string
+	StartTime    time.Time
+	// Pid is the process group leader of the container.
+	Pid int
+	// CgroupPath is the literal cgroupfs name of the cgroup of the container,
+	// empty if the container has none.
+	CgroupPath string
+	// LogPath is the path of the current log file of the container.
+	LogPath string
+}
+
+// ContainerLister lists the running containers of the container runtime.
+type ContainerLister interface {
+	// ListContainerInfo returns the containers that are currently running.
+	ListContainerInfo() ([]ContainerInfo, error)
+}
+
+// Provider provides the resource usage of the pods and containers running on
+// the node, as sampled over a short rolling window.
+type Provider interface {
+	// Start starts sampling the usage of the containers in the background.
+	Start()
+	// ListPodStats returns the latest stats of all the pods with running containers.
+	ListPodStats() []statsapi.PodStats
+	// GetPodStats returns the latest stats of the pod.
+	GetPodStats(podUID types.UID) (*statsapi.PodStats, bool)
+	// GetContainerStats returns the latest stats of the named container of the pod.
+	GetContainerStats(podUID types.UID, containerName string) (*statsapi.ContainerStats, bool)
+	// GetContainerStatsWindow returns the samples kept for the named container
+	// of the pod, oldest first.
+	GetContainerStatsWindow(podUID types.UID, containerName string) []statsapi.ContainerStats
+}
+
+// containerWindow holds the latest samples of a container instance.
+type containerWindow struct {
+	info    ContainerInfo
+	samples []statsapi.ContainerStats
+}
+
+// latest returns the most recent sample of the container.
+func (w *containerWindow) latest() *statsapi.ContainerStats {
+	if len(w.samples) == 0 {
+		return nil
+	}
+	return &w.samples[len(w.samples)-1]
+}
+
+// podWindow holds the pod-scoped stats of a pod.
+type podWindow struct {
+	ref       statsapi.PodReference
+	startTime time.Time
+	network   *statsapi.NetworkStats
+	// podDir is the usage of the pod directory, which holds the volumes of the pod.
+	podDir *statsapi.FsStats
+}
+
+type provider struct {
+	lister     ContainerLister
+	podDirFunc func(podUID types.UID) string
+
+	lock sync.RWMutex
+	// containers maps the ID of a running container to its samples.
+	containers map[string]*containerWindow
+	pods       map[types.UID]*podWindow
+}
+
+// NewProvider returns a Provider sampling the containers listed by lister.
+// podDirFunc returns the directory of a pod, whose usage is accounted to its
+// ephemeral storage.
+func NewProvider(lister ContainerLister, podDirFunc func(podUID types.UID) string) Provider {
+	return &provider{
+		lister:     lister,
+		podDirFunc: podDirFunc,
+		containers: make(map[string]*containerWindow),
+		pods:       make(map[types.UID]*podWindow),
+	}
+}
+
+func (p *provider) Start() {
+	klog.InfoS("Starting stats provider", "samplePeriod", samplePeriod, "windowSize", windowSize)
+	go wait.Until(p.sample, samplePeriod, wait.NeverStop)
+}
+
+// sample reads the usage of every running container, and drops the samples
+// of the containers that are gone.
+func (p *provider) sample() {
+	infos, err := p.lister.ListContainerInfo()
+	if err != nil {
+		klog.ErrorS(err, "Failed to list containers for stats")
+		return
+	}
+	now := time.Now()
+
+	// The processes are only scanned when a container has no cgroup to read
+	// its usage from.
+	var groups map[int]*processGroupUsage
+	for _, info := range infos {
+		if info.CgroupPath == "" {
+			if groups, err = listProcessGroups(); err != nil {
+				klog.V(4).InfoS("Failed to list process groups", "err", err)
+			}
+			break
+		}
+	}
+
+	samples := make(map[string]statsapi.ContainerStats, len(infos))
+	for _, info := range infos {
+		samples[info.ID] = p.sampleContainer(info, groups, now)
+	}
+
+	// Pod-scoped stats are read from any of the processes of the pod.
+	podInfos := make(map[types.UID]ContainerInfo)
+	for _, info := range infos {
+		if _, ok := podInfos[info.PodUID]; !ok {
+			podInfos[info.PodUID] = info
+		}
+	}
+	networks := make(map[types.UID]*statsapi.NetworkStats, len(podInfos))
+	for uid, info := range podInfos {
+		network, err := readNetworkStats(info.Pid, now)
+		if err != nil {
+			klog.V(4).InfoS("Failed to read network stats of pod", "pod", klog.KRef(info.PodNamespace, info.PodName), "err", err)
+			continue
+		}
+		networks[uid] = network
+	}
+
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	for _, info := range infos {
+		w, ok := p.containers[info.ID]
+		if !ok {
+			w = &containerWindow{info: info}
+			p.containers[info.ID] = w
+		}
+		sample := samples[info.ID]
+		setUsageNanoCores(w.latest(), &sample)
+		w.samples = append(w.samples, sample)
+		if len(w.samples) > windowSize {
+			w.samples = w.samples[len(w.samples)-windowSize:]
+		}
+	}
+	for id := range p.containers {
+		if _, ok := samples[id]; !ok {
+			delete(p.containers, id)
+		}
+	}
+
+	for uid, info := range podInfos {
+		pw, ok := p.pods[uid]
+		if !ok {
+			pw = &podWindow{
+				ref: statsapi.PodReference{
+					Name:      info.PodName,
+					Namespace: info.PodNamespace,
+					UID:       string(uid),
+				},
+				startTime: now,
+			}
+			p.pods[uid] = pw
+		}
+		if info.StartTime.Before(pw.startTime) {
+			pw.startTime = info.StartTime
+		}
+		if network, ok := networks[uid]; ok {
+			pw.network = network
+		}
+		if pw.podDir == nil || now.Sub(pw.podDir.Time.Time) >= fsSamplePeriod {
+			// The lock is held while walking the directory, which only blocks
+			// readers of the stats for the duration of a walk per minute.
+			podDir, err := readDirUsage(p.podDirFunc(uid), now)
+			if err != nil {
+				klog.V(4).InfoS("Failed to read usage of pod directory", "pod", klog.KRef(info.PodNamespace, info.PodName), "err", err)
+			} else {
+				pw.podDir = podDir
+			}
+		}
+	}
+	for uid := range p.pods {
+		if _, ok := podInfos[uid]; !ok {
+			delete(p.pods, uid)
+		}
+	}
+}
+
+// sampleContainer reads the usage of a container. The CPU and memory usage
+// are read from its cgroup when it has one, from its processes otherwise.
+func (p *provider) sampleContainer(info ContainerInfo, groups map[int]*processGroupUsage, now time.Time) statsapi.ContainerStats {
+	stats := statsapi.ContainerStats{
+		Name:      info.Name,
+		StartTime: metav1.NewTime(info.StartTime),
+	}
+	if info.CgroupPath != "" {
+		cpu, memory, err := readCgroupStats(info.CgroupPath, now)
+		if err != nil {
+			klog.V(4).InfoS("Failed to read cgroup stats of container", "containerID", info.ID, "err", err)
+		}
+		stats.CPU, stats.Memory = cpu, memory
+	} else if usage, ok := groups[info.Pid]; ok {
+		stats.CPU, stats.Memory = usage.toStats(now)
+	}
+	if info.LogPath != "" {
+		logs, err := readDirUsage(filepath.Dir(info.LogPath), now)
+		if err != nil {
+			klog.V(4).InfoS("Failed to read usage of container logs", "containerID", info.ID, "err", err)
+		}
+		stats.Logs = logs
+	}
+	return stats
+}
+
+// setUsageNanoCores sets the CPU usage of the sample averaged since the
+// previous sample of the container.
+func setUsageNanoCores(prev, cur *statsapi.ContainerStats) {
+	if prev == nil || prev.CPU == nil || prev.CPU.UsageCoreNanoSeconds == nil ||
+		cur.CPU == nil || cur.CPU.UsageCoreNanoSeconds == nil {
+		return
+	}
+	elapsed := cur.CPU.Time.Sub(prev.CPU.Time.Time)
+	if elapsed <= 0 || *cur.CPU.UsageCoreNanoSeconds < *prev.CPU.UsageCoreNanoSeconds {
+		return
+	}
+	usage := *cur.CPU.UsageCoreNanoSeconds - *prev.CPU.UsageCoreNanoSeconds
+	nanoCores := uint64(float64(usage) / elapsed.Seconds())
+	cur.CPU.UsageNanoCores = &nanoCores
+}
+
+func (p *provider) ListPodStats() []statsapi.PodStats {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+
+	result := make([]statsapi.PodStats, 0, len(p.pods))
+	for uid := range p.pods {
+		result = append(result, *p.buildPodStatsLocked(uid))
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].PodRef.Namespace != result[j].PodRef.Namespace {
+			return result[i].PodRef.Namespace < result[j].PodRef.Namespace
+		}
+		return result[i].PodRef.Name < result[j].PodRef.Name
+	})
+	return result
+}
+
+func (p *provider) GetPodStats(podUID types.UID) (*statsapi.PodStats, bool) {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+
+	if _, ok := p.pods[podUID]; !ok {
+		return nil, false
+	}
+	return p.buildPodStatsLocked(podUID), true
+}
+
+func (p *provider) GetContainerStats(podUID types.UID, containerName string) (*statsapi.ContainerStats, bool) {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+
+	w := p.findContainerLocked(podUID, containerName)
+	if w == nil || w.latest() == nil {
+		return nil, false
+	}
+	stats := *w.latest()
+	return &stats, true
+}
+
+func (p *provider) GetContainerStatsWindow(podUID types.UID, containerName string) []statsapi.ContainerStats {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+
+	w := p.findContainerLocked(podUID, containerName)
+	if w == nil {
+		return nil
+	}
+	return append([]statsapi.ContainerStats(nil), w.samples...)
+}
+
+// findContainerLocked returns the samples of the running instance of the
+// named container. The caller must hold the lock.
+func (p *provider) findContainerLocked(podUID types.UID, containerName string) *containerWindow {
+	for _, w := range p.containers {
+		if w.info.PodUID == podUID && w.info.Name == containerName {
+			return w
+		}
+	}
+	return nil
+}
+
+// buildPodStatsLocked aggregates the latest samples of the containers of the
+// pod. The caller must hold the lock.
+func (p *provider) buildPodStatsLocked(podUID types.UID) *statsapi.PodStats {
+	pw := p.pods[podUID]
+	stats := &statsapi.PodStats{
+		PodRef:    pw.ref,
+		StartTime: metav1.NewTime(pw.startTime),
+		Network:   pw.network,
+	}
+
+	var containers []*containerWindow
+	for _, w := range p.containers {
+		if w.info.PodUID == podUID && w.latest() != nil {
+			containers = append(containers, w)
+		}
+	}
+	sort.Slice(containers, func(i, j int) bool {
+		return containers[i].info.Name < containers[j].info.Name
+	})
+
+	var (
+		cpu                  *statsapi.CPUStats
+		memory               *statsapi.MemoryStats
+		ephemeral            = &statsapi.FsStats{}
+		hasEphemeral         bool
+		ephemeralUsedBytes   uint64
+		ephemeralInodesUsed  uint64
+		cpuTime, memoryTime  time.Time
+		ephemeralUpdatedTime time.Time
+	)
+	if pw.podDir != nil {
+		podDir := *pw.podDir
+		ephemeral = &podDir
+		hasEphemeral = true
+		ephemeralUsedBytes += valueOrZero(pw.podDir.UsedBytes)
+		ephemeralInodesUsed += valueOrZero(pw.podDir.InodesUsed)
+		ephemeralUpdatedTime = pw.podDir.Time.Time
+	}
+	for _, w := range containers {
+		c := *w.latest()
+		stats.Containers = append(stats.Containers, c)
+		if c.CPU != nil {
+			if cpu == nil {
+				cpu = &statsapi.CPUStats{}
+			}
+			cpu.UsageNanoCores = addUint64(cpu.UsageNanoCores, c.CPU.UsageNanoCores)
+			cpu.UsageCoreNanoSeconds = addUint64(cpu.UsageCoreNanoSeconds, c.CPU.UsageCoreNanoSeconds)
+			cpuTime = latestTime(cpuTime, c.CPU.Time.Time)
+		}
+		if c.Memory != nil {
+			if memory == nil {
+				memory = &statsapi.MemoryStats{}
+			}
+			memory.UsageBytes = addUint64(memory.UsageBytes, c.Memory.UsageBytes)
+			memory.WorkingSetBytes = addUint64(memory.WorkingSetBytes, c.Memory.WorkingSetBytes)
+			memory.RSSBytes = addUint64(memory.RSSBytes, c.Memory.RSSBytes)
+			memory.PageFaults = addUint64(memory.PageFaults, c.Memory.PageFaults)
+			memory.MajorPageFaults = addUint64(memory.MajorPageFaults, c.Memory.MajorPageFaults)
+			memoryTime = latestTime(memoryTime, c.Memory.Time.Time)
+		}
+		if c.Logs != nil {
+			if !hasEphemeral {
+				logs := *c.Logs
+				ephemeral = &logs
+				hasEphemeral = true
+			}
+			ephemeralUsedBytes += valueOrZero(c.Logs.UsedBytes)
+			ephemeralInodesUsed += valueOrZero(c.Logs.InodesUsed)
+			ephemeralUpdatedTime = latestTime(ephemeralUpdatedTime, c.Logs.Time.Time)
+		}
+	}
+	if cpu != nil {
+		cpu.Time = metav1.NewTime(cpuTime)
+		stats.CPU = cpu
+	}
+	if memory != nil {
+		memory.Time = metav1.NewTime(memoryTime)
+		stats.Memory = memory
+	}
+	if hasEphemeral {
+		ephemeral.Time = metav1.NewTime(ephemeralUpdatedTime)
+		ephemeral.UsedBytes = &ephemeralUsedBytes
+		ephemeral.InodesUsed = &ephemeralInodesUsed
+		stats.EphemeralStorage = ephemeral
+	}
+	return stats
+}
+
+// addUint64 adds b to a, where nil means the value is unknown.
+func addUint64(a, b *uint64) *uint64 {
+	if b == nil {
+		return a
+	}
+	sum := *b
+	if a != nil {
+		sum += *a
+	}
+	return &sum
+}
+
+func valueOrZero(v *uint64) uint64 {
+	if v == nil {
+		return 0
+	}
+	return *v
+}
+
+func latestTime(a, b time.Time) time.Time {
+	if b.After(a) {
+		return b
+	}
+	return a
+}
+
+func uint64Ptr(v uint64) *uint64 {
+	return &v
+}
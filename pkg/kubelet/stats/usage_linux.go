@@ -0,0 +1,295 @@
+//go:build linux
+// +build linux
+
+package stats
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	statsapi "github.com/xuliangTang/mykubelet/pkg/kubelet/apis/stats/v1alpha1"
+	"github.com/xuliangTang/mykubelet/pkg/kubelet/cm"
+	"golang.org/x/sys/unix"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	// userHZ is the unit of the CPU times reported in /proc/<pid>/stat.
+	userHZ = 100
+
+	// defaultNetworkInterfaceName is the interface reported as the default one of a pod.
+	defaultNetworkInterfaceName = "eth0"
+)
+
+// readCgroupStats reads the CPU and memory usage of the cgroup.
+func readCgroupStats(cgroupPath string, now time.Time) (*statsapi.CPUStats, *statsapi.MemoryStats, error) {
+	dir := filepath.Join(cm.CgroupMountPoint, cgroupPath)
+
+	cpuStat, err := readKeyValues(filepath.Join(dir, "cpu.stat"))
+	if err != nil {
+		return nil, nil, err
+	}
+	cpu := &statsapi.CPUStats{Time: metav1.NewTime(now)}
+	if usage, ok := cpuStat["usage_usec"]; ok {
+		cpu.UsageCoreNanoSeconds = uint64Ptr(usage * 1000)
+	}
+
+	current, err := readUint64(filepath.Join(dir, "memory.current"))
+	if err != nil {
+		return cpu, nil, err
+	}
+	memoryStat, err := readKeyValues(filepath.Join(dir, "memory.stat"))
+	if err != nil {
+		return cpu, nil, err
+	}
+	// The working set is the memory in use minus the page cache that is the
+	// first to be reclaimed, the way cAdvisor computes it.
+	workingSet := current
+	if inactiveFile := memoryStat["inactive_file"]; inactiveFile < workingSet {
+		workingSet -= inactiveFile
+	} else {
+		workingSet = 0
+	}
+	memory := &statsapi.MemoryStats{
+		Time:            metav1.NewTime(now),
+		UsageBytes:      uint64Ptr(current),
+		WorkingSetBytes: uint64Ptr(workingSet),
+		RSSBytes:        uint64Ptr(memoryStat["anon"]),
+		PageFaults:      uint64Ptr(memoryStat["pgfault"]),
+		MajorPageFaults: uint64Ptr(memoryStat["pgmajfault"]),
+	}
+	if limit, err := readUint64(filepath.Join(dir, "memory.max")); err == nil && limit > workingSet {
+		memory.AvailableBytes = uint64Ptr(limit - workingSet)
+	}
+	return cpu, memory, nil
+}
+
+// readKeyValues reads a flat keyed cgroup file such as cpu.stat.
+func readKeyValues(path string) (map[string]uint64, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	values := make(map[string]uint64)
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 2 {
+			continue
+		}
+		value, err := strconv.ParseUint(fields[1], 10, 64)
+		if err != nil {
+			continue
+		}
+		values[fields[0]] = value
+	}
+	return values, scanner.Err()
+}
+
+// readUint64 reads a single value cgroup file. "max" fails to parse.
+func readUint64(path string) (uint64, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseUint(strings.TrimSpace(string(data)), 10, 64)
+}
+
+// processGroupUsage is the usage of the processes of a process group.
+type processGroupUsage struct {
+	cpuTicks    uint64
+	rssPages    uint64
+	minorFaults uint64
+	majorFaults uint64
+}
+
+func (u *processGroupUsage) toStats(now time.Time) (*statsapi.CPUStats, *statsapi.MemoryStats) {
+	rss := u.rssPages * uint64(os.Getpagesize())
+	cpu := &statsapi.CPUStats{
+		Time:                 metav1.NewTime(now),
+		UsageCoreNanoSeconds: uint64Ptr(u.cpuTicks * uint64(time.Second) / userHZ),
+	}
+	// Without a cgroup, the page cache of the processes can not be told
+	// apart, the working set is their resident memory.
+	memory := &statsapi.MemoryStats{
+		Time:            metav1.NewTime(now),
+		UsageBytes:      uint64Ptr(rss),
+		WorkingSetBytes: uint64Ptr(rss),
+		RSSBytes:        uint64Ptr(rss),
+		PageFaults:      uint64Ptr(u.minorFaults),
+		MajorPageFaults: uint64Ptr(u.majorFaults),
+	}
+	return cpu, memory
+}
+
+// listProcessGroups sums the usage of the live processes per process group.
+// The CPU time of children that already exited is not accounted.
+func listProcessGroups() (map[int]*processGroupUsage, error) {
+	entries, err := os.ReadDir("/proc")
+	if err != nil {
+		return nil, err
+	}
+	groups := make(map[int]*processGroupUsage)
+	for _, entry := range entries {
+		if _, err := strconv.Atoi(entry.Name()); err != nil {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join("/proc", entry.Name(), "stat"))
+		if err != nil {
+			// The process exited in the meantime.
+			continue
+		}
+		pgid, usage, err := parseProcessStat(string(data))
+		if err != nil {
+			continue
+		}
+		group, ok := groups[pgid]
+		if !ok {
+			group = &processGroupUsage{}
+			groups[pgid] = group
+		}
+		group.cpuTicks += usage.cpuTicks
+		group.rssPages += usage.rssPages
+		group.minorFaults += usage.minorFaults
+		group.majorFaults += usage.majorFaults
+	}
+	return groups, nil
+}
+
+// parseProcessStat parses the content of /proc/<pid>/stat, see proc(5).
+func parseProcessStat(stat string) (int, *processGroupUsage, error) {
+	// The command name may contain spaces and parentheses, the fields start
+	// after its closing parenthesis.
+	i := strings.LastIndexByte(stat, ')')
+	if i < 0 {
+		return 0, nil, fmt.Errorf("malformed stat %q", stat)
+	}
+	fields := strings.Fields(stat[i+1:])
+	// fields[0] is the 3rd field (state), the rss is the 24th field.
+	if len(fields) < 22 {
+		return 0, nil, fmt.Errorf("malformed stat %q", stat)
+	}
+	parse := func(index int) uint64 {
+		v, _ := strconv.ParseUint(fields[index], 10, 64)
+		return v
+	}
+	pgid, err := strconv.Atoi(fields[2])
+	if err != nil {
+		return 0, nil, err
+	}
+	return pgid, &processGroupUsage{
+		minorFaults: parse(7),
+		majorFaults: parse(9),
+		cpuTicks:    parse(11) + parse(12),
+		rssPages:    parse(21),
+	}, nil
+}
+
+// readNetworkStats reads the counters of the interfaces in the network
+// namespace of the process.
+func readNetworkStats(pid int, now time.Time) (*statsapi.NetworkStats, error) {
+	data, err := os.ReadFile(filepath.Join("/proc", strconv.Itoa(pid), "net", "dev"))
+	if err != nil {
+		return nil, err
+	}
+	network := &statsapi.NetworkStats{Time: metav1.NewTime(now)}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := scanner.Text()
+		i := strings.IndexByte(line, ':')
+		if i < 0 {
+			// The header lines.
+			continue
+		}
+		name := strings.TrimSpace(line[:i])
+		fields := strings.Fields(line[i+1:])
+		if name == "lo" || len(fields) < 16 {
+			continue
+		}
+		parse := func(index int) *uint64 {
+			v, _ := strconv.ParseUint(fields[index], 10, 64)
+			return &v
+		}
+		network.Interfaces = append(network.Interfaces, statsapi.InterfaceStats{
+			Name:     name,
+			RxBytes:  parse(0),
+			RxErrors: parse(2),
+			TxBytes:  parse(8),
+			TxErrors: parse(10),
+		})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	for _, iface := range network.Interfaces {
+		if iface.Name == defaultNetworkInterfaceName {
+			network.InterfaceStats = iface
+			return network, nil
+		}
+	}
+	if len(network.Interfaces) > 0 {
+		network.InterfaceStats = network.Interfaces[0]
+	}
+	return network, nil
+}
+
+// readDirUsage returns the disk space and inodes used by the directory tree,
+// and the capacity of the filesystem it lives on.
+func readDirUsage(dir string, now time.Time) (*statsapi.FsStats, error) {
+	var statfs unix.Statfs_t
+	if err := unix.Statfs(dir, &statfs); err != nil {
+		return nil, err
+	}
+
+	var usedBytes, inodesUsed uint64
+	seen := make(map[uint64]struct{})
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			// Files may go away during the walk.
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		stat, ok := info.Sys().(*syscall.Stat_t)
+		if !ok {
+			return nil
+		}
+		// Hard links are only accounted once.
+		if _, ok := seen[stat.Ino]; ok {
+			return nil
+		}
+		seen[stat.Ino] = struct{}{}
+		usedBytes += uint64(stat.Blocks) * 512
+		inodesUsed++
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &statsapi.FsStats{
+		Time:           metav1.NewTime(now),
+		AvailableBytes: uint64Ptr(statfs.Bavail * uint64(statfs.Bsize)),
+		CapacityBytes:  uint64Ptr(statfs.Blocks * uint64(statfs.Bsize)),
+		UsedBytes:      uint64Ptr(usedBytes),
+		InodesFree:     uint64Ptr(statfs.Ffree),
+		Inodes:         uint64Ptr(statfs.Files),
+		InodesUsed:     uint64Ptr(inodesUsed),
+	}, nil
+}
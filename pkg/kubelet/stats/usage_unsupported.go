@@ -0,0 +1,35 @@
+//go:build !linux
+// +build !linux
+
+package stats
+
+import (
+	"errors"
+	"time"
+
+	statsapi "github.com/xuliangTang/mykubelet/pkg/kubelet/apis/stats/v1alpha1"
+)
+
+var errUnsupported = errors.New("stats are not supported on this platform")
+
+type processGroupUsage struct{}
+
+func (u *processGroupUsage) toStats(now time.Time) (*statsapi.CPUStats, *statsapi.MemoryStats) {
+	return nil, nil
+}
+
+func readCgroupStats(cgroupPath string, now time.Time) (*statsapi.CPUStats, *statsapi.MemoryStats, error) {
+	return nil, nil, errUnsupported
+}
+
+func listProcessGroups() (map[int]*processGroupUsage, error) {
+	return nil, errUnsupported
+}
+
+func readNetworkStats(pid int, now time.Time) (*statsapi.NetworkStats, error) {
+	return nil, errUnsupported
+}
+
+func readDirUsage(dir string, now time.Time) (*statsapi.FsStats, error) {
+	return nil, errUnsupported
+}
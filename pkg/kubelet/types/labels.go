@@ -0,0 +1,30 @@
+package types
+
+// Label keys the kubelet sets on the sandboxes and containers it creates in
+// a CRI runtime.
+const (
+	KubernetesPodNameLabel       = "io.kubernetes.pod.name"
+	KubernetesPodNamespaceLabel  = "io.kubernetes.pod.namespace"
+	KubernetesPodUIDLabel        = "io.kubernetes.pod.uid"
+	KubernetesContainerNameLabel = "io.kubernetes.container.name"
+)
+
+// GetContainerName returns the value of the KubernetesContainerNameLabel.
+func GetContainerName(labels map[string]string) string {
+	return labels[KubernetesContainerNameLabel]
+}
+
+// GetPodName returns the value of the KubernetesPodNameLabel.
+func GetPodName(labels map[string]string) string {
+	return labels[KubernetesPodNameLabel]
+}
+
+// GetPodUID returns the value of the KubernetesPodUIDLabel.
+func GetPodUID(labels map[string]string) string {
+	return labels[KubernetesPodUIDLabel]
+}
+
+// GetPodNamespace returns the value of the KubernetesPodNamespaceLabel.
+func GetPodNamespace(labels map[string]string) string {
+	return labels[KubernetesPodNamespaceLabel]
+}
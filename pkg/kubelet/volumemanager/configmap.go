@@ -0,0 +1,134 @@
+package volumemanager
+
+import (
+	"fmt"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/klog/v2"
+)
+
+const configMapPluginName = "kubernetes.io~configmap"
+
+type configMapPlugin struct {
+	host VolumeHost
+}
+
+func (plugin *configMapPlugin) GetPluginName() string {
+	return configMapPluginName
+}
+
+func (plugin *configMapPlugin) CanSupport(volume *v1.Volume) bool {
+	return volume.ConfigMap != nil
+}
+
+func (plugin *configMapPlugin) RequiresRemount() bool {
+	return true
+}
+
+func (plugin *configMapPlugin) GetAttributes() Attributes {
+	return Attributes{
+		ReadOnly: true,
+		Managed:  true,
+	}
+}
+
+func (plugin *configMapPlugin) SetUp(pod *v1.Pod, volume *v1.Volume, dir string) (string, error) {
+	source := volume.ConfigMap
+	optional := source.Optional != nil && *source.Optional
+	configMap, err := plugin.host.GetConfigMapFunc()(pod.Namespace, source.Name)
+	if err != nil {
+		if !(errors.IsNotFound(err) && optional) {
+			klog.ErrorS(err, "Couldn't get configMap", "pod", klog.KObj(pod), "configMap", source.Name)
+			return "", err
+		}
+		configMap = &v1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: pod.Namespace,
+				Name:      source.Name,
+			},
+		}
+	}
+
+	totalBytes := totalBytes(configMap)
+	klog.V(3).InfoS("Received configMap", "pod", klog.KObj(pod), "configMap", source.Name,
+		"dataKeys", len(configMap.Data), "binaryDataKeys", len(configMap.BinaryData), "totalBytes", totalBytes)
+
+	defaultMode := source.DefaultMode
+	if defaultMode == nil {
+		mode := v1.ConfigMapVolumeSourceDefaultMode
+		defaultMode = &mode
+	}
+	payload, err := MakeConfigMapPayload(source.Items, configMap, defaultMode, optional)
+	if err != nil {
+		return "", err
+	}
+
+	logContext := fmt.Sprintf("pod %v/%v volume %v", pod.Namespace, pod.Name, volume.Name)
+	if err := setUpWrapper(dir, logContext, payload); err != nil {
+		return "", err
+	}
+	return dir, nil
+}
+
+func (plugin *configMapPlugin) TearDown(dir string) error {
+	return removeDir(dir)
+}
+
+// MakeConfigMapPayload function is exported so that it can be called from the projection volume driver
+func MakeConfigMapPayload(mappings []v1.KeyToPath, configMap *v1.ConfigMap, defaultMode *int32, optional bool) (map[string]FileProjection, error) {
+	if defaultMode == nil {
+		return nil, fmt.Errorf("no defaultMode used, not even the default value for it")
+	}
+
+	payload := make(map[string]FileProjection, (len(configMap.Data) + len(configMap.BinaryData)))
+	var fileProjection FileProjection
+
+	if len(mappings) == 0 {
+		for name, data := range configMap.Data {
+			fileProjection.Data = []byte(data)
+			fileProjection.Mode = *defaultMode
+			payload[name] = fileProjection
+		}
+		for name, data := range configMap.BinaryData {
+			fileProjection.Data = data
+			fileProjection.Mode = *defaultMode
+			payload[name] = fileProjection
+		}
+	} else {
+		for _, ktp := range mappings {
+			if stringData, ok := configMap.Data[ktp.Key]; ok {
+				fileProjection.Data = []byte(stringData)
+			} else if binaryData, ok := configMap.BinaryData[ktp.Key]; ok {
+				fileProjection.Data = binaryData
+			} else {
+				if optional {
+					continue
+				}
+				return nil, fmt.Errorf("configmap references non-existent config key: %s", ktp.Key)
+			}
+
+			if ktp.Mode != nil {
+				fileProjection.Mode = *ktp.Mode
+			} else {
+				fileProjection.Mode = *defaultMode
+			}
+			payload[ktp.Path] = fileProjection
+		}
+	}
+
+	return payload, nil
+}
+
+func totalBytes(configMap *v1.ConfigMap) int {
+	totalSize := 0
+	for _, value := range configMap.Data {
+		totalSize += len(value)
+	}
+	for _, value := range configMap.BinaryData {
+		totalSize += len(value)
+	}
+
+	return totalSize
+}
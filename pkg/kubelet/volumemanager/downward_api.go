@@ -0,0 +1,109 @@
+package volumemanager
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"github.com/xuliangTang/mykubelet/pkg/api/v1/resource"
+	"github.com/xuliangTang/mykubelet/pkg/fieldpath"
+	v1 "k8s.io/api/core/v1"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/klog/v2"
+)
+
+const downwardAPIPluginName = "kubernetes.io~downward-api"
+
+type downwardAPIPlugin struct {
+	host VolumeHost
+}
+
+func (plugin *downwardAPIPlugin) GetPluginName() string {
+	return downwardAPIPluginName
+}
+
+func (plugin *downwardAPIPlugin) CanSupport(volume *v1.Volume) bool {
+	return volume.DownwardAPI != nil
+}
+
+// RequiresRemount is true because labels and annotations may change while
+// the pod is running.
+func (plugin *downwardAPIPlugin) RequiresRemount() bool {
+	return true
+}
+
+func (plugin *downwardAPIPlugin) GetAttributes() Attributes {
+	return Attributes{
+		ReadOnly: true,
+		Managed:  true,
+	}
+}
+
+func (plugin *downwardAPIPlugin) SetUp(pod *v1.Pod, volume *v1.Volume, dir string) (string, error) {
+	source := volume.DownwardAPI
+	defaultMode := source.DefaultMode
+	if defaultMode == nil {
+		mode := v1.DownwardAPIVolumeSourceDefaultMode
+		defaultMode = &mode
+	}
+	data, err := CollectData(source.Items, pod, plugin.host, defaultMode)
+	if err != nil {
+		klog.ErrorS(err, "Error preparing data for downwardAPI volume", "pod", klog.KObj(pod), "volume", volume.Name)
+		return "", err
+	}
+
+	logContext := fmt.Sprintf("pod %v/%v volume %v", pod.Namespace, pod.Name, volume.Name)
+	if err := setUpWrapper(dir, logContext, data); err != nil {
+		return "", err
+	}
+	return dir, nil
+}
+
+func (plugin *downwardAPIPlugin) TearDown(dir string) error {
+	return removeDir(dir)
+}
+
+// CollectData collects requested downwardAPI in data map.
+// Map's key is the requested name of file to dump
+// Map's value is the (sorted) content of the field to be dumped in the file.
+//
+// Note: this function is exported so that it can be called from the projection volume driver
+func CollectData(items []v1.DownwardAPIVolumeFile, pod *v1.Pod, host VolumeHost, defaultMode *int32) (map[string]FileProjection, error) {
+	if defaultMode == nil {
+		return nil, fmt.Errorf("no defaultMode used, not even the default value for it")
+	}
+
+	errlist := []error{}
+	data := make(map[string]FileProjection)
+	for _, fileInfo := range items {
+		var fileProjection FileProjection
+		fPath := filepath.Clean(fileInfo.Path)
+		if fileInfo.Mode != nil {
+			fileProjection.Mode = *fileInfo.Mode
+		} else {
+			fileProjection.Mode = *defaultMode
+		}
+		if fileInfo.FieldRef != nil {
+			// TODO: unify with Kubelet.podFieldSelectorRuntimeValue
+			if values, err := fieldpath.ExtractFieldPathAsString(pod, fileInfo.FieldRef.FieldPath); err != nil {
+				klog.ErrorS(err, "Unable to extract field", "fieldPath", fileInfo.FieldRef.FieldPath)
+				errlist = append(errlist, err)
+			} else {
+				fileProjection.Data = []byte(values)
+			}
+		} else if fileInfo.ResourceFieldRef != nil {
+			containerName := fileInfo.ResourceFieldRef.ContainerName
+			nodeAllocatable, err := host.GetNodeAllocatable()
+			if err != nil {
+				errlist = append(errlist, err)
+			} else if values, err := resource.ExtractResourceValueByContainerNameAndNodeAllocatable(fileInfo.ResourceFieldRef, pod, containerName, nodeAllocatable); err != nil {
+				klog.ErrorS(err, "Unable to extract field", "resource", fileInfo.ResourceFieldRef.Resource)
+				errlist = append(errlist, err)
+			} else {
+				fileProjection.Data = []byte(values)
+			}
+		}
+
+		data[fPath] = fileProjection
+	}
+	return data, utilerrors.NewAggregate(errlist)
+}
@@ -0,0 +1,65 @@
+package volumemanager
+
+import (
+	"os"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/klog/v2"
+)
+
+const emptyDirPluginName = "kubernetes.io~empty-dir"
+
+// perm is the permission set on emptyDir volumes, so that any user the
+// container runs as can write to it.
+const perm os.FileMode = 0777
+
+type emptyDirPlugin struct{}
+
+func (plugin *emptyDirPlugin) GetPluginName() string {
+	return emptyDirPluginName
+}
+
+func (plugin *emptyDirPlugin) CanSupport(volume *v1.Volume) bool {
+	return volume.EmptyDir != nil
+}
+
+func (plugin *emptyDirPlugin) RequiresRemount() bool {
+	return false
+}
+
+func (plugin *emptyDirPlugin) GetAttributes() Attributes {
+	return Attributes{
+		ReadOnly: false,
+		Managed:  true,
+	}
+}
+
+func (plugin *emptyDirPlugin) SetUp(pod *v1.Pod, volume *v1.Volume, dir string) (string, error) {
+	if err := os.MkdirAll(dir, perm); err != nil {
+		return "", err
+	}
+
+	if volume.EmptyDir.Medium == v1.StorageMediumMemory {
+		var sizeLimit int64
+		if volume.EmptyDir.SizeLimit != nil {
+			sizeLimit = volume.EmptyDir.SizeLimit.Value()
+		}
+		if err := setupTmpfs(dir, sizeLimit); err != nil {
+			// tmpfs需要CAP_SYS_ADMIN，没有权限时退化为普通目录
+			klog.InfoS("Unable to mount tmpfs for emptyDir, falling back to node disk", "pod", klog.KObj(pod), "volume", volume.Name, "err", err)
+		}
+	}
+
+	// Chmod is needed because MkdirAll honours the process' umask.
+	if err := os.Chmod(dir, perm); err != nil {
+		return "", err
+	}
+	return dir, nil
+}
+
+func (plugin *emptyDirPlugin) TearDown(dir string) error {
+	if err := teardownTmpfs(dir); err != nil {
+		return err
+	}
+	return os.RemoveAll(dir)
+}
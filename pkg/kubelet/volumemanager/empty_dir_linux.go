@@ -0,0 +1,46 @@
+//go:build linux
+// +build linux
+
+package volumemanager
+
+import (
+	"fmt"
+
+	"golang.org/x/sys/unix"
+	"k8s.io/klog/v2"
+)
+
+// isTmpfs returns true if dir is the root of a tmpfs mount.
+func isTmpfs(dir string) (bool, error) {
+	var buf unix.Statfs_t
+	if err := unix.Statfs(dir, &buf); err != nil {
+		return false, err
+	}
+	return buf.Type == unix.TMPFS_MAGIC, nil
+}
+
+// setupTmpfs mounts a tmpfs at dir unless one is already there.
+func setupTmpfs(dir string, sizeLimit int64) error {
+	if mounted, err := isTmpfs(dir); err != nil {
+		return err
+	} else if mounted {
+		return nil
+	}
+
+	options := "mode=0777"
+	if sizeLimit > 0 {
+		options = fmt.Sprintf("%s,size=%d", options, sizeLimit)
+	}
+	klog.V(3).InfoS("Mounting tmpfs for emptyDir", "dir", dir, "options", options)
+	return unix.Mount("tmpfs", dir, "tmpfs", 0, options)
+}
+
+// teardownTmpfs unmounts the tmpfs at dir, if any.
+func teardownTmpfs(dir string) error {
+	mounted, err := isTmpfs(dir)
+	if err != nil || !mounted {
+		// 目录不存在或不是tmpfs，无需卸载
+		return nil
+	}
+	return unix.Unmount(dir, 0)
+}
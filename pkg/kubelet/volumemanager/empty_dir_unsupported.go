@@ -0,0 +1,14 @@
+//go:build !linux
+// +build !linux
+
+package volumemanager
+
+import "errors"
+
+func setupTmpfs(dir string, sizeLimit int64) error {
+	return errors.New("tmpfs is only supported on linux")
+}
+
+func teardownTmpfs(dir string) error {
+	return nil
+}
@@ -0,0 +1,184 @@
+package volumemanager
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	v1 "k8s.io/api/core/v1"
+)
+
+const hostPathPluginName = "kubernetes.io~host-path"
+
+type hostPathPlugin struct{}
+
+func (plugin *hostPathPlugin) GetPluginName() string {
+	return hostPathPluginName
+}
+
+func (plugin *hostPathPlugin) CanSupport(volume *v1.Volume) bool {
+	return volume.HostPath != nil
+}
+
+func (plugin *hostPathPlugin) RequiresRemount() bool {
+	return false
+}
+
+// GetAttributes reports the volume as unmanaged: the ownership of a path of
+// the host is never changed for a pod.
+func (plugin *hostPathPlugin) GetAttributes() Attributes {
+	return Attributes{
+		ReadOnly: false,
+		Managed:  false,
+	}
+}
+
+// SetUp does not create anything under dir: containers see the host path
+// itself. The path is only checked against the volume's declared type.
+func (plugin *hostPathPlugin) SetUp(pod *v1.Pod, volume *v1.Volume, dir string) (string, error) {
+	path := volume.HostPath.Path
+	if !filepath.IsAbs(path) {
+		return "", fmt.Errorf("hostPath %q must be an absolute path", path)
+	}
+	if err := checkType(path, volume.HostPath.Type); err != nil {
+		return "", err
+	}
+	return path, nil
+}
+
+// TearDown does nothing: the host path outlives the pod.
+func (plugin *hostPathPlugin) TearDown(dir string) error {
+	return nil
+}
+
+type hostPathTypeChecker interface {
+	Exists() bool
+	IsFile() bool
+	MakeFile() error
+	IsDir() bool
+	MakeDir() error
+	IsBlock() bool
+	IsChar() bool
+	IsSocket() bool
+	GetPath() string
+}
+
+type fileTypeChecker struct {
+	path string
+}
+
+func (ftc *fileTypeChecker) Exists() bool {
+	_, err := os.Lstat(ftc.path)
+	return err == nil
+}
+
+func (ftc *fileTypeChecker) IsFile() bool {
+	if !ftc.Exists() {
+		return false
+	}
+	info, err := os.Stat(ftc.path)
+	if err != nil {
+		return false
+	}
+	return !info.IsDir()
+}
+
+func (ftc *fileTypeChecker) MakeFile() error {
+	f, err := os.OpenFile(ftc.path, os.O_CREATE, os.FileMode(0644))
+	if err != nil {
+		if os.IsExist(err) {
+			return nil
+		}
+		return err
+	}
+	return f.Close()
+}
+
+func (ftc *fileTypeChecker) IsDir() bool {
+	info, err := os.Stat(ftc.path)
+	if err != nil {
+		return false
+	}
+	return info.IsDir()
+}
+
+func (ftc *fileTypeChecker) MakeDir() error {
+	return os.MkdirAll(ftc.path, os.FileMode(0755))
+}
+
+func (ftc *fileTypeChecker) IsBlock() bool {
+	return ftc.hasMode(os.ModeDevice, os.ModeCharDevice)
+}
+
+func (ftc *fileTypeChecker) IsChar() bool {
+	return ftc.hasMode(os.ModeDevice|os.ModeCharDevice, 0)
+}
+
+func (ftc *fileTypeChecker) IsSocket() bool {
+	return ftc.hasMode(os.ModeSocket, 0)
+}
+
+// hasMode returns true if all bits in want and none in exclude are set.
+func (ftc *fileTypeChecker) hasMode(want, exclude os.FileMode) bool {
+	info, err := os.Stat(ftc.path)
+	if err != nil {
+		return false
+	}
+	mode := info.Mode()
+	return mode&want == want && mode&exclude == 0
+}
+
+func (ftc *fileTypeChecker) GetPath() string {
+	return ftc.path
+}
+
+func newFileTypeChecker(path string) hostPathTypeChecker {
+	return &fileTypeChecker{path: path}
+}
+
+// checkType checks whether the given path is the exact pathType
+func checkType(path string, pathType *v1.HostPathType) error {
+	if pathType == nil || *pathType == v1.HostPathUnset {
+		return nil
+	}
+	return checkTypeInternal(newFileTypeChecker(path), pathType)
+}
+
+func checkTypeInternal(ftc hostPathTypeChecker, pathType *v1.HostPathType) error {
+	switch *pathType {
+	case v1.HostPathDirectoryOrCreate:
+		if !ftc.Exists() {
+			return ftc.MakeDir()
+		}
+		fallthrough
+	case v1.HostPathDirectory:
+		if !ftc.IsDir() {
+			return fmt.Errorf("hostPath type check failed: %s is not a directory", ftc.GetPath())
+		}
+	case v1.HostPathFileOrCreate:
+		if !ftc.Exists() {
+			return ftc.MakeFile()
+		}
+		fallthrough
+	case v1.HostPathFile:
+		if !ftc.IsFile() {
+			return fmt.Errorf("hostPath type check failed: %s is not a file", ftc.GetPath())
+		}
+	case v1.HostPathSocket:
+		if !ftc.IsSocket() {
+			return fmt.Errorf("hostPath type check failed: %s is not a socket file", ftc.GetPath())
+		}
+	case v1.HostPathCharDev:
+		if !ftc.IsChar() {
+			return fmt.Errorf("hostPath type check failed: %s is not a character device", ftc.GetPath())
+		}
+	case v1.HostPathBlockDev:
+		if !ftc.IsBlock() {
+			return fmt.Errorf("hostPath type check failed: %s is not a block device", ftc.GetPath())
+		}
+	default:
+		return fmt.Errorf("%s is an invalid volume type", *pathType)
+	}
+
+	return nil
+}
@@ -0,0 +1,101 @@
+package volumemanager
+
+import (
+	"fmt"
+	"os"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/klog/v2"
+)
+
+// Attributes represents the attributes of the volumes of a plugin.
+type Attributes struct {
+	// ReadOnly is true if the containers can not write to the volume.
+	ReadOnly bool
+	// Managed is true if the kubelet owns the contents of the volume, whose
+	// ownership is then changed to the fsGroup of the pod.
+	Managed bool
+}
+
+// volumePlugin materializes one kind of volume source into a directory on
+// the host.
+type volumePlugin interface {
+	// GetPluginName returns the plugin's name, escaped for use in paths.
+	GetPluginName() string
+
+	// CanSupport tests whether the plugin supports the given volume.
+	CanSupport(volume *v1.Volume) bool
+
+	// RequiresRemount returns true if the contents of the volume are
+	// backed by API objects and must be refreshed periodically.
+	RequiresRemount() bool
+
+	// GetAttributes returns the attributes of the volumes of the plugin.
+	GetAttributes() Attributes
+
+	// SetUp materializes the volume for the pod. dir is the plugin's
+	// directory for this volume; the returned path is what containers
+	// should see at the mount point.
+	SetUp(pod *v1.Pod, volume *v1.Volume, dir string) (string, error)
+
+	// TearDown removes whatever SetUp created under dir.
+	TearDown(dir string) error
+}
+
+// newVolumePlugins returns the plugins supported by the volume manager.
+func newVolumePlugins(host VolumeHost) []volumePlugin {
+	return []volumePlugin{
+		&emptyDirPlugin{},
+		&hostPathPlugin{},
+		&configMapPlugin{host: host},
+		&secretPlugin{host: host},
+		&downwardAPIPlugin{host: host},
+		&projectedPlugin{host: host, tokens: newTokenCache()},
+	}
+}
+
+// findPluginBySpec returns the plugin that supports the given volume.
+func findPluginBySpec(plugins []volumePlugin, volume *v1.Volume) (volumePlugin, error) {
+	var match volumePlugin
+	for _, plugin := range plugins {
+		if plugin.CanSupport(volume) {
+			if match != nil {
+				return nil, fmt.Errorf("multiple volume plugins matched: %s and %s", match.GetPluginName(), plugin.GetPluginName())
+			}
+			match = plugin
+		}
+	}
+	if match == nil {
+		return nil, fmt.Errorf("no volume plugin matched volume %q", volume.Name)
+	}
+	return match, nil
+}
+
+// findPluginByName returns the plugin with the given name, or nil.
+func findPluginByName(plugins []volumePlugin, name string) volumePlugin {
+	for _, plugin := range plugins {
+		if plugin.GetPluginName() == name {
+			return plugin
+		}
+	}
+	return nil
+}
+
+// setUpWrapper creates dir and writes payload into it atomically. It is
+// shared by the plugins whose contents come from API objects.
+func setUpWrapper(dir string, logContext string, payload map[string]FileProjection) error {
+	if err := os.MkdirAll(dir, 0750); err != nil {
+		return err
+	}
+	writer, err := NewAtomicWriter(dir, logContext)
+	if err != nil {
+		klog.ErrorS(err, "Error creating atomic writer", "volume", logContext)
+		return err
+	}
+	return writer.Write(payload)
+}
+
+// removeDir removes the volume directory and everything in it.
+func removeDir(dir string) error {
+	return os.RemoveAll(dir)
+}
@@ -0,0 +1,157 @@
+package volumemanager
+
+import (
+	"fmt"
+
+	authenticationv1 "k8s.io/api/authentication/v1"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/klog/v2"
+)
+
+const projectedPluginName = "kubernetes.io~projected"
+
+type projectedPlugin struct {
+	host   VolumeHost
+	tokens *tokenCache
+}
+
+func (plugin *projectedPlugin) GetPluginName() string {
+	return projectedPluginName
+}
+
+func (plugin *projectedPlugin) CanSupport(volume *v1.Volume) bool {
+	return volume.Projected != nil
+}
+
+func (plugin *projectedPlugin) RequiresRemount() bool {
+	return true
+}
+
+func (plugin *projectedPlugin) GetAttributes() Attributes {
+	return Attributes{
+		ReadOnly: true,
+		Managed:  true,
+	}
+}
+
+func (plugin *projectedPlugin) SetUp(pod *v1.Pod, volume *v1.Volume, dir string) (string, error) {
+	data, err := plugin.collectData(pod, volume.Projected)
+	if err != nil {
+		klog.ErrorS(err, "Error preparing data for projected volume", "pod", klog.KObj(pod), "volume", volume.Name)
+		return "", err
+	}
+
+	logContext := fmt.Sprintf("pod %v/%v volume %v", pod.Namespace, pod.Name, volume.Name)
+	if err := setUpWrapper(dir, logContext, data); err != nil {
+		return "", err
+	}
+	return dir, nil
+}
+
+func (plugin *projectedPlugin) TearDown(dir string) error {
+	return removeDir(dir)
+}
+
+func (plugin *projectedPlugin) collectData(pod *v1.Pod, projected *v1.ProjectedVolumeSource) (map[string]FileProjection, error) {
+	defaultMode := projected.DefaultMode
+	if defaultMode == nil {
+		mode := v1.ProjectedVolumeSourceDefaultMode
+		defaultMode = &mode
+	}
+
+	errlist := []error{}
+	payload := make(map[string]FileProjection)
+	for _, source := range projected.Sources {
+		switch {
+		case source.Secret != nil:
+			optional := source.Secret.Optional != nil && *source.Secret.Optional
+			secretapi, err := plugin.host.GetSecretFunc()(pod.Namespace, source.Secret.Name)
+			if err != nil {
+				if !(errors.IsNotFound(err) && optional) {
+					klog.ErrorS(err, "Couldn't get secret", "pod", klog.KObj(pod), "secret", source.Secret.Name)
+					errlist = append(errlist, err)
+					continue
+				}
+				secretapi = &v1.Secret{
+					ObjectMeta: metav1.ObjectMeta{
+						Namespace: pod.Namespace,
+						Name:      source.Secret.Name,
+					},
+				}
+			}
+			secretPayload, err := MakeSecretPayload(source.Secret.Items, secretapi, defaultMode, optional)
+			if err != nil {
+				klog.ErrorS(err, "Couldn't get secret payload", "pod", klog.KObj(pod), "secret", source.Secret.Name)
+				errlist = append(errlist, err)
+				continue
+			}
+			for k, v := range secretPayload {
+				payload[k] = v
+			}
+		case source.ConfigMap != nil:
+			optional := source.ConfigMap.Optional != nil && *source.ConfigMap.Optional
+			configMap, err := plugin.host.GetConfigMapFunc()(pod.Namespace, source.ConfigMap.Name)
+			if err != nil {
+				if !(errors.IsNotFound(err) && optional) {
+					klog.ErrorS(err, "Couldn't get configMap", "pod", klog.KObj(pod), "configMap", source.ConfigMap.Name)
+					errlist = append(errlist, err)
+					continue
+				}
+				configMap = &v1.ConfigMap{
+					ObjectMeta: metav1.ObjectMeta{
+						Namespace: pod.Namespace,
+						Name:      source.ConfigMap.Name,
+					},
+				}
+			}
+			configMapPayload, err := MakeConfigMapPayload(source.ConfigMap.Items, configMap, defaultMode, optional)
+			if err != nil {
+				klog.ErrorS(err, "Couldn't get configMap payload", "pod", klog.KObj(pod), "configMap", source.ConfigMap.Name)
+				errlist = append(errlist, err)
+				continue
+			}
+			for k, v := range configMapPayload {
+				payload[k] = v
+			}
+		case source.DownwardAPI != nil:
+			downwardAPIPayload, err := CollectData(source.DownwardAPI.Items, pod, plugin.host, defaultMode)
+			if err != nil {
+				errlist = append(errlist, err)
+				continue
+			}
+			for k, v := range downwardAPIPayload {
+				payload[k] = v
+			}
+		case source.ServiceAccountToken != nil:
+			tp := source.ServiceAccountToken
+			var auds []string
+			if len(tp.Audience) != 0 {
+				auds = []string{tp.Audience}
+			}
+			tr, err := plugin.tokens.GetServiceAccountToken(plugin.host.GetServiceAccountTokenFunc(), pod.Namespace, pod.Spec.ServiceAccountName, &authenticationv1.TokenRequest{
+				Spec: authenticationv1.TokenRequestSpec{
+					Audiences:         auds,
+					ExpirationSeconds: tp.ExpirationSeconds,
+					BoundObjectRef: &authenticationv1.BoundObjectReference{
+						APIVersion: "v1",
+						Kind:       "Pod",
+						Name:       pod.Name,
+						UID:        pod.UID,
+					},
+				},
+			})
+			if err != nil {
+				errlist = append(errlist, err)
+				continue
+			}
+			payload[tp.Path] = FileProjection{
+				Data: []byte(tr.Status.Token),
+				Mode: *defaultMode,
+			}
+		}
+	}
+	return payload, utilerrors.NewAggregate(errlist)
+}
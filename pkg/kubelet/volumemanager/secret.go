@@ -0,0 +1,125 @@
+package volumemanager
+
+import (
+	"fmt"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/klog/v2"
+)
+
+const secretPluginName = "kubernetes.io~secret"
+
+type secretPlugin struct {
+	host VolumeHost
+}
+
+func (plugin *secretPlugin) GetPluginName() string {
+	return secretPluginName
+}
+
+func (plugin *secretPlugin) CanSupport(volume *v1.Volume) bool {
+	return volume.Secret != nil
+}
+
+func (plugin *secretPlugin) RequiresRemount() bool {
+	return true
+}
+
+func (plugin *secretPlugin) GetAttributes() Attributes {
+	return Attributes{
+		ReadOnly: true,
+		Managed:  true,
+	}
+}
+
+func (plugin *secretPlugin) SetUp(pod *v1.Pod, volume *v1.Volume, dir string) (string, error) {
+	source := volume.Secret
+	optional := source.Optional != nil && *source.Optional
+	secret, err := plugin.host.GetSecretFunc()(pod.Namespace, source.SecretName)
+	if err != nil {
+		if !(errors.IsNotFound(err) && optional) {
+			klog.ErrorS(err, "Couldn't get secret", "pod", klog.KObj(pod), "secret", source.SecretName)
+			return "", err
+		}
+		secret = &v1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: pod.Namespace,
+				Name:      source.SecretName,
+			},
+		}
+	}
+
+	totalBytes := totalSecretBytes(secret)
+	klog.V(3).InfoS("Received secret", "pod", klog.KObj(pod), "secret", source.SecretName,
+		"dataKeys", len(secret.Data), "totalBytes", totalBytes)
+
+	defaultMode := source.DefaultMode
+	if defaultMode == nil {
+		mode := v1.SecretVolumeSourceDefaultMode
+		defaultMode = &mode
+	}
+	payload, err := MakeSecretPayload(source.Items, secret, defaultMode, optional)
+	if err != nil {
+		return "", err
+	}
+
+	logContext := fmt.Sprintf("pod %v/%v volume %v", pod.Namespace, pod.Name, volume.Name)
+	if err := setUpWrapper(dir, logContext, payload); err != nil {
+		return "", err
+	}
+	return dir, nil
+}
+
+func (plugin *secretPlugin) TearDown(dir string) error {
+	return removeDir(dir)
+}
+
+// MakeSecretPayload function is exported so that it can be called from the projection volume driver
+func MakeSecretPayload(mappings []v1.KeyToPath, secret *v1.Secret, defaultMode *int32, optional bool) (map[string]FileProjection, error) {
+	if defaultMode == nil {
+		return nil, fmt.Errorf("no defaultMode used, not even the default value for it")
+	}
+
+	payload := make(map[string]FileProjection, len(secret.Data))
+	var fileProjection FileProjection
+
+	if len(mappings) == 0 {
+		for name, data := range secret.Data {
+			fileProjection.Data = []byte(data)
+			fileProjection.Mode = *defaultMode
+			payload[name] = fileProjection
+		}
+	} else {
+		for _, ktp := range mappings {
+			content, ok := secret.Data[ktp.Key]
+			if !ok {
+				if optional {
+					continue
+				}
+				err := fmt.Errorf("references non-existent secret key: %s", ktp.Key)
+				klog.ErrorS(err, "Invalid secret volume items", "secret", klog.KObj(secret))
+				return nil, err
+			}
+
+			fileProjection.Data = []byte(content)
+			if ktp.Mode != nil {
+				fileProjection.Mode = *ktp.Mode
+			} else {
+				fileProjection.Mode = *defaultMode
+			}
+			payload[ktp.Path] = fileProjection
+		}
+	}
+	return payload, nil
+}
+
+func totalSecretBytes(secret *v1.Secret) int {
+	totalSize := 0
+	for _, bytes := range secret.Data {
+		totalSize += len(bytes)
+	}
+
+	return totalSize
+}
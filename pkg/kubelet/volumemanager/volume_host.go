@@ -0,0 +1,35 @@
+package volumemanager
+
+import (
+	authenticationv1 "k8s.io/api/authentication/v1"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// VolumeHost is an interface that plugins can use to access the kubelet.
+type VolumeHost interface {
+	// GetPodVolumesDir returns the absolute path to the directory under which
+	// all volumes of the given pod are materialized.
+	GetPodVolumesDir(podUID types.UID) string
+
+	// GetPodVolumeDir returns the absolute path a directory which
+	// represents the named volume under the named plugin for the given
+	// pod.  If the specified pod does not exist, the result of this call
+	// might not exist.
+	GetPodVolumeDir(podUID types.UID, pluginName string, volumeName string) string
+
+	// GetNodeAllocatable returns the node allocatable.
+	GetNodeAllocatable() (v1.ResourceList, error)
+
+	// GetSecretFunc returns a function that returns a secret given its
+	// namespace and name.
+	GetSecretFunc() func(namespace, name string) (*v1.Secret, error)
+
+	// GetConfigMapFunc returns a function that returns a configmap given
+	// its namespace and name.
+	GetConfigMapFunc() func(namespace, name string) (*v1.ConfigMap, error)
+
+	// GetServiceAccountTokenFunc returns a function that requests a token
+	// for the given service account.
+	GetServiceAccountTokenFunc() func(namespace, name string, tr *authenticationv1.TokenRequest) (*authenticationv1.TokenRequest, error)
+}
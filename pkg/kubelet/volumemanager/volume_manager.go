@@ -0,0 +1,237 @@
+package volumemanager
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	kubecontainer "github.com/xuliangTang/mykubelet/pkg/kubelet/container"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/clock"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/klog/v2"
+)
+
+// resyncPeriod is the minimum interval between two refreshes of volumes
+// whose contents come from API objects (configMap, secret, downwardAPI,
+// projected).
+const resyncPeriod = time.Minute
+
+// VolumeManager materializes the volumes of pods scheduled to this node
+// into per-pod directories on the host.
+type VolumeManager interface {
+	// WaitForAttachAndMount sets up all volumes referenced by the pod and
+	// returns once they are ready to be handed to the containers.
+	// Volumes backed by API objects are refreshed at most once per
+	// resyncPeriod.
+	WaitForAttachAndMount(pod *v1.Pod) error
+
+	// GetMountedVolumesForPod returns a VolumeMap containing the volumes
+	// referenced by the specified pod that have been successfully set up.
+	// The key in the map is the OuterVolumeSpecName (i.e.
+	// pod.Spec.Volumes[x].Name). It returns an empty VolumeMap if pod has no
+	// volumes.
+	GetMountedVolumesForPod(podUID types.UID) kubecontainer.VolumeMap
+
+	// UnmountVolumes tears down all volumes of the given pod.
+	UnmountVolumes(podUID types.UID) error
+
+	// PodVolumesExist returns true if any volume of the pod is still
+	// present on disk.
+	PodVolumesExist(podUID types.UID) bool
+}
+
+// mountedPod records the volumes set up for a pod.
+type mountedPod struct {
+	// volumes by pod.Spec.Volumes[x].Name
+	volumes kubecontainer.VolumeMap
+	// plugin directory of each volume, needed for tear down
+	dirs map[string]volumeDir
+	// time of the last refresh of API backed volumes
+	lastSync time.Time
+}
+
+type volumeDir struct {
+	pluginName string
+	path       string
+}
+
+type volumeManager struct {
+	host    VolumeHost
+	plugins []volumePlugin
+	clock   clock.Clock
+
+	// lock guards mountedPods
+	lock        sync.Mutex
+	mountedPods map[types.UID]*mountedPod
+}
+
+// NewVolumeManager returns a new concrete instance implementing the
+// VolumeManager interface.
+func NewVolumeManager(host VolumeHost) VolumeManager {
+	return &volumeManager{
+		host:        host,
+		plugins:     newVolumePlugins(host),
+		clock:       clock.RealClock{},
+		mountedPods: make(map[types.UID]*mountedPod),
+	}
+}
+
+func (vm *volumeManager) WaitForAttachAndMount(pod *v1.Pod) error {
+	if pod == nil {
+		return nil
+	}
+
+	vm.lock.Lock()
+	defer vm.lock.Unlock()
+
+	mounted, ok := vm.mountedPods[pod.UID]
+	if !ok {
+		mounted = &mountedPod{
+			volumes: make(kubecontainer.VolumeMap),
+			dirs:    make(map[string]volumeDir),
+		}
+		vm.mountedPods[pod.UID] = mounted
+	}
+	resync := vm.clock.Since(mounted.lastSync) >= resyncPeriod
+
+	var errs []error
+	for i := range pod.Spec.Volumes {
+		volume := &pod.Spec.Volumes[i]
+		plugin, err := findPluginBySpec(vm.plugins, volume)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if _, exists := mounted.volumes[volume.Name]; exists && !(resync && plugin.RequiresRemount()) {
+			continue
+		}
+
+		dir := vm.host.GetPodVolumeDir(pod.UID, plugin.GetPluginName(), volume.Name)
+		hostPath, err := plugin.SetUp(pod, volume, dir)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("volume %q: %v", volume.Name, err))
+			continue
+		}
+		if attributes := plugin.GetAttributes(); attributes.Managed && pod.Spec.SecurityContext != nil {
+			// Contents written by SetUp belong to the kubelet, hand them over
+			// to the fsGroup of the pod on every set up.
+			if err := SetVolumeOwnership(hostPath, attributes.ReadOnly, pod.Spec.SecurityContext.FSGroup, pod.Spec.SecurityContext.FSGroupChangePolicy); err != nil {
+				errs = append(errs, fmt.Errorf("volume %q: failed to set ownership: %v", volume.Name, err))
+				continue
+			}
+		}
+		klog.V(4).InfoS("Volume set up", "pod", klog.KObj(pod), "volume", volume.Name, "plugin", plugin.GetPluginName(), "path", hostPath)
+		mounted.volumes[volume.Name] = kubecontainer.VolumeInfo{
+			HostPath: hostPath,
+			ReadOnly: isReadOnlyVolume(volume),
+		}
+		mounted.dirs[volume.Name] = volumeDir{pluginName: plugin.GetPluginName(), path: dir}
+	}
+	if len(errs) > 0 {
+		return utilerrors.NewAggregate(errs)
+	}
+	if resync {
+		mounted.lastSync = vm.clock.Now()
+	}
+	return nil
+}
+
+func (vm *volumeManager) GetMountedVolumesForPod(podUID types.UID) kubecontainer.VolumeMap {
+	vm.lock.Lock()
+	defer vm.lock.Unlock()
+
+	podVolumes := make(kubecontainer.VolumeMap)
+	if mounted, ok := vm.mountedPods[podUID]; ok {
+		for name, info := range mounted.volumes {
+			podVolumes[name] = info
+		}
+	}
+	return podVolumes
+}
+
+func (vm *volumeManager) UnmountVolumes(podUID types.UID) error {
+	vm.lock.Lock()
+	defer vm.lock.Unlock()
+
+	dirs := vm.podVolumeDirs(podUID)
+	var errs []error
+	for name, dir := range dirs {
+		plugin := findPluginByName(vm.plugins, dir.pluginName)
+		if plugin == nil {
+			// 未知插件的目录，直接删除
+			if err := removeDir(dir.path); err != nil {
+				errs = append(errs, err)
+			}
+			continue
+		}
+		if err := plugin.TearDown(dir.path); err != nil {
+			errs = append(errs, fmt.Errorf("volume %q: %v", name, err))
+			continue
+		}
+		klog.V(4).InfoS("Volume torn down", "podUID", podUID, "volume", name, "plugin", dir.pluginName)
+	}
+	if len(errs) > 0 {
+		return utilerrors.NewAggregate(errs)
+	}
+
+	for _, plugin := range vm.plugins {
+		if p, ok := plugin.(*projectedPlugin); ok {
+			p.tokens.DeleteServiceAccountToken(podUID)
+		}
+	}
+	delete(vm.mountedPods, podUID)
+	return nil
+}
+
+// podVolumeDirs returns the plugin directories of the pod. Pods set up by a
+// previous kubelet process are not known in memory, so their directories
+// are discovered from disk. The caller must hold the lock.
+func (vm *volumeManager) podVolumeDirs(podUID types.UID) map[string]volumeDir {
+	if mounted, ok := vm.mountedPods[podUID]; ok {
+		return mounted.dirs
+	}
+
+	dirs := make(map[string]volumeDir)
+	volumesDir := vm.host.GetPodVolumesDir(podUID)
+	pluginEntries, err := os.ReadDir(volumesDir)
+	if err != nil {
+		return dirs
+	}
+	for _, pluginEntry := range pluginEntries {
+		if !pluginEntry.IsDir() {
+			continue
+		}
+		volumeEntries, err := os.ReadDir(vm.host.GetPodVolumeDir(podUID, pluginEntry.Name(), ""))
+		if err != nil {
+			continue
+		}
+		for _, volumeEntry := range volumeEntries {
+			dirs[volumeEntry.Name()] = volumeDir{
+				pluginName: pluginEntry.Name(),
+				path:       vm.host.GetPodVolumeDir(podUID, pluginEntry.Name(), volumeEntry.Name()),
+			}
+		}
+	}
+	return dirs
+}
+
+func (vm *volumeManager) PodVolumesExist(podUID types.UID) bool {
+	vm.lock.Lock()
+	defer vm.lock.Unlock()
+
+	for _, dir := range vm.podVolumeDirs(podUID) {
+		if _, err := os.Lstat(dir.path); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// isReadOnlyVolume returns true for volume types whose contents are owned by
+// the kubelet and must not be modified by containers.
+func isReadOnlyVolume(volume *v1.Volume) bool {
+	return volume.ConfigMap != nil || volume.Secret != nil || volume.DownwardAPI != nil || volume.Projected != nil
+}
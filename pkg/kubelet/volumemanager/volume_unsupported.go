@@ -0,0 +1,13 @@
+//go:build !linux
+// +build !linux
+
+package volumemanager
+
+import (
+	v1 "k8s.io/api/core/v1"
+)
+
+// SetVolumeOwnership does nothing on platforms without unix ownership.
+func SetVolumeOwnership(dir string, readonly bool, fsGroup *int64, fsGroupChangePolicy *v1.PodFSGroupChangePolicy) error {
+	return nil
+}
@@ -1,7 +1,11 @@
 package exec
 
 import (
+	"bytes"
+
 	"github.com/xuliangTang/mykubelet/pkg/probe"
+	"github.com/xuliangTang/mykubelet/pkg/util/ioutils"
+	"k8s.io/klog/v2"
 
 	"k8s.io/utils/exec"
 )
@@ -22,7 +26,38 @@ type Prober interface {
 
 type execProber struct{}
 
-// Probe 不支持
+// Probe executes a command to check the liveness/readiness of container
+// from executing a command. Returns the Result status, command output, and
+// errors if any.
 func (pr execProber) Probe(e exec.Cmd) (probe.Result, string, error) {
-	return probe.Success, string(""), nil
+	var dataBuffer bytes.Buffer
+	writer := ioutils.LimitWriter(&dataBuffer, maxReadLength)
+
+	e.SetStderr(writer)
+	e.SetStdout(writer)
+	err := e.Start()
+	if err == nil {
+		err = e.Wait()
+	}
+	data := dataBuffer.Bytes()
+
+	klog.V(4).Infof("Exec probe response: %q", string(data))
+	if err != nil {
+		exit, ok := err.(exec.ExitError)
+		if ok {
+			if exit.ExitStatus() == 0 {
+				return probe.Success, string(data), nil
+			}
+			return probe.Failure, string(data), nil
+		}
+
+		timeoutErr, ok := err.(*TimeoutError)
+		if ok {
+			// When exec probe timeout, data is empty, so we should return timeoutErr.Error() as the stdout.
+			return probe.Failure, timeoutErr.Error(), nil
+		}
+
+		return probe.Unknown, "", err
+	}
+	return probe.Success, string(data), nil
 }
@@ -0,0 +1,16 @@
+//go:build linux
+// +build linux
+
+package filesystem
+
+import "golang.org/x/sys/unix"
+
+// Info returns the bytes available to unprivileged users and the capacity
+// of the filesystem path lives on.
+func Info(path string) (available, capacity uint64, err error) {
+	var statfs unix.Statfs_t
+	if err := unix.Statfs(path, &statfs); err != nil {
+		return 0, 0, err
+	}
+	return statfs.Bavail * uint64(statfs.Bsize), statfs.Blocks * uint64(statfs.Bsize), nil
+}
@@ -0,0 +1,11 @@
+//go:build !linux
+// +build !linux
+
+package filesystem
+
+import "errors"
+
+// Info is not supported on this platform.
+func Info(path string) (available, capacity uint64, err error) {
+	return 0, 0, errors.New("filesystem info is not supported on this platform")
+}
@@ -0,0 +1,53 @@
+package filesystem
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// maxSymlinks is how many symlinks SecureJoin follows before giving up.
+const maxSymlinks = 255
+
+// SecureJoin joins unsafePath to root the way it would be resolved by a
+// process chrooted into root: symlinks met along the way are followed, but
+// never out of root. Components that do not exist are joined as they are.
+func SecureJoin(root, unsafePath string) (string, error) {
+	resolved := "/"
+	remaining := strings.Split(path.Clean("/"+filepath.ToSlash(unsafePath)), "/")
+	links := 0
+	for len(remaining) > 0 {
+		component := remaining[0]
+		remaining = remaining[1:]
+		switch component {
+		case "", ".":
+			continue
+		case "..":
+			resolved = path.Dir(resolved)
+			continue
+		}
+
+		next := path.Join(resolved, component)
+		fi, err := os.Lstat(filepath.Join(root, filepath.FromSlash(next)))
+		if err != nil || fi.Mode()&os.ModeSymlink == 0 {
+			resolved = next
+			continue
+		}
+		links++
+		if links > maxSymlinks {
+			return "", fmt.Errorf("too many symlinks resolving %q in %q", unsafePath, root)
+		}
+		dest, err := os.Readlink(filepath.Join(root, filepath.FromSlash(next)))
+		if err != nil {
+			return "", err
+		}
+		dest = filepath.ToSlash(dest)
+		if path.IsAbs(dest) {
+			resolved = "/"
+		}
+		remaining = append(strings.Split(dest, "/"), remaining...)
+	}
+	return filepath.Join(root, filepath.FromSlash(resolved)), nil
+}